@@ -0,0 +1,322 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+
+	"Ejercicio_Final-Taller_Go/internal/anomaly"
+	"Ejercicio_Final-Taller_Go/internal/apikey"
+	"Ejercicio_Final-Taller_Go/internal/audit"
+	"Ejercicio_Final-Taller_Go/internal/bundle"
+	"Ejercicio_Final-Taller_Go/internal/clock"
+	"Ejercicio_Final-Taller_Go/internal/export"
+	"Ejercicio_Final-Taller_Go/internal/idgen"
+	"Ejercicio_Final-Taller_Go/internal/notify"
+	"Ejercicio_Final-Taller_Go/internal/saga"
+	"Ejercicio_Final-Taller_Go/internal/sales"
+	"Ejercicio_Final-Taller_Go/internal/scheduler"
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// adminHandler implements the HTTP handlers of the /admin endpoints.
+type adminHandler struct {
+	salesService *sales.Service
+	keys         apikey.Store
+	meter        *apikey.Meter
+	exporter     *export.Exporter // nil cuando no hay exportación programada
+	jobs         *scheduler.Scheduler
+	anomalies    *anomaly.Analyzer
+	deadLetters  *notify.DeadLetters
+	sagas        *saga.Coordinator
+	bundles      *bundle.Service
+	ids          idgen.Generator
+	clock        clock.Clock
+	logger       *zap.Logger
+}
+
+// handleDashboard handles GET /admin/dashboard
+func (h *adminHandler) handleDashboard(ctx *gin.Context) {
+	d, err := h.salesService.Dashboard(ctx.Request.Context())
+	if err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, d)
+}
+
+// boundTenant returns the tenant the admin key of the request is bound to,
+// or "" for admin keys that act in any tenant. A bound admin only manages
+// the keys of its tenant.
+func boundTenant(ctx *gin.Context) string {
+	if key, ok := apikey.FromContext(ctx.Request.Context()); ok {
+		return key.Tenant
+	}
+	return ""
+}
+
+// scopedKey returns the key of id, or apikey.ErrNotFound when it belongs
+// to a tenant other than the one the admin key of the request is bound to.
+func (h *adminHandler) scopedKey(ctx *gin.Context, id string) (*apikey.Key, error) {
+	key, err := h.keys.Get(ctx.Request.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if bound := boundTenant(ctx); bound != "" && key.Tenant != bound {
+		return nil, apikey.ErrNotFound
+	}
+	return key, nil
+}
+
+// handleKeyUsage handles GET /admin/keys/:id/usage
+// It reports what the key consumed this month next to its quotas.
+func (h *adminHandler) handleKeyUsage(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	key, err := h.scopedKey(ctx, id)
+	if err != nil {
+		writeError(ctx, h.logger, err, zap.String("api_key", id))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"usage":         h.meter.Usage(key.ID),
+		"request_quota": key.RequestQuota,
+		"sale_quota":    key.SaleQuota,
+		"resets_at":     h.meter.Reset(),
+	})
+}
+
+// handleCreateKey handles POST /admin/apikeys
+// The secret of the new key is only returned in this response. The key is
+// bound to the tenant given, or else to the tenant of the request; an
+// admin key bound to a tenant can only create keys of its own.
+func (h *adminHandler) handleCreateKey(ctx *gin.Context) {
+	var req struct {
+		Name         string `json:"name"`
+		RequestQuota int64  `json:"request_quota"`
+		SaleQuota    int64  `json:"sale_quota"`
+		Tenant       string `json:"tenant"`
+	}
+	if err := bindJSON(ctx, &req); err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+	if bound := boundTenant(ctx); bound != "" && req.Tenant != "" && req.Tenant != bound {
+		writeError(ctx, h.logger, apikey.ErrTenantNotAllowed, zap.String("tenant", req.Tenant))
+		return
+	}
+	if req.Tenant == "" {
+		req.Tenant = tenant.FromContext(ctx.Request.Context())
+	}
+	if err := tenant.Validate(req.Tenant); err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+
+	key, secret, err := apikey.Generate(h.ids.NewID(), req.Name, req.RequestQuota, req.SaleQuota, h.clock.Now())
+	if err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+	key.Tenant = req.Tenant
+	if err := h.keys.Save(ctx.Request.Context(), key); err != nil {
+		writeError(ctx, h.logger, err, zap.String("api_key", key.ID))
+		return
+	}
+
+	requestLogger(ctx, h.logger).Info("API key created", zap.String("api_key", key.ID), zap.String("name", key.Name))
+	ctx.JSON(http.StatusCreated, struct {
+		*apikey.Key
+		Secret string `json:"secret"`
+	}{key, secret})
+}
+
+// handleListKeys handles GET /admin/apikeys
+// An admin key bound to a tenant only sees the keys of its tenant.
+func (h *adminHandler) handleListKeys(ctx *gin.Context) {
+	keys, err := h.keys.List(ctx.Request.Context())
+	if err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+	if bound := boundTenant(ctx); bound != "" {
+		keys = slices.DeleteFunc(keys, func(k *apikey.Key) bool { return k.Tenant != bound })
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"results": keys})
+}
+
+// handleRevokeKey handles DELETE /admin/apikeys/:id
+func (h *adminHandler) handleRevokeKey(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	if _, err := h.scopedKey(ctx, id); err != nil {
+		writeError(ctx, h.logger, err, zap.String("api_key", id))
+		return
+	}
+	if err := h.keys.Revoke(ctx.Request.Context(), id, h.clock.Now()); err != nil {
+		writeError(ctx, h.logger, err, zap.String("api_key", id))
+		return
+	}
+
+	requestLogger(ctx, h.logger).Info("API key revoked", zap.String("api_key", id))
+	ctx.Status(http.StatusNoContent)
+}
+
+// handleUnarchiveSale handles POST /admin/sales/:id/unarchive
+// It moves an archived sale back to the primary store.
+func (h *adminHandler) handleUnarchiveSale(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	sale, err := h.salesService.Unarchive(ctx.Request.Context(), id)
+	if err != nil {
+		writeError(ctx, h.logger, err, zap.String("sale_id", id))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newSaleResource(sale, h.salesService.Clock().Now()))
+}
+
+// handleForceStatus handles POST /admin/sales/:id/force-status
+// It sets the status of a sale outside the normal transitions, to correct
+// sales broken by payment incidents. Only admin keys can use it.
+func (h *adminHandler) handleForceStatus(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	var req struct {
+		Status          sales.SaleStatus `json:"status"`
+		Reason          string           `json:"reason"`
+		RejectionReason string           `json:"rejection_reason"`
+	}
+	if err := bindJSON(ctx, &req); err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	review := sales.Review{Actor: audit.ActorFromContext(reqCtx), Reason: req.Reason, RejectionReason: req.RejectionReason}
+	sale, err := h.salesService.ForceStatus(reqCtx, id, req.Status, review)
+	if err != nil {
+		writeError(ctx, h.logger, err, zap.String("sale_id", id))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newSaleResource(sale, h.salesService.Clock().Now()))
+}
+
+// handleSaleAudit handles GET /admin/sales/:id/audit
+// It lists the forced changes and reprocessings of a sale, oldest first.
+func (h *adminHandler) handleSaleAudit(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	entries, err := h.salesService.AuditLog(ctx.Request.Context(), id)
+	if err != nil {
+		writeError(ctx, h.logger, err, zap.String("sale_id", id))
+		return
+	}
+
+	if entries == nil {
+		entries = []audit.Entry{}
+	}
+	ctx.JSON(http.StatusOK, gin.H{"sale_id": id, "audit": entries})
+}
+
+// handleExportConfig handles GET /admin/config
+// It returns the webhooks, API key metadata and thresholds as one bundle.
+func (h *adminHandler) handleExportConfig(ctx *gin.Context) {
+	b, err := h.bundles.Export(ctx.Request.Context())
+	if err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, b)
+}
+
+// handleImportConfig handles POST /admin/config/import
+// It applies a bundle exported by GET /admin/config, possibly in another
+// environment. The secrets of the webhooks it creates are only returned here.
+// The thresholds of the bundle apply to every tenant, so admins bound to
+// one cannot import.
+func (h *adminHandler) handleImportConfig(ctx *gin.Context) {
+	if bound := boundTenant(ctx); bound != "" {
+		writeError(ctx, h.logger, errUnboundAdminRequired, zap.String("tenant", bound))
+		return
+	}
+
+	var b bundle.Bundle
+	if err := bindJSON(ctx, &b); err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+
+	result, err := h.bundles.Import(ctx.Request.Context(), &b)
+	if err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+// handleGetSaga handles GET /admin/sagas/:id
+// It reports the steps of a saga and whether they were compensated.
+func (h *adminHandler) handleGetSaga(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	state, err := h.sagas.Get(ctx.Request.Context(), id)
+	if err != nil {
+		writeError(ctx, h.logger, err, zap.String("saga_id", id))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, state)
+}
+
+// handleExportStatus handles GET /admin/exports/status
+// It reports the last run and the last successful run of the nightly export.
+func (h *adminHandler) handleExportStatus(ctx *gin.Context) {
+	if h.exporter == nil {
+		writeError(ctx, h.logger, errExportsDisabled)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, h.exporter.Status())
+}
+
+// handleListJobs handles GET /admin/jobs
+// It lists the background jobs with their last runs and next run time, and
+// whether this instance is the leader that runs them.
+func (h *adminHandler) handleListJobs(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"results": h.jobs.Jobs(), "leader": h.jobs.Leader()})
+}
+
+// handleListAlerts handles GET /admin/alerts
+// It lists the recent sales anomalies of the tenant, newest first.
+func (h *adminHandler) handleListAlerts(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"results": h.anomalies.Alerts(ctx.Request.Context())})
+}
+
+// handleListDeadLetters handles GET /admin/dlq
+// It lists the notifications dropped after exhausting their attempts.
+func (h *adminHandler) handleListDeadLetters(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"results": h.deadLetters.List()})
+}
+
+// handleReplayDeadLetter handles POST /admin/dlq/:id/replay
+// It queues the notification for delivery again.
+func (h *adminHandler) handleReplayDeadLetter(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	if err := h.deadLetters.Replay(ctx.Request.Context(), id); err != nil {
+		writeError(ctx, h.logger, err, zap.String("dead_letter", id))
+		return
+	}
+
+	requestLogger(ctx, h.logger).Info("dead letter replayed", zap.String("dead_letter", id))
+	ctx.Status(http.StatusAccepted)
+}
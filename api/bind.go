@@ -0,0 +1,121 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"Ejercicio_Final-Taller_Go/internal/apperrors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// maxJSONDepth caps the nesting of request bodies. No request needs more
+// than a couple of levels; deeper bodies are rejected before decoding.
+const maxJSONDepth = 32
+
+// errBodyTooLarge is returned for bodies over the MaxBodyBytes limit.
+var errBodyTooLarge = apperrors.New(apperrors.TooLarge, "body_too_large", "request body is too large")
+
+// errBodyTooDeep is returned for bodies nested deeper than maxJSONDepth.
+var errBodyTooDeep = apperrors.New(apperrors.Validation, "body_too_deep", "request body is nested too deeply")
+
+// errUnknownField is returned by bindStrictJSON for bodies with fields v does not have.
+var errUnknownField = apperrors.New(apperrors.Validation, "unknown_field", "request body has unknown fields")
+
+// bindJSON decodes the JSON body of the request into v, like
+// ShouldBindJSON, after checking its size and nesting. Every error it
+// returns is tagged for writeError.
+func bindJSON(ctx *gin.Context, v any) error {
+	body, err := readBody(ctx)
+	if err != nil {
+		return err
+	}
+	if err := binding.JSON.BindBody(body, v); err != nil {
+		return invalidBody(err)
+	}
+	return nil
+}
+
+// bindStrictJSON is like bindJSON but fails with errUnknownField when the
+// body has fields v does not, for requests that replace a whole resource.
+func bindStrictJSON(ctx *gin.Context, v any) error {
+	body, err := readBody(ctx)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		// encoding/json no tiene un tipo para este error
+		if strings.HasPrefix(err.Error(), "json: unknown field ") {
+			return errUnknownField.Wrap(err)
+		}
+		return invalidBody(err)
+	}
+	return nil
+}
+
+// readBody reads the body of the request, checking its size and nesting.
+func readBody(ctx *gin.Context) ([]byte, error) {
+	body, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, errBodyTooLarge
+		}
+		return nil, invalidBody(err)
+	}
+	if jsonDepth(body) > maxJSONDepth {
+		return nil, errBodyTooDeep
+	}
+	return body, nil
+}
+
+// jsonDepth returns the deepest nesting of arrays and objects in data,
+// which need not be valid JSON.
+func jsonDepth(data []byte) int {
+	depth, deepest := 0, 0
+	inString, escaped := false, false
+	for _, b := range data {
+		switch {
+		case escaped:
+			escaped = false
+		case inString:
+			switch b {
+			case '\\':
+				escaped = true
+			case '"':
+				inString = false
+			}
+		case b == '"':
+			inString = true
+		case b == '{' || b == '[':
+			depth++
+			deepest = max(deepest, depth)
+		case b == '}' || b == ']':
+			depth--
+		}
+	}
+	return deepest
+}
+
+// bodyLimitMiddleware stops reading request bodies after limit bytes, so
+// an oversized body fails to bind instead of being held in memory.
+// A limit of 0 or less disables it.
+func bodyLimitMiddleware(limit int64) gin.HandlerFunc {
+	if limit <= 0 {
+		return noopMiddleware
+	}
+
+	return func(ctx *gin.Context) {
+		if ctx.Request.Body != nil {
+			ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, limit)
+		}
+		ctx.Next()
+	}
+}
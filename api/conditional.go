@@ -0,0 +1,59 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// versionETag builds the strong entity tag for a resource version.
+func versionETag(version int) string {
+	return `"v` + strconv.Itoa(version) + `"`
+}
+
+// ifMatchVersion returns the version named by an If-Match header value
+// built by versionETag, and false for "*", which any version matches.
+// Strong comparison is used, as RFC 9110 mandates for If-Match.
+func ifMatchVersion(header string) (int, bool, error) {
+	header = strings.TrimSpace(header)
+	if header == "*" {
+		return 0, false, nil
+	}
+	v, ok := strings.CutPrefix(header, `"v`)
+	if ok {
+		v, ok = strings.CutSuffix(v, `"`)
+	}
+	version, err := strconv.Atoi(v)
+	if !ok || err != nil {
+		return 0, false, fmt.Errorf("%w: got %q", errInvalidIfMatch, header)
+	}
+	return version, true, nil
+}
+
+// ifMatch returns the version the If-Match header of the request requires,
+// or nil when it has none or it is "*".
+func ifMatch(ctx *gin.Context) (*int, error) {
+	match := ctx.GetHeader("If-Match")
+	if match == "" {
+		return nil, nil
+	}
+	version, ok, err := ifMatchVersion(match)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// etagMatches reports whether an If-None-Match header value matches etag.
+// Weak comparison is used, as RFC 9110 mandates for If-None-Match.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
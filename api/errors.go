@@ -0,0 +1,133 @@
+package api
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"Ejercicio_Final-Taller_Go/internal/apperrors"
+	"Ejercicio_Final-Taller_Go/internal/i18n"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// problemContentType and problemXMLContentType are the media types of
+// error bodies (RFC 7807).
+const (
+	problemContentType    = "application/problem+json"
+	problemXMLContentType = "application/problem+xml"
+)
+
+// problem is the body written for every failed request.
+type problem struct {
+	XMLName xml.Name `json:"-" xml:"urn:ietf:rfc:7807 problem"`
+	Title   string   `json:"title" xml:"title"`
+	Status  int      `json:"status" xml:"status"`
+	Detail  string   `json:"detail" xml:"detail"`
+	Code    string   `json:"code" xml:"code"`
+}
+
+// invalidBody tags a request binding error as a validation error, unless it
+// already carries an apperrors kind (e.g. an invalid enum value).
+func invalidBody(err error) error {
+	var appErr *apperrors.Error
+	if errors.As(err, &appErr) {
+		return err
+	}
+	return errInvalidRequestBody.Wrap(fmt.Errorf("invalid request body: %w", err))
+}
+
+// errInvalidRequestBody is the template of the errors returned by invalidBody.
+var errInvalidRequestBody = apperrors.New(apperrors.Validation, "invalid_request_body", "invalid request body")
+
+// errInvalidPagination is returned for malformed limit/offset query parameters.
+var errInvalidPagination = apperrors.New(apperrors.Validation, "invalid_pagination", "invalid pagination parameters")
+
+// errInvalidCountOnly is returned for a count_only query parameter that is not a boolean.
+var errInvalidCountOnly = apperrors.New(apperrors.Validation, "invalid_count_only", "count_only must be a boolean")
+
+// errInvalidExportFormat is returned for a format query parameter naming no export format.
+var errInvalidExportFormat = apperrors.New(apperrors.Validation, "invalid_export_format", "format must be ndjson, parquet or msgpack")
+
+// errInvalidAt is returned for an at query parameter that is not an RFC 3339 timestamp.
+var errInvalidAt = apperrors.New(apperrors.Validation, "invalid_at", "at must be an RFC 3339 timestamp")
+
+// errExportsDisabled is returned by the export status endpoint when no export target is configured.
+var errExportsDisabled = apperrors.New(apperrors.NotFound, "exports_disabled", "scheduled exports are not configured")
+
+// errExportJobsDisabled is returned by the export job endpoints when no bucket is configured for them.
+var errExportJobsDisabled = apperrors.New(apperrors.NotFound, "export_jobs_disabled", "export jobs are not configured")
+
+// errPanic is written when a handler panics.
+var errPanic = apperrors.New(apperrors.Internal, "panic", "internal error")
+
+// errRequestTimeout is written when a request runs past its route deadline.
+var errRequestTimeout = apperrors.New(apperrors.Timeout, "request_timeout", "request timed out")
+
+// errInvalidIfMatch is returned for an If-Match header that is not a single
+// entity tag of this API, such as "v3".
+var errInvalidIfMatch = apperrors.New(apperrors.Validation, "invalid_if_match", `If-Match must be a single entity tag such as "v3"`)
+
+// errInvalidDateRange is returned for from/to query parameters that are not
+// dates or RFC 3339 timestamps, or where to is not after from.
+var errInvalidDateRange = apperrors.New(apperrors.Validation, "invalid_date_range", "from and to must be dates or RFC 3339 timestamps, to after from")
+
+// writeError maps err to its HTTP status through apperrors and writes it as a
+// problem+json body, or problem+xml when the client asks for XML. Server-side failures are logged at Error level together
+// with the request ID and the given fields, and their details are not exposed.
+// The detail is localized from the Accept-Language header; the code is not.
+// Errors caused by the request deadline are reported as errRequestTimeout,
+// unless they already name the dependency that ran out of time.
+func writeError(ctx *gin.Context, logger *zap.Logger, err error, fields ...zap.Field) {
+	if errors.Is(err, context.DeadlineExceeded) && apperrors.KindOf(err) != apperrors.Timeout {
+		err = fmt.Errorf("%w: %w", errRequestTimeout, err)
+	}
+
+	if apperrors.HTTPStatus(err) >= http.StatusInternalServerError {
+		requestLogger(ctx, logger).Error("request failed", append(fields, zap.Error(err))...)
+	}
+
+	p := newProblem(ctx, err)
+	if wantsXML(ctx) {
+		ctx.Header("Content-Type", problemXMLContentType)
+		ctx.Abort()
+		ctx.XML(p.Status, p)
+		return
+	}
+	ctx.Header("Content-Type", problemContentType)
+	ctx.AbortWithStatusJSON(p.Status, p)
+}
+
+// newProblem describes err as a problem localized for the request, also
+// setting the Content-Language header. Internal errors are not detailed.
+func newProblem(ctx *gin.Context, err error) problem {
+	status := apperrors.HTTPStatus(err)
+	code := apperrors.CodeOf(err)
+	if status >= http.StatusInternalServerError && apperrors.KindOf(err) == apperrors.Internal {
+		code = "internal_error"
+	}
+
+	lang := i18n.Negotiate(ctx.GetHeader("Accept-Language"))
+	ctx.Header("Content-Language", lang)
+	return problem{
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: i18n.Message(lang, code, err.Error()),
+		Code:   code,
+	}
+}
+
+// handleErrorCatalog lists every error code the API can answer with, its
+// HTTP status and its description in the language asked for.
+func handleErrorCatalog(ctx *gin.Context) {
+	lang := i18n.Negotiate(ctx.GetHeader("Accept-Language"))
+	entries := apperrors.Catalog()
+	for i := range entries {
+		entries[i].Description = i18n.Message(lang, entries[i].Code, entries[i].Description)
+	}
+	ctx.Header("Content-Language", lang)
+	ctx.JSON(http.StatusOK, gin.H{"results": entries})
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"net/http"
+	"path"
+
+	"Ejercicio_Final-Taller_Go/internal/export"
+	"Ejercicio_Final-Taller_Go/internal/sales"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// exportHandler implements the HTTP handlers of the /sales/exports endpoints.
+type exportHandler struct {
+	jobs   *export.Jobs // nil cuando no están configuradas
+	logger *zap.Logger
+}
+
+// exportJobResponse is an export job with the link its file is downloaded
+// from once it succeeded.
+type exportJobResponse struct {
+	*export.Job
+	DownloadURL string `json:"download_url,omitempty"`
+}
+
+// newExportJobResponse describes job, linking its download below base, the
+// path of the export job endpoints.
+func newExportJobResponse(base string, job *export.Job) exportJobResponse {
+	resp := exportJobResponse{Job: job}
+	if job.Status == export.JobSucceeded {
+		resp.DownloadURL = base + "/" + job.ID + "/download"
+	}
+	return resp
+}
+
+// handleCreateExport handles POST /sales/exports
+// It queues an export of the sales matching the optional user_id and status
+// of the body, as ndjson or, with "format": "msgpack", MessagePack.
+func (h *exportHandler) handleCreateExport(ctx *gin.Context) {
+	if h.jobs == nil {
+		writeError(ctx, h.logger, errExportJobsDisabled)
+		return
+	}
+
+	var req struct {
+		Format string           `json:"format"`
+		UserID string           `json:"user_id"`
+		Status sales.SaleStatus `json:"status"`
+	}
+	// el cuerpo es opcional
+	if ctx.Request.ContentLength != 0 {
+		if err := bindJSON(ctx, &req); err != nil {
+			writeError(ctx, h.logger, err)
+			return
+		}
+	}
+	if req.Format == "" {
+		req.Format = "ndjson"
+	}
+	format, err := export.LookupFormat(req.Format)
+	if err != nil {
+		writeError(ctx, h.logger, errInvalidExportFormat)
+		return
+	}
+
+	job, err := h.jobs.Create(ctx.Request.Context(), format, req.UserID, req.Status)
+	if err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+
+	ctx.Header("Location", ctx.Request.URL.Path+"/"+job.ID)
+	ctx.JSON(http.StatusAccepted, newExportJobResponse(ctx.Request.URL.Path, job))
+}
+
+// handleGetExport handles GET /sales/exports/:id
+// It reports the progress of an export job and, once it succeeded, its download link.
+func (h *exportHandler) handleGetExport(ctx *gin.Context) {
+	id := ctx.Param("id")
+	if h.jobs == nil {
+		writeError(ctx, h.logger, errExportJobsDisabled)
+		return
+	}
+
+	job, err := h.jobs.Get(ctx.Request.Context(), id)
+	if err != nil {
+		writeError(ctx, h.logger, err, zap.String("job_id", id))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newExportJobResponse(path.Dir(ctx.Request.URL.Path), job))
+}
+
+// handleDownloadExport handles GET /sales/exports/:id/download
+// It returns the file of a succeeded export job.
+func (h *exportHandler) handleDownloadExport(ctx *gin.Context) {
+	id := ctx.Param("id")
+	if h.jobs == nil {
+		writeError(ctx, h.logger, errExportJobsDisabled)
+		return
+	}
+
+	job, err := h.jobs.Get(ctx.Request.Context(), id)
+	if err != nil {
+		writeError(ctx, h.logger, err, zap.String("job_id", id))
+		return
+	}
+	if job.Status != export.JobSucceeded {
+		writeError(ctx, h.logger, export.ErrJobNotFinished, zap.String("job_id", id))
+		return
+	}
+	format, err := export.LookupFormat(job.Format)
+	if err != nil {
+		writeError(ctx, h.logger, err, zap.String("job_id", id))
+		return
+	}
+
+	ctx.Header("Content-Type", format.ContentType)
+	ctx.Header("Content-Disposition", `attachment; filename="sales-`+job.ID+format.Extension+`"`)
+	ctx.Status(http.StatusOK)
+	if err := h.jobs.Download(ctx.Request.Context(), job, ctx.Writer); err != nil {
+		// headers are already sent, so the client only sees a truncated file
+		requestLogger(ctx, h.logger).Warn("export download interrupted", zap.String("job_id", id), zap.Error(err))
+	}
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"compress/gzip"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// gzipMiddleware compresses responses with gzip for clients that accept it.
+// The gzip stream is only started on the first body write, so empty
+// responses such as 204 and 304 are passed through untouched.
+func gzipMiddleware(level int) (gin.HandlerFunc, error) {
+	// fail fast on an invalid level instead of on the first request
+	if _, err := gzip.NewWriterLevel(nil, level); err != nil {
+		return nil, err
+	}
+
+	pool := &sync.Pool{New: func() any {
+		gz, _ := gzip.NewWriterLevel(nil, level)
+		return gz
+	}}
+
+	return func(ctx *gin.Context) {
+		// la respuesta depende del encabezado aunque no se comprima
+		ctx.Header("Vary", "Accept-Encoding")
+		if !acceptsGzip(ctx.GetHeader("Accept-Encoding")) {
+			ctx.Next()
+			return
+		}
+
+		w := &gzipWriter{ResponseWriter: ctx.Writer, pool: pool}
+		ctx.Writer = w
+		defer w.close()
+
+		ctx.Next()
+	}, nil
+}
+
+// acceptsGzip reports whether an Accept-Encoding header value accepts gzip,
+// honoring q-values: gzip;q=0 refuses it, and so does *;q=0 unless gzip is
+// listed on its own.
+func acceptsGzip(acceptEncoding string) bool {
+	gzipQ, anyQ := -1.0, -1.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		switch strings.ToLower(strings.TrimSpace(coding)) {
+		case "gzip", "x-gzip":
+			gzipQ = q
+		case "*":
+			anyQ = q
+		}
+	}
+
+	if gzipQ >= 0 {
+		return gzipQ > 0
+	}
+	return anyQ > 0
+}
+
+// noopMiddleware is used in place of optional middlewares that are disabled.
+func noopMiddleware(ctx *gin.Context) {
+	ctx.Next()
+}
+
+// gzipWriter is a gin.ResponseWriter that compresses the body.
+type gzipWriter struct {
+	gin.ResponseWriter
+	pool *sync.Pool
+	gz   *gzip.Writer
+}
+
+func (w *gzipWriter) start() {
+	if w.gz != nil {
+		return
+	}
+
+	h := w.ResponseWriter.Header()
+	h.Set("Content-Encoding", "gzip")
+	h.Del("Content-Length")
+
+	w.gz = w.pool.Get().(*gzip.Writer)
+	w.gz.Reset(w.ResponseWriter)
+}
+
+func (w *gzipWriter) Write(data []byte) (int, error) {
+	w.start()
+	return w.gz.Write(data)
+}
+
+func (w *gzipWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *gzipWriter) Flush() {
+	if w.gz != nil {
+		_ = w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *gzipWriter) close() {
+	if w.gz == nil {
+		return
+	}
+
+	_ = w.gz.Close()
+	w.pool.Put(w.gz)
+	w.gz = nil
+}
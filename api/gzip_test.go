@@ -0,0 +1,94 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	for header, want := range map[string]bool{
+		"":                      false,
+		"gzip":                  true,
+		"deflate, gzip":         true,
+		"GZIP;q=0.5":            true,
+		"x-gzip":                true,
+		"gzip;q=0":              false,
+		"gzip;q=0.000":          false,
+		"gzip;q=0, *":           false,
+		"br, *;q=0.1":           true,
+		"*;q=0":                 false,
+		"identity":              false,
+		"gzip;q=bad, identity":  false,
+		"br;q=1.0, gzip;q=0.8 ": true,
+	} {
+		require.Equal(t, want, acceptsGzip(header), header)
+	}
+}
+
+func TestGzipMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	compress, err := gzipMiddleware(gzip.BestSpeed)
+	require.NoError(t, err)
+
+	var res *httptest.ResponseRecorder
+	var flushed []byte
+	app := gin.New()
+	app.Use(compress)
+	app.GET("/body", func(ctx *gin.Context) { ctx.String(http.StatusOK, "hola mundo") })
+	app.GET("/empty", func(ctx *gin.Context) { ctx.Status(http.StatusNoContent) })
+	app.GET("/cached", func(ctx *gin.Context) { ctx.Status(http.StatusNotModified) })
+	app.GET("/stream", func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+		_, _ = ctx.Writer.WriteString("uno\n")
+		ctx.Writer.Flush()
+		flushed = bytes.Clone(res.Body.Bytes())
+		_, _ = ctx.Writer.WriteString("dos\n")
+	})
+
+	get := func(path, acceptEncoding string) {
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		res = httptest.NewRecorder()
+		app.ServeHTTP(res, req)
+	}
+	// gunzip devuelve lo que se puede descomprimir de data, aunque esté incompleto
+	gunzip := func(data []byte) string {
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		require.NoError(t, err)
+		body, _ := io.ReadAll(r)
+		return string(body)
+	}
+
+	// los escritores del pool se reutilizan sin mezclar las respuestas
+	for range 3 {
+		get("/body", "gzip")
+		require.Equal(t, "gzip", res.Header().Get("Content-Encoding"))
+		require.Equal(t, "Accept-Encoding", res.Header().Get("Vary"))
+		require.Equal(t, "hola mundo", gunzip(res.Body.Bytes()))
+	}
+
+	get("/body", "gzip;q=0")
+	require.Empty(t, res.Header().Get("Content-Encoding"))
+	require.Equal(t, "Accept-Encoding", res.Header().Get("Vary"))
+	require.Equal(t, "hola mundo", res.Body.String())
+
+	for path, code := range map[string]int{"/empty": http.StatusNoContent, "/cached": http.StatusNotModified} {
+		get(path, "gzip")
+		require.Equal(t, code, res.Code)
+		require.Empty(t, res.Header().Get("Content-Encoding"))
+		require.Empty(t, res.Body.Bytes())
+	}
+
+	// lo escrito antes de Flush llega al cliente antes de terminar la respuesta
+	get("/stream", "gzip")
+	require.True(t, res.Flushed)
+	require.Equal(t, "uno\n", gunzip(flushed))
+	require.Equal(t, "uno\ndos\n", gunzip(res.Body.Bytes()))
+}
@@ -1,8 +1,13 @@
 package api
 
 import (
+	"Ejercicio_Final-Taller_Go/internal/apperrors"
+	"Ejercicio_Final-Taller_Go/internal/audit"
+	"Ejercicio_Final-Taller_Go/internal/money"
+	"Ejercicio_Final-Taller_Go/internal/sales"
 	"Ejercicio_Final-Taller_Go/internal/user"
-	"errors"
+	"context"
+	"encoding/xml"
 	"net/http"
 
 	"go.uber.org/zap"
@@ -12,96 +17,374 @@ import (
 
 // handler holds the user service and implements HTTP handlers for user CRUD.
 type handler struct {
-	userService *user.Service
-	logger      *zap.Logger
+	userService  *user.Service
+	salesService *sales.Service
+	logger       *zap.Logger
 }
 
 // handleCreate handles POST /users
+// A body with an external_id that a user already has answers 200 with that
+// user instead of creating another, so sync jobs can retry safely.
 func (h *handler) handleCreate(ctx *gin.Context) {
 	// request payload
 	var req struct {
-		Name     string `json:"name"`
-		Address  string `json:"address"`
-		NickName string `json:"nickname"`
+		ExternalID string       `json:"external_id"`
+		Name       string       `json:"name"`
+		Address    user.Address `json:"address"`
+		NickName   string       `json:"nickname"`
+		Email      string       `json:"email"`
 	}
-	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := bindJSON(ctx, &req); err != nil {
+		writeError(ctx, h.logger, err)
 		return
 	}
 
-	u := &user.User{
-		Name:     req.Name,
-		Address:  req.Address,
-		NickName: req.NickName,
+	u, created, err := h.userService.CreateOrGet(ctx.Request.Context(), &user.User{
+		ExternalID: req.ExternalID,
+		Name:       req.Name,
+		Address:    req.Address,
+		NickName:   req.NickName,
+		Email:      req.Email,
+	})
+	if err != nil {
+		writeError(ctx, h.logger, err)
+		return
 	}
-	if err := h.userService.Create(u); err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if !created {
+		ctx.JSON(http.StatusOK, u)
 		return
 	}
 
-	h.logger.Info("user created", zap.Any("user", u))
+	requestLogger(ctx, h.logger).Info("user created", zap.Any("user", u))
 	ctx.JSON(http.StatusCreated, u)
 }
 
+// handleList handles GET /users?limit=&offset=
+func (h *handler) handleList(ctx *gin.Context) {
+	limit, offset, err := parsePagination(ctx)
+	if err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+
+	users, err := h.userService.List(ctx.Request.Context())
+	if err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+
+	meta := pageMeta{Total: len(users), Limit: limit, Offset: offset}
+	writePage(ctx, paginate(users, limit, offset), meta, len(users), limit, offset)
+}
+
 // handleRead handles GET /users/:id
 func (h *handler) handleRead(ctx *gin.Context) {
 	id := ctx.Param("id")
 
-	u, err := h.userService.Get(id)
+	u, err := h.userService.Get(ctx.Request.Context(), id)
 	if err != nil {
-		if errors.Is(err, user.ErrNotFound) {
-			h.logger.Warn("user not found", zap.String("id", id))
-			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-			return
+		if apperrors.KindOf(err) == apperrors.NotFound {
+			requestLogger(ctx, h.logger).Warn("user not found", zap.String("id", id))
 		}
 
-		h.logger.Error("error trying to get user", zap.Error(err))
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(ctx, h.logger, err, zap.String("user_id", id))
 		return
 	}
 
-	h.logger.Info("get user succeed", zap.Any("user", u))
-	ctx.JSON(http.StatusOK, u)
+	requestLogger(ctx, h.logger).Info("get user succeed", zap.Any("user", u))
+	ctx.Header("ETag", versionETag(u.Version))
+	render(ctx, http.StatusOK, u)
 }
 
-// handleUpdate handles PUT /users/:id
+// handleUpdate handles PATCH /users/:id
+// An If-Match header with the ETag of GET /users/:id, or a "version" field
+// in the body, makes the update fail with 409 if the user changed since it
+// was read. The header wins over the field.
 func (h *handler) handleUpdate(ctx *gin.Context) {
 	id := ctx.Param("id")
 
 	// bind partial update fields
 	var fields *user.UpdateFields
-	if err := ctx.ShouldBindJSON(&fields); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := bindJSON(ctx, &fields); err != nil {
+		writeError(ctx, h.logger, err)
 		return
 	}
+	if fields == nil {
+		fields = &user.UpdateFields{}
+	}
+	version, err := ifMatch(ctx)
+	if err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+	if version != nil {
+		fields.Version = version
+	}
 
-	u, err := h.userService.Update(id, fields)
+	u, err := h.userService.Update(ctx.Request.Context(), id, fields)
 	if err != nil {
-		if errors.Is(err, user.ErrNotFound) {
-			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-			return
-		}
+		writeError(ctx, h.logger, err, zap.String("user_id", id))
+		return
+	}
+
+	ctx.Header("ETag", versionETag(u.Version))
+	ctx.JSON(http.StatusOK, u)
+}
 
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+// handleReplace handles PUT /users/:id
+// The body holds the whole mutable portion of the user: fields left out are
+// cleared, and unknown fields are rejected so typos do not go unnoticed.
+// If-Match and "version" make it fail with 409 as in handleUpdate.
+func (h *handler) handleReplace(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	var req struct {
+		Name     string       `json:"name"`
+		Address  user.Address `json:"address"`
+		NickName string       `json:"nickname"`
+		Email    string       `json:"email"`
+		Version  *int         `json:"version"`
+	}
+	if err := bindStrictJSON(ctx, &req); err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+	version, err := ifMatch(ctx)
+	if err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+	if version == nil {
+		version = req.Version
+	}
+
+	u, err := h.userService.Replace(ctx.Request.Context(), id, version, &user.User{
+		Name:     req.Name,
+		Address:  req.Address,
+		NickName: req.NickName,
+		Email:    req.Email,
+	})
+	if err != nil {
+		writeError(ctx, h.logger, err, zap.String("user_id", id))
+		return
+	}
+
+	ctx.Header("ETag", versionETag(u.Version))
+	ctx.JSON(http.StatusOK, u)
+}
+
+// handleVerify handles POST /users/:id/verify
+// The body holds the token emailed to the user, which marks their email as
+// verified. It honors If-Match as handleUpdate does.
+func (h *handler) handleVerify(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := bindJSON(ctx, &req); err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+	version, err := ifMatch(ctx)
+	if err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+
+	u, err := h.userService.Verify(ctx.Request.Context(), id, version, req.Token)
+	if err != nil {
+		writeError(ctx, h.logger, err, zap.String("user_id", id))
+		return
+	}
+
+	ctx.Header("ETag", versionETag(u.Version))
+	ctx.JSON(http.StatusOK, u)
+}
+
+// handleBlock handles POST /users/:id/block
+// The body says why the user is kept from buying; see blockUser.
+func (h *handler) handleBlock(ctx *gin.Context) {
+	h.blockUser(ctx, h.userService.Block)
+}
+
+// handleUnblock handles POST /users/:id/unblock
+func (h *handler) handleUnblock(ctx *gin.Context) {
+	h.blockUser(ctx, h.userService.Unblock)
+}
+
+// blockUser applies action to the user with the reason in the body,
+// attributed to the API key of the request. It honors If-Match as
+// handleUpdate does.
+func (h *handler) blockUser(ctx *gin.Context, action func(context.Context, string, *int, string, string) (*user.User, error)) {
+	id := ctx.Param("id")
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := bindJSON(ctx, &req); err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+	version, err := ifMatch(ctx)
+	if err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+	reqCtx := ctx.Request.Context()
+	u, err := action(reqCtx, id, version, req.Reason, audit.ActorFromContext(reqCtx))
+	if err != nil {
+		writeError(ctx, h.logger, err, zap.String("user_id", id))
 		return
 	}
 
+	ctx.Header("ETag", versionETag(u.Version))
 	ctx.JSON(http.StatusOK, u)
 }
 
+// handleHistory handles GET /users/:id/history
+// It lists the recorded changes of the user, oldest first, with who made
+// each one and the fields it changed. Deleted users keep their history.
+func (h *handler) handleHistory(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	entries, err := h.userService.History(ctx.Request.Context(), id)
+	if err != nil {
+		writeError(ctx, h.logger, err, zap.String("user_id", id))
+		return
+	}
+
+	if entries == nil {
+		entries = []audit.Entry{}
+	}
+	ctx.JSON(http.StatusOK, gin.H{"user_id": id, "history": entries})
+}
+
 // handleDelete handles DELETE /users/:id
 func (h *handler) handleDelete(ctx *gin.Context) {
 	id := ctx.Param("id")
 
-	if err := h.userService.Delete(id); err != nil {
-		if errors.Is(err, user.ErrNotFound) {
-			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-			return
-		}
-
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.userService.Delete(ctx.Request.Context(), id); err != nil {
+		writeError(ctx, h.logger, err, zap.String("user_id", id))
 		return
 	}
 
 	ctx.Status(http.StatusNoContent)
 }
+
+// handleSummary handles GET /users/:id/summary
+// It returns the user together with their sales metadata.
+func (h *handler) handleSummary(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	u, err := h.userService.Get(ctx.Request.Context(), id)
+	if err != nil {
+		writeError(ctx, h.logger, err, zap.String("user_id", id))
+		return
+	}
+
+	summary, err := h.salesService.SummarizeUser(ctx.Request.Context(), id)
+	if err != nil {
+		writeError(ctx, h.logger, err, zap.String("user_id", id))
+		return
+	}
+
+	render(ctx, http.StatusOK, userSummary{User: u, Sales: summary})
+}
+
+// handleUserSales handles GET /users/:id/sales?status=&limit=&offset=
+// It lists the sales of the user, oldest first, in the same page envelope
+// as GET /sales, without clients building its filter query themselves.
+func (h *handler) handleUserSales(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	limit, offset, err := parsePagination(ctx)
+	if err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+
+	if _, err := h.userService.Get(ctx.Request.Context(), id); err != nil {
+		writeError(ctx, h.logger, err, zap.String("user_id", id))
+		return
+	}
+
+	filter := sales.SalesFilter{UserID: id, Status: sales.SaleStatus(ctx.Query("status"))}
+	results, metadata, err := h.salesService.FilterSales(ctx.Request.Context(), filter)
+	if err != nil {
+		writeError(ctx, h.logger, err, zap.String("user_id", id))
+		return
+	}
+
+	meta := struct {
+		pageMeta
+		Totals *sales.SalesMetadata `json:"totals" xml:"totals"`
+	}{
+		pageMeta: pageMeta{Total: len(results), Limit: limit, Offset: offset},
+		Totals:   metadata,
+	}
+	writePage(ctx, newSaleResources(paginate(results, limit, offset), h.salesService.Clock().Now()), meta, len(results), limit, offset)
+}
+
+// handleOnboarding handles POST /onboarding
+// It creates a user together with their first sale. If the sale cannot be
+// created the user is deleted again, so a failed signup leaves nothing behind.
+func (h *handler) handleOnboarding(ctx *gin.Context) {
+	var req struct {
+		Name        string       `json:"name"`
+		Address     user.Address `json:"address"`
+		NickName    string       `json:"nickname"`
+		Email       string       `json:"email"`
+		Amount      money.Cents  `json:"amount"`
+		AmountCents *int64       `json:"amount_cents"`
+	}
+	if err := bindJSON(ctx, &req); err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+	if req.AmountCents != nil {
+		req.Amount = money.Cents(*req.AmountCents)
+	}
+	// se valida antes de crear el usuario para no tener que compensar
+	if err := sales.ValidateAmount(req.Amount); err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+
+	u := &user.User{
+		Name:     req.Name,
+		Address:  req.Address,
+		NickName: req.NickName,
+		Email:    req.Email,
+	}
+	if err := h.userService.Create(ctx.Request.Context(), u); err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+
+	sale, err := h.salesService.CreateSale(ctx.Request.Context(), u.ID, req.Amount)
+	if err != nil {
+		// compensación: el usuario no queda creado a medias, aunque el request haya vencido
+		if delErr := h.userService.Delete(context.WithoutCancel(ctx.Request.Context()), u.ID); delErr != nil {
+			requestLogger(ctx, h.logger).Error("failed to roll back onboarding user", zap.String("user_id", u.ID), zap.Error(delErr))
+		}
+		writeError(ctx, h.logger, err, zap.String("user_id", u.ID))
+		return
+	}
+
+	requestLogger(ctx, h.logger).Info("user onboarded", zap.String("user_id", u.ID), zap.String("sale_id", sale.ID))
+	ctx.JSON(http.StatusCreated, onboarding{User: u, Sale: newSaleResource(sale, h.salesService.Clock().Now())})
+}
+
+// onboarding is the body of POST /onboarding.
+type onboarding struct {
+	User *user.User   `json:"user"`
+	Sale saleResource `json:"sale"`
+}
+
+// userSummary is the body of GET /users/:id/summary.
+type userSummary struct {
+	XMLName xml.Name           `json:"-" xml:"summary"`
+	User    *user.User         `json:"user" xml:"user"`
+	Sales   *sales.UserSummary `json:"sales" xml:"sales"`
+}
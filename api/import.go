@@ -0,0 +1,156 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"Ejercicio_Final-Taller_Go/internal/apperrors"
+	"Ejercicio_Final-Taller_Go/internal/i18n"
+	"Ejercicio_Final-Taller_Go/internal/user"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxImportRows caps the users of a single import.
+const maxImportRows = 1000
+
+// errInvalidImport is returned for an import body that is neither a JSON
+// array of users nor a CSV file with a header row of known columns.
+var errInvalidImport = apperrors.New(apperrors.Validation, "invalid_import", "body must be a JSON array of users or a CSV file with a header row")
+
+// errTooManyRows is returned for imports of more than maxImportRows users.
+var errTooManyRows = apperrors.New(apperrors.TooLarge, "too_many_rows", "too many users in a single import")
+
+// importRow is one user of an import, in JSON or as a CSV record.
+type importRow struct {
+	Name     string       `json:"name"`
+	Address  user.Address `json:"address"`
+	NickName string       `json:"nickname"`
+	Email    string       `json:"email"`
+}
+
+// importRowResult is the outcome of one row, as written in the response.
+type importRowResult struct {
+	Row    int    `json:"row"`
+	Status string `json:"status"`
+	ID     string `json:"id,omitempty"`
+	Code   string `json:"code,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// handleImport handles POST /users/import
+// The body is a JSON array of users or, with Content-Type text/csv, a CSV
+// file whose header names its columns (name, nickname, email and street,
+// city, province, postal_code and country; a single address column is taken
+// as the street, as in files exported before addresses were structured).
+// Every row is validated and the valid ones are created; the response
+// tells the outcome of each row, so one bad row does not fail the rest.
+func (h *handler) handleImport(ctx *gin.Context) {
+	var rows []importRow
+	var err error
+	if ctx.ContentType() == "text/csv" {
+		rows, err = parseImportCSV(ctx)
+	} else {
+		err = bindJSON(ctx, &rows)
+	}
+	if err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+	if len(rows) > maxImportRows {
+		writeError(ctx, h.logger, fmt.Errorf("%w: %d rows, at most %d", errTooManyRows, len(rows), maxImportRows))
+		return
+	}
+
+	users := make([]*user.User, len(rows))
+	for i, r := range rows {
+		users[i] = &user.User{Name: r.Name, Address: r.Address, NickName: r.NickName, Email: r.Email}
+	}
+
+	lang := i18n.Negotiate(ctx.GetHeader("Accept-Language"))
+	ctx.Header("Content-Language", lang)
+	resp := struct {
+		Created int               `json:"created"`
+		Failed  int               `json:"failed"`
+		Results []importRowResult `json:"results"`
+	}{Results: make([]importRowResult, 0, len(users))}
+	for _, r := range h.userService.Import(ctx.Request.Context(), users) {
+		if r.Err != nil {
+			resp.Failed++
+			code := apperrors.CodeOf(r.Err)
+			resp.Results = append(resp.Results, importRowResult{Row: r.Row, Status: "failed", Code: code, Detail: i18n.Message(lang, code, r.Err.Error())})
+			continue
+		}
+		resp.Created++
+		resp.Results = append(resp.Results, importRowResult{Row: r.Row, Status: "created", ID: r.User.ID})
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// parseImportCSV reads the users of a CSV import body.
+func parseImportCSV(ctx *gin.Context) ([]importRow, error) {
+	body, err := readBody(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r := csv.NewReader(bytes.NewReader(body))
+	r.TrimLeadingSpace = true
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidImport, err)
+	}
+	columns := make([]string, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "name", "address", "street", "city", "province", "postal_code", "country", "nickname", "email":
+		default:
+			return nil, fmt.Errorf("%w: unknown column %q", errInvalidImport, name)
+		}
+		columns[i] = name
+	}
+
+	var rows []importRow
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidImport, err)
+		}
+		if len(rows) == maxImportRows {
+			return nil, fmt.Errorf("%w: at most %d", errTooManyRows, maxImportRows)
+		}
+
+		var row importRow
+		for i, v := range record {
+			switch columns[i] {
+			case "name":
+				row.Name = v
+			case "address", "street":
+				row.Address.Street = v
+			case "city":
+				row.Address.City = v
+			case "province":
+				row.Address.Province = v
+			case "postal_code":
+				row.Address.PostalCode = v
+			case "country":
+				row.Address.Country = v
+			case "nickname":
+				row.NickName = v
+			case "email":
+				row.Email = v
+			}
+		}
+		rows = append(rows, row)
+	}
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/xml"
+	"net/http"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/sales"
+)
+
+// linkBase is the path prefix of the URLs in resource links; links always
+// point to the current API version.
+const linkBase = "/v1"
+
+// link is a hypermedia link to a related resource or an action. Method is
+// omitted for plain GET links.
+type link struct {
+	Href   string `json:"href" xml:"href"`
+	Method string `json:"method,omitempty" xml:"method,omitempty"`
+}
+
+// saleLinks are the links of a sale. The action links are only present when
+// the action is valid for the current state of the sale: approve and reject
+// take a PATCH with the new status, claim a POST with the reviewer.
+type saleLinks struct {
+	Self      link  `json:"self" xml:"self"`
+	User      link  `json:"user" xml:"user"`
+	Approve   *link `json:"approve,omitempty" xml:"approve,omitempty"`
+	Reject    *link `json:"reject,omitempty" xml:"reject,omitempty"`
+	Claim     *link `json:"claim,omitempty" xml:"claim,omitempty"`
+	Unarchive *link `json:"unarchive,omitempty" xml:"unarchive,omitempty"`
+}
+
+// saleResource is a sale as written in responses, with its _links and how
+// long, in seconds, since it was created and since it got its status.
+type saleResource struct {
+	XMLName xml.Name `json:"-" xml:"sale"`
+	*sales.Sale
+	AgeSeconds          int64     `json:"age_seconds" xml:"age_seconds"`
+	TimeInCurrentStatus int64     `json:"time_in_current_status" xml:"time_in_current_status"`
+	Links               saleLinks `json:"_links" xml:"_links"`
+}
+
+// newSaleResource adds to sale its ages as of now and the links to itself,
+// its user and the actions its status allows.
+func newSaleResource(sale *sales.Sale, now time.Time) saleResource {
+	resource := saleResource{
+		Sale:                sale,
+		AgeSeconds:          secondsSince(now, sale.CreatedAt),
+		TimeInCurrentStatus: secondsSince(now, sale.StatusSince()),
+	}
+
+	self := linkBase + "/sales/" + sale.ID
+	links := saleLinks{
+		Self: link{Href: self},
+		User: link{Href: linkBase + "/users/" + sale.UserID},
+	}
+
+	// las ventas archivadas solo se pueden restaurar
+	if sale.Archived {
+		links.Unarchive = &link{Href: linkBase + "/admin/sales/" + sale.ID + "/unarchive", Method: http.MethodPost}
+		resource.Links = links
+		return resource
+	}
+
+	for _, next := range sale.Status.Next() {
+		switch next {
+		case sales.StatusApproved:
+			links.Approve = &link{Href: self, Method: http.MethodPatch}
+		case sales.StatusRejected:
+			links.Reject = &link{Href: self, Method: http.MethodPatch}
+		}
+	}
+	if sale.Status == sales.StatusPending && sale.AssignedTo == "" {
+		links.Claim = &link{Href: self + "/claim", Method: http.MethodPost}
+	}
+	resource.Links = links
+	return resource
+}
+
+// secondsSince returns the whole seconds from t to now, never negative even
+// if the clocks of the instances disagree.
+func secondsSince(now, t time.Time) int64 {
+	return max(int64(now.Sub(t)/time.Second), 0)
+}
+
+// newSaleResources adds their ages as of now and their links to every sale of list.
+func newSaleResources(list []*sales.Sale, now time.Time) []saleResource {
+	resources := make([]saleResource, len(list))
+	for i, sale := range list {
+		resources[i] = newSaleResource(sale, now)
+	}
+	return resources
+}
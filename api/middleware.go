@@ -0,0 +1,379 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/apikey"
+	"Ejercicio_Final-Taller_Go/internal/apperrors"
+	"Ejercicio_Final-Taller_Go/internal/audit"
+	"Ejercicio_Final-Taller_Go/internal/clock"
+	"Ejercicio_Final-Taller_Go/internal/errreport"
+	"Ejercicio_Final-Taller_Go/internal/logging"
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+	"Ejercicio_Final-Taller_Go/internal/tracing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	requestIDHeader = tracing.RequestIDHeader
+	requestIDKey    = "request_id"
+)
+
+// requestIDMiddleware propagates the incoming X-Request-ID header, or generates
+// a new one, and stores it in the Gin and request contexts and the response
+// headers.
+func requestIDMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.GetHeader(requestIDHeader)
+		if id == "" {
+			id = uuid.NewString()
+		}
+
+		ctx.Set(requestIDKey, id)
+		ctx.Header(requestIDHeader, id)
+		ctx.Request = ctx.Request.WithContext(tracing.WithRequestID(ctx.Request.Context(), id))
+		ctx.Next()
+	}
+}
+
+// traceMiddleware continues the trace of the incoming traceparent header,
+// or starts a new one, so the calls the request makes are spans of it.
+func traceMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		sc, ok := tracing.Parse(ctx.GetHeader(tracing.Header))
+		if !ok {
+			sc = tracing.NewRoot()
+		}
+		ctx.Request = ctx.Request.WithContext(tracing.WithSpanContext(ctx.Request.Context(), sc))
+		ctx.Next()
+	}
+}
+
+// requestID returns the request ID assigned by requestIDMiddleware.
+func requestID(ctx *gin.Context) string {
+	return ctx.GetString(requestIDKey)
+}
+
+// tenantMiddleware scopes the request context to the tenant named in the
+// X-Tenant-ID header, or to tenant.Default when the header is absent.
+func tenantMiddleware(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.GetHeader(tenant.Header)
+		if id == "" {
+			id = tenant.Default
+		}
+
+		if err := tenant.Validate(id); err != nil {
+			writeError(ctx, logger, err)
+			return
+		}
+
+		ctx.Request = ctx.Request.WithContext(tenant.WithID(ctx.Request.Context(), id))
+		ctx.Next()
+	}
+}
+
+// loggerKey is where requestLoggerMiddleware stores the request's logger.
+const loggerKey = "logger"
+
+// requestLoggerMiddleware derives from logger the logger of the request,
+// carrying its request ID and tenant, and stores it in the Gin and request
+// contexts, so the handlers and services log about the request through it
+// (see requestLogger). It runs after tenantMiddleware; apiKeyMiddleware
+// adds the authenticated actor.
+func requestLoggerMiddleware(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		scopeLogger(ctx, logger.With(zap.String(requestIDKey, requestID(ctx)), zap.String("tenant", tenant.FromContext(ctx.Request.Context()))))
+		ctx.Next()
+	}
+}
+
+// scopeLogger makes logger the logger of the request.
+func scopeLogger(ctx *gin.Context, logger *zap.Logger) {
+	ctx.Set(loggerKey, logger)
+	ctx.Request = ctx.Request.WithContext(logging.WithContext(ctx.Request.Context(), logger))
+}
+
+// requestLogger returns the logger of the request, or, before
+// requestLoggerMiddleware ran, fallback with the request ID.
+func requestLogger(ctx *gin.Context, fallback *zap.Logger) *zap.Logger {
+	if logger, ok := ctx.Value(loggerKey).(*zap.Logger); ok {
+		return logger
+	}
+	return fallback.With(zap.String(requestIDKey, requestID(ctx)))
+}
+
+// recoveryMiddleware recovers panics raised by later handlers, logs them
+// with their stack trace and request ID, reports them and answers a
+// problem+json 500. logger must not be wrapped by errreport.WrapLogger, or
+// each panic would be reported twice. http.ErrAbortHandler is re-panicked,
+// since it asks net/http to drop the connection on purpose.
+func recoveryMiddleware(reporter errreport.Reporter, logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			if r == http.ErrAbortHandler {
+				panic(r)
+			}
+
+			tags := map[string]string{
+				requestIDKey: requestID(ctx),
+				"route":      ctx.FullPath(),
+			}
+			if id := ctx.Param("id"); id != "" && strings.Contains(ctx.FullPath(), "/sales/") {
+				tags["sale_id"] = id
+			}
+			reporter.CapturePanic(r, tags)
+			logger.Error("panic recovered", zap.Any("panic", r), zap.String(requestIDKey, tags[requestIDKey]),
+				zap.String("route", tags["route"]), zap.ByteString("stack", debug.Stack()))
+
+			if ctx.Writer.Written() {
+				// ya se mandó parte de la respuesta; solo queda cortarla
+				ctx.Abort()
+				return
+			}
+			p := newProblem(ctx, errPanic)
+			ctx.Header("Content-Type", problemContentType)
+			ctx.AbortWithStatusJSON(p.Status, p)
+		}()
+
+		ctx.Next()
+	}
+}
+
+// deprecatedMiddleware flags responses of unversioned routes as deprecated
+// and points clients to the same path under the successor prefix.
+func deprecatedMiddleware(successor string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Header("Deprecation", "true")
+		ctx.Header("Link", "<"+successor+ctx.Request.URL.Path+`>; rel="successor-version"`)
+		ctx.Next()
+	}
+}
+
+// timeoutMiddleware bounds later handlers to d by cancelling the request
+// context once it elapses, so user API calls and storage iterations made
+// with it stop early. If the handler gave up without writing a response, a
+// 504 is written on its behalf. A non-positive d disables the deadline.
+func timeoutMiddleware(d time.Duration, logger *zap.Logger) gin.HandlerFunc {
+	if d <= 0 {
+		return noopMiddleware
+	}
+
+	return func(ctx *gin.Context) {
+		reqCtx, cancel := context.WithTimeout(ctx.Request.Context(), d)
+		defer cancel()
+
+		ctx.Request = ctx.Request.WithContext(reqCtx)
+		ctx.Next()
+
+		if errors.Is(reqCtx.Err(), context.DeadlineExceeded) && !ctx.Writer.Written() {
+			writeError(ctx, logger, errRequestTimeout)
+		}
+	}
+}
+
+// apiKeyMiddleware authenticates requests by the X-API-Key header and counts
+// them against the key's monthly quota, answering 401 for unknown keys and
+// 429 once the quota is used up. It scopes the request to the key's tenant
+// (see apikey.Key.ActingTenant), answering 403 when X-Tenant-ID names
+// another. The API stays open while no key is registered.
+func apiKeyMiddleware(keys apikey.Store, meter *apikey.Meter, clk clock.Clock, warnRatio float64, logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		reqCtx := ctx.Request.Context()
+		if empty, err := keys.Empty(reqCtx); err != nil || empty {
+			if err != nil {
+				writeError(ctx, logger, err)
+				return
+			}
+			ctx.Next()
+			return
+		}
+
+		secret := ctx.GetHeader(apikey.Header)
+		if secret == "" {
+			writeError(ctx, logger, apikey.ErrInvalid)
+			return
+		}
+		key, err := keys.Lookup(reqCtx, secret)
+		if err != nil {
+			writeError(ctx, logger, err)
+			return
+		}
+		// el tenant lo define la key, el header solo puede confirmarlo
+		id, err := key.ActingTenant(ctx.GetHeader(tenant.Header))
+		if err != nil {
+			writeError(ctx, logger, err, zap.String("api_key", key.ID))
+			return
+		}
+		reqLogger := requestLogger(ctx, logger)
+		if id != tenant.FromContext(reqCtx) {
+			reqCtx = tenant.WithID(reqCtx, id)
+			reqLogger = logger.With(zap.String(requestIDKey, requestID(ctx)), zap.String("tenant", id))
+		}
+
+		if err := keys.Touch(reqCtx, key.ID, clk.Now()); err != nil {
+			logger.Warn("failed to record API key use", zap.String("api_key", key.ID), zap.Error(err))
+		}
+
+		if err := meter.Request(key); err != nil {
+			quotaExceeded(ctx, meter, clk)
+			writeError(ctx, logger, err, zap.String("api_key", key.ID))
+			return
+		}
+
+		// los cambios hechos con la key quedan a su nombre en la auditoría
+		actor := "apikey:" + key.ID
+		reqCtx = audit.WithActor(apikey.WithKey(reqCtx, key), actor)
+		ctx.Request = ctx.Request.WithContext(reqCtx)
+		scopeLogger(ctx, reqLogger.With(zap.String("actor", actor)))
+		warnAfter(ctx, func() {
+			warnQuota(ctx, meter, quotaRemainingHeader, key.RequestQuota, meter.Usage(key.ID).Requests, warnRatio)
+		})
+	}
+}
+
+// saleQuotaMiddleware reserves the sale of the request from the sale quota
+// of its API key, answering 429 when none is left, and warns when a created
+// sale took the key past warnRatio of the quota. The reservation travels in the
+// request context for the created sale to commit it, and is released if the
+// request ends without one; an accepted asynchronous creation keeps it
+// until its job finishes.
+func saleQuotaMiddleware(meter *apikey.Meter, clk clock.Clock, warnRatio float64, logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		key, ok := apikey.FromContext(ctx.Request.Context())
+		if !ok {
+			ctx.Next()
+			return
+		}
+		reservation, err := meter.ReserveSale(key)
+		if err != nil {
+			quotaExceeded(ctx, meter, clk)
+			writeError(ctx, logger, err, zap.String("api_key", key.ID))
+			return
+		}
+		ctx.Request = ctx.Request.WithContext(apikey.WithSaleReservation(ctx.Request.Context(), reservation))
+		// la venta ya está creada, o reservada si se crea en segundo plano
+		warnAfter(ctx, func() {
+			warnQuota(ctx, meter, saleQuotaRemainingHeader, key.SaleQuota, meter.SalesTaken(key.ID), warnRatio)
+		})
+		if ctx.Writer.Status() != http.StatusAccepted {
+			reservation.Release()
+		}
+	}
+}
+
+// errAdminRequired is returned for admin-only requests made with a key
+// that is not an admin.
+var errAdminRequired = apperrors.New(apperrors.Forbidden, "admin_required", "an admin API key is required")
+
+// errUnboundAdminRequired is returned when an admin key bound to a tenant
+// tries to change what every tenant shares.
+var errUnboundAdminRequired = apperrors.New(apperrors.Forbidden, "unbound_admin_required", "an admin API key not bound to a tenant is required")
+
+// adminMiddleware answers 403 unless the request's API key is an admin. Like
+// apiKeyMiddleware, which must run before, it lets every request through
+// while no key is registered.
+func adminMiddleware(keys apikey.Store, logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		reqCtx := ctx.Request.Context()
+		if key, ok := apikey.FromContext(reqCtx); ok {
+			if !key.Admin {
+				writeError(ctx, logger, errAdminRequired, zap.String("api_key", key.ID))
+				return
+			}
+		} else if empty, err := keys.Empty(reqCtx); err != nil || !empty {
+			if err == nil {
+				err = errAdminRequired
+			}
+			writeError(ctx, logger, err)
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// Headers telling a client close to one of its monthly quotas how many
+// requests or sales it has left, and when the quotas reset.
+const (
+	quotaRemainingHeader     = "X-Quota-Remaining"
+	saleQuotaRemainingHeader = "X-Sale-Quota-Remaining"
+	quotaResetHeader         = "X-Quota-Reset"
+)
+
+// warnQuota sets header to what is left of quota, once used reaches ratio
+// of it, next to when it resets. Unlimited quotas never warn.
+func warnQuota(ctx *gin.Context, meter *apikey.Meter, header string, quota, used int64, ratio float64) {
+	if quota <= 0 || ratio <= 0 || float64(used) < ratio*float64(quota) {
+		return
+	}
+	ctx.Header(header, strconv.FormatInt(max(quota-used, 0), 10))
+	ctx.Header(quotaResetHeader, meter.Reset().Format(time.RFC3339))
+}
+
+// warnAfter runs the rest of the chain and has warn set its headers once
+// the handler succeeded, right before the response is written, so they
+// reflect the usage after the request.
+func warnAfter(ctx *gin.Context, warn func()) {
+	w := &warningWriter{ResponseWriter: ctx.Writer, warn: warn}
+	ctx.Writer = w
+	ctx.Next()
+	// sin cuerpo, gin escribe los headers recién al terminar la cadena
+	w.beforeWrite()
+}
+
+// warningWriter is a gin.ResponseWriter that calls warn before the headers
+// of a successful response are written.
+type warningWriter struct {
+	gin.ResponseWriter
+	warn   func()
+	called bool
+}
+
+func (w *warningWriter) beforeWrite() {
+	if w.called || w.ResponseWriter.Written() {
+		return
+	}
+	w.called = true
+	if w.ResponseWriter.Status() < http.StatusBadRequest {
+		w.warn()
+	}
+}
+
+func (w *warningWriter) WriteHeaderNow() {
+	w.beforeWrite()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *warningWriter) Write(data []byte) (int, error) {
+	w.beforeWrite()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *warningWriter) WriteString(s string) (int, error) {
+	w.beforeWrite()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *warningWriter) Flush() {
+	w.beforeWrite()
+	w.ResponseWriter.Flush()
+}
+
+// quotaExceeded tells the client when its quota resets.
+func quotaExceeded(ctx *gin.Context, meter *apikey.Meter, clk clock.Clock) {
+	retryAfter := meter.Reset().Sub(clk.Now()).Round(time.Second)
+	ctx.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// parsePagination reads the limit and offset query parameters, applying
+// defaults and capping limit at maxPageLimit.
+func parsePagination(ctx *gin.Context) (limit, offset int, err error) {
+	limit, offset = defaultPageLimit, 0
+
+	if v := ctx.Query("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 {
+			return 0, 0, errInvalidPagination
+		}
+		if limit > maxPageLimit {
+			limit = maxPageLimit
+		}
+	}
+
+	if v := ctx.Query("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			return 0, 0, errInvalidPagination
+		}
+	}
+
+	return limit, offset, nil
+}
+
+// page is the envelope of paginated list responses. In XML each item of
+// Data is an element named after its type, e.g. <data><sale>...</sale></data>.
+type page struct {
+	XMLName xml.Name  `json:"-" xml:"page"`
+	Data    any       `json:"data" xml:"data>item"`
+	Meta    any       `json:"meta" xml:"meta"`
+	Links   pageLinks `json:"links" xml:"links"`
+}
+
+// pageMeta describes the position of a page within the full result set.
+type pageMeta struct {
+	Total  int `json:"total" xml:"total"`
+	Limit  int `json:"limit" xml:"limit"`
+	Offset int `json:"offset" xml:"offset"`
+}
+
+// pageLinks point to the current, next and previous pages. Next and Prev are
+// omitted at the ends of the result set.
+type pageLinks struct {
+	Self string `json:"self" xml:"self"`
+	Next string `json:"next,omitempty" xml:"next,omitempty"`
+	Prev string `json:"prev,omitempty" xml:"prev,omitempty"`
+}
+
+// paginate returns the items of the page starting at offset.
+func paginate[T any](items []T, limit, offset int) []T {
+	if offset > len(items) {
+		offset = len(items)
+	}
+	// se compara sin sumar para que un offset enorme no desborde
+	end := len(items)
+	if limit < end-offset {
+		end = offset + limit
+	}
+	return items[offset:end]
+}
+
+// writePage writes data in the page envelope, with links to the neighbouring
+// pages in the body and in an RFC 5988 Link header. meta is usually a
+// pageMeta, or a struct embedding one to carry extra totals. The body is
+// XML when the client asks for it (see render).
+func writePage(ctx *gin.Context, data, meta any, total, limit, offset int) {
+	links := pageLinks{Self: pageURL(ctx, limit, offset)}
+	if offset < total-limit {
+		links.Next = pageURL(ctx, limit, offset+limit)
+	}
+	if offset > 0 {
+		links.Prev = pageURL(ctx, limit, max(offset-limit, 0))
+	}
+
+	var header []string
+	if links.Next != "" {
+		header = append(header, "<"+links.Next+`>; rel="next"`)
+	}
+	if links.Prev != "" {
+		header = append(header, "<"+links.Prev+`>; rel="prev"`)
+	}
+	if len(header) > 0 {
+		ctx.Header("Link", strings.Join(header, ", "))
+	}
+
+	render(ctx, http.StatusOK, page{Data: data, Meta: meta, Links: links})
+}
+
+// pageURL returns the request URL with its limit and offset replaced.
+func pageURL(ctx *gin.Context, limit, offset int) string {
+	u := *ctx.Request.URL
+	q := u.Query()
+	q.Set("limit", strconv.Itoa(limit))
+	q.Set("offset", strconv.Itoa(offset))
+	u.RawQuery = q.Encode()
+	return u.RequestURI()
+}
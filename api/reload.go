@@ -0,0 +1,242 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/apikey"
+	"Ejercicio_Final-Taller_Go/internal/clock"
+	"Ejercicio_Final-Taller_Go/internal/config"
+	"Ejercicio_Final-Taller_Go/internal/money"
+	"Ejercicio_Final-Taller_Go/internal/notify"
+
+	"go.uber.org/zap"
+)
+
+// reloadable are the settings applied at runtime when the configuration is
+// reloaded; any other change is only logged, since it needs a restart.
+var reloadable = map[string]bool{
+	"LogLevel":               true,
+	"APIKeys":                true,
+	"ChannelNotifyThreshold": true,
+	"SlackWebhookURL":        true,
+	"TeamsWebhookURL":        true,
+}
+
+// reloader applies configuration changes to the running server without
+// dropping its in-memory data.
+type reloader struct {
+	logger    *zap.Logger
+	level     zap.AtomicLevel
+	keys      *apikey.LocalStore
+	clock     clock.Clock
+	threshold atomic.Int64
+
+	// chats are the chat notifiers by name, "slack" or "teams".
+	chats map[string]*notify.ChatNotifier
+
+	mu  sync.Mutex
+	cfg config.Config
+	// revoked are the keys revoked because a reload dropped them, which
+	// authenticate again if a later reload lists them.
+	revoked map[string]bool
+
+	// file is the version of the config file cfg was last compared with (see fileVersion).
+	file string
+}
+
+func newReloader(cfg config.Config, logger *zap.Logger, level zap.AtomicLevel, keys *apikey.LocalStore, clk clock.Clock) *reloader {
+	r := &reloader{
+		logger:  logger,
+		level:   level,
+		keys:    keys,
+		clock:   clk,
+		chats:   map[string]*notify.ChatNotifier{},
+		cfg:     cfg,
+		revoked: map[string]bool{},
+		file:    fileVersion(cfg.ConfigFile),
+	}
+	r.threshold.Store(int64(cfg.ChannelNotifyThreshold))
+	return r
+}
+
+// channelThreshold returns the current minimum amount of sales posted to chat channels.
+func (r *reloader) channelThreshold() money.Cents {
+	return money.Cents(r.threshold.Load())
+}
+
+// setChannelThreshold changes the minimum amount of sales posted to chat
+// channels until the next reload.
+func (r *reloader) setChannelThreshold(c money.Cents) {
+	r.threshold.Store(int64(c))
+}
+
+// watch reloads the configuration with load on SIGHUP and, when cfg has a
+// config file and a reload interval, whenever the file changes. It returns
+// when ctx is cancelled.
+func (r *reloader) watch(ctx context.Context, load func() (config.Config, error)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	path, interval := r.cfg.ConfigFile, r.cfg.ConfigReloadInterval
+	var tick <-chan time.Time
+	if path != "" && interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.logger.Info("SIGHUP received, reloading configuration")
+		case <-tick:
+			v := fileVersion(path)
+			if v == r.file {
+				continue
+			}
+			r.file = v
+			r.logger.Info("config file changed, reloading configuration", zap.String("path", path))
+		}
+
+		cfg, err := load()
+		if err != nil {
+			r.logger.Error("error reloading configuration, keeping the current one", zap.Error(err))
+			continue
+		}
+		if err := r.apply(ctx, cfg); err != nil {
+			r.logger.Error("error applying reloaded configuration", zap.Error(err))
+		}
+	}
+}
+
+// fileVersion identifies the contents of the file at path by its size and
+// modification time; it is empty when the file cannot be read.
+func fileVersion(path string) string {
+	if path == "" {
+		return ""
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d", info.ModTime().UnixNano(), info.Size())
+}
+
+// apply makes the reloadable settings of cfg take effect and warns about
+// the changed ones that need a restart.
+func (r *reloader) apply(ctx context.Context, cfg config.Config) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var errs []error
+	if cfg.LogLevel != r.cfg.LogLevel {
+		if err := r.level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+			errs = append(errs, err)
+			cfg.LogLevel = r.cfg.LogLevel
+		}
+	}
+
+	if !reflect.DeepEqual(cfg.APIKeys, r.cfg.APIKeys) {
+		now := r.clock.Now()
+		if err := saveConfigKeys(ctx, r.keys, cfg.APIKeys, now, r.revoked); err != nil {
+			errs = append(errs, err)
+		}
+		for _, k := range cfg.APIKeys {
+			delete(r.revoked, k.ID)
+		}
+		// las keys que ya no están en la configuración dejan de autenticar;
+		// las que ya estaban revocadas siguen así aunque vuelvan a listarse
+		for _, old := range r.cfg.APIKeys {
+			if hasKey(cfg.APIKeys, old.ID) {
+				continue
+			}
+			key, err := r.keys.Get(ctx, old.ID)
+			if errors.Is(err, apikey.ErrNotFound) || (err == nil && key.RevokedAt != nil) {
+				continue
+			}
+			if err == nil {
+				err = r.keys.Revoke(ctx, old.ID, now)
+			}
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			r.revoked[old.ID] = true
+		}
+	}
+
+	r.threshold.Store(int64(cfg.ChannelNotifyThreshold))
+
+	// un canal sin configurar al arrancar, o que se quita, necesita reiniciar
+	for name, urls := range map[string][2]string{
+		"slack": {r.cfg.SlackWebhookURL, cfg.SlackWebhookURL},
+		"teams": {r.cfg.TeamsWebhookURL, cfg.TeamsWebhookURL},
+	} {
+		if chat, ok := r.chats[name]; ok && urls[1] != "" {
+			chat.SetWebhookURL(urls[1])
+		} else if urls[0] != urls[1] {
+			r.logger.Warn("chat webhook enabled or disabled, restart to apply", zap.String("channel", name))
+		}
+	}
+
+	old, next := reflect.ValueOf(r.cfg), reflect.ValueOf(cfg)
+	for i := 0; i < old.NumField(); i++ {
+		name := old.Type().Field(i).Name
+		if !reloadable[name] && !reflect.DeepEqual(old.Field(i).Interface(), next.Field(i).Interface()) {
+			r.logger.Warn("setting changed, restart to apply", zap.String("setting", name))
+		}
+	}
+
+	r.cfg = cfg
+	r.logger.Info("configuration reloaded", zap.String("log_level", cfg.LogLevel), zap.Int("api_keys", len(cfg.APIKeys)))
+	return errors.Join(errs...)
+}
+
+// saveConfigKeys stores the API keys given in the configuration, created
+// at now, updating the secret and quotas of those already stored. The keys
+// in restored are un-revoked; the others stay revoked if they were.
+func saveConfigKeys(ctx context.Context, keys *apikey.LocalStore, configured []config.APIKey, now time.Time, restored map[string]bool) error {
+	for _, k := range configured {
+		key, err := keys.Get(ctx, k.ID)
+		switch {
+		case errors.Is(err, apikey.ErrNotFound):
+			key = &apikey.Key{ID: k.ID, Name: k.ID, CreatedAt: now}
+		case err != nil:
+			return err
+		}
+		if restored[k.ID] {
+			key.RevokedAt = nil
+		}
+		key.Hash = apikey.Hash(k.Secret)
+		key.RequestQuota = k.RequestQuota
+		key.SaleQuota = k.SaleQuota
+		key.Admin = k.Admin
+		key.Tenant = k.Tenant
+		if err := keys.Save(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasKey reports whether keys holds one with the given ID.
+func hasKey(keys []config.APIKey, id string) bool {
+	for _, k := range keys {
+		if k.ID == id {
+			return true
+		}
+	}
+	return false
+}
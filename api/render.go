@@ -0,0 +1,68 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// MessagePack media types: the registered one and the older x- form many
+// clients still send.
+const (
+	mimeMsgpack  = "application/msgpack"
+	mimeXMsgpack = "application/x-msgpack"
+)
+
+// negotiate returns the response media type the client prefers in its
+// Accept header: binding.MIMEXML, mimeMsgpack or, by default, binding.MIMEJSON.
+func negotiate(ctx *gin.Context) string {
+	switch ctx.NegotiateFormat(binding.MIMEJSON, binding.MIMEXML, binding.MIMEXML2, mimeMsgpack, mimeXMsgpack) {
+	case binding.MIMEXML, binding.MIMEXML2:
+		return binding.MIMEXML
+	case mimeMsgpack, mimeXMsgpack:
+		return mimeMsgpack
+	default:
+		return binding.MIMEJSON
+	}
+}
+
+// wantsXML reports whether the client asked for XML over JSON in its Accept header.
+func wantsXML(ctx *gin.Context) bool {
+	return negotiate(ctx) == binding.MIMEXML
+}
+
+// render writes v with status as XML when the client asks for it with
+// Accept: application/xml, as MessagePack with Accept: application/msgpack,
+// and as JSON otherwise.
+func render(ctx *gin.Context, status int, v any) {
+	ctx.Header("Vary", "Accept")
+	switch negotiate(ctx) {
+	case binding.MIMEXML:
+		ctx.XML(status, v)
+	case mimeMsgpack:
+		ctx.Render(status, msgpackRender{v})
+	default:
+		ctx.JSON(status, v)
+	}
+}
+
+// msgpackRender writes a value as MessagePack, with the field names and
+// omissions of its JSON tags so both encodings carry the same document.
+type msgpackRender struct {
+	data any
+}
+
+func (r msgpackRender) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	enc := msgpack.NewEncoder(w)
+	enc.SetCustomStructTag("json")
+	return enc.Encode(r.data)
+}
+
+func (r msgpackRender) WriteContentType(w http.ResponseWriter) {
+	if len(w.Header().Values("Content-Type")) == 0 {
+		w.Header().Set("Content-Type", mimeMsgpack)
+	}
+}
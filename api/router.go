@@ -1,34 +1,477 @@
 package api
 
 import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"math/rand"
+	"net"
 	"net/http"
+	"net/url"
+	"time"
 
+	"Ejercicio_Final-Taller_Go/internal/anomaly"
+	"Ejercicio_Final-Taller_Go/internal/apikey"
+	"Ejercicio_Final-Taller_Go/internal/awsauth"
+	"Ejercicio_Final-Taller_Go/internal/buildinfo"
+	"Ejercicio_Final-Taller_Go/internal/bundle"
+	"Ejercicio_Final-Taller_Go/internal/cache"
+	"Ejercicio_Final-Taller_Go/internal/checkout"
+	"Ejercicio_Final-Taller_Go/internal/clock"
+	"Ejercicio_Final-Taller_Go/internal/config"
+	"Ejercicio_Final-Taller_Go/internal/discovery"
+	"Ejercicio_Final-Taller_Go/internal/envelope"
+	"Ejercicio_Final-Taller_Go/internal/errreport"
+	"Ejercicio_Final-Taller_Go/internal/eventbus"
+	"Ejercicio_Final-Taller_Go/internal/export"
+	"Ejercicio_Final-Taller_Go/internal/faults"
+	"Ejercicio_Final-Taller_Go/internal/httppool"
+	"Ejercicio_Final-Taller_Go/internal/idgen"
+	"Ejercicio_Final-Taller_Go/internal/leader"
+	"Ejercicio_Final-Taller_Go/internal/lock"
+	"Ejercicio_Final-Taller_Go/internal/logging"
+	"Ejercicio_Final-Taller_Go/internal/metrics"
+	"Ejercicio_Final-Taller_Go/internal/notify"
+	"Ejercicio_Final-Taller_Go/internal/objstore"
+	"Ejercicio_Final-Taller_Go/internal/payment"
+	"Ejercicio_Final-Taller_Go/internal/readiness"
+	"Ejercicio_Final-Taller_Go/internal/redact"
+	"Ejercicio_Final-Taller_Go/internal/saga"
 	"Ejercicio_Final-Taller_Go/internal/sales"
+	"Ejercicio_Final-Taller_Go/internal/scheduler"
 	"Ejercicio_Final-Taller_Go/internal/user"
+	"Ejercicio_Final-Taller_Go/internal/userapi"
+	"Ejercicio_Final-Taller_Go/internal/webhook"
 
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 )
 
 // InitRoutes registers all user and sales CRUD endpoints on the given Gin engine.
 // It initializes the storage, service, and handler for both users and sales,
 // then binds each HTTP method and path to the appropriate handler function.
-func InitRoutes(e *gin.Engine, userAPIURL string) { // Modificamos la firma para recibir userAPIURL
-	logger, _ := zap.NewProduction()
-	defer logger.Sync()
+// Panics and logged errors are sent to reporter; a nil reporter disables reporting.
+// Everything logs through base, the logger built once by the caller, which
+// syncs it; a nil base discards the logs.
+// The background work it starts runs until stop is called, once the server
+// no longer takes requests: stop waits, until its ctx is done, for the
+// queued asynchronous creations to finish.
+func InitRoutes(e *gin.Engine, cfg config.Config, reporter errreport.Reporter, base *logging.Logger) (stop func(ctx context.Context) error, err error) {
+	if reporter == nil {
+		reporter = errreport.Nop()
+	}
+	clk := clock.System()
+
+	// Las tareas de fondo se detienen con stop, o si el arranque falla
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		if err != nil {
+			cancel()
+		}
+	}()
 
-	// Inicialización de la lógica de usuarios (sin cambios)
-	userStorage := user.NewLocalStorage()
-	userService := user.NewService(userStorage, logger)
-	userHandler := handler{
-		userService: userService,
-		logger:      logger,
+	ids, err := idgen.New(cfg.IDGenerator)
+	if err != nil {
+		return nil, err
 	}
 
-	e.POST("/users", userHandler.handleCreate)
-	e.GET("/users/:id", userHandler.handleRead)
-	e.PATCH("/users/:id", userHandler.handleUpdate)
-	e.DELETE("/users/:id", userHandler.handleDelete)
+	compress := noopMiddleware
+	if cfg.GzipEnabled {
+		if compress, err = gzipMiddleware(cfg.GzipLevel); err != nil {
+			return nil, err
+		}
+	}
+
+	if base == nil {
+		base = logging.Nop()
+	}
+	// el nivel de log se puede cambiar en caliente recargando la configuración
+	level := base.Level
+	// los pánicos se reportan aparte, con su stack, así que se loguean sin reenviarlos
+	panicLogger := base.Logger
+	logger := errreport.WrapLogger(base.Logger, reporter)
+	redact.Reveal(cfg.LogPII)
+	if cfg.LogPII {
+		logger.Warn("LOG_PII is on: personal data is logged in clear")
+	}
+
+	e.Use(requestIDMiddleware(), traceMiddleware(), recoveryMiddleware(reporter, panicLogger), tenantMiddleware(logger), requestLoggerMiddleware(logger), bodyLimitMiddleware(cfg.MaxBodyBytes))
+
+	// Redis coordina a las instancias que comparten datos
+	var redisClient *redis.Client
+	if cfg.LeaderElection == "redis" || cfg.LockBackend == "redis" || cfg.UserCache == "redis" || cfg.EventBus == "redis" || cfg.UserStorage == "redis" {
+		redisClient = redis.NewClient(&redis.Options{Addr: cfg.RedisAddr, Password: cfg.RedisPassword})
+	}
+
+	// Inicialización de la lógica de usuarios
+	userStorage, err := newUserStorage(cfg, redisClient)
+	if err != nil {
+		return nil, err
+	}
+	// Se mide el almacenamiento debajo de la caché, así los aciertos no cuentan
+	userStorageOps := metrics.NewOperations("user_storage", logger, cfg.SlowStorageThreshold)
+	metrics.Publish("user_storage", userStorageOps)
+	userStorage = user.NewInstrumentedStorage(userStorage, userStorageOps)
+	// La caché queda debajo del cifrado, así que guarda los datos personales cifrados
+	var userCache cache.Cache
+	switch cfg.UserCache {
+	case "":
+	case "memory":
+		userCache = cache.NewLocal(clk, maxCachedUsers)
+	case "redis":
+		userCache = cache.NewRedis(redisClient, "sales-api:user:")
+	default:
+		return nil, fmt.Errorf("unknown USER_CACHE %q", cfg.UserCache)
+	}
+	if userCache != nil {
+		cached := user.NewCachedStorage(userStorage, userCache, cfg.UserCacheTTL)
+		metrics.Publish("user_cache", cached.Stats())
+		userStorage = cached
+	}
+	kek, err := masterKey(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var cipher *envelope.Cipher
+	if kek != nil {
+		// Los datos personales de los usuarios se guardan cifrados
+		cipher = envelope.New(kek)
+		userStorage = user.NewEncryptedStorage(userStorage, cipher)
+	}
+	userOpts := []user.Option{user.WithIDGenerator(ids)}
+
+	// Inicialización de la lógica de ventas
+	userAPIEndpoints, err := userAPIEndpoints(ctx, cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	// Un único pool de conexiones para todas las llamadas a la API de usuarios
+	userAPIHTTP, _ := httppool.NewClient("user_api", httppool.Config{
+		MaxIdleConns:        cfg.UserAPIMaxIdleConns,
+		MaxIdleConnsPerHost: cfg.UserAPIMaxIdleConnsPerHost,
+		MaxConnsPerHost:     cfg.UserAPIMaxConnsPerHost,
+		IdleConnTimeout:     cfg.UserAPIIdleConnTimeout,
+	})
+	userAPI := userapi.NewBalancedClient(userAPIEndpoints, userAPIHTTP, userapi.WithAPIKey(cfg.UserAPIKey))
+	validationHTTP := userAPIHTTP
+	if cfg.UserAPIFaults.Enabled() {
+		// Fallas inyectadas solo en la validación de usuarios, para probar la resiliencia
+		logger.Warn("injecting faults into user API calls", zap.Duration("latency", cfg.UserAPIFaults.Latency),
+			zap.Float64("timeout_rate", cfg.UserAPIFaults.TimeoutRate), zap.Float64("error_rate", cfg.UserAPIFaults.ErrorRate))
+		validationHTTP = &http.Client{Transport: faults.Transport(userAPIHTTP.Transport, cfg.UserAPIFaults, nil)}
+	}
+	// Llamadas a la API de usuarios por resultado, para alertar sobre la dependencia
+	userAPIMetrics := sales.NewUserAPIMetrics()
+	metrics.Publish("user_api", userAPIMetrics)
+	salesOpts := []sales.Option{
+		sales.WithIDGenerator(ids),
+		sales.WithUserAPIEndpoints(userAPIEndpoints),
+		sales.WithHTTPClient(validationHTTP),
+		sales.WithUserAPIKey(cfg.UserAPIKey),
+		sales.WithUserAPIBudget(cfg.UserAPIBudget),
+		sales.WithUserAPIMetrics(userAPIMetrics),
+	}
+	if cfg.RequireVerifiedUsers {
+		salesOpts = append(salesOpts, sales.WithVerifiedUsersOnly())
+	}
+	if len(cfg.RejectionReasons) > 0 {
+		salesOpts = append(salesOpts, sales.WithRejectionReasons(cfg.RejectionReasons...))
+	}
+	if cfg.StatusSeed != 0 {
+		// Secuencia de estados reproducible, útil en staging
+		salesOpts = append(salesOpts, sales.WithRand(rand.New(rand.NewSource(cfg.StatusSeed))))
+	}
+
+	// Las notificaciones que agotan sus reintentos quedan para reenviarlas a mano
+	var dlqBucket objstore.Bucket
+	if cfg.DLQDir != "" {
+		dlqBucket = objstore.Dir(cfg.DLQDir)
+	}
+	deadLetters, err := notify.NewDeadLetters(ctx, dlqBucket, ids, notify.WithDeadLetterClock(clk))
+	if err != nil {
+		return nil, err
+	}
+
+	// Emails de cambio de estado y de verificación, solo si hay un servidor SMTP configurado
+	var alertOpts []anomaly.Option
+	if cfg.SMTPAddr != "" {
+		mailer := notify.NewSMTPNotifier(cfg.SMTPAddr, cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPFrom)
+		mailQueue := notify.NewQueue(mailer, logger, 1000, cfg.NotifyMaxAttempts, time.Second, notify.WithDeadLetters(deadLetters, "email"))
+		salesOpts = append(salesOpts, sales.WithHooks(notify.StatusEmailHook(userAPI, mailQueue, logger)))
+		userOpts = append(userOpts, user.WithVerification(notify.VerificationEmail(mailQueue), cfg.VerificationTTL))
+		if cfg.AlertEmail != "" {
+			alertOpts = append(alertOpts, anomaly.WithSender(notify.AlertHook(mailQueue, cfg.AlertEmail, logger)))
+		}
+	}
+	userService := user.NewService(userStorage, logger, userOpts...)
+
+	// API keys y su consumo mensual
+	keys := apikey.NewLocalStore()
+	if err := saveConfigKeys(ctx, keys, cfg.APIKeys, clk.Now(), nil); err != nil {
+		return nil, err
+	}
+	meter := apikey.NewMeter(clk)
+	salesOpts = append(salesOpts, sales.WithHooks(func(ctx context.Context, e sales.Event) {
+		if e.Type != sales.EventCreated {
+			return
+		}
+		// la venta ocupa el lugar que reservó el request, si lo hizo
+		if reservation, ok := apikey.SaleReservationFromContext(ctx); ok {
+			reservation.Commit()
+		} else if key, ok := apikey.FromContext(ctx); ok {
+			meter.Sale(key.ID)
+		}
+	}))
+
+	// Nivel de log, cuotas, umbral y webhooks se recargan sin reiniciar
+	reloader := newReloader(cfg, logger, level, keys, clk)
+
+	// Avisos a canales de Slack/Teams sobre ventas grandes o rechazadas
+	for _, chat := range []*notify.ChatNotifier{
+		chatNotifier(cfg.SlackWebhookURL, notify.NewSlackNotifier),
+		chatNotifier(cfg.TeamsWebhookURL, notify.NewTeamsNotifier),
+	} {
+		if chat == nil {
+			continue
+		}
+		chatQueue := notify.NewQueue(chat, logger, 1000, cfg.NotifyMaxAttempts, time.Second, notify.WithDeadLetters(deadLetters, chat.Name()))
+		reloader.chats[chat.Name()] = chat
+		salesOpts = append(salesOpts, sales.WithHooks(notify.ChannelHook(chatQueue, reloader.channelThreshold, logger)))
+		alertOpts = append(alertOpts, anomaly.WithSender(notify.AlertHook(chatQueue, "", logger)))
+	}
+
+	// Webhooks de los clientes con los eventos de sus ventas, en el formato que elija cada uno
+	webhookOpts := []webhook.Option{webhook.WithIDGenerator(ids),
+		webhook.WithHTTPClient(&http.Client{Timeout: cfg.WebhookTimeout}), webhook.WithRetries(cfg.NotifyMaxAttempts, time.Second),
+		webhook.WithSecretGrace(cfg.WebhookSecretGrace)}
+	if cfg.WebhookPrivateTargets {
+		webhookOpts = append(webhookOpts, webhook.WithPrivateTargets())
+	}
+	webhooks := webhook.New(webhook.NewLocalStore(), 1000, logger, webhookOpts...)
+	salesOpts = append(salesOpts, sales.WithHooks(webhooks.Hook()))
+	// Configuración exportable para copiarla entre entornos
+	bundles := bundle.New(webhooks, keys, reloader.channelThreshold, reloader.setChannelThreshold, logger)
+
+	// Eventos de las ventas publicados en el broker como CloudEvents
+	var publisher eventbus.Publisher
+	switch cfg.EventBus {
+	case "":
+	case "redis":
+		publisher = eventbus.NewRedisStreams(redisClient, "sales-api:events:")
+	case "amqp", "rabbitmq":
+		publisher = eventbus.NewAMQP(cfg.AMQPURL, cfg.AMQPExchange)
+	default:
+		return nil, fmt.Errorf("unknown EVENT_BUS %q", cfg.EventBus)
+	}
+	if publisher != nil {
+		eventQueue := notify.NewQueue(eventbus.Notifier(publisher), logger, 1000,
+			cfg.NotifyMaxAttempts, time.Second, notify.WithDeadLetters(deadLetters, "eventbus"))
+		salesOpts = append(salesOpts, sales.WithHooks(eventbus.Hook(eventQueue, cfg.EventBusTopic, ids, logger)))
+	}
+	if (cfg.PaymentResultsTopic != "" || cfg.UserEventsTopic != "") && cfg.EventBus == "" {
+		return nil, fmt.Errorf("PAYMENT_RESULTS_TOPIC and USER_EVENTS_TOPIC need EVENT_BUS")
+	}
+
+	// Archivo de ventas antiguas para la política de retención
+	archive, err := salesArchive(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if archive != nil {
+		salesOpts = append(salesOpts, sales.WithArchive(archive))
+	} else if cfg.RetentionMonths > 0 {
+		return nil, fmt.Errorf("RETENTION_MONTHS needs ARCHIVE_DIR or ARCHIVE_S3_BUCKET")
+	}
+
+	// Adjuntos de las ventas, en disco o en S3
+	attachments, err := attachmentBucket(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if attachments != nil {
+		salesOpts = append(salesOpts, sales.WithAttachments(attachments, cfg.AttachmentMaxBytes, cfg.AttachmentTypes...))
+	}
+
+	switch cfg.LockBackend {
+	case "":
+	case "redis":
+		salesOpts = append(salesOpts, sales.WithLocker(lock.New(leader.NewRedisStore(redisClient, "sales-api:lock:"), 10*time.Second)))
+	default:
+		return nil, fmt.Errorf("unknown LOCK_BACKEND %q", cfg.LockBackend)
+	}
+
+	// Con demasiados rechazos las ventas nuevas quedan pendientes de revisión manual
+	var anomalies *anomaly.Analyzer
+	if cfg.BreakerRejectionRate > 0 {
+		salesOpts = append(salesOpts, sales.WithRejectionBreaker(sales.RejectionBreaker{
+			Rate:     cfg.BreakerRejectionRate,
+			Window:   cfg.BreakerWindow,
+			MinSales: cfg.BreakerMinSales,
+			Cooldown: cfg.BreakerCooldown,
+			OnTrip: func(ctx context.Context, trip sales.BreakerTrip) {
+				anomalies.Raise(ctx, anomaly.Alert{Kind: anomaly.KindRejectionBreaker, Value: trip.Rate, Baseline: cfg.BreakerRejectionRate,
+					Message: fmt.Sprintf("%d of the last %d sales were rejected, new sales start pending until %s",
+						trip.Rejected, trip.Total, trip.Until.Format(time.RFC3339))})
+			},
+		}))
+	}
+
+	salesStorage, err := newSalesStorage(cfg, clk)
+	if err != nil {
+		return nil, err
+	}
+	// Cada operación del almacenamiento se mide, y las lentas se registran
+	salesStorageOps := metrics.NewOperations("sales_storage", logger, cfg.SlowStorageThreshold)
+	metrics.Publish("sales_storage", salesStorageOps)
+	salesStorage = sales.NewInstrumentedStorage(salesStorage, salesStorageOps)
+	if cipher != nil {
+		// También las notas, metadatos y adjuntos de las ventas
+		salesStorage = sales.NewEncryptedStorage(salesStorage, cipher)
+	}
+	salesService := sales.NewService(salesStorage, logger, cfg.UserAPIURL, salesOpts...)
+
+	// Tareas periódicas, arrancan una vez verificadas las dependencias.
+	// Con varias instancias solo las corre la elegida como líder.
+	var jobOpts []scheduler.Option
+	switch cfg.LeaderElection {
+	case "":
+	case "redis":
+		elector := leader.NewElector(leader.NewRedisStore(redisClient, "sales-api:lease:"), "jobs", cfg.InstanceID, cfg.LeaderLeaseTTL, logger)
+		go elector.Run(ctx)
+		jobOpts = append(jobOpts, scheduler.WithLeader(elector.IsLeader))
+	default:
+		return nil, fmt.Errorf("unknown LEADER_ELECTION %q", cfg.LeaderElection)
+	}
+	jobs := scheduler.New(logger, jobOpts...)
+	if cfg.RetentionMonths > 0 {
+		jobs.Add(scheduler.Job{
+			Name:     "retention",
+			Schedule: scheduler.Every(cfg.RetentionInterval),
+			Jitter:   cfg.RetentionJitter,
+			Run: func(ctx context.Context) error {
+				_, err := salesService.ApplyRetention(ctx, cfg.RetentionMonths)
+				return err
+			},
+		})
+	}
+
+	// Alertas cuando el volumen o los rechazos de la última hora se salen de lo habitual
+	alertOpts = append(alertOpts, anomaly.WithIDGenerator(ids), anomaly.WithBaseline(cfg.AnomalyBaselineHours))
+	anomalies = anomaly.New(salesService, anomaly.Thresholds{
+		VolumeSigma:    cfg.AnomalyVolumeSigma,
+		RejectionDelta: cfg.AnomalyRejectionDelta,
+		MinSales:       cfg.AnomalyMinSales,
+	}, logger, alertOpts...)
+	if cfg.AnomalyInterval > 0 {
+		jobs.Add(scheduler.Job{
+			Name:     "anomalies",
+			Schedule: scheduler.Every(cfg.AnomalyInterval),
+			Run:      anomalies.Run,
+		})
+	}
+
+	// Exportación nocturna de ventas a un bucket
+	exporter, err := salesExporter(cfg, salesService, logger)
+	if err != nil {
+		return nil, err
+	}
+	if exporter != nil {
+		jobs.Add(scheduler.Job{
+			Name:     "export",
+			Schedule: scheduler.Daily(cfg.ExportAt),
+			Jitter:   cfg.ExportJitter,
+			Run:      exporter.Run,
+		})
+	}
+	// Exportaciones grandes pedidas por la API, escritas por partes para retomarlas tras un reinicio
+	var exportJobs *export.Jobs
+	exportJobsBucket, err := exportJobBucket(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if exportJobsBucket != nil && cfg.ExportJobsInterval > 0 {
+		exportJobs = export.NewJobs(salesService, exportJobsBucket, "export-jobs", cfg.ExportJobPartSize, logger, export.WithJobIDs(ids))
+		jobs.Add(scheduler.Job{
+			Name:     "export_jobs",
+			Schedule: scheduler.Every(cfg.ExportJobsInterval),
+			Run:      exportJobs.RunPending,
+		})
+	}
+	// Creación asíncrona de ventas, para no hacer esperar al cliente la validación del usuario
+	// las creaciones asíncronas devuelven la reserva de la cuota del request al terminar
+	creations := sales.NewCreationQueue(salesService, cfg.AsyncQueueSize, cfg.WriteTimeout, time.Hour,
+		sales.WithJobDone(func(ctx context.Context, _ sales.CreationJob) {
+			if reservation, ok := apikey.SaleReservationFromContext(ctx); ok {
+				reservation.Release()
+			}
+		}))
+	creationsDone := make(chan struct{})
+	go func() {
+		defer close(creationsDone)
+		creations.Run(ctx, cfg.AsyncWorkers)
+	}()
+	// Ventas pagas: crear, reservar el pago y confirmar, compensando si un paso falla
+	sagas := saga.New(saga.NewLocalStore(), logger, saga.WithIDGenerator(ids))
+	checkouts := checkout.New(sagas, salesService, payment.NewLocal(ids))
+	salesHandler := NewSalesHandler(salesService, creations, checkouts, logger)
+
+	// No se aceptan requests hasta que las dependencias respondan
+	if cfg.StartupCheckAttempts > 0 {
+		checks := []readiness.Check{
+			{Name: "user storage", Probe: userStorage.Ping},
+			{Name: "sales storage", Probe: salesStorage.Ping},
+		}
+		if redisClient != nil {
+			checks = append(checks, readiness.Check{Name: "redis", Probe: func(ctx context.Context) error {
+				return redisClient.Ping(ctx).Err()
+			}})
+		}
+		// cuando la API de usuarios es este mismo proceso todavía no está escuchando
+		if cfg.UserAPIDiscovery != "" || !servesItself(cfg.UserAPIURL, cfg.Port) {
+			checks = append(checks, readiness.Check{Name: "user API", Probe: userAPI.Ping})
+		}
+		if err := readiness.Wait(ctx, logger, cfg.StartupCheckAttempts, 500*time.Millisecond, checks...); err != nil {
+			return nil, err
+		}
+	}
+	// las sagas que quedaron a medias en una ejecución anterior se deshacen
+	if _, err := sagas.Recover(ctx); err != nil {
+		logger.Error("failed to recover sagas", zap.Error(err))
+	}
+	jobs.Start(ctx)
+	go reloader.watch(ctx, config.Load)
+	// Eventos de otros servicios consumidos del broker. Los ya procesados se recuerdan para descartar sus reentregas,
+	// en Redis si lo hay para que los vean todas las instancias.
+	consume := func(topic, name string, handle eventbus.Handler) {
+		var processed cache.Cache = cache.NewLocal(clk, maxProcessedEvents)
+		if redisClient != nil {
+			processed = cache.NewRedis(redisClient, "sales-api:processed:"+name+":")
+		}
+		handle = eventbus.Deduplicated(processed, cfg.ProcessedEventsTTL, logger, handle)
+		redelivery := eventbus.WithRedelivery(cfg.PaymentResultsMaxAttempts, cfg.PaymentResultsRetryAfter)
+		if cfg.EventBus == "redis" {
+			consumer := eventbus.NewStreamConsumer(redisClient, "sales-api:events:", topic, "sales-api", cfg.InstanceID, handle, logger, redelivery)
+			go consumer.Run(ctx)
+			return
+		}
+		consumer := eventbus.NewAMQPConsumer(cfg.AMQPURL, cfg.AMQPExchange, topic, "sales-api."+topic, handle, logger, redelivery)
+		go consumer.Run(ctx)
+	}
+	// los resultados de los pagos aprueban o rechazan las ventas pendientes
+	if cfg.PaymentResultsTopic != "" {
+		consume(cfg.PaymentResultsTopic, "payments", eventbus.PaymentResults(salesService, logger))
+	}
+	// las ventas de los usuarios borrados se anonimizan
+	if cfg.UserEventsTopic != "" {
+		consume(cfg.UserEventsTopic, "users", eventbus.UserDeletions(salesService, logger))
+	}
+
+	userHandler := &handler{
+		userService:  userService,
+		salesService: salesService,
+		logger:       logger,
+	}
 
 	e.GET("/ping", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
@@ -36,12 +479,320 @@ func InitRoutes(e *gin.Engine, userAPIURL string) { // Modificamos la firma para
 		})
 	})
 
-	// Inicialización de la lógica de ventas
-	salesStorage := sales.NewLocalStorage()
-	salesService := sales.NewService(salesStorage, logger, userAPIURL) // Usamos la userAPIURL recibida
-	salesHandler := NewSalesHandler(salesService, logger)
+	// Versión del binario, para saber qué build corre en cada instancia
+	e.GET("/version", func(c *gin.Context) {
+		c.JSON(http.StatusOK, buildinfo.Get())
+	})
+
+	// Catálogo de códigos de error, para que los clientes los manejen sin adivinar
+	e.GET("/errors", handleErrorCatalog)
+
+	r := &routes{
+		users:        userHandler,
+		sales:        salesHandler,
+		webhooks:     &webhookHandler{webhooks: webhooks, logger: logger},
+		exports:      &exportHandler{jobs: exportJobs, logger: logger},
+		admin:        &adminHandler{salesService: salesService, keys: keys, meter: meter, exporter: exporter, jobs: jobs, anomalies: anomalies, deadLetters: deadLetters, sagas: sagas, bundles: bundles, ids: ids, clock: clk, logger: logger},
+		compress:     compress,
+		auth:         apiKeyMiddleware(keys, meter, clk, cfg.QuotaWarningRatio, logger),
+		saleQuota:    saleQuotaMiddleware(meter, clk, cfg.QuotaWarningRatio, logger),
+		adminOnly:    adminMiddleware(keys, logger),
+		readTimeout:  timeoutMiddleware(cfg.ReadTimeout, logger),
+		writeTimeout: timeoutMiddleware(cfg.WriteTimeout, logger),
+		bulkTimeout:  timeoutMiddleware(cfg.BulkTimeout, logger),
+	}
+	r.registerV1(e.Group("/v1"))
+
+	// Alias sin versión, se mantienen temporalmente hasta que los clientes migren a /v1
+	r.registerV1(e.Group("", deprecatedMiddleware("/v1")))
+
+	return func(stopCtx context.Context) error {
+		cancel()
+		select {
+		case <-creationsDone:
+			return nil
+		case <-stopCtx.Done():
+			return stopCtx.Err()
+		}
+	}, nil
+}
+
+// chatNotifier builds a chat notifier for webhookURL, or returns nil when it is not configured.
+func chatNotifier(webhookURL string, build func(string, *http.Client) *notify.ChatNotifier) *notify.ChatNotifier {
+	if webhookURL == "" {
+		return nil
+	}
+	return build(webhookURL, nil)
+}
+
+// userAPIEndpoints returns the user API instances to call: the static
+// UserAPIURL, or a balancer over the instances found through DNS SRV or
+// Consul that is refreshed in the background every UserAPIRefresh until ctx
+// is done.
+func userAPIEndpoints(ctx context.Context, cfg config.Config, logger *zap.Logger) (discovery.Endpoints, error) {
+	var resolver discovery.Resolver
+	switch cfg.UserAPIDiscovery {
+	case "":
+		return discovery.Static(cfg.UserAPIURL), nil
+	case "srv":
+		resolver = discovery.SRV(cfg.UserAPISRVName, "http")
+	case "consul":
+		resolver = discovery.Consul(cfg.ConsulAddr, cfg.UserAPIConsulService, "http", nil)
+	default:
+		return nil, fmt.Errorf("unknown user API discovery %q", cfg.UserAPIDiscovery)
+	}
+
+	balancer := discovery.NewBalancer(resolver, logger)
+	// si falla, se reintenta en el refresco periódico; la verificación de arranque lo detecta antes
+	if err := balancer.Refresh(ctx); err != nil {
+		logger.Warn("error resolving user API", zap.Error(err))
+	}
+	go balancer.Run(ctx, cfg.UserAPIRefresh)
+	return balancer, nil
+}
+
+// masterKey returns the key that wraps the data keys of encrypted records:
+// the AWS KMS key KMSKeyID, or the local EncryptionKey. It returns nil when
+// encryption at rest is not configured.
+func masterKey(cfg config.Config) (envelope.KeyWrapper, error) {
+	switch {
+	case cfg.KMSKeyID != "":
+		creds, err := awsauth.FromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return envelope.AWSKMS(cfg.AWSRegion, cfg.KMSKeyID, creds, nil), nil
+	case cfg.EncryptionKey != "":
+		key, err := base64.StdEncoding.DecodeString(cfg.EncryptionKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ENCRYPTION_KEY: %w", err)
+		}
+		return envelope.LocalKey(key)
+	default:
+		return nil, nil
+	}
+}
+
+// newSalesStorage returns the sales storage selected by SalesStorage: in
+// memory, or event-sourced to keep the history of every sale.
+func newSalesStorage(cfg config.Config, clk clock.Clock) (sales.Storage, error) {
+	switch cfg.SalesStorage {
+	case "", "memory":
+		return sales.NewLocalStorage(), nil
+	case "events":
+		return sales.NewEventSourcedStorage(cfg.SalesSnapshotEvery, sales.WithEventClock(clk)), nil
+	default:
+		return nil, fmt.Errorf("unknown SALES_STORAGE %q", cfg.SalesStorage)
+	}
+}
 
-	e.POST("/sales", salesHandler.handleCreateSale)
+// maxCachedUsers bounds the in-memory cache of users.
+const maxCachedUsers = 10000
+
+// maxProcessedEvents bounds the in-memory record of the events consumed, without Redis.
+const maxProcessedEvents = 100000
+
+// newUserStorage returns the user storage selected by UserStorage: in
+// memory, or in Redis on the client the rest of the API shares.
+func newUserStorage(cfg config.Config, redisClient *redis.Client) (user.Storage, error) {
+	switch cfg.UserStorage {
+	case "", "memory":
+		return user.NewLocalStorage(), nil
+	case "redis":
+		return user.NewRedisStorage(redisClient, "sales-api:users:"), nil
+	default:
+		return nil, fmt.Errorf("unknown USER_STORAGE %q", cfg.UserStorage)
+	}
+}
+
+// salesArchive returns the archive of old sales: an S3 bucket when
+// ArchiveS3Bucket is set, a local directory when ArchiveDir is, or nil.
+func salesArchive(cfg config.Config) (sales.Archive, error) {
+	switch {
+	case cfg.ArchiveS3Bucket != "":
+		creds, err := awsauth.FromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return sales.NewBucketArchive(objstore.S3(cfg.ArchiveS3Bucket, cfg.AWSRegion, cfg.ArchiveS3Endpoint, creds, nil)), nil
+	case cfg.ArchiveDir != "":
+		return sales.NewBucketArchive(objstore.Dir(cfg.ArchiveDir)), nil
+	default:
+		return nil, nil
+	}
+}
+
+// attachmentBucket returns the bucket the files attached to sales are kept
+// in, or nil when attachments are not configured.
+func attachmentBucket(cfg config.Config) (objstore.Bucket, error) {
+	switch {
+	case cfg.AttachmentsS3Bucket != "":
+		creds, err := awsauth.FromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return objstore.S3(cfg.AttachmentsS3Bucket, cfg.AWSRegion, "", creds, nil), nil
+	case cfg.AttachmentsDir != "":
+		return objstore.Dir(cfg.AttachmentsDir), nil
+	default:
+		return nil, nil
+	}
+}
+
+// exportJobBucket returns the bucket export jobs are kept in, or nil when
+// they are not configured.
+func exportJobBucket(cfg config.Config) (objstore.Bucket, error) {
+	switch {
+	case cfg.ExportJobsS3Bucket != "":
+		creds, err := awsauth.FromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return objstore.S3(cfg.ExportJobsS3Bucket, cfg.AWSRegion, "", creds, nil), nil
+	case cfg.ExportJobsDir != "":
+		return objstore.Dir(cfg.ExportJobsDir), nil
+	default:
+		return nil, nil
+	}
+}
+
+// salesExporter returns the nightly exporter writing to the ExportTarget
+// bucket, or nil when exports are not configured.
+func salesExporter(cfg config.Config, salesService *sales.Service, logger *zap.Logger) (*export.Exporter, error) {
+	var bucket objstore.Bucket
+	switch cfg.ExportTarget {
+	case "":
+		return nil, nil
+	case "dir":
+		bucket = objstore.Dir(cfg.ExportBucket)
+	case "s3":
+		creds, err := awsauth.FromEnv()
+		if err != nil {
+			return nil, err
+		}
+		bucket = objstore.S3(cfg.ExportBucket, cfg.AWSRegion, "", creds, nil)
+	case "gcs":
+		bucket = objstore.GCS(cfg.ExportBucket, awsauth.Credentials{AccessKeyID: cfg.GCSAccessID, SecretAccessKey: cfg.GCSSecret}, nil)
+	default:
+		return nil, fmt.Errorf("unknown EXPORT_TARGET %q", cfg.ExportTarget)
+	}
+
+	format, err := export.LookupFormat(cfg.ExportFormat)
+	if err != nil {
+		return nil, err
+	}
+	return export.New(salesService, bucket, cfg.ExportPrefix, format, logger), nil
+}
+
+// servesItself reports whether userAPIURL points to this same server, i.e. a
+// loopback host on port.
+func servesItself(userAPIURL, port string) bool {
+	u, err := url.Parse(userAPIURL)
+	if err != nil || u.Port() != port {
+		return false
+	}
+	if u.Hostname() == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(u.Hostname())
+	return ip != nil && ip.IsLoopback()
+}
+
+// routes bundles the handlers shared by every API version.
+type routes struct {
+	users    *handler
+	sales    *salesHandler
+	admin    *adminHandler
+	webhooks *webhookHandler
+	exports  *exportHandler
+	compress gin.HandlerFunc
+
+	// auth authenticates every request by API key; saleQuota guards sale
+	// creation and adminOnly the endpoints needing an admin key
+	auth      gin.HandlerFunc
+	saleQuota gin.HandlerFunc
+	adminOnly gin.HandlerFunc
+
+	// deadlines of the read, write and bulk route groups
+	readTimeout  gin.HandlerFunc
+	writeTimeout gin.HandlerFunc
+	bulkTimeout  gin.HandlerFunc
+}
+
+// registerV1 binds the v1 user, sales and admin endpoints on g.
+func (r *routes) registerV1(g *gin.RouterGroup) {
+	g = g.Group("", r.auth)
+	reads := g.Group("", r.readTimeout)
+	writes := g.Group("", r.writeTimeout)
+	bulk := g.Group("", r.bulkTimeout)
+
+	writes.POST("/users", r.users.handleCreate)
+	bulk.POST("/users/import", r.users.handleImport)
+	reads.GET("/users", r.compress, r.users.handleList)
+	reads.GET("/users/:id", r.users.handleRead)
+	writes.PATCH("/users/:id", r.users.handleUpdate)
+	writes.PUT("/users/:id", r.users.handleReplace)
+	writes.DELETE("/users/:id", r.users.handleDelete)
+	writes.POST("/users/:id/verify", r.users.handleVerify)
+	writes.POST("/users/:id/block", r.users.handleBlock)
+	writes.POST("/users/:id/unblock", r.users.handleUnblock)
+	reads.GET("/users/:id/summary", r.users.handleSummary)
+	reads.GET("/users/:id/history", r.users.handleHistory)
+	reads.GET("/users/:id/sales", r.compress, r.users.handleUserSales)
+
+	writes.POST("/onboarding", r.saleQuota, r.users.handleOnboarding)
+
+	writes.POST("/sales", r.saleQuota, r.sales.handleCreateSale)
+	writes.POST("/checkout", r.saleQuota, r.sales.handleCheckout)
+	reads.GET("/sales", r.compress, r.sales.handleSearchSales)
+	bulk.GET("/sales/stream", r.compress, r.sales.handleStreamSales)
+	reads.GET("/sales/pending", r.compress, r.sales.handlePendingSales)
+	reads.GET("/sales/stats", r.sales.handleSalesStats)
+	reads.GET("/sales/aggregate", r.sales.handleAggregateSales)
+	reads.GET("/sales/reports/by-seller", r.sales.handleSalesBySeller)
+	reads.GET("/sales/jobs/:id", r.sales.handleGetCreationJob)
+	writes.POST("/sales/exports", r.exports.handleCreateExport)
+	reads.GET("/sales/exports/:id", r.exports.handleGetExport)
+	bulk.GET("/sales/exports/:id/download", r.compress, r.exports.handleDownloadExport)
+	reads.GET("/sales/by-number/:number", r.sales.handleGetSaleByNumber)
+	reads.GET("/sales/:id", r.sales.handleGetSale)
+	reads.GET("/sales/:id/history", r.sales.handleSaleHistory)
+	reads.GET("/sales/:id/notes", r.sales.handleSaleNotes)
+	writes.POST("/sales/:id/notes", r.sales.handleAddSaleNote)
+	reads.GET("/sales/:id/attachments", r.sales.handleSaleAttachments)
+	reads.GET("/sales/:id/attachments/:attachment_id", r.sales.handleGetAttachment)
+	writes.POST("/sales/:id/attachments", r.sales.handleAddAttachment)
 	// Ruta para actualizar el estado de una venta
-	e.PATCH("/sales/:id", salesHandler.PatchSaleHandler(salesService))
+	writes.PATCH("/sales/:id", r.sales.PatchSaleHandler(r.sales.salesService))
+	writes.POST("/sales/:id/claim", r.sales.handleClaimSale)
+	writes.POST("/sales/:id/approve", r.sales.handleApproveSale)
+	writes.POST("/sales/:id/reject", r.sales.handleRejectSale)
+	writes.POST("/sales/:id/reprocess", r.sales.handleReprocessSale)
+
+	writes.POST("/webhooks", r.webhooks.handleSubscribe)
+	reads.GET("/webhooks", r.webhooks.handleList)
+	reads.GET("/webhooks/:id", r.webhooks.handleGet)
+	reads.GET("/webhooks/:id/deliveries", r.webhooks.handleDeliveries)
+	writes.DELETE("/webhooks/:id", r.webhooks.handleUnsubscribe)
+	writes.POST("/webhooks/:id/rotate-secret", r.webhooks.handleRotateSecret)
+
+	// todo /admin requiere una clave de administrador
+	adminReads := reads.Group("/admin", r.adminOnly)
+	adminWrites := writes.Group("/admin", r.adminOnly)
+	adminReads.GET("/dashboard", r.admin.handleDashboard)
+	adminReads.GET("/keys/:id/usage", r.admin.handleKeyUsage)
+	adminWrites.POST("/apikeys", r.admin.handleCreateKey)
+	adminReads.GET("/apikeys", r.admin.handleListKeys)
+	adminWrites.DELETE("/apikeys/:id", r.admin.handleRevokeKey)
+	adminWrites.POST("/sales/:id/unarchive", r.admin.handleUnarchiveSale)
+	adminWrites.POST("/sales/:id/force-status", r.admin.handleForceStatus)
+	adminReads.GET("/sales/:id/audit", r.admin.handleSaleAudit)
+	adminReads.GET("/config", r.admin.handleExportConfig)
+	adminWrites.POST("/config/import", r.admin.handleImportConfig)
+	adminReads.GET("/exports/status", r.admin.handleExportStatus)
+	adminReads.GET("/jobs", r.admin.handleListJobs)
+	adminReads.GET("/alerts", r.admin.handleListAlerts)
+	adminReads.GET("/dlq", r.admin.handleListDeadLetters)
+	adminReads.GET("/sagas/:id", r.admin.handleGetSaga)
+	adminWrites.POST("/dlq/:id/replay", r.admin.handleReplayDeadLetter)
 }
@@ -1,8 +1,22 @@
 package api
 
 import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"Ejercicio_Final-Taller_Go/internal/audit"
+	"Ejercicio_Final-Taller_Go/internal/checkout"
+	"Ejercicio_Final-Taller_Go/internal/export"
+	"Ejercicio_Final-Taller_Go/internal/money"
+	"Ejercicio_Final-Taller_Go/internal/saga"
 	"Ejercicio_Final-Taller_Go/internal/sales"
 
 	"github.com/gin-gonic/gin"
@@ -12,13 +26,18 @@ import (
 // salesHandler holds the sales service and implements HTTP handlers for sales operations.
 type salesHandler struct {
 	salesService *sales.Service
+	creations    *sales.CreationQueue
+	checkouts    *checkout.Service
 	logger       *zap.Logger
 }
 
-// NewSalesHandler creates a new sales handler.
-func NewSalesHandler(salesService *sales.Service, logger *zap.Logger) *salesHandler {
+// NewSalesHandler creates a new sales handler. Asynchronous creations are
+// handed to creations, and paid sales to checkouts.
+func NewSalesHandler(salesService *sales.Service, creations *sales.CreationQueue, checkouts *checkout.Service, logger *zap.Logger) *salesHandler {
 	return &salesHandler{
 		salesService: salesService,
+		creations:    creations,
+		checkouts:    checkouts,
 		logger:       logger,
 	}
 }
@@ -26,58 +45,673 @@ func NewSalesHandler(salesService *sales.Service, logger *zap.Logger) *salesHand
 func (h *salesHandler) PatchSaleHandler(saleService *sales.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		saleID := c.Param("id")
+		// update_mask names the fields to change; without it, those present
+		// in the body are changed
 		var req struct {
-			Status string `json:"status"`
+			UpdateMask      []string          `json:"update_mask"`
+			Status          *sales.SaleStatus `json:"status"`
+			RejectionReason string            `json:"rejection_reason"`
+			Metadata        sales.Metadata    `json:"metadata"`
+			Tags            []string          `json:"tags"`
+			Notes           *string           `json:"notes"`
 		}
 
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		if err := bindJSON(c, &req); err != nil {
+			writeError(c, h.logger, err)
 			return
 		}
 
-		updated, err := saleService.UpdateSaleStatus(saleID, req.Status)
-		if err != nil {
-			switch err {
-			case sales.ErrNotFound:
-				c.JSON(http.StatusNotFound, gin.H{"error": "sale not found"})
-			case sales.ErrInvalidStatus:
-				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status value"})
-			case sales.ErrInvalidTransition:
-				c.JSON(http.StatusConflict, gin.H{"error": "invalid status transition"})
-			default:
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		patch := sales.SalePatch{
+			Mask:     req.UpdateMask,
+			Review:   sales.Review{RejectionReason: req.RejectionReason},
+			Metadata: req.Metadata,
+			Tags:     req.Tags,
+		}
+		if req.Status != nil {
+			patch.Status = *req.Status
+		}
+		if req.Notes != nil {
+			patch.Notes = *req.Notes
+		}
+		if patch.Mask == nil {
+			if req.Status != nil {
+				patch.Mask = append(patch.Mask, sales.FieldStatus)
+			}
+			if req.Metadata != nil {
+				patch.Mask = append(patch.Mask, sales.FieldMetadata)
 			}
+			if req.Tags != nil {
+				patch.Mask = append(patch.Mask, sales.FieldTags)
+			}
+			if req.Notes != nil {
+				patch.Mask = append(patch.Mask, sales.FieldNotes)
+			}
+		}
+
+		updated, err := saleService.PatchSale(c.Request.Context(), saleID, patch)
+		if err != nil {
+			writeError(c, h.logger, err, zap.String("sale_id", saleID))
 			return
 		}
 
-		c.JSON(http.StatusOK, updated)
+		c.JSON(http.StatusOK, newSaleResource(updated, saleService.Clock().Now()))
 	}
 }
 
 // handleCreateSale handles the POST /sales endpoint.
 func (h *salesHandler) handleCreateSale(ctx *gin.Context) {
+	// amount is the legacy decimal field; amount_cents takes precedence when present.
+	var req struct {
+		UserID      string      `json:"user_id"`
+		Amount      money.Cents `json:"amount"`
+		AmountCents *int64      `json:"amount_cents"`
+	}
+
+	if err := bindJSON(ctx, &req); err != nil {
+		requestLogger(ctx, h.logger).Warn("failed to bind JSON request", zap.Error(err))
+		writeError(ctx, h.logger, err)
+		return
+	}
+
+	if req.AmountCents != nil {
+		req.Amount = money.Cents(*req.AmountCents)
+	}
+
+	// Con "Prefer: respond-async" (RFC 7240) la venta se crea en segundo plano
+	if strings.Contains(ctx.GetHeader("Prefer"), "respond-async") {
+		job, err := h.creations.Enqueue(ctx.Request.Context(), req.UserID, req.Amount)
+		if err != nil {
+			writeError(ctx, h.logger, err, zap.String("user_id", req.UserID))
+			return
+		}
+
+		ctx.Header("Location", ctx.Request.URL.Path+"/jobs/"+job.ID)
+		ctx.Header("Preference-Applied", "respond-async")
+		ctx.JSON(http.StatusAccepted, creationJobResponse{CreationJob: job})
+		return
+	}
+
+	sale, err := h.salesService.CreateSale(ctx.Request.Context(), req.UserID, req.Amount)
+	if err != nil {
+		writeError(ctx, h.logger, err, zap.String("user_id", req.UserID), zap.Stringer("amount", req.Amount))
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, newSaleResource(sale, h.salesService.Clock().Now()))
+}
+
+// handleCheckout handles the POST /checkout endpoint.
+// It creates a sale, reserves its payment and confirms it; if a step fails
+// the previous ones are undone and the error of the failed step is returned.
+func (h *salesHandler) handleCheckout(ctx *gin.Context) {
+	var req struct {
+		UserID      string      `json:"user_id"`
+		Amount      money.Cents `json:"amount"`
+		AmountCents *int64      `json:"amount_cents"`
+	}
+	if err := bindJSON(ctx, &req); err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+	if req.AmountCents != nil {
+		req.Amount = money.Cents(*req.AmountCents)
+	}
+
+	sale, state, err := h.checkouts.Checkout(ctx.Request.Context(), req.UserID, req.Amount)
+	if err != nil {
+		fields := []zap.Field{zap.String("user_id", req.UserID)}
+		if state != nil {
+			fields = append(fields, zap.String("saga_id", state.ID), zap.String("saga_status", string(state.Status)))
+		}
+		writeError(ctx, h.logger, err, fields...)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, checkoutResponse{Saga: state, Sale: newSaleResource(sale, h.salesService.Clock().Now())})
+}
+
+// checkoutResponse is the body of POST /checkout.
+type checkoutResponse struct {
+	Saga *saga.State  `json:"saga"`
+	Sale saleResource `json:"sale"`
+}
+
+// creationJobResponse is a creation job with its failure, if any, described
+// as in error responses.
+type creationJobResponse struct {
+	*sales.CreationJob
+	Error *problem `json:"error,omitempty"`
+}
+
+// handleGetCreationJob handles GET /sales/jobs/:id
+// It reports the progress of an asynchronous sale creation and, once
+// finished, the created sale or the reason it failed.
+func (h *salesHandler) handleGetCreationJob(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	job, err := h.creations.Get(ctx.Request.Context(), id)
+	if err != nil {
+		writeError(ctx, h.logger, err, zap.String("job_id", id))
+		return
+	}
+
+	resp := creationJobResponse{CreationJob: job}
+	if job.Err != nil {
+		p := newProblem(ctx, job.Err)
+		resp.Error = &p
+	}
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// handleSearchSales handles GET /sales?user_id=&status=&filter=&limit=&offset=&count_only=
+// filter takes an expression such as "status:approved AND amount>100" (see
+// sales.ParseFilter); user_id and status, when given, override it.
+// The totals in meta cover every matching sale, not only the returned page.
+// With count_only=true only those totals are returned.
+func (h *salesHandler) handleSearchSales(ctx *gin.Context) {
+	limit, offset, err := parsePagination(ctx)
+	if err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+
+	countOnly, err := strconv.ParseBool(ctx.DefaultQuery("count_only", "false"))
+	if err != nil {
+		writeError(ctx, h.logger, errInvalidCountOnly)
+		return
+	}
+
+	filter, err := querySalesFilter(ctx)
+	if err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+
+	if countOnly {
+		metadata, err := h.salesService.CountSales(ctx.Request.Context(), filter)
+		if err != nil {
+			writeError(ctx, h.logger, err, zap.String("user_id", filter.UserID))
+			return
+		}
+		render(ctx, http.StatusOK, metadata)
+		return
+	}
+
+	results, metadata, err := h.salesService.FilterSales(ctx.Request.Context(), filter)
+	if err != nil {
+		writeError(ctx, h.logger, err, zap.String("user_id", filter.UserID))
+		return
+	}
+
+	meta := struct {
+		pageMeta
+		Totals *sales.SalesMetadata `json:"totals" xml:"totals"`
+	}{
+		pageMeta: pageMeta{Total: len(results), Limit: limit, Offset: offset},
+		Totals:   metadata,
+	}
+	writePage(ctx, newSaleResources(paginate(results, limit, offset), h.salesService.Clock().Now()), meta, len(results), limit, offset)
+}
+
+// querySalesFilter reads the filter of sales listings from the query: the
+// filter expression, overridden by user_id, status and rejection_reason.
+func querySalesFilter(ctx *gin.Context) (sales.SalesFilter, error) {
+	filter, err := sales.ParseFilter(ctx.Query("filter"))
+	if err != nil {
+		return filter, err
+	}
+	if userID := ctx.Query("user_id"); userID != "" {
+		filter.UserID = userID
+	}
+	if status := ctx.Query("status"); status != "" {
+		filter.Status = sales.SaleStatus(status)
+	}
+	if reason := ctx.Query("rejection_reason"); reason != "" {
+		filter.RejectionReason = reason
+	}
+	return filter, nil
+}
+
+// handleAggregateSales handles GET /sales/aggregate?group_by=&user_id=&status=&filter=
+// It returns the counts and sums of the matching sales per status, user or
+// creation day (UTC), so one endpoint can serve reports that would
+// otherwise need their own. The filters are those of GET /sales.
+func (h *salesHandler) handleAggregateSales(ctx *gin.Context) {
+	filter, err := querySalesFilter(ctx)
+	if err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+
+	groupBy := sales.GroupBy(ctx.Query("group_by"))
+	groups, err := h.salesService.AggregateSales(ctx.Request.Context(), filter, groupBy)
+	if err != nil {
+		writeError(ctx, h.logger, err, zap.String("group_by", string(groupBy)))
+		return
+	}
+	render(ctx, http.StatusOK, struct {
+		XMLName xml.Name           `json:"-" xml:"aggregate"`
+		GroupBy sales.GroupBy      `json:"group_by" xml:"group_by"`
+		Groups  []sales.SalesGroup `json:"groups" xml:"group"`
+	}{GroupBy: groupBy, Groups: groups})
+}
+
+// handleSalesStats handles GET /sales/stats?user_id=&status=&buckets=
+// It returns the totals of every sale, or of those of one user or status,
+// from the storage's read model, next to the distribution of their
+// amounts: percentiles and a histogram by buckets, comma-separated upper
+// bounds such as "10,100,1000" (see sales.DefaultBuckets).
+func (h *salesHandler) handleSalesStats(ctx *gin.Context) {
+	filter := sales.SalesFilter{UserID: ctx.Query("user_id"), Status: sales.SaleStatus(ctx.Query("status"))}
+	bounds, err := sales.ParseBuckets(ctx.Query("buckets"))
+	if err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+
+	metadata, err := h.salesService.CountSales(ctx.Request.Context(), filter)
+	if err != nil {
+		writeError(ctx, h.logger, err, zap.String("user_id", filter.UserID))
+		return
+	}
+	distribution, err := h.salesService.AmountDistribution(ctx.Request.Context(), filter, bounds)
+	if err != nil {
+		writeError(ctx, h.logger, err, zap.String("user_id", filter.UserID))
+		return
+	}
+	render(ctx, http.StatusOK, salesStats{SalesMetadata: metadata, Distribution: distribution})
+}
+
+// salesStats is the body of GET /sales/stats.
+type salesStats struct {
+	XMLName xml.Name `json:"-" xml:"stats"`
+	*sales.SalesMetadata
+	Distribution *sales.Distribution `json:"distribution" xml:"distribution"`
+}
+
+// handleSalesBySeller handles GET /sales/reports/by-seller?from=&to=
+// It returns the totals of the sales each seller created in the range, for
+// commissions and performance reviews. from and to are dates or RFC 3339
+// timestamps; a date to includes that whole day. Either may be omitted.
+func (h *salesHandler) handleSalesBySeller(ctx *gin.Context) {
+	from, to, err := parseDateRange(ctx.Query("from"), ctx.Query("to"))
+	if err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+
+	totals, err := h.salesService.SalesBySeller(ctx.Request.Context(), from, to)
+	if err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+	render(ctx, http.StatusOK, struct {
+		XMLName xml.Name            `json:"-" xml:"report"`
+		Sellers []sales.SellerTotal `json:"sellers" xml:"seller"`
+	}{Sellers: totals})
+}
+
+// parseDateRange parses the from and to query parameters of reports; to is
+// exclusive once parsed. Empty values are returned as zero times.
+func parseDateRange(fromValue, toValue string) (from, to time.Time, err error) {
+	parse := func(v string, end bool) (time.Time, error) {
+		if v == "" {
+			return time.Time{}, nil
+		}
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t, nil
+		}
+		t, err := time.Parse(time.DateOnly, v)
+		if err == nil && end {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, err
+	}
+
+	if from, err = parse(fromValue, false); err != nil {
+		return from, to, errInvalidDateRange
+	}
+	if to, err = parse(toValue, true); err != nil {
+		return from, to, errInvalidDateRange
+	}
+	if !from.IsZero() && !to.IsZero() && !to.After(from) {
+		return from, to, errInvalidDateRange
+	}
+	return from, to, nil
+}
+
+// handleGetSaleByNumber handles GET /sales/by-number/:number
+func (h *salesHandler) handleGetSaleByNumber(ctx *gin.Context) {
+	number := ctx.Param("number")
+
+	sale, err := h.salesService.GetSaleByNumber(ctx.Request.Context(), number)
+	if err != nil {
+		writeError(ctx, h.logger, err, zap.String("sale_number", number))
+		return
+	}
+
+	render(ctx, http.StatusOK, newSaleResource(sale, h.salesService.Clock().Now()))
+}
+
+// handleGetSale handles GET /sales/:id
+// The response carries an ETag derived from the sale version, and a matching
+// If-None-Match header is answered with 304 Not Modified.
+func (h *salesHandler) handleGetSale(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	sale, err := h.salesService.GetSale(ctx.Request.Context(), id)
+	if err != nil {
+		writeError(ctx, h.logger, err, zap.String("sale_id", id))
+		return
+	}
+
+	etag := versionETag(sale.Version)
+	ctx.Header("ETag", etag)
+	if match := ctx.GetHeader("If-None-Match"); match != "" && etagMatches(match, etag) {
+		ctx.Status(http.StatusNotModified)
+		return
+	}
+
+	render(ctx, http.StatusOK, newSaleResource(sale, h.salesService.Clock().Now()))
+}
+
+// handleSaleHistory handles GET /sales/:id/history?at=
+// It lists the recorded events of the sale, oldest first, next to the sale
+// as of at (an RFC 3339 timestamp) or, without it, its latest state. Only
+// available with the event-sourced storage.
+func (h *salesHandler) handleSaleHistory(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	at := h.salesService.Clock().Now()
+	if v := ctx.Query("at"); v != "" {
+		var err error
+		if at, err = time.Parse(time.RFC3339Nano, v); err != nil {
+			writeError(ctx, h.logger, errInvalidAt)
+			return
+		}
+	}
+
+	events, err := h.salesService.SaleHistory(ctx.Request.Context(), id)
+	if err != nil {
+		writeError(ctx, h.logger, err, zap.String("sale_id", id))
+		return
+	}
+	sale, err := h.salesService.SaleAt(ctx.Request.Context(), id, at)
+	if err != nil {
+		writeError(ctx, h.logger, err, zap.String("sale_id", id))
+		return
+	}
+
+	// solo los eventos que ya habían pasado en at
+	n := len(events)
+	for n > 0 && events[n-1].At.After(at) {
+		n--
+	}
+	ctx.JSON(http.StatusOK, saleHistory{Sale: newSaleResource(sale, h.salesService.Clock().Now()), Events: events[:n]})
+}
+
+// saleHistory is the body of GET /sales/:id/history.
+type saleHistory struct {
+	Sale   saleResource        `json:"sale"`
+	Events []sales.StreamEvent `json:"events"`
+}
+
+// handleAddSaleNote handles POST /sales/:id/notes
+// It adds a note with the text of the body, written by the API key of the request.
+func (h *salesHandler) handleAddSaleNote(ctx *gin.Context) {
+	id := ctx.Param("id")
+
 	var req struct {
-		UserID string  `json:"user_id"`
-		Amount float64 `json:"amount"`
+		Text string `json:"text"`
+	}
+	if err := bindJSON(ctx, &req); err != nil {
+		writeError(ctx, h.logger, err)
+		return
 	}
 
-	if err := ctx.ShouldBindJSON(&req); err != nil {
-		h.logger.Warn("failed to bind JSON request", zap.Error(err))
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+	note, err := h.salesService.AddNote(ctx.Request.Context(), id, req.Text)
+	if err != nil {
+		writeError(ctx, h.logger, err, zap.String("sale_id", id))
 		return
 	}
 
-	sale, err := h.salesService.CreateSale(req.UserID, req.Amount)
+	ctx.JSON(http.StatusCreated, note)
+}
+
+// handleAddAttachment handles POST /sales/:id/attachments
+// It attaches the file sent as the "file" field of a multipart/form-data
+// body, uploaded by the actor of the request.
+func (h *salesHandler) handleAddAttachment(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	header, err := ctx.FormFile("file")
 	if err != nil {
-		h.logger.Error("failed to create sale", zap.Error(err), zap.String("user_id", req.UserID), zap.Float64("amount", req.Amount))
-		if err.Error() == "amount must be greater than zero" || err.Error() == "user not found" {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(ctx, h.logger, errBodyTooLarge)
 			return
 		}
-		// Consider more specific error handling based en el tipo de error
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create sale"})
+		writeError(ctx, h.logger, invalidBody(fmt.Errorf("missing file: %w", err)))
+		return
+	}
+	f, err := header.Open()
+	if err != nil {
+		writeError(ctx, h.logger, invalidBody(err))
+		return
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		writeError(ctx, h.logger, invalidBody(err))
+		return
+	}
+
+	attachment, err := h.salesService.AddAttachment(ctx.Request.Context(), id, header.Filename, data)
+	if err != nil {
+		writeError(ctx, h.logger, err, zap.String("sale_id", id))
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, attachment)
+}
+
+// handleSaleAttachments handles GET /sales/:id/attachments
+// It lists the attachments of the sale, oldest first, without their content.
+func (h *salesHandler) handleSaleAttachments(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	attachments, err := h.salesService.SaleAttachments(ctx.Request.Context(), id)
+	if err != nil {
+		writeError(ctx, h.logger, err, zap.String("sale_id", id))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"results": attachments})
+}
+
+// handleGetAttachment handles GET /sales/:id/attachments/:attachment_id
+// It downloads the content of an attachment, with the type it was accepted as.
+func (h *salesHandler) handleGetAttachment(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	attachment, data, err := h.salesService.AttachmentContent(ctx.Request.Context(), id, ctx.Param("attachment_id"))
+	if err != nil {
+		writeError(ctx, h.logger, err, zap.String("sale_id", id))
+		return
+	}
+
+	ctx.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name}))
+	ctx.Header("X-Content-Type-Options", "nosniff")
+	ctx.Data(http.StatusOK, attachment.ContentType, data)
+}
+
+// handleSaleNotes handles GET /sales/:id/notes
+// It lists the notes of the sale, oldest first.
+func (h *salesHandler) handleSaleNotes(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	notes, err := h.salesService.SaleNotes(ctx.Request.Context(), id)
+	if err != nil {
+		writeError(ctx, h.logger, err, zap.String("sale_id", id))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"results": notes})
+}
+
+// streamFlushEvery is how many sales are buffered before flushing to the client.
+const streamFlushEvery = 100
+
+// handleStreamSales handles GET /sales/stream?user_id=&status=&format=
+// Sales are written while they are read from storage, as newline-delimited
+// JSON or, with format=parquet, as a Parquet file. format=msgpack, or no
+// format and Accept: application/msgpack, writes consecutive MessagePack maps.
+func (h *salesHandler) handleStreamSales(ctx *gin.Context) {
+	userID := ctx.Query("user_id")
+	status := sales.SaleStatus(ctx.Query("status"))
+	if status != "" && !status.Valid() {
+		writeError(ctx, h.logger, sales.ErrInvalidStatus)
+		return
+	}
+
+	name := ctx.Query("format")
+	if name == "" {
+		name = "ndjson"
+		if negotiate(ctx) == mimeMsgpack {
+			name = "msgpack"
+		}
+	}
+	format, err := export.LookupFormat(name)
+	if err != nil {
+		writeError(ctx, h.logger, errInvalidExportFormat)
+		return
+	}
+
+	ctx.Header("Content-Type", format.ContentType)
+	ctx.Status(http.StatusOK)
+
+	enc := format.NewEncoder(ctx.Writer)
+	written := 0
+	err = h.salesService.StreamSales(ctx.Request.Context(), userID, status, func(sale *sales.Sale) error {
+		if err := enc.Write(sale); err != nil {
+			return err
+		}
+
+		written++
+		if written%streamFlushEvery == 0 {
+			ctx.Writer.Flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = enc.Close()
+	}
+	if err != nil {
+		// headers are already sent, so the client only sees a truncated stream
+		requestLogger(ctx, h.logger).Warn("sales stream interrupted", zap.Error(err), zap.Int("written", written))
+		return
+	}
+
+	ctx.Writer.Flush()
+}
+
+// handlePendingSales handles GET /sales/pending?assigned_to=&limit=&offset=
+// It returns the review queue, oldest sales first.
+func (h *salesHandler) handlePendingSales(ctx *gin.Context) {
+	limit, offset, err := parsePagination(ctx)
+	if err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+
+	results, total, err := h.salesService.PendingSales(ctx.Request.Context(), ctx.Query("assigned_to"), limit, offset)
+	if err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+
+	render(ctx, http.StatusOK, pendingPage{
+		Results: newSaleResources(results, h.salesService.Clock().Now()),
+		Paging:  pageMeta{Total: total, Limit: limit, Offset: offset},
+	})
+}
+
+// pendingPage is the body of GET /sales/pending.
+type pendingPage struct {
+	XMLName xml.Name       `json:"-" xml:"pending"`
+	Results []saleResource `json:"results" xml:"results>sale"`
+	Paging  pageMeta       `json:"paging" xml:"paging"`
+}
+
+// handleApproveSale handles POST /sales/:id/approve
+func (h *salesHandler) handleApproveSale(ctx *gin.Context) {
+	h.reviewSale(ctx, h.salesService.ApproveSale)
+}
+
+// handleRejectSale handles POST /sales/:id/reject
+func (h *salesHandler) handleRejectSale(ctx *gin.Context) {
+	h.reviewSale(ctx, h.salesService.RejectSale)
+}
+
+// reviewSale runs action on the sale of the request with the reason and
+// rejection reason code of its optional body, attributed to the API key of
+// the request, if any.
+func (h *salesHandler) reviewSale(ctx *gin.Context, action func(context.Context, string, sales.Review) (*sales.Sale, error)) {
+	id := ctx.Param("id")
+
+	var req struct {
+		Reason          string `json:"reason"`
+		RejectionReason string `json:"rejection_reason"`
+	}
+	// el cuerpo es opcional
+	if ctx.Request.ContentLength != 0 {
+		if err := bindJSON(ctx, &req); err != nil {
+			writeError(ctx, h.logger, err)
+			return
+		}
+	}
+	reqCtx := ctx.Request.Context()
+	review := sales.Review{Actor: audit.ActorFromContext(reqCtx), Reason: req.Reason, RejectionReason: req.RejectionReason}
+	sale, err := action(reqCtx, id, review)
+	if err != nil {
+		writeError(ctx, h.logger, err, zap.String("sale_id", id))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newSaleResource(sale, h.salesService.Clock().Now()))
+}
+
+// handleReprocessSale handles POST /sales/:id/reprocess
+// It decides a rejected sale again, e.g. after a transient failure upstream.
+func (h *salesHandler) handleReprocessSale(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	sale, err := h.salesService.Reprocess(ctx.Request.Context(), id)
+	if err != nil {
+		writeError(ctx, h.logger, err, zap.String("sale_id", id))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newSaleResource(sale, h.salesService.Clock().Now()))
+}
+
+// handleClaimSale handles POST /sales/:id/claim
+func (h *salesHandler) handleClaimSale(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	var req struct {
+		Reviewer string `json:"reviewer"`
+	}
+	if err := bindJSON(ctx, &req); err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+
+	sale, err := h.salesService.ClaimSale(ctx.Request.Context(), id, req.Reviewer)
+	if err != nil {
+		writeError(ctx, h.logger, err, zap.String("sale_id", id))
 		return
 	}
 
-	ctx.JSON(http.StatusCreated, sale)
+	ctx.JSON(http.StatusOK, newSaleResource(sale, h.salesService.Clock().Now()))
 }
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"net/http"
+
+	"Ejercicio_Final-Taller_Go/internal/webhook"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// webhookHandler implements the HTTP handlers of the /webhooks endpoints,
+// through which tenants manage their webhook subscriptions.
+type webhookHandler struct {
+	webhooks *webhook.Dispatcher
+	logger   *zap.Logger
+}
+
+// subscriptionSecret is a subscription together with its signing secret,
+// which is only shown when it is created or rotated.
+type subscriptionSecret struct {
+	*webhook.Subscription
+	Secret string `json:"secret"`
+}
+
+// handleSubscribe handles POST /webhooks
+// The body is a subscription: url, and optionally events, format
+// (full, diff, cloudevents or template), schema_version, and the template
+// and content_type of the template format. The response carries the
+// secret deliveries are signed with, which cannot be retrieved again.
+func (h *webhookHandler) handleSubscribe(ctx *gin.Context) {
+	var req webhook.Subscription
+	if err := bindStrictJSON(ctx, &req); err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+
+	sub, secret, err := h.webhooks.Subscribe(ctx.Request.Context(), req)
+	if err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, subscriptionSecret{Subscription: sub, Secret: secret})
+}
+
+// handleRotateSecret handles POST /webhooks/:id/rotate-secret
+// The response carries the new secret. The previous one keeps signing the
+// deliveries until previous_secret_expires_at.
+func (h *webhookHandler) handleRotateSecret(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	sub, secret, err := h.webhooks.RotateSecret(ctx.Request.Context(), id)
+	if err != nil {
+		writeError(ctx, h.logger, err, zap.String("webhook_id", id))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, subscriptionSecret{Subscription: sub, Secret: secret})
+}
+
+// handleList handles GET /webhooks
+func (h *webhookHandler) handleList(ctx *gin.Context) {
+	subs, err := h.webhooks.List(ctx.Request.Context())
+	if err != nil {
+		writeError(ctx, h.logger, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"results": subs})
+}
+
+// handleGet handles GET /webhooks/:id
+func (h *webhookHandler) handleGet(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	sub, err := h.webhooks.Get(ctx.Request.Context(), id)
+	if err != nil {
+		writeError(ctx, h.logger, err, zap.String("webhook_id", id))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, sub)
+}
+
+// handleDeliveries handles GET /webhooks/:id/deliveries?outcome=
+// It lists the last delivery attempts of the subscription, newest first,
+// only the succeeded or failed ones if outcome is given.
+func (h *webhookHandler) handleDeliveries(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	attempts, err := h.webhooks.Deliveries(ctx.Request.Context(), id, webhook.Outcome(ctx.Query("outcome")))
+	if err != nil {
+		writeError(ctx, h.logger, err, zap.String("webhook_id", id))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"results": attempts})
+}
+
+// handleUnsubscribe handles DELETE /webhooks/:id
+func (h *webhookHandler) handleUnsubscribe(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	if err := h.webhooks.Unsubscribe(ctx.Request.Context(), id); err != nil {
+		writeError(ctx, h.logger, err, zap.String("webhook_id", id))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
@@ -0,0 +1,245 @@
+// Package anomaly watches the sales of every tenant and raises an alert
+// when the volume or the rejection rate of the last hour departs from the
+// hours before it, e.g. after a broken release or a fraud wave.
+package anomaly
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/clock"
+	"Ejercicio_Final-Taller_Go/internal/idgen"
+	"Ejercicio_Final-Taller_Go/internal/sales"
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+
+	"go.uber.org/zap"
+)
+
+// Kind is what an alert is about.
+type Kind string
+
+const (
+	// KindVolumeSpike is raised when far more sales than usual are created.
+	KindVolumeSpike Kind = "volume_spike"
+	// KindVolumeDrop is raised when far fewer sales than usual are created.
+	KindVolumeDrop Kind = "volume_drop"
+	// KindRejectionRate is raised when many more sales than usual are rejected.
+	KindRejectionRate Kind = "rejection_rate"
+	// KindRejectionBreaker is raised when so many sales are rejected that
+	// new ones start pending (see sales.WithRejectionBreaker).
+	KindRejectionBreaker Kind = "rejection_breaker"
+)
+
+// Alert is a deviation of the last hour from the baseline. Value and
+// Baseline are sales per hour for volume alerts, and fractions of rejected
+// sales for rejection rate alerts.
+type Alert struct {
+	ID       string    `json:"id"`
+	Kind     Kind      `json:"kind"`
+	At       time.Time `json:"at"`
+	Value    float64   `json:"value"`
+	Baseline float64   `json:"baseline"`
+	Message  string    `json:"message"`
+}
+
+// Thresholds tell how far the last hour must be from the baseline to alert.
+type Thresholds struct {
+	// VolumeSigma is how many standard deviations from the mean hourly
+	// volume of the baseline the last hour must be.
+	VolumeSigma float64
+	// RejectionDelta is how much the rejection rate of the last hour must
+	// exceed that of the baseline, e.g. 0.2 for 20 points.
+	RejectionDelta float64
+	// MinSales is the number of sales below which the last hour or the
+	// baseline are too few to tell anything.
+	MinSales int
+}
+
+// Sender delivers an alert raised in the tenant of ctx, e.g. to a chat channel.
+type Sender func(ctx context.Context, a Alert)
+
+// maxAlerts is how many alerts are kept per tenant.
+const maxAlerts = 100
+
+// Analyzer compares, on each Run, the last hour of sales of every tenant
+// with a baseline of the hours before it. An alert of a kind is raised at
+// most once an hour per tenant, so a lasting deviation is not repeated on
+// every run. Alerts are kept in memory. It is safe for concurrent use.
+type Analyzer struct {
+	sales      *sales.Service
+	thresholds Thresholds
+	baseline   int // horas
+	senders    []Sender
+	clock      clock.Clock
+	ids        idgen.Generator
+	logger     *zap.Logger
+
+	mu     sync.Mutex
+	alerts map[string][]Alert   // tenant -> alerts, oldest first
+	raised map[string]time.Time // tenant + kind -> last alert
+}
+
+// Option configures optional dependencies of an Analyzer.
+type Option func(*Analyzer)
+
+// WithClock sets the clock that dates the hours analyzed. Defaults to the system clock.
+func WithClock(c clock.Clock) Option {
+	return func(a *Analyzer) {
+		a.clock = c
+	}
+}
+
+// WithIDGenerator sets the generator of alert IDs. Defaults to UUIDs.
+func WithIDGenerator(ids idgen.Generator) Option {
+	return func(a *Analyzer) {
+		a.ids = ids
+	}
+}
+
+// WithSender delivers every alert raised through send, besides keeping it.
+func WithSender(send Sender) Option {
+	return func(a *Analyzer) {
+		a.senders = append(a.senders, send)
+	}
+}
+
+// WithBaseline sets how many hours before the last one make the baseline.
+// Defaults to 24.
+func WithBaseline(hours int) Option {
+	return func(a *Analyzer) {
+		a.baseline = hours
+	}
+}
+
+// New creates an Analyzer of the sales of salesService.
+func New(salesService *sales.Service, thresholds Thresholds, logger *zap.Logger, opts ...Option) *Analyzer {
+	a := &Analyzer{
+		sales:      salesService,
+		thresholds: thresholds,
+		baseline:   24,
+		clock:      clock.System(),
+		ids:        idgen.UUID(),
+		logger:     logger,
+		alerts:     map[string][]Alert{},
+		raised:     map[string]time.Time{},
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Run analyzes the last hour of every tenant once.
+func (a *Analyzer) Run(ctx context.Context) error {
+	tenants, err := a.sales.Tenants(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := a.clock.Now()
+	for _, id := range tenants {
+		tctx := tenant.WithID(ctx, id)
+		volumes, err := a.sales.VolumeWindows(tctx, now, time.Hour, a.baseline+1)
+		if err != nil {
+			return fmt.Errorf("error analyzing sales of tenant %s: %w", id, err)
+		}
+		for _, alert := range a.detect(volumes) {
+			a.raise(tctx, now, alert)
+		}
+	}
+	return nil
+}
+
+// detect returns the alerts the last of volumes deserves given the others.
+func (a *Analyzer) detect(volumes []sales.Volume) []Alert {
+	last, baseline := volumes[len(volumes)-1], volumes[:len(volumes)-1]
+	minSales := a.thresholds.MinSales
+
+	var total, rejected int
+	for _, v := range baseline {
+		total += v.Total
+		rejected += v.Rejected
+	}
+	if len(baseline) == 0 || total < minSales {
+		return nil
+	}
+
+	// la varianza de un conteo es al menos su media (Poisson), así un
+	// baseline muy parejo no dispara alertas por una venta de diferencia
+	mean := float64(total) / float64(len(baseline))
+	var variance float64
+	for _, v := range baseline {
+		variance += (float64(v.Total) - mean) * (float64(v.Total) - mean)
+	}
+	sd := math.Sqrt(max(variance/float64(len(baseline)), mean, 1))
+
+	var alerts []Alert
+	current := float64(last.Total)
+	switch sigma := a.thresholds.VolumeSigma * sd; {
+	case current > mean+sigma && last.Total >= minSales:
+		alerts = append(alerts, Alert{Kind: KindVolumeSpike, Value: current, Baseline: mean,
+			Message: fmt.Sprintf("%d sales in the last hour, against %.1f per hour usually", last.Total, mean)})
+	case current < mean-sigma:
+		alerts = append(alerts, Alert{Kind: KindVolumeDrop, Value: current, Baseline: mean,
+			Message: fmt.Sprintf("%d sales in the last hour, against %.1f per hour usually", last.Total, mean)})
+	}
+
+	if last.Total >= minSales {
+		rate, usual := float64(last.Rejected)/float64(last.Total), float64(rejected)/float64(total)
+		if rate-usual > a.thresholds.RejectionDelta {
+			alerts = append(alerts, Alert{Kind: KindRejectionRate, Value: rate, Baseline: usual,
+				Message: fmt.Sprintf("%.0f%% of the sales of the last hour were rejected, against %.0f%% usually", rate*100, usual*100)})
+		}
+	}
+	return alerts
+}
+
+// raise keeps and sends alert, unless one of its kind was raised in the
+// tenant of ctx within the last hour.
+func (a *Analyzer) raise(ctx context.Context, now time.Time, alert Alert) {
+	id := tenant.FromContext(ctx)
+	key := id + "/" + string(alert.Kind)
+
+	a.mu.Lock()
+	if last, ok := a.raised[key]; ok && now.Sub(last) < time.Hour {
+		a.mu.Unlock()
+		return
+	}
+	a.raised[key] = now
+	alert.ID, alert.At = a.ids.NewID(), now
+	alerts := append(a.alerts[id], alert)
+	if len(alerts) > maxAlerts {
+		alerts = slices.Delete(alerts, 0, len(alerts)-maxAlerts)
+	}
+	a.alerts[id] = alerts
+	a.mu.Unlock()
+
+	a.logger.Warn("sales anomaly", zap.String("tenant", id), zap.String("kind", string(alert.Kind)),
+		zap.Float64("value", alert.Value), zap.Float64("baseline", alert.Baseline))
+	for _, send := range a.senders {
+		send(ctx, alert)
+	}
+}
+
+// Raise keeps and sends an alert detected elsewhere in the tenant of ctx,
+// under the same once an hour limit as those of Run.
+func (a *Analyzer) Raise(ctx context.Context, alert Alert) {
+	a.raise(ctx, a.clock.Now(), alert)
+}
+
+// Alerts returns the alerts raised in the tenant of ctx, newest first.
+func (a *Analyzer) Alerts(ctx context.Context) []Alert {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	alerts := slices.Clone(a.alerts[tenant.FromContext(ctx)])
+	slices.Reverse(alerts)
+	if alerts == nil {
+		alerts = []Alert{}
+	}
+	return alerts
+}
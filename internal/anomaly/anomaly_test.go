@@ -0,0 +1,88 @@
+package anomaly
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/clock"
+	"Ejercicio_Final-Taller_Go/internal/sales"
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// seed stores, in each of the hours before now, count sales of which
+// rejected are rejected; the last entry is the last hour.
+func seed(t *testing.T, ctx context.Context, storage *sales.LocalStorage, now time.Time, hours []struct{ count, rejected int }) {
+	t.Helper()
+	for i, h := range hours {
+		at := now.Add(-time.Duration(len(hours)-i) * time.Hour).Add(30 * time.Minute)
+		for j := range h.count {
+			status := sales.StatusApproved
+			if j < h.rejected {
+				status = sales.StatusRejected
+			}
+			sale := &sales.Sale{ID: fmt.Sprintf("%d-%d", i, j), UserID: "u", Amount: 1000, Status: status, CreatedAt: at}
+			require.NoError(t, storage.Set(ctx, sale))
+		}
+	}
+}
+
+func TestAnalyzer(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	c := clock.NewManual(now)
+	acme := tenant.WithID(context.Background(), "acme")
+	globex := tenant.WithID(context.Background(), "globex")
+
+	storage := sales.NewLocalStorage()
+	usual := make([]struct{ count, rejected int }, 24)
+	for i := range usual {
+		usual[i].count, usual[i].rejected = 20, 2
+	}
+	// acme: el triple de ventas, la mitad rechazadas; globex: lo de siempre
+	seed(t, acme, storage, now, append(usual, struct{ count, rejected int }{60, 30}))
+	seed(t, globex, storage, now, append(usual, struct{ count, rejected int }{21, 2}))
+
+	var sent []Alert
+	a := New(sales.NewService(storage, zap.NewNop(), ""), Thresholds{VolumeSigma: 3, RejectionDelta: 0.2, MinSales: 10}, zap.NewNop(),
+		WithClock(c), WithSender(func(_ context.Context, alert Alert) { sent = append(sent, alert) }))
+
+	require.NoError(t, a.Run(context.Background()))
+	alerts := a.Alerts(acme)
+	require.Len(t, alerts, 2)
+	require.Equal(t, KindRejectionRate, alerts[0].Kind)
+	require.InDelta(t, 0.5, alerts[0].Value, 1e-9)
+	require.InDelta(t, 0.1, alerts[0].Baseline, 1e-9)
+	require.Equal(t, KindVolumeSpike, alerts[1].Kind)
+	require.InDelta(t, 20, alerts[1].Baseline, 1e-9)
+	require.Len(t, sent, 2)
+	require.Empty(t, a.Alerts(globex))
+
+	// la misma anomalía no se repite en cada corrida
+	c.Advance(5 * time.Minute)
+	require.NoError(t, a.Run(context.Background()))
+	require.Len(t, a.Alerts(acme), 2)
+
+	// globex deja de vender
+	c.Advance(time.Hour)
+	require.NoError(t, a.Run(context.Background()))
+	alerts = a.Alerts(globex)
+	require.Len(t, alerts, 1)
+	require.Equal(t, KindVolumeDrop, alerts[0].Kind)
+}
+
+func TestAnalyzer_TooFewSales(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+	storage := sales.NewLocalStorage()
+	// una tienda nueva no tiene con qué comparar
+	seed(t, ctx, storage, now, []struct{ count, rejected int }{{0, 0}, {1, 0}, {30, 20}})
+
+	a := New(sales.NewService(storage, zap.NewNop(), ""), Thresholds{VolumeSigma: 3, RejectionDelta: 0.2, MinSales: 10}, zap.NewNop(),
+		WithClock(clock.NewManual(now)), WithBaseline(2))
+	require.NoError(t, a.Run(ctx))
+	require.Empty(t, a.Alerts(ctx))
+}
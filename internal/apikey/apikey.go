@@ -0,0 +1,247 @@
+// Package apikey authenticates clients by API key and meters their monthly usage.
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/apperrors"
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+)
+
+// Header is the HTTP header clients send their API key in.
+const Header = "X-API-Key"
+
+// ErrInvalid is returned for a missing, unknown or revoked API key.
+var ErrInvalid = apperrors.New(apperrors.Unauthorized, "invalid_api_key", "invalid API key")
+
+// ErrNotFound is returned when no key has the given ID.
+var ErrNotFound = apperrors.New(apperrors.NotFound, "api_key_not_found", "API key not found")
+
+// ErrInvalidName is returned when creating a key without a name.
+var ErrInvalidName = apperrors.New(apperrors.Validation, "invalid_api_key_name", "API key name is required")
+
+// ErrTenantNotAllowed is returned when a request names a tenant other than
+// the one its key is bound to.
+var ErrTenantNotAllowed = apperrors.New(apperrors.Forbidden, "tenant_not_allowed", "the API key cannot act in this tenant")
+
+// secretPrefix marks generated secrets so they are easy to spot in logs and repos.
+const secretPrefix = "sk_"
+
+// Key is a registered API key. Only the hash of the secret is kept.
+type Key struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Hash string `json:"-"`
+
+	// RequestQuota and SaleQuota cap the requests made and sales created per
+	// calendar month (UTC); 0 means unlimited.
+	RequestQuota int64 `json:"request_quota"`
+	SaleQuota    int64 `json:"sale_quota"`
+	// Admin allows the key to call the admin-only endpoints. Only keys
+	// given in the configuration can be admins.
+	Admin bool `json:"admin"`
+	// Tenant is the only tenant the key's requests act in. Keys without one
+	// act in tenant.Default, except admin keys, which act in the tenant
+	// their requests name.
+	Tenant string `json:"tenant,omitempty"`
+
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	// RevokedAt is set once the key is revoked; revoked keys no longer authenticate.
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Generate creates a key with a new random secret, which is returned so it
+// can be shown to the caller once: only its hash is kept in the key.
+func Generate(id, name string, requestQuota, saleQuota int64, now time.Time) (*Key, string, error) {
+	if name == "" {
+		return nil, "", ErrInvalidName
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", fmt.Errorf("error generating API key secret: %w", err)
+	}
+	secret := secretPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	return &Key{
+		ID:           id,
+		Name:         name,
+		Hash:         Hash(secret),
+		RequestQuota: requestQuota,
+		SaleQuota:    saleQuota,
+		CreatedAt:    now,
+	}, secret, nil
+}
+
+// ActingTenant returns the tenant a request made with k acts in, given the
+// tenant it names, "" when it names none. Returns ErrTenantNotAllowed when
+// it names a tenant other than the key's.
+func (k *Key) ActingTenant(requested string) (string, error) {
+	bound := k.Tenant
+	if bound == "" {
+		if k.Admin && requested != "" {
+			return requested, nil
+		}
+		bound = tenant.Default
+	}
+	if requested != "" && requested != bound {
+		return "", ErrTenantNotAllowed
+	}
+	return bound, nil
+}
+
+// Hash returns the hex SHA-256 of secret, as stored in Key.Hash.
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Store keeps the registered API keys.
+type Store interface {
+	Save(ctx context.Context, key *Key) error
+	Get(ctx context.Context, id string) (*Key, error)
+	// Lookup finds the key whose secret is secret. Returns ErrInvalid if there is none.
+	Lookup(ctx context.Context, secret string) (*Key, error)
+	// Empty reports whether no key is registered, in which case the API is open.
+	Empty(ctx context.Context) (bool, error)
+	// List returns every key, revoked ones included, oldest first.
+	List(ctx context.Context) ([]*Key, error)
+	// Touch records that the key of id was used at t.
+	Touch(ctx context.Context, id string, t time.Time) error
+	// Revoke stops the key of id from authenticating. Returns ErrNotFound if there is none.
+	Revoke(ctx context.Context, id string, t time.Time) error
+}
+
+// LocalStore is an in-memory Store. It is safe for concurrent use; keys are
+// returned as copies so callers never race with Touch.
+type LocalStore struct {
+	mu     sync.RWMutex
+	byID   map[string]*Key
+	byHash map[string]*Key
+}
+
+// NewLocalStore creates an empty LocalStore.
+func NewLocalStore() *LocalStore {
+	return &LocalStore{
+		byID:   map[string]*Key{},
+		byHash: map[string]*Key{},
+	}
+}
+
+// Save stores or replaces key.
+func (l *LocalStore) Save(ctx context.Context, key *Key) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if old, ok := l.byID[key.ID]; ok {
+		delete(l.byHash, old.Hash)
+	}
+	k := *key
+	l.byID[key.ID] = &k
+	l.byHash[key.Hash] = &k
+	return nil
+}
+
+// Get returns the key with the given ID, or ErrNotFound.
+func (l *LocalStore) Get(ctx context.Context, id string) (*Key, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	k, ok := l.byID[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	c := *k
+	return &c, nil
+}
+
+// Lookup returns the key whose secret is secret, or ErrInvalid.
+func (l *LocalStore) Lookup(ctx context.Context, secret string) (*Key, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	k, ok := l.byHash[Hash(secret)]
+	if !ok || k.RevokedAt != nil {
+		return nil, ErrInvalid
+	}
+	c := *k
+	return &c, nil
+}
+
+// Empty reports whether no key is stored.
+func (l *LocalStore) Empty(ctx context.Context) (bool, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return len(l.byID) == 0, nil
+}
+
+// List returns copies of every key, oldest first.
+func (l *LocalStore) List(ctx context.Context) ([]*Key, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	keys := make([]*Key, 0, len(l.byID))
+	for _, k := range l.byID {
+		c := *k
+		keys = append(keys, &c)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+	return keys, nil
+}
+
+// Touch sets the last use of the key of id to t.
+func (l *LocalStore) Touch(ctx context.Context, id string, t time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	k, ok := l.byID[id]
+	if !ok {
+		return ErrNotFound
+	}
+	k.LastUsedAt = &t
+	return nil
+}
+
+// Revoke marks the key of id as revoked at t. Revoking it again keeps the
+// original time.
+func (l *LocalStore) Revoke(ctx context.Context, id string, t time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	k, ok := l.byID[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if k.RevokedAt == nil {
+		k.RevokedAt = &t
+	}
+	return nil
+}
+
+type ctxKey struct{}
+
+// WithKey returns a copy of ctx authenticated as key.
+func WithKey(ctx context.Context, key *Key) context.Context {
+	return context.WithValue(ctx, ctxKey{}, key)
+}
+
+// FromContext returns the key ctx was authenticated with, if any.
+func FromContext(ctx context.Context) (*Key, bool) {
+	k, ok := ctx.Value(ctxKey{}).(*Key)
+	return k, ok
+}
@@ -0,0 +1,66 @@
+package apikey
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalStore_Lifecycle(t *testing.T) {
+	ctx := context.Background()
+	store := NewLocalStore()
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	_, _, err := Generate("k1", "", 0, 0, now)
+	require.ErrorIs(t, err, ErrInvalidName)
+
+	key, secret, err := Generate("k1", "shop", 100, 10, now)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(secret, "sk_"))
+	require.NotContains(t, key.Hash, secret)
+	require.NoError(t, store.Save(ctx, key))
+
+	found, err := store.Lookup(ctx, secret)
+	require.NoError(t, err)
+	require.Equal(t, "k1", found.ID)
+	_, err = store.Lookup(ctx, "sk_wrong")
+	require.ErrorIs(t, err, ErrInvalid)
+
+	require.NoError(t, store.Touch(ctx, "k1", now.Add(time.Minute)))
+	keys, err := store.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	require.Equal(t, now.Add(time.Minute), *keys[0].LastUsedAt)
+
+	require.NoError(t, store.Revoke(ctx, "k1", now.Add(time.Hour)))
+	_, err = store.Lookup(ctx, secret)
+	require.ErrorIs(t, err, ErrInvalid)
+	require.ErrorIs(t, store.Revoke(ctx, "missing", now), ErrNotFound)
+}
+
+func TestKey_ActingTenant(t *testing.T) {
+	bound := &Key{ID: "acme", Tenant: "acme"}
+	id, err := bound.ActingTenant("")
+	require.NoError(t, err)
+	require.Equal(t, "acme", id)
+	_, err = bound.ActingTenant("other")
+	require.ErrorIs(t, err, ErrTenantNotAllowed)
+
+	// sin tenant propio, solo las admin eligen el tenant
+	unbound := &Key{ID: "shop"}
+	id, err = unbound.ActingTenant("")
+	require.NoError(t, err)
+	require.Equal(t, tenant.Default, id)
+	_, err = unbound.ActingTenant("acme")
+	require.ErrorIs(t, err, ErrTenantNotAllowed)
+
+	admin := &Key{ID: "ops", Admin: true}
+	id, err = admin.ActingTenant("acme")
+	require.NoError(t, err)
+	require.Equal(t, "acme", id)
+}
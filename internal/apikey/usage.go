@@ -0,0 +1,188 @@
+package apikey
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/apperrors"
+	"Ejercicio_Final-Taller_Go/internal/clock"
+)
+
+// ErrQuotaExceeded is returned once a key used up its monthly quota.
+var ErrQuotaExceeded = apperrors.New(apperrors.RateLimited, "quota_exceeded", "monthly quota exceeded")
+
+// Usage is what a key consumed during a calendar month.
+type Usage struct {
+	KeyID        string `json:"key_id"`
+	Month        string `json:"month"` // YYYY-MM, UTC
+	Requests     int64  `json:"requests"`
+	SalesCreated int64  `json:"sales_created"`
+}
+
+// Meter counts requests and created sales per key and month and enforces
+// the quotas of each key. Only the current month is kept. It is safe for
+// concurrent use.
+type Meter struct {
+	clock clock.Clock
+
+	mu       sync.Mutex
+	month    string            // del que se lleva la cuenta, YYYY-MM
+	usage    map[string]*Usage // key ID -> usage
+	reserved map[string]int64  // key ID -> ventas reservadas y todavía no creadas
+}
+
+// NewMeter creates a Meter that reads the current month from c.
+func NewMeter(c clock.Clock) *Meter {
+	return &Meter{
+		clock:    c,
+		usage:    map[string]*Usage{},
+		reserved: map[string]int64{},
+	}
+}
+
+// current returns the usage of keyID this month, dropping what was counted
+// in past months. Callers must hold m.mu.
+func (m *Meter) current(keyID string) *Usage {
+	if month := m.clock.Now().UTC().Format("2006-01"); month != m.month {
+		m.month = month
+		clear(m.usage)
+		clear(m.reserved)
+	}
+	u, ok := m.usage[keyID]
+	if !ok {
+		u = &Usage{KeyID: keyID, Month: m.month}
+		m.usage[keyID] = u
+	}
+	return u
+}
+
+// Request counts a request made with key. Returns ErrQuotaExceeded, without
+// counting it, if the key already reached its request quota.
+func (m *Meter) Request(key *Key) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := m.current(key.ID)
+	if key.RequestQuota > 0 && u.Requests >= key.RequestQuota {
+		return ErrQuotaExceeded
+	}
+	u.Requests++
+	return nil
+}
+
+// AllowSale returns ErrQuotaExceeded if key already created, or reserved,
+// as many sales this month as its sale quota allows.
+func (m *Meter) AllowSale(key *Key) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if key.SaleQuota > 0 && m.current(key.ID).SalesCreated+m.reserved[key.ID] >= key.SaleQuota {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// ReserveSale takes one of the sales key has left this month, or returns
+// ErrQuotaExceeded, so concurrent requests cannot create more sales than
+// the quota allows. The reservation is kept until it is committed, once
+// the sale is created, or released.
+func (m *Meter) ReserveSale(key *Key) (*SaleReservation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if key.SaleQuota > 0 && m.current(key.ID).SalesCreated+m.reserved[key.ID] >= key.SaleQuota {
+		return nil, ErrQuotaExceeded
+	}
+	m.reserved[key.ID]++
+	return &SaleReservation{meter: m, keyID: key.ID, month: m.month, held: true}, nil
+}
+
+// SaleReservation is a sale of the quota of a key reserved by ReserveSale.
+// It is safe for concurrent use.
+type SaleReservation struct {
+	meter *Meter
+	keyID string
+	month string
+	held  bool // guarded by meter.mu
+}
+
+// Commit counts a sale created with the reservation, turning it into a
+// created sale. Sales committed after the first, or after Release, are
+// counted on top.
+func (r *SaleReservation) Commit() {
+	m := r.meter
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r.release()
+	m.current(r.keyID).SalesCreated++
+}
+
+// Release gives the reservation back, unless a sale was committed with it.
+// Calling it again does nothing.
+func (r *SaleReservation) Release() {
+	r.meter.mu.Lock()
+	defer r.meter.mu.Unlock()
+
+	r.release()
+}
+
+// release drops the reservation if it is still held, and was made this
+// month. Callers must hold r.meter.mu.
+func (r *SaleReservation) release() {
+	m := r.meter
+	m.current(r.keyID)
+	if r.held && r.month == m.month {
+		if m.reserved[r.keyID]--; m.reserved[r.keyID] <= 0 {
+			delete(m.reserved, r.keyID)
+		}
+	}
+	r.held = false
+}
+
+type reservationKey struct{}
+
+// WithSaleReservation returns a copy of ctx carrying r, for the sale created
+// within it to commit.
+func WithSaleReservation(ctx context.Context, r *SaleReservation) context.Context {
+	return context.WithValue(ctx, reservationKey{}, r)
+}
+
+// SaleReservationFromContext returns the sale reservation ctx carries, if any.
+func SaleReservationFromContext(ctx context.Context) (*SaleReservation, bool) {
+	r, ok := ctx.Value(reservationKey{}).(*SaleReservation)
+	return r, ok
+}
+
+// Sale counts a sale created with the key of keyID.
+func (m *Meter) Sale(keyID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.current(keyID).SalesCreated++
+}
+
+// SalesTaken returns the sales counted this month against the sale quota
+// of the key of keyID: the ones created and the ones reserved.
+func (m *Meter) SalesTaken(keyID string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.current(keyID).SalesCreated + m.reserved[keyID]
+}
+
+// Usage returns what the key of keyID consumed this month.
+func (m *Meter) Usage(keyID string) Usage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return *m.current(keyID)
+}
+
+// Reset returns when the current quota period ends, i.e. the start of next
+// month in UTC.
+func (m *Meter) Reset() time.Time {
+	now := m.clock.Now().UTC()
+	return time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,103 @@
+package apikey
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/clock"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMeter_Quotas(t *testing.T) {
+	c := clock.NewManual(time.Date(2024, 1, 31, 23, 0, 0, 0, time.UTC))
+	m := NewMeter(c)
+	key := &Key{ID: "ops", RequestQuota: 2, SaleQuota: 1}
+
+	require.NoError(t, m.Request(key))
+	require.NoError(t, m.Request(key))
+	require.ErrorIs(t, m.Request(key), ErrQuotaExceeded)
+
+	require.NoError(t, m.AllowSale(key))
+	m.Sale(key.ID)
+	require.ErrorIs(t, m.AllowSale(key), ErrQuotaExceeded)
+
+	require.Equal(t, Usage{KeyID: "ops", Month: "2024-01", Requests: 2, SalesCreated: 1}, m.Usage("ops"))
+	require.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), m.Reset())
+
+	// a new month starts with a clean slate
+	c.Advance(time.Hour)
+	require.NoError(t, m.Request(key))
+	require.NoError(t, m.AllowSale(key))
+	require.Equal(t, Usage{KeyID: "ops", Month: "2024-02", Requests: 1}, m.Usage("ops"))
+}
+
+func TestMeter_ReserveSale(t *testing.T) {
+	c := clock.NewManual(time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC))
+	m := NewMeter(c)
+	key := &Key{ID: "ops", SaleQuota: 2}
+
+	// las reservas ocupan la cuota aunque las ventas todavía no se crearon
+	first, err := m.ReserveSale(key)
+	require.NoError(t, err)
+	second, err := m.ReserveSale(key)
+	require.NoError(t, err)
+	_, err = m.ReserveSale(key)
+	require.ErrorIs(t, err, ErrQuotaExceeded)
+	require.ErrorIs(t, m.AllowSale(key), ErrQuotaExceeded)
+
+	// una venta que no se creó devuelve su lugar
+	second.Release()
+	second.Release()
+	first.Commit()
+	first.Release()
+	require.Equal(t, int64(1), m.Usage("ops").SalesCreated)
+	third, err := m.ReserveSale(key)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), m.SalesTaken("ops"))
+	_, err = m.ReserveSale(key)
+	require.ErrorIs(t, err, ErrQuotaExceeded)
+
+	// una reserva del mes pasado no toca la cuenta del nuevo
+	c.Advance(20 * 24 * time.Hour)
+	third.Release()
+	third.Commit()
+	require.Equal(t, Usage{KeyID: "ops", Month: "2024-02", SalesCreated: 1}, m.Usage("ops"))
+}
+
+func TestMeter_ReserveSaleConcurrently(t *testing.T) {
+	m := NewMeter(clock.System())
+	key := &Key{ID: "ops", SaleQuota: 10}
+
+	var wg sync.WaitGroup
+	var reserved atomic.Int64
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if r, err := m.ReserveSale(key); err == nil {
+				reserved.Add(1)
+				r.Commit()
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int64(10), reserved.Load())
+	require.Equal(t, int64(10), m.Usage("ops").SalesCreated)
+}
+
+func TestMeter_DropsPastMonths(t *testing.T) {
+	c := clock.NewManual(time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC))
+	m := NewMeter(c)
+	for _, id := range []string{"a", "b", "c"} {
+		require.NoError(t, m.Request(&Key{ID: id}))
+	}
+	require.Len(t, m.usage, 3)
+
+	c.Advance(31 * 24 * time.Hour)
+	require.NoError(t, m.Request(&Key{ID: "a"}))
+	require.Len(t, m.usage, 1)
+	require.Equal(t, Usage{KeyID: "a", Month: "2024-02", Requests: 1}, m.Usage("a"))
+}
@@ -0,0 +1,159 @@
+package apperrors
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// Kind classifies an error by how a caller is expected to react to it.
+type Kind int
+
+const (
+	// Internal is the zero Kind, used for unexpected failures.
+	Internal Kind = iota
+	// NotFound means the requested resource does not exist.
+	NotFound
+	// Validation means the input was rejected.
+	Validation
+	// Conflict means the request clashes with the current state of the resource.
+	Conflict
+	// DependencyUnavailable means a downstream service could not be reached or failed.
+	DependencyUnavailable
+	// Unprocessable means the input is well-formed but semantically invalid.
+	Unprocessable
+	// Timeout means the request ran out of time before it could be completed.
+	Timeout
+	// Unauthorized means the caller did not present valid credentials.
+	Unauthorized
+	// RateLimited means the caller used up its allowance.
+	RateLimited
+	// TooLarge means the request exceeds a size limit.
+	TooLarge
+	// Forbidden means the caller is authenticated but not allowed to do it.
+	Forbidden
+)
+
+// Error is a domain error tagged with a Kind and a stable, machine-readable code.
+type Error struct {
+	Kind Kind
+	Code string
+	Err  error
+}
+
+// New creates an Error with its own underlying sentinel built from message.
+// It is meant to declare package-level sentinel errors, which are listed in
+// the Catalog.
+func New(kind Kind, code, message string) *Error {
+	register(kind, code, message)
+	return &Error{Kind: kind, Code: code, Err: errors.New(message)}
+}
+
+// Wrap returns an Error with the kind and code of e wrapping err. It lets a
+// sentinel declared with New serve as the template of errors whose cause is
+// only known at runtime, so their code is still in the Catalog.
+func (e *Error) Wrap(err error) *Error {
+	return &Error{Kind: e.Kind, Code: e.Code, Err: err}
+}
+
+// Wrap tags an existing error with a Kind and code.
+func Wrap(kind Kind, code string, err error) *Error {
+	return &Error{Kind: kind, Code: code, Err: err}
+}
+
+// Error returns the message of the wrapped error.
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped error so errors.Is and errors.As see through it.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// KindOf returns the Kind of the first Error in err's chain, or Internal.
+func KindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return Internal
+}
+
+// CodeOf returns the code of the first Error in err's chain, or "internal_error".
+func CodeOf(err error) string {
+	var e *Error
+	if errors.As(err, &e) && e.Code != "" {
+		return e.Code
+	}
+	return "internal_error"
+}
+
+// HTTPStatus maps err to the HTTP status code handlers should answer with.
+func HTTPStatus(err error) int {
+	switch KindOf(err) {
+	case NotFound:
+		return http.StatusNotFound
+	case Validation:
+		return http.StatusBadRequest
+	case Conflict:
+		return http.StatusConflict
+	case DependencyUnavailable:
+		return http.StatusServiceUnavailable
+	case Unprocessable:
+		return http.StatusUnprocessableEntity
+	case Timeout:
+		return http.StatusGatewayTimeout
+	case Unauthorized:
+		return http.StatusUnauthorized
+	case RateLimited:
+		return http.StatusTooManyRequests
+	case TooLarge:
+		return http.StatusRequestEntityTooLarge
+	case Forbidden:
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Entry describes an error code the API can answer with.
+type Entry struct {
+	Code        string `json:"code"`
+	Status      int    `json:"status"`
+	Description string `json:"description"`
+}
+
+var catalog = struct {
+	sync.Mutex
+	entries map[string]Entry
+}{entries: map[string]Entry{
+	"internal_error": {Code: "internal_error", Status: http.StatusInternalServerError, Description: "internal error"},
+}}
+
+// register adds code to the catalog. Internal errors are answered as
+// internal_error, so their own codes are left out.
+func register(kind Kind, code, message string) {
+	if kind == Internal {
+		return
+	}
+	catalog.Lock()
+	defer catalog.Unlock()
+	if _, ok := catalog.entries[code]; !ok {
+		catalog.entries[code] = Entry{Code: code, Status: HTTPStatus(&Error{Kind: kind}), Description: message}
+	}
+}
+
+// Catalog returns every error code declared with New, sorted by code.
+func Catalog() []Entry {
+	catalog.Lock()
+	defer catalog.Unlock()
+
+	entries := make([]Entry, 0, len(catalog.entries))
+	for _, e := range catalog.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Code < entries[j].Code })
+	return entries
+}
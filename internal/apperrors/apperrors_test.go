@@ -0,0 +1,57 @@
+package apperrors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPStatus(t *testing.T) {
+	errGone := New(NotFound, "thing_not_found", "thing not found")
+
+	tests := []struct {
+		name     string
+		err      error
+		wantCode string
+		want     int
+	}{
+		{name: "not found", err: errGone, wantCode: "thing_not_found", want: http.StatusNotFound},
+		{name: "wrapped", err: fmt.Errorf("reading thing: %w", errGone), wantCode: "thing_not_found", want: http.StatusNotFound},
+		{name: "validation", err: New(Validation, "bad", "bad input"), wantCode: "bad", want: http.StatusBadRequest},
+		{name: "conflict", err: New(Conflict, "busy", "busy"), wantCode: "busy", want: http.StatusConflict},
+		{name: "dependency", err: Wrap(DependencyUnavailable, "down", errors.New("dial tcp")), wantCode: "down", want: http.StatusServiceUnavailable},
+		{name: "unprocessable", err: New(Unprocessable, "odd", "odd"), wantCode: "odd", want: http.StatusUnprocessableEntity},
+		{name: "timeout", err: Wrap(Timeout, "late", errors.New("deadline exceeded")), wantCode: "late", want: http.StatusGatewayTimeout},
+		{name: "unauthorized", err: New(Unauthorized, "who", "who are you"), wantCode: "who", want: http.StatusUnauthorized},
+		{name: "rate limited", err: New(RateLimited, "slow", "slow down"), wantCode: "slow", want: http.StatusTooManyRequests},
+		{name: "plain error", err: errors.New("boom"), wantCode: "internal_error", want: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, HTTPStatus(tt.err))
+			require.Equal(t, tt.wantCode, CodeOf(tt.err))
+		})
+	}
+
+	require.True(t, errors.Is(fmt.Errorf("reading thing: %w", errGone), errGone))
+}
+
+func TestCatalog(t *testing.T) {
+	New(Conflict, "catalog_test_conflict", "catalog test conflict")
+	New(Internal, "catalog_test_internal", "catalog test internal")
+
+	var codes []string
+	for _, e := range Catalog() {
+		codes = append(codes, e.Code)
+		if e.Code == "catalog_test_conflict" {
+			require.Equal(t, Entry{Code: "catalog_test_conflict", Status: http.StatusConflict, Description: "catalog test conflict"}, e)
+		}
+	}
+	require.Contains(t, codes, "catalog_test_conflict")
+	require.Contains(t, codes, "internal_error")
+	require.NotContains(t, codes, "catalog_test_internal")
+	require.IsIncreasing(t, codes)
+}
@@ -0,0 +1,95 @@
+// Package audit records who changed the resources of the API, what they
+// changed and when, so that support can answer for any past edit.
+package audit
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+)
+
+// Change is the value of one field before and after an edit. Nested
+// fields are named with dots, e.g. "address.city".
+type Change struct {
+	Field  string `json:"field"`
+	Before any    `json:"before"`
+	After  any    `json:"after"`
+}
+
+// Entry records one edit of a resource, such as a user.
+type Entry struct {
+	ID         string    `json:"id"`
+	Resource   string    `json:"resource"`
+	ResourceID string    `json:"resource_id"`
+	Action     string    `json:"action"`
+	Actor      string    `json:"actor,omitempty"`
+	At         time.Time `json:"at"`
+	Changes    []Change  `json:"changes,omitempty"`
+	// Reason is why the edit was made, when it has to be justified.
+	Reason string `json:"reason,omitempty"`
+}
+
+// Store keeps the entries of every tenant, scoped by the tenant in ctx.
+type Store interface {
+	// Append records e.
+	Append(ctx context.Context, e Entry) error
+	// List returns the entries of the resource with the given ID, oldest first.
+	List(ctx context.Context, resource, id string) ([]Entry, error)
+}
+
+// LocalStore keeps entries in memory. It is safe for concurrent use.
+type LocalStore struct {
+	mu      sync.Mutex
+	entries map[string][]Entry // tenant + resource + ID -> entries
+}
+
+// NewLocalStore creates an empty LocalStore.
+func NewLocalStore() *LocalStore {
+	return &LocalStore{entries: map[string][]Entry{}}
+}
+
+// Append records e after the earlier entries of its resource.
+func (s *LocalStore) Append(ctx context.Context, e Entry) error {
+	e.Changes = slices.Clone(e.Changes)
+	key := storeKey(ctx, e.Resource, e.ResourceID)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = append(s.entries[key], e)
+	return nil
+}
+
+// List returns copies of the entries of the resource, in the order appended.
+func (s *LocalStore) List(ctx context.Context, resource, id string) ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := s.entries[storeKey(ctx, resource, id)]
+	entries := make([]Entry, len(stored))
+	for i, e := range stored {
+		e.Changes = slices.Clone(e.Changes)
+		entries[i] = e
+	}
+	return entries, nil
+}
+
+func storeKey(ctx context.Context, resource, id string) string {
+	return tenant.FromContext(ctx) + "/" + resource + "/" + id
+}
+
+type actorKey struct{}
+
+// WithActor returns a copy of ctx whose edits are attributed to actor,
+// such as "apikey:" followed by the ID of the API key of the request.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor set by WithActor, or "" if none.
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
@@ -0,0 +1,45 @@
+package awsauth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// CallJSON invokes target (e.g. "TrentService.Encrypt") on a service
+// speaking the AWS JSON 1.1 protocol in region, sending in and decoding the
+// answer into out.
+func CallJSON(ctx context.Context, c *http.Client, creds Credentials, region, service, target string, in, out any) error {
+	payload, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("error encoding %s request: %w", target, err)
+	}
+
+	endpoint := fmt.Sprintf("https://%s.%s.amazonaws.com/", service, region)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("error building %s request: %w", target, err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target)
+	Sign(req, payload, creds, region, service, time.Now())
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling %s: %w", target, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned unexpected status %d: %s", target, resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("error decoding %s response: %w", target, err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package awsauth
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestSign checks cases of the AWS SigV4 test suite, all signed at the
+// same instant with its example credentials.
+func TestSign(t *testing.T) {
+	creds := Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	at := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name, method, url, body string
+		header                  http.Header
+		signedHeaders           string
+		signature               string
+	}{
+		{name: "get-vanilla", method: http.MethodGet, url: "https://example.amazonaws.com/",
+			signedHeaders: "host;x-amz-date", signature: "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+		{name: "get-vanilla-query-order-key-case", method: http.MethodGet, url: "https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			signedHeaders: "host;x-amz-date", signature: "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500"},
+		{name: "get-vanilla-query-order-value", method: http.MethodGet, url: "https://example.amazonaws.com/?Param1=value2&Param1=Value1",
+			signedHeaders: "host;x-amz-date", signature: "eedbc4e291e521cf13422ffca22be7d2eb8146eecf653089df300a15b2382bd1"},
+		{name: "get-vanilla-utf8-query", method: http.MethodGet, url: "https://example.amazonaws.com/?ሴ=bar",
+			signedHeaders: "host;x-amz-date", signature: "2cdec8eed098649ff3a119c94853b13c643bcf08f8b0a1d91e12c9027818dd04"},
+		{name: "get-vanilla-query-unreserved", method: http.MethodGet,
+			url:           "https://example.amazonaws.com/?-._~0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz=-._~0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz",
+			signedHeaders: "host;x-amz-date", signature: "9c3e54bfcdf0b19771a7f523ee5669cdf59bc7cc0884027167c21bb143a40197"},
+		{name: "post-vanilla", method: http.MethodPost, url: "https://example.amazonaws.com/",
+			signedHeaders: "host;x-amz-date", signature: "5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b"},
+		{name: "post-vanilla-query", method: http.MethodPost, url: "https://example.amazonaws.com/?Param1=value1",
+			signedHeaders: "host;x-amz-date", signature: "28038455d6de14eafc1f9222cf5aa6f1a96197d7deb8263271d420d138af7f11"},
+		{name: "post-x-www-form-urlencoded", method: http.MethodPost, url: "https://example.amazonaws.com/", body: "Param1=value1",
+			header:        http.Header{"Content-Type": {"application/x-www-form-urlencoded"}},
+			signedHeaders: "content-type;host;x-amz-date", signature: "ff11897932ad3f4e8b18135d722051e5ac45fc38421b1da7b9d196a0fe09473a"},
+		{name: "post-x-www-form-urlencoded-parameters", method: http.MethodPost, url: "https://example.amazonaws.com/", body: "Param1=value1",
+			header:        http.Header{"Content-Type": {"application/x-www-form-urlencoded; charset=utf8"}},
+			signedHeaders: "content-type;host;x-amz-date", signature: "1a72ec8f64bd914b0e42e42607c7fbce7fb2c7465f63e3092b3b0d39fa77a6fe"},
+		// como get-header-value-trim y get-header-value-order, pero con
+		// encabezados x-amz-*, los únicos además de host y content-type que se firman
+		{name: "header-value-trim-and-order", method: http.MethodGet, url: "https://example.amazonaws.com/",
+			header:        http.Header{"X-Amz-Meta-Trim": {"  a   b  c "}, "X-Amz-Meta-List": {"value1", "value2"}},
+			signedHeaders: "host;x-amz-date;x-amz-meta-list;x-amz-meta-trim", signature: "cd3691f3d1077c867422c2a662cc140c629e3f1693940245878eb641a7870510"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+			require.NoError(t, err)
+			for name, values := range tc.header {
+				req.Header[name] = values
+			}
+			Sign(req, []byte(tc.body), creds, "us-east-1", "service", at)
+
+			require.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+			require.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders="+
+				tc.signedHeaders+", Signature="+tc.signature, req.Header.Get("Authorization"))
+		})
+	}
+}
+
+func TestCanonicalHeaders(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	require.NoError(t, err)
+	req.Header.Set("User-Agent", "sales-api")
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header["X-Amz-Meta-Trim"] = []string{"  a   b\t c "}
+	req.Header["X-Amz-Meta-List"] = []string{"value1", "value2"}
+
+	// los espacios se colapsan, los valores repetidos se unen y el resto de los encabezados no se firma
+	headers, signed := canonicalHeaders(req)
+	require.Equal(t, "content-type:text/plain\nhost:example.amazonaws.com\nx-amz-meta-list:value1,value2\nx-amz-meta-trim:a b c\n", headers)
+	require.Equal(t, "content-type;host;x-amz-meta-list;x-amz-meta-trim", signed)
+}
@@ -0,0 +1,57 @@
+// Package buildinfo describes the build of the running binary.
+//
+// The values are set at link time, e.g.
+//
+//	go build -ldflags "-X Ejercicio_Final-Taller_Go/internal/buildinfo.Version=v1.4.0 \
+//		-X Ejercicio_Final-Taller_Go/internal/buildinfo.Commit=$(git rev-parse HEAD) \
+//		-X Ejercicio_Final-Taller_Go/internal/buildinfo.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// When they are not, the commit and its time are taken from the VCS
+// information the Go toolchain embeds.
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// Set through -ldflags "-X ...".
+var (
+	Version   = "dev"
+	Commit    string
+	BuildTime string
+)
+
+// Info is the build information of the binary.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+var (
+	once sync.Once
+	info Info
+)
+
+// Get returns the build information of the running binary.
+func Get() Info {
+	once.Do(func() {
+		info = Info{Version: Version, Commit: Commit, BuildTime: BuildTime, GoVersion: runtime.Version()}
+		bi, ok := debug.ReadBuildInfo()
+		if !ok {
+			return
+		}
+		for _, s := range bi.Settings {
+			switch {
+			case s.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = s.Value
+			case s.Key == "vcs.time" && info.BuildTime == "":
+				info.BuildTime = s.Value
+			}
+		}
+	})
+	return info
+}
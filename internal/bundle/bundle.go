@@ -0,0 +1,249 @@
+// Package bundle exports the configuration-like entities of the API as a
+// single document, and imports it into another environment, so staging
+// and production can be kept aligned.
+package bundle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/apikey"
+	"Ejercicio_Final-Taller_Go/internal/apperrors"
+	"Ejercicio_Final-Taller_Go/internal/clock"
+	"Ejercicio_Final-Taller_Go/internal/money"
+	"Ejercicio_Final-Taller_Go/internal/sales"
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+	"Ejercicio_Final-Taller_Go/internal/webhook"
+
+	"go.uber.org/zap"
+)
+
+// Version is the version of the bundles written by Export.
+const Version = 1
+
+// ErrInvalidBundle is returned when importing a bundle of an unknown
+// version or with an invalid webhook.
+var ErrInvalidBundle = apperrors.New(apperrors.Validation, "invalid_bundle", "invalid configuration bundle")
+
+// Bundle is the configuration of a tenant: its webhook subscriptions, the
+// metadata of the API keys and the thresholds that can be changed at
+// runtime. It holds no secrets.
+type Bundle struct {
+	Version    int        `json:"version"`
+	ExportedAt time.Time  `json:"exported_at"`
+	Webhooks   []Webhook  `json:"webhooks"`
+	APIKeys    []APIKey   `json:"api_keys"`
+	Thresholds Thresholds `json:"thresholds"`
+}
+
+// Webhook is a webhook subscription, identified by its URL.
+type Webhook struct {
+	URL           string            `json:"url"`
+	Events        []sales.EventType `json:"events,omitempty"`
+	Format        webhook.Format    `json:"format"`
+	SchemaVersion int               `json:"schema_version"`
+	Template      string            `json:"template,omitempty"`
+	ContentType   string            `json:"content_type,omitempty"`
+}
+
+// APIKey is the metadata of an API key: its secret stays in its environment.
+type APIKey struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	RequestQuota int64  `json:"request_quota"`
+	SaleQuota    int64  `json:"sale_quota"`
+	Revoked      bool   `json:"revoked,omitempty"`
+}
+
+// Thresholds are the thresholds changed without a restart. ChannelNotify
+// is the minimum amount of the sales posted to chat channels.
+type Thresholds struct {
+	ChannelNotify money.Cents `json:"channel_notify"`
+}
+
+// Result tells what Import changed.
+type Result struct {
+	Webhooks []ImportedWebhook `json:"webhooks"`
+	// UpdatedKeys are the API keys whose metadata was replaced, and
+	// SkippedKeys those missing here, which cannot be created without
+	// their secret.
+	UpdatedKeys []string `json:"updated_keys"`
+	SkippedKeys []string `json:"skipped_keys"`
+}
+
+// ImportedWebhook is a webhook subscription created or updated by Import.
+// Secret is only set for new subscriptions, and only shown this once.
+type ImportedWebhook struct {
+	ID      string `json:"id"`
+	URL     string `json:"url"`
+	Created bool   `json:"created"`
+	Secret  string `json:"secret,omitempty"`
+}
+
+// Service exports and imports bundles.
+type Service struct {
+	webhooks     *webhook.Dispatcher
+	keys         apikey.Store
+	threshold    func() money.Cents
+	setThreshold func(money.Cents)
+	clock        clock.Clock
+	logger       *zap.Logger
+}
+
+// Option configures optional dependencies of a Service.
+type Option func(*Service)
+
+// WithClock sets the clock that dates the bundles. Defaults to the system clock.
+func WithClock(c clock.Clock) Option {
+	return func(s *Service) {
+		s.clock = c
+	}
+}
+
+// New creates a Service over the subscriptions of webhooks, the API keys
+// in keys, and the chat notification threshold read by threshold and
+// changed by setThreshold.
+func New(webhooks *webhook.Dispatcher, keys apikey.Store, threshold func() money.Cents, setThreshold func(money.Cents), logger *zap.Logger, opts ...Option) *Service {
+	s := &Service{
+		webhooks:     webhooks,
+		keys:         keys,
+		threshold:    threshold,
+		setThreshold: setThreshold,
+		clock:        clock.System(),
+		logger:       logger,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Export returns the bundle of the tenant in ctx. The thresholds are
+// shared by every tenant, so they are exported with each bundle.
+func (s *Service) Export(ctx context.Context) (*Bundle, error) {
+	subs, err := s.webhooks.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := s.keys.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Bundle{
+		Version:    Version,
+		ExportedAt: s.clock.Now(),
+		Webhooks:   make([]Webhook, 0, len(subs)),
+		APIKeys:    make([]APIKey, 0, len(keys)),
+		Thresholds: Thresholds{ChannelNotify: s.threshold()},
+	}
+	for _, sub := range subs {
+		b.Webhooks = append(b.Webhooks, Webhook{
+			URL:           sub.URL,
+			Events:        sub.Events,
+			Format:        sub.Format,
+			SchemaVersion: sub.SchemaVersion,
+			Template:      sub.Template,
+			ContentType:   sub.ContentType,
+		})
+	}
+	for _, k := range keys {
+		if !inTenant(k, tenant.FromContext(ctx)) {
+			continue
+		}
+		b.APIKeys = append(b.APIKeys, APIKey{
+			ID:           k.ID,
+			Name:         k.Name,
+			RequestQuota: k.RequestQuota,
+			SaleQuota:    k.SaleQuota,
+			Revoked:      k.RevokedAt != nil,
+		})
+	}
+	return b, nil
+}
+
+// Import applies b to the tenant in ctx. Webhooks are matched by URL:
+// missing ones are subscribed, with new secrets, and existing ones updated.
+// The stored API keys with the IDs of b get its names and quotas, and are
+// revoked if it says so; keys are neither created nor un-revoked, and those
+// of other tenants are skipped as missing. The thresholds are shared by
+// every tenant. Nothing outside b is deleted, so importing the same bundle
+// again changes nothing.
+// b is checked before anything is changed; returns ErrInvalidBundle.
+func (s *Service) Import(ctx context.Context, b *Bundle) (*Result, error) {
+	if b.Version != Version {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidBundle, b.Version)
+	}
+	for _, w := range b.Webhooks {
+		if err := s.webhooks.Validate(ctx, subscription(w)); err != nil {
+			return nil, fmt.Errorf("%w: webhook %s: %w", ErrInvalidBundle, w.URL, err)
+		}
+	}
+	if b.Thresholds.ChannelNotify < 0 {
+		return nil, fmt.Errorf("%w: thresholds must not be negative", ErrInvalidBundle)
+	}
+
+	result := &Result{Webhooks: []ImportedWebhook{}, UpdatedKeys: []string{}, SkippedKeys: []string{}}
+	for _, w := range b.Webhooks {
+		sub, secret, err := s.webhooks.Upsert(ctx, subscription(w))
+		if err != nil {
+			return result, err
+		}
+		result.Webhooks = append(result.Webhooks, ImportedWebhook{ID: sub.ID, URL: sub.URL, Created: secret != "", Secret: secret})
+	}
+
+	now := s.clock.Now()
+	for _, k := range b.APIKeys {
+		key, err := s.keys.Get(ctx, k.ID)
+		if err == nil && !inTenant(key, tenant.FromContext(ctx)) {
+			err = apikey.ErrNotFound
+		}
+		if errors.Is(err, apikey.ErrNotFound) {
+			result.SkippedKeys = append(result.SkippedKeys, k.ID)
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		key.Name, key.RequestQuota, key.SaleQuota = k.Name, k.RequestQuota, k.SaleQuota
+		if err := s.keys.Save(ctx, key); err != nil {
+			return result, err
+		}
+		if k.Revoked {
+			if err := s.keys.Revoke(ctx, k.ID, now); err != nil {
+				return result, err
+			}
+		}
+		result.UpdatedKeys = append(result.UpdatedKeys, k.ID)
+	}
+
+	s.setThreshold(b.Thresholds.ChannelNotify)
+
+	s.logger.Info("configuration bundle imported", zap.Int("webhooks", len(result.Webhooks)),
+		zap.Int("updated_keys", len(result.UpdatedKeys)), zap.Int("skipped_keys", len(result.SkippedKeys)))
+	return result, nil
+}
+
+// inTenant reports whether k acts in tenant id when its requests name none:
+// the keys bound to id and, for tenant.Default, the unbound keys other than
+// admins, which act in any tenant and so belong to none.
+func inTenant(k *apikey.Key, id string) bool {
+	if k.Tenant == "" {
+		return !k.Admin && id == tenant.Default
+	}
+	return k.Tenant == id
+}
+
+// subscription returns the webhook subscription w describes.
+func subscription(w Webhook) webhook.Subscription {
+	return webhook.Subscription{
+		URL:           w.URL,
+		Events:        w.Events,
+		Format:        w.Format,
+		SchemaVersion: w.SchemaVersion,
+		Template:      w.Template,
+		ContentType:   w.ContentType,
+	}
+}
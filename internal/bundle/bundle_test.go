@@ -0,0 +1,154 @@
+package bundle
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/apikey"
+	"Ejercicio_Final-Taller_Go/internal/money"
+	"Ejercicio_Final-Taller_Go/internal/sales"
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+	"Ejercicio_Final-Taller_Go/internal/webhook"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// environment is the configuration of one deployment of the API.
+type environment struct {
+	webhooks  *webhook.Dispatcher
+	keys      *apikey.LocalStore
+	threshold money.Cents
+	bundles   *Service
+}
+
+func newEnvironment(t *testing.T) *environment {
+	env := &environment{webhooks: webhook.New(webhook.NewLocalStore(), 10, zap.NewNop(), webhook.WithPrivateTargets()), keys: apikey.NewLocalStore()}
+	t.Cleanup(env.webhooks.Close)
+	env.bundles = New(env.webhooks, env.keys, func() money.Cents { return env.threshold },
+		func(c money.Cents) { env.threshold = c }, zap.NewNop())
+	return env
+}
+
+func TestService_ExportImport(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	staging := newEnvironment(t)
+	staging.threshold = 100000
+	_, _, err := staging.webhooks.Subscribe(ctx, webhook.Subscription{URL: "https://hooks.example.com/sales",
+		Events: []sales.EventType{sales.EventCreated}})
+	require.NoError(t, err)
+	_, _, err = staging.webhooks.Subscribe(ctx, webhook.Subscription{URL: "https://erp.example.com/in", Format: webhook.FormatDiff})
+	require.NoError(t, err)
+	require.NoError(t, staging.keys.Save(ctx, &apikey.Key{ID: "shop", Name: "Shop", Hash: "staging", SaleQuota: 50, CreatedAt: now}))
+	require.NoError(t, staging.keys.Save(ctx, &apikey.Key{ID: "old", Name: "Old", Hash: "staging", CreatedAt: now}))
+	require.NoError(t, staging.keys.Revoke(ctx, "old", now))
+	require.NoError(t, staging.keys.Save(ctx, &apikey.Key{ID: "staging-only", Name: "Tests", CreatedAt: now}))
+
+	b, err := staging.bundles.Export(ctx)
+	require.NoError(t, err)
+	require.Equal(t, Version, b.Version)
+	require.Len(t, b.Webhooks, 2)
+	require.Len(t, b.APIKeys, 3)
+	// el paquete no lleva secretos
+	data, err := json.Marshal(b)
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "staging\"")
+	require.NotContains(t, string(data), "secret")
+
+	production := newEnvironment(t)
+	existing, _, err := production.webhooks.Subscribe(ctx, webhook.Subscription{URL: "https://hooks.example.com/sales"})
+	require.NoError(t, err)
+	require.NoError(t, production.keys.Save(ctx, &apikey.Key{ID: "shop", Name: "shop", Hash: "production", CreatedAt: now}))
+	require.NoError(t, production.keys.Save(ctx, &apikey.Key{ID: "old", Name: "old", Hash: "production", CreatedAt: now}))
+
+	result, err := production.bundles.Import(ctx, b)
+	require.NoError(t, err)
+	require.Len(t, result.Webhooks, 2)
+	require.Equal(t, existing.ID, result.Webhooks[0].ID)
+	require.False(t, result.Webhooks[0].Created)
+	require.Empty(t, result.Webhooks[0].Secret)
+	require.True(t, result.Webhooks[1].Created)
+	require.NotEmpty(t, result.Webhooks[1].Secret)
+	require.ElementsMatch(t, []string{"shop", "old"}, result.UpdatedKeys)
+	require.Equal(t, []string{"staging-only"}, result.SkippedKeys)
+	require.Equal(t, money.Cents(100000), production.threshold)
+
+	sub, err := production.webhooks.Get(ctx, existing.ID)
+	require.NoError(t, err)
+	require.Equal(t, []sales.EventType{sales.EventCreated}, sub.Events)
+	require.Equal(t, existing.Secret, sub.Secret)
+	shop, err := production.keys.Get(ctx, "shop")
+	require.NoError(t, err)
+	require.Equal(t, "Shop", shop.Name)
+	require.Equal(t, int64(50), shop.SaleQuota)
+	require.Equal(t, "production", shop.Hash)
+	old, err := production.keys.Get(ctx, "old")
+	require.NoError(t, err)
+	require.NotNil(t, old.RevokedAt)
+
+	// importarlo otra vez no crea nada nuevo
+	result, err = production.bundles.Import(ctx, b)
+	require.NoError(t, err)
+	require.False(t, result.Webhooks[1].Created)
+	subs, err := production.webhooks.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, subs, 2)
+}
+
+func TestService_Import_Invalid(t *testing.T) {
+	ctx := context.Background()
+	env := newEnvironment(t)
+
+	_, err := env.bundles.Import(ctx, &Bundle{Version: 2})
+	require.ErrorIs(t, err, ErrInvalidBundle)
+
+	// nada se aplica si un webhook es inválido
+	_, err = env.bundles.Import(ctx, &Bundle{Version: Version, Webhooks: []Webhook{
+		{URL: "https://hooks.example.com/sales"},
+		{URL: "ftp://hooks.example.com"},
+	}})
+	require.ErrorIs(t, err, ErrInvalidBundle)
+	subs, err := env.webhooks.List(ctx)
+	require.NoError(t, err)
+	require.Empty(t, subs)
+}
+
+func TestService_ExportImport_Tenants(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	acme := tenant.WithID(context.Background(), "acme")
+	env := newEnvironment(t)
+	require.NoError(t, env.keys.Save(acme, &apikey.Key{ID: "acme-shop", Name: "Shop", Tenant: "acme", CreatedAt: now}))
+	require.NoError(t, env.keys.Save(acme, &apikey.Key{ID: "globex-shop", Name: "Shop", Tenant: "globex", CreatedAt: now}))
+	require.NoError(t, env.keys.Save(acme, &apikey.Key{ID: "default-shop", Name: "Shop", CreatedAt: now}))
+	require.NoError(t, env.keys.Save(acme, &apikey.Key{ID: "internal", Name: "Internal", Admin: true, CreatedAt: now}))
+
+	// solo se exportan las keys del tenant
+	b, err := env.bundles.Export(acme)
+	require.NoError(t, err)
+	require.Len(t, b.APIKeys, 1)
+	require.Equal(t, "acme-shop", b.APIKeys[0].ID)
+	b, err = env.bundles.Export(context.Background())
+	require.NoError(t, err)
+	require.Len(t, b.APIKeys, 1)
+	require.Equal(t, "default-shop", b.APIKeys[0].ID)
+
+	// e importar en acme no toca las de los demás
+	result, err := env.bundles.Import(acme, &Bundle{Version: Version, APIKeys: []APIKey{
+		{ID: "acme-shop", Name: "Renamed", Revoked: true},
+		{ID: "globex-shop", Name: "Renamed", Revoked: true},
+		{ID: "internal", Name: "Renamed", Revoked: true},
+	}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"acme-shop"}, result.UpdatedKeys)
+	require.Equal(t, []string{"globex-shop", "internal"}, result.SkippedKeys)
+	for _, id := range []string{"globex-shop", "internal"} {
+		key, err := env.keys.Get(acme, id)
+		require.NoError(t, err)
+		require.NotEqual(t, "Renamed", key.Name)
+		require.Nil(t, key.RevokedAt)
+	}
+}
@@ -0,0 +1,151 @@
+// Package cache keeps short-lived copies of values that are costly to read,
+// in process or in Redis to share them between instances.
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/clock"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Cache maps keys to values that expire after a TTL. A value may be
+// evicted at any time, so callers must be able to read it again.
+type Cache interface {
+	// Get returns the value of key, or false if it is missing or expired.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores value under key for ttl.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// SetNX stores value under key for ttl unless key already holds a value
+	// that did not expire, and reports whether it did, in one atomic step.
+	SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+	// Delete removes key; deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Local keeps values in memory, up to a maximum number of keys. It is safe
+// for concurrent use.
+type Local struct {
+	clock clock.Clock
+	max   int
+
+	mu    sync.Mutex
+	items map[string]localItem
+}
+
+type localItem struct {
+	value   []byte
+	expires time.Time
+}
+
+// NewLocal returns an empty Local cache of up to max keys.
+func NewLocal(clk clock.Clock, max int) *Local {
+	return &Local{clock: clk, max: max, items: map[string]localItem{}}
+}
+
+// Get returns a copy of the value of key.
+func (l *Local) Get(_ context.Context, key string) ([]byte, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	item, ok := l.items[key]
+	if !ok || !l.clock.Now().Before(item.expires) {
+		return nil, false, nil
+	}
+	return append([]byte(nil), item.value...), true, nil
+}
+
+// Set stores a copy of value. When the cache is full, expired keys are
+// dropped first and every key if there are none.
+func (l *Local) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.set(key, value, ttl)
+	return nil
+}
+
+// SetNX stores a copy of value if key is missing or expired.
+func (l *Local) SetNX(_ context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if item, ok := l.items[key]; ok && l.clock.Now().Before(item.expires) {
+		return false, nil
+	}
+	l.set(key, value, ttl)
+	return true, nil
+}
+
+// set stores a copy of value, making room when the cache is full.
+// Callers must hold l.mu.
+func (l *Local) set(key string, value []byte, ttl time.Duration) {
+	now := l.clock.Now()
+	if _, ok := l.items[key]; !ok && len(l.items) >= l.max {
+		for k, item := range l.items {
+			if !now.Before(item.expires) {
+				delete(l.items, k)
+			}
+		}
+		if len(l.items) >= l.max {
+			clear(l.items)
+		}
+	}
+	l.items[key] = localItem{value: append([]byte(nil), value...), expires: now.Add(ttl)}
+}
+
+// Delete removes key.
+func (l *Local) Delete(_ context.Context, key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.items, key)
+	return nil
+}
+
+// Redis keeps values as Redis keys, with the TTL as key expiry.
+type Redis struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedis returns a Cache on client, namespacing its keys with prefix.
+func NewRedis(client *redis.Client, prefix string) *Redis {
+	return &Redis{client: client, prefix: prefix}
+}
+
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := r.client.Get(ctx, r.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("error reading cached %s: %w", key, err)
+	}
+	return value, true, nil
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := r.client.Set(ctx, r.prefix+key, value, ttl).Err(); err != nil {
+		return fmt.Errorf("error caching %s: %w", key, err)
+	}
+	return nil
+}
+
+func (r *Redis) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	stored, err := r.client.SetNX(ctx, r.prefix+key, value, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("error caching %s: %w", key, err)
+	}
+	return stored, nil
+}
+
+func (r *Redis) Delete(ctx context.Context, key string) error {
+	if err := r.client.Del(ctx, r.prefix+key).Err(); err != nil {
+		return fmt.Errorf("error deleting cached %s: %w", key, err)
+	}
+	return nil
+}
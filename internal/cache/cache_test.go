@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/clock"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCaches(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c := clock.NewManual(time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC))
+
+	for name, tc := range map[string]struct {
+		cache   Cache
+		advance func(time.Duration)
+	}{
+		"local": {NewLocal(c, 10), c.Advance},
+		"redis": {NewRedis(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "sales-api:"), mr.FastForward},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			_, ok, err := tc.cache.Get(ctx, "a")
+			require.NoError(t, err)
+			require.False(t, ok)
+
+			require.NoError(t, tc.cache.Set(ctx, "a", []byte("1"), 10*time.Second))
+			v, ok, err := tc.cache.Get(ctx, "a")
+			require.NoError(t, err)
+			require.True(t, ok)
+			require.Equal(t, []byte("1"), v)
+
+			tc.advance(10 * time.Second)
+			_, ok, err = tc.cache.Get(ctx, "a")
+			require.NoError(t, err)
+			require.False(t, ok)
+
+			// SetNX no pisa un valor vigente, sí uno vencido
+			stored, err := tc.cache.SetNX(ctx, "c", []byte("1"), 10*time.Second)
+			require.NoError(t, err)
+			require.True(t, stored)
+			stored, err = tc.cache.SetNX(ctx, "c", []byte("2"), 10*time.Second)
+			require.NoError(t, err)
+			require.False(t, stored)
+			v, _, err = tc.cache.Get(ctx, "c")
+			require.NoError(t, err)
+			require.Equal(t, []byte("1"), v)
+			tc.advance(10 * time.Second)
+			stored, err = tc.cache.SetNX(ctx, "c", []byte("3"), 10*time.Second)
+			require.NoError(t, err)
+			require.True(t, stored)
+
+			require.NoError(t, tc.cache.Set(ctx, "b", []byte("2"), time.Minute))
+			require.NoError(t, tc.cache.Delete(ctx, "b"))
+			require.NoError(t, tc.cache.Delete(ctx, "b"))
+			_, ok, err = tc.cache.Get(ctx, "b")
+			require.NoError(t, err)
+			require.False(t, ok)
+		})
+	}
+}
+
+func TestLocal_Full(t *testing.T) {
+	ctx := context.Background()
+	c := clock.NewManual(time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC))
+	l := NewLocal(c, 2)
+
+	require.NoError(t, l.Set(ctx, "old", []byte("1"), time.Second))
+	require.NoError(t, l.Set(ctx, "a", []byte("2"), time.Minute))
+	c.Advance(time.Second)
+
+	// al llenarse primero se descartan las vencidas
+	require.NoError(t, l.Set(ctx, "b", []byte("3"), time.Minute))
+	_, ok, _ := l.Get(ctx, "a")
+	require.True(t, ok)
+
+	require.NoError(t, l.Set(ctx, "c", []byte("4"), time.Minute))
+	require.Len(t, l.items, 1)
+	_, ok, _ = l.Get(ctx, "c")
+	require.True(t, ok)
+}
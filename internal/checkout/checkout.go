@@ -0,0 +1,152 @@
+// Package checkout sells in one call: it creates a sale, reserves its
+// payment and confirms both, as a saga so that a failure halfway does not
+// leave a sale approved without payment or funds held for a dead sale.
+package checkout
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"Ejercicio_Final-Taller_Go/internal/apperrors"
+	"Ejercicio_Final-Taller_Go/internal/money"
+	"Ejercicio_Final-Taller_Go/internal/payment"
+	"Ejercicio_Final-Taller_Go/internal/saga"
+	"Ejercicio_Final-Taller_Go/internal/sales"
+)
+
+// ErrSaleRejected is returned when the sale is rejected on creation, so
+// there is nothing to pay for.
+var ErrSaleRejected = apperrors.New(apperrors.Unprocessable, "sale_rejected", "the sale was rejected")
+
+// sagaName is the name the checkout saga is registered under.
+const sagaName = "checkout"
+
+// Keys of the saga data.
+const (
+	keyUserID        = "user_id"
+	keyAmount        = "amount_cents"
+	keySaleID        = "sale_id"
+	keyReservationID = "reservation_id"
+)
+
+// Service runs checkouts.
+type Service struct {
+	sagas    *saga.Coordinator
+	sales    *sales.Service
+	payments payment.Provider
+}
+
+// New creates a Service and registers the checkout saga in sagas.
+func New(sagas *saga.Coordinator, salesService *sales.Service, payments payment.Provider) *Service {
+	s := &Service{sagas: sagas, sales: salesService, payments: payments}
+	sagas.Register(saga.Definition{
+		Name: sagaName,
+		Steps: []saga.Step{
+			{Name: "create_sale", Action: s.createSale, Compensate: s.rejectSale},
+			{Name: "reserve_payment", Action: s.reservePayment, Compensate: s.releasePayment},
+			{Name: "confirm", Action: s.confirm},
+		},
+	})
+	return s
+}
+
+// Checkout creates a sale of amount for userID, reserves its payment and
+// then captures the payment and approves the sale. It returns the sale
+// together with the saga that ran it; the saga is returned on failure too,
+// with the steps that were compensated.
+func (s *Service) Checkout(ctx context.Context, userID string, amount money.Cents) (*sales.Sale, *saga.State, error) {
+	// se valida antes de arrancar la saga para no tener que compensar
+	if err := sales.ValidateAmount(amount); err != nil {
+		return nil, nil, err
+	}
+
+	state, err := s.sagas.Run(ctx, sagaName, saga.Data{
+		keyUserID: userID,
+		keyAmount: strconv.FormatInt(int64(amount), 10),
+	})
+	if err != nil {
+		return nil, state, err
+	}
+
+	sale, err := s.sales.GetSale(ctx, state.Data[keySaleID])
+	if err != nil {
+		return nil, state, err
+	}
+	return sale, state, nil
+}
+
+func (s *Service) createSale(ctx context.Context, data saga.Data) error {
+	amount, err := strconv.ParseInt(data[keyAmount], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	sale, err := s.sales.CreateSale(ctx, data[keyUserID], money.Cents(amount))
+	if err != nil {
+		return err
+	}
+	data[keySaleID] = sale.ID
+	if sale.Status == sales.StatusRejected {
+		return ErrSaleRejected
+	}
+	return nil
+}
+
+// rejectSale rejects the sale unless it already was. A sale approved on
+// creation cannot be rejected, which leaves the saga stuck for review.
+func (s *Service) rejectSale(ctx context.Context, data saga.Data) error {
+	id, ok := data[keySaleID]
+	if !ok {
+		return nil
+	}
+
+	sale, err := s.sales.GetSale(ctx, id)
+	if err != nil {
+		return err
+	}
+	if sale.Status == sales.StatusRejected {
+		return nil
+	}
+	_, err = s.sales.RejectSale(ctx, id, sales.Review{Actor: sagaName, RejectionReason: sales.ReasonPaymentFailed})
+	return err
+}
+
+func (s *Service) reservePayment(ctx context.Context, data saga.Data) error {
+	amount, err := strconv.ParseInt(data[keyAmount], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	id, err := s.payments.Reserve(ctx, data[keySaleID], money.Cents(amount))
+	if err != nil {
+		return err
+	}
+	data[keyReservationID] = id
+	return nil
+}
+
+func (s *Service) releasePayment(ctx context.Context, data saga.Data) error {
+	id, ok := data[keyReservationID]
+	if !ok {
+		return nil
+	}
+	return s.payments.Release(ctx, id)
+}
+
+// confirm captures the payment and approves the sale, unless it was
+// approved on creation.
+func (s *Service) confirm(ctx context.Context, data saga.Data) error {
+	if err := s.payments.Capture(ctx, data[keyReservationID]); err != nil {
+		return err
+	}
+
+	_, err := s.sales.UpdateSaleStatus(ctx, data[keySaleID], sales.StatusApproved)
+	if errors.Is(err, sales.ErrInvalidTransition) {
+		sale, getErr := s.sales.GetSale(ctx, data[keySaleID])
+		if getErr == nil && sale.Status == sales.StatusApproved {
+			return nil
+		}
+	}
+	return err
+}
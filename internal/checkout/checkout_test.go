@@ -0,0 +1,73 @@
+package checkout
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+
+	"Ejercicio_Final-Taller_Go/internal/idgen"
+	"Ejercicio_Final-Taller_Go/internal/money"
+	"Ejercicio_Final-Taller_Go/internal/payment"
+	"Ejercicio_Final-Taller_Go/internal/saga"
+	"Ejercicio_Final-Taller_Go/internal/sales"
+	"Ejercicio_Final-Taller_Go/internal/sales/salestest"
+	"Ejercicio_Final-Taller_Go/internal/user/usertest"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// failingCapture is a payment provider whose captures always fail.
+type failingCapture struct {
+	*payment.Local
+}
+
+func (f failingCapture) Capture(ctx context.Context, reservationID string) error {
+	return errors.New("card declined")
+}
+
+func TestCheckout_CompensatesFailedConfirm(t *testing.T) {
+	u := usertest.NewUserBuilder().Build()
+	userAPI := usertest.NewServer(t, u)
+	salesService := sales.NewService(salestest.NewStorage(t), zap.NewNop(), userAPI.URL)
+	payments := failingCapture{payment.NewLocal(idgen.UUID())}
+	s := New(saga.New(saga.NewLocalStore(), zap.NewNop()), salesService, payments)
+
+	// se reintenta hasta que la venta no quede rechazada al crearse
+	var state *saga.State
+	var err error
+	for range 20 {
+		if _, state, err = s.Checkout(context.Background(), u.ID, 1000); !errors.Is(err, ErrSaleRejected) {
+			break
+		}
+	}
+	require.EqualError(t, err, "card declined")
+	require.Equal(t, saga.StatusFailed, state.Steps[2].Status)
+	require.Equal(t, saga.StatusCompensated, state.Steps[1].Status)
+
+	reservation, err := payments.Get(context.Background(), state.Data[keyReservationID])
+	require.NoError(t, err)
+	require.True(t, reservation.Released)
+
+	sale, err := salesService.GetSale(context.Background(), state.Data[keySaleID])
+	require.NoError(t, err)
+	if sale.Status == sales.StatusApproved {
+		// aprobada al crearse: no se puede rechazar y la saga queda para revisión
+		require.Equal(t, saga.StatusStuck, state.Status)
+	} else {
+		require.Equal(t, sales.StatusRejected, sale.Status)
+		require.Equal(t, saga.StatusCompensated, state.Status)
+	}
+}
+
+func TestCheckout_UnknownUser(t *testing.T) {
+	userAPI := usertest.NewServer(t)
+	salesService := sales.NewService(salestest.NewStorage(t), zap.NewNop(), userAPI.URL, sales.WithRand(rand.New(rand.NewSource(1))))
+	s := New(saga.New(saga.NewLocalStore(), zap.NewNop()), salesService, payment.NewLocal(idgen.UUID()))
+
+	_, state, err := s.Checkout(context.Background(), "nobody", money.Cents(1000))
+	require.ErrorIs(t, err, sales.ErrUserNotFound)
+	require.Equal(t, saga.StatusCompensated, state.Status)
+	require.Equal(t, 1, userAPI.Requests())
+}
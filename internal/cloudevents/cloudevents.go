@@ -0,0 +1,43 @@
+// Package cloudevents builds CloudEvents 1.0 envelopes of sale events, in
+// the JSON structured mode, for the systems the events are sent to.
+package cloudevents
+
+import (
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/sales"
+)
+
+// SpecVersion is the version of the CloudEvents specification followed.
+const SpecVersion = "1.0"
+
+// ContentType is the media type of CloudEvents in the JSON structured mode.
+const ContentType = "application/cloudevents+json"
+
+// Event is a CloudEvents event in the JSON structured mode.
+type Event struct {
+	SpecVersion     string    `json:"specversion"`
+	ID              string    `json:"id"`
+	Source          string    `json:"source"`
+	Type            string    `json:"type"`
+	Subject         string    `json:"subject"`
+	Time            time.Time `json:"time"`
+	DataContentType string    `json:"datacontenttype"`
+	DataSchema      string    `json:"dataschema,omitempty"`
+	Data            any       `json:"data"`
+}
+
+// FromSale returns the event id of type t on sale, of the tenant tenantID,
+// carrying data as JSON. The sale is the subject and its update the time.
+func FromSale(id, tenantID string, t sales.EventType, sale sales.Sale, data any) Event {
+	return Event{
+		SpecVersion:     SpecVersion,
+		ID:              id,
+		Source:          "/tenants/" + tenantID + "/sales",
+		Type:            string(t),
+		Subject:         sale.ID,
+		Time:            sale.UpdatedAt,
+		DataContentType: "application/json",
+		Data:            data,
+	}
+}
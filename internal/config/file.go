@@ -0,0 +1,67 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// fileEnv remembers the variables set from the config file, so a reload can
+// replace or remove them without touching the real environment.
+var fileEnv = struct {
+	sync.Mutex
+	keys map[string]bool
+}{keys: map[string]bool{}}
+
+// loadFile reads the KEY=VALUE lines of the file at path into the
+// environment. Blank lines and lines starting with # are skipped, and values
+// may be quoted. Variables already in the environment take precedence over
+// the file; those set by a previous load and no longer in the file are unset.
+func loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening config file: %w", err)
+	}
+	defer f.Close()
+
+	values := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if key = strings.TrimSpace(key); !ok || key == "" {
+			return fmt.Errorf("config file %s: malformed line %d", path, n)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading config file: %w", err)
+	}
+
+	fileEnv.Lock()
+	defer fileEnv.Unlock()
+
+	for key := range fileEnv.keys {
+		if _, ok := values[key]; !ok {
+			os.Unsetenv(key)
+			delete(fileEnv.keys, key)
+		}
+	}
+	for key, value := range values {
+		if _, set := os.LookupEnv(key); set && !fileEnv.keys[key] {
+			continue
+		}
+		os.Setenv(key, value)
+		fileEnv.keys[key] = true
+	}
+	return nil
+}
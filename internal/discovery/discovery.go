@@ -0,0 +1,240 @@
+// Package discovery resolves the instances of a downstream service, such as
+// the user API, and spreads calls across the healthy ones.
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrNoEndpoints is returned when no instance of the service is known.
+var ErrNoEndpoints = errors.New("no endpoints available")
+
+// Endpoints picks the base URL of the instance to call next.
+// Callers report instances that failed so they are skipped for a while.
+type Endpoints interface {
+	Pick() (string, error)
+	MarkFailed(endpoint string)
+}
+
+// Resolver lists the base URLs of the instances of a service.
+type Resolver interface {
+	Resolve(ctx context.Context) ([]string, error)
+}
+
+// static always returns the same base URL.
+type static string
+
+// Static returns Endpoints for a single, fixed base URL.
+func Static(baseURL string) Endpoints {
+	return static(baseURL)
+}
+
+func (s static) Pick() (string, error) {
+	return string(s), nil
+}
+
+func (s static) MarkFailed(string) {}
+
+// srvResolver resolves instances through DNS SRV records.
+type srvResolver struct {
+	name   string
+	scheme string
+}
+
+// SRV returns a Resolver that looks up the SRV records of name, for example
+// "_users._tcp.example.com", and builds base URLs with scheme.
+func SRV(name, scheme string) Resolver {
+	return &srvResolver{name: name, scheme: scheme}
+}
+
+func (r *srvResolver) Resolve(ctx context.Context) ([]string, error) {
+	_, records, err := net.DefaultResolver.LookupSRV(ctx, "", "", r.name)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up SRV records of %s: %w", r.name, err)
+	}
+
+	endpoints := make([]string, 0, len(records))
+	for _, rec := range records {
+		host := strings.TrimSuffix(rec.Target, ".")
+		endpoints = append(endpoints, r.scheme+"://"+net.JoinHostPort(host, strconv.Itoa(int(rec.Port))))
+	}
+	return endpoints, nil
+}
+
+// consulResolver resolves instances through the Consul health API.
+type consulResolver struct {
+	addr    string
+	service string
+	scheme  string
+	http    *http.Client
+}
+
+// Consul returns a Resolver that asks the Consul agent at addr for the
+// instances of service passing their health checks. A nil httpClient uses
+// http.DefaultClient.
+func Consul(addr, service, scheme string, httpClient *http.Client) Resolver {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &consulResolver{addr: strings.TrimSuffix(addr, "/"), service: service, scheme: scheme, http: httpClient}
+}
+
+// consulEntry is the subset of a /v1/health/service entry we need.
+type consulEntry struct {
+	Node struct {
+		Address string
+	}
+	Service struct {
+		Address string
+		Port    int
+	}
+}
+
+func (r *consulResolver) Resolve(ctx context.Context) ([]string, error) {
+	u := fmt.Sprintf("%s/v1/health/service/%s?passing=true", r.addr, url.PathEscape(r.service))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error building request to Consul: %w", err)
+	}
+
+	resp, err := r.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error making request to Consul: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("consul returned unexpected status: %d", resp.StatusCode)
+	}
+
+	var entries []consulEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("error decoding Consul response: %w", err)
+	}
+
+	endpoints := make([]string, 0, len(entries))
+	for _, e := range entries {
+		host := e.Service.Address
+		if host == "" {
+			host = e.Node.Address
+		}
+		endpoints = append(endpoints, r.scheme+"://"+net.JoinHostPort(host, strconv.Itoa(e.Service.Port)))
+	}
+	return endpoints, nil
+}
+
+// failureCooldown is how long an instance that failed is skipped.
+const failureCooldown = 30 * time.Second
+
+// Balancer round-robins calls across the instances found by a Resolver,
+// skipping the ones that recently failed. It is safe for concurrent use.
+type Balancer struct {
+	resolver Resolver
+	logger   *zap.Logger
+
+	mu        sync.Mutex
+	endpoints []string
+	failed    map[string]time.Time // endpoint -> when it failed
+	next      int
+}
+
+// NewBalancer creates a Balancer with no known instances; call Refresh or
+// Run to populate it.
+func NewBalancer(resolver Resolver, logger *zap.Logger) *Balancer {
+	return &Balancer{
+		resolver: resolver,
+		logger:   logger,
+		failed:   map[string]time.Time{},
+	}
+}
+
+// Refresh resolves the instances again. On error the previous ones are kept.
+func (b *Balancer) Refresh(ctx context.Context) error {
+	endpoints, err := b.resolver.Resolve(ctx)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.endpoints = endpoints
+	for e := range b.failed {
+		if !contains(endpoints, e) {
+			delete(b.failed, e)
+		}
+	}
+	return nil
+}
+
+// Run refreshes the instances every interval until ctx is done.
+func (b *Balancer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := b.Refresh(ctx); err != nil {
+				b.logger.Warn("error refreshing endpoints", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Pick returns the next healthy instance. When every instance failed
+// recently it still returns one rather than refusing to call at all.
+// Returns ErrNoEndpoints if none is known.
+func (b *Balancer) Pick() (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.endpoints) == 0 {
+		return "", ErrNoEndpoints
+	}
+
+	now := time.Now()
+	for range b.endpoints {
+		e := b.endpoints[b.next%len(b.endpoints)]
+		b.next++
+		if failedAt, ok := b.failed[e]; !ok || now.Sub(failedAt) > failureCooldown {
+			delete(b.failed, e)
+			return e, nil
+		}
+	}
+
+	e := b.endpoints[b.next%len(b.endpoints)]
+	b.next++
+	return e, nil
+}
+
+// MarkFailed skips endpoint for a while after a failed call.
+func (b *Balancer) MarkFailed(endpoint string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failed[endpoint] = time.Now()
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package discovery
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type fixedResolver []string
+
+func (f fixedResolver) Resolve(context.Context) ([]string, error) {
+	return f, nil
+}
+
+func TestBalancer(t *testing.T) {
+	b := NewBalancer(fixedResolver{"http://a", "http://b"}, zap.NewNop())
+
+	_, err := b.Pick()
+	require.ErrorIs(t, err, ErrNoEndpoints)
+
+	require.NoError(t, b.Refresh(context.Background()))
+
+	first, _ := b.Pick()
+	second, _ := b.Pick()
+	require.ElementsMatch(t, []string{"http://a", "http://b"}, []string{first, second})
+
+	b.MarkFailed("http://a")
+	for i := 0; i < 3; i++ {
+		e, err := b.Pick()
+		require.NoError(t, err)
+		require.Equal(t, "http://b", e)
+	}
+
+	// with every instance down one is still returned
+	b.MarkFailed("http://b")
+	_, err = b.Pick()
+	require.NoError(t, err)
+}
+
+func TestConsulResolver(t *testing.T) {
+	consul := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/health/service/user-api", r.URL.Path)
+		require.Equal(t, "true", r.URL.Query().Get("passing"))
+		w.Write([]byte(`[
+			{"Node": {"Address": "10.0.0.1"}, "Service": {"Address": "", "Port": 8080}},
+			{"Node": {"Address": "10.0.0.2"}, "Service": {"Address": "10.0.1.2", "Port": 9090}}
+		]`))
+	}))
+	defer consul.Close()
+
+	endpoints, err := Consul(consul.URL, "user-api", "http", nil).Resolve(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"http://10.0.0.1:8080", "http://10.0.1.2:9090"}, endpoints)
+}
@@ -0,0 +1,221 @@
+// Package envelope encrypts values at rest with envelope encryption: every
+// record gets its own random data key, which is itself encrypted ("wrapped")
+// by a master key held in a KMS.
+package envelope
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"Ejercicio_Final-Taller_Go/internal/awsauth"
+)
+
+// prefix marks encrypted values, with the version of their format.
+const prefix = "enc:v1:"
+
+// ErrMalformed is returned when decrypting a value that was not produced by Encrypt.
+var ErrMalformed = errors.New("malformed encrypted value")
+
+// KeyWrapper encrypts and decrypts data keys with a master key.
+type KeyWrapper interface {
+	Wrap(ctx context.Context, dataKey []byte) ([]byte, error)
+	Unwrap(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+// localKey wraps data keys with a master key held in memory.
+type localKey struct {
+	aead cipher.AEAD
+}
+
+// LocalKey returns a KeyWrapper using master, a 32-byte AES key, directly.
+// It is meant for development and for deployments without a KMS.
+func LocalKey(master []byte) (KeyWrapper, error) {
+	aead, err := newAEAD(master)
+	if err != nil {
+		return nil, fmt.Errorf("invalid master key: %w", err)
+	}
+	return &localKey{aead: aead}, nil
+}
+
+func (k *localKey) Wrap(_ context.Context, dataKey []byte) ([]byte, error) {
+	return seal(k.aead, dataKey)
+}
+
+func (k *localKey) Unwrap(_ context.Context, wrapped []byte) ([]byte, error) {
+	return open(k.aead, wrapped)
+}
+
+// awsKMS wraps data keys with a key held in AWS KMS.
+type awsKMS struct {
+	region string
+	keyID  string
+	creds  awsauth.Credentials
+	http   *http.Client
+}
+
+// AWSKMS returns a KeyWrapper that encrypts data keys with the KMS key keyID
+// in region. A nil httpClient uses http.DefaultClient.
+func AWSKMS(region, keyID string, creds awsauth.Credentials, httpClient *http.Client) KeyWrapper {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &awsKMS{region: region, keyID: keyID, creds: creds, http: httpClient}
+}
+
+func (k *awsKMS) Wrap(ctx context.Context, dataKey []byte) ([]byte, error) {
+	var out struct {
+		CiphertextBlob []byte
+	}
+	in := map[string]any{"KeyId": k.keyID, "Plaintext": dataKey}
+	if err := awsauth.CallJSON(ctx, k.http, k.creds, k.region, "kms", "TrentService.Encrypt", in, &out); err != nil {
+		return nil, err
+	}
+	return out.CiphertextBlob, nil
+}
+
+func (k *awsKMS) Unwrap(ctx context.Context, wrapped []byte) ([]byte, error) {
+	var out struct {
+		Plaintext []byte
+	}
+	in := map[string]any{"KeyId": k.keyID, "CiphertextBlob": wrapped}
+	if err := awsauth.CallJSON(ctx, k.http, k.creds, k.region, "kms", "TrentService.Decrypt", in, &out); err != nil {
+		return nil, err
+	}
+	return out.Plaintext, nil
+}
+
+// maxCachedKeys bounds the cache of unwrapped data keys.
+const maxCachedKeys = 10000
+
+// Cipher issues data keys wrapped by a KeyWrapper and encrypts values with
+// them. Unwrapped keys are cached, so reading a record does not call the
+// KMS every time. It is safe for concurrent use.
+type Cipher struct {
+	kek KeyWrapper
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte][]byte // hash of the wrapped key -> data key
+}
+
+// New creates a Cipher whose data keys are wrapped by kek.
+func New(kek KeyWrapper) *Cipher {
+	return &Cipher{kek: kek, cache: map[[sha256.Size]byte][]byte{}}
+}
+
+// NewDataKey returns a random data key together with its wrapped form, to
+// be stored next to the values it encrypts.
+func (c *Cipher) NewDataKey(ctx context.Context) (dataKey, wrapped []byte, err error) {
+	dataKey = make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, fmt.Errorf("error generating data key: %w", err)
+	}
+	if wrapped, err = c.kek.Wrap(ctx, dataKey); err != nil {
+		return nil, nil, fmt.Errorf("error wrapping data key: %w", err)
+	}
+	c.remember(wrapped, dataKey)
+	return dataKey, wrapped, nil
+}
+
+// DataKey unwraps a key returned by NewDataKey.
+func (c *Cipher) DataKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	sum := sha256.Sum256(wrapped)
+	c.mu.Lock()
+	dataKey, ok := c.cache[sum]
+	c.mu.Unlock()
+	if ok {
+		return dataKey, nil
+	}
+
+	dataKey, err := c.kek.Unwrap(ctx, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("error unwrapping data key: %w", err)
+	}
+	c.remember(wrapped, dataKey)
+	return dataKey, nil
+}
+
+func (c *Cipher) remember(wrapped, dataKey []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.cache) >= maxCachedKeys {
+		clear(c.cache)
+	}
+	c.cache[sha256.Sum256(wrapped)] = dataKey
+}
+
+// Encrypt encrypts value with dataKey. Empty values are kept empty.
+func Encrypt(dataKey []byte, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(aead, []byte(value))
+	if err != nil {
+		return "", err
+	}
+	return prefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt reverses Encrypt. Values without the encryption prefix, written
+// before encryption was enabled, are returned unchanged.
+func Decrypt(dataKey []byte, value string) (string, error) {
+	if !strings.HasPrefix(value, prefix) {
+		return value, nil
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(value, prefix))
+	if err != nil {
+		return "", ErrMalformed
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plain, err := open(aead, sealed)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plain, prefixing the result with a random nonce.
+func seal(aead cipher.AEAD, plain []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("error generating nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plain, nil), nil
+}
+
+// open reverses seal.
+func open(aead cipher.AEAD, sealed []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	return plain, nil
+}
@@ -0,0 +1,39 @@
+package envelope
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCipher_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	kek, err := LocalKey(bytes.Repeat([]byte{7}, 32))
+	require.NoError(t, err)
+	c := New(kek)
+
+	dataKey, wrapped, err := c.NewDataKey(ctx)
+	require.NoError(t, err)
+
+	enc, err := Encrypt(dataKey, "Ayrton Senna")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(enc, "enc:v1:"))
+	require.NotContains(t, enc, "Ayrton")
+
+	// a fresh cipher has to unwrap the key through the KMS
+	unwrapped, err := New(kek).DataKey(ctx, wrapped)
+	require.NoError(t, err)
+	dec, err := Decrypt(unwrapped, enc)
+	require.NoError(t, err)
+	require.Equal(t, "Ayrton Senna", dec)
+
+	plain, err := Decrypt(unwrapped, "written before encryption")
+	require.NoError(t, err)
+	require.Equal(t, "written before encryption", plain)
+
+	_, err = Decrypt(bytes.Repeat([]byte{1}, 32), enc)
+	require.ErrorIs(t, err, ErrMalformed)
+}
@@ -0,0 +1,76 @@
+package errreport
+
+import (
+	"errors"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// taggedFields are the string log fields promoted to tags on reported errors.
+var taggedFields = map[string]bool{
+	"request_id": true,
+	"sale_id":    true,
+	"user_id":    true,
+}
+
+// WrapLogger returns a copy of logger that also sends every Error (or higher)
+// entry to the reporter, so service-level error paths are reported without
+// having to know about the reporter.
+func WrapLogger(logger *zap.Logger, reporter Reporter) *zap.Logger {
+	return logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(core, &reportingCore{
+			LevelEnabler: zapcore.ErrorLevel,
+			reporter:     reporter,
+		})
+	}))
+}
+
+// reportingCore is a zapcore.Core that turns log entries into reported errors.
+type reportingCore struct {
+	zapcore.LevelEnabler
+	reporter Reporter
+	fields   []zapcore.Field
+}
+
+func (c *reportingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &reportingCore{
+		LevelEnabler: c.LevelEnabler,
+		reporter:     c.reporter,
+		fields:       append(c.fields[:len(c.fields):len(c.fields)], fields...),
+	}
+}
+
+func (c *reportingCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *reportingCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	var err error
+	tags := map[string]string{"log_message": entry.Message}
+
+	for _, f := range append(c.fields[:len(c.fields):len(c.fields)], fields...) {
+		switch {
+		case f.Type == zapcore.ErrorType:
+			if e, ok := f.Interface.(error); ok {
+				err = e
+			}
+		case f.Type == zapcore.StringType && taggedFields[f.Key]:
+			tags[f.Key] = f.String
+		}
+	}
+
+	if err == nil {
+		err = errors.New(entry.Message)
+	}
+
+	c.reporter.CaptureError(err, tags)
+	return nil
+}
+
+func (c *reportingCore) Sync() error {
+	return nil
+}
@@ -0,0 +1,66 @@
+package errreport
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// captured is an error reported to a recordingReporter.
+type captured struct {
+	err  error
+	tags map[string]string
+}
+
+// recordingReporter keeps the errors reported to it.
+type recordingReporter struct {
+	errors []captured
+}
+
+func (r *recordingReporter) CaptureError(err error, tags map[string]string) {
+	r.errors = append(r.errors, captured{err: err, tags: tags})
+}
+
+func (r *recordingReporter) CapturePanic(any, map[string]string) {}
+
+func (r *recordingReporter) Flush(time.Duration) bool { return true }
+
+func TestWrapLogger(t *testing.T) {
+	reporter := &recordingReporter{}
+	logger := WrapLogger(zap.NewNop(), reporter).With(zap.String("request_id", "r1"))
+
+	logger.Info("sale created", zap.String("sale_id", "s1"))
+	logger.Warn("slow storage", zap.String("sale_id", "s1"))
+	require.Empty(t, reporter.errors)
+
+	failure := errors.New("storage unavailable")
+	logger.Error("failed to create sale", zap.String("sale_id", "s1"), zap.Int("user_id", 7),
+		zap.String("status", "pending"), zap.Error(failure))
+	// sin un error en los campos se reporta el mensaje
+	logger.Error("queue full")
+
+	require.Len(t, reporter.errors, 2)
+	require.Equal(t, failure, reporter.errors[0].err)
+	// solo los campos de texto conocidos pasan a ser etiquetas
+	require.Equal(t, map[string]string{"log_message": "failed to create sale", "request_id": "r1", "sale_id": "s1"}, reporter.errors[0].tags)
+	require.EqualError(t, reporter.errors[1].err, "queue full")
+	require.Equal(t, map[string]string{"log_message": "queue full", "request_id": "r1"}, reporter.errors[1].tags)
+}
+
+func TestWrapLogger_With(t *testing.T) {
+	reporter := &recordingReporter{}
+	base := WrapLogger(zap.NewNop(), reporter)
+
+	// los campos de un logger derivado no se filtran a sus hermanos
+	a := base.With(zap.String("sale_id", "a"))
+	b := base.With(zap.String("sale_id", "b"))
+	a.With(zap.String("user_id", "u")).Error("a failed")
+	b.Error("b failed")
+
+	require.Len(t, reporter.errors, 2)
+	require.Equal(t, map[string]string{"log_message": "a failed", "sale_id": "a", "user_id": "u"}, reporter.errors[0].tags)
+	require.Equal(t, map[string]string{"log_message": "b failed", "sale_id": "b"}, reporter.errors[1].tags)
+}
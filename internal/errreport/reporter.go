@@ -0,0 +1,75 @@
+package errreport
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// Reporter sends errors and recovered panics to an external error tracker.
+type Reporter interface {
+	// CaptureError reports err tagged with the given key/value pairs.
+	CaptureError(err error, tags map[string]string)
+
+	// CapturePanic reports a value recovered from a panic.
+	CapturePanic(value any, tags map[string]string)
+
+	// Flush waits until buffered events are sent or the timeout expires.
+	Flush(timeout time.Duration) bool
+}
+
+// New returns a Reporter backed by Sentry when dsn is set, or a no-op Reporter
+// otherwise. Reports are tagged with release, the version of the running build.
+func New(dsn, environment, release string) (Reporter, error) {
+	if dsn == "" {
+		return Nop(), nil
+	}
+
+	client, err := sentry.NewClient(sentry.ClientOptions{
+		Dsn:         dsn,
+		Environment: environment,
+		Release:     release,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error initializing sentry client: %w", err)
+	}
+
+	return &sentryReporter{hub: sentry.NewHub(client, sentry.NewScope())}, nil
+}
+
+// Nop returns a Reporter that discards everything.
+func Nop() Reporter {
+	return nopReporter{}
+}
+
+type nopReporter struct{}
+
+func (nopReporter) CaptureError(error, map[string]string) {}
+
+func (nopReporter) CapturePanic(any, map[string]string) {}
+
+func (nopReporter) Flush(time.Duration) bool { return true }
+
+// sentryReporter forwards events to Sentry through a dedicated hub.
+type sentryReporter struct {
+	hub *sentry.Hub
+}
+
+func (r *sentryReporter) CaptureError(err error, tags map[string]string) {
+	r.hub.WithScope(func(scope *sentry.Scope) {
+		scope.SetTags(tags)
+		r.hub.CaptureException(err)
+	})
+}
+
+func (r *sentryReporter) CapturePanic(value any, tags map[string]string) {
+	r.hub.WithScope(func(scope *sentry.Scope) {
+		scope.SetTags(tags)
+		r.hub.Recover(value)
+	})
+}
+
+func (r *sentryReporter) Flush(timeout time.Duration) bool {
+	return r.hub.Flush(timeout)
+}
@@ -0,0 +1,63 @@
+package errreport
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingTransport keeps the events a Sentry client sends.
+type recordingTransport struct {
+	mu     sync.Mutex
+	events []*sentry.Event
+}
+
+func (t *recordingTransport) Configure(sentry.ClientOptions) {}
+
+func (t *recordingTransport) SendEvent(event *sentry.Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events = append(t.events, event)
+}
+
+func (t *recordingTransport) Flush(time.Duration) bool { return true }
+
+func (t *recordingTransport) Close() {}
+
+func TestNew(t *testing.T) {
+	r, err := New("", "test", "v1")
+	require.NoError(t, err)
+	require.Equal(t, Nop(), r)
+	require.True(t, r.Flush(time.Second))
+
+	_, err = New("not a dsn", "test", "v1")
+	require.ErrorContains(t, err, "error initializing sentry client")
+
+	r, err = New("https://key@sentry.example.com/1", "test", "v1")
+	require.NoError(t, err)
+	require.IsType(t, &sentryReporter{}, r)
+}
+
+func TestSentryReporter(t *testing.T) {
+	transport := &recordingTransport{}
+	client, err := sentry.NewClient(sentry.ClientOptions{Dsn: "https://key@sentry.example.com/1", Release: "v1", Transport: transport})
+	require.NoError(t, err)
+	r := &sentryReporter{hub: sentry.NewHub(client, sentry.NewScope())}
+
+	r.CaptureError(errors.New("storage unavailable"), map[string]string{"sale_id": "s1"})
+	r.CapturePanic("boom", map[string]string{"request_id": "r1"})
+	// las etiquetas de un reporte no quedan en los siguientes
+	r.CaptureError(errors.New("queue full"), nil)
+
+	require.Len(t, transport.events, 3)
+	require.Equal(t, "storage unavailable", transport.events[0].Exception[0].Value)
+	require.Equal(t, map[string]string{"sale_id": "s1"}, transport.events[0].Tags)
+	require.Equal(t, "v1", transport.events[0].Release)
+	require.Equal(t, "boom", transport.events[1].Message)
+	require.Equal(t, map[string]string{"request_id": "r1"}, transport.events[1].Tags)
+	require.Empty(t, transport.events[2].Tags)
+}
@@ -0,0 +1,405 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/cloudevents"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.uber.org/zap"
+)
+
+// amqpTimeout bounds each publication to the broker, confirmation included.
+const amqpTimeout = 10 * time.Second
+
+// deliveriesHeader counts, in the messages moved to the retry or the
+// dead-letter queue, the times they were handed to a handler.
+const deliveriesHeader = "x-deliveries"
+
+// errNacked is returned by Publish when the broker refuses the message.
+var errNacked = errors.New("message nacked by the broker")
+
+// amqpConn is a connection to the broker with a channel open on it, as the
+// publisher and the consumer use it. It cannot be used any more after a
+// call of it fails: it has to be closed and dialed again.
+type amqpConn interface {
+	DeclareExchange(ctx context.Context, name, kind string) error
+	DeclareQueue(ctx context.Context, name string, args amqp.Table) error
+	BindQueue(ctx context.Context, queue, exchange, key string) error
+	Confirm(ctx context.Context) error
+	Publish(ctx context.Context, exchange, key string, p amqp.Publishing) error
+	Consume(ctx context.Context, queue, consumerTag string, prefetch int) error
+	Next(ctx context.Context) (amqp.Delivery, error)
+	Ack(ctx context.Context, tag uint64) error
+	Close() error
+}
+
+// rabbitConn is an amqpConn over the RabbitMQ client. Cancelling the
+// context of a call closes the connection, since the client's calls do not
+// take one.
+type rabbitConn struct {
+	conn       *amqp.Connection
+	ch         *amqp.Channel
+	deliveries <-chan amqp.Delivery
+}
+
+// dialAMQP connects to the broker at url, giving up on the handshake at the
+// deadline of ctx or after amqpTimeout.
+func dialAMQP(ctx context.Context, url string) (amqpConn, error) {
+	conn, err := amqp.DialConfig(url, amqp.Config{
+		Heartbeat: 10 * time.Second,
+		Dial: func(network, addr string) (net.Conn, error) {
+			var d net.Dialer
+			conn, err := d.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			// el cliente quita el plazo una vez abierta la conexión
+			deadline, ok := ctx.Deadline()
+			if !ok {
+				deadline = time.Now().Add(amqpTimeout)
+			}
+			if err := conn.SetDeadline(deadline); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return conn, nil
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to the AMQP broker: %w", err)
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error opening an AMQP channel: %w", err)
+	}
+	return &rabbitConn{conn: conn, ch: ch}, nil
+}
+
+// start closes the connection if ctx is done before the returned func is called.
+func (r *rabbitConn) start(ctx context.Context) (stop func()) {
+	after := context.AfterFunc(ctx, func() { r.conn.Close() })
+	return func() { after() }
+}
+
+func (r *rabbitConn) DeclareExchange(ctx context.Context, name, kind string) error {
+	defer r.start(ctx)()
+	if err := r.ch.ExchangeDeclare(name, kind, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("error declaring exchange %s: %w", name, err)
+	}
+	return nil
+}
+
+func (r *rabbitConn) DeclareQueue(ctx context.Context, name string, args amqp.Table) error {
+	defer r.start(ctx)()
+	if _, err := r.ch.QueueDeclare(name, true, false, false, false, args); err != nil {
+		return fmt.Errorf("error declaring queue %s: %w", name, err)
+	}
+	return nil
+}
+
+func (r *rabbitConn) BindQueue(ctx context.Context, queue, exchange, key string) error {
+	defer r.start(ctx)()
+	if err := r.ch.QueueBind(queue, key, exchange, false, nil); err != nil {
+		return fmt.Errorf("error binding queue %s: %w", queue, err)
+	}
+	return nil
+}
+
+func (r *rabbitConn) Confirm(ctx context.Context) error {
+	defer r.start(ctx)()
+	if err := r.ch.Confirm(false); err != nil {
+		return fmt.Errorf("error enabling publisher confirms: %w", err)
+	}
+	return nil
+}
+
+// Publish publishes p and, in confirm mode, waits for the broker to
+// confirm it; returns errNacked if the broker refuses it.
+func (r *rabbitConn) Publish(ctx context.Context, exchange, key string, p amqp.Publishing) error {
+	defer r.start(ctx)()
+	confirm, err := r.ch.PublishWithDeferredConfirmWithContext(ctx, exchange, key, false, false, p)
+	if err != nil {
+		return err
+	}
+	if confirm == nil {
+		return nil
+	}
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !acked {
+		return errNacked
+	}
+	return nil
+}
+
+func (r *rabbitConn) Consume(ctx context.Context, queue, consumerTag string, prefetch int) error {
+	defer r.start(ctx)()
+	if err := r.ch.Qos(prefetch, 0, false); err != nil {
+		return fmt.Errorf("error setting the prefetch of %s: %w", queue, err)
+	}
+	deliveries, err := r.ch.Consume(queue, consumerTag, false, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("error consuming %s: %w", queue, err)
+	}
+	r.deliveries = deliveries
+	return nil
+}
+
+// Next waits for the next delivery of the queue being consumed. The client
+// closes the deliveries when the channel or the connection is closed.
+func (r *rabbitConn) Next(ctx context.Context) (amqp.Delivery, error) {
+	select {
+	case d, ok := <-r.deliveries:
+		if !ok {
+			return amqp.Delivery{}, amqp.ErrClosed
+		}
+		return d, nil
+	case <-ctx.Done():
+		return amqp.Delivery{}, ctx.Err()
+	}
+}
+
+func (r *rabbitConn) Ack(ctx context.Context, tag uint64) error {
+	return r.ch.Ack(tag, false)
+}
+
+func (r *rabbitConn) Close() error {
+	return r.conn.Close()
+}
+
+// AMQP publishes each topic to a topic exchange of RabbitMQ, with the topic
+// as routing key, as persistent messages the broker confirms. The
+// connection is opened with the first message, and again after a failure.
+type AMQP struct {
+	url      string
+	exchange string
+	dial     func(ctx context.Context, url string) (amqpConn, error)
+
+	mu   sync.Mutex
+	conn amqpConn
+}
+
+// NewAMQP returns a Publisher to exchange, on the broker at url.
+func NewAMQP(url, exchange string) *AMQP {
+	return &AMQP{url: url, exchange: exchange, dial: dialAMQP}
+}
+
+func (a *AMQP) Publish(ctx context.Context, topic string, body []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ctx, cancel := context.WithTimeout(ctx, amqpTimeout)
+	defer cancel()
+
+	if a.conn == nil {
+		conn, err := a.dial(ctx, a.url)
+		if err != nil {
+			return fmt.Errorf("error publishing to %s: %w", topic, err)
+		}
+		if err := declareExchange(ctx, conn, a.exchange); err != nil {
+			conn.Close()
+			return fmt.Errorf("error publishing to %s: %w", topic, err)
+		}
+		a.conn = conn
+	}
+
+	err := a.conn.Publish(ctx, a.exchange, topic, amqp.Publishing{ContentType: cloudevents.ContentType, DeliveryMode: amqp.Persistent, Body: body})
+	if err != nil {
+		// la conexión queda inservible tras un error; la próxima publicación abre otra
+		a.conn.Close()
+		a.conn = nil
+		return fmt.Errorf("error publishing to %s: %w", topic, err)
+	}
+	return nil
+}
+
+// declareExchange declares the topic exchange and turns on the publisher confirms.
+func declareExchange(ctx context.Context, conn amqpConn, exchange string) error {
+	if err := conn.DeclareExchange(ctx, exchange, "topic"); err != nil {
+		return err
+	}
+	return conn.Confirm(ctx)
+}
+
+// AMQPConsumer reads a topic published by AMQP from a durable queue bound
+// to it, shared by the instances so each message is handled by one of them.
+// A handled message is acknowledged. A failed one is moved to a retry
+// queue, named after the queue with ".retry" appended, whose entries the
+// broker moves back once they expire; after a number of deliveries it is
+// moved instead, like poison ones, to a dead-letter queue named after the
+// queue with ".dead" appended. The deliveries are counted in the
+// x-deliveries header of the moved messages.
+type AMQPConsumer struct {
+	consumerOptions
+	url      string
+	exchange string
+	topic    string
+	queue    string
+	handler  Handler
+	logger   *zap.Logger
+	dial     func(ctx context.Context, url string) (amqpConn, error)
+}
+
+// NewAMQPConsumer returns a consumer of topic, published to exchange on the
+// broker at url, reading from queue.
+func NewAMQPConsumer(url, exchange, topic, queue string, handler Handler, logger *zap.Logger, opts ...ConsumerOption) *AMQPConsumer {
+	return &AMQPConsumer{
+		consumerOptions: newConsumerOptions(opts),
+		url:             url,
+		exchange:        exchange,
+		topic:           topic,
+		queue:           queue,
+		handler:         handler,
+		logger:          logger,
+		dial:            dialAMQP,
+	}
+}
+
+// Run consumes messages until ctx is done.
+func (c *AMQPConsumer) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		if err := c.consume(ctx); err != nil && ctx.Err() == nil {
+			c.logger.Error("failed to consume messages", zap.String("queue", c.queue), zap.Error(err))
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+		}
+	}
+}
+
+// consume connects to the broker, declares the queues and handles their
+// messages, one at a time, until the connection fails.
+func (c *AMQPConsumer) consume(ctx context.Context) error {
+	conn, err := c.dial(ctx, c.url)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := c.declare(ctx, conn); err != nil {
+		return err
+	}
+	// de a un mensaje: el siguiente no llega hasta que el anterior se confirma
+	if err := conn.Consume(ctx, c.queue, "", 1); err != nil {
+		return err
+	}
+	for {
+		d, err := conn.Next(ctx)
+		if err != nil {
+			return err
+		}
+		if err := c.handle(ctx, conn, d); err != nil {
+			return err
+		}
+	}
+}
+
+// declare declares the exchange, the queue bound to the topic and its retry
+// and dead-letter queues. The retry queue dead-letters its expired messages
+// back to the queue through the default exchange.
+func (c *AMQPConsumer) declare(ctx context.Context, conn amqpConn) error {
+	if err := declareExchange(ctx, conn, c.exchange); err != nil {
+		return err
+	}
+	if err := conn.DeclareQueue(ctx, c.queue, nil); err != nil {
+		return err
+	}
+	if err := conn.BindQueue(ctx, c.queue, c.exchange, c.topic); err != nil {
+		return err
+	}
+	retry := amqp.Table{"x-dead-letter-exchange": "", "x-dead-letter-routing-key": c.queue}
+	if err := conn.DeclareQueue(ctx, c.queue+".retry", retry); err != nil {
+		return err
+	}
+	return conn.DeclareQueue(ctx, c.queue+".dead", nil)
+}
+
+// handle hands d to the handler, moving it to the retry or the dead-letter
+// queue if it fails, and acknowledges it. An error means d could not be
+// moved or acknowledged, and is left for the broker to deliver again.
+func (c *AMQPConsumer) handle(ctx context.Context, conn amqpConn, d amqp.Delivery) error {
+	deliveries := deliveriesOf(d)
+	id := d.MessageId
+	if id == "" {
+		id = strconv.FormatUint(d.DeliveryTag, 10)
+	}
+	err := c.handler(ctx, Message{ID: id, Body: d.Body, Deliveries: deliveries})
+	if err != nil {
+		moved := publishingOf(d)
+		moved.Headers[deliveriesHeader] = deliveries
+
+		if !errors.Is(err, ErrPoison) && deliveries < c.maxDeliveries {
+			moved.Expiration = strconv.FormatInt(c.retryAfter.Milliseconds(), 10)
+			if retryErr := conn.Publish(ctx, "", c.queue+".retry", moved); retryErr != nil {
+				return fmt.Errorf("error scheduling the retry of message %s: %w", id, retryErr)
+			}
+			c.logger.Warn("failed to handle message, retrying", zap.String("queue", c.queue), zap.String("message_id", id),
+				zap.Int64("deliveries", deliveries), zap.Duration("retry_in", c.retryAfter), zap.Error(err))
+		} else {
+			moved.Expiration = ""
+			moved.Headers["x-error"] = err.Error()
+			if dlqErr := conn.Publish(ctx, "", c.queue+".dead", moved); dlqErr != nil {
+				c.logger.Error("failed to dead-letter message", zap.String("queue", c.queue), zap.String("message_id", id),
+					zap.Error(err), zap.NamedError("dlq_error", dlqErr))
+				return dlqErr
+			}
+			c.logger.Error("message moved to dead-letter queue", zap.String("queue", c.queue), zap.String("message_id", id),
+				zap.Int64("deliveries", deliveries), zap.Error(err))
+		}
+	}
+
+	if err := conn.Ack(ctx, d.DeliveryTag); err != nil {
+		return fmt.Errorf("error acknowledging message %s: %w", id, err)
+	}
+	return nil
+}
+
+// publishingOf returns d as a message to publish again, with a copy of its headers.
+func publishingOf(d amqp.Delivery) amqp.Publishing {
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	return amqp.Publishing{
+		Headers:         headers,
+		ContentType:     d.ContentType,
+		ContentEncoding: d.ContentEncoding,
+		DeliveryMode:    d.DeliveryMode,
+		Priority:        d.Priority,
+		CorrelationId:   d.CorrelationId,
+		ReplyTo:         d.ReplyTo,
+		Expiration:      d.Expiration,
+		MessageId:       d.MessageId,
+		Timestamp:       d.Timestamp,
+		Type:            d.Type,
+		UserId:          d.UserId,
+		AppId:           d.AppId,
+		Body:            d.Body,
+	}
+}
+
+// deliveriesOf returns the times d has been handed to a handler, counting
+// this one and, for a message redelivered by the broker, the one whose
+// connection was lost.
+func deliveriesOf(d amqp.Delivery) int64 {
+	var previous int64
+	switch v := d.Headers[deliveriesHeader].(type) {
+	case int64:
+		previous = v
+	case int32:
+		previous = int64(v)
+	}
+	if d.Redelivered {
+		previous++
+	}
+	return previous + 1
+}
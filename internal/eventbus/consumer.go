@@ -0,0 +1,220 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// ErrPoison marks a message that no retry can handle, e.g. a malformed one.
+// A Handler returning it has the message dead-lettered right away.
+var ErrPoison = errors.New("poison message")
+
+// Message is a message read from a topic.
+type Message struct {
+	ID   string
+	Body []byte
+	// Deliveries counts the times the message was handed to a handler, from 1.
+	Deliveries int64
+}
+
+// Handler handles a message read from a topic. A message whose handler
+// fails is redelivered later, unless the error is ErrPoison.
+type Handler func(ctx context.Context, msg Message) error
+
+// StreamConsumer reads a topic published by RedisStreams as a member of a
+// consumer group, so each message is handled by one of the instances. A
+// handled message is acknowledged, which moves the group past it. A failed
+// one is redelivered after a delay, up to a number of deliveries, and then
+// moved, like poison ones, to a dead-letter stream named after the topic's
+// with ":dead" appended.
+type StreamConsumer struct {
+	consumerOptions
+	client   *redis.Client
+	stream   string
+	group    string
+	consumer string
+	handler  Handler
+	logger   *zap.Logger
+}
+
+// consumerOptions are the settings shared by the consumers.
+type consumerOptions struct {
+	maxDeliveries int64
+	retryAfter    time.Duration
+	block         time.Duration
+}
+
+func newConsumerOptions(opts []ConsumerOption) consumerOptions {
+	o := consumerOptions{maxDeliveries: 5, retryAfter: 30 * time.Second, block: 5 * time.Second}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// ConsumerOption configures optional behaviour of a StreamConsumer or an AMQPConsumer.
+type ConsumerOption func(*consumerOptions)
+
+// WithRedelivery sets how many times a message is handed to the handler
+// before it is dead-lettered, and how long after a failure it is handed
+// again. Defaults to 5 deliveries 30 seconds apart.
+func WithRedelivery(maxDeliveries int, retryAfter time.Duration) ConsumerOption {
+	return func(o *consumerOptions) {
+		o.maxDeliveries, o.retryAfter = int64(maxDeliveries), retryAfter
+	}
+}
+
+// WithBlock sets how long each read of a StreamConsumer waits for new
+// messages. Defaults to 5 seconds.
+func WithBlock(block time.Duration) ConsumerOption {
+	return func(o *consumerOptions) {
+		o.block = block
+	}
+}
+
+// NewStreamConsumer returns a consumer of topic on client, whose streams
+// are namespaced with prefix, reading as consumer of group.
+func NewStreamConsumer(client *redis.Client, prefix, topic, group, consumer string, handler Handler, logger *zap.Logger, opts ...ConsumerOption) *StreamConsumer {
+	return &StreamConsumer{
+		consumerOptions: newConsumerOptions(opts),
+		client:          client,
+		stream:          prefix + topic,
+		group:           group,
+		consumer:        consumer,
+		handler:         handler,
+		logger:          logger,
+	}
+}
+
+// Run consumes messages until ctx is done.
+func (c *StreamConsumer) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		err := c.createGroup(ctx)
+		if err == nil {
+			err = c.poll(ctx)
+		}
+		if err != nil && ctx.Err() == nil {
+			c.logger.Error("failed to consume messages", zap.String("stream", c.stream), zap.Error(err))
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+		}
+	}
+}
+
+// createGroup creates the consumer group, starting at the beginning of the
+// stream, unless it exists.
+func (c *StreamConsumer) createGroup(ctx context.Context) error {
+	err := c.client.XGroupCreateMkStream(ctx, c.stream, c.group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("error creating consumer group %s: %w", c.group, err)
+	}
+	return nil
+}
+
+// poll hands the messages due for a retry to the handler, and then waits
+// for new ones.
+func (c *StreamConsumer) poll(ctx context.Context) error {
+	if err := c.retry(ctx); err != nil {
+		return err
+	}
+
+	streams, err := c.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    c.group,
+		Consumer: c.consumer,
+		Streams:  []string{c.stream, ">"},
+		Count:    10,
+		Block:    c.block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", c.stream, err)
+	}
+	for _, s := range streams {
+		for _, m := range s.Messages {
+			c.handle(ctx, m, 1)
+		}
+	}
+	return nil
+}
+
+// retry claims the messages whose handling failed at least retryAfter ago,
+// here or in an instance that died, and hands them to the handler again.
+func (c *StreamConsumer) retry(ctx context.Context) error {
+	pending, err := c.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: c.stream,
+		Group:  c.group,
+		Idle:   c.retryAfter,
+		Start:  "-",
+		End:    "+",
+		Count:  10,
+	}).Result()
+	if err != nil {
+		return fmt.Errorf("error listing pending messages of %s: %w", c.stream, err)
+	}
+
+	for _, p := range pending {
+		claimed, err := c.client.XClaim(ctx, &redis.XClaimArgs{
+			Stream:   c.stream,
+			Group:    c.group,
+			Consumer: c.consumer,
+			MinIdle:  c.retryAfter,
+			Messages: []string{p.ID},
+		}).Result()
+		if err != nil {
+			return fmt.Errorf("error claiming message %s of %s: %w", p.ID, c.stream, err)
+		}
+		for _, m := range claimed {
+			c.handle(ctx, m, p.RetryCount+1)
+		}
+	}
+	return nil
+}
+
+// handle hands m, delivered for the given time, to the handler, and
+// acknowledges it unless it has to be retried.
+func (c *StreamConsumer) handle(ctx context.Context, m redis.XMessage, deliveries int64) {
+	body, _ := m.Values["data"].(string)
+	err := c.handler(ctx, Message{ID: m.ID, Body: []byte(body), Deliveries: deliveries})
+	if err != nil {
+		if !errors.Is(err, ErrPoison) && deliveries < c.maxDeliveries {
+			c.logger.Warn("failed to handle message, retrying", zap.String("stream", c.stream), zap.String("message_id", m.ID),
+				zap.Int64("deliveries", deliveries), zap.Duration("retry_in", c.retryAfter), zap.Error(err))
+			return
+		}
+		if dlqErr := c.deadLetter(ctx, m, deliveries, err); dlqErr != nil {
+			c.logger.Error("failed to dead-letter message", zap.String("stream", c.stream), zap.String("message_id", m.ID),
+				zap.Error(err), zap.NamedError("dlq_error", dlqErr))
+			return
+		}
+		c.logger.Error("message moved to dead-letter stream", zap.String("stream", c.stream), zap.String("message_id", m.ID),
+			zap.Int64("deliveries", deliveries), zap.Error(err))
+	}
+
+	if err := c.client.XAck(ctx, c.stream, c.group, m.ID).Err(); err != nil {
+		c.logger.Error("failed to acknowledge message", zap.String("stream", c.stream), zap.String("message_id", m.ID), zap.Error(err))
+	}
+}
+
+// deadLetter copies m to the dead-letter stream, with why it was dropped.
+func (c *StreamConsumer) deadLetter(ctx context.Context, m redis.XMessage, deliveries int64, cause error) error {
+	values := map[string]any{"message_id": m.ID, "deliveries": deliveries, "error": cause.Error()}
+	for k, v := range m.Values {
+		values[k] = v
+	}
+	return c.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: c.stream + ":dead",
+		MaxLen: maxStreamLength,
+		Approx: true,
+		Values: values,
+	}).Err()
+}
@@ -0,0 +1,174 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/cache"
+	"Ejercicio_Final-Taller_Go/internal/clock"
+	"Ejercicio_Final-Taller_Go/internal/sales"
+	"Ejercicio_Final-Taller_Go/internal/sales/salestest"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestStreamConsumer(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	publisher := NewRedisStreams(client, "test:")
+	for _, body := range []string{"ok", "flaky", "poison", "broken"} {
+		require.NoError(t, publisher.Publish(ctx, "payments", []byte(body)))
+	}
+
+	var mu sync.Mutex
+	handled := map[string]int{}
+	handler := func(_ context.Context, msg Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		body := string(msg.Body)
+		handled[body]++
+		require.EqualValues(t, handled[body], msg.Deliveries)
+		switch {
+		case body == "flaky" && msg.Deliveries == 1, body == "broken":
+			return errors.New("unavailable")
+		case body == "poison":
+			return ErrPoison
+		}
+		return nil
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	c := NewStreamConsumer(client, "test:", "payments", "sales-api", "test", handler, zap.NewNop(),
+		WithRedelivery(3, 10*time.Millisecond), WithBlock(10*time.Millisecond))
+	go c.Run(runCtx)
+
+	require.Eventually(t, func() bool {
+		dead, err := client.XLen(ctx, "test:payments:dead").Result()
+		pending, _ := client.XPending(ctx, "test:payments", "sales-api").Result()
+		return err == nil && dead == 2 && pending != nil && pending.Count == 0
+	}, 2*time.Second, 10*time.Millisecond)
+	cancel()
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, map[string]int{"ok": 1, "flaky": 2, "poison": 1, "broken": 3}, handled)
+	dead, err := client.XRange(ctx, "test:payments:dead", "-", "+").Result()
+	require.NoError(t, err)
+	require.Equal(t, "poison", dead[0].Values["data"])
+	require.Equal(t, "broken", dead[1].Values["data"])
+	require.Equal(t, "3", dead[1].Values["deliveries"])
+	require.Equal(t, "unavailable", dead[1].Values["error"])
+}
+
+func TestPaymentResults(t *testing.T) {
+	ctx := context.Background()
+	pending := salestest.NewSaleBuilder().Build()
+	other := salestest.NewSaleBuilder().Build()
+	salesService := sales.NewService(salestest.NewStorage(t, pending, other), zap.NewNop(), "http://localhost")
+	handle := PaymentResults(salesService, zap.NewNop())
+	message := func(body string) Message { return Message{ID: "1-0", Body: []byte(body), Deliveries: 1} }
+
+	approve := message(`{"id":"p1","sale_id":"` + pending.ID + `","status":"approved"}`)
+	require.NoError(t, handle(ctx, approve))
+	sale, err := salesService.GetSale(ctx, pending.ID)
+	require.NoError(t, err)
+	require.Equal(t, sales.StatusApproved, sale.Status)
+	require.Equal(t, "payments", sale.StatusChangedBy)
+
+	// una redelivery no falla, y un resultado contradictorio es poison
+	require.NoError(t, handle(ctx, approve))
+	require.ErrorIs(t, handle(ctx, message(`{"id":"p2","sale_id":"`+pending.ID+`","status":"rejected"}`)), ErrPoison)
+
+	require.NoError(t, handle(ctx, message(`{"id":"p3","tenant":"default","sale_id":"`+other.ID+`","status":"rejected"}`)))
+	sale, err = salesService.GetSale(ctx, other.ID)
+	require.NoError(t, err)
+	require.Equal(t, sales.StatusRejected, sale.Status)
+
+	for _, body := range []string{
+		`not json`,
+		`{"id":"p4","sale_id":"` + other.ID + `","status":"pending"}`,
+		`{"id":"p5","status":"approved"}`,
+		`{"id":"p6","sale_id":"nope","status":"approved"}`,
+		`{"id":"p7","tenant":"a b","sale_id":"` + other.ID + `","status":"approved"}`,
+	} {
+		require.ErrorIs(t, handle(ctx, message(body)), ErrPoison, body)
+	}
+}
+
+func TestDeduplicated(t *testing.T) {
+	ctx := context.Background()
+	now := clock.NewManual(time.Date(2024, 3, 10, 15, 0, 0, 0, time.UTC))
+	calls := map[string]int{}
+	fail := true
+	handle := Deduplicated(cache.NewLocal(now, 100), time.Hour, zap.NewNop(), func(_ context.Context, msg Message) error {
+		calls[string(msg.Body)]++
+		if string(msg.Body) == `{"id":"flaky"}` && fail {
+			fail = false
+			return errors.New("unavailable")
+		}
+		return nil
+	})
+
+	for _, body := range []string{`{"id":"a"}`, `{"id":"a"}`, `{"id":"flaky"}`, `{"id":"flaky"}`, `{"id":"flaky"}`, `{}`, `{}`} {
+		_ = handle(ctx, Message{ID: "1-0", Body: []byte(body)})
+	}
+	// un evento que falló no cuenta como procesado
+	require.Equal(t, map[string]int{`{"id":"a"}`: 1, `{"id":"flaky"}`: 2, `{}`: 2}, calls)
+
+	now.Advance(time.Hour)
+	require.NoError(t, handle(ctx, Message{ID: "2-0", Body: []byte(`{"id":"a"}`)}))
+	require.Equal(t, 2, calls[`{"id":"a"}`])
+}
+
+func TestDeduplicated_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	now := clock.NewManual(time.Date(2024, 3, 10, 15, 0, 0, 0, time.UTC))
+	entered, release := make(chan struct{}), make(chan struct{})
+	var calls atomic.Int32
+	handle := Deduplicated(cache.NewLocal(now, 100), time.Hour, zap.NewNop(), func(_ context.Context, msg Message) error {
+		calls.Add(1)
+		close(entered)
+		<-release
+		return nil
+	})
+
+	// la misma entrega llega a otro consumidor mientras el primero la maneja
+	done := make(chan error)
+	go func() { done <- handle(ctx, Message{ID: "1-0", Body: []byte(`{"id":"a"}`)}) }()
+	<-entered
+	require.NoError(t, handle(ctx, Message{ID: "1-1", Body: []byte(`{"id":"a"}`)}))
+	close(release)
+	require.NoError(t, <-done)
+	require.Equal(t, int32(1), calls.Load())
+}
+
+func TestUserDeletions(t *testing.T) {
+	ctx := context.Background()
+	sale := salestest.NewSaleBuilder().WithUserID("ana").Build()
+	salesService := sales.NewService(salestest.NewStorage(t, sale), zap.NewNop(), "http://localhost")
+	handle := UserDeletions(salesService, zap.NewNop())
+	message := func(body string) Message { return Message{ID: "1-0", Body: []byte(body), Deliveries: 1} }
+
+	require.NoError(t, handle(ctx, message(`{"id":"u1","type":"user.updated","user_id":"ana"}`)))
+	got, err := salesService.GetSale(ctx, sale.ID)
+	require.NoError(t, err)
+	require.Equal(t, "ana", got.UserID)
+
+	require.NoError(t, handle(ctx, message(`{"id":"u2","type":"user.deleted","tenant":"default","user_id":"ana"}`)))
+	got, err = salesService.GetSale(ctx, sale.ID)
+	require.NoError(t, err)
+	require.Equal(t, sales.AnonymizedUserID, got.UserID)
+
+	for _, body := range []string{`not json`, `{"id":"u3","type":"user.anonymized"}`, `{"id":"u4","type":"user.deleted","tenant":"a b","user_id":"ana"}`} {
+		require.ErrorIs(t, handle(ctx, message(body)), ErrPoison, body)
+	}
+}
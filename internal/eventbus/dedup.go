@@ -0,0 +1,50 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/cache"
+
+	"go.uber.org/zap"
+)
+
+// Deduplicated returns a Handler passing to next only the messages whose
+// event, identified by the "id" of their JSON body, was not handled yet, so
+// the redeliveries of an event already handled are dropped. Each ID is
+// claimed in processed with SetNX before its event is handled, so two
+// consumers getting the same event at once do not both handle it, and kept
+// for ttl; the claim is released if handling fails, for the redelivery to
+// retry it. Messages without an ID are always passed, and so are those that
+// processed cannot be asked about, since handling an event twice beats not
+// handling it.
+func Deduplicated(processed cache.Cache, ttl time.Duration, logger *zap.Logger, next Handler) Handler {
+	return func(ctx context.Context, msg Message) error {
+		var event struct {
+			ID string `json:"id"`
+		}
+		if json.Unmarshal(msg.Body, &event) != nil || event.ID == "" {
+			return next(ctx, msg)
+		}
+
+		claimed, err := processed.SetNX(ctx, event.ID, []byte(msg.ID), ttl)
+		if err != nil {
+			logger.Warn("failed to record processed event", zap.String("event_id", event.ID), zap.Error(err))
+			return next(ctx, msg)
+		}
+		if !claimed {
+			logger.Info("dropped redelivered event", zap.String("event_id", event.ID), zap.String("message_id", msg.ID))
+			return nil
+		}
+
+		if err := next(ctx, msg); err != nil {
+			// Se libera el ID, así el evento se vuelve a manejar al reintentarlo
+			if delErr := processed.Delete(ctx, event.ID); delErr != nil {
+				logger.Warn("failed to release processed event", zap.String("event_id", event.ID), zap.Error(delErr))
+			}
+			return err
+		}
+		return nil
+	}
+}
@@ -0,0 +1,99 @@
+// Package eventbus publishes the sale events to a message broker, as
+// CloudEvents, so other systems can react to them without polling the API.
+//
+// It also consumes the events of other services, which brokers deliver at
+// least once. Deduplicated drops the redeliveries: the ID of each event is
+// claimed with cache.Cache.SetNX before handling it, atomically, so only
+// one consumer handles it even if it is delivered to several at once. The
+// claim is kept for a TTL and released if handling fails, so the retry of
+// the broker handles the event again.
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"Ejercicio_Final-Taller_Go/internal/cloudevents"
+	"Ejercicio_Final-Taller_Go/internal/idgen"
+	"Ejercicio_Final-Taller_Go/internal/notify"
+	"Ejercicio_Final-Taller_Go/internal/sales"
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// Publisher posts messages to the topics of a broker.
+type Publisher interface {
+	Publish(ctx context.Context, topic string, body []byte) error
+}
+
+// Data is the data of the published sale events.
+type Data struct {
+	Tenant         string           `json:"tenant"`
+	Sale           sales.Sale       `json:"sale"`
+	PreviousStatus sales.SaleStatus `json:"previous_status,omitempty"`
+}
+
+// maxStreamLength caps, approximately, the entries kept in each stream.
+const maxStreamLength = 100000
+
+// RedisStreams publishes each topic as a Redis stream, whose entries carry
+// the message in their "data" field and its media type in "content_type".
+type RedisStreams struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStreams returns a Publisher on client, namespacing its streams
+// with prefix.
+func NewRedisStreams(client *redis.Client, prefix string) *RedisStreams {
+	return &RedisStreams{client: client, prefix: prefix}
+}
+
+func (r *RedisStreams) Publish(ctx context.Context, topic string, body []byte) error {
+	err := r.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: r.prefix + topic,
+		MaxLen: maxStreamLength,
+		Approx: true,
+		Values: map[string]any{"content_type": cloudevents.ContentType, "data": body},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("error publishing to %s: %w", topic, err)
+	}
+	return nil
+}
+
+// notifier adapts a Publisher to a notify.Notifier, publishing the body of
+// each message to the topic it is addressed to.
+type notifier struct {
+	publisher Publisher
+}
+
+// Notifier returns a notify.Notifier publishing through p, so events can be
+// published by a notify.Queue, with its retries and dead letters.
+func Notifier(p Publisher) notify.Notifier {
+	return notifier{publisher: p}
+}
+
+func (n notifier) Notify(ctx context.Context, msg notify.Message) error {
+	return n.publisher.Publish(ctx, msg.To, []byte(msg.Body))
+}
+
+// Hook returns a sales hook queueing every event on queue, as a CloudEvent
+// published to topic.
+func Hook(queue *notify.Queue, topic string, ids idgen.Generator, logger *zap.Logger) sales.Hook {
+	return func(ctx context.Context, e sales.Event) {
+		id := tenant.FromContext(ctx)
+		event := cloudevents.FromSale(ids.NewID(), id, e.Type, e.Sale, Data{Tenant: id, Sale: e.Sale, PreviousStatus: e.PreviousStatus})
+		body, err := json.Marshal(event)
+		if err != nil {
+			logger.Error("failed to encode sale event", zap.String("sale_id", e.Sale.ID), zap.Error(err))
+			return
+		}
+		if err := queue.Enqueue(notify.Message{To: topic, Subject: string(e.Type), Body: string(body)}); err != nil {
+			logger.Warn("failed to enqueue sale event", zap.String("sale_id", e.Sale.ID), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/idgen"
+	"Ejercicio_Final-Taller_Go/internal/notify"
+	"Ejercicio_Final-Taller_Go/internal/sales"
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestHook(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	queue := notify.NewQueue(Notifier(NewRedisStreams(client, "test:")), zap.NewNop(), 10, 1, time.Millisecond)
+	defer queue.Close()
+
+	at := time.Date(2024, 3, 10, 15, 0, 0, 0, time.UTC)
+	sale := sales.Sale{ID: "1", UserID: "a", Amount: 1000, Status: sales.StatusApproved, CreatedAt: at, UpdatedAt: at.Add(time.Minute), Version: 2}
+	hook := Hook(queue, "sales.events", idgen.UUID(), zap.NewNop())
+	hook(tenant.WithID(context.Background(), "acme"), sales.Event{Type: sales.EventStatusChanged, Sale: sale, PreviousStatus: sales.StatusPending})
+
+	var entries []redis.XMessage
+	require.Eventually(t, func() bool {
+		var err error
+		entries, err = client.XRange(context.Background(), "test:sales.events", "-", "+").Result()
+		return err == nil && len(entries) == 1
+	}, 2*time.Second, 5*time.Millisecond)
+	require.Equal(t, "application/cloudevents+json", entries[0].Values["content_type"])
+
+	var event map[string]any
+	require.NoError(t, json.Unmarshal([]byte(entries[0].Values["data"].(string)), &event))
+	require.Equal(t, "1.0", event["specversion"])
+	require.NotEmpty(t, event["id"])
+	require.Equal(t, "/tenants/acme/sales", event["source"])
+	require.Equal(t, "sale.status_changed", event["type"])
+	require.Equal(t, "1", event["subject"])
+	require.Equal(t, "2024-03-10T15:01:00Z", event["time"])
+	require.Equal(t, "application/json", event["datacontenttype"])
+	data := event["data"].(map[string]any)
+	require.Equal(t, "acme", data["tenant"])
+	require.Equal(t, "pending", data["previous_status"])
+	require.Equal(t, "approved", data["sale"].(map[string]any)["status"])
+}
@@ -0,0 +1,69 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"Ejercicio_Final-Taller_Go/internal/sales"
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+
+	"go.uber.org/zap"
+)
+
+// paymentsActor is who the status changes of the payment results are attributed to.
+const paymentsActor = "payments"
+
+// PaymentResult is what the payment provider publishes once the payment of
+// a sale is settled. ID identifies the result, the same on redeliveries.
+type PaymentResult struct {
+	ID     string           `json:"id"`
+	Tenant string           `json:"tenant"`
+	SaleID string           `json:"sale_id"`
+	Status sales.SaleStatus `json:"status"` // approved or rejected
+	// RejectionReason is the reason code of a rejection.
+	RejectionReason string `json:"rejection_reason,omitempty"`
+}
+
+// PaymentResults returns a Handler moving each pending sale to the status
+// of its payment result. A result already applied is accepted again, so
+// redeliveries are harmless; one that is malformed, for an unknown sale or
+// contradicting the sale's status is poison.
+func PaymentResults(salesService *sales.Service, logger *zap.Logger) Handler {
+	return func(ctx context.Context, msg Message) error {
+		var r PaymentResult
+		if err := json.Unmarshal(msg.Body, &r); err != nil {
+			return fmt.Errorf("%w: %w", ErrPoison, err)
+		}
+		if r.SaleID == "" || (r.Status != sales.StatusApproved && r.Status != sales.StatusRejected) {
+			return fmt.Errorf("%w: payment result needs a sale_id and an approved or rejected status", ErrPoison)
+		}
+		if r.Tenant != "" && tenant.Validate(r.Tenant) != nil {
+			return fmt.Errorf("%w: invalid tenant %q", ErrPoison, r.Tenant)
+		}
+		ctx = tenant.WithID(ctx, r.Tenant)
+
+		review := sales.Review{Actor: paymentsActor, Reason: "payment " + string(r.Status), RejectionReason: r.RejectionReason}
+		var err error
+		if r.Status == sales.StatusApproved {
+			_, err = salesService.ApproveSale(ctx, r.SaleID, review)
+		} else {
+			_, err = salesService.RejectSale(ctx, r.SaleID, review)
+		}
+		switch {
+		case err == nil:
+			logger.Info("payment result applied", zap.String("sale_id", r.SaleID), zap.String("status", string(r.Status)))
+			return nil
+		case errors.Is(err, sales.ErrInvalidTransition):
+			if sale, getErr := salesService.GetSale(ctx, r.SaleID); getErr == nil && sale.Status == r.Status {
+				return nil
+			}
+			return fmt.Errorf("%w: %w", ErrPoison, err)
+		case errors.Is(err, sales.ErrNotFound), errors.Is(err, sales.ErrInvalidRejectionReason):
+			return fmt.Errorf("%w: %w", ErrPoison, err)
+		default:
+			return err
+		}
+	}
+}
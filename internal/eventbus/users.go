@@ -0,0 +1,55 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"Ejercicio_Final-Taller_Go/internal/sales"
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+
+	"go.uber.org/zap"
+)
+
+// Types of the user events that anonymize the sales of their user.
+const (
+	UserDeleted    = "user.deleted"
+	UserAnonymized = "user.anonymized"
+)
+
+// UserEvent is what the user service publishes about a user. ID identifies
+// the event, the same on redeliveries.
+type UserEvent struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	Tenant string `json:"tenant"`
+	UserID string `json:"user_id"`
+}
+
+// UserDeletions returns a Handler anonymizing the sales of the users that
+// are deleted or anonymized (see sales.Service.AnonymizeUser). Other user
+// events are ignored, and malformed ones are poison.
+func UserDeletions(salesService *sales.Service, logger *zap.Logger) Handler {
+	return func(ctx context.Context, msg Message) error {
+		var e UserEvent
+		if err := json.Unmarshal(msg.Body, &e); err != nil {
+			return fmt.Errorf("%w: %w", ErrPoison, err)
+		}
+		if e.Type != UserDeleted && e.Type != UserAnonymized {
+			return nil
+		}
+		if e.UserID == "" {
+			return fmt.Errorf("%w: user event needs a user_id", ErrPoison)
+		}
+		if e.Tenant != "" && tenant.Validate(e.Tenant) != nil {
+			return fmt.Errorf("%w: invalid tenant %q", ErrPoison, e.Tenant)
+		}
+
+		n, err := salesService.AnonymizeUser(tenant.WithID(ctx, e.Tenant), e.UserID)
+		if err != nil {
+			return err
+		}
+		logger.Info("user event applied", zap.String("event_id", e.ID), zap.String("type", e.Type), zap.Int("sales", n))
+		return nil
+	}
+}
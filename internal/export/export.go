@@ -0,0 +1,136 @@
+// Package export writes nightly dumps of every tenant's sales to an object
+// store bucket, for reporting and analytics outside the API.
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/clock"
+	"Ejercicio_Final-Taller_Go/internal/objstore"
+	"Ejercicio_Final-Taller_Go/internal/sales"
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+
+	"go.uber.org/zap"
+)
+
+// Status reports the outcome of the exports run so far.
+type Status struct {
+	Format        string     `json:"format"`
+	LastRunAt     *time.Time `json:"last_run_at"`
+	LastSuccessAt *time.Time `json:"last_success_at"`
+	LastError     string     `json:"last_error,omitempty"`
+	// Objects and Sales describe the last successful export.
+	Objects []string `json:"objects"`
+	Sales   int      `json:"sales"`
+}
+
+// Exporter writes one file per tenant and day, named
+// "<prefix>/<tenant>/sales-<YYYY-MM-DD><extension>", to a bucket.
+type Exporter struct {
+	sales  *sales.Service
+	bucket objstore.Bucket
+	prefix string
+	format Format
+	clock  clock.Clock
+	logger *zap.Logger
+
+	mu     sync.Mutex
+	status Status
+}
+
+// Option configures optional dependencies of an Exporter.
+type Option func(*Exporter)
+
+// WithClock sets the clock that dates the exports. Defaults to the system clock.
+func WithClock(c clock.Clock) Option {
+	return func(e *Exporter) {
+		e.clock = c
+	}
+}
+
+// New creates an Exporter dumping the sales of salesService to bucket.
+func New(salesService *sales.Service, bucket objstore.Bucket, prefix string, format Format, logger *zap.Logger, opts ...Option) *Exporter {
+	e := &Exporter{
+		sales:  salesService,
+		bucket: bucket,
+		prefix: prefix,
+		format: format,
+		clock:  clock.System(),
+		logger: logger,
+		status: Status{Format: format.Name, Objects: []string{}},
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Run exports the sales of every tenant once. Files of the same day are
+// overwritten, so a failed run can simply be retried.
+func (e *Exporter) Run(ctx context.Context) error {
+	now := e.clock.Now()
+	objects, count, err := e.run(ctx, now)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.status.LastRunAt = &now
+	if err != nil {
+		e.status.LastError = err.Error()
+		e.logger.Error("sales export failed", zap.Error(err))
+		return err
+	}
+	e.status.LastSuccessAt = &now
+	e.status.LastError = ""
+	e.status.Objects = objects
+	e.status.Sales = count
+	e.logger.Info("sales exported", zap.Int("sales", count), zap.Strings("objects", objects))
+	return nil
+}
+
+func (e *Exporter) run(ctx context.Context, now time.Time) ([]string, int, error) {
+	tenants, err := e.sales.Tenants(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	objects := make([]string, 0, len(tenants))
+	total := 0
+	for _, id := range tenants {
+		var buf bytes.Buffer
+		enc := e.format.NewEncoder(&buf)
+		count := 0
+		err := e.sales.StreamSales(tenant.WithID(ctx, id), "", "", func(sale *sales.Sale) error {
+			count++
+			return enc.Write(sale)
+		})
+		if err == nil {
+			err = enc.Close()
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("error exporting sales of tenant %s: %w", id, err)
+		}
+
+		key := path.Join(e.prefix, id, "sales-"+now.Format("2006-01-02")+e.format.Extension)
+		if err := e.bucket.Put(ctx, key, buf.Bytes()); err != nil {
+			return nil, 0, err
+		}
+		objects = append(objects, key)
+		total += count
+	}
+	return objects, total, nil
+}
+
+// Status returns a snapshot of the export status.
+func (e *Exporter) Status() Status {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	s := e.status
+	s.Objects = append([]string(nil), e.status.Objects...)
+	return s
+}
@@ -0,0 +1,97 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/clock"
+	"Ejercicio_Final-Taller_Go/internal/objstore"
+	"Ejercicio_Final-Taller_Go/internal/sales"
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// failingBucket rejects every write.
+type failingBucket struct {
+	objstore.Bucket
+}
+
+func (failingBucket) Put(context.Context, string, []byte) error {
+	return errors.New("bucket unavailable")
+}
+
+func TestExporter_Run(t *testing.T) {
+	now := time.Date(2024, 3, 10, 2, 0, 0, 0, time.UTC)
+	storage := sales.NewLocalStorage()
+	acme := tenant.WithID(context.Background(), "acme")
+	globex := tenant.WithID(context.Background(), "globex")
+	require.NoError(t, storage.Set(acme, &sales.Sale{ID: "1", UserID: "a", Amount: 1000, Status: sales.StatusApproved}))
+	require.NoError(t, storage.Set(acme, &sales.Sale{ID: "2", UserID: "a", Amount: 500, Status: sales.StatusPending}))
+	require.NoError(t, storage.Set(globex, &sales.Sale{ID: "3", UserID: "b", Amount: 700, Status: sales.StatusRejected}))
+	salesService := sales.NewService(storage, zap.NewNop(), "")
+
+	format, err := LookupFormat("ndjson")
+	require.NoError(t, err)
+	bucket := objstore.Dir(t.TempDir())
+	e := New(salesService, bucket, "reports", format, zap.NewNop(), WithClock(clock.NewManual(now)))
+
+	require.Nil(t, e.Status().LastSuccessAt)
+	require.NoError(t, e.Run(context.Background()))
+
+	status := e.Status()
+	require.Equal(t, now, *status.LastSuccessAt)
+	require.Equal(t, 3, status.Sales)
+	require.Equal(t, []string{"reports/acme/sales-2024-03-10.ndjson", "reports/globex/sales-2024-03-10.ndjson"}, status.Objects)
+
+	data, err := bucket.Get(context.Background(), "reports/acme/sales-2024-03-10.ndjson")
+	require.NoError(t, err)
+	require.Len(t, strings.Split(strings.TrimSpace(string(data)), "\n"), 2)
+
+	// un fallo no pisa la última exportación exitosa
+	e.bucket = failingBucket{bucket}
+	require.Error(t, e.Run(context.Background()))
+	status = e.Status()
+	require.Equal(t, now, *status.LastSuccessAt)
+	require.Contains(t, status.LastError, "bucket unavailable")
+}
+
+func TestLookupFormat(t *testing.T) {
+	_, err := LookupFormat("xlsx")
+	require.ErrorIs(t, err, ErrUnknownFormat)
+}
+
+func TestParquetEncoder(t *testing.T) {
+	createdAt := time.Date(2024, 3, 10, 15, 4, 5, 0, time.FixedZone("ART", -3*3600))
+	format, err := LookupFormat("parquet")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	enc := format.NewEncoder(&buf)
+	require.NoError(t, enc.Write(&sales.Sale{ID: "1", Number: "2024-000001", UserID: "a", Amount: 123456, Status: sales.StatusApproved, CreatedAt: createdAt, UpdatedAt: createdAt, Version: 2}))
+	require.NoError(t, enc.Write(&sales.Sale{ID: "2", UserID: "b", Amount: 5, Status: sales.StatusPending, AssignedTo: "rev", CreatedAt: createdAt, UpdatedAt: createdAt, Version: 1,
+		OperatorNotes: []sales.Note{{ID: "n1", Text: "customer called", Author: "support", CreatedAt: createdAt}}}))
+	require.NoError(t, enc.Close())
+
+	rows, err := parquet.Read[parquetRow](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	require.EqualValues(t, 123456, rows[0].Amount)
+	require.True(t, createdAt.Equal(rows[0].CreatedAt))
+	require.Equal(t, "rev", rows[1].AssignedTo)
+	require.Empty(t, rows[0].OperatorNotes)
+	require.Equal(t, []parquetNote{{ID: "n1", Text: "customer called", Author: "support", CreatedAt: createdAt.UTC()}}, rows[1].OperatorNotes)
+
+	// los montos se declaran como decimales exactos y las fechas como timestamps
+	schema := parquet.SchemaOf(parquetRow{})
+	amount, _ := schema.Lookup("amount")
+	require.Equal(t, "DECIMAL(18,2)", amount.Node.Type().LogicalType().String())
+	created, _ := schema.Lookup("created_at")
+	require.Contains(t, created.Node.Type().LogicalType().String(), "TIMESTAMP")
+}
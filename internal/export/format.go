@@ -0,0 +1,68 @@
+package export
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"Ejercicio_Final-Taller_Go/internal/sales"
+)
+
+// ErrUnknownFormat is returned for an export format that is not supported.
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// Encoder writes sales to an export file in one format. Close must be
+// called to finish the file.
+type Encoder interface {
+	Write(sale *sales.Sale) error
+	Close() error
+}
+
+// Format is a file format exports can be written in.
+type Format struct {
+	// Name is how the format is selected, e.g. "ndjson".
+	Name string
+	// Extension is appended to the name of exported files.
+	Extension string
+	// ContentType is the media type of the files.
+	ContentType string
+	// NewEncoder returns an Encoder writing to w.
+	NewEncoder func(w io.Writer) Encoder
+	// Concatenable tells that files in the format joined one after the
+	// other are still a valid file, as export jobs write them (see Jobs).
+	Concatenable bool
+}
+
+var formats = map[string]Format{
+	"ndjson":  {Name: "ndjson", Extension: ".ndjson", ContentType: "application/x-ndjson", NewEncoder: newNDJSONEncoder, Concatenable: true},
+	"parquet": {Name: "parquet", Extension: ".parquet", ContentType: "application/vnd.apache.parquet", NewEncoder: newParquetEncoder},
+	"msgpack": {Name: "msgpack", Extension: ".msgpack", ContentType: "application/msgpack", NewEncoder: newMsgpackEncoder, Concatenable: true},
+}
+
+// LookupFormat returns the format called name.
+// Returns ErrUnknownFormat if there is none.
+func LookupFormat(name string) (Format, error) {
+	f, ok := formats[name]
+	if !ok {
+		return Format{}, fmt.Errorf("%w %q", ErrUnknownFormat, name)
+	}
+	return f, nil
+}
+
+// ndjsonEncoder writes one JSON sale per line, like GET /sales/stream.
+type ndjsonEncoder struct {
+	enc *json.Encoder
+}
+
+func newNDJSONEncoder(w io.Writer) Encoder {
+	return ndjsonEncoder{enc: json.NewEncoder(w)}
+}
+
+func (e ndjsonEncoder) Write(sale *sales.Sale) error {
+	return e.enc.Encode(sale)
+}
+
+func (e ndjsonEncoder) Close() error {
+	return nil
+}
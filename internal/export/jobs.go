@@ -0,0 +1,337 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/apperrors"
+	"Ejercicio_Final-Taller_Go/internal/clock"
+	"Ejercicio_Final-Taller_Go/internal/idgen"
+	"Ejercicio_Final-Taller_Go/internal/objstore"
+	"Ejercicio_Final-Taller_Go/internal/sales"
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+
+	"go.uber.org/zap"
+)
+
+// ErrJobNotFound is returned for an export job the tenant does not have.
+var ErrJobNotFound = apperrors.New(apperrors.NotFound, "export_job_not_found", "export job not found")
+
+// ErrJobNotFinished is returned when downloading an export job that has not succeeded.
+var ErrJobNotFinished = apperrors.New(apperrors.Conflict, "export_job_not_finished", "the export job has not finished")
+
+// ErrFormatNotConcatenable is returned when creating an export job in a
+// format whose files cannot be written in parts, such as Parquet.
+var ErrFormatNotConcatenable = apperrors.New(apperrors.Validation, "invalid_job_format", "export jobs are written as ndjson or msgpack")
+
+// JobStatus is the progress of an export job.
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+)
+
+// Job is an export of the sales of a tenant requested through the API, too
+// large to be streamed in one response. Only the sales created before the
+// job, and matching UserID and SaleStatus when set, are exported.
+type Job struct {
+	ID         string           `json:"id"`
+	Tenant     string           `json:"tenant"`
+	Status     JobStatus        `json:"status"`
+	Format     string           `json:"format"`
+	UserID     string           `json:"user_id,omitempty"`
+	SaleStatus sales.SaleStatus `json:"sale_status,omitempty"`
+	// Sales counts the sales exported so far, written to Parts files.
+	Sales int `json:"sales"`
+	Parts int `json:"parts"`
+	// Cursor is the last sale of the last written part, after which an
+	// interrupted job resumes.
+	Cursor     *Cursor    `json:"cursor,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Cursor identifies a sale in creation order.
+type Cursor struct {
+	CreatedAt time.Time `json:"created_at"`
+	ID        string    `json:"id"`
+}
+
+// after reports whether sale comes after c in creation order.
+func (c *Cursor) after(sale *sales.Sale) bool {
+	if !sale.CreatedAt.Equal(c.CreatedAt) {
+		return sale.CreatedAt.After(c.CreatedAt)
+	}
+	return sale.ID > c.ID
+}
+
+// Jobs keeps export jobs and their files in a bucket, so they survive
+// restarts: each job is a record "<prefix>/<tenant>/<id>/job.json" next
+// to its parts, "part-00001<extension>" and on, each a file of at most a
+// part size of sales. RunPending writes the parts of the unfinished jobs,
+// checkpointing the job after each one, so a job interrupted midway
+// resumes after its last part.
+type Jobs struct {
+	sales    *sales.Service
+	bucket   objstore.Bucket
+	prefix   string
+	partSize int
+	ids      idgen.Generator
+	clock    clock.Clock
+	logger   *zap.Logger
+}
+
+// JobsOption configures optional dependencies of Jobs.
+type JobsOption func(*Jobs)
+
+// WithJobsClock sets the clock that dates the jobs. Defaults to the system clock.
+func WithJobsClock(c clock.Clock) JobsOption {
+	return func(j *Jobs) {
+		j.clock = c
+	}
+}
+
+// WithJobIDs sets the generator of job IDs. Defaults to UUIDs.
+func WithJobIDs(ids idgen.Generator) JobsOption {
+	return func(j *Jobs) {
+		j.ids = ids
+	}
+}
+
+// NewJobs creates export jobs of the sales of salesService, kept in bucket
+// below prefix and written in parts of partSize sales, or in a single part
+// if partSize is not positive.
+func NewJobs(salesService *sales.Service, bucket objstore.Bucket, prefix string, partSize int, logger *zap.Logger, opts ...JobsOption) *Jobs {
+	j := &Jobs{
+		sales:    salesService,
+		bucket:   bucket,
+		prefix:   prefix,
+		partSize: partSize,
+		ids:      idgen.UUID(),
+		clock:    clock.System(),
+		logger:   logger,
+	}
+	for _, opt := range opts {
+		opt(j)
+	}
+	return j
+}
+
+// Create queues an export job of the sales of the tenant in ctx, in format.
+// Returns ErrFormatNotConcatenable for a format jobs cannot be written in,
+// and sales.ErrInvalidStatus for an unknown status.
+func (j *Jobs) Create(ctx context.Context, format Format, userID string, status sales.SaleStatus) (*Job, error) {
+	if !format.Concatenable {
+		return nil, ErrFormatNotConcatenable
+	}
+	if status != "" && !status.Valid() {
+		return nil, sales.ErrInvalidStatus
+	}
+
+	now := j.clock.Now()
+	job := &Job{
+		ID:         j.ids.NewID(),
+		Tenant:     tenant.FromContext(ctx),
+		Status:     JobQueued,
+		Format:     format.Name,
+		UserID:     userID,
+		SaleStatus: status,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := j.save(ctx, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Get returns the job id of the tenant in ctx.
+// Returns ErrJobNotFound if there is no such job.
+func (j *Jobs) Get(ctx context.Context, id string) (*Job, error) {
+	// el ID es parte de la clave, no puede salirse del directorio del job
+	if id == "" || strings.ContainsAny(id, "/.") {
+		return nil, ErrJobNotFound
+	}
+	data, err := j.bucket.Get(ctx, j.key(tenant.FromContext(ctx), id, "job.json"))
+	if errors.Is(err, objstore.ErrNotFound) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("error decoding export job %s: %w", id, err)
+	}
+	return &job, nil
+}
+
+// Download writes the file of the succeeded job to w, joining its parts.
+// Returns ErrJobNotFinished if the job has not succeeded.
+func (j *Jobs) Download(ctx context.Context, job *Job, w io.Writer) error {
+	if job.Status != JobSucceeded {
+		return ErrJobNotFinished
+	}
+	format, err := LookupFormat(job.Format)
+	if err != nil {
+		return err
+	}
+
+	for part := 1; part <= job.Parts; part++ {
+		data, err := j.bucket.Get(ctx, j.partKey(job, format, part))
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunPending runs every queued job, and resumes those left running by an
+// interrupted run, one after the other. A job whose export fails is marked
+// failed; the error of the first one is returned.
+func (j *Jobs) RunPending(ctx context.Context) error {
+	keys, err := j.bucket.List(ctx, j.prefix)
+	if err != nil {
+		return err
+	}
+
+	var first error
+	for _, key := range keys {
+		if path.Base(key) != "job.json" {
+			continue
+		}
+		data, err := j.bucket.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		var job Job
+		if err := json.Unmarshal(data, &job); err != nil {
+			j.logger.Error("failed to decode export job", zap.String("key", key), zap.Error(err))
+			continue
+		}
+		if job.Status != JobQueued && job.Status != JobRunning {
+			continue
+		}
+
+		if err := j.run(tenant.WithID(ctx, job.Tenant), &job); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// run writes the parts of job not written yet, and records how it ended.
+func (j *Jobs) run(ctx context.Context, job *Job) error {
+	if job.Status == JobRunning {
+		j.logger.Info("resuming export job", zap.String("job_id", job.ID), zap.String("tenant", job.Tenant), zap.Int("parts", job.Parts))
+	}
+	job.Status = JobRunning
+	err := j.save(ctx, job)
+	if err == nil {
+		err = j.export(ctx, job)
+	}
+	if ctx.Err() != nil {
+		// se interrumpió, queda en curso para retomarlo
+		return err
+	}
+
+	now := j.clock.Now()
+	job.FinishedAt = &now
+	if err != nil {
+		job.Status = JobFailed
+		job.Error = err.Error()
+		j.logger.Error("export job failed", zap.String("job_id", job.ID), zap.String("tenant", job.Tenant), zap.Error(err))
+	} else {
+		job.Status = JobSucceeded
+		j.logger.Info("export job finished", zap.String("job_id", job.ID), zap.String("tenant", job.Tenant),
+			zap.Int("sales", job.Sales), zap.Int("parts", job.Parts))
+	}
+	if saveErr := j.save(ctx, job); saveErr != nil {
+		return saveErr
+	}
+	return err
+}
+
+// export writes the sales of job after its cursor in parts of partSize
+// sales, saving the job after each one.
+func (j *Jobs) export(ctx context.Context, job *Job) error {
+	format, err := LookupFormat(job.Format)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	enc := format.NewEncoder(&buf)
+	var last *sales.Sale
+	count := 0
+	flush := func() error {
+		if err := enc.Close(); err != nil {
+			return err
+		}
+		if err := j.bucket.Put(ctx, j.partKey(job, format, job.Parts+1), buf.Bytes()); err != nil {
+			return err
+		}
+		job.Parts++
+		job.Sales += count
+		job.Cursor = &Cursor{CreatedAt: last.CreatedAt, ID: last.ID}
+		buf.Reset()
+		enc, count = format.NewEncoder(&buf), 0
+		return j.save(ctx, job)
+	}
+
+	err = j.sales.StreamSales(ctx, job.UserID, job.SaleStatus, func(sale *sales.Sale) error {
+		if sale.CreatedAt.After(job.CreatedAt) || (job.Cursor != nil && !job.Cursor.after(sale)) {
+			return nil
+		}
+		if err := enc.Write(sale); err != nil {
+			return err
+		}
+		last = sale
+		count++
+		if count == j.partSize {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil && count > 0 {
+		err = flush()
+	}
+	if err != nil {
+		return fmt.Errorf("error exporting sales: %w", err)
+	}
+	return nil
+}
+
+// save writes the record of job.
+func (j *Jobs) save(ctx context.Context, job *Job) error {
+	job.UpdatedAt = j.clock.Now()
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return j.bucket.Put(ctx, j.key(job.Tenant, job.ID, "job.json"), data)
+}
+
+func (j *Jobs) key(tenantID, id, name string) string {
+	return path.Join(j.prefix, tenantID, id, name)
+}
+
+func (j *Jobs) partKey(job *Job, format Format, part int) string {
+	return j.key(job.Tenant, job.ID, fmt.Sprintf("part-%05d%s", part, format.Extension))
+}
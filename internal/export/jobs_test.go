@@ -0,0 +1,93 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/clock"
+	"Ejercicio_Final-Taller_Go/internal/objstore"
+	"Ejercicio_Final-Taller_Go/internal/sales"
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// interruptingBucket cancels the run writing the object key, as if the
+// process stopped right then.
+type interruptingBucket struct {
+	objstore.Bucket
+	key    string
+	cancel context.CancelFunc
+}
+
+func (b interruptingBucket) Put(ctx context.Context, key string, data []byte) error {
+	if strings.HasSuffix(key, b.key) {
+		b.cancel()
+		return ctx.Err()
+	}
+	return b.Bucket.Put(ctx, key, data)
+}
+
+func TestJobs(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	storage := sales.NewLocalStorage()
+	acme := tenant.WithID(context.Background(), "acme")
+	for i, id := range []string{"1", "2", "3", "4", "5"} {
+		require.NoError(t, storage.Set(acme, &sales.Sale{ID: id, UserID: "a", Amount: 100, Status: sales.StatusApproved,
+			CreatedAt: now.Add(time.Duration(i-10) * time.Minute)}))
+	}
+	// creada después del pedido, no se exporta
+	require.NoError(t, storage.Set(acme, &sales.Sale{ID: "6", UserID: "a", Amount: 100, Status: sales.StatusApproved,
+		CreatedAt: now.Add(time.Minute)}))
+	salesService := sales.NewService(storage, zap.NewNop(), "")
+
+	dir := objstore.Dir(t.TempDir())
+	jobs := NewJobs(salesService, dir, "export-jobs", 2, zap.NewNop(), WithJobsClock(clock.NewManual(now)))
+
+	parquet, err := LookupFormat("parquet")
+	require.NoError(t, err)
+	_, err = jobs.Create(acme, parquet, "", "")
+	require.ErrorIs(t, err, ErrFormatNotConcatenable)
+
+	ndjson, err := LookupFormat("ndjson")
+	require.NoError(t, err)
+	job, err := jobs.Create(acme, ndjson, "a", "")
+	require.NoError(t, err)
+	require.Equal(t, JobQueued, job.Status)
+
+	_, err = jobs.Get(tenant.WithID(context.Background(), "globex"), job.ID)
+	require.ErrorIs(t, err, ErrJobNotFound)
+	require.ErrorIs(t, jobs.Download(acme, job, &bytes.Buffer{}), ErrJobNotFinished)
+
+	// se corta al escribir la segunda parte
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupted := NewJobs(salesService, interruptingBucket{Bucket: dir, key: "part-00002.ndjson", cancel: cancel}, "export-jobs", 2,
+		zap.NewNop(), WithJobsClock(clock.NewManual(now)))
+	require.Error(t, interrupted.RunPending(ctx))
+	got, err := jobs.Get(acme, job.ID)
+	require.NoError(t, err)
+	require.Equal(t, JobRunning, got.Status)
+	require.Equal(t, 1, got.Parts)
+	require.Equal(t, "2", got.Cursor.ID)
+
+	// al reiniciar sigue después de la última parte escrita
+	require.NoError(t, jobs.RunPending(context.Background()))
+	got, err = jobs.Get(acme, job.ID)
+	require.NoError(t, err)
+	require.Equal(t, JobSucceeded, got.Status)
+	require.Equal(t, 3, got.Parts)
+	require.Equal(t, 5, got.Sales)
+	require.NotNil(t, got.FinishedAt)
+
+	var buf bytes.Buffer
+	require.NoError(t, jobs.Download(acme, got, &buf))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 5)
+	for i, line := range lines {
+		require.Contains(t, line, `"id":"`+string(rune('1'+i))+`"`)
+	}
+}
@@ -0,0 +1,29 @@
+package export
+
+import (
+	"io"
+
+	"Ejercicio_Final-Taller_Go/internal/sales"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// msgpackEncoder writes sales as a sequence of MessagePack maps with the
+// same fields as the JSON encoding, one after the other with no framing.
+type msgpackEncoder struct {
+	enc *msgpack.Encoder
+}
+
+func newMsgpackEncoder(w io.Writer) Encoder {
+	enc := msgpack.NewEncoder(w)
+	enc.SetCustomStructTag("json")
+	return msgpackEncoder{enc: enc}
+}
+
+func (e msgpackEncoder) Write(sale *sales.Sale) error {
+	return e.enc.Encode(sale)
+}
+
+func (e msgpackEncoder) Close() error {
+	return nil
+}
@@ -0,0 +1,75 @@
+package export
+
+import (
+	"io"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/sales"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// parquetRow is the Parquet schema of an exported sale. Amounts are
+// DECIMAL(18,2) over the stored cents, so they keep their exact value, and
+// timestamps are TIMESTAMP(MILLIS) in UTC.
+type parquetRow struct {
+	ID              string    `parquet:"id"`
+	Number          string    `parquet:"number"`
+	UserID          string    `parquet:"user_id"`
+	Amount          int64     `parquet:"amount,decimal(2:18)"`
+	Status          string    `parquet:"status,enum"`
+	AssignedTo      string    `parquet:"assigned_to,optional"`
+	RejectionReason string    `parquet:"rejection_reason,optional"`
+	CreatedBy       string    `parquet:"created_by,optional"`
+	CreatedAt       time.Time `parquet:"created_at,timestamp(millisecond)"`
+	UpdatedAt       time.Time `parquet:"updated_at,timestamp(millisecond)"`
+	Version         int64     `parquet:"version"`
+	Archived        bool      `parquet:"archived"`
+
+	OperatorNotes []parquetNote `parquet:"operator_notes,list"`
+}
+
+// parquetNote is a note of an exported sale.
+type parquetNote struct {
+	ID        string    `parquet:"id"`
+	Text      string    `parquet:"text"`
+	Author    string    `parquet:"author,optional"`
+	CreatedAt time.Time `parquet:"created_at,timestamp(millisecond)"`
+}
+
+// parquetEncoder writes sales as a Snappy-compressed Parquet file. Parquet
+// keeps its metadata in a footer, so nothing is valid until Close.
+type parquetEncoder struct {
+	w *parquet.GenericWriter[parquetRow]
+}
+
+func newParquetEncoder(w io.Writer) Encoder {
+	return parquetEncoder{w: parquet.NewGenericWriter[parquetRow](w, parquet.Compression(&parquet.Snappy))}
+}
+
+func (e parquetEncoder) Write(sale *sales.Sale) error {
+	var notes []parquetNote
+	for _, n := range sale.OperatorNotes {
+		notes = append(notes, parquetNote{ID: n.ID, Text: n.Text, Author: n.Author, CreatedAt: n.CreatedAt.UTC()})
+	}
+	_, err := e.w.Write([]parquetRow{{
+		ID:              sale.ID,
+		Number:          sale.Number,
+		UserID:          sale.UserID,
+		Amount:          int64(sale.Amount),
+		Status:          string(sale.Status),
+		AssignedTo:      sale.AssignedTo,
+		RejectionReason: sale.RejectionReason,
+		CreatedBy:       sale.CreatedBy,
+		CreatedAt:       sale.CreatedAt.UTC(),
+		UpdatedAt:       sale.UpdatedAt.UTC(),
+		Version:         int64(sale.Version),
+		Archived:        sale.Archived,
+		OperatorNotes:   notes,
+	}})
+	return err
+}
+
+func (e parquetEncoder) Close() error {
+	return e.w.Close()
+}
@@ -0,0 +1,110 @@
+// Package faults injects latency, timeouts and errors into outgoing HTTP
+// calls, to check in test and staging environments how the API copes with
+// a slow or failing dependency without breaking the dependency itself.
+package faults
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config describes the faults to inject. The zero value injects none.
+type Config struct {
+	// Latency delays every request by a random duration up to it.
+	Latency time.Duration
+	// TimeoutRate is the fraction of requests, between 0 and 1, that hang
+	// until their context is done, as if the dependency never answered.
+	TimeoutRate float64
+	// ErrorRate is the fraction of requests answered with 503 Service
+	// Unavailable without reaching the dependency.
+	ErrorRate float64
+}
+
+// Enabled reports whether cfg injects any fault.
+func (cfg Config) Enabled() bool {
+	return cfg.Latency > 0 || cfg.TimeoutRate > 0 || cfg.ErrorRate > 0
+}
+
+// Transport returns a RoundTripper injecting the faults of cfg into the
+// requests sent through next. A nil rnd uses a source seeded from the
+// current time; a fixed seed makes the sequence of faults reproducible.
+func Transport(next http.RoundTripper, cfg Config, rnd *rand.Rand) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if rnd == nil {
+		rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return &transport{next: next, cfg: cfg, rand: rnd}
+}
+
+type transport struct {
+	next http.RoundTripper
+	cfg  Config
+
+	mu   sync.Mutex
+	rand *rand.Rand // *rand.Rand no es seguro para uso concurrente, se protege con mu
+}
+
+// fault is what to do with one request.
+type fault struct {
+	delay   time.Duration
+	timeout bool
+	fail    bool
+}
+
+// pick draws the fault of the next request.
+func (t *transport) pick() fault {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var f fault
+	if t.cfg.Latency > 0 {
+		f.delay = time.Duration(t.rand.Int63n(int64(t.cfg.Latency) + 1))
+	}
+	// un único sorteo para que las tasas no se pisen
+	switch p := t.rand.Float64(); {
+	case p < t.cfg.TimeoutRate:
+		f.timeout = true
+	case p < t.cfg.TimeoutRate+t.cfg.ErrorRate:
+		f.fail = true
+	}
+	return f
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f := t.pick()
+	ctx := req.Context()
+
+	if f.delay > 0 {
+		timer := time.NewTimer(f.delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+	if f.timeout {
+		<-ctx.Done()
+		return nil, fmt.Errorf("injected timeout: %w", ctx.Err())
+	}
+	if f.fail {
+		return &http.Response{
+			Status:     "503 Service Unavailable",
+			StatusCode: http.StatusServiceUnavailable,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     http.Header{"Content-Type": {"text/plain"}},
+			Body:       io.NopCloser(strings.NewReader("injected fault")),
+			Request:    req,
+		}, nil
+	}
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,57 @@
+package faults
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	c := &http.Client{Transport: Transport(nil, Config{TimeoutRate: 0.2, ErrorRate: 0.3}, rand.New(rand.NewSource(1)))}
+
+	counts := map[string]int{}
+	for range 200 {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+		resp, err := c.Do(req)
+		cancel()
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			counts["timeout"]++
+		case err != nil:
+			t.Fatal(err)
+		default:
+			counts[resp.Status]++
+			resp.Body.Close()
+		}
+	}
+
+	require.InDelta(t, 40, counts["timeout"], 20)
+	require.InDelta(t, 60, counts["503 Service Unavailable"], 20)
+	require.InDelta(t, 100, counts["200 OK"], 25)
+}
+
+func TestTransport_Latency(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	c := &http.Client{Transport: Transport(nil, Config{Latency: time.Hour}, nil)}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	_, err := c.Do(req)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	require.False(t, Config{}.Enabled())
+}
@@ -0,0 +1,81 @@
+// Package httppool builds long-lived HTTP clients with a tuned connection
+// pool and publishes their pool statistics through expvar.
+package httppool
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+	"time"
+)
+
+// pools holds the statistics of every client, keyed by name, under
+// "http_pools" in /debug/vars.
+var pools = expvar.NewMap("http_pools")
+
+// Config tunes the connection pool of a client.
+type Config struct {
+	// MaxIdleConns caps the idle connections kept across all hosts.
+	MaxIdleConns int
+	// MaxIdleConnsPerHost caps the idle connections kept per host. The
+	// net/http default of 2 makes most requests under load dial again.
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost caps the connections per host, idle or not; 0 means no limit.
+	MaxConnsPerHost int
+	// IdleConnTimeout is how long an idle connection is kept open.
+	IdleConnTimeout time.Duration
+}
+
+// Stats counts how a client's requests got their connections.
+type Stats struct {
+	Requests    atomic.Int64
+	InFlight    atomic.Int64
+	ConnsNew    atomic.Int64
+	ConnsReused atomic.Int64
+}
+
+// String renders the stats as JSON, implementing expvar.Var.
+func (s *Stats) String() string {
+	return fmt.Sprintf(`{"requests": %d, "in_flight": %d, "conns_new": %d, "conns_reused": %d}`,
+		s.Requests.Load(), s.InFlight.Load(), s.ConnsNew.Load(), s.ConnsReused.Load())
+}
+
+// NewClient returns an HTTP client with a pool tuned by cfg whose statistics
+// are published as name. A later client with the same name replaces them.
+func NewClient(name string, cfg Config) (*http.Client, *Stats) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = cfg.MaxIdleConns
+	transport.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	transport.MaxConnsPerHost = cfg.MaxConnsPerHost
+	transport.IdleConnTimeout = cfg.IdleConnTimeout
+
+	stats := &Stats{}
+	pools.Set(name, stats)
+
+	return &http.Client{Transport: &instrumented{next: transport, stats: stats}}, stats
+}
+
+// instrumented counts requests and connection reuse on the way to next.
+type instrumented struct {
+	next  http.RoundTripper
+	stats *Stats
+}
+
+func (t *instrumented) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.stats.Requests.Add(1)
+	t.stats.InFlight.Add(1)
+	defer t.stats.InFlight.Add(-1)
+
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				t.stats.ConnsReused.Add(1)
+			} else {
+				t.stats.ConnsNew.Add(1)
+			}
+		},
+	}
+	return t.next.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+}
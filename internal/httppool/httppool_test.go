@@ -0,0 +1,32 @@
+package httppool
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewClient_ReusesConnections(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	client, stats := NewClient("test", Config{MaxIdleConns: 10, MaxIdleConnsPerHost: 10, IdleConnTimeout: time.Minute})
+	for i := 0; i < 5; i++ {
+		resp, err := client.Get(srv.URL)
+		require.NoError(t, err)
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	require.EqualValues(t, 5, stats.Requests.Load())
+	require.EqualValues(t, 0, stats.InFlight.Load())
+	require.EqualValues(t, 1, stats.ConnsNew.Load())
+	require.EqualValues(t, 4, stats.ConnsReused.Load())
+	require.Contains(t, pools.Get("test").String(), `"conns_reused": 4`)
+}
@@ -0,0 +1,221 @@
+package i18n
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLanguage is used when the client does not ask for a supported language.
+const DefaultLanguage = "en"
+
+// messages holds the translated error details, keyed by language and error code.
+// Codes are the stable apperrors codes; only the text changes per language.
+var messages = map[string]map[string]string{
+	"en": {
+		"internal_error":            "internal error",
+		"invalid_request_body":      "invalid request body",
+		"invalid_tenant_id":         "invalid tenant ID",
+		"sale_not_found":            "sale not found",
+		"empty_sale_id":             "empty sale ID",
+		"invalid_status":            "invalid status value",
+		"invalid_status_transition": "invalid status transition",
+		"invalid_amount":            "amount must be greater than zero",
+		"user_not_found":            "user not found",
+		"empty_user_id":             "empty user ID",
+		"user_api_unavailable":      "the user API is unavailable",
+		"sale_already_claimed":      "sale already claimed by another reviewer",
+		"invalid_reviewer":          "reviewer is required",
+		"invalid_pagination":        "invalid pagination parameters",
+		"request_timeout":           "the request took too long to complete",
+		"invalid_filter":            "invalid filter expression",
+		"invalid_count_only":        "count_only must be a boolean",
+		"invalid_api_key":           "invalid API key",
+		"api_key_not_found":         "API key not found",
+		"quota_exceeded":            "monthly quota exceeded",
+		"invalid_api_key_name":      "API key name is required",
+		"exports_disabled":          "scheduled exports are not configured",
+		"invalid_export_format":     "format must be ndjson, parquet or msgpack",
+		"sale_locked":               "sale is being updated by another request",
+		"lock_unavailable":          "the lock service is unavailable",
+		"creation_job_not_found":    "sale creation job not found",
+		"creation_queue_full":       "too many sales are waiting to be created",
+		"dead_letter_not_found":     "dead letter not found",
+		"notify_unavailable":        "the notification queue cannot accept messages",
+		"saga_not_found":            "saga not found",
+		"sale_rejected":             "the sale was rejected",
+		"reservation_not_found":     "payment reservation not found",
+		"reservation_released":      "payment reservation was released",
+		"history_unavailable":       "sale history is not recorded",
+		"invalid_at":                "at must be an RFC 3339 timestamp",
+		"amount_too_large":          "amount exceeds the maximum allowed",
+		"body_too_large":            "request body is too large",
+		"body_too_deep":             "request body is nested too deeply",
+		"user_api_timeout":          "the user API did not answer in time",
+		"storage_timeout":           "the storage did not answer in time",
+		"invalid_rejection_reason":  "a valid rejection reason is required",
+		"unknown_sale_field":        "the field cannot be patched",
+		"immutable_sale_field":      "the field cannot be changed in the sale's status",
+		"invalid_sale_data":         "metadata, tags or notes exceed their limits",
+		"empty_sale_patch":          "no field to update",
+		"unknown_field":             "request body has unknown fields",
+		"name_required":             "name is required",
+		"invalid_email":             "invalid email address",
+		"invalid_import":            "body must be a JSON array of users or a CSV file with a header row",
+		"too_many_rows":             "too many users in a single import",
+		"invalid_address":           "address fields must be at most 200 characters",
+		"invalid_country":           "country must be a supported ISO 3166-1 alpha-2 code",
+		"invalid_postal_code":       "invalid postal code for the country",
+		"invalid_verification":      "invalid or expired verification token",
+		"user_not_verified":         "the user has not verified their email",
+		"block_reason_required":     "a reason is required to block or unblock a user",
+		"user_blocked":              "the user is blocked from buying",
+		"user_version_mismatch":     "the user was modified since it was read",
+		"invalid_if_match":          `If-Match must be a single entity tag such as "v3"`,
+		"invalid_date_range":        "from and to must be dates or RFC 3339 timestamps, to after from",
+		"invalid_buckets":           "buckets must be increasing positive amounts",
+		"invalid_sale_note":         "the note is empty or exceeds its limits",
+		"attachments_unavailable":   "sale attachments are not enabled",
+		"invalid_attachment":        "the attachment is empty or exceeds its limits",
+		"unsupported_attachment":    "the attachment type is not accepted",
+		"webhook_not_found":         "webhook not found",
+		"invalid_webhook":           "invalid webhook subscription",
+		"invalid_delivery_outcome":  "outcome must be succeeded or failed",
+		"admin_required":            "an admin API key is required",
+		"unbound_admin_required":    "an admin API key not bound to a tenant is required",
+		"force_reason_required":     "a reason is required to force a status",
+		"sale_not_reprocessable":    "only rejected sales can be reprocessed",
+		"export_jobs_disabled":      "export jobs are not configured",
+		"export_job_not_found":      "export job not found",
+		"export_job_not_finished":   "the export job has not finished",
+		"invalid_job_format":        "export jobs are written as ndjson or msgpack",
+		"invalid_bundle":            "invalid configuration bundle",
+		"invalid_group_by":          "group_by must be status, user_id or day",
+		"tenant_not_allowed":        "the API key cannot act in this tenant",
+	},
+	"es": {
+		"internal_error":            "error interno",
+		"invalid_request_body":      "cuerpo de la solicitud inválido",
+		"invalid_tenant_id":         "identificador de tenant inválido",
+		"sale_not_found":            "venta no encontrada",
+		"empty_sale_id":             "ID de venta vacío",
+		"invalid_status":            "valor de estado inválido",
+		"invalid_status_transition": "transición de estado inválida",
+		"invalid_amount":            "el monto debe ser mayor a cero",
+		"user_not_found":            "usuario no encontrado",
+		"empty_user_id":             "ID de usuario vacío",
+		"user_api_unavailable":      "la API de usuarios no está disponible",
+		"sale_already_claimed":      "la venta ya fue tomada por otro revisor",
+		"invalid_reviewer":          "el revisor es obligatorio",
+		"invalid_pagination":        "parámetros de paginación inválidos",
+		"request_timeout":           "la solicitud tardó demasiado en completarse",
+		"invalid_filter":            "expresión de filtro inválida",
+		"invalid_count_only":        "count_only debe ser un booleano",
+		"invalid_api_key":           "API key inválida",
+		"api_key_not_found":         "API key no encontrada",
+		"quota_exceeded":            "cuota mensual excedida",
+		"invalid_api_key_name":      "el nombre de la API key es obligatorio",
+		"exports_disabled":          "las exportaciones programadas no están configuradas",
+		"invalid_export_format":     "el formato debe ser ndjson, parquet o msgpack",
+		"sale_locked":               "la venta está siendo modificada por otra solicitud",
+		"lock_unavailable":          "el servicio de bloqueos no está disponible",
+		"creation_job_not_found":    "trabajo de creación de venta no encontrado",
+		"creation_queue_full":       "demasiadas ventas esperando ser creadas",
+		"dead_letter_not_found":     "mensaje fallido no encontrado",
+		"notify_unavailable":        "la cola de notificaciones no puede aceptar mensajes",
+		"saga_not_found":            "saga no encontrada",
+		"sale_rejected":             "la venta fue rechazada",
+		"reservation_not_found":     "reserva de pago no encontrada",
+		"reservation_released":      "la reserva de pago fue liberada",
+		"history_unavailable":       "no se registra el historial de las ventas",
+		"invalid_at":                "at debe ser una fecha RFC 3339",
+		"amount_too_large":          "el monto supera el máximo permitido",
+		"body_too_large":            "el cuerpo de la solicitud es demasiado grande",
+		"body_too_deep":             "el cuerpo de la solicitud está demasiado anidado",
+		"user_api_timeout":          "la API de usuarios no respondió a tiempo",
+		"storage_timeout":           "el almacenamiento no respondió a tiempo",
+		"invalid_rejection_reason":  "se requiere un motivo de rechazo válido",
+		"unknown_sale_field":        "el campo no se puede modificar",
+		"immutable_sale_field":      "el campo no se puede cambiar en el estado de la venta",
+		"invalid_sale_data":         "los metadatos, etiquetas o notas exceden sus límites",
+		"empty_sale_patch":          "no hay campos para actualizar",
+		"unknown_field":             "el cuerpo de la solicitud tiene campos desconocidos",
+		"name_required":             "el nombre es obligatorio",
+		"invalid_email":             "dirección de email inválida",
+		"invalid_import":            "el cuerpo debe ser un array JSON de usuarios o un CSV con encabezado",
+		"too_many_rows":             "demasiados usuarios en una sola importación",
+		"invalid_address":           "los campos de la dirección deben tener como máximo 200 caracteres",
+		"invalid_country":           "el país debe ser un código ISO 3166-1 alfa-2 soportado",
+		"invalid_postal_code":       "código postal inválido para el país",
+		"invalid_verification":      "token de verificación inválido o vencido",
+		"user_not_verified":         "el usuario no verificó su email",
+		"block_reason_required":     "hace falta un motivo para bloquear o desbloquear a un usuario",
+		"user_blocked":              "el usuario tiene bloqueadas las compras",
+		"user_version_mismatch":     "el usuario fue modificado después de leerlo",
+		"invalid_if_match":          `If-Match debe ser una única etiqueta de entidad, como "v3"`,
+		"invalid_date_range":        "from y to deben ser fechas o fechas RFC 3339, con to posterior a from",
+		"invalid_buckets":           "buckets deben ser montos positivos crecientes",
+		"invalid_sale_note":         "la nota está vacía o excede sus límites",
+		"attachments_unavailable":   "los adjuntos de ventas no están habilitados",
+		"invalid_attachment":        "el adjunto está vacío o excede sus límites",
+		"unsupported_attachment":    "el tipo del adjunto no está admitido",
+		"webhook_not_found":         "webhook no encontrado",
+		"invalid_webhook":           "suscripción de webhook inválida",
+		"invalid_delivery_outcome":  "outcome debe ser succeeded o failed",
+		"admin_required":            "se requiere una API key de administrador",
+		"unbound_admin_required":    "se requiere una API key de administrador sin tenant",
+		"force_reason_required":     "se requiere un motivo para forzar un estado",
+		"sale_not_reprocessable":    "solo se pueden reprocesar las ventas rechazadas",
+		"export_jobs_disabled":      "las exportaciones en segundo plano no están configuradas",
+		"export_job_not_found":      "exportación no encontrada",
+		"export_job_not_finished":   "la exportación todavía no terminó",
+		"invalid_job_format":        "las exportaciones se escriben en ndjson o msgpack",
+		"invalid_bundle":            "paquete de configuración inválido",
+		"invalid_group_by":          "group_by debe ser status, user_id o day",
+		"tenant_not_allowed":        "la API key no puede operar en este tenant",
+	},
+}
+
+// Message returns the text for code in lang, or fallback when there is no translation.
+func Message(lang, code, fallback string) string {
+	if msg, ok := messages[lang][code]; ok {
+		return msg
+	}
+	return fallback
+}
+
+// Negotiate picks the supported language that best matches an
+// Accept-Language header value, honoring q-values. It returns
+// DefaultLanguage when nothing matches.
+func Negotiate(acceptLanguage string) string {
+	type candidate struct {
+		lang string
+		q    float64
+	}
+
+	var candidates []candidate
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		// only the primary subtag matters: es-AR and es-ES both map to es
+		primary, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if _, ok := messages[primary]; ok && q > 0 {
+			candidates = append(candidates, candidate{lang: primary, q: q})
+		}
+	}
+
+	if len(candidates) == 0 {
+		return DefaultLanguage
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	return candidates[0].lang
+}
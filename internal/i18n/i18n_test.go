@@ -0,0 +1,20 @@
+package i18n
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiate(t *testing.T) {
+	require.Equal(t, "en", Negotiate(""))
+	require.Equal(t, "es", Negotiate("es-AR,es;q=0.9,en;q=0.8"))
+	require.Equal(t, "en", Negotiate("fr-FR, es;q=0.5, en;q=0.7"))
+	require.Equal(t, "en", Negotiate("de"))
+	require.Equal(t, "en", Negotiate("es;q=0"))
+}
+
+func TestMessage(t *testing.T) {
+	require.Equal(t, "venta no encontrada", Message("es", "sale_not_found", "sale not found"))
+	require.Equal(t, "something new", Message("es", "unknown_code", "something new"))
+}
@@ -0,0 +1,59 @@
+package idgen
+
+import (
+	"crypto/rand"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/oklog/ulid/v2"
+)
+
+// Generator produces unique identifiers for new entities.
+type Generator interface {
+	NewID() string
+}
+
+// New returns the Generator registered under kind ("uuid" or "ulid").
+// An empty kind selects UUIDs.
+func New(kind string) (Generator, error) {
+	switch kind {
+	case "", "uuid":
+		return UUID(), nil
+	case "ulid":
+		return ULID(), nil
+	default:
+		return nil, fmt.Errorf("unknown ID generator %q", kind)
+	}
+}
+
+// UUID returns a Generator of random (version 4) UUIDs.
+func UUID() Generator {
+	return uuidGenerator{}
+}
+
+type uuidGenerator struct{}
+
+func (uuidGenerator) NewID() string {
+	return uuid.NewString()
+}
+
+// ULID returns a Generator of ULIDs. IDs generated by the same Generator are
+// strictly increasing, even within the same millisecond, so they sort in
+// creation order.
+func ULID() Generator {
+	return &ulidGenerator{entropy: ulid.Monotonic(rand.Reader, 0)}
+}
+
+type ulidGenerator struct {
+	mu      sync.Mutex
+	entropy *ulid.MonotonicEntropy
+}
+
+func (g *ulidGenerator) NewID() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return ulid.MustNew(ulid.Timestamp(time.Now()), g.entropy).String()
+}
@@ -0,0 +1,55 @@
+package idgen
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/oklog/ulid/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	for kind, want := range map[string]Generator{"": UUID(), "uuid": UUID()} {
+		g, err := New(kind)
+		require.NoError(t, err)
+		require.Equal(t, want, g)
+	}
+	g, err := New("ulid")
+	require.NoError(t, err)
+	require.IsType(t, &ulidGenerator{}, g)
+
+	_, err = New("snowflake")
+	require.ErrorContains(t, err, `unknown ID generator "snowflake"`)
+}
+
+func TestUUID(t *testing.T) {
+	g := UUID()
+	seen := map[string]bool{}
+	for range 100 {
+		id := g.NewID()
+		parsed, err := uuid.Parse(id)
+		require.NoError(t, err)
+		require.Equal(t, uuid.Version(4), parsed.Version())
+		require.False(t, seen[id], id)
+		seen[id] = true
+	}
+}
+
+func TestULID(t *testing.T) {
+	g := ULID()
+	prev := g.NewID()
+	sameMillisecond := 0
+	for range 1000 {
+		id := g.NewID()
+		// estrictamente crecientes, también dentro del mismo milisegundo
+		require.Greater(t, id, prev)
+
+		cur, err := ulid.ParseStrict(id)
+		require.NoError(t, err)
+		if cur.Time() == ulid.MustParse(prev).Time() {
+			sameMillisecond++
+		}
+		prev = id
+	}
+	require.Positive(t, sameMillisecond)
+}
@@ -0,0 +1,79 @@
+package leader
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Elector competes for a lease and reports whether this instance is the
+// leader. The leader renews the lease every third of its TTL; the other
+// instances retry as often, taking over once the leader stops renewing.
+type Elector struct {
+	store  Store
+	name   string
+	holder string
+	ttl    time.Duration
+	logger *zap.Logger
+
+	leader atomic.Bool
+}
+
+// NewElector creates an Elector for the lease name, held as holder, a name
+// unique to this instance.
+func NewElector(store Store, name, holder string, ttl time.Duration, logger *zap.Logger) *Elector {
+	return &Elector{store: store, name: name, holder: holder, ttl: ttl, logger: logger}
+}
+
+// IsLeader reports whether this instance held the lease at its last attempt.
+func (e *Elector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Holder returns the name this instance holds the lease as.
+func (e *Elector) Holder() string {
+	return e.holder
+}
+
+// Run competes for the lease until ctx is done, then releases it.
+func (e *Elector) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		e.attempt(ctx)
+
+		select {
+		case <-ctx.Done():
+			e.leader.Store(false)
+			// ctx ya terminó: se libera con un contexto propio
+			releaseCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+			if err := e.store.Release(releaseCtx, e.name, e.holder); err != nil {
+				e.logger.Warn("error releasing leadership", zap.Error(err))
+			}
+			cancel()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// attempt acquires or renews the lease once. When the store fails, the
+// instance stops acting as leader: it can no longer prove it holds the lease.
+func (e *Elector) attempt(ctx context.Context) {
+	held, err := e.store.Acquire(ctx, e.name, e.holder, e.ttl)
+	if err != nil {
+		e.logger.Warn("error renewing leadership", zap.String("lease", e.name), zap.Error(err))
+		held = false
+	}
+
+	if was := e.leader.Swap(held); was != held {
+		if held {
+			e.logger.Info("became leader", zap.String("lease", e.name), zap.String("holder", e.holder))
+		} else {
+			e.logger.Info("lost leadership", zap.String("lease", e.name), zap.String("holder", e.holder))
+		}
+	}
+}
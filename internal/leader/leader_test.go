@@ -0,0 +1,80 @@
+package leader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/clock"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestStores(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c := clock.NewManual(time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC))
+
+	for name, tc := range map[string]struct {
+		store   Store
+		advance func(time.Duration)
+	}{
+		"local": {NewLocalStore(c), c.Advance},
+		"redis": {NewRedisStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "sales-api:"), mr.FastForward},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			ttl := 10 * time.Second
+
+			held, err := tc.store.Acquire(ctx, "jobs", "a", ttl)
+			require.NoError(t, err)
+			require.True(t, held)
+
+			held, err = tc.store.Acquire(ctx, "jobs", "b", ttl)
+			require.NoError(t, err)
+			require.False(t, held)
+
+			// a renueva; b sigue sin poder tomarlo
+			tc.advance(6 * time.Second)
+			held, err = tc.store.Acquire(ctx, "jobs", "a", ttl)
+			require.NoError(t, err)
+			require.True(t, held)
+			tc.advance(6 * time.Second)
+			held, _ = tc.store.Acquire(ctx, "jobs", "b", ttl)
+			require.False(t, held)
+
+			// b libera sin efecto; vencido el lease de a, b lo toma
+			require.NoError(t, tc.store.Release(ctx, "jobs", "b"))
+			tc.advance(11 * time.Second)
+			held, _ = tc.store.Acquire(ctx, "jobs", "b", ttl)
+			require.True(t, held)
+
+			require.NoError(t, tc.store.Release(ctx, "jobs", "b"))
+			held, _ = tc.store.Acquire(ctx, "jobs", "a", ttl)
+			require.True(t, held)
+		})
+	}
+}
+
+func TestElector(t *testing.T) {
+	store := NewLocalStore(clock.System())
+	ctx, cancel := context.WithCancel(context.Background())
+
+	a := NewElector(store, "jobs", "a", 30*time.Millisecond, zap.NewNop())
+	b := NewElector(store, "jobs", "b", 30*time.Millisecond, zap.NewNop())
+	go a.Run(ctx)
+	require.Eventually(t, a.IsLeader, time.Second, time.Millisecond)
+
+	bctx, bcancel := context.WithCancel(context.Background())
+	defer bcancel()
+	go b.Run(bctx)
+	time.Sleep(50 * time.Millisecond)
+	require.False(t, b.IsLeader())
+
+	// al detenerse a libera el lease y b lo toma
+	cancel()
+	require.Eventually(t, b.IsLeader, time.Second, time.Millisecond)
+	require.False(t, a.IsLeader())
+}
@@ -0,0 +1,112 @@
+// Package leader elects, among the instances sharing a store, the single one
+// that runs the background jobs, through a lease the leader keeps renewing.
+package leader
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/clock"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Store keeps named leases, each held by at most one holder until it expires.
+type Store interface {
+	// Acquire takes the lease name for holder for ttl, or extends it when
+	// holder already has it. It reports whether holder holds the lease.
+	Acquire(ctx context.Context, name, holder string, ttl time.Duration) (bool, error)
+	// Release gives up the lease if holder has it.
+	Release(ctx context.Context, name, holder string) error
+}
+
+// LocalStore keeps leases in memory, so it only coordinates the goroutines
+// of a single process. It is safe for concurrent use.
+type LocalStore struct {
+	clock clock.Clock
+
+	mu     sync.Mutex
+	leases map[string]localLease
+}
+
+type localLease struct {
+	holder  string
+	expires time.Time
+}
+
+// NewLocalStore returns an empty LocalStore whose leases expire by c.
+func NewLocalStore(c clock.Clock) *LocalStore {
+	return &LocalStore{clock: c, leases: map[string]localLease{}}
+}
+
+func (s *LocalStore) Acquire(_ context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	if l, ok := s.leases[name]; ok && l.holder != holder && now.Before(l.expires) {
+		return false, nil
+	}
+	s.leases[name] = localLease{holder: holder, expires: now.Add(ttl)}
+	return true, nil
+}
+
+func (s *LocalStore) Release(_ context.Context, name, holder string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if l, ok := s.leases[name]; ok && l.holder == holder {
+		delete(s.leases, name)
+	}
+	return nil
+}
+
+// RedisStore keeps leases as Redis keys holding the holder's ID, with the
+// lease TTL as key expiry. Renewals and releases check the holder within a
+// Lua script, so an instance never extends or deletes a lease it lost.
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStore returns a Store on client, namespacing its keys with prefix.
+func NewRedisStore(client *redis.Client, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+// acquireScript sets the key when it is free and extends it when the
+// caller holds it. It returns 1 when the caller holds the lease.
+var acquireScript = redis.NewScript(`
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return 1
+end
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	return 1
+end
+return 0
+`)
+
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+func (s *RedisStore) Acquire(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	held, err := acquireScript.Run(ctx, s.client, []string{s.prefix + name}, holder, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, fmt.Errorf("error acquiring lease %s: %w", name, err)
+	}
+	return held == 1, nil
+}
+
+func (s *RedisStore) Release(ctx context.Context, name, holder string) error {
+	if err := releaseScript.Run(ctx, s.client, []string{s.prefix + name}, holder).Err(); err != nil {
+		return fmt.Errorf("error releasing lease %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+// Package lock provides short-lived exclusive locks on named resources,
+// shared by every instance using the same lease store (see package leader).
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/leader"
+)
+
+// ErrHeld is returned when another holder has the lock.
+var ErrHeld = errors.New("lock held by another holder")
+
+// Locker takes locks without waiting: a held lock fails fast with ErrHeld,
+// so the caller can report the conflict instead of queueing behind it.
+type Locker interface {
+	// Lock takes the lock key and returns the function releasing it.
+	Lock(ctx context.Context, key string) (release func(), err error)
+}
+
+// leaseLocker implements Locker as leases held under a random token, which
+// expire after ttl should the holder die before releasing them.
+type leaseLocker struct {
+	store leader.Store
+	ttl   time.Duration
+}
+
+// New returns a Locker over the leases of store. ttl must exceed the
+// longest time a lock is held.
+func New(store leader.Store, ttl time.Duration) Locker {
+	return &leaseLocker{store: store, ttl: ttl}
+}
+
+func (l *leaseLocker) Lock(ctx context.Context, key string) (func(), error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	held, err := l.store.Acquire(ctx, key, token, l.ttl)
+	if err != nil {
+		return nil, fmt.Errorf("error locking %s: %w", key, err)
+	}
+	if !held {
+		return nil, ErrHeld
+	}
+
+	return func() {
+		// se libera aunque el contexto del llamador ya haya terminado
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		// si falla, el lease vence solo al cumplirse ttl
+		_ = l.store.Release(ctx, key, token)
+	}, nil
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating lock token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,32 @@
+package lock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/clock"
+	"Ejercicio_Final-Taller_Go/internal/leader"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocker(t *testing.T) {
+	ctx := context.Background()
+	l := New(leader.NewLocalStore(clock.System()), time.Minute)
+
+	release, err := l.Lock(ctx, "sale:1")
+	require.NoError(t, err)
+
+	_, err = l.Lock(ctx, "sale:1")
+	require.ErrorIs(t, err, ErrHeld)
+
+	other, err := l.Lock(ctx, "sale:2")
+	require.NoError(t, err)
+	other()
+
+	release()
+	release, err = l.Lock(ctx, "sale:1")
+	require.NoError(t, err)
+	release()
+}
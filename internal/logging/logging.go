@@ -0,0 +1,96 @@
+// Package logging builds the zap logger of the service from its
+// configuration, so how entries are encoded and sampled is a setting
+// rather than a choice made in code.
+package logging
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// Config describes the logger to build. The zero value logs JSON, without
+// sampling, callers or stack traces.
+type Config struct {
+	// Encoding is "json", for log collectors, or "console", for people;
+	// empty means "json".
+	Encoding string
+	// SampleInitial and SampleThereafter sample repeated entries: of the
+	// entries with the same level and message logged each second, the first
+	// SampleInitial are kept and then one in SampleThereafter. A
+	// SampleInitial of 0 keeps every entry.
+	SampleInitial    int
+	SampleThereafter int
+	// Caller annotates each entry with the file and line that logged it.
+	Caller bool
+	// Stacktrace adds the stack trace to the entries of level error and above.
+	Stacktrace bool
+}
+
+// Logger is the logger shared by the whole service, with the level it logs
+// at, which can be changed while it runs.
+type Logger struct {
+	*zap.Logger
+	Level zap.AtomicLevel
+}
+
+// New returns a logger as described by cfg, logging to stderr the entries
+// at or above level, e.g. "info". It is meant to be built once, in main,
+// which syncs it on exit.
+func New(cfg Config, level string) (*Logger, error) {
+	return build(cfg, level, "stderr")
+}
+
+// Nop returns a Logger discarding every entry.
+func Nop() *Logger {
+	return &Logger{Logger: zap.NewNop(), Level: zap.NewAtomicLevel()}
+}
+
+// build is New logging to path.
+func build(cfg Config, level, path string) (*Logger, error) {
+	atomicLevel := zap.NewAtomicLevel()
+	if err := atomicLevel.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level: %w", err)
+	}
+
+	zapCfg := zap.NewProductionConfig()
+	switch cfg.Encoding {
+	case "", "json":
+	case "console":
+		zapCfg.Encoding = "console"
+		zapCfg.EncoderConfig = zap.NewDevelopmentEncoderConfig()
+	default:
+		return nil, fmt.Errorf("unknown log encoding %q", cfg.Encoding)
+	}
+
+	zapCfg.Level = atomicLevel
+	zapCfg.OutputPaths = []string{path}
+	zapCfg.DisableCaller = !cfg.Caller
+	zapCfg.DisableStacktrace = !cfg.Stacktrace
+	zapCfg.Sampling = nil
+	if cfg.SampleInitial > 0 {
+		zapCfg.Sampling = &zap.SamplingConfig{Initial: cfg.SampleInitial, Thereafter: cfg.SampleThereafter}
+	}
+	logger, err := zapCfg.Build()
+	if err != nil {
+		return nil, err
+	}
+	return &Logger{Logger: logger, Level: atomicLevel}, nil
+}
+
+type loggerKey struct{}
+
+// WithContext returns a copy of ctx carrying logger, the logger of the work
+// ctx belongs to, such as a request, with the fields describing it.
+func WithContext(ctx context.Context, logger *zap.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, or fallback if none.
+func FromContext(ctx context.Context, fallback *zap.Logger) *zap.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*zap.Logger); ok {
+		return logger
+	}
+	return fallback
+}
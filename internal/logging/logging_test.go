@@ -0,0 +1,50 @@
+package logging
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestNew(t *testing.T) {
+	logLines := func(cfg Config) []string {
+		path := filepath.Join(t.TempDir(), "log")
+		logger, err := build(cfg, "info", path)
+		require.NoError(t, err)
+		for range 5 {
+			logger.Info("sale created")
+		}
+		logger.Debug("not logged")
+		require.NoError(t, logger.Sync())
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		return strings.Split(strings.TrimSpace(string(data)), "\n")
+	}
+
+	lines := logLines(Config{})
+	require.Len(t, lines, 5)
+	require.True(t, strings.HasPrefix(lines[0], "{"))
+	require.NotContains(t, lines[0], `"caller"`)
+
+	lines = logLines(Config{Encoding: "console", Caller: true, SampleInitial: 2, SampleThereafter: 100})
+	require.Len(t, lines, 2)
+	require.False(t, strings.HasPrefix(lines[0], "{"))
+	require.Contains(t, lines[0], "logging_test.go")
+
+	_, err := New(Config{Encoding: "xml"}, "info")
+	require.Error(t, err)
+	_, err = New(Config{}, "loud")
+	require.Error(t, err)
+}
+
+func TestFromContext(t *testing.T) {
+	fallback, scoped := zap.NewNop(), zap.NewExample()
+	require.Same(t, fallback, FromContext(context.Background(), fallback))
+	require.Same(t, scoped, FromContext(WithContext(context.Background(), scoped), fallback))
+}
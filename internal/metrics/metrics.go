@@ -0,0 +1,162 @@
+// Package metrics publishes the health of the service's dependencies, as
+// counters and latency histograms, through expvar under "metrics" in
+// /debug/vars, so alerts can point at the failing dependency.
+package metrics
+
+import (
+	"expvar"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// vars holds the published metrics, keyed by name.
+var vars = expvar.NewMap("metrics")
+
+// Publish publishes v as name. A later var with the same name replaces it.
+func Publish(name string, v expvar.Var) {
+	vars.Set(name, v)
+}
+
+// LatencyBuckets are the default upper bounds of a Histogram.
+var LatencyBuckets = []time.Duration{
+	5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second,
+}
+
+// Histogram counts durations into buckets by upper bound. It is safe for
+// concurrent use.
+type Histogram struct {
+	bounds []time.Duration
+	counts []atomic.Int64 // una por cota, y la última para las que las superan
+	sum    atomic.Int64   // en nanosegundos
+}
+
+// NewHistogram returns a Histogram with the given ascending upper bounds,
+// or LatencyBuckets if there are none.
+func NewHistogram(bounds ...time.Duration) *Histogram {
+	if len(bounds) == 0 {
+		bounds = LatencyBuckets
+	}
+	return &Histogram{bounds: bounds, counts: make([]atomic.Int64, len(bounds)+1)}
+}
+
+// Observe counts d.
+func (h *Histogram) Observe(d time.Duration) {
+	i := 0
+	for i < len(h.bounds) && d > h.bounds[i] {
+		i++
+	}
+	h.counts[i].Add(1)
+	h.sum.Add(int64(d))
+}
+
+// Count returns how many durations were observed.
+func (h *Histogram) Count() int64 {
+	var n int64
+	for i := range h.counts {
+		n += h.counts[i].Load()
+	}
+	return n
+}
+
+// String renders the histogram as JSON, implementing expvar.Var. Buckets
+// are cumulative and keyed by their bound in milliseconds, as in
+// Prometheus, the last one being "+Inf".
+func (h *Histogram) String() string {
+	var b strings.Builder
+	b.WriteString(`{"buckets": {`)
+	var n int64
+	for i := range h.counts {
+		n += h.counts[i].Load()
+		bound := "+Inf"
+		if i < len(h.bounds) {
+			bound = strconv.FormatFloat(float64(h.bounds[i])/float64(time.Millisecond), 'f', -1, 64)
+		}
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%q: %d", bound, n)
+	}
+	fmt.Fprintf(&b, `}, "count": %d, "sum_ms": %g}`, n, float64(h.sum.Load())/float64(time.Millisecond))
+	return b.String()
+}
+
+// Operations times the operations of a component, in a Histogram per
+// operation, and logs the ones slower than a threshold. It is safe for
+// concurrent use and implements expvar.Var.
+type Operations struct {
+	component string
+	logger    *zap.Logger
+	slow      time.Duration
+
+	mu  sync.Mutex
+	ops map[string]*Histogram
+}
+
+// NewOperations returns the operations of component, logging on logger
+// the ones that take longer than slow. A slow of 0 logs none.
+func NewOperations(component string, logger *zap.Logger, slow time.Duration) *Operations {
+	return &Operations{component: component, logger: logger, slow: slow, ops: map[string]*Histogram{}}
+}
+
+// Start starts timing an operation op. The returned func ends it,
+// logging it with fields if it was slow, so these should describe what
+// it was asked, e.g. its filter.
+func (o *Operations) Start(op string) func(fields ...zap.Field) {
+	start := time.Now()
+	return func(fields ...zap.Field) {
+		d := time.Since(start)
+		o.Histogram(op).Observe(d)
+		if o.slow > 0 && d > o.slow {
+			o.logger.Warn("slow operation", append([]zap.Field{
+				zap.String("component", o.component),
+				zap.String("operation", op),
+				zap.Duration("duration", d),
+			}, fields...)...)
+		}
+	}
+}
+
+// Histogram returns the latencies of op.
+func (o *Operations) Histogram(op string) *Histogram {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	h, ok := o.ops[op]
+	if !ok {
+		h = NewHistogram()
+		o.ops[op] = h
+	}
+	return h
+}
+
+// String renders the histograms as JSON, keyed by operation, implementing
+// expvar.Var.
+func (o *Operations) String() string {
+	o.mu.Lock()
+	names := make([]string, 0, len(o.ops))
+	for op := range o.ops {
+		names = append(names, op)
+	}
+	o.mu.Unlock()
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("{")
+	for i, op := range names {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%q: %s", op, o.Histogram(op).String())
+	}
+	b.WriteString("}")
+	return b.String()
+}
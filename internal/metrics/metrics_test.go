@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram(10*time.Millisecond, 100*time.Millisecond)
+	h.Observe(5 * time.Millisecond)
+	h.Observe(10 * time.Millisecond)
+	h.Observe(50 * time.Millisecond)
+	h.Observe(time.Second)
+	require.Equal(t, int64(4), h.Count())
+
+	var got struct {
+		Buckets map[string]int64 `json:"buckets"`
+		Count   int64            `json:"count"`
+		SumMS   float64          `json:"sum_ms"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(h.String()), &got))
+	require.Equal(t, map[string]int64{"10": 2, "100": 3, "+Inf": 4}, got.Buckets)
+	require.Equal(t, int64(4), got.Count)
+	require.Equal(t, 1065.0, got.SumMS)
+}
+
+func TestOperations(t *testing.T) {
+	core, logs := observer.New(zap.WarnLevel)
+	ops := NewOperations("storage", zap.New(core), time.Nanosecond)
+
+	done := ops.Start("search")
+	time.Sleep(time.Millisecond)
+	done(zap.String("user_id", "a"))
+	require.Equal(t, int64(1), ops.Histogram("search").Count())
+
+	entries := logs.FilterMessage("slow operation").All()
+	require.Len(t, entries, 1)
+	require.Equal(t, "storage", entries[0].ContextMap()["component"])
+	require.Equal(t, "search", entries[0].ContextMap()["operation"])
+	require.Equal(t, "a", entries[0].ContextMap()["user_id"])
+
+	var got map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal([]byte(ops.String()), &got))
+	require.Contains(t, got, "search")
+
+	// sin umbral no se registra ninguna
+	ops = NewOperations("storage", zap.New(core), 0)
+	ops.Start("read")()
+	require.Len(t, logs.FilterMessage("slow operation").All(), 1)
+}
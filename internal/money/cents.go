@@ -0,0 +1,114 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// ErrInvalidAmount is returned when a decimal amount cannot be represented in cents.
+var ErrInvalidAmount = errors.New("invalid amount")
+
+// Cents is a monetary amount expressed as an integer number of minor units,
+// so sums and comparisons never accumulate floating point rounding errors.
+//
+// On the wire it is encoded as a decimal JSON number with two fraction
+// digits (1234 cents is 12.34), which keeps existing clients that send and
+// read float amounts working unchanged.
+type Cents int64
+
+// Parse converts a decimal string with at most two fraction digits, such as
+// "12.5" or "-3.07", into Cents without going through float64.
+func Parse(s string) (Cents, error) {
+	raw := s
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	if whole == "" || (hasFrac && frac == "") || len(frac) > 2 {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, raw)
+	}
+
+	// Pad the fraction so "12.5" reads as 1250.
+	frac += strings.Repeat("0", 2-len(frac))
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, raw)
+	}
+	minor, err := strconv.ParseInt(frac, 10, 64)
+	if err != nil || strings.ContainsAny(whole+frac, "+-") {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, raw)
+	}
+
+	if units > (1<<63-1-minor)/100 {
+		return 0, fmt.Errorf("%w: %q overflows", ErrInvalidAmount, raw)
+	}
+
+	c := Cents(units*100 + minor)
+	if negative {
+		c = -c
+	}
+	return c, nil
+}
+
+// String formats the amount as a decimal with two fraction digits.
+func (c Cents) String() string {
+	sign := ""
+	v := int64(c)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, v/100, v%100)
+}
+
+// Float64 returns the amount in major units. It is meant for logging and
+// display only; arithmetic must stay on Cents.
+func (c Cents) Float64() float64 {
+	return float64(c) / 100
+}
+
+// MarshalJSON encodes the amount as a decimal JSON number.
+func (c Cents) MarshalJSON() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// MarshalText encodes the amount as its decimal string, which is how it is
+// written in XML.
+func (c Cents) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// EncodeMsgpack encodes the amount as its decimal string, since MessagePack
+// has no exact decimal type.
+func (c Cents) EncodeMsgpack(enc *msgpack.Encoder) error {
+	return enc.EncodeString(c.String())
+}
+
+// UnmarshalJSON decodes a decimal JSON number into Cents.
+func (c *Cents) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+
+	// Extra fraction digits are accepted only when they are zeros (10.500).
+	if whole, frac, ok := strings.Cut(s, "."); ok && len(frac) > 2 {
+		if strings.Trim(frac[2:], "0") != "" {
+			return fmt.Errorf("%w: %s has more than two decimal places", ErrInvalidAmount, s)
+		}
+		s = whole + "." + frac[:2]
+	}
+
+	v, err := Parse(s)
+	if err != nil {
+		return err
+	}
+
+	*c = v
+	return nil
+}
@@ -0,0 +1,86 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Cents
+		wantErr bool
+	}{
+		{in: "12.34", want: 1234},
+		{in: "12.5", want: 1250},
+		{in: "7", want: 700},
+		{in: "-3.07", want: -307},
+		{in: "0.01", want: 1},
+		{in: "1.234", wantErr: true},
+		{in: "1.", wantErr: true},
+		{in: ".5", wantErr: true},
+		{in: "1e3", wantErr: true},
+		{in: "1.-5", wantErr: true},
+		{in: "99999999999999999999", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := Parse(tt.in)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrInvalidAmount)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCents_JSON(t *testing.T) {
+	var v struct {
+		Amount Cents `json:"amount"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(`{"amount": 0.1}`), &v))
+	require.Equal(t, Cents(10), v.Amount)
+
+	require.NoError(t, json.Unmarshal([]byte(`{"amount": 10.500}`), &v))
+	require.Equal(t, Cents(1050), v.Amount)
+
+	require.Error(t, json.Unmarshal([]byte(`{"amount": 10.555}`), &v))
+
+	out, err := json.Marshal(struct {
+		Amount Cents `json:"amount"`
+	}{Amount: 30})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"amount": 0.30}`, string(out))
+}
+
+func TestCents_Msgpack(t *testing.T) {
+	b, err := msgpack.Marshal(Cents(1234))
+	require.NoError(t, err)
+
+	var s string
+	require.NoError(t, msgpack.Unmarshal(b, &s))
+	require.Equal(t, "12.34", s)
+}
+
+func FuzzCents_UnmarshalJSON(f *testing.F) {
+	for _, seed := range []string{"12.34", "-3.07", "10.500", "null", "1e3", "NaN", "Infinity", "99999999999999999999", `"12.34"`, "0.001"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, in string) {
+		var c Cents
+		if err := json.Unmarshal([]byte(in), &c); err != nil {
+			return
+		}
+		// lo que se acepta vuelve a leerse igual
+		out, err := json.Marshal(c)
+		require.NoError(t, err)
+		var again Cents
+		require.NoError(t, json.Unmarshal(out, &again))
+		require.Equal(t, c, again)
+	})
+}
@@ -0,0 +1,81 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// ChatNotifier posts messages to an incoming-webhook URL of a chat tool.
+// Message.To is ignored: the webhook URL already identifies the channel.
+type ChatNotifier struct {
+	name string
+	http *http.Client
+
+	mu         sync.RWMutex
+	webhookURL string
+}
+
+// NewSlackNotifier creates a notifier for a Slack incoming webhook.
+func NewSlackNotifier(webhookURL string, httpClient *http.Client) *ChatNotifier {
+	return newChatNotifier("slack", webhookURL, httpClient)
+}
+
+// NewTeamsNotifier creates a notifier for a Microsoft Teams incoming webhook.
+func NewTeamsNotifier(webhookURL string, httpClient *http.Client) *ChatNotifier {
+	return newChatNotifier("teams", webhookURL, httpClient)
+}
+
+func newChatNotifier(name, webhookURL string, httpClient *http.Client) *ChatNotifier {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &ChatNotifier{name: name, webhookURL: webhookURL, http: httpClient}
+}
+
+// Name returns the chat tool the notifier posts to, "slack" or "teams".
+func (n *ChatNotifier) Name() string {
+	return n.name
+}
+
+// SetWebhookURL makes the notifier post to webhookURL from now on.
+func (n *ChatNotifier) SetWebhookURL(webhookURL string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.webhookURL = webhookURL
+}
+
+// Notify posts the subject in bold followed by the body. Both Slack and
+// Teams incoming webhooks accept a {"text": ...} payload with markdown.
+func (n *ChatNotifier) Notify(ctx context.Context, msg Message) error {
+	payload, err := json.Marshal(map[string]string{
+		"text": fmt.Sprintf("*%s*\n%s", msg.Subject, msg.Body),
+	})
+	if err != nil {
+		return err
+	}
+
+	n.mu.RLock()
+	webhookURL := n.webhookURL
+	n.mu.RUnlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("error building %s webhook request: %w", n.name, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting to %s webhook: %w", n.name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s webhook returned unexpected status: %d", n.name, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/apperrors"
+	"Ejercicio_Final-Taller_Go/internal/clock"
+	"Ejercicio_Final-Taller_Go/internal/idgen"
+	"Ejercicio_Final-Taller_Go/internal/objstore"
+)
+
+// ErrDeadLetterNotFound is returned for an unknown dead letter.
+var ErrDeadLetterNotFound = apperrors.New(apperrors.NotFound, "dead_letter_not_found", "dead letter not found")
+
+// errNotifyUnavailable wraps the failure to enqueue a replayed message.
+var errNotifyUnavailable = apperrors.New(apperrors.DependencyUnavailable, "notify_unavailable", "the notification queue cannot accept messages")
+
+// DeadLetter is a message whose deliveries all failed.
+type DeadLetter struct {
+	ID       string    `json:"id"`
+	Queue    string    `json:"queue"`
+	Message  Message   `json:"message"`
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// DeadLetters collects the messages queues gave up on, so they can be
+// inspected and replayed once the destination is back. With a bucket, dead
+// letters are also stored as "dlq/<id>.json" objects and survive restarts.
+// It is safe for concurrent use.
+type DeadLetters struct {
+	bucket objstore.Bucket
+	ids    idgen.Generator
+	clock  clock.Clock
+
+	mu      sync.Mutex
+	letters map[string]*DeadLetter
+	queues  map[string]*Queue
+}
+
+// DeadLettersOption configures optional dependencies of DeadLetters.
+type DeadLettersOption func(*DeadLetters)
+
+// WithDeadLetterClock sets the clock that dates the dead letters. Defaults
+// to the system clock.
+func WithDeadLetterClock(c clock.Clock) DeadLettersOption {
+	return func(d *DeadLetters) {
+		d.clock = c
+	}
+}
+
+// NewDeadLetters creates a dead-letter store, loading the dead letters
+// already in bucket. A nil bucket keeps them in memory only.
+func NewDeadLetters(ctx context.Context, bucket objstore.Bucket, ids idgen.Generator, opts ...DeadLettersOption) (*DeadLetters, error) {
+	d := &DeadLetters{bucket: bucket, ids: ids, clock: clock.System(), letters: map[string]*DeadLetter{}, queues: map[string]*Queue{}}
+	for _, opt := range opts {
+		opt(d)
+	}
+	if bucket == nil {
+		return d, nil
+	}
+
+	keys, err := bucket.List(ctx, "dlq/")
+	if err != nil {
+		return nil, fmt.Errorf("error loading dead letters: %w", err)
+	}
+	for _, key := range keys {
+		data, err := bucket.Get(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("error loading dead letters: %w", err)
+		}
+		l := &DeadLetter{}
+		if err := json.Unmarshal(data, l); err != nil {
+			return nil, fmt.Errorf("error decoding dead letter %s: %w", key, err)
+		}
+		d.letters[l.ID] = l
+	}
+	return d, nil
+}
+
+func deadLetterKey(id string) string {
+	return "dlq/" + id + ".json"
+}
+
+// add stores a message the queue called name gave up on.
+func (d *DeadLetters) add(name string, msg Message, err error, attempts int) error {
+	l := &DeadLetter{
+		ID:       d.ids.NewID(),
+		Queue:    name,
+		Message:  msg,
+		Error:    err.Error(),
+		Attempts: attempts,
+		FailedAt: d.clock.Now(),
+	}
+
+	if d.bucket != nil {
+		data, err := json.Marshal(l)
+		if err != nil {
+			return err
+		}
+		if err := d.bucket.Put(context.Background(), deadLetterKey(l.ID), data); err != nil {
+			return err
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.letters[l.ID] = l
+	return nil
+}
+
+// register makes q the queue dead letters of name are replayed to.
+func (d *DeadLetters) register(name string, q *Queue) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.queues[name] = q
+}
+
+// List returns every dead letter, oldest first.
+func (d *DeadLetters) List() []DeadLetter {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	letters := make([]DeadLetter, 0, len(d.letters))
+	for _, l := range d.letters {
+		letters = append(letters, *l)
+	}
+	sort.Slice(letters, func(i, j int) bool {
+		if !letters[i].FailedAt.Equal(letters[j].FailedAt) {
+			return letters[i].FailedAt.Before(letters[j].FailedAt)
+		}
+		return letters[i].ID < letters[j].ID
+	})
+	return letters
+}
+
+// Replay enqueues the dead letter id again on its queue, with a fresh set
+// of attempts, and removes it from the store. Should it fail again it comes
+// back as a new dead letter.
+// Returns ErrDeadLetterNotFound if there is no such dead letter.
+func (d *DeadLetters) Replay(ctx context.Context, id string) error {
+	d.mu.Lock()
+	l, ok := d.letters[id]
+	if !ok {
+		d.mu.Unlock()
+		return ErrDeadLetterNotFound
+	}
+	q := d.queues[l.Queue]
+	d.mu.Unlock()
+	if q == nil {
+		return fmt.Errorf("queue %q of dead letter %s is not configured", l.Queue, id)
+	}
+
+	if err := q.Enqueue(l.Message); err != nil {
+		return errNotifyUnavailable.Wrap(err)
+	}
+
+	if d.bucket != nil {
+		if err := d.bucket.Delete(ctx, deadLetterKey(id)); err != nil && !errors.Is(err, objstore.ErrNotFound) {
+			return err
+		}
+	}
+	d.mu.Lock()
+	delete(d.letters, id)
+	d.mu.Unlock()
+	return nil
+}
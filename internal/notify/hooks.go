@@ -0,0 +1,114 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/anomaly"
+	"Ejercicio_Final-Taller_Go/internal/money"
+	"Ejercicio_Final-Taller_Go/internal/sales"
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+	"Ejercicio_Final-Taller_Go/internal/user"
+
+	"go.uber.org/zap"
+)
+
+// UserDirectory resolves the contact details of a user.
+type UserDirectory interface {
+	Email(ctx context.Context, userID string) (string, error)
+}
+
+// StatusEmailHook returns a sales hook that emails the sale's user when the
+// sale is approved or rejected. The user lookup runs in the background and
+// the message is delivered through queue, so the request is never delayed.
+func StatusEmailHook(users UserDirectory, queue *Queue, logger *zap.Logger) sales.Hook {
+	return func(ctx context.Context, e sales.Event) {
+		if e.Type != sales.EventStatusChanged {
+			return
+		}
+		if _, ok := statusTemplates[e.Sale.Status]; !ok {
+			return
+		}
+
+		// keep the tenant but outlive the request
+		ctx = context.WithoutCancel(ctx)
+		go func() {
+			email, err := users.Email(ctx, e.Sale.UserID)
+			if err != nil {
+				logger.Warn("could not look up user email for notification", zap.Error(err), zap.String("sale_id", e.Sale.ID))
+				return
+			}
+			if email == "" {
+				logger.Info("user has no email, skipping notification", zap.String("sale_id", e.Sale.ID))
+				return
+			}
+
+			msg, _, err := renderStatusMessage(email, e.Sale)
+			if err != nil {
+				logger.Error("failed to render notification", zap.Error(err), zap.String("sale_id", e.Sale.ID))
+				return
+			}
+
+			if err := queue.Enqueue(msg); err != nil {
+				logger.Warn("failed to enqueue notification", zap.Error(err), zap.String("sale_id", e.Sale.ID))
+			}
+		}()
+	}
+}
+
+// VerificationEmail returns a user.VerificationSender that emails the
+// verification token to the user through queue.
+func VerificationEmail(queue *Queue) user.VerificationSender {
+	return func(_ context.Context, u *user.User, token string) error {
+		return queue.Enqueue(Message{
+			To:      u.Email,
+			Subject: "Verify your email address",
+			Body:    fmt.Sprintf("Hello,\n\nYour verification code is %s.\n\nIf you did not ask for it, you can ignore this email.\n", token),
+		})
+	}
+}
+
+// AlertHook returns an anomaly.Sender that posts alerts through queue,
+// addressed to to when queue emails them.
+func AlertHook(queue *Queue, to string, logger *zap.Logger) anomaly.Sender {
+	return func(ctx context.Context, a anomaly.Alert) {
+		msg := Message{
+			To:      to,
+			Subject: fmt.Sprintf("Sales alert: %s", strings.ReplaceAll(string(a.Kind), "_", " ")),
+			Body:    fmt.Sprintf("%s\nTenant: %s\nAt: %s", a.Message, tenant.FromContext(ctx), a.At.Format(time.RFC3339)),
+		}
+		if err := queue.Enqueue(msg); err != nil {
+			logger.Warn("failed to enqueue alert", zap.Error(err), zap.String("alert_id", a.ID))
+		}
+	}
+}
+
+// ChannelHook returns a sales hook that posts to a chat channel through
+// queue when a sale of at least threshold() is created or rejected.
+func ChannelHook(queue *Queue, threshold func() money.Cents, logger *zap.Logger) sales.Hook {
+	return func(_ context.Context, e sales.Event) {
+		if e.Sale.Amount < threshold() {
+			return
+		}
+
+		var msg Message
+		switch {
+		case e.Type == sales.EventCreated:
+			msg.Subject = fmt.Sprintf("New sale %s for %s", e.Sale.Number, e.Sale.Amount)
+		case e.Type == sales.EventStatusChanged && e.Sale.Status == sales.StatusRejected:
+			msg.Subject = fmt.Sprintf("Sale %s for %s was rejected", e.Sale.Number, e.Sale.Amount)
+		default:
+			return
+		}
+		msg.Body = fmt.Sprintf("Sale ID: %s\nUser ID: %s\nStatus: %s", e.Sale.ID, e.Sale.UserID, e.Sale.Status)
+		if e.Sale.RejectionReason != "" {
+			msg.Body += "\nReason: " + e.Sale.RejectionReason
+		}
+
+		if err := queue.Enqueue(msg); err != nil {
+			logger.Warn("failed to enqueue channel notification", zap.Error(err), zap.String("sale_id", e.Sale.ID))
+		}
+	}
+}
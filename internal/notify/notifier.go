@@ -0,0 +1,66 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+	"strings"
+
+	"Ejercicio_Final-Taller_Go/internal/redact"
+)
+
+// Message is a notification addressed to a single recipient.
+type Message struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// Notifier delivers messages through some channel (email, chat, ...).
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// SMTPNotifier sends messages as plain-text emails.
+type SMTPNotifier struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTPNotifier creates a notifier that sends mail through the SMTP server
+// at addr (host:port). Authentication is only used when username is set.
+func NewSMTPNotifier(addr, username, password, from string) *SMTPNotifier {
+	var auth smtp.Auth
+	if username != "" {
+		host, _, _ := strings.Cut(addr, ":")
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &SMTPNotifier{
+		addr: addr,
+		auth: auth,
+		from: from,
+	}
+}
+
+// Notify sends msg. net/smtp does not support contexts, so ctx is only
+// checked before dialing.
+func (n *SMTPNotifier) Notify(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", n.from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	if err := smtp.SendMail(n.addr, n.auth, n.from, []string{msg.To}, []byte(b.String())); err != nil {
+		return fmt.Errorf("error sending email to %s: %w", redact.Hash(msg.To), err)
+	}
+	return nil
+}
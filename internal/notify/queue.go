@@ -0,0 +1,139 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrQueueFull is returned by Enqueue when the delivery buffer is full.
+var ErrQueueFull = errors.New("notification queue is full")
+
+// ErrQueueClosed is returned by Enqueue after Close.
+var ErrQueueClosed = errors.New("notification queue is closed")
+
+// Queue delivers messages asynchronously through a Notifier, retrying
+// failed deliveries with exponential backoff.
+type Queue struct {
+	notifier    Notifier
+	logger      *zap.Logger
+	maxAttempts int
+	backoff     time.Duration
+
+	// dlq receives the messages dropped after maxAttempts, if set
+	dlq  *DeadLetters
+	name string
+
+	jobs chan job
+	done chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
+}
+
+type job struct {
+	msg     Message
+	attempt int
+}
+
+// QueueOption configures optional behaviour of a Queue.
+type QueueOption func(*Queue)
+
+// WithDeadLetters keeps in dlq, under the queue name name, the messages
+// dropped after maxAttempts, and lets dlq replay them to this queue.
+func WithDeadLetters(dlq *DeadLetters, name string) QueueOption {
+	return func(q *Queue) {
+		q.dlq = dlq
+		q.name = name
+		dlq.register(name, q)
+	}
+}
+
+// NewQueue starts a queue with a single delivery worker. size bounds the
+// number of buffered messages, maxAttempts the deliveries tried per message,
+// and backoff the delay before the first retry (doubled on every retry).
+func NewQueue(notifier Notifier, logger *zap.Logger, size, maxAttempts int, backoff time.Duration, opts ...QueueOption) *Queue {
+	q := &Queue{
+		notifier:    notifier,
+		logger:      logger,
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+		jobs:        make(chan job, size),
+		done:        make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(q)
+	}
+
+	q.wg.Add(1)
+	go q.work()
+	return q
+}
+
+// Enqueue schedules msg for delivery without blocking.
+func (q *Queue) Enqueue(msg Message) error {
+	select {
+	case <-q.done:
+		return ErrQueueClosed
+	default:
+	}
+
+	select {
+	case q.jobs <- job{msg: msg, attempt: 1}:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Close stops the worker. Messages still buffered or waiting for a retry are dropped.
+func (q *Queue) Close() {
+	q.once.Do(func() { close(q.done) })
+	q.wg.Wait()
+}
+
+func (q *Queue) work() {
+	defer q.wg.Done()
+
+	for {
+		select {
+		case <-q.done:
+			return
+		case j := <-q.jobs:
+			q.deliver(j)
+		}
+	}
+}
+
+func (q *Queue) deliver(j job) {
+	err := q.notifier.Notify(context.Background(), j.msg)
+	if err == nil {
+		return
+	}
+
+	if j.attempt >= q.maxAttempts {
+		if q.dlq == nil {
+			q.logger.Error("notification dropped after max attempts", zap.Error(err), zap.Int("attempts", j.attempt))
+			return
+		}
+		if dlqErr := q.dlq.add(q.name, j.msg, err, j.attempt); dlqErr != nil {
+			q.logger.Error("notification dropped, dead letter not stored", zap.Error(err), zap.NamedError("dlq_error", dlqErr), zap.Int("attempts", j.attempt))
+			return
+		}
+		q.logger.Error("notification moved to dead-letter queue after max attempts", zap.Error(err), zap.String("queue", q.name), zap.Int("attempts", j.attempt))
+		return
+	}
+
+	delay := q.backoff << (j.attempt - 1)
+	q.logger.Warn("notification failed, retrying", zap.Error(err), zap.Int("attempt", j.attempt), zap.Duration("retry_in", delay))
+
+	j.attempt++
+	time.AfterFunc(delay, func() {
+		select {
+		case q.jobs <- j:
+		case <-q.done:
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/clock"
+	"Ejercicio_Final-Taller_Go/internal/idgen"
+	"Ejercicio_Final-Taller_Go/internal/objstore"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type flakyNotifier struct {
+	mu        sync.Mutex
+	failures  int
+	delivered []Message
+}
+
+func (f *flakyNotifier) Notify(_ context.Context, msg Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("smtp unavailable")
+	}
+	f.delivered = append(f.delivered, msg)
+	return nil
+}
+
+func (f *flakyNotifier) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.delivered)
+}
+
+func TestQueue_RetriesUntilDelivered(t *testing.T) {
+	n := &flakyNotifier{failures: 2}
+	q := NewQueue(n, zap.NewNop(), 10, 3, time.Millisecond)
+	defer q.Close()
+
+	require.NoError(t, q.Enqueue(Message{To: "chiche@example.com", Subject: "hi"}))
+	require.Eventually(t, func() bool { return n.count() == 1 }, time.Second, time.Millisecond)
+}
+
+func TestQueue_DropsAfterMaxAttempts(t *testing.T) {
+	n := &flakyNotifier{failures: 5}
+	q := NewQueue(n, zap.NewNop(), 10, 2, time.Millisecond)
+
+	require.NoError(t, q.Enqueue(Message{To: "chiche@example.com"}))
+	time.Sleep(20 * time.Millisecond)
+	q.Close()
+
+	require.Equal(t, 0, n.count())
+	require.ErrorIs(t, q.Enqueue(Message{}), ErrQueueClosed)
+}
+
+func TestQueue_DeadLettersAndReplay(t *testing.T) {
+	ctx := context.Background()
+	bucket := objstore.Dir(t.TempDir())
+	failedAt := time.Date(2024, 3, 10, 15, 0, 0, 0, time.UTC)
+	dlq, err := NewDeadLetters(ctx, bucket, idgen.UUID(), WithDeadLetterClock(clock.NewManual(failedAt)))
+	require.NoError(t, err)
+
+	n := &flakyNotifier{failures: 2}
+	q := NewQueue(n, zap.NewNop(), 10, 2, time.Millisecond, WithDeadLetters(dlq, "slack"))
+	defer q.Close()
+
+	require.NoError(t, q.Enqueue(Message{Subject: "sale rejected"}))
+	require.Eventually(t, func() bool { return len(dlq.List()) == 1 }, time.Second, time.Millisecond)
+
+	letter := dlq.List()[0]
+	require.Equal(t, "slack", letter.Queue)
+	require.Equal(t, 2, letter.Attempts)
+	require.Equal(t, "smtp unavailable", letter.Error)
+	require.Equal(t, failedAt, letter.FailedAt)
+
+	// tras un reinicio los mensajes fallidos siguen ahí
+	reloaded, err := NewDeadLetters(ctx, bucket, idgen.UUID())
+	require.NoError(t, err)
+	require.Len(t, reloaded.List(), 1)
+	require.Equal(t, letter.ID, reloaded.List()[0].ID)
+	require.True(t, letter.FailedAt.Equal(reloaded.List()[0].FailedAt))
+
+	require.NoError(t, dlq.Replay(ctx, letter.ID))
+	require.Eventually(t, func() bool { return n.count() == 1 }, time.Second, time.Millisecond)
+	require.Empty(t, dlq.List())
+	require.ErrorIs(t, dlq.Replay(ctx, letter.ID), ErrDeadLetterNotFound)
+
+	keys, err := bucket.List(ctx, "dlq/")
+	require.NoError(t, err)
+	require.Empty(t, keys)
+}
@@ -0,0 +1,57 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"Ejercicio_Final-Taller_Go/internal/sales"
+)
+
+// statusTemplate holds the subject and body templates for one sale status.
+type statusTemplate struct {
+	subject *template.Template
+	body    *template.Template
+}
+
+// statusTemplates are rendered with the sale as data.
+var statusTemplates = map[sales.SaleStatus]statusTemplate{
+	sales.StatusApproved: {
+		subject: template.Must(template.New("approved_subject").Parse(`Your purchase {{.Number}} was approved`)),
+		body: template.Must(template.New("approved_body").Parse(`Hello,
+
+Your purchase {{.Number}} for {{.Amount}} has been approved.
+
+Thank you for your purchase.
+`)),
+	},
+	sales.StatusRejected: {
+		subject: template.Must(template.New("rejected_subject").Parse(`Your purchase {{.Number}} was rejected`)),
+		body: template.Must(template.New("rejected_body").Parse(`Hello,
+
+Unfortunately your purchase {{.Number}} for {{.Amount}} has been rejected.
+{{- with .RejectionReason}} Reason: {{.}}.{{end}}
+
+Please contact support if you have any questions.
+`)),
+	},
+}
+
+// renderStatusMessage builds the email sent to to when sale reaches its
+// current status. ok is false when there is no template for that status.
+func renderStatusMessage(to string, sale sales.Sale) (msg Message, ok bool, err error) {
+	tmpl, ok := statusTemplates[sale.Status]
+	if !ok {
+		return Message{}, false, nil
+	}
+
+	var subject, body strings.Builder
+	if err := tmpl.subject.Execute(&subject, sale); err != nil {
+		return Message{}, true, fmt.Errorf("error rendering subject: %w", err)
+	}
+	if err := tmpl.body.Execute(&body, sale); err != nil {
+		return Message{}, true, fmt.Errorf("error rendering body: %w", err)
+	}
+
+	return Message{To: to, Subject: subject.String(), Body: body.String()}, true, nil
+}
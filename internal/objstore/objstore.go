@@ -0,0 +1,119 @@
+// Package objstore stores opaque objects by key, on the local filesystem or
+// in an S3 bucket, for data that leaves the primary stores (archives, exports).
+package objstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrNotFound is returned when the bucket holds no object with the given key.
+var ErrNotFound = errors.New("object not found")
+
+// Bucket stores objects under slash-separated keys such as "sales/acme/1.json".
+type Bucket interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+	// List returns the keys starting with prefix, sorted.
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// dirBucket keeps every object as a file below root.
+type dirBucket struct {
+	root string
+}
+
+// Dir returns a Bucket storing objects as files below the directory root,
+// which is created on the first write.
+func Dir(root string) Bucket {
+	return dirBucket{root: root}
+}
+
+// path maps key to its file, refusing keys that would escape root.
+func (d dirBucket) path(key string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(key))
+	if clean == "." || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+	return filepath.Join(d.root, clean), nil
+}
+
+func (d dirBucket) Put(_ context.Context, key string, data []byte) error {
+	path, err := d.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("error creating directory for %s: %w", key, err)
+	}
+
+	// se escribe a un temporal y se renombra para no dejar objetos a medias
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("error writing %s: %w", key, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("error writing %s: %w", key, err)
+	}
+	return nil
+}
+
+func (d dirBucket) Get(_ context.Context, key string) ([]byte, error) {
+	path, err := d.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", key, err)
+	}
+	return data, nil
+}
+
+func (d dirBucket) Delete(_ context.Context, key string) error {
+	path, err := d.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("error deleting %s: %w", key, err)
+	}
+	return nil
+}
+
+func (d dirBucket) List(_ context.Context, prefix string) ([]string, error) {
+	var keys []string
+	err := filepath.WalkDir(d.root, func(path string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil || entry.IsDir() || strings.HasSuffix(path, ".tmp") {
+			return err
+		}
+
+		rel, err := filepath.Rel(d.root, path)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing %s: %w", prefix, err)
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
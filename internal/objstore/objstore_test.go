@@ -0,0 +1,101 @@
+package objstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"Ejercicio_Final-Taller_Go/internal/awsauth"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3 serves the subset of the S3 REST API the bucket uses, path-style.
+func fakeS3(t *testing.T) *httptest.Server {
+	var mu sync.Mutex
+	objects := map[string][]byte{}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Contains(t, r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/")
+		require.NotEmpty(t, r.Header.Get("X-Amz-Content-Sha256"))
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		key := strings.TrimPrefix(r.URL.Path, "/archive/")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+			var keys []string
+			for k := range objects {
+				if strings.HasPrefix(k, r.URL.Query().Get("prefix")) {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			fmt.Fprint(w, "<ListBucketResult>")
+			for _, k := range keys {
+				fmt.Fprintf(w, "<Contents><Key>%s</Key></Contents>", k)
+			}
+			fmt.Fprint(w, "<IsTruncated>false</IsTruncated></ListBucketResult>")
+		case r.Method == http.MethodPut:
+			objects[key], _ = io.ReadAll(r.Body)
+		case r.Method == http.MethodGet:
+			data, ok := objects[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(data)
+		case r.Method == http.MethodDelete:
+			delete(objects, key)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+}
+
+func TestBuckets(t *testing.T) {
+	s3 := fakeS3(t)
+	defer s3.Close()
+
+	creds := awsauth.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}
+	for name, b := range map[string]Bucket{
+		"dir": Dir(t.TempDir()),
+		"s3":  S3("archive", "us-east-1", s3.URL, creds, nil),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			keys, err := b.List(ctx, "sales/")
+			require.NoError(t, err)
+			require.Empty(t, keys)
+
+			require.NoError(t, b.Put(ctx, "sales/acme/2.json", []byte("two")))
+			require.NoError(t, b.Put(ctx, "sales/acme/1.json", []byte("one")))
+			require.NoError(t, b.Put(ctx, "users/acme/1.json", []byte("user")))
+
+			data, err := b.Get(ctx, "sales/acme/1.json")
+			require.NoError(t, err)
+			require.Equal(t, "one", string(data))
+
+			keys, err = b.List(ctx, "sales/")
+			require.NoError(t, err)
+			require.Equal(t, []string{"sales/acme/1.json", "sales/acme/2.json"}, keys)
+
+			require.NoError(t, b.Delete(ctx, "sales/acme/1.json"))
+			require.NoError(t, b.Delete(ctx, "sales/acme/1.json"))
+			_, err = b.Get(ctx, "sales/acme/1.json")
+			require.ErrorIs(t, err, ErrNotFound)
+		})
+	}
+}
+
+func TestDirRejectsEscapingKeys(t *testing.T) {
+	err := Dir(t.TempDir()).Put(context.Background(), "../outside", []byte("x"))
+	require.Error(t, err)
+}
@@ -0,0 +1,156 @@
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/awsauth"
+)
+
+// s3Bucket stores objects in an S3 bucket through its REST API.
+type s3Bucket struct {
+	base   string // URL of the bucket, without trailing slash
+	region string
+	creds  awsauth.Credentials
+	http   *http.Client
+}
+
+// S3 returns a Bucket backed by the S3 bucket named bucket in region. An
+// empty endpoint uses AWS; otherwise the bucket is addressed path-style
+// below endpoint, as S3-compatible servers such as MinIO expect. A nil
+// httpClient uses http.DefaultClient.
+func S3(bucket, region, endpoint string, creds awsauth.Credentials, httpClient *http.Client) Bucket {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	base := fmt.Sprintf("https://%s.s3.%s.amazonaws.com", bucket, region)
+	if endpoint != "" {
+		base = strings.TrimSuffix(endpoint, "/") + "/" + bucket
+	}
+	return &s3Bucket{base: base, region: region, creds: creds, http: httpClient}
+}
+
+// objectURL returns the URL of key, escaping each of its segments.
+func (b *s3Bucket) objectURL(key string) string {
+	segments := strings.Split(key, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return b.base + "/" + strings.Join(segments, "/")
+}
+
+// do signs and sends a request, returning the response when its status is
+// one of ok. Other statuses are turned into errors, 404 into ErrNotFound.
+func (b *s3Bucket) do(ctx context.Context, method, rawURL string, body []byte, ok ...int) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error building S3 request: %w", err)
+	}
+	awsauth.Sign(req, body, b.creds, b.region, "s3", time.Now())
+
+	resp, err := b.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error making request to S3: %w", err)
+	}
+	for _, status := range ok {
+		if resp.StatusCode == status {
+			return resp, nil
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return nil, fmt.Errorf("S3 returned unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+}
+
+func (b *s3Bucket) Put(ctx context.Context, key string, data []byte) error {
+	resp, err := b.do(ctx, http.MethodPut, b.objectURL(key), data, http.StatusOK)
+	if err != nil {
+		return fmt.Errorf("error writing %s: %w", key, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (b *s3Bucket) Get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := b.do(ctx, http.MethodGet, b.objectURL(key), nil, http.StatusOK)
+	if err == ErrNotFound {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", key, err)
+	}
+	return data, nil
+}
+
+func (b *s3Bucket) Delete(ctx context.Context, key string) error {
+	// S3 reports 204 whether or not the object existed
+	resp, err := b.do(ctx, http.MethodDelete, b.objectURL(key), nil, http.StatusNoContent, http.StatusOK)
+	if err != nil {
+		return fmt.Errorf("error deleting %s: %w", key, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// List pages through ListObjectsV2, which returns keys in ascending order.
+func (b *s3Bucket) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		q := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+
+		resp, err := b.do(ctx, http.MethodGet, b.base+"/?"+q.Encode(), nil, http.StatusOK)
+		if err != nil {
+			return nil, fmt.Errorf("error listing %s: %w", prefix, err)
+		}
+
+		var page struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error decoding S3 listing: %w", err)
+		}
+
+		for _, c := range page.Contents {
+			keys = append(keys, c.Key)
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// GCS returns a Bucket backed by the Google Cloud Storage bucket named
+// bucket, through its S3-compatible XML API. creds are an HMAC key of a
+// service account (access ID and secret), which GCS accepts in SigV4
+// signatures. A nil httpClient uses http.DefaultClient.
+func GCS(bucket string, creds awsauth.Credentials, httpClient *http.Client) Bucket {
+	return S3(bucket, "auto", "https://storage.googleapis.com", creds, httpClient)
+}
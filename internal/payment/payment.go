@@ -0,0 +1,103 @@
+// Package payment reserves and captures the payment of sales.
+package payment
+
+import (
+	"context"
+	"sync"
+
+	"Ejercicio_Final-Taller_Go/internal/apperrors"
+	"Ejercicio_Final-Taller_Go/internal/idgen"
+	"Ejercicio_Final-Taller_Go/internal/money"
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+)
+
+// ErrReservationNotFound is returned for an unknown reservation ID.
+var ErrReservationNotFound = apperrors.New(apperrors.NotFound, "reservation_not_found", "payment reservation not found")
+
+// ErrReservationReleased is returned when capturing a released reservation.
+var ErrReservationReleased = apperrors.New(apperrors.Conflict, "reservation_released", "payment reservation was released")
+
+// Provider holds funds for a sale until the sale is confirmed. Release
+// gives back the funds of a reservation, refunding them if it was already
+// captured; releasing twice is not an error.
+type Provider interface {
+	Reserve(ctx context.Context, saleID string, amount money.Cents) (string, error)
+	Capture(ctx context.Context, reservationID string) error
+	Release(ctx context.Context, reservationID string) error
+}
+
+// Reservation is a hold on the funds of a sale.
+type Reservation struct {
+	ID       string
+	SaleID   string
+	Amount   money.Cents
+	Captured bool
+	Released bool
+}
+
+// Local is an in-memory Provider that accepts every reservation, for
+// development and tests. It is safe for concurrent use.
+type Local struct {
+	ids idgen.Generator
+
+	mu           sync.Mutex
+	reservations map[string]*Reservation // tenant + ID -> reservation
+}
+
+// NewLocal creates an empty Local provider.
+func NewLocal(ids idgen.Generator) *Local {
+	return &Local{ids: ids, reservations: map[string]*Reservation{}}
+}
+
+func (l *Local) Reserve(ctx context.Context, saleID string, amount money.Cents) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	r := &Reservation{ID: l.ids.NewID(), SaleID: saleID, Amount: amount}
+	l.reservations[key(ctx, r.ID)] = r
+	return r.ID, nil
+}
+
+func (l *Local) Capture(ctx context.Context, reservationID string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	r, ok := l.reservations[key(ctx, reservationID)]
+	if !ok {
+		return ErrReservationNotFound
+	}
+	if r.Released {
+		return ErrReservationReleased
+	}
+	r.Captured = true
+	return nil
+}
+
+func (l *Local) Release(ctx context.Context, reservationID string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	r, ok := l.reservations[key(ctx, reservationID)]
+	if !ok {
+		return ErrReservationNotFound
+	}
+	r.Released = true
+	return nil
+}
+
+// Get returns a copy of the reservation with the given ID.
+func (l *Local) Get(ctx context.Context, reservationID string) (Reservation, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	r, ok := l.reservations[key(ctx, reservationID)]
+	if !ok {
+		return Reservation{}, ErrReservationNotFound
+	}
+	return *r, nil
+}
+
+// key scopes a reservation ID to the tenant in ctx.
+func key(ctx context.Context, id string) string {
+	return tenant.FromContext(ctx) + "/" + id
+}
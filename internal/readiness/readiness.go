@@ -0,0 +1,62 @@
+// Package readiness waits for the dependencies of the API to be reachable
+// before it starts accepting traffic.
+package readiness
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// attemptTimeout bounds a single probe, so a hung dependency counts as a failed attempt.
+const attemptTimeout = 2 * time.Second
+
+// Check is a named probe of a dependency. Probe returns nil when it is reachable.
+type Check struct {
+	Name  string
+	Probe func(ctx context.Context) error
+}
+
+// Wait runs every check in order, retrying each one up to attempts times with
+// an exponential backoff starting at backoff. It returns an error naming the
+// first check that is still failing after its last attempt, or ctx.Err() if
+// ctx ends first.
+func Wait(ctx context.Context, logger *zap.Logger, attempts int, backoff time.Duration, checks ...Check) error {
+	for _, check := range checks {
+		if err := wait(ctx, logger, attempts, backoff, check); err != nil {
+			return err
+		}
+		logger.Info("dependency ready", zap.String("dependency", check.Name))
+	}
+	return nil
+}
+
+func wait(ctx context.Context, logger *zap.Logger, attempts int, backoff time.Duration, check Check) error {
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		probeCtx, cancel := context.WithTimeout(ctx, attemptTimeout)
+		err = check.Probe(probeCtx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+
+		logger.Warn("dependency not ready",
+			zap.String("dependency", check.Name),
+			zap.Int("attempt", attempt),
+			zap.Error(err),
+		)
+		if attempt == attempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff << (attempt - 1)):
+		}
+	}
+	return fmt.Errorf("%s not ready after %d attempts: %w", check.Name, attempts, err)
+}
@@ -0,0 +1,32 @@
+package readiness
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestWait(t *testing.T) {
+	ctx := context.Background()
+	errDown := errors.New("connection refused")
+
+	calls := 0
+	flaky := Check{Name: "flaky", Probe: func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return errDown
+		}
+		return nil
+	}}
+	require.NoError(t, Wait(ctx, zap.NewNop(), 3, time.Millisecond, flaky))
+	require.Equal(t, 3, calls)
+
+	down := Check{Name: "user API", Probe: func(context.Context) error { return errDown }}
+	err := Wait(ctx, zap.NewNop(), 2, time.Millisecond, down)
+	require.ErrorIs(t, err, errDown)
+	require.Contains(t, err.Error(), "user API not ready after 2 attempts")
+}
@@ -0,0 +1,48 @@
+// Package redact masks personal data before it reaches the logs.
+//
+// Domain types implement zapcore.ObjectMarshaler with these helpers, so
+// logging them with zap.Any or zap.Object never dumps names, addresses or
+// emails in clear. Reveal turns masking off for local debugging.
+package redact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+var revealed atomic.Bool
+
+// Reveal turns masking off (true) or back on (false) process-wide.
+// It is meant for local development only.
+func Reveal(on bool) {
+	revealed.Store(on)
+}
+
+// Mask keeps only the first character of s, e.g. "Ayrton" -> "A*****".
+func Mask(s string) string {
+	if revealed.Load() || s == "" {
+		return s
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	n := utf8.RuneCountInString(s[size:])
+	if n > 8 {
+		n = 8
+	}
+	masked := string(r)
+	for i := 0; i < n; i++ {
+		masked += "*"
+	}
+	return masked
+}
+
+// Hash replaces s with a short stable digest, so log lines about the same
+// value can still be correlated without exposing it.
+func Hash(s string) string {
+	if revealed.Load() || s == "" {
+		return s
+	}
+	sum := sha256.Sum256([]byte(s))
+	return "sha256:" + hex.EncodeToString(sum[:6])
+}
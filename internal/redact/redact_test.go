@@ -0,0 +1,22 @@
+package redact
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaskAndHash(t *testing.T) {
+	require.Equal(t, "A*****", Mask("Ayrton"))
+	require.Equal(t, "Ñ***", Mask("Ñoño"))
+	require.Equal(t, "", Mask(""))
+
+	h := Hash("ayrton@example.com")
+	require.Equal(t, h, Hash("ayrton@example.com"))
+	require.NotContains(t, h, "ayrton")
+
+	Reveal(true)
+	defer Reveal(false)
+	require.Equal(t, "Ayrton", Mask("Ayrton"))
+	require.Equal(t, "ayrton@example.com", Hash("ayrton@example.com"))
+}
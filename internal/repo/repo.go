@@ -0,0 +1,277 @@
+// Package repo provides the in-memory, tenant-partitioned storage shared by
+// the entities of the API. Entity packages wrap a Repository with their own
+// errors and add the queries specific to them.
+package repo
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+)
+
+// Identifiable is an entity stored under its own ID.
+type Identifiable interface {
+	EntityID() string
+}
+
+// Index is a unique secondary index: Key returns the value an entity is
+// found by through ReadBy, or "" to leave it out of the index.
+type Index[T Identifiable] struct {
+	Name string
+	Key  func(T) string
+}
+
+// Repository stores entities in memory, partitioned by the tenant carried
+// by ctx (see package tenant). It is safe for concurrent use. Entities are
+// stored as given, so callers must not modify them after Set.
+type Repository[T Identifiable] struct {
+	notFound error
+	emptyID  error
+	indexes  []Index[T]
+
+	mu      sync.RWMutex
+	tenants map[string]*partition[T]
+}
+
+// partition holds the entities of a single tenant.
+type partition[T Identifiable] struct {
+	items   map[string]T
+	indexes map[string]map[string]string // index name -> key -> ID
+	// keys are the index keys each ID was stored with, kept apart since
+	// callers may change a stored entity before setting it again.
+	keys map[string][]string
+}
+
+// New creates an empty Repository that returns notFound for missing
+// entities and emptyID for entities without an ID.
+func New[T Identifiable](notFound, emptyID error, indexes ...Index[T]) *Repository[T] {
+	return &Repository[T]{
+		notFound: notFound,
+		emptyID:  emptyID,
+		indexes:  indexes,
+		tenants:  map[string]*partition[T]{},
+	}
+}
+
+// partition returns the partition of the tenant in ctx, or nil if that
+// tenant has no data yet. Callers must hold r.mu.
+func (r *Repository[T]) partition(ctx context.Context) *partition[T] {
+	return r.tenants[tenant.FromContext(ctx)]
+}
+
+// writablePartition is like partition but creates the partition when
+// missing. Callers must hold r.mu for writing.
+func (r *Repository[T]) writablePartition(ctx context.Context) *partition[T] {
+	id := tenant.FromContext(ctx)
+	p, ok := r.tenants[id]
+	if !ok {
+		p = &partition[T]{items: map[string]T{}, indexes: map[string]map[string]string{}, keys: map[string][]string{}}
+		for _, idx := range r.indexes {
+			p.indexes[idx.Name] = map[string]string{}
+		}
+		r.tenants[id] = p
+	}
+	return p
+}
+
+// Set stores or replaces v. Returns the emptyID error if v has no ID.
+func (r *Repository[T]) Set(ctx context.Context, v T) error {
+	id := v.EntityID()
+	if id == "" {
+		return r.emptyID
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p := r.writablePartition(ctx)
+	p.unindex(r.indexes, id)
+	p.items[id] = v
+	keys := make([]string, len(r.indexes))
+	for i, idx := range r.indexes {
+		if keys[i] = idx.Key(v); keys[i] != "" {
+			p.indexes[idx.Name][keys[i]] = id
+		}
+	}
+	p.keys[id] = keys
+	return nil
+}
+
+// unindex removes the index entries of the entity with the given ID.
+func (p *partition[T]) unindex(indexes []Index[T], id string) {
+	for i, key := range p.keys[id] {
+		if name := indexes[i].Name; key != "" && p.indexes[name][key] == id {
+			delete(p.indexes[name], key)
+		}
+	}
+	delete(p.keys, id)
+}
+
+// Read returns the entity with the given ID, or the notFound error.
+func (r *Repository[T]) Read(ctx context.Context, id string) (T, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var zero T
+	p := r.partition(ctx)
+	if p == nil {
+		return zero, r.notFound
+	}
+	v, ok := p.items[id]
+	if !ok {
+		return zero, r.notFound
+	}
+	return v, nil
+}
+
+// ReadBy returns the entity whose key in the named index is key, or the
+// notFound error.
+func (r *Repository[T]) ReadBy(ctx context.Context, index, key string) (T, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var zero T
+	p := r.partition(ctx)
+	if p == nil {
+		return zero, r.notFound
+	}
+	id, ok := p.indexes[index][key]
+	if !ok {
+		return zero, r.notFound
+	}
+	return p.items[id], nil
+}
+
+// Delete removes the entity with the given ID. Returns the notFound error
+// if there is none.
+func (r *Repository[T]) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p := r.partition(ctx)
+	if p == nil {
+		return r.notFound
+	}
+	if _, ok := p.items[id]; !ok {
+		return r.notFound
+	}
+	p.unindex(r.indexes, id)
+	delete(p.items, id)
+	return nil
+}
+
+// List returns every entity of the tenant, in no particular order.
+func (r *Repository[T]) List(ctx context.Context) ([]T, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	p := r.partition(ctx)
+	if p == nil {
+		return []T{}, nil
+	}
+	items := make([]T, 0, len(p.items))
+	for _, v := range p.items {
+		items = append(items, v)
+	}
+	return items, nil
+}
+
+// Range calls fn for every entity of the tenant, in no particular order,
+// while holding the read lock; fn must be fast and must not write to r.
+func (r *Repository[T]) Range(ctx context.Context, fn func(T)) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if p := r.partition(ctx); p != nil {
+		for _, v := range p.items {
+			fn(v)
+		}
+	}
+}
+
+// Iterate calls fn for every entity of the tenant until fn returns an
+// error, which is then returned. The lock is not held while fn runs, so a
+// slow consumer does not block writers; entities stored during the
+// iteration may not be visited. It also stops with ctx.Err() once ctx is done.
+func (r *Repository[T]) Iterate(ctx context.Context, fn func(T) error) error {
+	r.mu.RLock()
+	p := r.partition(ctx)
+	if p == nil {
+		r.mu.RUnlock()
+		return nil
+	}
+	ids := make([]string, 0, len(p.items))
+	for id := range p.items {
+		ids = append(ids, id)
+	}
+	r.mu.RUnlock()
+
+	return r.visit(ctx, p, ids, fn)
+}
+
+// IterateOrdered is like Iterate but calls fn in the order given by less
+// over the entities as they were when it was called. Only their IDs are
+// kept meanwhile, so memory does not grow with their size.
+func (r *Repository[T]) IterateOrdered(ctx context.Context, less func(a, b T) bool, fn func(T) error) error {
+	r.mu.RLock()
+	p := r.partition(ctx)
+	if p == nil {
+		r.mu.RUnlock()
+		return nil
+	}
+	ids := make([]string, 0, len(p.items))
+	for id := range p.items {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return less(p.items[ids[i]], p.items[ids[j]])
+	})
+	r.mu.RUnlock()
+
+	return r.visit(ctx, p, ids, fn)
+}
+
+// visit calls fn for the entities of p with the given IDs that are still
+// stored, in that order, reading each one under the lock.
+func (r *Repository[T]) visit(ctx context.Context, p *partition[T], ids []string, fn func(T) error) error {
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		r.mu.RLock()
+		v, ok := p.items[id]
+		r.mu.RUnlock()
+		if !ok {
+			continue
+		}
+
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Tenants returns the tenants that have stored entities, sorted. It is the
+// only operation not scoped to the tenant of ctx.
+func (r *Repository[T]) Tenants(ctx context.Context) ([]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ids := make([]string, 0, len(r.tenants))
+	for id, p := range r.tenants {
+		if len(p.items) > 0 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Ping reports whether the storage is reachable. The in-memory storage always is.
+func (r *Repository[T]) Ping(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,124 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	errNotFound = errors.New("not found")
+	errEmptyID  = errors.New("empty ID")
+)
+
+type thing struct {
+	ID   string
+	Code string
+}
+
+func (t *thing) EntityID() string {
+	return t.ID
+}
+
+func newThings() *Repository[*thing] {
+	return New(errNotFound, errEmptyID, Index[*thing]{Name: "code", Key: func(t *thing) string { return t.Code }})
+}
+
+func TestRepository_Tenants(t *testing.T) {
+	r := newThings()
+	acme := tenant.WithID(context.Background(), "acme")
+	globex := tenant.WithID(context.Background(), "globex")
+
+	require.ErrorIs(t, r.Set(acme, &thing{}), errEmptyID)
+	require.NoError(t, r.Set(acme, &thing{ID: "1"}))
+
+	_, err := r.Read(globex, "1")
+	require.ErrorIs(t, err, errNotFound)
+	require.ErrorIs(t, r.Delete(globex, "1"), errNotFound)
+
+	got, err := r.Read(acme, "1")
+	require.NoError(t, err)
+	require.Equal(t, "1", got.ID)
+
+	list, err := r.List(globex)
+	require.NoError(t, err)
+	require.Empty(t, list)
+	require.NotNil(t, list)
+
+	require.NoError(t, r.Set(globex, &thing{ID: "2"}))
+	tenants, err := r.Tenants(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"acme", "globex"}, tenants)
+
+	require.NoError(t, r.Delete(globex, "2"))
+	tenants, err = r.Tenants(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"acme"}, tenants)
+}
+
+func TestRepository_Index(t *testing.T) {
+	r := newThings()
+	ctx := context.Background()
+
+	v := &thing{ID: "1", Code: "a"}
+	require.NoError(t, r.Set(ctx, v))
+	got, err := r.ReadBy(ctx, "code", "a")
+	require.NoError(t, err)
+	require.Same(t, v, got)
+
+	// el índice sigue a la entidad aunque se modifique el mismo puntero
+	v.Code = "b"
+	require.NoError(t, r.Set(ctx, v))
+	_, err = r.ReadBy(ctx, "code", "a")
+	require.ErrorIs(t, err, errNotFound)
+	got, err = r.ReadBy(ctx, "code", "b")
+	require.NoError(t, err)
+	require.Same(t, v, got)
+
+	require.NoError(t, r.Delete(ctx, "1"))
+	_, err = r.ReadBy(ctx, "code", "b")
+	require.ErrorIs(t, err, errNotFound)
+}
+
+func TestRepository_Iterate(t *testing.T) {
+	r := newThings()
+	ctx := context.Background()
+	for _, id := range []string{"1", "2", "3"} {
+		require.NoError(t, r.Set(ctx, &thing{ID: id}))
+	}
+
+	seen := 0
+	require.NoError(t, r.Iterate(ctx, func(*thing) error {
+		// escribir durante la iteración no bloquea
+		seen++
+		return r.Set(ctx, &thing{ID: "new"})
+	}))
+	require.Equal(t, 3, seen)
+
+	stop := errors.New("stop")
+	require.ErrorIs(t, r.Iterate(ctx, func(*thing) error { return stop }), stop)
+}
+
+func TestRepository_IterateOrdered(t *testing.T) {
+	r := newThings()
+	ctx := context.Background()
+	for _, id := range []string{"2", "3", "1"} {
+		require.NoError(t, r.Set(ctx, &thing{ID: id}))
+	}
+
+	var seen []string
+	byID := func(a, b *thing) bool { return a.ID < b.ID }
+	require.NoError(t, r.IterateOrdered(ctx, byID, func(v *thing) error {
+		seen = append(seen, v.ID)
+		if v.ID == "1" {
+			// las borradas durante la iteración se saltean
+			return r.Delete(ctx, "2")
+		}
+		return nil
+	}))
+	require.Equal(t, []string{"1", "3"}, seen)
+}
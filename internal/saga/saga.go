@@ -0,0 +1,309 @@
+// Package saga coordinates flows that span several services, none of which
+// can take part in a shared transaction. A saga runs its steps in order and
+// persists their outcome after each one; when a step fails, the steps that
+// already completed are undone by their compensations, last first.
+package saga
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/apperrors"
+	"Ejercicio_Final-Taller_Go/internal/clock"
+	"Ejercicio_Final-Taller_Go/internal/idgen"
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+
+	"go.uber.org/zap"
+)
+
+// ErrNotFound is returned when no saga exists with the given ID.
+var ErrNotFound = apperrors.New(apperrors.NotFound, "saga_not_found", "saga not found")
+
+// ErrEmptyID is returned when storing a saga without an ID.
+var ErrEmptyID = apperrors.New(apperrors.Internal, "empty_saga_id", "empty saga ID")
+
+// Status is the progress of a saga or of one of its steps.
+type Status string
+
+const (
+	// StatusRunning sagas and steps have started and not finished yet. A saga
+	// found running by Recover was interrupted, e.g. by a restart.
+	StatusRunning Status = "running"
+	// StatusCompleted sagas ran every step; completed steps succeeded.
+	StatusCompleted Status = "completed"
+	// StatusFailed steps returned an error.
+	StatusFailed Status = "failed"
+	// StatusCompensated sagas and steps were undone.
+	StatusCompensated Status = "compensated"
+	// StatusStuck sagas failed and at least one compensation failed too,
+	// so they need manual attention.
+	StatusStuck Status = "stuck"
+	// StatusPending steps have not started.
+	StatusPending Status = "pending"
+)
+
+// Data carries the values the steps of a saga share, e.g. the IDs of what
+// earlier steps created. It is persisted with the saga so compensations can
+// run after a restart.
+type Data map[string]string
+
+// Step is one action of a saga. Compensate undoes a completed Action; it may
+// be nil for actions with nothing to undo. Both must be idempotent, since
+// Recover may run a compensation again after a crash.
+type Step struct {
+	Name       string
+	Action     func(ctx context.Context, data Data) error
+	Compensate func(ctx context.Context, data Data) error
+}
+
+// Definition names a sequence of steps.
+type Definition struct {
+	Name  string
+	Steps []Step
+}
+
+// StepState is the persisted outcome of a step.
+type StepState struct {
+	Name   string `json:"name"`
+	Status Status `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// State is the persisted progress of one run of a saga.
+type State struct {
+	ID        string      `json:"id"`
+	Name      string      `json:"name"`
+	Status    Status      `json:"status"`
+	Steps     []StepState `json:"steps"`
+	Data      Data        `json:"data"`
+	Error     string      `json:"error,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// EntityID returns the ID the saga is stored under.
+func (s *State) EntityID() string {
+	return s.ID
+}
+
+// clone returns a deep copy of s, so the stored copy is never modified.
+func (s *State) clone() *State {
+	c := *s
+	c.Steps = append([]StepState(nil), s.Steps...)
+	c.Data = maps.Clone(s.Data)
+	return &c
+}
+
+// Coordinator runs sagas and persists their State in a Store.
+type Coordinator struct {
+	store  Store
+	logger *zap.Logger
+	ids    idgen.Generator
+	clock  clock.Clock
+
+	definitions map[string]Definition
+}
+
+// Option configures optional dependencies of a Coordinator.
+type Option func(*Coordinator)
+
+// WithClock sets the clock used for timestamps. Defaults to the system clock.
+func WithClock(c clock.Clock) Option {
+	return func(co *Coordinator) {
+		co.clock = c
+	}
+}
+
+// WithIDGenerator sets the generator used for saga IDs. Defaults to UUIDs.
+func WithIDGenerator(ids idgen.Generator) Option {
+	return func(co *Coordinator) {
+		co.ids = ids
+	}
+}
+
+// New creates a Coordinator persisting sagas in store.
+func New(store Store, logger *zap.Logger, opts ...Option) *Coordinator {
+	c := &Coordinator{
+		store:       store,
+		logger:      logger,
+		ids:         idgen.UUID(),
+		clock:       clock.System(),
+		definitions: map[string]Definition{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Register makes the saga d available to Run and Recover. It must be called
+// before either, typically at startup, and panics on duplicate names.
+func (c *Coordinator) Register(d Definition) {
+	if _, ok := c.definitions[d.Name]; ok {
+		panic(fmt.Sprintf("saga: %q registered twice", d.Name))
+	}
+	c.definitions[d.Name] = d
+}
+
+// Run starts the registered saga name with the given data and runs it to
+// the end. It returns the final state and, when a step failed, that step's
+// error; the completed steps have then been compensated. Compensations run
+// even if ctx is cancelled.
+func (c *Coordinator) Run(ctx context.Context, name string, data Data) (*State, error) {
+	d, ok := c.definitions[name]
+	if !ok {
+		return nil, fmt.Errorf("saga %q is not registered", name)
+	}
+
+	now := c.clock.Now()
+	state := &State{
+		ID:        c.ids.NewID(),
+		Name:      name,
+		Status:    StatusRunning,
+		Steps:     make([]StepState, len(d.Steps)),
+		Data:      maps.Clone(data),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if state.Data == nil {
+		state.Data = Data{}
+	}
+	for i, step := range d.Steps {
+		state.Steps[i] = StepState{Name: step.Name, Status: StatusPending}
+	}
+	if err := c.save(ctx, state); err != nil {
+		return nil, err
+	}
+
+	for i, step := range d.Steps {
+		state.Steps[i].Status = StatusRunning
+		if err := c.save(ctx, state); err != nil {
+			state.Steps[i].Status = StatusPending
+			return state, c.abort(ctx, d, state, err)
+		}
+
+		if err := step.Action(ctx, state.Data); err != nil {
+			c.logger.Warn("saga step failed", zap.String("saga_id", state.ID), zap.String("saga", name), zap.String("step", step.Name), zap.Error(err))
+			state.Steps[i].Status = StatusFailed
+			state.Steps[i].Error = err.Error()
+			return state, c.abort(ctx, d, state, err)
+		}
+		state.Steps[i].Status = StatusCompleted
+	}
+
+	state.Status = StatusCompleted
+	if err := c.save(ctx, state); err != nil {
+		// todos los pasos se hicieron; solo falló registrar el final
+		c.logger.Error("failed to save completed saga", zap.String("saga_id", state.ID), zap.Error(err))
+	}
+	return state, nil
+}
+
+// abort compensates the completed steps of state and returns cause.
+func (c *Coordinator) abort(ctx context.Context, d Definition, state *State, cause error) error {
+	state.Error = cause.Error()
+	c.compensate(context.WithoutCancel(ctx), d, state)
+	return cause
+}
+
+// compensate undoes the completed steps of state, last first, leaving it
+// compensated or, if a compensation fails, stuck. A running step is
+// compensated too, since it may have taken effect before an interruption.
+func (c *Coordinator) compensate(ctx context.Context, d Definition, state *State) {
+	state.Status = StatusCompensated
+	for i := len(state.Steps) - 1; i >= 0; i-- {
+		st := &state.Steps[i]
+		if st.Status != StatusCompleted && st.Status != StatusRunning {
+			continue
+		}
+		if step := d.Steps[i]; step.Compensate != nil {
+			if err := step.Compensate(ctx, state.Data); err != nil {
+				c.logger.Error("saga compensation failed", zap.String("saga_id", state.ID), zap.String("saga", state.Name), zap.String("step", st.Name), zap.Error(err))
+				st.Error = err.Error()
+				state.Status = StatusStuck
+				continue
+			}
+		}
+		st.Status = StatusCompensated
+	}
+
+	if err := c.save(ctx, state); err != nil {
+		c.logger.Error("failed to save compensated saga", zap.String("saga_id", state.ID), zap.Error(err))
+	}
+}
+
+// Recover compensates the sagas of every tenant that were left running,
+// e.g. because the process stopped halfway. It returns how many it
+// compensated. Sagas whose definition is not registered are skipped.
+func (c *Coordinator) Recover(ctx context.Context) (int, error) {
+	tenants, err := c.store.Tenants(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	recovered := 0
+	for _, id := range tenants {
+		tctx := tenant.WithID(ctx, id)
+		states, err := c.store.List(tctx)
+		if err != nil {
+			return recovered, err
+		}
+		for _, state := range states {
+			if state.Status != StatusRunning {
+				continue
+			}
+			d, ok := c.definitions[state.Name]
+			if !ok {
+				c.logger.Warn("cannot recover unknown saga", zap.String("saga_id", state.ID), zap.String("saga", state.Name))
+				continue
+			}
+			state = state.clone()
+			if finished(state) {
+				// solo faltó registrar el final
+				state.Status = StatusCompleted
+				if err := c.save(tctx, state); err != nil {
+					return recovered, err
+				}
+				continue
+			}
+			state.Error = "interrupted"
+			c.compensate(tctx, d, state)
+			recovered++
+		}
+	}
+	if recovered > 0 {
+		c.logger.Info("recovered interrupted sagas", zap.Int("count", recovered))
+	}
+	return recovered, nil
+}
+
+// finished reports whether every step of state completed.
+func finished(state *State) bool {
+	for _, st := range state.Steps {
+		if st.Status != StatusCompleted {
+			return false
+		}
+	}
+	return true
+}
+
+// Get returns the state of the saga with the given ID.
+// Returns ErrNotFound if there is none.
+func (c *Coordinator) Get(ctx context.Context, id string) (*State, error) {
+	state, err := c.store.Read(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return state.clone(), nil
+}
+
+// save persists a copy of state, stamping its update time.
+func (c *Coordinator) save(ctx context.Context, state *State) error {
+	state.UpdatedAt = c.clock.Now()
+	if err := c.store.Set(ctx, state.clone()); err != nil {
+		return fmt.Errorf("failed to save saga state: %w", err)
+	}
+	return nil
+}
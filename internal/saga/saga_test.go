@@ -0,0 +1,111 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// recorder builds steps that log what ran, in order.
+type recorder struct {
+	calls []string
+}
+
+func (r *recorder) step(name string, fail error) Step {
+	return Step{
+		Name: name,
+		Action: func(ctx context.Context, data Data) error {
+			r.calls = append(r.calls, name)
+			data[name] = "done"
+			return fail
+		},
+		Compensate: func(ctx context.Context, data Data) error {
+			r.calls = append(r.calls, "undo "+name)
+			return nil
+		},
+	}
+}
+
+func TestCoordinator_Run(t *testing.T) {
+	rec := &recorder{}
+	c := New(NewLocalStore(), zap.NewNop())
+	c.Register(Definition{Name: "flow", Steps: []Step{rec.step("a", nil), rec.step("b", nil)}})
+
+	state, err := c.Run(context.Background(), "flow", Data{"input": "x"})
+	require.NoError(t, err)
+	require.Equal(t, StatusCompleted, state.Status)
+	require.Equal(t, []string{"a", "b"}, rec.calls)
+	require.Equal(t, Data{"input": "x", "a": "done", "b": "done"}, state.Data)
+
+	stored, err := c.Get(context.Background(), state.ID)
+	require.NoError(t, err)
+	require.Equal(t, StatusCompleted, stored.Status)
+	require.Equal(t, []StepState{{Name: "a", Status: StatusCompleted}, {Name: "b", Status: StatusCompleted}}, stored.Steps)
+}
+
+func TestCoordinator_RunCompensates(t *testing.T) {
+	boom := errors.New("boom")
+	rec := &recorder{}
+	c := New(NewLocalStore(), zap.NewNop())
+	c.Register(Definition{Name: "flow", Steps: []Step{rec.step("a", nil), rec.step("b", nil), rec.step("c", boom)}})
+
+	state, err := c.Run(context.Background(), "flow", nil)
+	require.ErrorIs(t, err, boom)
+	require.Equal(t, []string{"a", "b", "c", "undo b", "undo a"}, rec.calls)
+
+	stored, err := c.Get(context.Background(), state.ID)
+	require.NoError(t, err)
+	require.Equal(t, StatusCompensated, stored.Status)
+	require.Equal(t, "boom", stored.Error)
+	require.Equal(t, []StepState{
+		{Name: "a", Status: StatusCompensated},
+		{Name: "b", Status: StatusCompensated},
+		{Name: "c", Status: StatusFailed, Error: "boom"},
+	}, stored.Steps)
+}
+
+func TestCoordinator_RunStuck(t *testing.T) {
+	rec := &recorder{}
+	a := rec.step("a", nil)
+	a.Compensate = func(ctx context.Context, data Data) error { return errors.New("cannot undo") }
+	c := New(NewLocalStore(), zap.NewNop())
+	c.Register(Definition{Name: "flow", Steps: []Step{a, rec.step("b", errors.New("boom"))}})
+
+	state, err := c.Run(context.Background(), "flow", nil)
+	require.Error(t, err)
+	require.Equal(t, StatusStuck, state.Status)
+	require.Equal(t, StepState{Name: "a", Status: StatusCompleted, Error: "cannot undo"}, state.Steps[0])
+}
+
+func TestCoordinator_Recover(t *testing.T) {
+	store := NewLocalStore()
+	acme := tenant.WithID(context.Background(), "acme")
+	// una saga interrumpida después de completar "a", con "b" en curso
+	require.NoError(t, store.Set(acme, &State{
+		ID:     "1",
+		Name:   "flow",
+		Status: StatusRunning,
+		Steps:  []StepState{{Name: "a", Status: StatusCompleted}, {Name: "b", Status: StatusRunning}, {Name: "c", Status: StatusPending}},
+		Data:   Data{},
+	}))
+	require.NoError(t, store.Set(acme, &State{ID: "2", Name: "flow", Status: StatusCompleted}))
+
+	rec := &recorder{}
+	c := New(store, zap.NewNop())
+	c.Register(Definition{Name: "flow", Steps: []Step{rec.step("a", nil), rec.step("b", nil), rec.step("c", nil)}})
+
+	n, err := c.Recover(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Equal(t, []string{"undo b", "undo a"}, rec.calls)
+
+	stored, err := c.Get(acme, "1")
+	require.NoError(t, err)
+	require.Equal(t, StatusCompensated, stored.Status)
+	require.Equal(t, StatusPending, stored.Steps[2].Status)
+}
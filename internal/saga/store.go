@@ -0,0 +1,27 @@
+package saga
+
+import (
+	"context"
+
+	"Ejercicio_Final-Taller_Go/internal/repo"
+)
+
+// Store persists the state of sagas. Every operation except Tenants is
+// scoped to the tenant carried by ctx (see package tenant).
+type Store interface {
+	Set(ctx context.Context, state *State) error
+	Read(ctx context.Context, id string) (*State, error)
+	List(ctx context.Context) ([]*State, error)
+	// Tenants lists the tenants holding sagas, so Recover can sweep them all.
+	Tenants(ctx context.Context) ([]string, error)
+}
+
+// LocalStore keeps sagas in memory. It is safe for concurrent use.
+type LocalStore struct {
+	*repo.Repository[*State]
+}
+
+// NewLocalStore creates an empty LocalStore.
+func NewLocalStore() *LocalStore {
+	return &LocalStore{Repository: repo.New[*State](ErrNotFound, ErrEmptyID)}
+}
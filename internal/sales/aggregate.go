@@ -0,0 +1,115 @@
+package sales
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/apperrors"
+
+	"go.uber.org/zap"
+)
+
+// ErrInvalidGroupBy is returned when sales are grouped by an unknown field.
+var ErrInvalidGroupBy = apperrors.New(apperrors.Validation, "invalid_group_by", "group_by must be status, user_id or day")
+
+// GroupBy is the field sales are grouped by in AggregateSales.
+type GroupBy string
+
+const (
+	GroupByStatus GroupBy = "status"
+	GroupByUser   GroupBy = "user_id"
+	// GroupByDay groups sales by the UTC date they were created on.
+	GroupByDay GroupBy = "day"
+)
+
+// Valid reports whether g is a known grouping.
+func (g GroupBy) Valid() bool {
+	switch g {
+	case GroupByStatus, GroupByUser, GroupByDay:
+		return true
+	}
+	return false
+}
+
+// key returns the group of sale.
+func (g GroupBy) key(sale *Sale) string {
+	switch g {
+	case GroupByStatus:
+		return string(sale.Status)
+	case GroupByUser:
+		return sale.UserID
+	default:
+		return sale.CreatedAt.UTC().Format(time.DateOnly)
+	}
+}
+
+// SalesGroup sums the sales sharing Key, the value of the field they were
+// grouped by.
+type SalesGroup struct {
+	Key string `json:"key" xml:"key"`
+	SalesMetadata
+}
+
+// salesGroups accumulates sales into their groups, by key.
+type salesGroups map[string]*SalesGroup
+
+// add counts sale into its group by g.
+func (m salesGroups) add(sale *Sale, g GroupBy) {
+	k := g.key(sale)
+	group, ok := m[k]
+	if !ok {
+		group = &SalesGroup{Key: k}
+		m[k] = group
+	}
+	group.Add(sale)
+}
+
+// sorted returns the groups of m sorted by key.
+func (m salesGroups) sorted() []SalesGroup {
+	groups := make([]SalesGroup, 0, len(m))
+	for _, group := range m {
+		groups = append(groups, *group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Key < groups[j].Key
+	})
+	return groups
+}
+
+// AggregateSales returns the counts and sums of the sales matching filter,
+// grouped by g and sorted by key. The storage groups them itself unless
+// archived sales have to be merged in. Returns ErrInvalidGroupBy for an
+// unknown grouping and ErrInvalidStatus for an unknown status.
+func (s *Service) AggregateSales(ctx context.Context, filter SalesFilter, g GroupBy) ([]SalesGroup, error) {
+	if !g.Valid() {
+		return nil, ErrInvalidGroupBy
+	}
+	if filter.Status != "" && !filter.Status.Valid() {
+		return nil, ErrInvalidStatus
+	}
+
+	if s.archive == nil {
+		groups, err := s.storage.GroupSales(ctx, filter, g)
+		if err != nil {
+			s.log(ctx).Error("failed to group sales", zap.String("group_by", string(g)), zap.Error(err))
+			return nil, err
+		}
+		return groups, nil
+	}
+
+	// las ventas archivadas pueden estar duplicadas en la storage
+	results, err := s.storage.Search(ctx, filter)
+	if err != nil {
+		s.log(ctx).Error("failed to search sales", zap.Error(err))
+		return nil, err
+	}
+	if results, err = s.withArchived(ctx, filter, results); err != nil {
+		return nil, err
+	}
+	groups := salesGroups{}
+	for _, sale := range results {
+		groups.add(sale, g)
+	}
+	return groups.sorted(), nil
+}
@@ -0,0 +1,70 @@
+package sales
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/objstore"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestService_AggregateSales(t *testing.T) {
+	ctx := context.Background()
+	day := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	storage := NewLocalStorage()
+	for _, sale := range []*Sale{
+		{ID: "a", UserID: "u1", Amount: 1000, Status: StatusApproved, CreatedAt: day},
+		{ID: "b", UserID: "u1", Amount: 2000, Status: StatusPending, CreatedAt: day.Add(14 * time.Hour)},
+		{ID: "c", UserID: "u2", Amount: 500, Status: StatusApproved, CreatedAt: day.AddDate(0, 0, 2)},
+	} {
+		require.NoError(t, storage.Set(ctx, sale))
+	}
+	s := NewService(storage, zap.NewNop(), "")
+
+	groups, err := s.AggregateSales(ctx, SalesFilter{}, GroupByStatus)
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+	require.Equal(t, "approved", groups[0].Key)
+	require.Equal(t, 2, groups[0].Quantity)
+	require.EqualValues(t, 1500, groups[0].TotalAmount)
+	require.Equal(t, "pending", groups[1].Key)
+
+	// el día es el de creación en UTC
+	groups, err = s.AggregateSales(ctx, SalesFilter{}, GroupByDay)
+	require.NoError(t, err)
+	require.Equal(t, []string{"2024-03-01", "2024-03-02", "2024-03-03"}, []string{groups[0].Key, groups[1].Key, groups[2].Key})
+
+	groups, err = s.AggregateSales(ctx, SalesFilter{Status: StatusApproved}, GroupByUser)
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+	require.Equal(t, "u1", groups[0].Key)
+	require.EqualValues(t, 1000, groups[0].TotalAmount)
+
+	_, err = s.AggregateSales(ctx, SalesFilter{}, "seller")
+	require.ErrorIs(t, err, ErrInvalidGroupBy)
+	_, err = s.AggregateSales(ctx, SalesFilter{Status: "lost"}, GroupByUser)
+	require.ErrorIs(t, err, ErrInvalidStatus)
+}
+
+func TestService_AggregateSales_Archived(t *testing.T) {
+	ctx := context.Background()
+	storage := NewLocalStorage()
+	archive := NewBucketArchive(objstore.Dir(t.TempDir()))
+	sale := &Sale{ID: "a", UserID: "u1", Amount: 1000, Status: StatusApproved}
+	require.NoError(t, storage.Set(ctx, sale))
+	require.NoError(t, storage.Set(ctx, &Sale{ID: "b", UserID: "u1", Amount: 2000, Status: StatusRejected}))
+	// una venta a medio archivar está en los dos lados y se cuenta una vez
+	require.NoError(t, archive.Put(ctx, sale))
+	require.NoError(t, archive.Put(ctx, &Sale{ID: "old", UserID: "u2", Amount: 300, Status: StatusApproved}))
+	s := NewService(storage, zap.NewNop(), "", WithArchive(archive))
+
+	groups, err := s.AggregateSales(ctx, SalesFilter{}, GroupByUser)
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+	require.Equal(t, 2, groups[0].Quantity)
+	require.EqualValues(t, 3000, groups[0].TotalAmount)
+	require.Equal(t, "u2", groups[1].Key)
+}
@@ -0,0 +1,95 @@
+package sales
+
+import (
+	"context"
+	"errors"
+
+	"go.uber.org/zap"
+)
+
+// AnonymizedUserID is the user of the sales whose user was deleted (see
+// AnonymizeUser).
+const AnonymizedUserID = "anonymized"
+
+// AnonymizeUser detaches the sales of a deleted user from them, in the
+// primary store and in the archive: their UserID becomes AnonymizedUserID,
+// and their Notes and Metadata, free-form data that may identify the user,
+// are dropped. Amounts and statuses are kept, so totals do not change. It
+// returns how many sales were anonymized; running it again finds none.
+func (s *Service) AnonymizeUser(ctx context.Context, userID string) (int, error) {
+	if userID == "" || userID == AnonymizedUserID {
+		return 0, nil
+	}
+
+	found, err := s.storage.Search(ctx, SalesFilter{UserID: userID})
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, sale := range found {
+		ok, err := s.anonymizeSale(ctx, sale.ID, userID)
+		if err != nil {
+			return n, err
+		}
+		if ok {
+			n++
+		}
+	}
+
+	// las ventas archivadas no se modifican, se reemplazan
+	if s.archive != nil {
+		archived, err := s.archive.Search(ctx, SalesFilter{UserID: userID})
+		if err != nil {
+			return n, err
+		}
+		for _, sale := range archived {
+			anonymize(sale)
+			if err := s.archive.Put(ctx, sale); err != nil {
+				s.log(ctx).Error("failed to anonymize archived sale", zap.String("sale_id", sale.ID), zap.Error(err))
+				return n, err
+			}
+			n++
+		}
+	}
+
+	s.log(ctx).Info("user sales anonymized", zap.String("user_id", userID), zap.Int("count", n))
+	return n, nil
+}
+
+// anonymizeSale anonymizes the sale saleID unless it no longer belongs to
+// userID, and reports whether it did.
+func (s *Service) anonymizeSale(ctx context.Context, saleID, userID string) (bool, error) {
+	release, err := s.lockSale(ctx, saleID)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	sale, err := s.readForUpdate(ctx, saleID)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if sale.UserID != userID {
+		return false, nil
+	}
+
+	before := *sale
+	anonymize(sale)
+	sale.UpdatedAt = s.clock.Now()
+	sale.Version++
+	if err := s.storage.Set(ctx, sale); err != nil {
+		s.log(ctx).Error("failed to anonymize sale", zap.String("sale_id", sale.ID), zap.Error(err))
+		return false, err
+	}
+
+	s.emit(ctx, Event{Type: EventUpdated, Sale: *sale, Previous: &before})
+	return true, nil
+}
+
+// anonymize drops from sale the data of its user.
+func anonymize(sale *Sale) {
+	sale.UserID, sale.Notes, sale.Metadata = AnonymizedUserID, "", nil
+}
@@ -0,0 +1,56 @@
+package sales
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/clock"
+	"Ejercicio_Final-Taller_Go/internal/objstore"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestService_AnonymizeUser(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 3, 10, 15, 0, 0, 0, time.UTC)
+	storage := NewLocalStorage()
+	archive := NewBucketArchive(objstore.Dir(t.TempDir()))
+	var events []Event
+	s := NewService(storage, zap.NewNop(), "", WithClock(clock.NewManual(now)), WithArchive(archive),
+		WithHooks(func(_ context.Context, e Event) { events = append(events, e) }))
+
+	sale := func(id, userID string) *Sale {
+		return &Sale{ID: id, UserID: userID, Amount: 1000, Status: StatusApproved, Notes: "call Ana at 555-1234",
+			Metadata: Metadata{"email": "ana@example.com"}, CreatedAt: now, UpdatedAt: now, Version: 1}
+	}
+	require.NoError(t, storage.Set(ctx, sale("1", "ana")))
+	require.NoError(t, storage.Set(ctx, sale("2", "bob")))
+	require.NoError(t, archive.Put(ctx, sale("3", "ana")))
+
+	n, err := s.AnonymizeUser(ctx, "ana")
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	got, err := s.GetSale(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, AnonymizedUserID, got.UserID)
+	require.Empty(t, got.Notes)
+	require.Empty(t, got.Metadata)
+	require.Equal(t, 2, got.Version)
+	require.Len(t, events, 1)
+	require.Equal(t, "ana", events[0].Previous.UserID)
+
+	archived, err := archive.Get(ctx, "3")
+	require.NoError(t, err)
+	require.Equal(t, AnonymizedUserID, archived.UserID)
+	other, err := s.GetSale(ctx, "2")
+	require.NoError(t, err)
+	require.Equal(t, "bob", other.UserID)
+
+	// otra vez no queda nada por anonimizar
+	n, err = s.AnonymizeUser(ctx, "ana")
+	require.NoError(t, err)
+	require.Zero(t, n)
+}
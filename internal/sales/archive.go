@@ -0,0 +1,269 @@
+package sales
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/clock"
+	"Ejercicio_Final-Taller_Go/internal/objstore"
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+)
+
+// Archive holds the sales moved out of the primary Storage by the retention
+// policy. Like Storage, every operation is scoped to the tenant carried by ctx.
+type Archive interface {
+	Put(ctx context.Context, sale *Sale) error
+	Get(ctx context.Context, id string) (*Sale, error)
+	ReadByNumber(ctx context.Context, number string) (*Sale, error)
+	Search(ctx context.Context, filter SalesFilter) ([]*Sale, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// BucketArchive stores each archived sale as a JSON object at
+// "sales/<tenant>/<id>.json" in an objstore.Bucket. Searching every object
+// on each request would be too slow for S3, so the sales of a tenant are
+// kept in an in-memory index, updated on Put and Delete. The index is
+// refreshed from the bucket once it is older than the refresh interval, to
+// see the sales other instances archived or restored, fetching only the
+// objects it did not have: archived sales are not changed in place. Only
+// the indexes of the most recently used tenants are kept.
+type BucketArchive struct {
+	bucket     objstore.Bucket
+	clock      clock.Clock
+	refresh    time.Duration
+	maxTenants int
+
+	mu    sync.Mutex
+	index map[string]*archiveIndex // tenant -> índice
+}
+
+// archiveIndex is the index of the archived sales of a tenant.
+type archiveIndex struct {
+	sales    map[string]*Sale // sale ID -> sale
+	loadedAt time.Time
+	usedAt   time.Time
+}
+
+const (
+	defaultArchiveRefresh    = time.Minute
+	defaultArchiveMaxTenants = 100
+)
+
+// ArchiveOption configures optional behaviour of a BucketArchive.
+type ArchiveOption func(*BucketArchive)
+
+// WithArchiveClock sets the clock that ages the indexes. Defaults to the system clock.
+func WithArchiveClock(c clock.Clock) ArchiveOption {
+	return func(a *BucketArchive) {
+		a.clock = c
+	}
+}
+
+// WithIndexRefresh sets how old the index of a tenant can get before it is
+// refreshed from the bucket. Defaults to a minute.
+func WithIndexRefresh(d time.Duration) ArchiveOption {
+	return func(a *BucketArchive) {
+		a.refresh = d
+	}
+}
+
+// WithIndexedTenants sets how many tenants have their index kept in
+// memory; the least recently used one is dropped to make room. Defaults to 100.
+func WithIndexedTenants(n int) ArchiveOption {
+	return func(a *BucketArchive) {
+		if n > 0 {
+			a.maxTenants = n
+		}
+	}
+}
+
+// NewBucketArchive returns an Archive backed by bucket.
+func NewBucketArchive(bucket objstore.Bucket, opts ...ArchiveOption) *BucketArchive {
+	a := &BucketArchive{
+		bucket:     bucket,
+		clock:      clock.System(),
+		refresh:    defaultArchiveRefresh,
+		maxTenants: defaultArchiveMaxTenants,
+		index:      map[string]*archiveIndex{},
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+func saleKey(tenantID, id string) string {
+	return fmt.Sprintf("sales/%s/%s.json", tenantID, id)
+}
+
+// tenantIndex returns the index of the tenant in ctx, loading it from the
+// bucket the first time and again once it is older than a.refresh.
+// Callers must hold a.mu.
+func (a *BucketArchive) tenantIndex(ctx context.Context) (map[string]*Sale, error) {
+	tenantID := tenant.FromContext(ctx)
+	now := a.clock.Now()
+	idx, ok := a.index[tenantID]
+	if ok && now.Sub(idx.loadedAt) < a.refresh {
+		idx.usedAt = now
+		return idx.sales, nil
+	}
+
+	keys, err := a.bucket.List(ctx, fmt.Sprintf("sales/%s/", tenantID))
+	if err != nil {
+		return nil, err
+	}
+	sales := make(map[string]*Sale, len(keys))
+	for _, key := range keys {
+		if !strings.HasSuffix(key, ".json") {
+			continue
+		}
+		id := strings.TrimSuffix(path.Base(key), ".json")
+		// las ventas archivadas no cambian: solo se bajan las que faltan
+		if ok && idx.sales[id] != nil {
+			sales[id] = idx.sales[id]
+			continue
+		}
+		data, err := a.bucket.Get(ctx, key)
+		if errors.Is(err, objstore.ErrNotFound) {
+			continue // otra instancia la restauró mientras tanto
+		}
+		if err != nil {
+			return nil, err
+		}
+		sale := &Sale{}
+		if err := json.Unmarshal(data, sale); err != nil {
+			return nil, fmt.Errorf("error decoding archived sale %s: %w", key, err)
+		}
+		sales[id] = sale
+	}
+
+	a.index[tenantID] = &archiveIndex{sales: sales, loadedAt: now, usedAt: now}
+	a.evict(tenantID)
+	return sales, nil
+}
+
+// evict drops the least recently used indexes, other than the one of keep,
+// until at most a.maxTenants are left. Callers must hold a.mu.
+func (a *BucketArchive) evict(keep string) {
+	for len(a.index) > a.maxTenants {
+		oldest := ""
+		for id, idx := range a.index {
+			if id != keep && (oldest == "" || idx.usedAt.Before(a.index[oldest].usedAt)) {
+				oldest = id
+			}
+		}
+		delete(a.index, oldest)
+	}
+}
+
+// Put archives sale, marking it as Archived.
+// Returns ErrEmptyID if the sale has an empty ID.
+func (a *BucketArchive) Put(ctx context.Context, sale *Sale) error {
+	if sale.ID == "" {
+		return ErrEmptyID
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	idx, err := a.tenantIndex(ctx)
+	if err != nil {
+		return err
+	}
+
+	archived := *sale
+	archived.Archived = true
+	data, err := json.Marshal(&archived)
+	if err != nil {
+		return fmt.Errorf("error encoding sale %s: %w", sale.ID, err)
+	}
+	if err := a.bucket.Put(ctx, saleKey(tenant.FromContext(ctx), sale.ID), data); err != nil {
+		return err
+	}
+
+	idx[sale.ID] = &archived
+	return nil
+}
+
+// Get returns a copy of the archived sale with the given ID.
+// Returns ErrNotFound if it is not archived.
+func (a *BucketArchive) Get(ctx context.Context, id string) (*Sale, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	idx, err := a.tenantIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := idx[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	sale := *s
+	return &sale, nil
+}
+
+// ReadByNumber returns a copy of the archived sale with the given Number.
+// Returns ErrNotFound if none is archived.
+func (a *BucketArchive) ReadByNumber(ctx context.Context, number string) (*Sale, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	idx, err := a.tenantIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range idx {
+		if number != "" && s.Number == number {
+			sale := *s
+			return &sale, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Search returns copies of the archived sales matching filter, in no particular order.
+func (a *BucketArchive) Search(ctx context.Context, filter SalesFilter) ([]*Sale, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	idx, err := a.tenantIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sales := make([]*Sale, 0)
+	for _, s := range idx {
+		if filter.Matches(s) {
+			sale := *s
+			sales = append(sales, &sale)
+		}
+	}
+	return sales, nil
+}
+
+// Delete removes a sale from the archive.
+// Returns ErrNotFound if it is not archived.
+func (a *BucketArchive) Delete(ctx context.Context, id string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	idx, err := a.tenantIndex(ctx)
+	if err != nil {
+		return err
+	}
+	if _, ok := idx[id]; !ok {
+		return ErrNotFound
+	}
+	if err := a.bucket.Delete(ctx, saleKey(tenant.FromContext(ctx), id)); err != nil && !errors.Is(err, objstore.ErrNotFound) {
+		return err
+	}
+
+	delete(idx, id)
+	return nil
+}
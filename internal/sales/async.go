@@ -0,0 +1,219 @@
+package sales
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/apperrors"
+	"Ejercicio_Final-Taller_Go/internal/money"
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+
+	"go.uber.org/zap"
+)
+
+// ErrCreationJobNotFound is returned when polling an unknown or expired creation job.
+var ErrCreationJobNotFound = apperrors.New(apperrors.NotFound, "creation_job_not_found", "sale creation job not found")
+
+// ErrCreationQueueFull is returned when too many sale creations are already queued.
+var ErrCreationQueueFull = apperrors.New(apperrors.DependencyUnavailable, "creation_queue_full", "too many sales are waiting to be created")
+
+// CreationJobStatus is the progress of an asynchronous sale creation.
+type CreationJobStatus string
+
+const (
+	JobQueued    CreationJobStatus = "queued"
+	JobRunning   CreationJobStatus = "running"
+	JobSucceeded CreationJobStatus = "succeeded"
+	JobFailed    CreationJobStatus = "failed"
+)
+
+// CreationJob is a sale creation handed to a CreationQueue. Sale is set once
+// it succeeded and Err once it failed.
+type CreationJob struct {
+	ID        string            `json:"id"`
+	Status    CreationJobStatus `json:"status"`
+	UserID    string            `json:"user_id"`
+	Amount    money.Cents       `json:"amount"`
+	Sale      *Sale             `json:"sale,omitempty"`
+	Err       error             `json:"-"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+
+	ctx context.Context // valores (tenant, API key) del request original
+}
+
+// CreationQueue runs CreateSale in background workers, so a client does not
+// wait for the user API validation of its sale. Finished jobs are kept for
+// polling during a retention period and then forgotten.
+type CreationQueue struct {
+	service   *Service
+	timeout   time.Duration
+	retention time.Duration
+
+	queue chan *CreationJob
+
+	mu   sync.Mutex
+	jobs map[string]*CreationJob // tenant + "/" + job ID -> job
+
+	done func(ctx context.Context, job CreationJob)
+}
+
+// CreationQueueOption configures optional behaviour of a CreationQueue.
+type CreationQueueOption func(*CreationQueue)
+
+// WithJobDone has fn called once each job finished, with the context
+// whose values the job was enqueued with.
+func WithJobDone(fn func(ctx context.Context, job CreationJob)) CreationQueueOption {
+	return func(q *CreationQueue) {
+		q.done = fn
+	}
+}
+
+// NewCreationQueue creates a queue of at most size pending creations on
+// service. Each creation runs for at most timeout (0 means no limit), and
+// finished jobs can be polled for retention after they end.
+func NewCreationQueue(service *Service, size int, timeout, retention time.Duration, opts ...CreationQueueOption) *CreationQueue {
+	q := &CreationQueue{
+		service:   service,
+		timeout:   timeout,
+		retention: retention,
+		queue:     make(chan *CreationJob, size),
+		jobs:      map[string]*CreationJob{},
+		done:      func(context.Context, CreationJob) {},
+	}
+	for _, opt := range opts {
+		opt(q)
+	}
+	return q
+}
+
+func jobKey(ctx context.Context, id string) string {
+	return tenant.FromContext(ctx) + "/" + id
+}
+
+// Enqueue queues the creation of a sale and returns its job. The amount is
+// checked right away; the user is validated when the job runs. ctx only
+// lends its values to the job: cancelling it does not cancel the creation.
+// Returns ErrCreationQueueFull when the queue has no room left.
+func (q *CreationQueue) Enqueue(ctx context.Context, userID string, amount money.Cents) (*CreationJob, error) {
+	if err := ValidateAmount(amount); err != nil {
+		return nil, err
+	}
+
+	now := q.service.clock.Now()
+	job := &CreationJob{
+		ID:        q.service.ids.NewID(),
+		Status:    JobQueued,
+		UserID:    userID,
+		Amount:    amount,
+		CreatedAt: now,
+		UpdatedAt: now,
+		ctx:       context.WithoutCancel(ctx),
+	}
+
+	q.mu.Lock()
+	q.prune(now)
+	select {
+	case q.queue <- job:
+		q.jobs[jobKey(ctx, job.ID)] = job
+	default:
+		q.mu.Unlock()
+		return nil, ErrCreationQueueFull
+	}
+	snapshot := *job
+	q.mu.Unlock()
+
+	return &snapshot, nil
+}
+
+// prune forgets the jobs that finished more than the retention period ago.
+// Callers must hold q.mu.
+func (q *CreationQueue) prune(now time.Time) {
+	for key, job := range q.jobs {
+		done := job.Status == JobSucceeded || job.Status == JobFailed
+		if done && now.Sub(job.UpdatedAt) > q.retention {
+			delete(q.jobs, key)
+		}
+	}
+}
+
+// Get returns a snapshot of the job id of the tenant in ctx.
+// Returns ErrCreationJobNotFound if there is no such job.
+func (q *CreationQueue) Get(ctx context.Context, id string) (*CreationJob, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[jobKey(ctx, id)]
+	if !ok {
+		return nil, ErrCreationJobNotFound
+	}
+	snapshot := *job
+	return &snapshot, nil
+}
+
+// Run processes queued creations with the given number of workers until
+// ctx is done, and then the creations still queued, so that none is lost
+// once no more are enqueued.
+func (q *CreationQueue) Run(ctx context.Context, workers int) {
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					q.drain()
+					return
+				case job := <-q.queue:
+					q.process(job)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// drain processes the queued creations until the queue is empty.
+func (q *CreationQueue) drain() {
+	for {
+		select {
+		case job := <-q.queue:
+			q.process(job)
+		default:
+			return
+		}
+	}
+}
+
+func (q *CreationQueue) process(job *CreationJob) {
+	q.setStatus(job, JobRunning, nil, nil)
+
+	ctx := job.ctx
+	if q.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, q.timeout)
+		defer cancel()
+	}
+
+	sale, err := q.service.CreateSale(ctx, job.UserID, job.Amount)
+	if err != nil {
+		q.service.log(job.ctx).Warn("async sale creation failed", zap.String("job_id", job.ID), zap.Error(err))
+		q.done(job.ctx, q.setStatus(job, JobFailed, nil, err))
+		return
+	}
+	q.done(job.ctx, q.setStatus(job, JobSucceeded, sale, nil))
+}
+
+// setStatus updates job and returns a snapshot of it.
+func (q *CreationQueue) setStatus(job *CreationJob, status CreationJobStatus, sale *Sale, err error) CreationJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job.Status = status
+	job.Sale = sale
+	job.Err = err
+	job.UpdatedAt = q.service.clock.Now()
+	return *job
+}
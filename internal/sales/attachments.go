@@ -0,0 +1,189 @@
+package sales
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/apperrors"
+	"Ejercicio_Final-Taller_Go/internal/audit"
+	"Ejercicio_Final-Taller_Go/internal/objstore"
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+
+	"go.uber.org/zap"
+)
+
+// ErrAttachmentsUnavailable is returned for attachments when no blob
+// storage is configured (see WithAttachments).
+var ErrAttachmentsUnavailable = apperrors.New(apperrors.NotFound, "attachments_unavailable", "sale attachments are not enabled")
+
+// ErrInvalidAttachment is returned for an empty or too large attachment, or
+// one more than a sale can hold.
+var ErrInvalidAttachment = apperrors.New(apperrors.Validation, "invalid_attachment", "the attachment is empty or exceeds its limits")
+
+// ErrUnsupportedAttachment is returned for an attachment whose content is
+// not of an accepted type.
+var ErrUnsupportedAttachment = apperrors.New(apperrors.Validation, "unsupported_attachment", "the attachment type is not accepted")
+
+// maxAttachments caps the attachments of a sale.
+const maxAttachments = 20
+
+// maxAttachmentName caps the length of the file name of an attachment.
+const maxAttachmentName = 255
+
+// Attachment describes a file attached to a sale, such as a receipt. The
+// content is kept in the blob storage, apart from the sale.
+type Attachment struct {
+	ID          string    `json:"id" xml:"id"`
+	Name        string    `json:"name" xml:"name"`
+	ContentType string    `json:"content_type" xml:"content_type"`
+	Size        int64     `json:"size" xml:"size"`
+	SHA256      string    `json:"sha256" xml:"sha256"`
+	UploadedBy  string    `json:"uploaded_by,omitempty" xml:"uploaded_by,omitempty"`
+	CreatedAt   time.Time `json:"created_at" xml:"created_at"`
+}
+
+// attachmentStore is where the content of attachments is kept.
+type attachmentStore struct {
+	bucket  objstore.Bucket
+	maxSize int64
+	types   []string
+}
+
+// WithAttachments enables attachments, keeping their content in bucket.
+// Attachments of up to maxSize bytes whose content is of one of types,
+// such as "image/png", are accepted.
+func WithAttachments(bucket objstore.Bucket, maxSize int64, types ...string) Option {
+	return func(s *Service) {
+		s.attachments = &attachmentStore{bucket: bucket, maxSize: maxSize, types: types}
+	}
+}
+
+// attachmentKey is where the content of an attachment is kept in the bucket.
+func attachmentKey(ctx context.Context, saleID, id string) string {
+	return fmt.Sprintf("attachments/%s/%s/%s", tenant.FromContext(ctx), saleID, id)
+}
+
+// AddAttachment attaches data, a file with the given name, to a sale in
+// any status, uploaded by the actor in ctx (see audit.WithActor). Its type
+// is told by its content, so a file cannot pass for a type it is not.
+// Returns ErrAttachmentsUnavailable, ErrNotFound, also for archived sales,
+// ErrInvalidAttachment or ErrUnsupportedAttachment.
+func (s *Service) AddAttachment(ctx context.Context, saleID, name string, data []byte) (*Attachment, error) {
+	store := s.attachments
+	if store == nil {
+		return nil, ErrAttachmentsUnavailable
+	}
+	name = path.Base(strings.ReplaceAll(strings.TrimSpace(name), `\`, "/"))
+	if len(data) == 0 || int64(len(data)) > store.maxSize {
+		return nil, fmt.Errorf("%w: up to %d bytes", ErrInvalidAttachment, store.maxSize)
+	}
+	if name == "" || name == "." || name == "/" || len(name) > maxAttachmentName {
+		return nil, fmt.Errorf("%w: invalid file name", ErrInvalidAttachment)
+	}
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	if !slices.Contains(store.types, contentType) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAttachment, contentType)
+	}
+
+	release, err := s.lockSale(ctx, saleID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	sale, err := s.readForUpdate(ctx, saleID)
+	if err != nil {
+		return nil, err
+	}
+	if len(sale.Attachments) >= maxAttachments {
+		return nil, fmt.Errorf("%w: more than %d attachments", ErrInvalidAttachment, maxAttachments)
+	}
+
+	before, now := *sale, s.clock.Now()
+	sum := sha256.Sum256(data)
+	attachment := Attachment{
+		ID:          s.ids.NewID(),
+		Name:        name,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		SHA256:      hex.EncodeToString(sum[:]),
+		UploadedBy:  audit.ActorFromContext(ctx),
+		CreatedAt:   now,
+	}
+	key := attachmentKey(ctx, sale.ID, attachment.ID)
+	if err := store.bucket.Put(ctx, key, data); err != nil {
+		s.log(ctx).Error("failed to store attachment", zap.String("sale_id", sale.ID), zap.Error(err))
+		return nil, err
+	}
+
+	sale.Attachments = append(sale.Attachments, attachment)
+	sale.UpdatedAt = now
+	sale.Version++
+	if err := s.storage.Set(ctx, sale); err != nil {
+		s.log(ctx).Error("failed to add attachment", zap.String("sale_id", sale.ID), zap.Error(err))
+		if derr := store.bucket.Delete(ctx, key); derr != nil {
+			s.log(ctx).Warn("failed to delete orphan attachment", zap.String("key", key), zap.Error(derr))
+		}
+		return nil, err
+	}
+
+	s.log(ctx).Info("sale attachment added", zap.String("sale_id", sale.ID), zap.String("attachment_id", attachment.ID),
+		zap.String("content_type", contentType), zap.Int64("size", attachment.Size))
+	s.emit(ctx, Event{Type: EventUpdated, Sale: *sale, Previous: &before})
+	return &attachment, nil
+}
+
+// SaleAttachments returns the attachments of a sale, oldest first, looking
+// in the archive when it is not in the primary store.
+// Returns ErrAttachmentsUnavailable or ErrNotFound.
+func (s *Service) SaleAttachments(ctx context.Context, saleID string) ([]Attachment, error) {
+	if s.attachments == nil {
+		return nil, ErrAttachmentsUnavailable
+	}
+	sale, err := s.GetSale(ctx, saleID)
+	if err != nil {
+		return nil, err
+	}
+	attachments := slices.Clone(sale.Attachments)
+	if attachments == nil {
+		attachments = []Attachment{}
+	}
+	return attachments, nil
+}
+
+// AttachmentContent returns an attachment of a sale and its content.
+// Returns ErrAttachmentsUnavailable, or ErrNotFound if the sale or the
+// attachment do not exist.
+func (s *Service) AttachmentContent(ctx context.Context, saleID, id string) (*Attachment, []byte, error) {
+	if s.attachments == nil {
+		return nil, nil, ErrAttachmentsUnavailable
+	}
+	sale, err := s.GetSale(ctx, saleID)
+	if err != nil {
+		return nil, nil, err
+	}
+	i := slices.IndexFunc(sale.Attachments, func(a Attachment) bool { return a.ID == id })
+	if i < 0 {
+		return nil, nil, ErrNotFound
+	}
+
+	data, err := s.attachments.bucket.Get(ctx, attachmentKey(ctx, sale.ID, id))
+	if errors.Is(err, objstore.ErrNotFound) {
+		return nil, nil, ErrNotFound
+	}
+	if err != nil {
+		s.log(ctx).Error("failed to read attachment", zap.String("sale_id", sale.ID), zap.String("attachment_id", id), zap.Error(err))
+		return nil, nil, err
+	}
+	attachment := sale.Attachments[i]
+	return &attachment, data, nil
+}
@@ -0,0 +1,75 @@
+package sales
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/audit"
+	"Ejercicio_Final-Taller_Go/internal/clock"
+	"Ejercicio_Final-Taller_Go/internal/objstore"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// pngData is the start of a PNG file, enough to be detected as one.
+var pngData = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestService_AddAttachment(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 3, 10, 15, 0, 0, 0, time.UTC)
+	storage := NewLocalStorage()
+	bucket := objstore.Dir(t.TempDir())
+	s := NewService(storage, zap.NewNop(), "", WithClock(clock.NewManual(now)), WithAttachments(bucket, 64, "image/png", "application/pdf"))
+	require.NoError(t, storage.Set(ctx, &Sale{ID: "1", UserID: "a", Amount: 1000, Status: StatusApproved, CreatedAt: now, UpdatedAt: now, Version: 1}))
+
+	_, err := s.AddAttachment(ctx, "1", "empty.png", nil)
+	require.ErrorIs(t, err, ErrInvalidAttachment)
+	_, err = s.AddAttachment(ctx, "1", "big.png", append(pngData, make([]byte, 64)...))
+	require.ErrorIs(t, err, ErrInvalidAttachment)
+	// el tipo sale del contenido, no del nombre
+	_, err = s.AddAttachment(ctx, "1", "receipt.png", []byte("<html><script>alert(1)</script>"))
+	require.ErrorIs(t, err, ErrUnsupportedAttachment)
+	_, err = s.AddAttachment(ctx, "missing", "receipt.png", pngData)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	attachment, err := s.AddAttachment(audit.WithActor(ctx, "ana"), "1", `C:\scans\..\receipt.png`, pngData)
+	require.NoError(t, err)
+	require.Equal(t, "receipt.png", attachment.Name)
+	require.Equal(t, "image/png", attachment.ContentType)
+	require.EqualValues(t, len(pngData), attachment.Size)
+	require.Len(t, attachment.SHA256, 64)
+	require.Equal(t, "ana", attachment.UploadedBy)
+	require.Equal(t, now, attachment.CreatedAt)
+
+	attachments, err := s.SaleAttachments(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, []Attachment{*attachment}, attachments)
+	sale, err := s.GetSale(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, 2, sale.Version)
+
+	got, data, err := s.AttachmentContent(ctx, "1", attachment.ID)
+	require.NoError(t, err)
+	require.Equal(t, *attachment, *got)
+	require.Equal(t, pngData, data)
+	_, _, err = s.AttachmentContent(ctx, "1", "missing")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	for i := len(attachments); i < maxAttachments; i++ {
+		_, err = s.AddAttachment(ctx, "1", "more.pdf", []byte("%PDF-1.4\n"))
+		require.NoError(t, err)
+	}
+	_, err = s.AddAttachment(ctx, "1", "one too many.pdf", []byte("%PDF-1.4\n"))
+	require.ErrorIs(t, err, ErrInvalidAttachment)
+}
+
+func TestService_Attachments_Unavailable(t *testing.T) {
+	s := NewService(NewLocalStorage(), zap.NewNop(), "")
+
+	_, err := s.AddAttachment(context.Background(), "1", "receipt.png", pngData)
+	require.ErrorIs(t, err, ErrAttachmentsUnavailable)
+	_, err = s.SaleAttachments(context.Background(), "1")
+	require.ErrorIs(t, err, ErrAttachmentsUnavailable)
+}
@@ -0,0 +1,153 @@
+package sales
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+
+	"go.uber.org/zap"
+)
+
+// RejectionBreaker configures the breaker that stops rejecting new sales
+// automatically when too many of them are rejected, e.g. because the
+// approval policy misbehaves. While it is open, new sales start pending
+// for manual review instead.
+type RejectionBreaker struct {
+	// Rate is the fraction of the automatic decisions of the Window that
+	// must be rejections to open the breaker, e.g. 0.5.
+	Rate float64
+	// Window is how far back decisions are counted.
+	Window time.Duration
+	// MinSales is the number of decisions in the Window below which the
+	// rate tells nothing.
+	MinSales int
+	// Cooldown is how long the breaker stays open before automatic
+	// decisions resume.
+	Cooldown time.Duration
+	// OnTrip, if set, is called when the breaker opens in the tenant of
+	// ctx, e.g. to alert operators.
+	OnTrip func(ctx context.Context, trip BreakerTrip)
+}
+
+// BreakerTrip tells why and until when a RejectionBreaker opened.
+type BreakerTrip struct {
+	Rate     float64   // fracción de rechazos de la ventana
+	Rejected int       // rechazos de la ventana
+	Total    int       // decisiones de la ventana
+	Until    time.Time // cuando vuelven las decisiones automáticas
+}
+
+// maxDecisions caps the decisions a breaker remembers per tenant, so a
+// long window under heavy traffic does not grow without bound.
+const maxDecisions = 10000
+
+// WithRejectionBreaker starts new sales as pending while the breaker
+// configured by b is open. The decisions counted are the initial statuses
+// of the sales created by this instance, per tenant.
+func WithRejectionBreaker(b RejectionBreaker) Option {
+	return func(s *Service) {
+		s.breaker = &breaker{config: b, tenants: map[string]*breakerState{}}
+	}
+}
+
+// breaker keeps the recent automatic decisions of every tenant. It is safe
+// for concurrent use.
+type breaker struct {
+	config RejectionBreaker
+
+	mu      sync.Mutex
+	tenants map[string]*breakerState
+}
+
+type breakerState struct {
+	decisions []decision // oldest first
+	openUntil time.Time
+}
+
+type decision struct {
+	at       time.Time
+	rejected bool
+}
+
+// open reports whether the breaker is open in the tenant of ctx at now.
+func (b *breaker) open(ctx context.Context, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st, ok := b.tenants[tenant.FromContext(ctx)]
+	return ok && now.Before(st.openUntil)
+}
+
+// record counts status as a decision taken at now in the tenant of ctx,
+// and returns the trip it caused, if any.
+func (b *breaker) record(ctx context.Context, now time.Time, status SaleStatus) (BreakerTrip, bool) {
+	if status != StatusApproved && status != StatusRejected {
+		return BreakerTrip{}, false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := tenant.FromContext(ctx)
+	st, ok := b.tenants[id]
+	if !ok {
+		st = &breakerState{}
+		b.tenants[id] = st
+	}
+
+	// se descartan las decisiones fuera de la ventana
+	from := now.Add(-b.config.Window)
+	i := 0
+	for i < len(st.decisions) && !st.decisions[i].at.After(from) {
+		i++
+	}
+	if len(st.decisions)-i >= maxDecisions {
+		i = len(st.decisions) - maxDecisions + 1
+	}
+	st.decisions = append(st.decisions[i:], decision{at: now, rejected: status == StatusRejected})
+
+	rejected := 0
+	for _, d := range st.decisions {
+		if d.rejected {
+			rejected++
+		}
+	}
+	total := len(st.decisions)
+	rate := float64(rejected) / float64(total)
+	if total < b.config.MinSales || rate <= b.config.Rate {
+		return BreakerTrip{}, false
+	}
+
+	// al cerrarse vuelve a hacer falta MinSales decisiones nuevas para abrirse
+	st.openUntil = now.Add(b.config.Cooldown)
+	st.decisions = nil
+	return BreakerTrip{Rate: rate, Rejected: rejected, Total: total, Until: st.openUntil}, true
+}
+
+// initialStatus picks the status of a new sale: pending while the breaker
+// is open, or the automatic decision otherwise.
+func (s *Service) initialStatus(ctx context.Context, now time.Time) SaleStatus {
+	if s.breaker != nil && s.breaker.open(ctx, now) {
+		return StatusPending
+	}
+	return s.randomStatus()
+}
+
+// recordDecision counts the initial status of a stored sale in the
+// breaker, and alerts when it opens it.
+func (s *Service) recordDecision(ctx context.Context, sale *Sale) {
+	if s.breaker == nil {
+		return
+	}
+	trip, ok := s.breaker.record(ctx, sale.CreatedAt, sale.Status)
+	if !ok {
+		return
+	}
+	s.log(ctx).Warn("rejection breaker open, new sales start pending",
+		zap.String("tenant", tenant.FromContext(ctx)), zap.Float64("rate", trip.Rate),
+		zap.Int("rejected", trip.Rejected), zap.Int("total", trip.Total), zap.Time("until", trip.Until))
+	if s.breaker.config.OnTrip != nil {
+		s.breaker.config.OnTrip(ctx, trip)
+	}
+}
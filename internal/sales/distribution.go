@@ -0,0 +1,189 @@
+package sales
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+
+	"Ejercicio_Final-Taller_Go/internal/apperrors"
+	"Ejercicio_Final-Taller_Go/internal/money"
+
+	"go.uber.org/zap"
+)
+
+// ErrInvalidBuckets is returned for histogram bounds that are not
+// increasing positive amounts.
+var ErrInvalidBuckets = apperrors.New(apperrors.Validation, "invalid_buckets", "buckets must be increasing positive amounts")
+
+// DefaultBuckets are the upper bounds of the amount histogram when none are given.
+var DefaultBuckets = []money.Cents{1000, 5000, 10000, 50000, 100000, 500000}
+
+// maxBuckets caps the bounds of a histogram.
+const maxBuckets = 50
+
+// Distribution tells how the amounts of a set of sales are spread. The
+// percentiles are estimates within 1% of the exact amount (see
+// amountSketch); the histogram counts are exact. Percentiles are zero when
+// there are no sales.
+type Distribution struct {
+	P50     money.Cents `json:"p50" xml:"p50"`
+	P90     money.Cents `json:"p90" xml:"p90"`
+	P99     money.Cents `json:"p99" xml:"p99"`
+	Buckets []Bucket    `json:"buckets" xml:"bucket"`
+}
+
+// Bucket counts the sales with an amount up to UpTo, inclusive, and above
+// the bound of the previous bucket. The last bucket has no UpTo and counts
+// every larger amount.
+type Bucket struct {
+	UpTo  *money.Cents `json:"up_to" xml:"up_to,omitempty"`
+	Count int          `json:"count" xml:"count"`
+}
+
+// ParseBuckets parses comma-separated decimal amounts, such as
+// "10,50.5,100", into histogram bounds. An empty string returns
+// DefaultBuckets.
+func ParseBuckets(s string) ([]money.Cents, error) {
+	if strings.TrimSpace(s) == "" {
+		return DefaultBuckets, nil
+	}
+	parts := strings.Split(s, ",")
+	if len(parts) > maxBuckets {
+		return nil, fmt.Errorf("%w: more than %d", ErrInvalidBuckets, maxBuckets)
+	}
+
+	bounds := make([]money.Cents, len(parts))
+	for i, p := range parts {
+		v, err := money.Parse(strings.TrimSpace(p))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidBuckets, p)
+		}
+		bounds[i] = v
+	}
+	if !validBuckets(bounds) {
+		return nil, ErrInvalidBuckets
+	}
+	return bounds, nil
+}
+
+// validBuckets reports whether bounds are at most maxBuckets increasing
+// positive amounts.
+func validBuckets(bounds []money.Cents) bool {
+	if len(bounds) > maxBuckets {
+		return false
+	}
+	for i, b := range bounds {
+		if b <= 0 || (i > 0 && b <= bounds[i-1]) {
+			return false
+		}
+	}
+	return true
+}
+
+// AmountDistribution returns the distribution of the amounts of the sales
+// matching filter, histogrammed by the given upper bounds. Sales are
+// streamed from the storage, so the memory used does not grow with them.
+// Returns ErrInvalidStatus for an unknown status, or ErrInvalidBuckets.
+func (s *Service) AmountDistribution(ctx context.Context, filter SalesFilter, bounds []money.Cents) (*Distribution, error) {
+	if filter.Status != "" && !filter.Status.Valid() {
+		return nil, ErrInvalidStatus
+	}
+	if !validBuckets(bounds) {
+		return nil, ErrInvalidBuckets
+	}
+
+	sketch := newAmountSketch()
+	counts := make([]int, len(bounds)+1)
+	add := func(sale *Sale) {
+		sketch.Add(sale.Amount)
+		i, _ := slices.BinarySearch(bounds, sale.Amount)
+		counts[i]++
+	}
+
+	err := s.storage.Iterate(ctx, func(sale *Sale) error {
+		if filter.Matches(sale) {
+			add(sale)
+		}
+		return nil
+	})
+	if err != nil {
+		s.log(ctx).Error("failed to iterate sales", zap.Error(err))
+		return nil, err
+	}
+	archived, err := s.archivedOnly(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	for _, sale := range archived {
+		add(sale)
+	}
+
+	d := &Distribution{
+		P50:     sketch.Quantile(0.5),
+		P90:     sketch.Quantile(0.9),
+		P99:     sketch.Quantile(0.99),
+		Buckets: make([]Bucket, len(counts)),
+	}
+	for i, count := range counts {
+		d.Buckets[i].Count = count
+		if i < len(bounds) {
+			d.Buckets[i].UpTo = &bounds[i]
+		}
+	}
+	return d, nil
+}
+
+// sketchAccuracy is the relative error of the quantiles of an amountSketch.
+const sketchAccuracy = 0.01
+
+// amountSketch estimates quantiles of a stream of amounts in constant
+// memory, as in DDSketch: amounts are counted in buckets whose bounds grow
+// geometrically, so any estimate is within sketchAccuracy of the exact
+// amount. Amounts up to MaxAmount need fewer than two thousand buckets.
+type amountSketch struct {
+	logGamma float64
+	counts   map[int]int // bucket index -> count
+	zero     int         // amounts of a cent or less
+	total    int
+}
+
+func newAmountSketch() *amountSketch {
+	gamma := (1 + sketchAccuracy) / (1 - sketchAccuracy)
+	return &amountSketch{logGamma: math.Log(gamma), counts: map[int]int{}}
+}
+
+// Add counts v.
+func (s *amountSketch) Add(v money.Cents) {
+	s.total++
+	if v <= 1 {
+		s.zero++
+		return
+	}
+	s.counts[int(math.Ceil(math.Log(float64(v))/s.logGamma))]++
+}
+
+// Quantile returns the estimated nearest-rank q-quantile of the counted
+// amounts: the smallest one that at least a fraction q of them do not
+// exceed. It returns 0 if none were counted.
+func (s *amountSketch) Quantile(q float64) money.Cents {
+	if s.total == 0 {
+		return 0
+	}
+	rank := max(int(math.Ceil(q*float64(s.total)))-1, 0)
+	if rank < s.zero {
+		return 1
+	}
+
+	seen, key := s.zero, 0
+	for _, key = range slices.Sorted(maps.Keys(s.counts)) {
+		if seen += s.counts[key]; seen > rank {
+			break
+		}
+	}
+	// el bucket (γ^(k-1), γ^k] se estima por el valor a igual error relativo de ambos bordes
+	gamma := math.Exp(s.logGamma)
+	return money.Cents(math.Round(2 * math.Pow(gamma, float64(key)) / (gamma + 1)))
+}
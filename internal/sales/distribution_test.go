@@ -0,0 +1,75 @@
+package sales
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+
+	"Ejercicio_Final-Taller_Go/internal/money"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestAmountSketch_Accuracy(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	sketch := newAmountSketch()
+	amounts := make([]money.Cents, 100000)
+	for i := range amounts {
+		// montos sesgados: muchas ventas chicas y pocas grandes
+		amounts[i] = money.Cents(r.ExpFloat64()*5000) + 1
+		sketch.Add(amounts[i])
+	}
+	slices.Sort(amounts)
+
+	for _, q := range []float64{0.5, 0.9, 0.99} {
+		exact := float64(amounts[int(math.Ceil(q*float64(len(amounts))))-1])
+		require.InEpsilon(t, exact, float64(sketch.Quantile(q)), sketchAccuracy+0.001, "p%v", q*100)
+	}
+	require.Zero(t, newAmountSketch().Quantile(0.5))
+}
+
+func TestParseBuckets(t *testing.T) {
+	bounds, err := ParseBuckets("10, 50.5,100")
+	require.NoError(t, err)
+	require.Equal(t, []money.Cents{1000, 5050, 10000}, bounds)
+
+	bounds, err = ParseBuckets("")
+	require.NoError(t, err)
+	require.Equal(t, DefaultBuckets, bounds)
+
+	for _, s := range []string{"10,10", "50,10", "0", "-5", "ten"} {
+		_, err := ParseBuckets(s)
+		require.ErrorIs(t, err, ErrInvalidBuckets, s)
+	}
+}
+
+func TestService_AmountDistribution(t *testing.T) {
+	ctx := context.Background()
+	storage := NewLocalStorage()
+	for i, amount := range []money.Cents{500, 1000, 1500, 20000, 90000} {
+		status := StatusApproved
+		if i == 0 {
+			status = StatusRejected
+		}
+		require.NoError(t, storage.Set(ctx, &Sale{ID: string(rune('a' + i)), UserID: "u", Amount: amount, Status: status}))
+	}
+	s := NewService(storage, zap.NewNop(), "")
+
+	d, err := s.AmountDistribution(ctx, SalesFilter{}, []money.Cents{1000, 10000})
+	require.NoError(t, err)
+	require.InEpsilon(t, 1500, float64(d.P50), sketchAccuracy)
+	require.Len(t, d.Buckets, 3)
+	require.Equal(t, []int{2, 1, 2}, []int{d.Buckets[0].Count, d.Buckets[1].Count, d.Buckets[2].Count})
+	require.EqualValues(t, 1000, *d.Buckets[0].UpTo)
+	require.Nil(t, d.Buckets[2].UpTo)
+
+	d, err = s.AmountDistribution(ctx, SalesFilter{Status: StatusRejected}, DefaultBuckets)
+	require.NoError(t, err)
+	require.InEpsilon(t, 500, float64(d.P99), sketchAccuracy)
+
+	_, err = s.AmountDistribution(ctx, SalesFilter{Status: "lost"}, DefaultBuckets)
+	require.ErrorIs(t, err, ErrInvalidStatus)
+}
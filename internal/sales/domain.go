@@ -1,14 +1,203 @@
 package sales
 
-import "time"
+import (
+	"encoding/xml"
+	"maps"
+	"slices"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/money"
+	"Ejercicio_Final-Taller_Go/internal/redact"
+
+	"go.uber.org/zap/zapcore"
+)
 
 // Sale represents a sales transaction in the system.
 type Sale struct {
-	ID        string    `json:"id"`
-	UserID    string    `json:"user_id"`
-	Amount    float64   `json:"amount"`
-	Status    string    `json:"status"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Version   int       `json:"version"`
+	XMLName xml.Name `json:"-" xml:"sale"`
+
+	ID     string      `json:"id" xml:"id"`
+	Number string      `json:"number" xml:"number"`
+	UserID string      `json:"user_id" xml:"user_id"`
+	Amount money.Cents `json:"amount" xml:"amount"`
+	Status SaleStatus  `json:"status" xml:"status"`
+	// AssignedTo is the reviewer who claimed the sale for manual review.
+	AssignedTo string `json:"assigned_to,omitempty" xml:"assigned_to,omitempty"`
+	// StatusReason and StatusChangedBy tell why and by whom the sale was
+	// approved or rejected, when the change said so (see Review).
+	StatusReason    string `json:"status_reason,omitempty" xml:"status_reason,omitempty"`
+	StatusChangedBy string `json:"status_changed_by,omitempty" xml:"status_changed_by,omitempty"`
+	// StatusChangedAt is when the sale got its current status; see StatusSince.
+	StatusChangedAt time.Time `json:"status_changed_at,omitzero" xml:"status_changed_at,omitempty"`
+	// RejectionReason is the code rejected sales were rejected with.
+	RejectionReason string `json:"rejection_reason,omitempty" xml:"rejection_reason,omitempty"`
+	// CreatedBy is the authenticated actor that created the sale, such as
+	// "apikey:" and the ID of its API key (see audit.WithActor).
+	CreatedBy string `json:"created_by,omitempty" xml:"created_by,omitempty"`
+	// Metadata, Tags and Notes are free-form data set through PatchSale.
+	// They are replaced, never modified in place, so copies may share them.
+	Metadata  Metadata  `json:"metadata,omitempty" xml:"metadata,omitempty"`
+	Tags      []string  `json:"tags,omitempty" xml:"tag,omitempty"`
+	Notes     string    `json:"notes,omitempty" xml:"notes,omitempty"`
+	CreatedAt time.Time `json:"created_at" xml:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" xml:"updated_at"`
+	Version   int       `json:"version" xml:"version"`
+	// Archived marks sales served from the archive instead of the primary
+	// store (see Archive); they must be un-archived before being modified.
+	Archived bool `json:"archived,omitempty" xml:"archived,omitempty"`
+
+	// OperatorNotes are the notes left on the sale, oldest first (see AddNote).
+	OperatorNotes []Note `json:"operator_notes,omitempty" xml:"operator_note,omitempty"`
+	// Attachments describe the files attached to the sale, oldest first
+	// (see AddAttachment).
+	Attachments []Attachment `json:"attachments,omitempty" xml:"attachment,omitempty"`
+
+	// wrappedKey is the wrapped data key the free-form fields of a stored
+	// copy are encrypted with (see EncryptedStorage); nil in plaintext copies.
+	wrappedKey []byte
+}
+
+// Metadata holds key/value pairs attached to a sale.
+type Metadata map[string]string
+
+// clone returns a copy of m.
+func (m Metadata) clone() Metadata {
+	return maps.Clone(m)
+}
+
+// metadataEntry is how each pair of a Metadata is written in XML, since
+// keys need not be valid element names.
+type metadataEntry struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// MarshalXML writes m as <entry key="...">value</entry> elements, sorted by key.
+func (m Metadata) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, k := range slices.Sorted(maps.Keys(m)) {
+		if err := enc.EncodeElement(metadataEntry{Key: k, Value: m[k]}, xml.StartElement{Name: xml.Name{Local: "entry"}}); err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// UnmarshalXML reads the elements written by MarshalXML.
+func (m *Metadata) UnmarshalXML(dec *xml.Decoder, start xml.StartElement) error {
+	var entries struct {
+		Entries []metadataEntry `xml:"entry"`
+	}
+	if err := dec.DecodeElement(&entries, &start); err != nil {
+		return err
+	}
+	*m = Metadata{}
+	for _, e := range entries.Entries {
+		(*m)[e.Key] = e.Value
+	}
+	return nil
+}
+
+// copySale returns a copy of s that shares nothing with it.
+func copySale(s *Sale) *Sale {
+	c := *s
+	c.Metadata = s.Metadata.clone()
+	c.Tags = slices.Clone(s.Tags)
+	c.OperatorNotes = slices.Clone(s.OperatorNotes)
+	c.Attachments = slices.Clone(s.Attachments)
+	return &c
+}
+
+// StatusSince returns when the sale got its current status. Sales stored
+// before it was recorded count from their creation.
+func (s *Sale) StatusSince() time.Time {
+	if s.StatusChangedAt.IsZero() {
+		return s.CreatedAt
+	}
+	return s.StatusChangedAt
+}
+
+// EntityID returns the ID the sale is stored under.
+func (s *Sale) EntityID() string {
+	return s.ID
+}
+
+// MarshalLogObject logs the sale without personal data: reviewers are masked.
+func (s *Sale) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("id", s.ID)
+	enc.AddString("number", s.Number)
+	enc.AddString("user_id", s.UserID)
+	enc.AddString("amount", s.Amount.String())
+	enc.AddString("status", string(s.Status))
+	if s.AssignedTo != "" {
+		enc.AddString("assigned_to", redact.Mask(s.AssignedTo))
+	}
+	if s.StatusChangedBy != "" {
+		enc.AddString("status_changed_by", redact.Mask(s.StatusChangedBy))
+	}
+	enc.AddInt("version", s.Version)
+	return nil
+}
+
+// SalesMetadata summarizes a set of sales.
+type SalesMetadata struct {
+	Quantity    int         `json:"quantity" xml:"quantity"`
+	Approved    int         `json:"approved" xml:"approved"`
+	Rejected    int         `json:"rejected" xml:"rejected"`
+	Pending     int         `json:"pending" xml:"pending"`
+	TotalAmount money.Cents `json:"total_amount" xml:"total_amount"`
+}
+
+// Add counts sale into m.
+func (m *SalesMetadata) Add(sale *Sale) {
+	m.Quantity++
+	m.TotalAmount += sale.Amount
+	switch sale.Status {
+	case StatusApproved:
+		m.Approved++
+	case StatusRejected:
+		m.Rejected++
+	case StatusPending:
+		m.Pending++
+	}
+}
+
+// Dashboard is the admin summary of activity since a given instant.
+type Dashboard struct {
+	Since            time.Time   `json:"since"`
+	SalesCount       int         `json:"sales_count"`
+	Revenue          money.Cents `json:"revenue"`
+	PendingApprovals int         `json:"pending_approvals"`
+	RejectionRate    float64     `json:"rejection_rate"`
+	TopUsers         []UserTotal `json:"top_users"`
+}
+
+// UserTotal is the sales volume of one user.
+type UserTotal struct {
+	UserID      string      `json:"user_id"`
+	Quantity    int         `json:"quantity"`
+	TotalAmount money.Cents `json:"total_amount"`
+}
+
+// UserSummary is the sales activity of a single user.
+type UserSummary struct {
+	SalesMetadata
+	LastSaleAt *time.Time `json:"last_sale_at" xml:"last_sale_at,omitempty"`
+}
+
+// SellerTotal is the sales activity of the sales created by one seller.
+// Revenue only counts approved sales.
+type SellerTotal struct {
+	Seller string `json:"seller" xml:"seller"`
+	SalesMetadata
+	Revenue money.Cents `json:"revenue" xml:"revenue"`
+}
+
+// Volume counts the sales created in a time window starting at From.
+type Volume struct {
+	From     time.Time `json:"from"`
+	Total    int       `json:"total"`
+	Rejected int       `json:"rejected"`
 }
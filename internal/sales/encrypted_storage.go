@@ -0,0 +1,274 @@
+package sales
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/envelope"
+)
+
+// EncryptedStorage wraps a Storage so the free-form data of sales (notes,
+// metadata values, operator notes and attachment names) is kept encrypted
+// in it and decrypted on read. Each sale gets its own data key, wrapped by
+// the cipher's KMS key, which is kept while the sale is stored; values that
+// did not change keep their ciphertext, so a write is still recorded as the
+// specific change it made (see EventSourcedStorage).
+type EncryptedStorage struct {
+	inner  Storage
+	cipher *envelope.Cipher
+}
+
+// NewEncryptedStorage returns inner with the free-form data of sales encrypted by cipher.
+func NewEncryptedStorage(inner Storage, cipher *envelope.Cipher) *EncryptedStorage {
+	return &EncryptedStorage{inner: inner, cipher: cipher}
+}
+
+// sealFields replaces each field of sale that is encrypted at rest by the
+// result of fn, which gets a name identifying the field across versions of
+// the sale. sale must not share its metadata or notes (see copySale).
+func sealFields(sale *Sale, fn func(name, value string) (string, error)) error {
+	var err error
+	if sale.Notes, err = fn("notes", sale.Notes); err != nil {
+		return err
+	}
+	for k, v := range sale.Metadata {
+		if sale.Metadata[k], err = fn("metadata/"+k, v); err != nil {
+			return err
+		}
+	}
+	for i := range sale.OperatorNotes {
+		n := &sale.OperatorNotes[i]
+		if n.Text, err = fn("note/"+n.ID, n.Text); err != nil {
+			return err
+		}
+	}
+	for i := range sale.Attachments {
+		a := &sale.Attachments[i]
+		if a.Name, err = fn("attachment/"+a.ID, a.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Set stores an encrypted copy of sale; sale itself is left untouched.
+// The stored version of the sale is read first, to reuse its data key and
+// the ciphertext of the values that did not change.
+func (e *EncryptedStorage) Set(ctx context.Context, sale *Sale) error {
+	stored := copySale(sale)
+	sealed := map[string][2]string{} // campo -> texto plano y cifrado guardados
+	prev, err := e.inner.Read(ctx, sale.ID)
+	switch {
+	case errors.Is(err, ErrNotFound):
+	case err != nil:
+		return err
+	case prev.wrappedKey != nil:
+		prevKey, err := e.cipher.DataKey(ctx, prev.wrappedKey)
+		if err != nil {
+			return err
+		}
+		err = sealFields(copySale(prev), func(name, value string) (string, error) {
+			plain, err := envelope.Decrypt(prevKey, value)
+			sealed[name] = [2]string{plain, value}
+			return plain, err
+		})
+		if err != nil {
+			return fmt.Errorf("error decrypting sale %s: %w", sale.ID, err)
+		}
+		stored.wrappedKey = prev.wrappedKey
+	}
+
+	var dataKey []byte
+	if stored.wrappedKey != nil {
+		dataKey, err = e.cipher.DataKey(ctx, stored.wrappedKey)
+	} else {
+		dataKey, stored.wrappedKey, err = e.cipher.NewDataKey(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	err = sealFields(stored, func(name, value string) (string, error) {
+		if s, ok := sealed[name]; ok && s[0] == value {
+			return s[1], nil
+		}
+		return envelope.Encrypt(dataKey, value)
+	})
+	if err != nil {
+		return fmt.Errorf("error encrypting sale %s: %w", sale.ID, err)
+	}
+	return e.inner.Set(ctx, stored)
+}
+
+// Read returns a decrypted copy of the stored sale.
+func (e *EncryptedStorage) Read(ctx context.Context, id string) (*Sale, error) {
+	stored, err := e.inner.Read(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return e.decrypt(ctx, stored)
+}
+
+// ReadByNumber returns a decrypted copy of the sale with the given number,
+// which is not encrypted so it can be looked up.
+func (e *EncryptedStorage) ReadByNumber(ctx context.Context, number string) (*Sale, error) {
+	stored, err := e.inner.ReadByNumber(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	return e.decrypt(ctx, stored)
+}
+
+// GetAll returns decrypted copies of every sale.
+func (e *EncryptedStorage) GetAll(ctx context.Context) ([]*Sale, error) {
+	stored, err := e.inner.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return e.decryptAll(ctx, stored)
+}
+
+// Search returns decrypted copies of the sales matching filter, whose
+// conditions are all on fields that are not encrypted.
+func (e *EncryptedStorage) Search(ctx context.Context, filter SalesFilter) ([]*Sale, error) {
+	stored, err := e.inner.Search(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	return e.decryptAll(ctx, stored)
+}
+
+// Iterate calls fn with a decrypted copy of every sale.
+func (e *EncryptedStorage) Iterate(ctx context.Context, fn func(*Sale) error) error {
+	return e.inner.Iterate(ctx, func(stored *Sale) error {
+		sale, err := e.decrypt(ctx, stored)
+		if err != nil {
+			return err
+		}
+		return fn(sale)
+	})
+}
+
+func (e *EncryptedStorage) Aggregate(ctx context.Context, filter SalesFilter) (*SalesMetadata, error) {
+	return e.inner.Aggregate(ctx, filter)
+}
+
+func (e *EncryptedStorage) GroupSales(ctx context.Context, filter SalesFilter, g GroupBy) ([]SalesGroup, error) {
+	return e.inner.GroupSales(ctx, filter, g)
+}
+
+func (e *EncryptedStorage) NextNumber(ctx context.Context, at time.Time) (string, error) {
+	return e.inner.NextNumber(ctx, at)
+}
+
+func (e *EncryptedStorage) Dashboard(ctx context.Context, since time.Time, topUsers int) (*Dashboard, error) {
+	return e.inner.Dashboard(ctx, since, topUsers)
+}
+
+func (e *EncryptedStorage) Ping(ctx context.Context) error {
+	return e.inner.Ping(ctx)
+}
+
+func (e *EncryptedStorage) Delete(ctx context.Context, id string) error {
+	return e.inner.Delete(ctx, id)
+}
+
+func (e *EncryptedStorage) Tenants(ctx context.Context) ([]string, error) {
+	return e.inner.Tenants(ctx)
+}
+
+// WithTx runs fn in a transaction of the wrapped storage, which fn also sees encrypted.
+func (e *EncryptedStorage) WithTx(ctx context.Context, fn func(tx Storage) error) error {
+	return e.inner.WithTx(ctx, func(tx Storage) error {
+		return fn(&EncryptedStorage{inner: tx, cipher: e.cipher})
+	})
+}
+
+// History returns the history of the wrapped storage with the sales and
+// notes of its events decrypted, if it keeps one (see Historian). Returns
+// ErrHistoryUnavailable otherwise.
+func (e *EncryptedStorage) History(ctx context.Context, id string) ([]StreamEvent, error) {
+	h, ok := e.inner.(Historian)
+	if !ok {
+		return nil, ErrHistoryUnavailable
+	}
+	stored, err := h.History(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]StreamEvent, len(stored))
+	var wrappedKey []byte // clave de la venta en cada momento de su historia
+	for i, ev := range stored {
+		if ev.Sale != nil {
+			wrappedKey = ev.Sale.wrappedKey
+			if ev.Sale, err = e.decrypt(ctx, ev.Sale); err != nil {
+				return nil, err
+			}
+		}
+		if ev.Note != nil && wrappedKey != nil {
+			dataKey, err := e.cipher.DataKey(ctx, wrappedKey)
+			if err != nil {
+				return nil, err
+			}
+			note := *ev.Note
+			if note.Text, err = envelope.Decrypt(dataKey, note.Text); err != nil {
+				return nil, fmt.Errorf("error decrypting sale %s: %w", id, err)
+			}
+			ev.Note = &note
+		}
+		events[i] = ev
+	}
+	return events, nil
+}
+
+// StateAt returns a decrypted copy of the sale as the wrapped storage
+// rebuilds it, if it keeps a history (see Historian). Returns
+// ErrHistoryUnavailable otherwise.
+func (e *EncryptedStorage) StateAt(ctx context.Context, id string, at time.Time) (*Sale, error) {
+	h, ok := e.inner.(Historian)
+	if !ok {
+		return nil, ErrHistoryUnavailable
+	}
+	stored, err := h.StateAt(ctx, id, at)
+	if err != nil {
+		return nil, err
+	}
+	return e.decrypt(ctx, stored)
+}
+
+// decryptAll returns plaintext copies of stored.
+func (e *EncryptedStorage) decryptAll(ctx context.Context, stored []*Sale) ([]*Sale, error) {
+	sales := make([]*Sale, 0, len(stored))
+	for _, s := range stored {
+		sale, err := e.decrypt(ctx, s)
+		if err != nil {
+			return nil, err
+		}
+		sales = append(sales, sale)
+	}
+	return sales, nil
+}
+
+// decrypt returns a plaintext copy of stored. Sales stored before
+// encryption was enabled have no data key and are returned as they are.
+func (e *EncryptedStorage) decrypt(ctx context.Context, stored *Sale) (*Sale, error) {
+	sale := copySale(stored)
+	sale.wrappedKey = nil
+	if stored.wrappedKey == nil {
+		return sale, nil
+	}
+
+	dataKey, err := e.cipher.DataKey(ctx, stored.wrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	err = sealFields(sale, func(_, value string) (string, error) {
+		return envelope.Decrypt(dataKey, value)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting sale %s: %w", sale.ID, err)
+	}
+	return sale, nil
+}
@@ -0,0 +1,69 @@
+package sales
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/clock"
+	"Ejercicio_Final-Taller_Go/internal/envelope"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestEncryptedStorage(t *testing.T) {
+	ctx := context.Background()
+	kek, err := envelope.LocalKey(bytes.Repeat([]byte{7}, 32))
+	require.NoError(t, err)
+
+	start := time.Date(2024, 3, 10, 15, 0, 0, 0, time.UTC)
+	clk := clock.NewManual(start)
+	inner := NewEventSourcedStorage(0, WithEventClock(clk))
+	storage := NewEncryptedStorage(inner, envelope.New(kek))
+	s := NewService(storage, zap.NewNop(), "", WithClock(clk))
+
+	sale := &Sale{ID: "1", Number: "2024-000001", UserID: "a", Amount: 1000, Status: StatusPending,
+		Metadata: Metadata{"cliente": "Ayrton Senna"}, Notes: "llamar al 555-1234",
+		Attachments: []Attachment{{ID: "f", Name: "dni-ayrton.pdf"}},
+		CreatedAt:   start, UpdatedAt: start, Version: 1}
+	require.NoError(t, storage.Set(ctx, sale))
+	require.Equal(t, "llamar al 555-1234", sale.Notes)
+
+	raw, err := inner.Read(ctx, "1")
+	require.NoError(t, err)
+	require.NotContains(t, raw.Notes, "555")
+	require.NotContains(t, raw.Metadata["cliente"], "Ayrton")
+	require.NotContains(t, raw.Attachments[0].Name, "ayrton")
+
+	got, err := storage.Read(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, sale, got)
+	got, err = storage.ReadByNumber(ctx, "2024-000001")
+	require.NoError(t, err)
+	require.Equal(t, sale, got)
+	list, err := storage.GetAll(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []*Sale{sale}, list)
+
+	// los valores sin cambios conservan su cifrado, así la nota se registra como tal
+	clk.Advance(time.Minute)
+	_, err = s.AddNote(ctx, "1", "pagó en efectivo")
+	require.NoError(t, err)
+	after, err := inner.Read(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, raw.Notes, after.Notes)
+	require.NotContains(t, after.OperatorNotes[0].Text, "efectivo")
+
+	events, err := s.SaleHistory(ctx, "1")
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	require.Equal(t, sale, events[0].Sale)
+	require.Equal(t, StreamNoted, events[1].Type)
+	require.Equal(t, "pagó en efectivo", events[1].Note.Text)
+
+	past, err := s.SaleAt(ctx, "1", start)
+	require.NoError(t, err)
+	require.Equal(t, sale, past)
+}
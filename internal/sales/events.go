@@ -0,0 +1,44 @@
+package sales
+
+import "context"
+
+// EventType identifies what happened to a sale.
+type EventType string
+
+const (
+	// EventCreated is emitted after a new sale is stored.
+	EventCreated EventType = "sale.created"
+	// EventStatusChanged is emitted after a sale moves to a new status.
+	EventStatusChanged EventType = "sale.status_changed"
+	// EventUpdated is emitted after other fields of a sale change (see PatchSale).
+	EventUpdated EventType = "sale.updated"
+)
+
+// Event describes a change to a sale. Sale is a copy taken right after the
+// change was stored, so hooks may keep it without racing later updates.
+// Previous is the sale right before the change, nil for EventCreated.
+type Event struct {
+	Type           EventType
+	Sale           Sale
+	PreviousStatus SaleStatus
+	Previous       *Sale
+}
+
+// Hook is called synchronously after every stored change. Hooks must not
+// block: slow work such as network calls has to be handed off. The context
+// is the one of the originating request and carries its tenant.
+type Hook func(ctx context.Context, e Event)
+
+// WithHooks registers hooks called on sale events, in order.
+func WithHooks(hooks ...Hook) Option {
+	return func(s *Service) {
+		s.hooks = append(s.hooks, hooks...)
+	}
+}
+
+// emit calls every registered hook with e.
+func (s *Service) emit(ctx context.Context, e Event) {
+	for _, hook := range s.hooks {
+		hook(ctx, e)
+	}
+}
@@ -0,0 +1,327 @@
+package sales
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/apperrors"
+	"Ejercicio_Final-Taller_Go/internal/clock"
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+)
+
+// ErrHistoryUnavailable is returned when asking for the history of a sale
+// and the storage does not keep one (see EventSourcedStorage).
+var ErrHistoryUnavailable = apperrors.New(apperrors.NotFound, "history_unavailable", "sale history is not recorded")
+
+// StreamEventType identifies a change recorded in the stream of a sale.
+type StreamEventType string
+
+const (
+	// StreamCreated records a new sale; Sale holds it in full.
+	StreamCreated StreamEventType = "created"
+	// StreamStatusChanged records a move from PreviousStatus to Status, made
+	// by Actor for Reason and RejectionReason when given.
+	StreamStatusChanged StreamEventType = "status_changed"
+	// StreamClaimed records the sale being claimed by AssignedTo.
+	StreamClaimed StreamEventType = "claimed"
+	// StreamUpdated records any other change; Sale holds the new state in full.
+	StreamUpdated StreamEventType = "updated"
+	// StreamNoted records Note being added to the sale by its author.
+	StreamNoted StreamEventType = "noted"
+	// StreamDeleted records the sale leaving the store, e.g. to the archive.
+	StreamDeleted StreamEventType = "deleted"
+)
+
+// StreamEvent is one entry of the append-only stream of a sale. At and
+// Version are those of the sale right after the change.
+type StreamEvent struct {
+	Seq             int             `json:"seq"`
+	Type            StreamEventType `json:"type"`
+	At              time.Time       `json:"at"`
+	Version         int             `json:"version"`
+	Status          SaleStatus      `json:"status,omitempty"`
+	PreviousStatus  SaleStatus      `json:"previous_status,omitempty"`
+	AssignedTo      string          `json:"assigned_to,omitempty"`
+	Actor           string          `json:"actor,omitempty"`
+	Reason          string          `json:"reason,omitempty"`
+	RejectionReason string          `json:"rejection_reason,omitempty"`
+	Note            *Note           `json:"note,omitempty"`
+	Sale            *Sale           `json:"sale,omitempty"`
+}
+
+// Historian is implemented by storages that keep the history of each sale.
+type Historian interface {
+	// History returns the events of the sale with the given ID, oldest first.
+	History(ctx context.Context, id string) ([]StreamEvent, error)
+	// StateAt rebuilds the sale with the given ID as it was at the given
+	// instant. Returns ErrNotFound if it did not exist then.
+	StateAt(ctx context.Context, id string, at time.Time) (*Sale, error)
+}
+
+// EventSourcedStorage stores every sale as an append-only stream of events,
+// from which any past state can be rebuilt exactly. Each write is turned
+// into the events that explain it, so Service code is unaware of it. Reads
+// and queries are served by a LocalStorage projection holding the current
+// state. Every snapshotEvery events a snapshot of the sale is kept, so
+// rebuilding does not replay whole streams. It is safe for concurrent use.
+type EventSourcedStorage struct {
+	*LocalStorage
+
+	snapshotEvery int
+	clock         clock.Clock
+
+	mu      sync.Mutex
+	streams map[string]*stream // tenant + ID -> stream
+}
+
+// stream is the history of a single sale.
+type stream struct {
+	events    []StreamEvent
+	snapshots []snapshot
+	current   Sale // estado luego del último evento, copiado para no compartirlo
+	deleted   bool
+}
+
+// snapshot is the state of a sale after the event numbered Seq.
+type snapshot struct {
+	Seq     int
+	Sale    Sale
+	Deleted bool
+}
+
+// EventStorageOption configures optional dependencies of an EventSourcedStorage.
+type EventStorageOption func(*EventSourcedStorage)
+
+// WithEventClock sets the clock that dates the deletions, the only events
+// not dated by the sale itself. Defaults to the system clock.
+func WithEventClock(c clock.Clock) EventStorageOption {
+	return func(e *EventSourcedStorage) {
+		e.clock = c
+	}
+}
+
+// NewEventSourcedStorage creates an empty EventSourcedStorage taking a
+// snapshot every snapshotEvery events; values below 1 disable snapshots.
+func NewEventSourcedStorage(snapshotEvery int, opts ...EventStorageOption) *EventSourcedStorage {
+	e := &EventSourcedStorage{
+		LocalStorage:  NewLocalStorage(),
+		snapshotEvery: snapshotEvery,
+		clock:         clock.System(),
+		streams:       map[string]*stream{},
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// WithTx runs fn on e itself, so writes inside it are recorded as events.
+func (e *EventSourcedStorage) WithTx(ctx context.Context, fn func(tx Storage) error) error {
+	return fn(e)
+}
+
+// Set appends the events that turn the previous state of sale into the
+// given one, then updates the projection.
+func (e *EventSourcedStorage) Set(ctx context.Context, sale *Sale) error {
+	if sale.ID == "" {
+		return ErrEmptyID
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	key := streamKey(ctx, sale.ID)
+	st, ok := e.streams[key]
+	if !ok {
+		st = &stream{}
+		e.streams[key] = st
+	}
+	for _, ev := range changes(st, sale) {
+		e.append(st, ev)
+	}
+	return e.LocalStorage.Set(ctx, sale)
+}
+
+// Delete appends a deleted event and removes the sale from the projection.
+func (e *EventSourcedStorage) Delete(ctx context.Context, id string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.LocalStorage.Delete(ctx, id); err != nil {
+		return err
+	}
+	if st, ok := e.streams[streamKey(ctx, id)]; ok {
+		e.append(st, StreamEvent{Type: StreamDeleted, At: e.clock.Now(), Version: st.current.Version})
+	}
+	return nil
+}
+
+// History returns the events of the sale with the given ID, oldest first.
+// Returns ErrNotFound if the sale never existed.
+func (e *EventSourcedStorage) History(ctx context.Context, id string) ([]StreamEvent, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	st, ok := e.streams[streamKey(ctx, id)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	events := make([]StreamEvent, len(st.events))
+	for i, ev := range st.events {
+		events[i] = ev.clone()
+	}
+	return events, nil
+}
+
+// StateAt rebuilds the sale with the given ID from its latest snapshot
+// taken at or before at and the events that followed it.
+func (e *EventSourcedStorage) StateAt(ctx context.Context, id string, at time.Time) (*Sale, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	st, ok := e.streams[streamKey(ctx, id)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	// hasta dónde llega la historia a esa fecha
+	last := 0
+	for _, ev := range st.events {
+		if ev.At.After(at) {
+			break
+		}
+		last = ev.Seq
+	}
+	if last == 0 {
+		return nil, ErrNotFound
+	}
+
+	var sale Sale
+	var deleted bool
+	from := 0
+	for _, snap := range st.snapshots {
+		if snap.Seq > last {
+			break
+		}
+		sale, deleted, from = snap.Sale, snap.Deleted, snap.Seq
+	}
+	for _, ev := range st.events[from:last] {
+		deleted = apply(&sale, ev)
+	}
+	if deleted {
+		return nil, ErrNotFound
+	}
+	return &sale, nil
+}
+
+// append numbers ev, applies it to the stream and takes a snapshot when due.
+// Callers must hold e.mu.
+func (e *EventSourcedStorage) append(st *stream, ev StreamEvent) {
+	ev.Seq = len(st.events) + 1
+	st.events = append(st.events, ev)
+	st.deleted = apply(&st.current, ev)
+
+	if e.snapshotEvery > 0 && ev.Seq%e.snapshotEvery == 0 {
+		st.snapshots = append(st.snapshots, snapshot{Seq: ev.Seq, Sale: st.current, Deleted: st.deleted})
+	}
+}
+
+// changes returns the events that take the stream from its current state
+// to sale: the specific events when they explain the whole change, or a
+// single updated event otherwise.
+func changes(st *stream, sale *Sale) []StreamEvent {
+	if len(st.events) == 0 || st.deleted {
+		return []StreamEvent{{Type: StreamCreated, At: sale.UpdatedAt, Version: sale.Version, Sale: copySale(sale)}}
+	}
+
+	prev := st.current
+	var events []StreamEvent
+	if sale.Status != prev.Status {
+		events = append(events, StreamEvent{Type: StreamStatusChanged, Status: sale.Status, PreviousStatus: prev.Status,
+			Actor: sale.StatusChangedBy, Reason: sale.StatusReason, RejectionReason: sale.RejectionReason})
+	}
+	if sale.AssignedTo != prev.AssignedTo && sale.AssignedTo != "" {
+		events = append(events, StreamEvent{Type: StreamClaimed, AssignedTo: sale.AssignedTo})
+	}
+	if n := len(prev.OperatorNotes); len(sale.OperatorNotes) == n+1 {
+		note := sale.OperatorNotes[n]
+		events = append(events, StreamEvent{Type: StreamNoted, Actor: note.Author, Note: &note})
+	}
+
+	expected := prev
+	for i := range events {
+		events[i].At, events[i].Version = sale.UpdatedAt, sale.Version
+		apply(&expected, events[i])
+	}
+	switch {
+	case sameSale(expected, *sale) && len(events) > 0:
+		return events
+	case sameSale(prev, *sale):
+		return nil
+	default:
+		return []StreamEvent{{Type: StreamUpdated, At: sale.UpdatedAt, Version: sale.Version, Sale: copySale(sale)}}
+	}
+}
+
+// apply changes sale as recorded by ev and reports whether the sale is
+// deleted afterwards.
+func apply(sale *Sale, ev StreamEvent) bool {
+	switch ev.Type {
+	case StreamCreated, StreamUpdated:
+		*sale = *ev.Sale
+		return false
+	case StreamStatusChanged:
+		sale.Status, sale.StatusChangedAt = ev.Status, ev.At
+		sale.StatusChangedBy, sale.StatusReason = ev.Actor, ev.Reason
+		sale.RejectionReason = ev.RejectionReason
+	case StreamClaimed:
+		sale.AssignedTo = ev.AssignedTo
+	case StreamNoted:
+		sale.OperatorNotes = append(slices.Clone(sale.OperatorNotes), *ev.Note)
+	case StreamDeleted:
+		return true
+	}
+	sale.UpdatedAt, sale.Version = ev.At, ev.Version
+	return false
+}
+
+// clone returns a copy of ev that does not share its Sale.
+func (ev StreamEvent) clone() StreamEvent {
+	if ev.Sale != nil {
+		ev.Sale = copySale(ev.Sale)
+	}
+	return ev
+}
+
+// sameSale reports whether a and b hold the same values.
+func sameSale(a, b Sale) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+// streamKey scopes a sale ID to the tenant in ctx.
+func streamKey(ctx context.Context, id string) string {
+	return tenant.FromContext(ctx) + "/" + id
+}
+
+// SaleHistory returns the recorded events of a sale, oldest first.
+// Returns ErrHistoryUnavailable if the storage keeps no history.
+func (s *Service) SaleHistory(ctx context.Context, id string) ([]StreamEvent, error) {
+	h, ok := s.storage.(Historian)
+	if !ok {
+		return nil, ErrHistoryUnavailable
+	}
+	return h.History(ctx, id)
+}
+
+// SaleAt returns a sale as it was at the given instant.
+// Returns ErrHistoryUnavailable if the storage keeps no history.
+func (s *Service) SaleAt(ctx context.Context, id string, at time.Time) (*Sale, error) {
+	h, ok := s.storage.(Historian)
+	if !ok {
+		return nil, ErrHistoryUnavailable
+	}
+	return h.StateAt(ctx, id, at)
+}
@@ -0,0 +1,73 @@
+package sales
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/clock"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestEventSourcedStorage_History(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2024, 3, 10, 15, 0, 0, 0, time.UTC)
+	clk := clock.NewManual(start)
+	storage := NewEventSourcedStorage(2, WithEventClock(clk))
+	s := NewService(storage, zap.NewNop(), "", WithClock(clk))
+
+	require.NoError(t, storage.Set(ctx, &Sale{ID: "1", UserID: "a", Amount: 1000, Status: StatusPending, CreatedAt: start, UpdatedAt: start, Version: 1}))
+	clk.Advance(time.Minute)
+	_, err := s.ClaimSale(ctx, "1", "ana")
+	require.NoError(t, err)
+	clk.Advance(time.Minute)
+	_, err = s.UpdateSaleStatus(ctx, "1", StatusApproved)
+	require.NoError(t, err)
+
+	events, err := s.SaleHistory(ctx, "1")
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	require.Equal(t, StreamCreated, events[0].Type)
+	require.Equal(t, StreamClaimed, events[1].Type)
+	require.Equal(t, "ana", events[1].AssignedTo)
+	require.Equal(t, StreamStatusChanged, events[2].Type)
+	require.Equal(t, StatusPending, events[2].PreviousStatus)
+	require.Equal(t, StatusApproved, events[2].Status)
+
+	// cada estado intermedio se reconstruye igual a como se guardó
+	current, err := s.GetSale(ctx, "1")
+	require.NoError(t, err)
+	latest, err := s.SaleAt(ctx, "1", clk.Now())
+	require.NoError(t, err)
+	require.Equal(t, *current, *latest)
+
+	claimed, err := s.SaleAt(ctx, "1", start.Add(90*time.Second))
+	require.NoError(t, err)
+	require.Equal(t, StatusPending, claimed.Status)
+	require.Equal(t, "ana", claimed.AssignedTo)
+	require.Equal(t, 2, claimed.Version)
+
+	_, err = s.SaleAt(ctx, "1", start.Add(-time.Second))
+	require.ErrorIs(t, err, ErrNotFound)
+
+	clk.Advance(time.Minute)
+	require.NoError(t, storage.Delete(ctx, "1"))
+	_, err = s.SaleAt(ctx, "1", clk.Now())
+	require.ErrorIs(t, err, ErrNotFound)
+	// antes de borrarse seguía aprobada
+	sale, err := s.SaleAt(ctx, "1", clk.Now().Add(-time.Second))
+	require.NoError(t, err)
+	require.Equal(t, StatusApproved, sale.Status)
+	events, err = s.SaleHistory(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, StreamDeleted, events[3].Type)
+	require.Equal(t, clk.Now(), events[3].At)
+}
+
+func TestService_SaleHistory_Unavailable(t *testing.T) {
+	s := NewService(NewLocalStorage(), zap.NewNop(), "")
+	_, err := s.SaleHistory(context.Background(), "1")
+	require.ErrorIs(t, err, ErrHistoryUnavailable)
+}
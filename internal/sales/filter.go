@@ -0,0 +1,176 @@
+package sales
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/apperrors"
+	"Ejercicio_Final-Taller_Go/internal/money"
+)
+
+// ErrInvalidFilter is returned for a filter expression that cannot be parsed.
+var ErrInvalidFilter = apperrors.New(apperrors.Validation, "invalid_filter", "invalid filter expression")
+
+// SalesFilter selects sales by field. Zero fields match every sale and the
+// bounds are inclusive.
+type SalesFilter struct {
+	UserID     string
+	Status     SaleStatus
+	AssignedTo string
+	// RejectionReason keeps only the sales rejected with that code.
+	RejectionReason string
+
+	MinAmount *money.Cents
+	MaxAmount *money.Cents
+
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+}
+
+// Matches reports whether sale passes every condition of f.
+func (f SalesFilter) Matches(sale *Sale) bool {
+	switch {
+	case f.UserID != "" && sale.UserID != f.UserID:
+		return false
+	case f.Status != "" && sale.Status != f.Status:
+		return false
+	case f.AssignedTo != "" && sale.AssignedTo != f.AssignedTo:
+		return false
+	case f.RejectionReason != "" && sale.RejectionReason != f.RejectionReason:
+		return false
+	case f.MinAmount != nil && sale.Amount < *f.MinAmount:
+		return false
+	case f.MaxAmount != nil && sale.Amount > *f.MaxAmount:
+		return false
+	case f.CreatedFrom != nil && sale.CreatedAt.Before(*f.CreatedFrom):
+		return false
+	case f.CreatedTo != nil && sale.CreatedAt.After(*f.CreatedTo):
+		return false
+	}
+	return true
+}
+
+// byUserAndStatus reports whether f filters on nothing but user and status,
+// so the read model can answer it.
+func (f SalesFilter) byUserAndStatus() bool {
+	return f.AssignedTo == "" && f.RejectionReason == "" && f.MinAmount == nil && f.MaxAmount == nil && f.CreatedFrom == nil && f.CreatedTo == nil
+}
+
+// maxFilterLength caps filter expressions; real ones are a few conditions long.
+const maxFilterLength = 1024
+
+// filterTerm matches a single "<field><op><value>" condition.
+var filterTerm = regexp.MustCompile(`^([a-z_]+)\s*(>=|<=|>|<|:|=)\s*(.+)$`)
+
+// filterAnd separates the conditions of an expression.
+var filterAnd = regexp.MustCompile(`\s+(?i:and)\s+`)
+
+// ParseFilter parses a compact filter expression such as
+//
+//	status:approved AND amount>100 AND created_at>=2024-01-01
+//
+// into a SalesFilter. Conditions are joined with AND. user_id, status,
+// assigned_to and rejection_reason accept ":" or "="; amount (a decimal such as 100.50) and
+// created_at (a date or an RFC 3339 timestamp, dates being midnight UTC)
+// also accept >, >=, < and <=. Returns ErrInvalidFilter for anything else.
+func ParseFilter(expr string) (SalesFilter, error) {
+	var f SalesFilter
+	if len(expr) > maxFilterLength {
+		return f, fmt.Errorf("%w: longer than %d bytes", ErrInvalidFilter, maxFilterLength)
+	}
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return f, nil
+	}
+
+	for _, term := range filterAnd.Split(expr, -1) {
+		m := filterTerm.FindStringSubmatch(strings.TrimSpace(term))
+		if m == nil {
+			return SalesFilter{}, fmt.Errorf("%w: %q", ErrInvalidFilter, term)
+		}
+		if err := f.apply(m[1], m[2], strings.TrimSpace(m[3])); err != nil {
+			return SalesFilter{}, fmt.Errorf("%w: %q: %v", ErrInvalidFilter, term, err)
+		}
+	}
+	return f, nil
+}
+
+// apply adds the condition "field op value" to f.
+func (f *SalesFilter) apply(field, op, value string) error {
+	equality := op == ":" || op == "="
+
+	switch field {
+	case "user_id", "status", "assigned_to", "rejection_reason":
+		if !equality {
+			return fmt.Errorf("%s only supports equality", field)
+		}
+		switch field {
+		case "user_id":
+			f.UserID = value
+		case "assigned_to":
+			f.AssignedTo = value
+		case "rejection_reason":
+			f.RejectionReason = value
+		case "status":
+			f.Status = SaleStatus(value)
+			if !f.Status.Valid() {
+				return fmt.Errorf("unknown status %q", value)
+			}
+		}
+
+	case "amount":
+		v, err := money.Parse(value)
+		if err != nil {
+			return err
+		}
+		// los montos son enteros en centavos, así que los límites estrictos se corren un centavo
+		switch op {
+		case ">":
+			v++
+			f.MinAmount = &v
+		case ">=":
+			f.MinAmount = &v
+		case "<":
+			v--
+			f.MaxAmount = &v
+		case "<=":
+			f.MaxAmount = &v
+		default:
+			f.MinAmount, f.MaxAmount = &v, &v
+		}
+
+	case "created_at":
+		t, err := parseFilterTime(value)
+		if err != nil {
+			return err
+		}
+		switch op {
+		case ">":
+			t = t.Add(time.Nanosecond)
+			f.CreatedFrom = &t
+		case ">=":
+			f.CreatedFrom = &t
+		case "<":
+			t = t.Add(-time.Nanosecond)
+			f.CreatedTo = &t
+		case "<=":
+			f.CreatedTo = &t
+		default:
+			f.CreatedFrom, f.CreatedTo = &t, &t
+		}
+
+	default:
+		return fmt.Errorf("unknown field %q", field)
+	}
+	return nil
+}
+
+// parseFilterTime accepts an RFC 3339 timestamp or a YYYY-MM-DD date.
+func parseFilterTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
@@ -0,0 +1,71 @@
+package sales
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFilter(t *testing.T) {
+	f, err := ParseFilter("status:approved AND amount>100 and created_at>=2024-01-01")
+	require.NoError(t, err)
+	require.Equal(t, StatusApproved, f.Status)
+	require.EqualValues(t, 10001, *f.MinAmount)
+	require.Nil(t, f.MaxAmount)
+	require.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), *f.CreatedFrom)
+
+	jan := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	require.True(t, f.Matches(&Sale{Status: StatusApproved, Amount: 10001, CreatedAt: jan}))
+	require.False(t, f.Matches(&Sale{Status: StatusApproved, Amount: 10000, CreatedAt: jan}))
+	require.False(t, f.Matches(&Sale{Status: StatusApproved, Amount: 20000, CreatedAt: jan.AddDate(-1, 0, 0)}))
+	require.False(t, f.Matches(&Sale{Status: StatusPending, Amount: 20000, CreatedAt: jan}))
+
+	f, err = ParseFilter("status:rejected AND rejection_reason:fraud")
+	require.NoError(t, err)
+	require.True(t, f.Matches(&Sale{Status: StatusRejected, RejectionReason: "fraud"}))
+	require.False(t, f.Matches(&Sale{Status: StatusRejected, RejectionReason: "other"}))
+
+	f, err = ParseFilter("")
+	require.NoError(t, err)
+	require.True(t, f.Matches(&Sale{}))
+
+	for _, expr := range []string{
+		"status:unknown",
+		"amount>abc",
+		"status>approved",
+		"color:red",
+		"amount",
+		"created_at<yesterday",
+	} {
+		_, err := ParseFilter(expr)
+		require.True(t, errors.Is(err, ErrInvalidFilter), expr)
+	}
+}
+
+func FuzzParseFilter(f *testing.F) {
+	for _, seed := range []string{
+		"status:approved AND amount>100 and created_at>=2024-01-01",
+		"user_id=u1",
+		"amount<=NaN",
+		"amount>1e308",
+		"created_at<2024-13-45",
+		"assigned_to: AND AND",
+		strings.Repeat("amount>1 AND ", 200),
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, expr string) {
+		filter, err := ParseFilter(expr)
+		if err != nil {
+			require.ErrorIs(t, err, ErrInvalidFilter)
+			return
+		}
+		if filter.Status != "" {
+			require.True(t, filter.Status.Valid())
+		}
+		filter.Matches(&Sale{})
+	})
+}
@@ -0,0 +1,130 @@
+package sales
+
+import (
+	"context"
+	"fmt"
+
+	"Ejercicio_Final-Taller_Go/internal/apperrors"
+	"Ejercicio_Final-Taller_Go/internal/audit"
+
+	"go.uber.org/zap"
+)
+
+// ErrForceReasonRequired is returned when forcing a status without a reason.
+var ErrForceReasonRequired = apperrors.New(apperrors.Validation, "force_reason_required", "a reason is required to force a status")
+
+// auditResource is the resource name sales are recorded under in the audit store.
+const auditResource = "sale"
+
+// ActionStatusForced is the audit action of a status set by ForceStatus.
+const ActionStatusForced = "status_forced"
+
+// WithAudit sets the store the forced changes of sales are recorded in.
+// Defaults to an in-memory store.
+func WithAudit(store audit.Store) Option {
+	return func(s *Service) {
+		s.audit = store
+	}
+}
+
+// ForceStatus sets the status of a sale bypassing the transitions of
+// SaleStatus.Next, to correct sales left wrong by an incident upstream,
+// e.g. approving a rejected sale whose payment did go through. It needs a
+// review.Reason, and records the change, attributed to the actor in ctx,
+// in the audit store; the change is undone if it cannot be recorded.
+// Returns ErrForceReasonRequired without a reason,
+// ErrInvalidStatus for an unknown status, ErrNotFound,
+// ErrInvalidTransition if the sale already has the status and
+// ErrInvalidRejectionReason as RejectSale.
+func (s *Service) ForceStatus(ctx context.Context, saleID string, status SaleStatus, review Review) (*Sale, error) {
+	if review.Reason == "" {
+		return nil, ErrForceReasonRequired
+	}
+	if !status.Valid() {
+		return nil, ErrInvalidStatus
+	}
+	if status != StatusRejected {
+		review.RejectionReason = ""
+	} else if s.reasons != nil && !s.reasons[review.RejectionReason] {
+		return nil, ErrInvalidRejectionReason
+	}
+
+	release, err := s.lockSale(ctx, saleID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	sale, err := s.readForUpdate(ctx, saleID)
+	if err != nil {
+		return nil, err
+	}
+	if sale.Status == status {
+		return nil, ErrInvalidTransition
+	}
+
+	before, previous := *sale, sale.Status
+	sale.Status = status
+	sale.StatusReason, sale.StatusChangedBy = review.Reason, review.Actor
+	sale.RejectionReason = review.RejectionReason
+	sale.UpdatedAt = s.clock.Now()
+	sale.StatusChangedAt = sale.UpdatedAt
+	sale.Version++
+
+	e := audit.Entry{
+		ID:         s.ids.NewID(),
+		Resource:   auditResource,
+		ResourceID: sale.ID,
+		Action:     ActionStatusForced,
+		Actor:      audit.ActorFromContext(ctx),
+		At:         sale.UpdatedAt,
+		Changes: []audit.Change{
+			{Field: "status", Before: previous, After: status},
+			{Field: "rejection_reason", Before: before.RejectionReason, After: sale.RejectionReason},
+		},
+		Reason: review.Reason,
+	}
+	if err := s.setAudited(ctx, sale, &before, e); err != nil {
+		s.log(ctx).Error("failed to force sale status", zap.String("sale_id", sale.ID), zap.Error(err))
+		return nil, err
+	}
+
+	s.log(ctx).Warn("sale status forced", zap.String("sale_id", sale.ID), zap.String("previous_status", string(previous)),
+		zap.String("status", string(status)), zap.String("reason", review.Reason))
+	s.emit(ctx, Event{Type: EventStatusChanged, Sale: *sale, PreviousStatus: previous, Previous: &before})
+	return sale, nil
+}
+
+// setAudited saves sale, changed from before, along with the audit entry
+// e of the change, in a transaction of the storage. If e cannot be
+// recorded, before is saved back, for the storages without transactions,
+// and the error returned: an audited change is never saved unrecorded.
+func (s *Service) setAudited(ctx context.Context, sale, before *Sale, e audit.Entry) error {
+	return s.storage.WithTx(ctx, func(tx Storage) error {
+		if err := tx.Set(ctx, sale); err != nil {
+			return err
+		}
+		if err := s.audit.Append(ctx, e); err != nil {
+			if restoreErr := tx.Set(ctx, before); restoreErr != nil {
+				s.log(ctx).Error("failed to restore unrecorded sale change", zap.String("sale_id", sale.ID), zap.Error(restoreErr))
+			}
+			return fmt.Errorf("failed to record the audit entry: %w", err)
+		}
+		return nil
+	})
+}
+
+// AuditLog returns the recorded forced changes and reprocessings of the
+// sale with the given ID, oldest first. Returns ErrNotFound if it has none and does not exist.
+func (s *Service) AuditLog(ctx context.Context, saleID string) ([]audit.Entry, error) {
+	entries, err := s.audit.List(ctx, auditResource, saleID)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		if _, err := s.GetSale(ctx, saleID); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,86 @@
+package sales
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/audit"
+	"Ejercicio_Final-Taller_Go/internal/clock"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestService_ForceStatus(t *testing.T) {
+	ctx := audit.WithActor(context.Background(), "apikey:ops")
+	now := time.Date(2024, 3, 10, 15, 0, 0, 0, time.UTC)
+	storage := NewLocalStorage()
+	var events []Event
+	s := NewService(storage, zap.NewNop(), "", WithClock(clock.NewManual(now)),
+		WithHooks(func(_ context.Context, e Event) { events = append(events, e) }))
+
+	require.NoError(t, storage.Set(ctx, &Sale{ID: "1", UserID: "ana", Amount: 1000, Status: StatusRejected,
+		RejectionReason: "insufficient_funds", CreatedAt: now, UpdatedAt: now, Version: 1}))
+
+	_, err := s.ForceStatus(ctx, "1", StatusApproved, Review{})
+	require.ErrorIs(t, err, ErrForceReasonRequired)
+	_, err = s.ForceStatus(ctx, "1", "refunded", Review{Reason: "incident 42"})
+	require.ErrorIs(t, err, ErrInvalidStatus)
+	_, err = s.ForceStatus(ctx, "2", StatusApproved, Review{Reason: "incident 42"})
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// un rechazo no puede pasar a aprobado por las transiciones normales
+	sale, err := s.ForceStatus(ctx, "1", StatusApproved, Review{Actor: "apikey:ops", Reason: "incident 42"})
+	require.NoError(t, err)
+	require.Equal(t, StatusApproved, sale.Status)
+	require.Empty(t, sale.RejectionReason)
+	require.Equal(t, "incident 42", sale.StatusReason)
+	require.Equal(t, 2, sale.Version)
+
+	require.Len(t, events, 1)
+	require.Equal(t, EventStatusChanged, events[0].Type)
+	require.Equal(t, StatusRejected, events[0].PreviousStatus)
+
+	entries, err := s.AuditLog(ctx, "1")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, ActionStatusForced, entries[0].Action)
+	require.Equal(t, "apikey:ops", entries[0].Actor)
+	require.Equal(t, "incident 42", entries[0].Reason)
+	require.Equal(t, audit.Change{Field: "status", Before: StatusRejected, After: StatusApproved}, entries[0].Changes[0])
+
+	_, err = s.ForceStatus(ctx, "1", StatusApproved, Review{Reason: "incident 42"})
+	require.ErrorIs(t, err, ErrInvalidTransition)
+
+	_, err = s.AuditLog(ctx, "2")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+// failingAudit is an audit store that cannot record entries.
+type failingAudit struct {
+	audit.Store
+	err error
+}
+
+func (f failingAudit) Append(context.Context, audit.Entry) error { return f.err }
+
+func TestService_ForceStatus_AuditFailure(t *testing.T) {
+	ctx := context.Background()
+	storage := NewLocalStorage()
+	errAudit := errors.New("audit store down")
+	var events []Event
+	s := NewService(storage, zap.NewNop(), "", WithAudit(failingAudit{Store: audit.NewLocalStore(), err: errAudit}),
+		WithHooks(func(_ context.Context, e Event) { events = append(events, e) }))
+	require.NoError(t, storage.Set(ctx, &Sale{ID: "1", Status: StatusRejected, Version: 1}))
+
+	// sin registro de auditoría el cambio no se guarda
+	_, err := s.ForceStatus(ctx, "1", StatusApproved, Review{Reason: "incident 42"})
+	require.ErrorIs(t, err, errAudit)
+	sale, err := storage.Read(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, StatusRejected, sale.Status)
+	require.Equal(t, 1, sale.Version)
+	require.Empty(t, events)
+}
@@ -0,0 +1,154 @@
+package sales
+
+import (
+	"context"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/metrics"
+	"Ejercicio_Final-Taller_Go/internal/redact"
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+
+	"go.uber.org/zap"
+)
+
+// InstrumentedStorage wraps a Storage timing each of its operations on a
+// metrics.Operations, which logs the slow ones with their parameters.
+type InstrumentedStorage struct {
+	inner Storage
+	ops   *metrics.Operations
+}
+
+// NewInstrumentedStorage returns inner with its operations timed on ops.
+func NewInstrumentedStorage(inner Storage, ops *metrics.Operations) *InstrumentedStorage {
+	return &InstrumentedStorage{inner: inner, ops: ops}
+}
+
+func (s *InstrumentedStorage) Set(ctx context.Context, sale *Sale) error {
+	defer s.ops.Start("set")(tenantField(ctx), zap.String("sale_id", sale.ID))
+	return s.inner.Set(ctx, sale)
+}
+
+func (s *InstrumentedStorage) Read(ctx context.Context, id string) (*Sale, error) {
+	defer s.ops.Start("read")(tenantField(ctx), zap.String("sale_id", id))
+	return s.inner.Read(ctx, id)
+}
+
+func (s *InstrumentedStorage) GetAll(ctx context.Context) ([]*Sale, error) {
+	defer s.ops.Start("get_all")(tenantField(ctx))
+	return s.inner.GetAll(ctx)
+}
+
+func (s *InstrumentedStorage) Search(ctx context.Context, filter SalesFilter) ([]*Sale, error) {
+	defer s.ops.Start("search")(append(filterFields(filter), tenantField(ctx))...)
+	return s.inner.Search(ctx, filter)
+}
+
+func (s *InstrumentedStorage) Aggregate(ctx context.Context, filter SalesFilter) (*SalesMetadata, error) {
+	defer s.ops.Start("aggregate")(append(filterFields(filter), tenantField(ctx))...)
+	return s.inner.Aggregate(ctx, filter)
+}
+
+func (s *InstrumentedStorage) GroupSales(ctx context.Context, filter SalesFilter, g GroupBy) ([]SalesGroup, error) {
+	defer s.ops.Start("group_sales")(append(filterFields(filter), tenantField(ctx), zap.String("group_by", string(g)))...)
+	return s.inner.GroupSales(ctx, filter, g)
+}
+
+// Iterate times the whole iteration, including the time spent in fn.
+func (s *InstrumentedStorage) Iterate(ctx context.Context, fn func(*Sale) error) error {
+	defer s.ops.Start("iterate")(tenantField(ctx))
+	return s.inner.Iterate(ctx, fn)
+}
+
+func (s *InstrumentedStorage) NextNumber(ctx context.Context, at time.Time) (string, error) {
+	defer s.ops.Start("next_number")(tenantField(ctx))
+	return s.inner.NextNumber(ctx, at)
+}
+
+func (s *InstrumentedStorage) ReadByNumber(ctx context.Context, number string) (*Sale, error) {
+	defer s.ops.Start("read_by_number")(tenantField(ctx), zap.String("number", number))
+	return s.inner.ReadByNumber(ctx, number)
+}
+
+func (s *InstrumentedStorage) Dashboard(ctx context.Context, since time.Time, topUsers int) (*Dashboard, error) {
+	defer s.ops.Start("dashboard")(tenantField(ctx), zap.Time("since", since), zap.Int("top_users", topUsers))
+	return s.inner.Dashboard(ctx, since, topUsers)
+}
+
+func (s *InstrumentedStorage) Ping(ctx context.Context) error {
+	defer s.ops.Start("ping")()
+	return s.inner.Ping(ctx)
+}
+
+func (s *InstrumentedStorage) Delete(ctx context.Context, id string) error {
+	defer s.ops.Start("delete")(tenantField(ctx), zap.String("sale_id", id))
+	return s.inner.Delete(ctx, id)
+}
+
+func (s *InstrumentedStorage) Tenants(ctx context.Context) ([]string, error) {
+	defer s.ops.Start("tenants")()
+	return s.inner.Tenants(ctx)
+}
+
+// WithTx times the whole transaction, and each operation within it.
+func (s *InstrumentedStorage) WithTx(ctx context.Context, fn func(tx Storage) error) error {
+	defer s.ops.Start("with_tx")(tenantField(ctx))
+	return s.inner.WithTx(ctx, func(tx Storage) error {
+		return fn(&InstrumentedStorage{inner: tx, ops: s.ops})
+	})
+}
+
+// History reads the history of the wrapped storage, if it keeps one (see
+// Historian). Returns ErrHistoryUnavailable otherwise.
+func (s *InstrumentedStorage) History(ctx context.Context, id string) ([]StreamEvent, error) {
+	h, ok := s.inner.(Historian)
+	if !ok {
+		return nil, ErrHistoryUnavailable
+	}
+	defer s.ops.Start("history")(tenantField(ctx), zap.String("sale_id", id))
+	return h.History(ctx, id)
+}
+
+// StateAt reads the history of the wrapped storage, if it keeps one (see
+// Historian). Returns ErrHistoryUnavailable otherwise.
+func (s *InstrumentedStorage) StateAt(ctx context.Context, id string, at time.Time) (*Sale, error) {
+	h, ok := s.inner.(Historian)
+	if !ok {
+		return nil, ErrHistoryUnavailable
+	}
+	defer s.ops.Start("state_at")(tenantField(ctx), zap.String("sale_id", id), zap.Time("at", at))
+	return h.StateAt(ctx, id, at)
+}
+
+func tenantField(ctx context.Context) zap.Field {
+	return zap.String("tenant", tenant.FromContext(ctx))
+}
+
+// filterFields describes the conditions set in f.
+func filterFields(f SalesFilter) []zap.Field {
+	var fields []zap.Field
+	if f.UserID != "" {
+		fields = append(fields, zap.String("user_id", f.UserID))
+	}
+	if f.Status != "" {
+		fields = append(fields, zap.String("status", string(f.Status)))
+	}
+	if f.AssignedTo != "" {
+		fields = append(fields, zap.String("assigned_to", redact.Mask(f.AssignedTo)))
+	}
+	if f.RejectionReason != "" {
+		fields = append(fields, zap.String("rejection_reason", f.RejectionReason))
+	}
+	if f.MinAmount != nil {
+		fields = append(fields, zap.Stringer("min_amount", *f.MinAmount))
+	}
+	if f.MaxAmount != nil {
+		fields = append(fields, zap.Stringer("max_amount", *f.MaxAmount))
+	}
+	if f.CreatedFrom != nil {
+		fields = append(fields, zap.Time("created_from", *f.CreatedFrom))
+	}
+	if f.CreatedTo != nil {
+		fields = append(fields, zap.Time("created_to", *f.CreatedTo))
+	}
+	return fields
+}
@@ -0,0 +1,63 @@
+package sales
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/metrics"
+	"Ejercicio_Final-Taller_Go/internal/money"
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestInstrumentedStorage(t *testing.T) {
+	core, logs := observer.New(zap.WarnLevel)
+	ops := metrics.NewOperations("sales_storage", zap.New(core), time.Nanosecond)
+	storage := NewInstrumentedStorage(NewLocalStorage(), ops)
+	ctx := tenant.WithID(context.Background(), "acme")
+
+	require.NoError(t, storage.WithTx(ctx, func(tx Storage) error {
+		return tx.Set(ctx, &Sale{ID: "1", UserID: "a", Amount: 1000, Status: StatusApproved})
+	}))
+	minAmount := money.Cents(500)
+	found, err := storage.Search(ctx, SalesFilter{UserID: "a", MinAmount: &minAmount})
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	_, err = storage.Search(ctx, SalesFilter{AssignedTo: "ana@example.com"})
+	require.NoError(t, err)
+
+	require.Equal(t, int64(1), ops.Histogram("with_tx").Count())
+	require.Equal(t, int64(1), ops.Histogram("set").Count())
+	require.Equal(t, int64(2), ops.Histogram("search").Count())
+
+	search := logs.FilterField(zap.String("operation", "search")).All()
+	require.Len(t, search, 2)
+	fields := search[0].ContextMap()
+	require.Equal(t, "acme", fields["tenant"])
+	require.Equal(t, "a", fields["user_id"])
+	require.Equal(t, "5.00", fields["min_amount"])
+	require.NotContains(t, fields, "status")
+	// el revisor es un dato personal, no se registra en claro
+	require.Equal(t, "a********", search[1].ContextMap()["assigned_to"])
+}
+
+func TestInstrumentedStorage_History(t *testing.T) {
+	ctx := context.Background()
+	ops := metrics.NewOperations("sales_storage", zap.NewNop(), 0)
+
+	s := NewService(NewInstrumentedStorage(NewLocalStorage(), ops), zap.NewNop(), "")
+	_, err := s.SaleHistory(ctx, "1")
+	require.ErrorIs(t, err, ErrHistoryUnavailable)
+
+	storage := NewInstrumentedStorage(NewEventSourcedStorage(0), ops)
+	require.NoError(t, storage.Set(ctx, &Sale{ID: "1", UserID: "a", Amount: 1000, Status: StatusPending, Version: 1}))
+	s = NewService(storage, zap.NewNop(), "")
+	history, err := s.SaleHistory(ctx, "1")
+	require.NoError(t, err)
+	require.NotEmpty(t, history)
+	require.Equal(t, int64(1), ops.Histogram("history").Count())
+}
@@ -0,0 +1,84 @@
+package sales
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/apperrors"
+	"Ejercicio_Final-Taller_Go/internal/audit"
+
+	"go.uber.org/zap"
+)
+
+// ErrInvalidNote is returned for an empty or too long note, or one more
+// than a sale can hold.
+var ErrInvalidNote = apperrors.New(apperrors.Validation, "invalid_sale_note", "the note is empty or exceeds its limits")
+
+// maxNotes caps the notes of a sale.
+const maxNotes = 100
+
+// Note is a free-text remark left on a sale by an operator, e.g. to track
+// a support case. Unlike Sale.Notes, notes are only ever added.
+type Note struct {
+	ID        string    `json:"id" xml:"id"`
+	Text      string    `json:"text" xml:"text"`
+	Author    string    `json:"author,omitempty" xml:"author,omitempty"`
+	CreatedAt time.Time `json:"created_at" xml:"created_at"`
+}
+
+// AddNote appends a note with the given text to a sale, written by the
+// actor in ctx (see audit.WithActor), in any status. Returns ErrNotFound,
+// also for archived sales, or ErrInvalidNote.
+func (s *Service) AddNote(ctx context.Context, saleID, text string) (*Note, error) {
+	text = strings.TrimSpace(text)
+	if text == "" || len(text) > maxNotesLength {
+		return nil, fmt.Errorf("%w: up to %d bytes", ErrInvalidNote, maxNotesLength)
+	}
+
+	release, err := s.lockSale(ctx, saleID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	sale, err := s.readForUpdate(ctx, saleID)
+	if err != nil {
+		return nil, err
+	}
+	if len(sale.OperatorNotes) >= maxNotes {
+		return nil, fmt.Errorf("%w: more than %d notes", ErrInvalidNote, maxNotes)
+	}
+
+	before, now := *sale, s.clock.Now()
+	note := Note{ID: s.ids.NewID(), Text: text, Author: audit.ActorFromContext(ctx), CreatedAt: now}
+	sale.OperatorNotes = append(sale.OperatorNotes, note)
+	sale.UpdatedAt = now
+	sale.Version++
+
+	if err := s.storage.Set(ctx, sale); err != nil {
+		s.log(ctx).Error("failed to add sale note", zap.String("sale_id", sale.ID), zap.Error(err))
+		return nil, err
+	}
+
+	s.log(ctx).Info("sale note added", zap.String("sale_id", sale.ID), zap.String("note_id", note.ID))
+	s.emit(ctx, Event{Type: EventUpdated, Sale: *sale, Previous: &before})
+	return &note, nil
+}
+
+// SaleNotes returns the notes of a sale, oldest first, looking in the
+// archive when it is not in the primary store.
+// Returns ErrNotFound if the sale does not exist.
+func (s *Service) SaleNotes(ctx context.Context, saleID string) ([]Note, error) {
+	sale, err := s.GetSale(ctx, saleID)
+	if err != nil {
+		return nil, err
+	}
+	notes := slices.Clone(sale.OperatorNotes)
+	if notes == nil {
+		notes = []Note{}
+	}
+	return notes, nil
+}
@@ -0,0 +1,63 @@
+package sales
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/audit"
+	"Ejercicio_Final-Taller_Go/internal/clock"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestService_AddNote(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2024, 3, 10, 15, 0, 0, 0, time.UTC)
+	clk := clock.NewManual(start)
+	storage := NewEventSourcedStorage(2)
+	s := NewService(storage, zap.NewNop(), "", WithClock(clk))
+	require.NoError(t, storage.Set(ctx, &Sale{ID: "1", UserID: "a", Amount: 1000, Status: StatusApproved, CreatedAt: start, UpdatedAt: start, Version: 1}))
+
+	_, err := s.AddNote(ctx, "1", " ")
+	require.ErrorIs(t, err, ErrInvalidNote)
+	_, err = s.AddNote(ctx, "1", strings.Repeat("a", maxNotesLength+1))
+	require.ErrorIs(t, err, ErrInvalidNote)
+	_, err = s.AddNote(ctx, "missing", "hello")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	clk.Advance(time.Minute)
+	note, err := s.AddNote(audit.WithActor(ctx, "ana"), "1", " refund asked by phone ")
+	require.NoError(t, err)
+	require.Equal(t, "refund asked by phone", note.Text)
+	require.Equal(t, "ana", note.Author)
+	require.Equal(t, clk.Now(), note.CreatedAt)
+	clk.Advance(time.Minute)
+	_, err = s.AddNote(ctx, "1", "refund done")
+	require.NoError(t, err)
+
+	notes, err := s.SaleNotes(ctx, "1")
+	require.NoError(t, err)
+	require.Len(t, notes, 2)
+	require.Equal(t, *note, notes[0])
+
+	// las notas se reconstruyen desde la historia, también entre snapshots
+	sale, err := s.GetSale(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, 3, sale.Version)
+	latest, err := s.SaleAt(ctx, "1", clk.Now())
+	require.NoError(t, err)
+	require.Equal(t, *sale, *latest)
+	first, err := s.SaleAt(ctx, "1", start.Add(90*time.Second))
+	require.NoError(t, err)
+	require.Equal(t, []Note{*note}, first.OperatorNotes)
+
+	for i := len(notes); i < maxNotes; i++ {
+		_, err = s.AddNote(ctx, "1", "more")
+		require.NoError(t, err)
+	}
+	_, err = s.AddNote(ctx, "1", "one too many")
+	require.ErrorIs(t, err, ErrInvalidNote)
+}
@@ -0,0 +1,188 @@
+package sales
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"Ejercicio_Final-Taller_Go/internal/apperrors"
+
+	"go.uber.org/zap"
+)
+
+// ErrUnknownField is returned when a SalePatch names a field it cannot change.
+var ErrUnknownField = apperrors.New(apperrors.Validation, "unknown_sale_field", "the field cannot be patched")
+
+// ErrImmutableField is returned when a SalePatch changes a field the
+// current status of the sale does not allow to change.
+var ErrImmutableField = apperrors.New(apperrors.Conflict, "immutable_sale_field", "the field cannot be changed in the sale's status")
+
+// ErrInvalidSaleData is returned for metadata, tags or notes over their limits.
+var ErrInvalidSaleData = apperrors.New(apperrors.Validation, "invalid_sale_data", "metadata, tags or notes exceed their limits")
+
+// ErrEmptyPatch is returned for a SalePatch naming no field.
+var ErrEmptyPatch = apperrors.New(apperrors.Validation, "empty_sale_patch", "no field to update")
+
+// Fields of a sale a SalePatch can change.
+const (
+	FieldStatus   = "status"
+	FieldMetadata = "metadata"
+	FieldTags     = "tags"
+	FieldNotes    = "notes"
+)
+
+// mutableFields lists the fields that can be changed in each status besides
+// the status itself, which follows SaleStatus.Next. Decided sales keep the
+// metadata they were decided with.
+var mutableFields = map[SaleStatus][]string{
+	StatusPending:  {FieldMetadata, FieldTags, FieldNotes},
+	StatusApproved: {FieldTags, FieldNotes},
+	StatusRejected: {FieldTags, FieldNotes},
+}
+
+// Limits of the free-form fields of a sale.
+const (
+	maxMetadataEntries = 20
+	maxMetadataKey     = 64
+	maxMetadataValue   = 256
+	maxTags            = 20
+	maxTagLength       = 50
+	maxNotesLength     = 1000
+)
+
+// SalePatch sets the fields of a sale named in Mask to the values given
+// here, clearing those left empty; fields not in Mask are kept. Review
+// attributes a change of status.
+type SalePatch struct {
+	Mask []string
+
+	Status   SaleStatus
+	Review   Review
+	Metadata Metadata
+	Tags     []string
+	Notes    string
+}
+
+// has reports whether field is in the mask of p.
+func (p SalePatch) has(field string) bool {
+	return slices.Contains(p.Mask, field)
+}
+
+// validate checks the fields of p that do not depend on the sale.
+func (p SalePatch) validate() error {
+	if len(p.Mask) == 0 {
+		return ErrEmptyPatch
+	}
+	for _, field := range p.Mask {
+		switch field {
+		case FieldStatus, FieldMetadata, FieldTags, FieldNotes:
+		default:
+			return fmt.Errorf("%w: %q", ErrUnknownField, field)
+		}
+	}
+
+	if p.has(FieldStatus) && p.Status != StatusApproved && p.Status != StatusRejected {
+		return ErrInvalidStatus
+	}
+	if len(p.Metadata) > maxMetadataEntries {
+		return fmt.Errorf("%w: more than %d metadata entries", ErrInvalidSaleData, maxMetadataEntries)
+	}
+	for k, v := range p.Metadata {
+		if k == "" || len(k) > maxMetadataKey || len(v) > maxMetadataValue {
+			return fmt.Errorf("%w: metadata %q", ErrInvalidSaleData, k)
+		}
+	}
+	if len(p.Tags) > maxTags {
+		return fmt.Errorf("%w: more than %d tags", ErrInvalidSaleData, maxTags)
+	}
+	for _, tag := range p.Tags {
+		if tag == "" || len(tag) > maxTagLength {
+			return fmt.Errorf("%w: tag %q", ErrInvalidSaleData, tag)
+		}
+	}
+	if len(p.Notes) > maxNotesLength {
+		return fmt.Errorf("%w: notes longer than %d bytes", ErrInvalidSaleData, maxNotesLength)
+	}
+	return nil
+}
+
+// PatchSale changes the fields of a sale named in patch.Mask, bumping its
+// Version once. Whether each field can change is decided by the status
+// the sale had before the patch. Returns ErrNotFound, ErrEmptyPatch,
+// ErrUnknownField or ErrInvalidSaleData for a bad request, and
+// ErrInvalidTransition or ErrImmutableField for a field that cannot change
+// in the sale's status. Status changes fail as in UpdateSaleStatus.
+func (s *Service) PatchSale(ctx context.Context, saleID string, patch SalePatch) (*Sale, error) {
+	release, err := s.lockSale(ctx, saleID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	sale, err := s.readForUpdate(ctx, saleID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := patch.validate(); err != nil {
+		return nil, err
+	}
+	for _, field := range patch.Mask {
+		if field == FieldStatus {
+			if !slices.Contains(sale.Status.Next(), patch.Status) {
+				return nil, ErrInvalidTransition
+			}
+			continue
+		}
+		if !slices.Contains(mutableFields[sale.Status], field) {
+			return nil, fmt.Errorf("%w: %s of a %s sale", ErrImmutableField, field, sale.Status)
+		}
+	}
+	if patch.has(FieldStatus) {
+		if patch.Status != StatusRejected {
+			patch.Review.RejectionReason = ""
+		} else if s.reasons != nil && !s.reasons[patch.Review.RejectionReason] {
+			return nil, ErrInvalidRejectionReason
+		}
+	}
+
+	before, previous := *sale, sale.Status
+	now := s.clock.Now()
+	if patch.has(FieldStatus) {
+		sale.Status, sale.StatusChangedAt = patch.Status, now
+		sale.StatusReason, sale.StatusChangedBy = patch.Review.Reason, patch.Review.Actor
+		sale.RejectionReason = patch.Review.RejectionReason
+	}
+	// se reemplazan enteros, los del patch son del llamador
+	if patch.has(FieldMetadata) {
+		sale.Metadata = nil
+		if len(patch.Metadata) > 0 {
+			sale.Metadata = patch.Metadata.clone()
+		}
+	}
+	if patch.has(FieldTags) {
+		sale.Tags = nil
+		if len(patch.Tags) > 0 {
+			sale.Tags = slices.Clone(patch.Tags)
+		}
+	}
+	if patch.has(FieldNotes) {
+		sale.Notes = patch.Notes
+	}
+	sale.UpdatedAt = now
+	sale.Version++
+
+	if err := s.storage.Set(ctx, sale); err != nil {
+		s.log(ctx).Error("failed to update sale", zap.String("sale_id", sale.ID), zap.Error(err))
+		return nil, err
+	}
+
+	if sale.Status == previous {
+		s.log(ctx).Info("sale updated", zap.String("sale_id", sale.ID), zap.Strings("fields", patch.Mask), zap.Any("sale", sale))
+		s.emit(ctx, Event{Type: EventUpdated, Sale: *sale, Previous: &before})
+		return sale, nil
+	}
+	s.log(ctx).Info("sale status changed", zap.String("sale_id", sale.ID), zap.String("previous_status", string(previous)), zap.Any("sale", sale))
+	s.emit(ctx, Event{Type: EventStatusChanged, Sale: *sale, PreviousStatus: previous, Previous: &before})
+	return sale, nil
+}
@@ -0,0 +1,100 @@
+package sales
+
+import (
+	"Ejercicio_Final-Taller_Go/internal/money"
+)
+
+// statsModel is a read model of the SalesMetadata of a tenant, globally and
+// per user, kept up to date on every write so that aggregating by user and
+// status needs no scan. Callers synchronize access.
+type statsModel struct {
+	global statusTotals
+	byUser map[string]statusTotals
+	// counted is what each stored sale contributes, kept apart since callers
+	// may change a stored sale before setting it again.
+	counted map[string]contribution
+}
+
+// contribution is the part of a sale the totals depend on.
+type contribution struct {
+	UserID string
+	Status SaleStatus
+	Amount money.Cents
+}
+
+// statusTotals are the count and amount of sales in each status.
+type statusTotals map[SaleStatus]total
+
+type total struct {
+	Quantity int
+	Amount   money.Cents
+}
+
+func newStatsModel() *statsModel {
+	return &statsModel{global: statusTotals{}, byUser: map[string]statusTotals{}, counted: map[string]contribution{}}
+}
+
+// set replaces the contribution of sale with its current values.
+func (m *statsModel) set(sale *Sale) {
+	m.remove(sale.ID)
+	c := contribution{UserID: sale.UserID, Status: sale.Status, Amount: sale.Amount}
+	m.counted[sale.ID] = c
+	m.global.add(c, 1)
+	if m.byUser[c.UserID] == nil {
+		m.byUser[c.UserID] = statusTotals{}
+	}
+	m.byUser[c.UserID].add(c, 1)
+}
+
+// remove takes the sale with the given ID out of the totals.
+func (m *statsModel) remove(id string) {
+	c, ok := m.counted[id]
+	if !ok {
+		return
+	}
+	delete(m.counted, id)
+	m.global.add(c, -1)
+	m.byUser[c.UserID].add(c, -1)
+	if len(m.byUser[c.UserID]) == 0 {
+		delete(m.byUser, c.UserID)
+	}
+}
+
+// metadata returns the totals of the sales of userID in status, where empty
+// values match every user or status.
+func (m *statsModel) metadata(userID string, status SaleStatus) *SalesMetadata {
+	totals := m.global
+	if userID != "" {
+		totals = m.byUser[userID]
+	}
+
+	metadata := &SalesMetadata{}
+	for s, t := range totals {
+		if status != "" && s != status {
+			continue
+		}
+		metadata.Quantity += t.Quantity
+		metadata.TotalAmount += t.Amount
+		switch s {
+		case StatusApproved:
+			metadata.Approved += t.Quantity
+		case StatusRejected:
+			metadata.Rejected += t.Quantity
+		case StatusPending:
+			metadata.Pending += t.Quantity
+		}
+	}
+	return metadata
+}
+
+// add adds sign times c to the totals of its status.
+func (t statusTotals) add(c contribution, sign int) {
+	v := t[c.Status]
+	v.Quantity += sign
+	v.Amount += money.Cents(sign) * c.Amount
+	if v.Quantity == 0 {
+		delete(t, c.Status)
+		return
+	}
+	t[c.Status] = v
+}
@@ -0,0 +1,86 @@
+package sales
+
+import (
+	"context"
+
+	"Ejercicio_Final-Taller_Go/internal/apperrors"
+	"Ejercicio_Final-Taller_Go/internal/audit"
+
+	"go.uber.org/zap"
+)
+
+// ErrNotReprocessable is returned when reprocessing a sale that is not rejected.
+var ErrNotReprocessable = apperrors.New(apperrors.Conflict, "sale_not_reprocessable", "only rejected sales can be reprocessed")
+
+// ActionReprocessed is the audit action of a sale decided again by Reprocess.
+const ActionReprocessed = "reprocessed"
+
+// Reprocess runs a rejected sale through the checks and the approval of
+// CreateSale again, so a sale rejected because of a transient failure of
+// the user API or the payment gateway can be retried without creating it
+// anew. The sale keeps its ID and number and gets a new version and
+// status; each attempt is recorded in the audit store (see AuditLog), and
+// undone if it cannot be.
+// Returns ErrNotFound, ErrNotReprocessable, and the errors of CreateSale
+// validating the user, in which case the sale is left as it was.
+func (s *Service) Reprocess(ctx context.Context, saleID string) (*Sale, error) {
+	sale, err := s.storage.Read(ctx, saleID)
+	if err != nil {
+		return nil, err
+	}
+	if sale.Status != StatusRejected {
+		return nil, ErrNotReprocessable
+	}
+	// la API de usuarios se consulta sin tener tomada la venta
+	if err := s.checkBuyer(ctx, sale.UserID); err != nil {
+		return nil, err
+	}
+
+	release, err := s.lockSale(ctx, saleID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	sale, err = s.readForUpdate(ctx, saleID)
+	if err != nil {
+		return nil, err
+	}
+	if sale.Status != StatusRejected {
+		return nil, ErrNotReprocessable
+	}
+
+	before := *sale
+	now := s.clock.Now()
+	sale.Status = s.initialStatus(ctx, now)
+	sale.StatusReason, sale.StatusChangedBy, sale.RejectionReason = "", "", ""
+	sale.AssignedTo = ""
+	sale.StatusChangedAt, sale.UpdatedAt = now, now
+	sale.Version++
+
+	e := audit.Entry{
+		ID:         s.ids.NewID(),
+		Resource:   auditResource,
+		ResourceID: sale.ID,
+		Action:     ActionReprocessed,
+		Actor:      audit.ActorFromContext(ctx),
+		At:         now,
+		Changes: []audit.Change{
+			{Field: "status", Before: before.Status, After: sale.Status},
+			{Field: "version", Before: before.Version, After: sale.Version},
+		},
+	}
+	if err := s.setAudited(ctx, sale, &before, e); err != nil {
+		s.log(ctx).Error("failed to reprocess sale", zap.String("sale_id", sale.ID), zap.Error(err))
+		return nil, err
+	}
+
+	s.log(ctx).Info("sale reprocessed", zap.String("sale_id", sale.ID), zap.String("status", string(sale.Status)),
+		zap.Int("version", sale.Version))
+	if sale.Status == before.Status {
+		s.emit(ctx, Event{Type: EventUpdated, Sale: *sale, Previous: &before})
+	} else {
+		s.emit(ctx, Event{Type: EventStatusChanged, Sale: *sale, PreviousStatus: before.Status, Previous: &before})
+	}
+	return sale, nil
+}
@@ -0,0 +1,90 @@
+package sales
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/apperrors"
+	"Ejercicio_Final-Taller_Go/internal/audit"
+	"Ejercicio_Final-Taller_Go/internal/clock"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestService_Reprocess(t *testing.T) {
+	ctx := context.Background()
+	var down atomic.Bool
+	down.Store(true)
+	userAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer userAPI.Close()
+
+	now := time.Date(2024, 3, 10, 15, 0, 0, 0, time.UTC)
+	storage := NewLocalStorage()
+	var events []Event
+	s := NewService(storage, zap.NewNop(), userAPI.URL, WithClock(clock.NewManual(now)),
+		WithHooks(func(_ context.Context, e Event) { events = append(events, e) }))
+
+	require.NoError(t, storage.Set(ctx, &Sale{ID: "1", Number: "S-1", UserID: "ana", Amount: 1000, Status: StatusRejected,
+		RejectionReason: "gateway_error", CreatedAt: now, UpdatedAt: now, Version: 1}))
+	require.NoError(t, storage.Set(ctx, &Sale{ID: "2", UserID: "ana", Amount: 1000, Status: StatusApproved,
+		CreatedAt: now, UpdatedAt: now, Version: 1}))
+
+	_, err := s.Reprocess(ctx, "2")
+	require.ErrorIs(t, err, ErrNotReprocessable)
+	_, err = s.Reprocess(ctx, "3")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// con la API de usuarios caída la venta no cambia
+	_, err = s.Reprocess(ctx, "1")
+	require.Equal(t, apperrors.DependencyUnavailable, apperrors.KindOf(err))
+	got, err := s.GetSale(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, 1, got.Version)
+
+	down.Store(false)
+	sale, err := s.Reprocess(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, "S-1", sale.Number)
+	require.Equal(t, 2, sale.Version)
+	require.Empty(t, sale.RejectionReason)
+	require.Len(t, events, 1)
+	require.Equal(t, StatusRejected, events[0].Previous.Status)
+
+	entries, err := s.AuditLog(ctx, "1")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, ActionReprocessed, entries[0].Action)
+	require.Equal(t, sale.Status, entries[0].Changes[0].After)
+}
+
+func TestService_Reprocess_AuditFailure(t *testing.T) {
+	userAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer userAPI.Close()
+
+	ctx := context.Background()
+	storage := NewLocalStorage()
+	errAudit := errors.New("audit store down")
+	s := NewService(storage, zap.NewNop(), userAPI.URL, WithAudit(failingAudit{Store: audit.NewLocalStore(), err: errAudit}))
+	require.NoError(t, storage.Set(ctx, &Sale{ID: "1", UserID: "ana", Amount: 1000, Status: StatusRejected, Version: 1}))
+
+	_, err := s.Reprocess(ctx, "1")
+	require.ErrorIs(t, err, errAudit)
+	sale, err := storage.Read(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, StatusRejected, sale.Status)
+	require.Equal(t, 1, sale.Version)
+}
@@ -0,0 +1,184 @@
+package sales
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+
+	"go.uber.org/zap"
+)
+
+// ApplyRetention moves the sales of every tenant created more than months
+// months ago from the primary store to the archive, and returns how many
+// were moved. Pending sales are kept, since they still wait for review.
+// It does nothing when the service has no archive or months is not positive.
+func (s *Service) ApplyRetention(ctx context.Context, months int) (int, error) {
+	if s.archive == nil || months <= 0 {
+		return 0, nil
+	}
+	cutoff := s.clock.Now().AddDate(0, -months, 0)
+
+	tenants, err := s.Tenants(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	moved := 0
+	for _, id := range tenants {
+		tctx := tenant.WithID(ctx, id)
+
+		var old []*Sale
+		err := s.storage.Iterate(tctx, func(sale *Sale) error {
+			if sale.Status != StatusPending && sale.CreatedAt.Before(cutoff) {
+				old = append(old, sale)
+			}
+			return nil
+		})
+		if err != nil {
+			return moved, err
+		}
+
+		for _, sale := range old {
+			ok, err := s.archiveSale(tctx, sale.ID, cutoff)
+			if err != nil {
+				return moved, err
+			}
+			if ok {
+				moved++
+			}
+		}
+	}
+
+	if moved > 0 {
+		s.log(ctx).Info("sales archived", zap.Int("count", moved), zap.Time("cutoff", cutoff))
+	}
+	return moved, nil
+}
+
+// archiveSale moves the sale id of the tenant in ctx to the archive, under
+// its lock, if it is still old enough and not pending. It reports whether
+// it was moved; a sale locked by a change in progress is left for the next run.
+func (s *Service) archiveSale(ctx context.Context, id string, cutoff time.Time) (bool, error) {
+	release, err := s.lockSale(ctx, id)
+	if errors.Is(err, ErrSaleLocked) {
+		s.log(ctx).Info("sale locked, not archived", zap.String("tenant", tenant.FromContext(ctx)), zap.String("sale_id", id))
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	// pudo cambiar desde que se recorrió la storage
+	sale, err := s.storage.Read(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if sale.Status == StatusPending || !sale.CreatedAt.Before(cutoff) {
+		return false, nil
+	}
+
+	// se escribe primero en el archivo: si falla el borrado la venta
+	// queda duplicada, y las búsquedas descartan la copia archivada
+	if err := s.archive.Put(ctx, sale); err != nil {
+		s.log(ctx).Error("failed to archive sale", zap.String("tenant", tenant.FromContext(ctx)), zap.String("sale_id", id), zap.Error(err))
+		return false, err
+	}
+	if err := s.storage.Delete(ctx, id); err != nil && !errors.Is(err, ErrNotFound) {
+		s.log(ctx).Error("failed to remove archived sale", zap.String("tenant", tenant.FromContext(ctx)), zap.String("sale_id", id), zap.Error(err))
+		return false, err
+	}
+	return true, nil
+}
+
+// Unarchive moves an archived sale back to the primary store and returns it.
+// Returns ErrNotFound if the sale is not archived.
+func (s *Service) Unarchive(ctx context.Context, id string) (*Sale, error) {
+	if s.archive == nil {
+		return nil, ErrNotFound
+	}
+
+	release, err := s.lockSale(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	sale, err := s.archive.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	sale.Archived = false
+
+	if err := s.storage.Set(ctx, sale); err != nil {
+		s.log(ctx).Error("failed to restore sale", zap.String("sale_id", id), zap.Error(err))
+		return nil, err
+	}
+	if err := s.archive.Delete(ctx, id); err != nil && !errors.Is(err, ErrNotFound) {
+		s.log(ctx).Error("failed to remove unarchived sale from archive", zap.String("sale_id", id), zap.Error(err))
+		return nil, err
+	}
+
+	s.log(ctx).Info("sale unarchived", zap.String("sale_id", id))
+	return sale, nil
+}
+
+// withArchived appends to results the archived sales matching filter that
+// are not in results already.
+func (s *Service) withArchived(ctx context.Context, filter SalesFilter, results []*Sale) ([]*Sale, error) {
+	if s.archive == nil {
+		return results, nil
+	}
+
+	archived, err := s.archive.Search(ctx, filter)
+	if err != nil {
+		s.log(ctx).Error("failed to search archived sales", zap.Error(err))
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(results))
+	for _, sale := range results {
+		seen[sale.ID] = true
+	}
+	for _, sale := range archived {
+		if !seen[sale.ID] {
+			results = append(results, sale)
+		}
+	}
+	return results, nil
+}
+
+// archivedOnly returns the archived sales matching filter that are not in
+// the primary store, for callers that take the rest from the storage
+// without listing them: a sale whose removal failed after archiving it is
+// in both.
+func (s *Service) archivedOnly(ctx context.Context, filter SalesFilter) ([]*Sale, error) {
+	if s.archive == nil {
+		return nil, nil
+	}
+
+	archived, err := s.archive.Search(ctx, filter)
+	if err != nil {
+		s.log(ctx).Error("failed to search archived sales", zap.Error(err))
+		return nil, err
+	}
+
+	only := archived[:0]
+	for _, sale := range archived {
+		_, err := s.storage.Read(ctx, sale.ID)
+		if errors.Is(err, ErrNotFound) {
+			only = append(only, sale)
+			continue
+		}
+		if err != nil {
+			s.log(ctx).Error("failed to read sale", zap.String("sale_id", sale.ID), zap.Error(err))
+			return nil, err
+		}
+	}
+	return only, nil
+}
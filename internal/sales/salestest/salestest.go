@@ -0,0 +1,113 @@
+// Package salestest provides builders and pre-seeded storages for tests of
+// code that works with sales.
+package salestest
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/money"
+	"Ejercicio_Final-Taller_Go/internal/sales"
+)
+
+// Now is the creation time of built sales unless WithCreatedAt says otherwise.
+var Now = time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+
+// seq numbers the sales built without an explicit ID.
+var seq atomic.Int64
+
+// SaleBuilder builds a Sale field by field. Its zero fields default to a
+// valid pending sale of 10.00 for user "user-1", with a unique ID and number.
+// Each With method sets the field of the same name.
+type SaleBuilder struct {
+	sale sales.Sale
+}
+
+// NewSaleBuilder starts a sale with the defaults.
+func NewSaleBuilder() *SaleBuilder {
+	n := seq.Add(1)
+	return &SaleBuilder{sale: sales.Sale{
+		ID:        fmt.Sprintf("sale-%d", n),
+		Number:    fmt.Sprintf("%d-%06d", Now.Year(), n),
+		UserID:    "user-1",
+		Amount:    1000,
+		Status:    sales.StatusPending,
+		CreatedAt: Now,
+		UpdatedAt: Now,
+		Version:   1,
+	}}
+}
+
+func (b *SaleBuilder) WithID(id string) *SaleBuilder {
+	b.sale.ID = id
+	return b
+}
+
+func (b *SaleBuilder) WithNumber(number string) *SaleBuilder {
+	b.sale.Number = number
+	return b
+}
+
+func (b *SaleBuilder) WithUserID(userID string) *SaleBuilder {
+	b.sale.UserID = userID
+	return b
+}
+
+func (b *SaleBuilder) WithAmount(amount money.Cents) *SaleBuilder {
+	b.sale.Amount = amount
+	return b
+}
+
+func (b *SaleBuilder) WithStatus(status sales.SaleStatus) *SaleBuilder {
+	b.sale.Status = status
+	return b
+}
+
+func (b *SaleBuilder) WithAssignedTo(reviewer string) *SaleBuilder {
+	b.sale.AssignedTo = reviewer
+	return b
+}
+
+func (b *SaleBuilder) WithCreatedBy(actor string) *SaleBuilder {
+	b.sale.CreatedBy = actor
+	return b
+}
+
+// WithCreatedAt sets both the creation and the update time.
+func (b *SaleBuilder) WithCreatedAt(at time.Time) *SaleBuilder {
+	b.sale.CreatedAt = at
+	b.sale.UpdatedAt = at
+	return b
+}
+
+func (b *SaleBuilder) WithVersion(version int) *SaleBuilder {
+	b.sale.Version = version
+	return b
+}
+
+// Build returns a new copy of the sale, so a builder can be reused as a template.
+func (b *SaleBuilder) Build() *sales.Sale {
+	s := b.sale
+	return &s
+}
+
+// NewStorage returns a LocalStorage holding the given sales in the default tenant.
+func NewStorage(tb testing.TB, seed ...*sales.Sale) *sales.LocalStorage {
+	tb.Helper()
+	storage := sales.NewLocalStorage()
+	Seed(tb, context.Background(), storage, seed...)
+	return storage
+}
+
+// Seed stores the given sales in the tenant of ctx, failing tb on error.
+func Seed(tb testing.TB, ctx context.Context, storage sales.Storage, seed ...*sales.Sale) {
+	tb.Helper()
+	for _, sale := range seed {
+		if err := storage.Set(ctx, sale); err != nil {
+			tb.Fatalf("seeding sale %s: %v", sale.ID, err)
+		}
+	}
+}
@@ -1,124 +1,799 @@
 package sales
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"math/rand"
 	"net/http"
+	"net/url"
+	"sort"
+	"sync"
 	"time"
 
-	"github.com/google/uuid"
+	"Ejercicio_Final-Taller_Go/internal/apikey"
+	"Ejercicio_Final-Taller_Go/internal/apperrors"
+	"Ejercicio_Final-Taller_Go/internal/audit"
+	"Ejercicio_Final-Taller_Go/internal/clock"
+	"Ejercicio_Final-Taller_Go/internal/discovery"
+	"Ejercicio_Final-Taller_Go/internal/idgen"
+	"Ejercicio_Final-Taller_Go/internal/leader"
+	"Ejercicio_Final-Taller_Go/internal/lock"
+	"Ejercicio_Final-Taller_Go/internal/logging"
+	"Ejercicio_Final-Taller_Go/internal/money"
+	"Ejercicio_Final-Taller_Go/internal/redact"
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+	"Ejercicio_Final-Taller_Go/internal/tracing"
+
 	"go.uber.org/zap"
 )
 
 // Error para transiciones inválidas
-var ErrInvalidTransition = errors.New("invalid status transition")
+var ErrInvalidTransition = apperrors.New(apperrors.Conflict, "invalid_status_transition", "invalid status transition")
 
 // Error para estados inválidos
-var ErrInvalidStatus = errors.New("invalid status value")
+var ErrInvalidStatus = apperrors.New(apperrors.Validation, "invalid_status", "invalid status value")
+
+// ErrInvalidAmount is returned when a sale is created with a non-positive amount.
+var ErrInvalidAmount = apperrors.New(apperrors.Unprocessable, "invalid_amount", "amount must be greater than zero")
+
+// ErrAmountTooLarge is returned when a sale is created with an amount over MaxAmount.
+var ErrAmountTooLarge = apperrors.New(apperrors.Unprocessable, "amount_too_large", "amount exceeds the maximum allowed")
+
+// MaxAmount is the largest amount a sale can be created with, far above any
+// real sale and low enough that totals over many sales cannot overflow.
+const MaxAmount money.Cents = 1_000_000_000_00
+
+// ValidateAmount checks that amount can be used for a new sale.
+// Returns ErrInvalidAmount or ErrAmountTooLarge otherwise.
+func ValidateAmount(amount money.Cents) error {
+	switch {
+	case amount <= 0:
+		return ErrInvalidAmount
+	case amount > MaxAmount:
+		return ErrAmountTooLarge
+	}
+	return nil
+}
+
+// ErrInvalidRejectionReason is returned when rejecting a sale without one of
+// the reason codes given to WithRejectionReasons.
+var ErrInvalidRejectionReason = apperrors.New(apperrors.Validation, "invalid_rejection_reason", "a valid rejection reason is required")
+
+// ReasonPaymentFailed is the rejection reason of sales whose payment could
+// not be completed. It is always accepted, so checkouts can be undone
+// whatever reasons are configured.
+const ReasonPaymentFailed = "payment_failed"
+
+// ErrAlreadyClaimed is returned when claiming a sale another reviewer already claimed.
+var ErrAlreadyClaimed = apperrors.New(apperrors.Conflict, "sale_already_claimed", "sale already claimed by another reviewer")
+
+// ErrInvalidReviewer is returned when claiming a sale without naming a reviewer.
+var ErrInvalidReviewer = apperrors.New(apperrors.Validation, "invalid_reviewer", "reviewer is required")
+
+// ErrSaleLocked is returned when another request, possibly on another
+// instance, is updating the same sale at the same time.
+var ErrSaleLocked = apperrors.New(apperrors.Conflict, "sale_locked", "sale is being updated by another request")
+
+// ErrUserNotFound is returned when the user API does not know the sale's user.
+var ErrUserNotFound = apperrors.New(apperrors.NotFound, "user_not_found", "user not found")
+
+// ErrUserNotVerified is returned when creating a sale for a user whose
+// email is not verified, if verified users are required (see WithVerifiedUsersOnly).
+var ErrUserNotVerified = apperrors.New(apperrors.Unprocessable, "user_not_verified", "the user has not verified their email")
+
+// ErrUserBlocked is returned when creating a sale for a user that is blocked
+// from buying, e.g. after a chargeback.
+var ErrUserBlocked = apperrors.New(apperrors.Unprocessable, "user_blocked", "the user is blocked from buying")
+
+// ErrUserAPITimeout is returned when validating the user of a new sale runs
+// past the user API budget (see WithUserAPIBudget).
+var ErrUserAPITimeout = apperrors.New(apperrors.Timeout, "user_api_timeout", "the user API did not answer in time")
+
+// ErrStorageTimeout is returned when the deadline runs out while storing a sale.
+var ErrStorageTimeout = apperrors.New(apperrors.Timeout, "storage_timeout", "the storage did not answer in time")
+
+// errUserAPIUnavailable and errLockUnavailable wrap the failures of the user
+// API and of the lock backend.
+var (
+	errUserAPIUnavailable = apperrors.New(apperrors.DependencyUnavailable, "user_api_unavailable", "the user API is unavailable")
+	errLockUnavailable    = apperrors.New(apperrors.DependencyUnavailable, "lock_unavailable", "the lock service is unavailable")
+)
 
 // Service provides high-level sales management operations on a Storage backend.
 type Service struct {
-	storage    Storage
-	logger     *zap.Logger
-	userAPIURL string // URL base de la API de usuarios
+	storage Storage
+	archive Archive // nil cuando no hay política de retención
+	logger  *zap.Logger
+	userAPI discovery.Endpoints // instancias de la API de usuarios
+	http    *http.Client
+	apiKey  string          // API key enviada a la API de usuarios
+	budget  time.Duration   // tope del deadline para validar el usuario, 0 sin tope
+	reasons map[string]bool // motivos de rechazo aceptados, nil si no se exige
+	ids     idgen.Generator
+	hooks   []Hook
+	clock   clock.Clock
+	locks   lock.Locker // serializa las transiciones de cada venta
+	audit   audit.Store // cambios forzados de estado
+
+	verifiedOnly bool // rechaza las ventas de usuarios sin el email verificado
+
+	breaker     *breaker         // nil sin corte por tasa de rechazos
+	attachments *attachmentStore // nil sin adjuntos
+
+	userAPIMetrics *UserAPIMetrics
+
+	randMu sync.Mutex
+	rand   *rand.Rand // *rand.Rand no es seguro para uso concurrente, se protege con randMu
+}
+
+// Option configures optional dependencies of a Service.
+type Option func(*Service)
+
+// WithClock sets the clock used for timestamps. Defaults to the system clock.
+func WithClock(c clock.Clock) Option {
+	return func(s *Service) {
+		s.clock = c
+	}
+}
+
+// WithRand sets the random source used to assign the initial status of new
+// sales. A source with a fixed seed yields a reproducible status sequence.
+// Defaults to a source seeded from the current time.
+func WithRand(r *rand.Rand) Option {
+	return func(s *Service) {
+		s.rand = r
+	}
+}
+
+// WithUserAPIEndpoints resolves the user API through endpoints instead of
+// the static URL given to NewService.
+func WithUserAPIEndpoints(endpoints discovery.Endpoints) Option {
+	return func(s *Service) {
+		s.userAPI = endpoints
+	}
+}
+
+// WithHTTPClient sets the client used to call the user API, so its
+// connections are pooled and reused. Defaults to http.DefaultClient.
+func WithHTTPClient(c *http.Client) Option {
+	return func(s *Service) {
+		s.http = c
+	}
+}
+
+// WithUserAPIKey authenticates the calls to the user API with the given key.
+func WithUserAPIKey(secret string) Option {
+	return func(s *Service) {
+		s.apiKey = secret
+	}
+}
+
+// WithUserAPIBudget bounds validating the user of a new sale to at most d
+// of the caller's deadline, leaving the remainder to storage. Running past
+// it fails with ErrUserAPITimeout. By default validation may take the whole
+// deadline, and running out of it is not told apart from other timeouts.
+func WithUserAPIBudget(d time.Duration) Option {
+	return func(s *Service) {
+		s.budget = d
+	}
+}
+
+// WithVerifiedUsersOnly refuses sales for users that the user API does not
+// report with "email_verified": true, with ErrUserNotVerified.
+func WithVerifiedUsersOnly() Option {
+	return func(s *Service) {
+		s.verifiedOnly = true
+	}
+}
+
+// WithRejectionReasons requires rejecting a sale with one of codes, or
+// ReasonPaymentFailed. Without it any code is accepted, or none.
+func WithRejectionReasons(codes ...string) Option {
+	return func(s *Service) {
+		s.reasons = map[string]bool{ReasonPaymentFailed: true}
+		for _, c := range codes {
+			s.reasons[c] = true
+		}
+	}
+}
+
+// WithArchive sets the archive that ApplyRetention moves old sales to.
+// Archived sales stay visible through GetSale and FilterSales, marked as
+// Archived. Without one, retention is disabled.
+func WithArchive(a Archive) Option {
+	return func(s *Service) {
+		s.archive = a
+	}
+}
+
+// WithLocker sets the locks that serialize changes to a sale, shared by
+// every instance using the same storage. Defaults to in-process locks.
+func WithLocker(l lock.Locker) Option {
+	return func(s *Service) {
+		s.locks = l
+	}
+}
+
+// WithIDGenerator sets the generator used for new sale IDs. Defaults to UUIDs.
+func WithIDGenerator(ids idgen.Generator) Option {
+	return func(s *Service) {
+		s.ids = ids
+	}
 }
 
 // NewService creates a new Sales Service.
-func NewService(storage Storage, logger *zap.Logger, userAPIURL string) *Service {
+func NewService(storage Storage, logger *zap.Logger, userAPIURL string, opts ...Option) *Service {
 	if logger == nil {
-		logger, _ = zap.NewProduction()
-		defer logger.Sync()
+		logger = zap.NewNop()
+	}
+	s := &Service{
+		storage: storage,
+		logger:  logger,
+		userAPI: discovery.Static(userAPIURL),
+		http:    http.DefaultClient,
+		ids:     idgen.UUID(),
+		clock:   clock.System(),
+		locks:   lock.New(leader.NewLocalStore(clock.System()), saleLockTTL),
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		audit:   audit.NewLocalStore(),
+
+		userAPIMetrics: NewUserAPIMetrics(),
 	}
-	return &Service{
-		storage:    storage,
-		logger:     logger,
-		userAPIURL: userAPIURL,
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
+}
+
+// Clock returns the clock the service dates sales with, for the ages
+// computed from those dates.
+func (s *Service) Clock() clock.Clock {
+	return s.clock
+}
+
+// log returns the logger of the work ctx belongs to, such as a request,
+// with the fields describing it, or the service's logger.
+func (s *Service) log(ctx context.Context) *zap.Logger {
+	return logging.FromContext(ctx, s.logger)
 }
 
 // CreateSale handles the creation of a new sale.
-func (s *Service) CreateSale(userID string, amount float64) (*Sale, error) {
-	if amount <= 0 {
-		return nil, fmt.Errorf("amount must be greater than zero")
+func (s *Service) CreateSale(ctx context.Context, userID string, amount money.Cents) (*Sale, error) {
+	if err := ValidateAmount(amount); err != nil {
+		return nil, err
 	}
 
 	// Validar que el usuario existe llamando a la API de usuarios
-	userExists, err := s.validateUser(userID)
-	if err != nil {
-		s.logger.Error("error validating user", zap.String("user_id", userID), zap.Error(err))
-		return nil, fmt.Errorf("error validating user: %w", err)
-	}
-	if !userExists {
-		return nil, fmt.Errorf("user with ID '%s' not found", userID)
+	if err := s.checkBuyer(ctx, userID); err != nil {
+		return nil, err
 	}
 
+	now := s.clock.Now()
 	sale := &Sale{
-		ID:        uuid.NewString(),
-		UserID:    userID,
-		Amount:    amount,
-		Status:    getRandomStatus(),
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-		Version:   1,
+		ID:              s.ids.NewID(),
+		UserID:          userID,
+		Amount:          amount,
+		Status:          s.initialStatus(ctx, now),
+		StatusChangedAt: now,
+		CreatedBy:       audit.ActorFromContext(ctx),
+		CreatedAt:       now,
+		UpdatedAt:       now,
+		Version:         1,
 	}
 
-	if err := s.storage.Set(sale); err != nil {
-		s.logger.Error("failed to save sale", zap.String("sale_id", sale.ID), zap.Error(err))
-		return nil, fmt.Errorf("failed to save sale: %w", err)
+	// el número solo se consume si la venta se guarda
+	err := s.storage.WithTx(ctx, func(tx Storage) error {
+		number, err := tx.NextNumber(ctx, now)
+		if err != nil {
+			s.log(ctx).Error("failed to issue sale number", zap.Error(err))
+			return fmt.Errorf("failed to issue sale number: %w", err)
+		}
+		sale.Number = number
+
+		if err := tx.Set(ctx, sale); err != nil {
+			s.log(ctx).Error("failed to save sale", zap.String("sale_id", sale.ID), zap.Error(err))
+			return fmt.Errorf("failed to save sale: %w", err)
+		}
+		return nil
+	})
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, fmt.Errorf("%w: %w", ErrStorageTimeout, err)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	s.logger.Info("sale created", zap.String("sale_id", sale.ID), zap.Any("sale", sale))
+	s.log(ctx).Info("sale created", zap.String("sale_id", sale.ID), zap.Any("sale", sale))
+	s.recordDecision(ctx, sale)
+	s.emit(ctx, Event{Type: EventCreated, Sale: *sale})
 	return sale, nil
 }
 
-func (s *Service) validateUser(userID string) (bool, error) {
-	url := fmt.Sprintf("%s/users/%s", s.userAPIURL, userID)
-	resp, err := http.Get(url)
+// checkBuyer checks with the user API that userID can buy, within the user
+// API budget. Returns ErrUserNotFound, ErrUserBlocked, ErrUserNotVerified,
+// ErrUserAPITimeout, or a DependencyUnavailable error if the API fails.
+func (s *Service) checkBuyer(ctx context.Context, userID string) error {
+	userCtx, cancel := ctx, context.CancelFunc(func() {})
+	if s.budget > 0 {
+		userCtx, cancel = context.WithTimeout(ctx, s.budget)
+	}
+	buyer, err := s.validateUser(userCtx, userID)
+	cancel()
 	if err != nil {
-		return false, fmt.Errorf("error making request to user API: %w", err)
+		s.log(ctx).Error("error validating user", zap.String("user_id", userID), zap.Error(err))
+		if s.budget > 0 && errors.Is(userCtx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("%w: error validating user: %w", ErrUserAPITimeout, err)
+		}
+		return errUserAPIUnavailable.Wrap(fmt.Errorf("error validating user: %w", err))
+	}
+	if buyer == nil {
+		return fmt.Errorf("user with ID '%s': %w", userID, ErrUserNotFound)
+	}
+	if buyer.Blocked {
+		return fmt.Errorf("user with ID '%s': %w", userID, ErrUserBlocked)
+	}
+	if s.verifiedOnly && !buyer.EmailVerified {
+		return fmt.Errorf("user with ID '%s': %w", userID, ErrUserNotVerified)
+	}
+	return nil
+}
+
+// GetSale retrieves a sale by its ID, looking in the archive when it is
+// not in the primary store.
+// Returns ErrNotFound if the sale does not exist.
+func (s *Service) GetSale(ctx context.Context, id string) (*Sale, error) {
+	sale, err := s.storage.Read(ctx, id)
+	if errors.Is(err, ErrNotFound) && s.archive != nil {
+		return s.archive.Get(ctx, id)
+	}
+	return sale, err
+}
+
+// GetSaleByNumber retrieves a sale by its human-readable sequential number,
+// looking in the archive when it is not in the primary store.
+// Returns ErrNotFound if no sale has that number.
+func (s *Service) GetSaleByNumber(ctx context.Context, number string) (*Sale, error) {
+	sale, err := s.storage.ReadByNumber(ctx, number)
+	if errors.Is(err, ErrNotFound) && s.archive != nil {
+		return s.archive.ReadByNumber(ctx, number)
+	}
+	return sale, err
+}
+
+// userInfo is what the user API tells about the user of a new sale.
+type userInfo struct {
+	EmailVerified bool `json:"email_verified"`
+	Blocked       bool `json:"blocked"`
+}
+
+// validateUser asks the user API for userID in the tenant of ctx. It
+// returns nil if the user does not exist. The call is a span of the trace
+// of ctx, propagated to the user API with the request ID, and is counted
+// on the service's UserAPIMetrics.
+func (s *Service) validateUser(ctx context.Context, userID string) (*userInfo, error) {
+	// sin ID se pediría /users/, que no es ningún usuario
+	if userID == "" {
+		return nil, nil
+	}
+
+	ctx, span := tracing.Start(ctx, "user_api.get_user")
+	defer span.End(s.logger)
+
+	baseURL, err := s.userAPI.Pick()
+	if err != nil {
+		s.userAPIMetrics.observe(userAPIFailure(err), 0, false)
+		return nil, fmt.Errorf("error resolving user API: %w", err)
+	}
+
+	// el ID se escapa para que no pueda alterar la ruta pedida
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/users/"+url.PathEscape(userID), nil)
+	if err != nil {
+		s.userAPIMetrics.observe(UserAPIError, 0, false)
+		return nil, fmt.Errorf("error building request to user API: %w", err)
+	}
+	req.Header.Set(tenant.Header, tenant.FromContext(ctx))
+	if s.apiKey != "" {
+		req.Header.Set(apikey.Header, s.apiKey)
+	}
+	tracing.Inject(ctx, req.Header)
+
+	start := time.Now()
+	resp, err := s.http.Do(req)
+	latency := time.Since(start)
+	span.SetAttributes(zap.String("peer.url", baseURL), zap.Int64("user_api.latency_ms", latency.Milliseconds()))
+	if err != nil {
+		span.SetAttributes(zap.Error(err))
+		s.userAPIMetrics.observe(userAPIFailure(err), latency, true)
+		if ctx.Err() == nil {
+			s.userAPI.MarkFailed(baseURL)
+		}
+		return nil, fmt.Errorf("error making request to user API: %w", err)
 	}
 	defer resp.Body.Close()
+	// se descarta el cuerpo para que la conexión vuelva al pool
+	defer io.Copy(io.Discard, resp.Body)
+	span.SetAttributes(zap.Int("http.status_code", resp.StatusCode))
 
 	if resp.StatusCode == http.StatusOK {
-		return true, nil
+		// una API que responde sin cuerpo no dice nada más del usuario
+		var info userInfo
+		if err := json.NewDecoder(resp.Body).Decode(&info); err != nil && !errors.Is(err, io.EOF) {
+			s.userAPIMetrics.observe(UserAPIError, latency, true)
+			return nil, fmt.Errorf("error decoding user API response: %w", err)
+		}
+		s.userAPIMetrics.observe(UserAPISuccess, latency, true)
+		return &info, nil
 	} else if resp.StatusCode == http.StatusNotFound {
-		return false, nil
+		s.userAPIMetrics.observe(UserAPINotFound, latency, true)
+		return nil, nil
 	} else {
-		return false, fmt.Errorf("user API returned unexpected status: %d", resp.StatusCode)
+		if resp.StatusCode >= http.StatusInternalServerError {
+			s.userAPIMetrics.observe(UserAPIServerError, latency, true)
+			s.userAPI.MarkFailed(baseURL)
+		} else {
+			s.userAPIMetrics.observe(UserAPIError, latency, true)
+		}
+		return nil, fmt.Errorf("user API returned unexpected status: %d", resp.StatusCode)
 	}
 }
 
-func getRandomStatus() string {
-	statuses := []string{"pending", "approved", "rejected"}
-	randomIndex := rand.Intn(len(statuses))
+// randomStatus picks the initial status of a new sale from the service's random source.
+func (s *Service) randomStatus() SaleStatus {
+	s.randMu.Lock()
+	defer s.randMu.Unlock()
+
+	randomIndex := s.rand.Intn(len(statuses))
 	return statuses[randomIndex]
 }
 
-// Modificar el estado de una venta
-func (s *Service) UpdateSaleStatus(saleID, newStatus string) (*Sale, error) {
-	sale, err := s.storage.Read(saleID)
+// saleLockTTL bounds how long a sale stays locked if its holder dies.
+const saleLockTTL = 10 * time.Second
+
+// lockSale locks the sale saleID of the tenant in ctx.
+// Returns ErrSaleLocked if another request holds it.
+func (s *Service) lockSale(ctx context.Context, saleID string) (func(), error) {
+	release, err := s.locks.Lock(ctx, "sale:"+tenant.FromContext(ctx)+":"+saleID)
+	if errors.Is(err, lock.ErrHeld) {
+		return nil, ErrSaleLocked
+	}
+	if err != nil {
+		s.log(ctx).Error("failed to lock sale", zap.String("sale_id", saleID), zap.Error(err))
+		return nil, errLockUnavailable.Wrap(err)
+	}
+	return release, nil
+}
+
+// readForUpdate returns a copy of the stored sale id, for the caller to
+// change and Set: the stored one is shared with concurrent readers.
+func (s *Service) readForUpdate(ctx context.Context, id string) (*Sale, error) {
+	sale, err := s.storage.Read(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return copySale(sale), nil
+}
+
+// Review attributes a status change: who made it and, optionally, why.
+// RejectionReason is the reason code of rejections; see WithRejectionReasons.
+type Review struct {
+	Actor           string
+	Reason          string
+	RejectionReason string
+}
+
+// ApproveSale approves a pending sale, recording review on it.
+// Returns the same errors as UpdateSaleStatus.
+func (s *Service) ApproveSale(ctx context.Context, saleID string, review Review) (*Sale, error) {
+	return s.changeStatus(ctx, saleID, StatusApproved, review)
+}
+
+// RejectSale rejects a pending sale, recording review on it. Returns
+// ErrInvalidRejectionReason for a reason code that is not accepted, and
+// otherwise the same errors as UpdateSaleStatus.
+func (s *Service) RejectSale(ctx context.Context, saleID string, review Review) (*Sale, error) {
+	return s.changeStatus(ctx, saleID, StatusRejected, review)
+}
+
+// Modificar el estado de una venta. Rechazar así falla con
+// ErrInvalidRejectionReason si se exigen motivos; ver RejectSale.
+func (s *Service) UpdateSaleStatus(ctx context.Context, saleID string, newStatus SaleStatus) (*Sale, error) {
+	return s.changeStatus(ctx, saleID, newStatus, Review{})
+}
+
+// changeStatus moves a pending sale to newStatus, attributed to review.
+func (s *Service) changeStatus(ctx context.Context, saleID string, newStatus SaleStatus, review Review) (*Sale, error) {
+	return s.PatchSale(ctx, saleID, SalePatch{Mask: []string{FieldStatus}, Status: newStatus, Review: review})
+}
+
+// SearchSale returns the sales matching the given filters, oldest first,
+// together with their metadata. An empty userID or status matches every
+// sale. Returns ErrInvalidStatus for an unknown status.
+func (s *Service) SearchSale(ctx context.Context, userID string, status SaleStatus) ([]*Sale, *SalesMetadata, error) {
+	return s.FilterSales(ctx, SalesFilter{UserID: userID, Status: status})
+}
+
+// FilterSales returns the sales matching filter, oldest first, together with
+// their metadata. Returns ErrInvalidStatus for an unknown status.
+func (s *Service) FilterSales(ctx context.Context, filter SalesFilter) ([]*Sale, *SalesMetadata, error) {
+	if filter.Status != "" && !filter.Status.Valid() {
+		return nil, nil, ErrInvalidStatus
+	}
+
+	results, err := s.storage.Search(ctx, filter)
 	if err != nil {
-		return nil, ErrNotFound
+		s.log(ctx).Error("failed to search sales", zap.Error(err))
+		return nil, nil, err
 	}
+	var metadata *SalesMetadata
+	if s.archive == nil {
+		// la storage mantiene los totales, no hace falta recorrer los resultados
+		if metadata, err = s.storage.Aggregate(ctx, filter); err != nil {
+			s.log(ctx).Error("failed to aggregate sales", zap.Error(err))
+			return nil, nil, err
+		}
+	} else {
+		if results, err = s.withArchived(ctx, filter, results); err != nil {
+			return nil, nil, err
+		}
+		metadata = &SalesMetadata{}
+		for _, sale := range results {
+			metadata.Add(sale)
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return createdBefore(results[i], results[j])
+	})
 
-	if newStatus != "approved" && newStatus != "rejected" {
+	return results, metadata, nil
+}
+
+// CountSales returns only the metadata of the sales matching filter,
+// aggregated by the storage without listing them.
+// Returns ErrInvalidStatus for an unknown status.
+func (s *Service) CountSales(ctx context.Context, filter SalesFilter) (*SalesMetadata, error) {
+	if filter.Status != "" && !filter.Status.Valid() {
 		return nil, ErrInvalidStatus
+	}
 
+	metadata, err := s.storage.Aggregate(ctx, filter)
+	if err != nil {
+		s.log(ctx).Error("failed to aggregate sales", zap.Error(err))
+		return nil, err
+	}
+
+	archived, err := s.archivedOnly(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	for _, sale := range archived {
+		metadata.Add(sale)
+	}
+	return metadata, nil
+}
+
+// StreamSales calls fn for every sale matching the given filters, without
+// loading them all in memory first, archived ones last. It stops at the
+// first error returned by fn. Returns ErrInvalidStatus for an unknown status.
+func (s *Service) StreamSales(ctx context.Context, userID string, status SaleStatus, fn func(*Sale) error) error {
+	if status != "" && !status.Valid() {
+		return ErrInvalidStatus
+	}
+
+	filter := SalesFilter{UserID: userID, Status: status}
+	err := s.storage.Iterate(ctx, func(sale *Sale) error {
+		if !filter.Matches(sale) {
+			return nil
+		}
+		return fn(sale)
+	})
+	if err != nil {
+		return err
 	}
 
-	if sale.Status != "pending" {
+	archived, err := s.archivedOnly(ctx, filter)
+	if err != nil {
+		return err
+	}
+	for _, sale := range archived {
+		if err := fn(sale); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Tenants returns the tenants that have sales, for jobs that process every tenant.
+func (s *Service) Tenants(ctx context.Context) ([]string, error) {
+	tenants, err := s.storage.Tenants(ctx)
+	if err != nil {
+		s.log(ctx).Error("failed to list tenants", zap.Error(err))
+		return nil, err
+	}
+	return tenants, nil
+}
+
+// dashboardTopUsers is how many users the admin dashboard ranks.
+const dashboardTopUsers = 5
+
+// Dashboard returns the admin summary of today's activity (since local midnight).
+func (s *Service) Dashboard(ctx context.Context) (*Dashboard, error) {
+	now := s.clock.Now()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	d, err := s.storage.Dashboard(ctx, midnight, dashboardTopUsers)
+	if err != nil {
+		s.log(ctx).Error("failed to build dashboard", zap.Error(err))
+		return nil, err
+	}
+	return d, nil
+}
+
+// SummarizeUser returns the sales metadata of a user together with the
+// creation time of their latest sale (nil when they have none).
+func (s *Service) SummarizeUser(ctx context.Context, userID string) (*UserSummary, error) {
+	results, metadata, err := s.SearchSale(ctx, userID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &UserSummary{SalesMetadata: *metadata}
+	for _, sale := range results {
+		if summary.LastSaleAt == nil || sale.CreatedAt.After(*summary.LastSaleAt) {
+			createdAt := sale.CreatedAt
+			summary.LastSaleAt = &createdAt
+		}
+	}
+	return summary, nil
+}
+
+// SalesBySeller returns the totals of the sales created from from up to,
+// but excluding, to, per seller (the CreatedBy of each sale), highest
+// revenue first. A zero from or to leaves that end of the range open.
+// Sales created without an authenticated actor count under an empty seller.
+func (s *Service) SalesBySeller(ctx context.Context, from, to time.Time) ([]SellerTotal, error) {
+	var filter SalesFilter
+	if !from.IsZero() {
+		filter.CreatedFrom = &from
+	}
+	if !to.IsZero() {
+		end := to.Add(-time.Nanosecond)
+		filter.CreatedTo = &end
+	}
+
+	results, err := s.storage.Search(ctx, filter)
+	if err != nil {
+		s.log(ctx).Error("failed to search sales", zap.Error(err))
+		return nil, err
+	}
+	if results, err = s.withArchived(ctx, filter, results); err != nil {
+		return nil, err
+	}
+
+	bySeller := map[string]*SellerTotal{}
+	for _, sale := range results {
+		total, ok := bySeller[sale.CreatedBy]
+		if !ok {
+			total = &SellerTotal{Seller: sale.CreatedBy}
+			bySeller[sale.CreatedBy] = total
+		}
+		total.Add(sale)
+		if sale.Status == StatusApproved {
+			total.Revenue += sale.Amount
+		}
+	}
+
+	totals := make([]SellerTotal, 0, len(bySeller))
+	for _, total := range bySeller {
+		totals = append(totals, *total)
+	}
+	sort.Slice(totals, func(i, j int) bool {
+		if totals[i].Revenue != totals[j].Revenue {
+			return totals[i].Revenue > totals[j].Revenue
+		}
+		return totals[i].Seller < totals[j].Seller
+	})
+	return totals, nil
+}
+
+// VolumeWindows returns the sales created in each of the n consecutive
+// windows of the given length that end at end, oldest first, counting the
+// rejected ones apart. Sales are streamed, so n can cover a long period.
+func (s *Service) VolumeWindows(ctx context.Context, end time.Time, window time.Duration, n int) ([]Volume, error) {
+	start := end.Add(-time.Duration(n) * window)
+	volumes := make([]Volume, n)
+	for i := range volumes {
+		volumes[i].From = start.Add(time.Duration(i) * window)
+	}
+
+	err := s.storage.Iterate(ctx, func(sale *Sale) error {
+		if sale.CreatedAt.Before(start) || !sale.CreatedAt.Before(end) {
+			return nil
+		}
+		v := &volumes[sale.CreatedAt.Sub(start)/window]
+		v.Total++
+		if sale.Status == StatusRejected {
+			v.Rejected++
+		}
+		return nil
+	})
+	if err != nil {
+		s.log(ctx).Error("failed to iterate sales", zap.Error(err))
+		return nil, err
+	}
+	return volumes, nil
+}
+
+// PendingSales returns a page of pending sales, oldest first, together with
+// the total number of pending sales matching the filter. A non-empty
+// assignedTo keeps only the sales claimed by that reviewer.
+func (s *Service) PendingSales(ctx context.Context, assignedTo string, limit, offset int) ([]*Sale, int, error) {
+	// Iterate ya las da de la más vieja a la más nueva
+	pending := make([]*Sale, 0)
+	err := s.storage.Iterate(ctx, func(sale *Sale) error {
+		if sale.Status == StatusPending && (assignedTo == "" || sale.AssignedTo == assignedTo) {
+			pending = append(pending, sale)
+		}
+		return nil
+	})
+	if err != nil {
+		s.log(ctx).Error("failed to list sales", zap.Error(err))
+		return nil, 0, err
+	}
+
+	total := len(pending)
+	if offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	return pending[offset:end], total, nil
+}
+
+// ClaimSale assigns a pending sale to reviewer for manual review. Claiming a
+// sale already claimed by the same reviewer is a no-op.
+// Returns ErrInvalidTransition if the sale is no longer pending and
+// ErrAlreadyClaimed if another reviewer holds it.
+func (s *Service) ClaimSale(ctx context.Context, saleID, reviewer string) (*Sale, error) {
+	if reviewer == "" {
+		return nil, ErrInvalidReviewer
+	}
+
+	release, err := s.lockSale(ctx, saleID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	sale, err := s.readForUpdate(ctx, saleID)
+	if err != nil {
+		return nil, err
+	}
+
+	if sale.Status != StatusPending {
 		return nil, ErrInvalidTransition
 	}
+	if sale.AssignedTo == reviewer {
+		return sale, nil
+	}
+	if sale.AssignedTo != "" {
+		return nil, ErrAlreadyClaimed
+	}
 
-	sale.Status = newStatus
-	sale.UpdatedAt = time.Now()
+	sale.AssignedTo = reviewer
+	sale.UpdatedAt = s.clock.Now()
 	sale.Version++
 
-	if err := s.storage.Set(sale); err != nil {
-		s.logger.Error("failed to update sale", zap.String("sale_id", sale.ID), zap.Error(err))
+	if err := s.storage.Set(ctx, sale); err != nil {
+		s.log(ctx).Error("failed to claim sale", zap.String("sale_id", sale.ID), zap.Error(err))
 		return nil, err
 	}
 
+	s.log(ctx).Info("sale claimed", zap.String("sale_id", sale.ID), zap.String("reviewer", redact.Mask(reviewer)))
 	return sale, nil
 }
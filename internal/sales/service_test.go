@@ -0,0 +1,777 @@
+package sales
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/apperrors"
+	"Ejercicio_Final-Taller_Go/internal/clock"
+	"Ejercicio_Final-Taller_Go/internal/leader"
+	"Ejercicio_Final-Taller_Go/internal/lock"
+	"Ejercicio_Final-Taller_Go/internal/logging"
+	"Ejercicio_Final-Taller_Go/internal/objstore"
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+	"Ejercicio_Final-Taller_Go/internal/tracing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestService_CreateSale_Errors(t *testing.T) {
+	userAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/users/known" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer userAPI.Close()
+
+	ctx := context.Background()
+	s := NewService(NewLocalStorage(), zap.NewNop(), userAPI.URL)
+
+	_, err := s.CreateSale(ctx, "known", 0)
+	require.True(t, errors.Is(err, ErrInvalidAmount))
+
+	_, err = s.CreateSale(ctx, "unknown", 1000)
+	require.True(t, errors.Is(err, ErrUserNotFound))
+
+	sale, err := s.CreateSale(ctx, "known", 1000)
+	require.NoError(t, err)
+	require.NotEmpty(t, sale.ID)
+	require.Equal(t, 1, sale.Version)
+	require.Equal(t, fmt.Sprintf("%d-000001", sale.CreatedAt.Year()), sale.Number)
+
+	byNumber, err := s.GetSaleByNumber(ctx, sale.Number)
+	require.NoError(t, err)
+	require.Equal(t, sale.ID, byNumber.ID)
+}
+
+func TestService_CreateSale_SeededStatus(t *testing.T) {
+	userAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer userAPI.Close()
+
+	ctx := context.Background()
+	statusSequence := func() []SaleStatus {
+		s := NewService(NewLocalStorage(), zap.NewNop(), userAPI.URL, WithRand(rand.New(rand.NewSource(42))))
+		seq := make([]SaleStatus, 0, 10)
+		for i := 0; i < 10; i++ {
+			sale, err := s.CreateSale(ctx, "known", 1000)
+			require.NoError(t, err)
+			seq = append(seq, sale.Status)
+		}
+		return seq
+	}
+
+	require.Equal(t, statusSequence(), statusSequence())
+}
+
+func TestService_SearchSale(t *testing.T) {
+	ctx := context.Background()
+	storage := NewLocalStorage()
+	require.NoError(t, storage.Set(ctx, &Sale{ID: "1", UserID: "a", Amount: 1000, Status: StatusApproved}))
+	require.NoError(t, storage.Set(ctx, &Sale{ID: "2", UserID: "a", Amount: 550, Status: StatusPending}))
+	require.NoError(t, storage.Set(ctx, &Sale{ID: "3", UserID: "b", Amount: 700, Status: StatusRejected}))
+
+	s := NewService(storage, zap.NewNop(), "")
+
+	results, metadata, err := s.SearchSale(ctx, "a", "")
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.Equal(t, &SalesMetadata{Quantity: 2, Approved: 1, Pending: 1, TotalAmount: 1550}, metadata)
+
+	results, _, err = s.SearchSale(ctx, "", StatusRejected)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+
+	_, _, err = s.SearchSale(ctx, "", "unknown")
+	require.ErrorIs(t, err, ErrInvalidStatus)
+}
+
+func TestService_CountSales(t *testing.T) {
+	ctx := context.Background()
+	storage := NewLocalStorage()
+	require.NoError(t, storage.Set(ctx, &Sale{ID: "1", UserID: "a", Amount: 1000, Status: StatusApproved}))
+	require.NoError(t, storage.Set(ctx, &Sale{ID: "2", UserID: "a", Amount: 550, Status: StatusPending}))
+	require.NoError(t, storage.Set(ctx, &Sale{ID: "3", UserID: "b", Amount: 700, Status: StatusRejected}))
+
+	s := NewService(storage, zap.NewNop(), "")
+
+	filter, err := ParseFilter("amount>=7")
+	require.NoError(t, err)
+	metadata, err := s.CountSales(ctx, filter)
+	require.NoError(t, err)
+	require.Equal(t, &SalesMetadata{Quantity: 2, Approved: 1, Rejected: 1, TotalAmount: 1700}, metadata)
+
+	_, err = s.CountSales(ctx, SalesFilter{Status: "unknown"})
+	require.ErrorIs(t, err, ErrInvalidStatus)
+}
+
+func TestLocalStorage_TenantIsolation(t *testing.T) {
+	storage := NewLocalStorage()
+	acme := tenant.WithID(context.Background(), "acme")
+	globex := tenant.WithID(context.Background(), "globex")
+
+	require.NoError(t, storage.Set(acme, &Sale{ID: "1", Status: StatusPending}))
+
+	_, err := storage.Read(acme, "1")
+	require.NoError(t, err)
+
+	_, err = storage.Read(globex, "1")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	all, err := storage.GetAll(globex)
+	require.NoError(t, err)
+	require.Empty(t, all)
+}
+
+func TestService_Dashboard(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 3, 10, 15, 0, 0, 0, time.UTC)
+	storage := NewLocalStorage()
+	require.NoError(t, storage.Set(ctx, &Sale{ID: "old", UserID: "a", Amount: 900, Status: StatusPending, CreatedAt: now.Add(-24 * time.Hour)}))
+	require.NoError(t, storage.Set(ctx, &Sale{ID: "1", UserID: "a", Amount: 1000, Status: StatusApproved, CreatedAt: now.Add(-time.Hour)}))
+	require.NoError(t, storage.Set(ctx, &Sale{ID: "2", UserID: "b", Amount: 3000, Status: StatusRejected, CreatedAt: now.Add(-2 * time.Hour)}))
+	require.NoError(t, storage.Set(ctx, &Sale{ID: "3", UserID: "b", Amount: 500, Status: StatusApproved, CreatedAt: now}))
+
+	s := NewService(storage, zap.NewNop(), "", WithClock(clock.NewManual(now)))
+
+	d, err := s.Dashboard(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 3, d.SalesCount)
+	require.EqualValues(t, 1500, d.Revenue)
+	require.Equal(t, 1, d.PendingApprovals)
+	require.InDelta(t, 1.0/3.0, d.RejectionRate, 1e-9)
+	require.Equal(t, []UserTotal{
+		{UserID: "b", Quantity: 2, TotalAmount: 3500},
+		{UserID: "a", Quantity: 1, TotalAmount: 1000},
+	}, d.TopUsers)
+}
+
+func TestService_SalesBySeller(t *testing.T) {
+	ctx := context.Background()
+	day := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+	storage := NewLocalStorage()
+	require.NoError(t, storage.Set(ctx, &Sale{ID: "1", CreatedBy: "apikey:shop", Amount: 1000, Status: StatusApproved, CreatedAt: day}))
+	require.NoError(t, storage.Set(ctx, &Sale{ID: "2", CreatedBy: "apikey:shop", Amount: 3000, Status: StatusRejected, CreatedAt: day.Add(time.Hour)}))
+	require.NoError(t, storage.Set(ctx, &Sale{ID: "3", CreatedBy: "apikey:pos", Amount: 2000, Status: StatusApproved, CreatedAt: day.Add(2 * time.Hour)}))
+	require.NoError(t, storage.Set(ctx, &Sale{ID: "4", Amount: 500, Status: StatusPending, CreatedAt: day.Add(3 * time.Hour)}))
+	require.NoError(t, storage.Set(ctx, &Sale{ID: "late", CreatedBy: "apikey:shop", Amount: 9000, Status: StatusApproved, CreatedAt: day.AddDate(0, 0, 1)}))
+
+	s := NewService(storage, zap.NewNop(), "")
+
+	totals, err := s.SalesBySeller(ctx, day, day.AddDate(0, 0, 1))
+	require.NoError(t, err)
+	require.Equal(t, []SellerTotal{
+		{Seller: "apikey:pos", SalesMetadata: SalesMetadata{Quantity: 1, Approved: 1, TotalAmount: 2000}, Revenue: 2000},
+		{Seller: "apikey:shop", SalesMetadata: SalesMetadata{Quantity: 2, Approved: 1, Rejected: 1, TotalAmount: 4000}, Revenue: 1000},
+		{Seller: "", SalesMetadata: SalesMetadata{Quantity: 1, Pending: 1, TotalAmount: 500}},
+	}, totals)
+
+	// sin límites entran todas
+	totals, err = s.SalesBySeller(ctx, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, "apikey:shop", totals[0].Seller)
+	require.EqualValues(t, 10000, totals[0].Revenue)
+}
+
+func TestService_ApplyRetention(t *testing.T) {
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	acme := tenant.WithID(context.Background(), "acme")
+	globex := tenant.WithID(context.Background(), "globex")
+	storage := NewLocalStorage()
+	require.NoError(t, storage.Set(acme, &Sale{ID: "old", Number: "2023-000001", UserID: "a", Amount: 1000, Status: StatusApproved, CreatedAt: now.AddDate(-1, 0, 0)}))
+	require.NoError(t, storage.Set(acme, &Sale{ID: "old-pending", UserID: "a", Amount: 200, Status: StatusPending, CreatedAt: now.AddDate(-1, 0, 0)}))
+	require.NoError(t, storage.Set(acme, &Sale{ID: "new", UserID: "a", Amount: 300, Status: StatusRejected, CreatedAt: now.AddDate(0, -1, 0)}))
+	require.NoError(t, storage.Set(globex, &Sale{ID: "g-old", UserID: "b", Amount: 400, Status: StatusRejected, CreatedAt: now.AddDate(0, -7, 0)}))
+
+	dir := t.TempDir()
+	archive := NewBucketArchive(objstore.Dir(dir))
+	s := NewService(storage, zap.NewNop(), "", WithClock(clock.NewManual(now)), WithArchive(archive))
+
+	moved, err := s.ApplyRetention(context.Background(), 6)
+	require.NoError(t, err)
+	require.Equal(t, 2, moved)
+
+	_, err = storage.Read(acme, "old")
+	require.ErrorIs(t, err, ErrNotFound)
+	_, err = storage.ReadByNumber(acme, "2023-000001")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// los archivados siguen visibles, marcados como tales
+	results, metadata, err := s.SearchSale(acme, "a", "")
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	require.Equal(t, "old", results[0].ID)
+	require.True(t, results[0].Archived)
+	require.False(t, results[2].Archived)
+	require.EqualValues(t, 1500, metadata.TotalAmount)
+
+	count, err := s.CountSales(acme, SalesFilter{Status: StatusApproved})
+	require.NoError(t, err)
+	require.Equal(t, 1, count.Quantity)
+
+	sale, err := s.GetSale(globex, "g-old")
+	require.NoError(t, err)
+	require.True(t, sale.Archived)
+	_, err = s.GetSale(globex, "old")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	sale, err = s.Unarchive(acme, "old")
+	require.NoError(t, err)
+	require.False(t, sale.Archived)
+	stored, err := storage.ReadByNumber(acme, "2023-000001")
+	require.NoError(t, err)
+	require.False(t, stored.Archived)
+
+	_, err = s.Unarchive(acme, "old")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// un archivo recién abierto sobre el mismo directorio encuentra las ventas
+	results, err = NewBucketArchive(objstore.Dir(dir)).Search(globex, SalesFilter{})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+}
+
+func TestService_ApplyRetention_Locked(t *testing.T) {
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	ctx := tenant.WithID(context.Background(), "acme")
+	storage := NewLocalStorage()
+	require.NoError(t, storage.Set(ctx, &Sale{ID: "old", Status: StatusApproved, CreatedAt: now.AddDate(-1, 0, 0)}))
+
+	locks := lock.New(leader.NewLocalStore(clock.System()), time.Minute)
+	s := NewService(storage, zap.NewNop(), "", WithClock(clock.NewManual(now)), WithLocker(locks),
+		WithArchive(NewBucketArchive(objstore.Dir(t.TempDir()))))
+
+	// otra instancia está modificando la venta: queda para la próxima pasada
+	release, err := locks.Lock(ctx, "sale:acme:old")
+	require.NoError(t, err)
+	moved, err := s.ApplyRetention(context.Background(), 6)
+	require.NoError(t, err)
+	require.Zero(t, moved)
+	_, err = storage.Read(ctx, "old")
+	require.NoError(t, err)
+
+	release()
+	moved, err = s.ApplyRetention(context.Background(), 6)
+	require.NoError(t, err)
+	require.Equal(t, 1, moved)
+	sale, err := s.GetSale(ctx, "old")
+	require.NoError(t, err)
+	require.True(t, sale.Archived)
+}
+
+func TestService_ArchivedInPrimaryStore(t *testing.T) {
+	ctx := tenant.WithID(context.Background(), "acme")
+	storage := NewLocalStorage()
+	archive := NewBucketArchive(objstore.Dir(t.TempDir()))
+	s := NewService(storage, zap.NewNop(), "", WithArchive(archive))
+
+	// el borrado de "dup" falló tras archivarla: está en los dos lados
+	dup := &Sale{ID: "dup", Number: "2023-000001", UserID: "a", Amount: 100, Status: StatusApproved}
+	require.NoError(t, storage.Set(ctx, dup))
+	require.NoError(t, archive.Put(ctx, dup))
+	require.NoError(t, archive.Put(ctx, &Sale{ID: "old", Number: "2023-000002", UserID: "a", Amount: 200, Status: StatusApproved}))
+
+	count, err := s.CountSales(ctx, SalesFilter{UserID: "a"})
+	require.NoError(t, err)
+	require.Equal(t, 2, count.Quantity)
+	require.EqualValues(t, 300, count.TotalAmount)
+
+	var streamed []string
+	require.NoError(t, s.StreamSales(ctx, "a", "", func(sale *Sale) error {
+		streamed = append(streamed, sale.ID)
+		return nil
+	}))
+	require.Equal(t, []string{"dup", "old"}, streamed)
+
+	sale, err := s.GetSaleByNumber(ctx, "2023-000002")
+	require.NoError(t, err)
+	require.Equal(t, "old", sale.ID)
+	require.True(t, sale.Archived)
+	_, err = s.GetSaleByNumber(ctx, "2023-000003")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestBucketArchive_Refresh(t *testing.T) {
+	acme := tenant.WithID(context.Background(), "acme")
+	globex := tenant.WithID(context.Background(), "globex")
+	dir := t.TempDir()
+	c := clock.NewManual(time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC))
+	writer := NewBucketArchive(objstore.Dir(dir))
+	reader := NewBucketArchive(objstore.Dir(dir), WithArchiveClock(c), WithIndexRefresh(time.Minute), WithIndexedTenants(1))
+
+	_, err := reader.Get(acme, "1")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// lo que archiva otra instancia se ve al refrescar el índice
+	require.NoError(t, writer.Put(acme, &Sale{ID: "1", Status: StatusApproved}))
+	_, err = reader.Get(acme, "1")
+	require.ErrorIs(t, err, ErrNotFound)
+	c.Advance(time.Minute)
+	_, err = reader.Get(acme, "1")
+	require.NoError(t, err)
+
+	// y también lo que restaura
+	require.NoError(t, writer.Delete(acme, "1"))
+	c.Advance(time.Minute)
+	_, err = reader.Get(acme, "1")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// solo se guarda el índice de un tenant
+	_, err = reader.Get(globex, "1")
+	require.ErrorIs(t, err, ErrNotFound)
+	require.Len(t, reader.index, 1)
+	require.Contains(t, reader.index, "globex")
+}
+
+func TestService_UpdateSaleStatus_Locked(t *testing.T) {
+	ctx := tenant.WithID(context.Background(), "acme")
+	storage := NewLocalStorage()
+	require.NoError(t, storage.Set(ctx, &Sale{ID: "1", Status: StatusPending, Version: 1}))
+
+	// otra instancia comparte los locks y está modificando la venta
+	locks := lock.New(leader.NewLocalStore(clock.System()), time.Minute)
+	s := NewService(storage, zap.NewNop(), "", WithLocker(locks))
+	release, err := locks.Lock(ctx, "sale:acme:1")
+	require.NoError(t, err)
+
+	_, err = s.UpdateSaleStatus(ctx, "1", StatusApproved)
+	require.ErrorIs(t, err, ErrSaleLocked)
+	require.Equal(t, 409, apperrors.HTTPStatus(err))
+	_, err = s.ClaimSale(ctx, "1", "reviewer")
+	require.ErrorIs(t, err, ErrSaleLocked)
+
+	release()
+	sale, err := s.UpdateSaleStatus(ctx, "1", StatusApproved)
+	require.NoError(t, err)
+	require.Equal(t, 2, sale.Version)
+}
+
+func TestCreationQueue_Full(t *testing.T) {
+	s := NewService(NewLocalStorage(), zap.NewNop(), "")
+	q := NewCreationQueue(s, 1, 0, time.Hour)
+	ctx := tenant.WithID(context.Background(), "acme")
+
+	_, err := q.Enqueue(ctx, "a", 0)
+	require.ErrorIs(t, err, ErrInvalidAmount)
+
+	job, err := q.Enqueue(ctx, "a", 100)
+	require.NoError(t, err)
+	require.Equal(t, JobQueued, job.Status)
+
+	// sin workers la cola de un lugar ya está llena
+	_, err = q.Enqueue(ctx, "a", 100)
+	require.ErrorIs(t, err, ErrCreationQueueFull)
+
+	_, err = q.Get(ctx, job.ID)
+	require.NoError(t, err)
+	_, err = q.Get(tenant.WithID(context.Background(), "globex"), job.ID)
+	require.ErrorIs(t, err, ErrCreationJobNotFound)
+}
+
+func TestCreationQueue_JobDone(t *testing.T) {
+	// sin API de usuarios la creación falla
+	s := NewService(NewLocalStorage(), zap.NewNop(), "")
+	type ctxKey struct{}
+	done := make(chan CreationJob, 1)
+	q := NewCreationQueue(s, 1, 0, time.Hour, WithJobDone(func(ctx context.Context, job CreationJob) {
+		require.Equal(t, "request", ctx.Value(ctxKey{}))
+		done <- job
+	}))
+	runCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(runCtx, 1)
+
+	// el fallo se registra con el logger del request
+	core, logs := observer.New(zap.WarnLevel)
+	ctx := logging.WithContext(context.WithValue(context.Background(), ctxKey{}, "request"), zap.New(core).With(zap.String("request_id", "req-1")))
+	ctx, cancelRequest := context.WithCancel(ctx)
+	job, err := q.Enqueue(ctx, "a", 100)
+	require.NoError(t, err)
+	cancelRequest()
+
+	finished := <-done
+	require.Equal(t, job.ID, finished.ID)
+	require.Equal(t, JobFailed, finished.Status)
+	require.Error(t, finished.Err)
+	entries := logs.FilterMessage("async sale creation failed").All()
+	require.Len(t, entries, 1)
+	require.Equal(t, "req-1", entries[0].ContextMap()["request_id"])
+}
+
+func TestCreationQueue_Drain(t *testing.T) {
+	s := NewService(NewLocalStorage(), zap.NewNop(), "")
+	q := NewCreationQueue(s, 2, 0, time.Hour)
+	ctx := context.Background()
+	first, err := q.Enqueue(ctx, "a", 100)
+	require.NoError(t, err)
+	second, err := q.Enqueue(ctx, "b", 100)
+	require.NoError(t, err)
+
+	// detenida antes de empezar, igual termina las creaciones encoladas
+	runCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	q.Run(runCtx, 1)
+
+	for _, id := range []string{first.ID, second.ID} {
+		job, err := q.Get(ctx, id)
+		require.NoError(t, err)
+		require.Equal(t, JobFailed, job.Status)
+	}
+}
+
+func TestCreateSale_Transaction(t *testing.T) {
+	users := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer users.Close()
+
+	errSave := errors.New("disk full")
+	storage := &failingSetStorage{LocalStorage: NewLocalStorage(), err: errSave}
+	s := NewService(storage, zap.NewNop(), users.URL)
+
+	_, err := s.CreateSale(context.Background(), "u1", 1000)
+	require.ErrorIs(t, err, errSave)
+	require.Equal(t, 1, storage.txs)
+}
+
+// failingSetStorage is a LocalStorage whose writes fail, counting the
+// transactions opened on it.
+type failingSetStorage struct {
+	*LocalStorage
+	err error
+	txs int
+}
+
+func (f *failingSetStorage) Set(ctx context.Context, sale *Sale) error {
+	return f.err
+}
+
+func (f *failingSetStorage) WithTx(ctx context.Context, fn func(tx Storage) error) error {
+	f.txs++
+	return fn(f)
+}
+
+func TestService_CreateSale_Budget(t *testing.T) {
+	users := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/users/slow" {
+			<-r.Context().Done()
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer users.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	s := NewService(NewLocalStorage(), zap.NewNop(), users.URL, WithUserAPIBudget(20*time.Millisecond))
+	_, err := s.CreateSale(ctx, "slow", 1000)
+	require.ErrorIs(t, err, ErrUserAPITimeout)
+	require.Equal(t, apperrors.Timeout, apperrors.KindOf(err))
+
+	// el resto del deadline es del almacenamiento
+	storage := &failingSetStorage{LocalStorage: NewLocalStorage(), err: fmt.Errorf("redis: %w", context.DeadlineExceeded)}
+	s = NewService(storage, zap.NewNop(), users.URL, WithUserAPIBudget(time.Second))
+	_, err = s.CreateSale(ctx, "u1", 1000)
+	require.ErrorIs(t, err, ErrStorageTimeout)
+}
+
+func TestLocalStorage_AggregateReadModel(t *testing.T) {
+	ctx := context.Background()
+	storage := NewLocalStorage()
+	require.NoError(t, storage.Set(ctx, &Sale{ID: "1", UserID: "a", Amount: 1000, Status: StatusPending}))
+	require.NoError(t, storage.Set(ctx, &Sale{ID: "2", UserID: "a", Amount: 500, Status: StatusApproved}))
+	require.NoError(t, storage.Set(ctx, &Sale{ID: "3", UserID: "b", Amount: 300, Status: StatusRejected}))
+
+	// se modifica la venta guardada antes de volver a guardarla, como hace el servicio
+	sale, err := storage.Read(ctx, "1")
+	require.NoError(t, err)
+	sale.Status = StatusApproved
+	require.NoError(t, storage.Set(ctx, sale))
+	require.NoError(t, storage.Delete(ctx, "3"))
+
+	for _, filter := range []SalesFilter{{}, {UserID: "a"}, {Status: StatusApproved}, {UserID: "b"}, {UserID: "a", Status: StatusPending}} {
+		got, err := storage.Aggregate(ctx, filter)
+		require.NoError(t, err)
+
+		want := &SalesMetadata{}
+		storage.Range(ctx, func(s *Sale) {
+			if filter.Matches(s) {
+				want.Add(s)
+			}
+		})
+		require.Equal(t, want, got, "filter %+v", filter)
+	}
+}
+
+func TestLocalStorage_IterateCreationOrder(t *testing.T) {
+	ctx := context.Background()
+	storage := NewLocalStorage()
+	base := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	for _, sale := range []*Sale{
+		{ID: "c", CreatedAt: base.Add(time.Minute)},
+		{ID: "b", CreatedAt: base},
+		{ID: "a", CreatedAt: base},
+		{ID: "d", CreatedAt: base.Add(-time.Hour)},
+	} {
+		require.NoError(t, storage.Set(ctx, sale))
+	}
+
+	var ids []string
+	require.NoError(t, storage.Iterate(ctx, func(sale *Sale) error {
+		ids = append(ids, sale.ID)
+		return nil
+	}))
+	require.Equal(t, []string{"d", "a", "b", "c"}, ids)
+
+	all, err := storage.GetAll(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "d", all[0].ID)
+	require.Equal(t, "c", all[3].ID)
+}
+
+func TestService_RejectSale_Reasons(t *testing.T) {
+	ctx := context.Background()
+	storage := NewLocalStorage()
+	s := NewService(storage, zap.NewNop(), "", WithRejectionReasons("fraud", "other"))
+	for _, id := range []string{"s1", "s2", "s3"} {
+		require.NoError(t, storage.Set(ctx, &Sale{ID: id, Status: StatusPending, Version: 1}))
+	}
+
+	_, err := s.RejectSale(ctx, "s1", Review{Actor: "ana"})
+	require.ErrorIs(t, err, ErrInvalidRejectionReason)
+	_, err = s.UpdateSaleStatus(ctx, "s1", StatusRejected)
+	require.ErrorIs(t, err, ErrInvalidRejectionReason)
+	_, err = s.RejectSale(ctx, "s1", Review{RejectionReason: "unknown"})
+	require.ErrorIs(t, err, ErrInvalidRejectionReason)
+
+	sale, err := s.RejectSale(ctx, "s1", Review{Actor: "ana", Reason: "stolen card", RejectionReason: "fraud"})
+	require.NoError(t, err)
+	require.Equal(t, "fraud", sale.RejectionReason)
+	require.Equal(t, "stolen card", sale.StatusReason)
+
+	// el de pagos fallidos siempre se acepta
+	_, err = s.RejectSale(ctx, "s2", Review{RejectionReason: ReasonPaymentFailed})
+	require.NoError(t, err)
+
+	// aprobar no deja motivo de rechazo
+	sale, err = s.ApproveSale(ctx, "s3", Review{RejectionReason: "fraud"})
+	require.NoError(t, err)
+	require.Empty(t, sale.RejectionReason)
+}
+
+func TestService_PatchSale(t *testing.T) {
+	ctx := context.Background()
+	storage := NewLocalStorage()
+	s := NewService(storage, zap.NewNop(), "")
+	require.NoError(t, storage.Set(ctx, &Sale{ID: "s1", Status: StatusPending, Version: 1}))
+
+	sale, err := s.PatchSale(ctx, "s1", SalePatch{
+		Mask:     []string{FieldMetadata, FieldTags, FieldNotes},
+		Metadata: Metadata{"channel": "web"},
+		Tags:     []string{"vip"},
+		Notes:    "called the customer",
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, sale.Version)
+	require.Equal(t, Metadata{"channel": "web"}, sale.Metadata)
+	require.Equal(t, []string{"vip"}, sale.Tags)
+
+	// los campos fuera de la máscara se mantienen
+	sale, err = s.PatchSale(ctx, "s1", SalePatch{Mask: []string{FieldStatus, FieldTags}, Status: StatusApproved})
+	require.NoError(t, err)
+	require.Equal(t, StatusApproved, sale.Status)
+	require.Nil(t, sale.Tags)
+	require.Equal(t, "called the customer", sale.Notes)
+	require.Equal(t, 3, sale.Version)
+
+	// una venta decidida ya no cambia sus metadatos
+	_, err = s.PatchSale(ctx, "s1", SalePatch{Mask: []string{FieldMetadata}})
+	require.ErrorIs(t, err, ErrImmutableField)
+	_, err = s.PatchSale(ctx, "s1", SalePatch{Mask: []string{FieldStatus}, Status: StatusRejected})
+	require.ErrorIs(t, err, ErrInvalidTransition)
+	sale, err = s.PatchSale(ctx, "s1", SalePatch{Mask: []string{FieldNotes}, Notes: "delivered"})
+	require.NoError(t, err)
+	require.Equal(t, 4, sale.Version)
+
+	_, err = s.PatchSale(ctx, "s1", SalePatch{})
+	require.ErrorIs(t, err, ErrEmptyPatch)
+	_, err = s.PatchSale(ctx, "s1", SalePatch{Mask: []string{"amount"}})
+	require.ErrorIs(t, err, ErrUnknownField)
+	_, err = s.PatchSale(ctx, "s1", SalePatch{Mask: []string{FieldTags}, Tags: []string{""}})
+	require.ErrorIs(t, err, ErrInvalidSaleData)
+}
+
+func TestService_PatchSale_CopiesStoredSale(t *testing.T) {
+	ctx := context.Background()
+	storage := NewLocalStorage()
+	s := NewService(storage, zap.NewNop(), "")
+	require.NoError(t, storage.Set(ctx, &Sale{ID: "s1", Status: StatusPending, Tags: []string{"vip"}, Version: 1}))
+
+	// lo leído antes del cambio no se modifica por debajo
+	read, err := s.GetSale(ctx, "s1")
+	require.NoError(t, err)
+	_, err = s.PatchSale(ctx, "s1", SalePatch{Mask: []string{FieldStatus}, Status: StatusApproved})
+	require.NoError(t, err)
+	_, err = s.AddNote(ctx, "s1", "checked")
+	require.NoError(t, err)
+	require.Equal(t, StatusPending, read.Status)
+	require.Equal(t, 1, read.Version)
+	require.Empty(t, read.OperatorNotes)
+
+	// los errores de la storage que no son de venta inexistente se mantienen
+	errRead := errors.New("storage down")
+	failing := NewService(&failingReadStorage{LocalStorage: storage, err: errRead}, zap.NewNop(), "")
+	_, err = failing.PatchSale(ctx, "s1", SalePatch{Mask: []string{FieldNotes}, Notes: "x"})
+	require.ErrorIs(t, err, errRead)
+	_, err = s.PatchSale(ctx, "missing", SalePatch{Mask: []string{FieldNotes}, Notes: "x"})
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+// failingReadStorage is a LocalStorage whose reads fail.
+type failingReadStorage struct {
+	*LocalStorage
+	err error
+}
+
+func (f *failingReadStorage) Read(ctx context.Context, id string) (*Sale, error) {
+	return nil, f.err
+}
+
+func TestService_PatchSale_StatusChangedAt(t *testing.T) {
+	ctx := context.Background()
+	created := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	clk := clock.NewManual(created.Add(time.Hour))
+	storage := NewLocalStorage()
+	s := NewService(storage, zap.NewNop(), "", WithClock(clk))
+	require.NoError(t, storage.Set(ctx, &Sale{ID: "s1", Status: StatusPending, CreatedAt: created, Version: 1}))
+
+	// las ventas guardadas sin el dato cuentan desde su creación
+	sale, err := s.PatchSale(ctx, "s1", SalePatch{Mask: []string{FieldNotes}, Notes: "called"})
+	require.NoError(t, err)
+	require.True(t, sale.StatusChangedAt.IsZero())
+	require.Equal(t, created, sale.StatusSince())
+
+	clk.Advance(time.Hour)
+	sale, err = s.PatchSale(ctx, "s1", SalePatch{Mask: []string{FieldStatus}, Status: StatusApproved})
+	require.NoError(t, err)
+	require.Equal(t, clk.Now(), sale.StatusSince())
+
+	clk.Advance(time.Hour)
+	sale, err = s.PatchSale(ctx, "s1", SalePatch{Mask: []string{FieldNotes}, Notes: "delivered"})
+	require.NoError(t, err)
+	require.Equal(t, clk.Now().Add(-time.Hour), sale.StatusSince())
+}
+
+func TestService_CreateSale_VerifiedUsersOnly(t *testing.T) {
+	users := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/users/blocked":
+			fmt.Fprint(w, `{"id":"u1","email_verified":true,"blocked":true}`)
+		default:
+			fmt.Fprintf(w, `{"id":"u1","email_verified":%t}`, r.URL.Path == "/users/verified")
+		}
+	}))
+	defer users.Close()
+	ctx := context.Background()
+
+	s := NewService(NewLocalStorage(), zap.NewNop(), users.URL, WithVerifiedUsersOnly())
+	_, err := s.CreateSale(ctx, "verified", 1000)
+	require.NoError(t, err)
+	_, err = s.CreateSale(ctx, "unverified", 1000)
+	require.ErrorIs(t, err, ErrUserNotVerified)
+	_, err = s.CreateSale(ctx, "blocked", 1000)
+	require.ErrorIs(t, err, ErrUserBlocked)
+
+	// sin la opción no se mira la verificación, pero el bloqueo sí
+	s = NewService(NewLocalStorage(), zap.NewNop(), users.URL)
+	_, err = s.CreateSale(ctx, "unverified", 1000)
+	require.NoError(t, err)
+	_, err = s.CreateSale(ctx, "blocked", 1000)
+	require.ErrorIs(t, err, ErrUserBlocked)
+}
+
+func TestService_CreateSale_RejectionBreaker(t *testing.T) {
+	userAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer userAPI.Close()
+
+	ctx := context.Background()
+	clk := clock.NewManual(time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC))
+	var trips []BreakerTrip
+	s := NewService(NewLocalStorage(), zap.NewNop(), userAPI.URL, WithClock(clk), WithRand(rand.New(rand.NewSource(42))),
+		WithRejectionBreaker(RejectionBreaker{
+			Rate:     0.5,
+			Window:   time.Minute,
+			MinSales: 4,
+			Cooldown: 10 * time.Minute,
+			OnTrip:   func(_ context.Context, trip BreakerTrip) { trips = append(trips, trip) },
+		}))
+
+	// las decisiones automáticas siguen hasta que más de la mitad son rechazos
+	for created := 0; len(trips) == 0; created++ {
+		require.Less(t, created, 1000, "breaker never opened")
+		_, err := s.CreateSale(ctx, "known", 1000)
+		require.NoError(t, err)
+	}
+	require.Greater(t, trips[0].Rate, 0.5)
+	require.GreaterOrEqual(t, trips[0].Total, 4)
+	require.Equal(t, clk.Now().Add(10*time.Minute), trips[0].Until)
+
+	for i := 0; i < 5; i++ {
+		sale, err := s.CreateSale(ctx, "known", 1000)
+		require.NoError(t, err)
+		require.Equal(t, StatusPending, sale.Status)
+	}
+	// el corte es por tenant
+	sale, err := s.CreateSale(tenant.WithID(ctx, "other"), "known", 1000)
+	require.NoError(t, err)
+	require.NotEqual(t, StatusPending, sale.Status)
+
+	clk.Advance(10 * time.Minute)
+	seen := map[SaleStatus]bool{}
+	for i := 0; i < 20; i++ {
+		sale, err := s.CreateSale(ctx, "known", 1000)
+		require.NoError(t, err)
+		seen[sale.Status] = true
+		clk.Advance(time.Minute) // cada decisión sola en su ventana no alcanza MinSales
+	}
+	require.True(t, seen[StatusApproved])
+	require.True(t, seen[StatusRejected])
+	require.Len(t, trips, 1)
+}
+
+func TestService_CreateSale_PropagatesTrace(t *testing.T) {
+	var traceparent, requestID string
+	userAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent, requestID = r.Header.Get(tracing.Header), r.Header.Get(tracing.RequestIDHeader)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer userAPI.Close()
+
+	parent := tracing.NewRoot()
+	ctx := tracing.WithRequestID(tracing.WithSpanContext(context.Background(), parent), "req-1")
+	s := NewService(NewLocalStorage(), zap.NewNop(), userAPI.URL)
+
+	_, err := s.CreateSale(ctx, "known", 1000)
+	require.NoError(t, err)
+	require.Equal(t, "req-1", requestID)
+
+	sc, ok := tracing.Parse(traceparent)
+	require.True(t, ok)
+	require.Equal(t, parent.TraceID, sc.TraceID)
+	require.NotEqual(t, parent.SpanID, sc.SpanID)
+}
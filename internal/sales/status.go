@@ -0,0 +1,66 @@
+package sales
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// SaleStatus is the approval state of a sale.
+type SaleStatus string
+
+const (
+	StatusPending  SaleStatus = "pending"
+	StatusApproved SaleStatus = "approved"
+	StatusRejected SaleStatus = "rejected"
+)
+
+// statuses lists every valid SaleStatus.
+var statuses = []SaleStatus{StatusPending, StatusApproved, StatusRejected}
+
+// Valid reports whether s is one of the known statuses.
+func (s SaleStatus) Valid() bool {
+	for _, v := range statuses {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Next returns the statuses a sale in status s can be moved to: a pending
+// sale can be approved or rejected, and decided sales are final.
+func (s SaleStatus) Next() []SaleStatus {
+	if s == StatusPending {
+		return []SaleStatus{StatusApproved, StatusRejected}
+	}
+	return nil
+}
+
+// String returns the status as a plain string.
+func (s SaleStatus) String() string {
+	return string(s)
+}
+
+// MarshalJSON encodes the status as a JSON string, rejecting unknown values.
+func (s SaleStatus) MarshalJSON() ([]byte, error) {
+	if !s.Valid() {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidStatus, string(s))
+	}
+	return json.Marshal(string(s))
+}
+
+// UnmarshalJSON decodes a JSON string into a status, returning ErrInvalidStatus for unknown values.
+func (s *SaleStatus) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	status := SaleStatus(raw)
+	if !status.Valid() {
+		return ErrInvalidStatus
+	}
+
+	*s = status
+	return nil
+}
@@ -1,69 +1,263 @@
 package sales
 
-import "errors"
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/apperrors"
+	"Ejercicio_Final-Taller_Go/internal/repo"
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+)
 
 // ErrNotFound is returned when a sale with the given ID is not found.
-var ErrNotFound = errors.New("sale not found")
+var ErrNotFound = apperrors.New(apperrors.NotFound, "sale_not_found", "sale not found")
 
 // ErrEmptyID is returned when trying to store a sale with an empty ID.
-var ErrEmptyID = errors.New("empty sale ID")
+var ErrEmptyID = apperrors.New(apperrors.Internal, "empty_sale_id", "empty sale ID")
 
 // Storage is the main interface for our sales storage layer.
+// Every operation is scoped to the tenant carried by ctx (see package tenant):
+// sales of other tenants are invisible and reported as ErrNotFound.
 type Storage interface {
-	Set(sale *Sale) error
-	Read(id string) (*Sale, error) // Aunque no se pide explícitamente ahora, puede ser útil
+	Set(ctx context.Context, sale *Sale) error
+	Read(ctx context.Context, id string) (*Sale, error) // Aunque no se pide explícitamente ahora, puede ser útil
+	GetAll(ctx context.Context) ([]*Sale, error)
+	Search(ctx context.Context, filter SalesFilter) ([]*Sale, error)
+	Aggregate(ctx context.Context, filter SalesFilter) (*SalesMetadata, error)
+	// GroupSales summarizes the sales matching filter per value of the
+	// field g, sorted by that value.
+	GroupSales(ctx context.Context, filter SalesFilter, g GroupBy) ([]SalesGroup, error)
+	// Iterate calls fn for every sale in creation order, oldest first,
+	// without loading them all in memory, until fn returns an error, which
+	// is then returned.
+	Iterate(ctx context.Context, fn func(*Sale) error) error
+	NextNumber(ctx context.Context, at time.Time) (string, error)
+	ReadByNumber(ctx context.Context, number string) (*Sale, error)
+	Dashboard(ctx context.Context, since time.Time, topUsers int) (*Dashboard, error)
+	Ping(ctx context.Context) error
+	Delete(ctx context.Context, id string) error
+	// Tenants lists the tenants holding sales; it is the only operation not
+	// scoped to the tenant of ctx, for jobs that sweep every tenant.
+	Tenants(ctx context.Context) ([]string, error)
+	// WithTx runs fn with a Storage whose writes are committed together if
+	// fn returns nil and rolled back otherwise, returning fn's error.
+	// Storages without transactions run fn on themselves.
+	WithTx(ctx context.Context, fn func(tx Storage) error) error
 	// Update(sale *Sale) error     // Podríamos necesitar esto en el futuro
-	// Delete(id string) error     // Podríamos necesitar esto en el futuro
 }
 
-// LocalStorage provides an in-memory implementation for storing sales.
+// LocalStorage provides an in-memory implementation for storing sales,
+// partitioned by tenant. It is safe for concurrent use.
 type LocalStorage struct {
-	m map[string]*Sale
+	*repo.Repository[*Sale]
+
+	mu       sync.Mutex
+	counters map[string]map[int]int // tenant -> year -> last issued sale number
+
+	// statsMu keeps the read model in step with the stored sales
+	statsMu sync.RWMutex
+	stats   map[string]*statsModel // tenant -> totals
 }
 
+// numberIndex finds sales by their sequential number.
+const numberIndex = "number"
+
 // NewLocalStorage instantiates a new LocalStorage for sales with an empty map.
 func NewLocalStorage() *LocalStorage {
 	return &LocalStorage{
-		m: map[string]*Sale{},
+		Repository: repo.New(ErrNotFound, ErrEmptyID, repo.Index[*Sale]{
+			Name: numberIndex,
+			Key:  func(s *Sale) string { return s.Number },
+		}),
+		counters: map[string]map[int]int{},
+		stats:    map[string]*statsModel{},
 	}
 }
 
-// Set stores a sale in the local storage.
-// Returns ErrEmptyID if the sale has an empty ID.
-func (l *LocalStorage) Set(sale *Sale) error {
-	if sale.ID == "" {
-		return ErrEmptyID
+// Set stores or replaces sale and updates the totals read model.
+func (l *LocalStorage) Set(ctx context.Context, sale *Sale) error {
+	l.statsMu.Lock()
+	defer l.statsMu.Unlock()
+
+	if err := l.Repository.Set(ctx, sale); err != nil {
+		return err
+	}
+	t := tenant.FromContext(ctx)
+	if l.stats[t] == nil {
+		l.stats[t] = newStatsModel()
+	}
+	l.stats[t].set(sale)
+	return nil
+}
+
+// Delete removes the sale with the given ID and its totals.
+func (l *LocalStorage) Delete(ctx context.Context, id string) error {
+	l.statsMu.Lock()
+	defer l.statsMu.Unlock()
+
+	if err := l.Repository.Delete(ctx, id); err != nil {
+		return err
+	}
+	if m := l.stats[tenant.FromContext(ctx)]; m != nil {
+		m.remove(id)
 	}
-	l.m[sale.ID] = sale
 	return nil
 }
 
-// Read retrieves a sale from the local storage by ID.
-// Returns ErrNotFound if the sale is not found.
-func (l *LocalStorage) Read(id string) (*Sale, error) {
-	s, ok := l.m[id]
-	if !ok {
-		return nil, ErrNotFound
+// WithTx runs fn on l itself: the in-memory storage has no transactions,
+// and writes made before fn fails are kept.
+func (l *LocalStorage) WithTx(ctx context.Context, fn func(tx Storage) error) error {
+	return fn(l)
+}
+
+// GetAll returns every stored sale in creation order, oldest first.
+func (l *LocalStorage) GetAll(ctx context.Context) ([]*Sale, error) {
+	sales, err := l.List(ctx)
+	if err != nil {
+		return nil, err
 	}
-	return s, nil
+	sort.Slice(sales, func(i, j int) bool {
+		return createdBefore(sales[i], sales[j])
+	})
+	return sales, nil
 }
 
-// // Update updates a sale in the local storage.
-// // Returns ErrNotFound if the sale does not exist.
-// func (l *LocalStorage) Update(sale *Sale) error {
-// 	if _, ok := l.m[sale.ID]; !ok {
-// 		return ErrNotFound
-// 	}
-// 	l.m[sale.ID] = sale
-// 	return nil
-// }
-
-// // Delete removes a sale from the local storage by ID.
-// // Returns ErrNotFound if the sale does not exist.
-// func (l *LocalStorage) Delete(id string) error {
-// 	if _, ok := l.m[id]; !ok {
-// 		return ErrNotFound
-// 	}
-// 	delete(l.m, id)
-// 	return nil
-// }
+// Iterate calls fn for every stored sale in creation order, oldest first.
+// Sales stored while iterating are not visited, and deleted ones are skipped.
+func (l *LocalStorage) Iterate(ctx context.Context, fn func(*Sale) error) error {
+	return l.IterateOrdered(ctx, createdBefore, fn)
+}
+
+// createdBefore orders sales by creation time, and by ID when created at
+// the same instant, so ULIDs keep the order in which they were issued.
+func createdBefore(a, b *Sale) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return a.ID < b.ID
+}
+
+// Search returns the stored sales matching filter, in no particular order.
+func (l *LocalStorage) Search(ctx context.Context, filter SalesFilter) ([]*Sale, error) {
+	sales := make([]*Sale, 0)
+	l.Range(ctx, func(s *Sale) {
+		if filter.Matches(s) {
+			sales = append(sales, s)
+		}
+	})
+	return sales, nil
+}
+
+// Aggregate summarizes the stored sales matching filter. Filters on user
+// and status alone are answered from the read model without a scan; any
+// other is computed in a single pass.
+func (l *LocalStorage) Aggregate(ctx context.Context, filter SalesFilter) (*SalesMetadata, error) {
+	if filter.byUserAndStatus() {
+		l.statsMu.RLock()
+		defer l.statsMu.RUnlock()
+
+		if m := l.stats[tenant.FromContext(ctx)]; m != nil {
+			return m.metadata(filter.UserID, filter.Status), nil
+		}
+		return &SalesMetadata{}, nil
+	}
+
+	metadata := &SalesMetadata{}
+	l.Range(ctx, func(s *Sale) {
+		if filter.Matches(s) {
+			metadata.Add(s)
+		}
+	})
+	return metadata, nil
+}
+
+// GroupSales summarizes, in a single pass, the stored sales matching filter
+// per value of the field g.
+func (l *LocalStorage) GroupSales(ctx context.Context, filter SalesFilter, g GroupBy) ([]SalesGroup, error) {
+	groups := salesGroups{}
+	l.Range(ctx, func(s *Sale) {
+		if filter.Matches(s) {
+			groups.add(s, g)
+		}
+	})
+	return groups.sorted(), nil
+}
+
+// NextNumber issues the next sequential sale number for the year of at,
+// formatted as YYYY-NNNNNN. Numbers restart at 1 every year and are
+// independent per tenant.
+func (l *LocalStorage) NextNumber(ctx context.Context, at time.Time) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	t := tenant.FromContext(ctx)
+	if l.counters[t] == nil {
+		l.counters[t] = map[int]int{}
+	}
+	year := at.Year()
+	l.counters[t][year]++
+	return fmt.Sprintf("%d-%06d", year, l.counters[t][year]), nil
+}
+
+// ReadByNumber retrieves a sale by its sequential number.
+// Returns ErrNotFound if no sale has that number.
+func (l *LocalStorage) ReadByNumber(ctx context.Context, number string) (*Sale, error) {
+	return l.ReadBy(ctx, numberIndex, number)
+}
+
+// Dashboard aggregates, in a single pass, the sales created since the given
+// instant: their count, approved revenue, rejection rate over decided sales
+// and the topUsers users by amount. PendingApprovals counts every pending
+// sale regardless of age, since those are still waiting for review.
+func (l *LocalStorage) Dashboard(ctx context.Context, since time.Time, topUsers int) (*Dashboard, error) {
+	d := &Dashboard{Since: since, TopUsers: []UserTotal{}}
+	var approved, rejected int
+	totals := map[string]*UserTotal{}
+	l.Range(ctx, func(s *Sale) {
+		if s.Status == StatusPending {
+			d.PendingApprovals++
+		}
+		if s.CreatedAt.Before(since) {
+			return
+		}
+
+		d.SalesCount++
+		switch s.Status {
+		case StatusApproved:
+			approved++
+			d.Revenue += s.Amount
+		case StatusRejected:
+			rejected++
+		}
+
+		t, ok := totals[s.UserID]
+		if !ok {
+			t = &UserTotal{UserID: s.UserID}
+			totals[s.UserID] = t
+		}
+		t.Quantity++
+		t.TotalAmount += s.Amount
+	})
+
+	if decided := approved + rejected; decided > 0 {
+		d.RejectionRate = float64(rejected) / float64(decided)
+	}
+
+	for _, t := range totals {
+		d.TopUsers = append(d.TopUsers, *t)
+	}
+	sort.Slice(d.TopUsers, func(i, j int) bool {
+		if d.TopUsers[i].TotalAmount != d.TopUsers[j].TotalAmount {
+			return d.TopUsers[i].TotalAmount > d.TopUsers[j].TotalAmount
+		}
+		return d.TopUsers[i].UserID < d.TopUsers[j].UserID
+	})
+	if len(d.TopUsers) > topUsers {
+		d.TopUsers = d.TopUsers[:topUsers]
+	}
+
+	return d, nil
+}
@@ -0,0 +1,81 @@
+package sales
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"net"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/discovery"
+	"Ejercicio_Final-Taller_Go/internal/metrics"
+)
+
+// The outcomes of a call to the user API, as counted by UserAPIMetrics.
+const (
+	UserAPISuccess     = "success"
+	UserAPINotFound    = "not_found"
+	UserAPIServerError = "server_error" // 5xx
+	UserAPITimeout     = "timeout"
+	// UserAPIUnavailable counts the calls refused without being sent
+	// because no instance of the user API was available.
+	UserAPIUnavailable = "unavailable"
+	UserAPIError       = "error" // cualquier otra falla
+)
+
+// UserAPIMetrics counts the user lookups made to validate sales by outcome
+// and times the ones that were sent. It implements expvar.Var, to be
+// published with metrics.Publish.
+type UserAPIMetrics struct {
+	calls   expvar.Map
+	latency *metrics.Histogram
+}
+
+// NewUserAPIMetrics returns metrics with no calls counted.
+func NewUserAPIMetrics() *UserAPIMetrics {
+	return &UserAPIMetrics{latency: metrics.NewHistogram()}
+}
+
+// Calls returns how many calls had outcome.
+func (m *UserAPIMetrics) Calls(outcome string) int64 {
+	if v, ok := m.calls.Get(outcome).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+// String renders the metrics as JSON, implementing expvar.Var.
+func (m *UserAPIMetrics) String() string {
+	return fmt.Sprintf(`{"calls": %s, "latency_ms": %s}`, m.calls.String(), m.latency.String())
+}
+
+// observe counts a call that ended with outcome, after latency if it was sent.
+func (m *UserAPIMetrics) observe(outcome string, latency time.Duration, sent bool) {
+	m.calls.Add(outcome, 1)
+	if sent {
+		m.latency.Observe(latency)
+	}
+}
+
+// WithUserAPIMetrics counts the calls to the user API on m. By default
+// they are counted on metrics nobody reads.
+func WithUserAPIMetrics(m *UserAPIMetrics) Option {
+	return func(s *Service) {
+		s.userAPIMetrics = m
+	}
+}
+
+// userAPIFailure classifies err, the failure of a call, as UserAPITimeout,
+// UserAPIUnavailable or UserAPIError.
+func userAPIFailure(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return UserAPITimeout
+	case errors.Is(err, discovery.ErrNoEndpoints):
+		return UserAPIUnavailable
+	default:
+		return UserAPIError
+	}
+}
@@ -0,0 +1,52 @@
+package sales
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/discovery"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestService_UserAPIMetrics(t *testing.T) {
+	userAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/users/known":
+			w.WriteHeader(http.StatusOK)
+		case "/users/broken":
+			w.WriteHeader(http.StatusBadGateway)
+		case "/users/slow":
+			time.Sleep(50 * time.Millisecond)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer userAPI.Close()
+
+	ctx := context.Background()
+	m := NewUserAPIMetrics()
+	s := NewService(NewLocalStorage(), zap.NewNop(), userAPI.URL, WithUserAPIMetrics(m), WithUserAPIBudget(10*time.Millisecond))
+
+	for _, userID := range []string{"known", "known", "unknown", "broken", "slow"} {
+		_, _ = s.CreateSale(ctx, userID, 1000)
+	}
+	require.Equal(t, int64(2), m.Calls(UserAPISuccess))
+	require.Equal(t, int64(1), m.Calls(UserAPINotFound))
+	require.Equal(t, int64(1), m.Calls(UserAPIServerError))
+	require.Equal(t, int64(1), m.Calls(UserAPITimeout))
+	require.Equal(t, int64(5), m.latency.Count())
+
+	// sin instancias la llamada no se hace, ni se mide
+	s = NewService(NewLocalStorage(), zap.NewNop(), "", WithUserAPIMetrics(m),
+		WithUserAPIEndpoints(discovery.NewBalancer(nil, zap.NewNop())))
+	_, err := s.CreateSale(ctx, "known", 1000)
+	require.Error(t, err)
+	require.Equal(t, int64(1), m.Calls(UserAPIUnavailable))
+	require.Equal(t, int64(5), m.latency.Count())
+	require.Contains(t, m.String(), `"unavailable": 1`)
+}
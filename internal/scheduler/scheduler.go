@@ -0,0 +1,275 @@
+// Package scheduler runs the recurring background jobs of the API
+// (retention, exports...) and keeps a history of their runs.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/clock"
+
+	"go.uber.org/zap"
+)
+
+// Schedule tells when a job runs next.
+type Schedule interface {
+	// Next returns the first run instant after t.
+	Next(t time.Time) time.Time
+	String() string
+}
+
+type every time.Duration
+
+// Every returns a Schedule running a job each interval.
+func Every(interval time.Duration) Schedule {
+	return every(interval)
+}
+
+func (e every) Next(t time.Time) time.Time { return t.Add(time.Duration(e)) }
+
+func (e every) String() string { return "every " + time.Duration(e).String() }
+
+type daily time.Duration
+
+// Daily returns a Schedule running a job once a day, at the given time
+// after midnight in the time zone of the instants it is given.
+func Daily(at time.Duration) Schedule {
+	return daily(at)
+}
+
+func (d daily) Next(t time.Time) time.Time {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	next := midnight.Add(time.Duration(d))
+	if !next.After(t) {
+		next = midnight.AddDate(0, 0, 1).Add(time.Duration(d))
+	}
+	return next
+}
+
+func (d daily) String() string {
+	at := time.Duration(d)
+	return fmt.Sprintf("daily at %02d:%02d", int(at.Hours()), int(at.Minutes())%60)
+}
+
+// Job is a recurring task.
+type Job struct {
+	Name     string
+	Schedule Schedule
+	// Jitter delays each run by a random amount up to Jitter, so instances
+	// sharing a schedule do not all hit their dependencies at once.
+	Jitter time.Duration
+	Run    func(ctx context.Context) error
+}
+
+// Run is the outcome of one execution of a job.
+type Run struct {
+	StartedAt  time.Time `json:"started_at"`
+	DurationMS int64     `json:"duration_ms"`
+	Status     string    `json:"status"` // "succeeded" or "failed"
+	Error      string    `json:"error,omitempty"`
+}
+
+// JobStatus describes a job together with its recent runs, newest first.
+type JobStatus struct {
+	Name      string     `json:"name"`
+	Schedule  string     `json:"schedule"`
+	NextRunAt *time.Time `json:"next_run_at"`
+	LastRun   *Run       `json:"last_run"`
+	History   []Run      `json:"history"`
+}
+
+// Scheduler runs jobs on their schedules. A job never overlaps with itself:
+// a run that outlasts its interval delays the next one.
+type Scheduler struct {
+	logger  *zap.Logger
+	clock   clock.Clock
+	history int
+	leader  func() bool
+
+	randMu sync.Mutex
+	rand   *rand.Rand
+
+	mu   sync.Mutex
+	jobs []*job
+}
+
+// job is a Job together with its state.
+type job struct {
+	Job
+	running sync.Mutex // held while the job runs
+	next    time.Time
+	history []Run // newest first
+}
+
+// Option configures optional dependencies of a Scheduler.
+type Option func(*Scheduler)
+
+// WithClock sets the clock schedules are computed from. Defaults to the system clock.
+func WithClock(c clock.Clock) Option {
+	return func(s *Scheduler) {
+		s.clock = c
+	}
+}
+
+// WithHistory sets how many runs are kept per job. Defaults to 20.
+func WithHistory(n int) Option {
+	return func(s *Scheduler) {
+		s.history = n
+	}
+}
+
+// WithLeader makes scheduled runs happen only while isLeader reports true,
+// so that of several instances only the elected one runs the jobs (see
+// package leader). The other instances keep computing the next run times.
+func WithLeader(isLeader func() bool) Option {
+	return func(s *Scheduler) {
+		s.leader = isLeader
+	}
+}
+
+// New creates a Scheduler with no jobs.
+func New(logger *zap.Logger, opts ...Option) *Scheduler {
+	s := &Scheduler{
+		logger:  logger,
+		clock:   clock.System(),
+		history: 20,
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Add registers j. Jobs must be added before Start.
+func (s *Scheduler) Add(j Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs = append(s.jobs, &job{Job: j})
+}
+
+// Start runs every job on its schedule in the background until ctx is done.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, j := range s.jobs {
+		j.next = s.nextRun(j, s.clock.Now())
+		go s.loop(ctx, j)
+	}
+}
+
+// nextRun returns when j runs after t, jitter included.
+func (s *Scheduler) nextRun(j *job, t time.Time) time.Time {
+	next := j.Schedule.Next(t)
+	if j.Jitter > 0 {
+		s.randMu.Lock()
+		next = next.Add(time.Duration(s.rand.Int63n(int64(j.Jitter))))
+		s.randMu.Unlock()
+	}
+	return next
+}
+
+func (s *Scheduler) loop(ctx context.Context, j *job) {
+	for {
+		s.mu.Lock()
+		next := j.next
+		s.mu.Unlock()
+
+		timer := time.NewTimer(next.Sub(s.clock.Now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			if s.leader != nil && !s.leader() {
+				s.mu.Lock()
+				j.next = s.nextRun(j, s.clock.Now())
+				s.mu.Unlock()
+				continue
+			}
+			s.RunNow(ctx, j.Name)
+		}
+	}
+}
+
+// RunNow runs the job called name once, out of schedule, records the run
+// and schedules the following one. It returns the run error, or an error
+// when there is no such job.
+func (s *Scheduler) RunNow(ctx context.Context, name string) error {
+	j := s.job(name)
+	if j == nil {
+		return fmt.Errorf("unknown job %q", name)
+	}
+
+	j.running.Lock()
+	defer j.running.Unlock()
+
+	started := s.clock.Now()
+	err := j.Run(ctx)
+	run := Run{StartedAt: started, DurationMS: s.clock.Now().Sub(started).Milliseconds(), Status: "succeeded"}
+	if err != nil {
+		run.Status = "failed"
+		run.Error = err.Error()
+		s.logger.Warn("job failed", zap.String("job", name), zap.Error(err))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j.history = append([]Run{run}, j.history...)
+	if len(j.history) > s.history {
+		j.history = j.history[:s.history]
+	}
+	j.next = s.nextRun(j, s.clock.Now())
+	return err
+}
+
+func (s *Scheduler) job(name string) *job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, j := range s.jobs {
+		if j.Name == name {
+			return j
+		}
+	}
+	return nil
+}
+
+// Leader reports whether this instance runs the scheduled jobs.
+func (s *Scheduler) Leader() bool {
+	return s.leader == nil || s.leader()
+}
+
+// Jobs returns the status of every job, sorted by name.
+func (s *Scheduler) Jobs() []JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]JobStatus, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		st := JobStatus{
+			Name:     j.Name,
+			Schedule: j.Schedule.String(),
+			History:  append([]Run{}, j.history...),
+		}
+		if !j.next.IsZero() {
+			next := j.next
+			st.NextRunAt = &next
+		}
+		if len(j.history) > 0 {
+			last := j.history[0]
+			st.LastRun = &last
+		}
+		statuses = append(statuses, st)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
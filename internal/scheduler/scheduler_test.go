@@ -0,0 +1,89 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/clock"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestDaily(t *testing.T) {
+	d := Daily(2*time.Hour + 30*time.Minute)
+	require.Equal(t, "daily at 02:30", d.String())
+	require.Equal(t, time.Date(2024, 3, 10, 2, 30, 0, 0, time.UTC), d.Next(time.Date(2024, 3, 10, 1, 0, 0, 0, time.UTC)))
+	require.Equal(t, time.Date(2024, 3, 11, 2, 30, 0, 0, time.UTC), d.Next(time.Date(2024, 3, 10, 2, 30, 0, 0, time.UTC)))
+}
+
+func TestScheduler_RunNow(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	s := New(zap.NewNop(), WithClock(clock.NewManual(now)), WithHistory(2))
+
+	fail := true
+	s.Add(Job{Name: "retention", Schedule: Every(time.Hour), Run: func(context.Context) error {
+		if fail {
+			return errors.New("archive unavailable")
+		}
+		return nil
+	}})
+	s.Add(Job{Name: "export", Schedule: Daily(2 * time.Hour), Run: func(context.Context) error { return nil }})
+
+	require.Error(t, s.RunNow(context.Background(), "retention"))
+	fail = false
+	require.NoError(t, s.RunNow(context.Background(), "retention"))
+	require.NoError(t, s.RunNow(context.Background(), "retention"))
+	require.Error(t, s.RunNow(context.Background(), "unknown"))
+
+	jobs := s.Jobs()
+	require.Len(t, jobs, 2)
+	require.Equal(t, "export", jobs[0].Name)
+	require.Nil(t, jobs[0].LastRun)
+
+	retention := jobs[1]
+	require.Equal(t, "every 1h0m0s", retention.Schedule)
+	require.Equal(t, now.Add(time.Hour), *retention.NextRunAt)
+	require.Equal(t, "succeeded", retention.LastRun.Status)
+	require.Len(t, retention.History, 2)
+}
+
+func TestScheduler_Start(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var runs atomic.Int32
+	s := New(zap.NewNop())
+	s.Add(Job{Name: "tick", Schedule: Every(5 * time.Millisecond), Jitter: time.Millisecond, Run: func(context.Context) error {
+		runs.Add(1)
+		return nil
+	}})
+	s.Start(ctx)
+
+	require.Eventually(t, func() bool { return runs.Load() >= 3 }, time.Second, time.Millisecond)
+	require.Equal(t, "succeeded", s.Jobs()[0].LastRun.Status)
+}
+
+func TestScheduler_FollowerSkipsRuns(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var leader atomic.Bool
+	var runs atomic.Int32
+	s := New(zap.NewNop(), WithLeader(leader.Load))
+	s.Add(Job{Name: "tick", Schedule: Every(5 * time.Millisecond), Run: func(context.Context) error {
+		runs.Add(1)
+		return nil
+	}})
+	s.Start(ctx)
+
+	time.Sleep(30 * time.Millisecond)
+	require.False(t, s.Leader())
+	require.Zero(t, runs.Load())
+
+	leader.Store(true)
+	require.Eventually(t, func() bool { return runs.Load() > 0 }, time.Second, time.Millisecond)
+}
@@ -0,0 +1,139 @@
+// Package secrets reads sensitive settings from a secret manager instead of
+// plain environment variables.
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"Ejercicio_Final-Taller_Go/internal/awsauth"
+)
+
+// ErrNotFound is returned when the provider holds no secret with the given name.
+var ErrNotFound = errors.New("secret not found")
+
+// Provider returns secrets by name. Names are those of the environment
+// variables the secrets replace, e.g. "SMTP_PASSWORD".
+type Provider interface {
+	Get(ctx context.Context, name string) (string, error)
+}
+
+// envProvider reads secrets from environment variables.
+type envProvider struct{}
+
+// Env returns a Provider backed by the environment.
+func Env() Provider {
+	return envProvider{}
+}
+
+func (envProvider) Get(_ context.Context, name string) (string, error) {
+	v, ok := os.LookupEnv(name)
+	if !ok || v == "" {
+		return "", ErrNotFound
+	}
+	return v, nil
+}
+
+// bundle is a Provider whose secrets are all stored as the fields of a
+// single document, fetched once and then served from memory.
+type bundle struct {
+	fetch func(ctx context.Context) (map[string]string, error)
+
+	once    sync.Once
+	secrets map[string]string
+	err     error
+}
+
+func (b *bundle) Get(ctx context.Context, name string) (string, error) {
+	b.once.Do(func() {
+		b.secrets, b.err = b.fetch(ctx)
+	})
+	if b.err != nil {
+		return "", b.err
+	}
+
+	v, ok := b.secrets[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return v, nil
+}
+
+// Vault returns a Provider reading the KV version 2 secret at path, under
+// the secrets engine mounted at mount, from the Vault server at addr. Every
+// field of the secret is one setting. A nil httpClient uses http.DefaultClient.
+func Vault(addr, token, mount, path string, httpClient *http.Client) Provider {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	url := fmt.Sprintf("%s/v1/%s/data/%s", strings.TrimSuffix(addr, "/"), strings.Trim(mount, "/"), strings.Trim(path, "/"))
+
+	return &bundle{fetch: func(ctx context.Context) (map[string]string, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error building request to Vault: %w", err)
+		}
+		req.Header.Set("X-Vault-Token", token)
+
+		var body struct {
+			Data struct {
+				Data map[string]string `json:"data"`
+			} `json:"data"`
+		}
+		if err := doJSON(httpClient, req, "Vault", &body); err != nil {
+			return nil, err
+		}
+		return body.Data.Data, nil
+	}}
+}
+
+// AWSSecretsManager returns a Provider reading the secret secretID from AWS
+// Secrets Manager in region. The secret must hold a JSON object whose
+// fields are the settings. A nil httpClient uses http.DefaultClient.
+func AWSSecretsManager(region, secretID string, creds awsauth.Credentials, httpClient *http.Client) Provider {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &bundle{fetch: func(ctx context.Context) (map[string]string, error) {
+		var body struct {
+			SecretString string `json:"SecretString"`
+		}
+		in := map[string]string{"SecretId": secretID}
+		if err := awsauth.CallJSON(ctx, httpClient, creds, region, "secretsmanager", "secretsmanager.GetSecretValue", in, &body); err != nil {
+			return nil, err
+		}
+
+		secrets := map[string]string{}
+		if err := json.Unmarshal([]byte(body.SecretString), &secrets); err != nil {
+			return nil, fmt.Errorf("secret %s is not a JSON object of strings: %w", secretID, err)
+		}
+		return secrets, nil
+	}}
+}
+
+// doJSON sends req and decodes a 200 JSON answer into v.
+func doJSON(c *http.Client, req *http.Request, service string, v any) error {
+	resp, err := c.Do(req)
+	if err != nil {
+		return fmt.Errorf("error making request to %s: %w", service, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned unexpected status %d: %s", service, resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("error decoding %s response: %w", service, err)
+	}
+	return nil
+}
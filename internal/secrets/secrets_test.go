@@ -0,0 +1,32 @@
+package secrets
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVault(t *testing.T) {
+	calls := 0
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		require.Equal(t, "/v1/secret/data/sales-api", r.URL.Path)
+		require.Equal(t, "s.token", r.Header.Get("X-Vault-Token"))
+		w.Write([]byte(`{"data": {"data": {"SMTP_PASSWORD": "hunter2"}, "metadata": {"version": 3}}}`))
+	}))
+	defer vault.Close()
+
+	ctx := context.Background()
+	p := Vault(vault.URL, "s.token", "secret", "sales-api", nil)
+
+	v, err := p.Get(ctx, "SMTP_PASSWORD")
+	require.NoError(t, err)
+	require.Equal(t, "hunter2", v)
+
+	_, err = p.Get(ctx, "SENTRY_DSN")
+	require.ErrorIs(t, err, ErrNotFound)
+	require.Equal(t, 1, calls)
+}
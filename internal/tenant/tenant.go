@@ -0,0 +1,44 @@
+package tenant
+
+import (
+	"context"
+	"regexp"
+
+	"Ejercicio_Final-Taller_Go/internal/apperrors"
+)
+
+// Header is the HTTP header clients use to select their tenant. It is also
+// forwarded on calls to the user API.
+const Header = "X-Tenant-ID"
+
+// Default is the tenant used when a request does not name one, so
+// single-merchant deployments keep working without sending any header.
+const Default = "default"
+
+// ErrInvalidID is returned for tenant IDs that are not valid identifiers.
+var ErrInvalidID = apperrors.New(apperrors.Validation, "invalid_tenant_id", "invalid tenant ID")
+
+var validID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+type ctxKey struct{}
+
+// Validate returns ErrInvalidID unless id is 1 to 64 letters, digits, '-' or '_'.
+func Validate(id string) error {
+	if !validID.MatchString(id) {
+		return ErrInvalidID
+	}
+	return nil
+}
+
+// WithID returns a copy of ctx scoped to the given tenant.
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext returns the tenant ctx is scoped to, or Default.
+func FromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(ctxKey{}).(string); ok && id != "" {
+		return id
+	}
+	return Default
+}
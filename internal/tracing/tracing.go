@@ -0,0 +1,160 @@
+// Package tracing propagates W3C Trace Context and request IDs across the
+// calls to other services, and records the spans of those calls as log
+// entries, so the APM tool can stitch a request together with the work it
+// caused downstream.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Header is the W3C Trace Context header propagating the caller's span.
+const Header = "traceparent"
+
+// RequestIDHeader carries the ID of the request that caused a call.
+const RequestIDHeader = "X-Request-ID"
+
+// SpanContext identifies a span within its trace, in lowercase hex.
+type SpanContext struct {
+	TraceID string
+	SpanID  string
+	Sampled bool
+}
+
+// Parse reads a traceparent header of version 00, reporting whether it is valid.
+func Parse(header string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) != 4 || parts[0] != "00" || !isHex(parts[1], 32) || !isHex(parts[2], 16) || !isHex(parts[3], 2) {
+		return SpanContext{}, false
+	}
+	// los IDs en cero son inválidos según la especificación
+	if strings.Trim(parts[1], "0") == "" || strings.Trim(parts[2], "0") == "" {
+		return SpanContext{}, false
+	}
+	flags, _ := hex.DecodeString(parts[3])
+	return SpanContext{TraceID: parts[1], SpanID: parts[2], Sampled: flags[0]&1 == 1}, true
+}
+
+// isHex reports whether s is n lowercase hex digits.
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// Traceparent returns the traceparent header of sc.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID + "-" + sc.SpanID + "-" + flags
+}
+
+// NewRoot returns the context of the root span of a new, sampled trace.
+func NewRoot() SpanContext {
+	return SpanContext{TraceID: randomHex(16), SpanID: randomHex(8), Sampled: true}
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+type spanKey struct{}
+
+type requestIDKey struct{}
+
+// WithSpanContext returns a copy of ctx within the span sc.
+func WithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanKey{}, sc)
+}
+
+// FromContext returns the span ctx is within, if any.
+func FromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(spanKey{}).(SpanContext)
+	return sc, ok
+}
+
+// WithRequestID returns a copy of ctx carrying the ID of its request.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the ID of the request of ctx, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Inject sets on h the headers that propagate ctx to a downstream call:
+// its span as traceparent, and its request ID.
+func Inject(ctx context.Context, h interface{ Set(key, value string) }) {
+	if sc, ok := FromContext(ctx); ok {
+		h.Set(Header, sc.Traceparent())
+	}
+	if id := RequestID(ctx); id != "" {
+		h.Set(RequestIDHeader, id)
+	}
+}
+
+// Span is an operation being timed, usually a call to another service.
+type Span struct {
+	name    string
+	context SpanContext
+	parent  string
+	start   time.Time
+	attrs   []zap.Field
+}
+
+// Start starts the span name as a child of the span of ctx, or as the root
+// of a new trace, and returns ctx within it.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	s := &Span{name: name, start: time.Now()}
+	if parent, ok := FromContext(ctx); ok {
+		s.context = SpanContext{TraceID: parent.TraceID, SpanID: randomHex(8), Sampled: parent.Sampled}
+		s.parent = parent.SpanID
+	} else {
+		s.context = NewRoot()
+	}
+	return WithSpanContext(ctx, s.context), s
+}
+
+// Context returns the context of s.
+func (s *Span) Context() SpanContext {
+	return s.context
+}
+
+// SetAttributes adds attributes to s, logged when it ends.
+func (s *Span) SetAttributes(attrs ...zap.Field) {
+	s.attrs = append(s.attrs, attrs...)
+}
+
+// End finishes s and, if its trace is sampled, logs it with its attributes.
+func (s *Span) End(logger *zap.Logger) {
+	if !s.context.Sampled {
+		return
+	}
+	fields := append([]zap.Field{
+		zap.String("span", s.name),
+		zap.String("trace_id", s.context.TraceID),
+		zap.String("span_id", s.context.SpanID),
+		zap.String("parent_span_id", s.parent),
+		zap.Time("start", s.start),
+		zap.Int64("duration_ms", time.Since(s.start).Milliseconds()),
+	}, s.attrs...)
+	logger.Info("span", fields...)
+}
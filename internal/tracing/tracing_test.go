@@ -0,0 +1,45 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	sc, ok := Parse("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.True(t, ok)
+	require.Equal(t, SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Sampled: true}, sc)
+	require.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", sc.Traceparent())
+
+	for _, header := range []string{
+		"",
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+	} {
+		_, ok := Parse(header)
+		require.False(t, ok, header)
+	}
+}
+
+func TestStart(t *testing.T) {
+	_, root := Start(context.Background(), "root")
+	_, ok := Parse(root.Context().Traceparent())
+	require.True(t, ok)
+
+	parent := SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7"}
+	ctx, span := Start(WithRequestID(WithSpanContext(context.Background(), parent), "req-1"), "child")
+	require.Equal(t, parent.TraceID, span.Context().TraceID)
+	require.NotEqual(t, parent.SpanID, span.Context().SpanID)
+	require.False(t, span.Context().Sampled)
+
+	h := http.Header{}
+	Inject(ctx, h)
+	require.Equal(t, span.Context().Traceparent(), h.Get(Header))
+	require.Equal(t, "req-1", h.Get(RequestIDHeader))
+}
@@ -0,0 +1,140 @@
+package user
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"Ejercicio_Final-Taller_Go/internal/apperrors"
+)
+
+// ErrInvalidAddress is returned for an address with a field longer than
+// maxAddressField.
+var ErrInvalidAddress = apperrors.New(apperrors.Validation, "invalid_address", "invalid address")
+
+// ErrInvalidCountry is returned for an address whose country is not one of
+// the supported ISO 3166-1 alpha-2 codes (see countries).
+var ErrInvalidCountry = apperrors.New(apperrors.Validation, "invalid_country", "unsupported country")
+
+// ErrInvalidPostalCode is returned for a postal code that does not follow
+// the format of the country of the address.
+var ErrInvalidPostalCode = apperrors.New(apperrors.Validation, "invalid_postal_code", "invalid postal code for the country")
+
+// maxAddressField is the longest, in characters, each field of an Address may be.
+const maxAddressField = 200
+
+// Address is the postal address of a user. Country is an ISO 3166-1
+// alpha-2 code, which is what formatting and taxes depend on.
+//
+// Users stored when the address was a single line decode with that line
+// as Street and the rest empty.
+type Address struct {
+	Street     string `json:"street,omitempty" xml:"street,omitempty"`
+	City       string `json:"city,omitempty" xml:"city,omitempty"`
+	Province   string `json:"province,omitempty" xml:"province,omitempty"`
+	PostalCode string `json:"postal_code,omitempty" xml:"postal_code,omitempty"`
+	Country    string `json:"country,omitempty" xml:"country,omitempty"`
+}
+
+// country is how addresses of a supported country are checked and written.
+type country struct {
+	name   string
+	postal *regexp.Regexp
+	// postalLast writes the postal code after the province, as in the US,
+	// instead of before the city.
+	postalLast bool
+}
+
+// countries are the supported countries by ISO code.
+var countries = map[string]country{
+	"AR": {name: "Argentina", postal: regexp.MustCompile(`^([A-Z]\d{4}[A-Z]{3}|\d{4})$`)},
+	"BR": {name: "Brasil", postal: regexp.MustCompile(`^\d{5}-?\d{3}$`), postalLast: true},
+	"CL": {name: "Chile", postal: regexp.MustCompile(`^\d{7}$`)},
+	"ES": {name: "España", postal: regexp.MustCompile(`^\d{5}$`)},
+	"MX": {name: "México", postal: regexp.MustCompile(`^\d{5}$`)},
+	"US": {name: "United States", postal: regexp.MustCompile(`^\d{5}(-\d{4})?$`), postalLast: true},
+	"UY": {name: "Uruguay", postal: regexp.MustCompile(`^\d{5}$`)},
+}
+
+// UnmarshalJSON decodes an address object or, for data written before
+// addresses were structured, a plain string taken as the street.
+func (a *Address) UnmarshalJSON(data []byte) error {
+	var line string
+	if err := json.Unmarshal(data, &line); err == nil {
+		*a = Address{Street: line}
+		return nil
+	}
+
+	type plain Address // sin UnmarshalJSON, para no recursar
+	return json.Unmarshal(data, (*plain)(a))
+}
+
+// IsZero reports whether every field of a is empty.
+func (a Address) IsZero() bool {
+	return a == Address{}
+}
+
+// normalized returns a with its fields trimmed and its country and postal
+// code upper-cased.
+func (a Address) normalized() Address {
+	return Address{
+		Street:     strings.TrimSpace(a.Street),
+		City:       strings.TrimSpace(a.City),
+		Province:   strings.TrimSpace(a.Province),
+		PostalCode: strings.ToUpper(strings.TrimSpace(a.PostalCode)),
+		Country:    strings.ToUpper(strings.TrimSpace(a.Country)),
+	}
+}
+
+// Validate checks that a can be formatted and taxed: no field is longer
+// than maxAddressField, the country, if any, is supported and the postal
+// code follows its format. Every field is optional.
+func (a Address) Validate() error {
+	for _, f := range []string{a.Street, a.City, a.Province, a.PostalCode, a.Country} {
+		if utf8.RuneCountInString(f) > maxAddressField {
+			return fmt.Errorf("%w: fields are at most %d characters", ErrInvalidAddress, maxAddressField)
+		}
+	}
+	if a.Country == "" {
+		return nil
+	}
+
+	c, ok := countries[a.Country]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrInvalidCountry, a.Country)
+	}
+	if a.PostalCode != "" && !c.postal.MatchString(a.PostalCode) {
+		return fmt.Errorf("%w: %q in %s", ErrInvalidPostalCode, a.PostalCode, a.Country)
+	}
+	return nil
+}
+
+// String formats a on one line as is usual in its country, e.g.
+// "Av. Corrientes 1234, C1043AAZ CABA, Buenos Aires, Argentina" or
+// "1 Main St, Springfield, IL 62701, United States". Empty fields are
+// left out.
+func (a Address) String() string {
+	c, ok := countries[a.Country]
+	name := c.name
+	if !ok {
+		name = a.Country
+	}
+
+	if c.postalLast {
+		return joinNonEmpty(", ", a.Street, a.City, joinNonEmpty(" ", a.Province, a.PostalCode), name)
+	}
+	return joinNonEmpty(", ", a.Street, joinNonEmpty(" ", a.PostalCode, a.City), a.Province, name)
+}
+
+// joinNonEmpty joins the non-empty parts with sep.
+func joinNonEmpty(sep string, parts ...string) string {
+	var kept []string
+	for _, p := range parts {
+		if p != "" {
+			kept = append(kept, p)
+		}
+	}
+	return strings.Join(kept, sep)
+}
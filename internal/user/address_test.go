@@ -0,0 +1,69 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddress_UnmarshalLegacy(t *testing.T) {
+	var u User
+	require.NoError(t, json.Unmarshal([]byte(`{"name":"Ayrton","address":"Calle Falsa 123"}`), &u))
+	require.Equal(t, Address{Street: "Calle Falsa 123"}, u.Address)
+
+	require.NoError(t, json.Unmarshal([]byte(`{"address":{"street":"Calle Falsa 123","postal_code":"1900","country":"AR"}}`), &u))
+	require.Equal(t, Address{Street: "Calle Falsa 123", PostalCode: "1900", Country: "AR"}, u.Address)
+}
+
+func TestAddress_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		address Address
+		err     error
+	}{
+		{name: "empty", address: Address{}},
+		{name: "legacy street only", address: Address{Street: "Calle Falsa 123"}},
+		{name: "argentine CPA", address: Address{Street: "Av. Corrientes 1234", PostalCode: "C1043AAZ", Country: "AR"}},
+		{name: "argentine 4 digits", address: Address{PostalCode: "1900", Country: "AR"}},
+		{name: "us zip+4", address: Address{PostalCode: "62701-1234", Country: "US"}},
+		{name: "postal code without country", address: Address{PostalCode: "anything"}},
+		{name: "unsupported country", address: Address{Country: "ZZ"}, err: ErrInvalidCountry},
+		{name: "bad postal code", address: Address{PostalCode: "1900", Country: "US"}, err: ErrInvalidPostalCode},
+		{name: "too long", address: Address{City: strings.Repeat("a", maxAddressField+1)}, err: ErrInvalidAddress},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.address.Validate()
+			if tt.err == nil {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestAddress_String(t *testing.T) {
+	ar := Address{Street: "Av. Corrientes 1234", City: "CABA", Province: "Buenos Aires", PostalCode: "C1043AAZ", Country: "AR"}
+	require.Equal(t, "Av. Corrientes 1234, C1043AAZ CABA, Buenos Aires, Argentina", ar.String())
+
+	us := Address{Street: "1 Main St", City: "Springfield", Province: "IL", PostalCode: "62701", Country: "US"}
+	require.Equal(t, "1 Main St, Springfield, IL 62701, United States", us.String())
+
+	require.Equal(t, "Calle Falsa 123", Address{Street: "Calle Falsa 123"}.String())
+	require.Equal(t, "Lyon, FR", Address{City: "Lyon", Country: "FR"}.String())
+}
+
+func TestService_CreateNormalizesAddress(t *testing.T) {
+	s := NewService(NewLocalStorage(), nil)
+
+	u := &User{Name: "Ayrton", Address: Address{Street: " Calle Falsa 123 ", PostalCode: "c1043aaz", Country: "ar"}}
+	require.NoError(t, s.Create(context.Background(), u))
+	require.Equal(t, Address{Street: "Calle Falsa 123", PostalCode: "C1043AAZ", Country: "AR"}, u.Address)
+
+	err := s.Create(context.Background(), &User{Name: "Ayrton", Address: Address{PostalCode: "1900", Country: "US"}})
+	require.ErrorIs(t, err, ErrInvalidPostalCode)
+}
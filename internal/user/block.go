@@ -0,0 +1,87 @@
+package user
+
+import (
+	"context"
+	"strings"
+
+	"Ejercicio_Final-Taller_Go/internal/apperrors"
+	"Ejercicio_Final-Taller_Go/internal/redact"
+
+	"go.uber.org/zap"
+)
+
+// ErrBlockReasonRequired is returned when blocking or unblocking a user
+// without saying why.
+var ErrBlockReasonRequired = apperrors.New(apperrors.Validation, "block_reason_required", "a reason is required to block or unblock a user")
+
+// Block keeps the user with the given ID from buying, e.g. after a fraud or
+// a chargeback, recording reason and actor. Blocking a blocked user again
+// replaces its reason. It sets UpdatedAt to now and increments Version.
+// Returns ErrNotFound if the user does not exist, ErrVersionMismatch if
+// version is set and differs from the stored one, or ErrBlockReasonRequired.
+func (s *Service) Block(ctx context.Context, id string, version *int, reason, actor string) (*User, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ErrBlockReasonRequired
+	}
+
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	existing, err := s.readForUpdate(ctx, id, version)
+	if err != nil {
+		return nil, err
+	}
+
+	before := *existing
+	now := s.clock.Now()
+	existing.Blocked = true
+	existing.BlockReason = reason
+	existing.BlockedBy = actor
+	existing.BlockedAt = &now
+	existing.UpdatedAt = now
+	existing.Version++
+	if err := s.storage.Set(ctx, existing); err != nil {
+		return nil, err
+	}
+
+	s.record(ctx, ActionBlocked, &before, existing)
+	s.log(ctx).Info("user blocked", zap.String("user_id", id), zap.String("reason", reason), zap.String("actor", redact.Mask(actor)))
+	return existing, nil
+}
+
+// Unblock lets the user with the given ID buy again, clearing the block.
+// The reason is only logged. Unblocking a user that is not
+// blocked changes nothing.
+// Returns ErrNotFound if the user does not exist, ErrVersionMismatch if
+// version is set and differs from the stored one, or ErrBlockReasonRequired.
+func (s *Service) Unblock(ctx context.Context, id string, version *int, reason, actor string) (*User, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ErrBlockReasonRequired
+	}
+
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	existing, err := s.readForUpdate(ctx, id, version)
+	if err != nil {
+		return nil, err
+	}
+	if !existing.Blocked {
+		return existing, nil
+	}
+
+	before := *existing
+	existing.Blocked = false
+	existing.BlockReason, existing.BlockedBy, existing.BlockedAt = "", "", nil
+	existing.UpdatedAt = s.clock.Now()
+	existing.Version++
+	if err := s.storage.Set(ctx, existing); err != nil {
+		return nil, err
+	}
+
+	s.record(ctx, ActionUnblocked, &before, existing)
+	s.log(ctx).Info("user unblocked", zap.String("user_id", id), zap.String("reason", reason), zap.String("actor", redact.Mask(actor)))
+	return existing, nil
+}
@@ -0,0 +1,42 @@
+package user
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestService_BlockUnblock(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(NewLocalStorage(), zap.NewNop())
+	u := &User{Name: "Ayrton"}
+	require.NoError(t, s.Create(ctx, u))
+
+	_, err := s.Block(ctx, u.ID, nil, "  ", "admin")
+	require.ErrorIs(t, err, ErrBlockReasonRequired)
+
+	blocked, err := s.Block(ctx, u.ID, nil, "chargeback", "admin")
+	require.NoError(t, err)
+	require.True(t, blocked.Blocked)
+	require.Equal(t, "chargeback", blocked.BlockReason)
+	require.Equal(t, "admin", blocked.BlockedBy)
+	require.NotNil(t, blocked.BlockedAt)
+	require.Equal(t, 2, blocked.Version)
+
+	unblocked, err := s.Unblock(ctx, u.ID, nil, "dispute won", "admin")
+	require.NoError(t, err)
+	require.False(t, unblocked.Blocked)
+	require.Empty(t, unblocked.BlockReason)
+	require.Nil(t, unblocked.BlockedAt)
+	require.Equal(t, 3, unblocked.Version)
+
+	// desbloquear a quien no está bloqueado no cambia nada
+	again, err := s.Unblock(ctx, u.ID, nil, "dispute won", "admin")
+	require.NoError(t, err)
+	require.Equal(t, 3, again.Version)
+
+	_, err = s.Block(ctx, "missing", nil, "fraud", "admin")
+	require.ErrorIs(t, err, ErrNotFound)
+}
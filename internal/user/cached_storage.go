@@ -0,0 +1,163 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/cache"
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+)
+
+// CachedStorage wraps a Storage so reads of a user by ID are served from a
+// cache, filled on a miss and invalidated whenever the user is written or
+// deleted. A read racing a write may cache the older user, for up to the TTL.
+// Cache failures on read fall back to the wrapped storage.
+type CachedStorage struct {
+	inner Storage
+	cache cache.Cache
+	ttl   time.Duration
+	stats *CacheStats
+}
+
+// NewCachedStorage returns inner with its reads by ID cached for ttl.
+func NewCachedStorage(inner Storage, c cache.Cache, ttl time.Duration) *CachedStorage {
+	return &CachedStorage{inner: inner, cache: c, ttl: ttl, stats: &CacheStats{}}
+}
+
+// CacheStats counts the reads by ID served from the cache and the ones
+// that missed it.
+type CacheStats struct {
+	Hits   atomic.Int64
+	Misses atomic.Int64
+}
+
+// HitRate returns the fraction of the reads served from the cache, or 0
+// before any.
+func (s *CacheStats) HitRate() float64 {
+	hits, misses := s.Hits.Load(), s.Misses.Load()
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
+
+// String renders the stats as JSON, implementing expvar.Var.
+func (s *CacheStats) String() string {
+	return fmt.Sprintf(`{"hits": %d, "misses": %d, "hit_rate": %g}`, s.Hits.Load(), s.Misses.Load(), s.HitRate())
+}
+
+// Stats returns the statistics of the reads through c.
+func (c *CachedStorage) Stats() *CacheStats {
+	return c.stats
+}
+
+// cachedUser is how a user is kept in the cache, with the data key of an
+// encrypted copy that its JSON leaves out.
+type cachedUser struct {
+	User       *User  `json:"user"`
+	WrappedKey []byte `json:"wrapped_key,omitempty"`
+}
+
+// Set stores user and drops its cached copy.
+func (c *CachedStorage) Set(ctx context.Context, user *User) error {
+	if err := c.inner.Set(ctx, user); err != nil {
+		return err
+	}
+	return c.invalidate(ctx, user.ID)
+}
+
+// Read returns the cached copy of the user, reading and caching it on a miss.
+func (c *CachedStorage) Read(ctx context.Context, id string) (*User, error) {
+	key := c.key(ctx, id)
+	if data, ok, err := c.cache.Get(ctx, key); err == nil && ok {
+		var cached cachedUser
+		if err := json.Unmarshal(data, &cached); err == nil && cached.User != nil {
+			cached.User.wrappedKey = cached.WrappedKey
+			c.stats.Hits.Add(1)
+			return cached.User, nil
+		}
+	}
+	c.stats.Misses.Add(1)
+
+	u, err := c.inner.Read(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if data, err := json.Marshal(cachedUser{User: u, WrappedKey: u.wrappedKey}); err == nil {
+		_ = c.cache.Set(ctx, key, data, c.ttl)
+	}
+	return u, nil
+}
+
+// ReadByExternalID reads the wrapped storage; only reads by ID are cached.
+func (c *CachedStorage) ReadByExternalID(ctx context.Context, externalID string) (*User, error) {
+	return c.inner.ReadByExternalID(ctx, externalID)
+}
+
+// Delete removes a user and its cached copy.
+func (c *CachedStorage) Delete(ctx context.Context, id string) error {
+	if err := c.inner.Delete(ctx, id); err != nil {
+		return err
+	}
+	return c.invalidate(ctx, id)
+}
+
+// List reads the wrapped storage.
+func (c *CachedStorage) List(ctx context.Context) ([]*User, error) {
+	return c.inner.List(ctx)
+}
+
+// Ping checks the wrapped storage.
+func (c *CachedStorage) Ping(ctx context.Context) error {
+	return c.inner.Ping(ctx)
+}
+
+// WithTx runs fn in a transaction of the wrapped storage. The users fn
+// writes are invalidated again once the transaction ends, so a read during
+// it cannot leave them cached with their older values.
+func (c *CachedStorage) WithTx(ctx context.Context, fn func(tx Storage) error) error {
+	var written []string
+	err := c.inner.WithTx(ctx, func(tx Storage) error {
+		return fn(&txCachedStorage{CachedStorage: &CachedStorage{inner: tx, cache: c.cache, ttl: c.ttl, stats: c.stats}, written: &written})
+	})
+	for _, id := range written {
+		if ierr := c.invalidate(ctx, id); ierr != nil && err == nil {
+			err = ierr
+		}
+	}
+	return err
+}
+
+// txCachedStorage is the CachedStorage seen by a transaction, which
+// remembers the users written in it.
+type txCachedStorage struct {
+	*CachedStorage
+	written *[]string
+}
+
+func (t *txCachedStorage) Set(ctx context.Context, user *User) error {
+	*t.written = append(*t.written, user.ID)
+	return t.CachedStorage.Set(ctx, user)
+}
+
+func (t *txCachedStorage) Delete(ctx context.Context, id string) error {
+	*t.written = append(*t.written, id)
+	return t.CachedStorage.Delete(ctx, id)
+}
+
+// invalidate drops the cached copy of the user with the given ID. The
+// change is stored already, so the error tells it may be served stale.
+func (c *CachedStorage) invalidate(ctx context.Context, id string) error {
+	if err := c.cache.Delete(ctx, c.key(ctx, id)); err != nil {
+		return fmt.Errorf("user %s stored but still cached: %w", id, err)
+	}
+	return nil
+}
+
+// key scopes a user ID to the tenant in ctx.
+func (c *CachedStorage) key(ctx context.Context, id string) string {
+	return tenant.FromContext(ctx) + "/" + id
+}
@@ -0,0 +1,73 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/cache"
+	"Ejercicio_Final-Taller_Go/internal/clock"
+	"Ejercicio_Final-Taller_Go/internal/envelope"
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachedStorage(t *testing.T) {
+	ctx := context.Background()
+	inner := NewLocalStorage()
+	storage := NewCachedStorage(inner, cache.NewLocal(clock.System(), 100), time.Minute)
+
+	require.NoError(t, storage.Set(ctx, &User{ID: "1", Name: "Ayrton", Version: 1}))
+	got, err := storage.Read(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, "Ayrton", got.Name)
+
+	// una escritura por fuera de la caché no se ve hasta invalidarla
+	require.NoError(t, inner.Set(ctx, &User{ID: "1", Name: "Senna", Version: 2}))
+	got, err = storage.Read(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, "Ayrton", got.Name)
+
+	require.NoError(t, storage.Set(ctx, &User{ID: "1", Name: "Prost", Version: 3}))
+	got, err = storage.Read(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, "Prost", got.Name)
+
+	// cada tenant tiene sus usuarios
+	_, err = storage.Read(tenant.WithID(ctx, "acme"), "1")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, storage.WithTx(ctx, func(tx Storage) error {
+		return tx.Delete(ctx, "1")
+	}))
+	_, err = storage.Read(ctx, "1")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	require.Equal(t, int64(1), storage.Stats().Hits.Load())
+	require.Equal(t, int64(4), storage.Stats().Misses.Load())
+	require.Equal(t, 0.2, storage.Stats().HitRate())
+}
+
+func TestCachedStorage_UnderEncryption(t *testing.T) {
+	ctx := context.Background()
+	kek, err := envelope.LocalKey(bytes.Repeat([]byte{7}, 32))
+	require.NoError(t, err)
+
+	c := cache.NewLocal(clock.System(), 100)
+	storage := NewEncryptedStorage(NewCachedStorage(NewLocalStorage(), c, time.Minute), envelope.New(kek))
+
+	require.NoError(t, storage.Set(ctx, &User{ID: "1", Name: "Ayrton", Email: "ayrton@example.com"}))
+	for range 2 {
+		got, err := storage.Read(ctx, "1")
+		require.NoError(t, err)
+		require.Equal(t, "Ayrton", got.Name)
+	}
+
+	raw, ok, err := c.Get(ctx, tenant.FromContext(ctx)+"/1")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NotContains(t, string(raw), "Ayrton")
+	require.NotContains(t, string(raw), "ayrton")
+}
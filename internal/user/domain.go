@@ -1,22 +1,74 @@
 package user
 
-import "time"
+import (
+	"encoding/xml"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/redact"
+
+	"go.uber.org/zap/zapcore"
+)
 
 // User represents a system user with metadata for auditing and versioning.
 type User struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	Address   string    `json:"address"`
-	NickName  string    `json:"nickname"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Version   int       `json:"version"`
+	XMLName xml.Name `json:"-" xml:"user"`
+
+	ID        string    `json:"id" xml:"id"`
+	Name      string    `json:"name" xml:"name"`
+	Address   Address   `json:"address" xml:"address"`
+	NickName  string    `json:"nickname" xml:"nickname"`
+	Email     string    `json:"email" xml:"email"`
+	CreatedAt time.Time `json:"created_at" xml:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" xml:"updated_at"`
+	Version   int       `json:"version" xml:"version"`
+
+	// ExternalID is the ID of the user in an external system such as a CRM,
+	// unique per tenant; creating a user with a known one returns that user.
+	ExternalID string `json:"external_id,omitempty" xml:"external_id,omitempty"`
+
+	// EmailVerified is set once the user confirms the token sent to Email
+	// (see Service.Verify), and cleared whenever Email changes.
+	EmailVerified bool `json:"email_verified" xml:"email_verified"`
+
+	// Blocked users cannot buy (see Service.Block). BlockReason, BlockedBy
+	// and BlockedAt tell why, by whom and when they were blocked.
+	Blocked     bool       `json:"blocked" xml:"blocked"`
+	BlockReason string     `json:"block_reason,omitempty" xml:"block_reason,omitempty"`
+	BlockedBy   string     `json:"blocked_by,omitempty" xml:"blocked_by,omitempty"`
+	BlockedAt   *time.Time `json:"blocked_at,omitempty" xml:"blocked_at,omitempty"`
+
+	// wrappedKey is the wrapped data key the PII fields of a stored copy are
+	// encrypted with (see EncryptedStorage).
+	wrappedKey []byte
+}
+
+// EntityID returns the ID the user is stored under.
+func (u *User) EntityID() string {
+	return u.ID
+}
+
+// MarshalLogObject logs the user with its personal data masked, and its
+// email hashed so log lines about the same address can be correlated.
+func (u *User) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("id", u.ID)
+	enc.AddString("name", redact.Mask(u.Name))
+	enc.AddString("address", redact.Mask(u.Address.String()))
+	enc.AddString("nickname", redact.Mask(u.NickName))
+	enc.AddString("email", redact.Hash(u.Email))
+	if u.Blocked {
+		enc.AddBool("blocked", true)
+	}
+	enc.AddInt("version", u.Version)
+	return nil
 }
 
 // UpdateFields represents the optional fields for updating a User.
-// A nil pointer means “no change” for that field.
+// A nil pointer means “no change” for that field. Version, if set, is the
+// version the caller read; the update fails if the user changed since.
 type UpdateFields struct {
-	Name     *string `json:"name"`
-	Address  *string `json:"address"`
-	NickName *string `json:"nickname"`
+	Name     *string  `json:"name"`
+	Address  *Address `json:"address"`
+	NickName *string  `json:"nickname"`
+	Email    *string  `json:"email"`
+	Version  *int     `json:"version"`
 }
@@ -0,0 +1,119 @@
+package user
+
+import (
+	"context"
+	"fmt"
+
+	"Ejercicio_Final-Taller_Go/internal/envelope"
+)
+
+// EncryptedStorage wraps a Storage so the PII of users (name, address,
+// nickname and email) is kept encrypted in it and decrypted on read.
+// Every write encrypts with a fresh data key wrapped by the cipher's KMS key.
+type EncryptedStorage struct {
+	inner  Storage
+	cipher *envelope.Cipher
+}
+
+// NewEncryptedStorage returns inner with its PII encrypted by cipher.
+func NewEncryptedStorage(inner Storage, cipher *envelope.Cipher) *EncryptedStorage {
+	return &EncryptedStorage{inner: inner, cipher: cipher}
+}
+
+// piiFields returns pointers to the fields of u that are encrypted at rest.
+func piiFields(u *User) []*string {
+	a := &u.Address
+	return []*string{&u.Name, &a.Street, &a.City, &a.Province, &a.PostalCode, &a.Country, &u.NickName, &u.Email}
+}
+
+// Set stores an encrypted copy of user; user itself is left untouched.
+func (e *EncryptedStorage) Set(ctx context.Context, user *User) error {
+	dataKey, wrapped, err := e.cipher.NewDataKey(ctx)
+	if err != nil {
+		return err
+	}
+
+	stored := *user
+	stored.wrappedKey = wrapped
+	for _, f := range piiFields(&stored) {
+		if *f, err = envelope.Encrypt(dataKey, *f); err != nil {
+			return fmt.Errorf("error encrypting user %s: %w", user.ID, err)
+		}
+	}
+	return e.inner.Set(ctx, &stored)
+}
+
+// Read returns a decrypted copy of the stored user.
+func (e *EncryptedStorage) Read(ctx context.Context, id string) (*User, error) {
+	stored, err := e.inner.Read(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return e.decrypt(ctx, stored)
+}
+
+// ReadByExternalID returns a decrypted copy of the user with the given
+// external ID, which is not encrypted so it can be looked up.
+func (e *EncryptedStorage) ReadByExternalID(ctx context.Context, externalID string) (*User, error) {
+	stored, err := e.inner.ReadByExternalID(ctx, externalID)
+	if err != nil {
+		return nil, err
+	}
+	return e.decrypt(ctx, stored)
+}
+
+// Delete removes a user.
+func (e *EncryptedStorage) Delete(ctx context.Context, id string) error {
+	return e.inner.Delete(ctx, id)
+}
+
+// List returns decrypted copies of every user.
+func (e *EncryptedStorage) List(ctx context.Context) ([]*User, error) {
+	stored, err := e.inner.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]*User, 0, len(stored))
+	for _, s := range stored {
+		u, err := e.decrypt(ctx, s)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, nil
+}
+
+// Ping checks the wrapped storage.
+func (e *EncryptedStorage) Ping(ctx context.Context) error {
+	return e.inner.Ping(ctx)
+}
+
+// WithTx runs fn in a transaction of the wrapped storage, which fn also sees encrypted.
+func (e *EncryptedStorage) WithTx(ctx context.Context, fn func(tx Storage) error) error {
+	return e.inner.WithTx(ctx, func(tx Storage) error {
+		return fn(&EncryptedStorage{inner: tx, cipher: e.cipher})
+	})
+}
+
+// decrypt returns a plaintext copy of stored. Users stored before
+// encryption was enabled have no data key and are returned as they are.
+func (e *EncryptedStorage) decrypt(ctx context.Context, stored *User) (*User, error) {
+	u := *stored
+	u.wrappedKey = nil
+	if stored.wrappedKey == nil {
+		return &u, nil
+	}
+
+	dataKey, err := e.cipher.DataKey(ctx, stored.wrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range piiFields(&u) {
+		if *f, err = envelope.Decrypt(dataKey, *f); err != nil {
+			return nil, fmt.Errorf("error decrypting user %s: %w", u.ID, err)
+		}
+	}
+	return &u, nil
+}
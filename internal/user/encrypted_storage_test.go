@@ -0,0 +1,38 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"Ejercicio_Final-Taller_Go/internal/envelope"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptedStorage(t *testing.T) {
+	ctx := context.Background()
+	kek, err := envelope.LocalKey(bytes.Repeat([]byte{7}, 32))
+	require.NoError(t, err)
+
+	inner := NewLocalStorage()
+	storage := NewEncryptedStorage(inner, envelope.New(kek))
+
+	u := &User{ID: "1", Name: "Ayrton", Email: "ayrton@example.com", Version: 1}
+	require.NoError(t, storage.Set(ctx, u))
+	require.Equal(t, "Ayrton", u.Name)
+
+	raw, err := inner.Read(ctx, "1")
+	require.NoError(t, err)
+	require.NotContains(t, raw.Name, "Ayrton")
+	require.NotContains(t, raw.Email, "ayrton")
+	require.Empty(t, raw.Address)
+
+	got, err := storage.Read(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, u, got)
+
+	list, err := storage.List(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []*User{u}, list)
+}
@@ -0,0 +1,107 @@
+package user
+
+import (
+	"context"
+
+	"Ejercicio_Final-Taller_Go/internal/audit"
+
+	"go.uber.org/zap"
+)
+
+// auditResource is the resource name users are recorded under in the audit store.
+const auditResource = "user"
+
+// Actions recorded in the history of a user.
+const (
+	ActionCreated   = "created"
+	ActionImported  = "imported"
+	ActionUpdated   = "updated"
+	ActionReplaced  = "replaced"
+	ActionVerified  = "verified"
+	ActionBlocked   = "blocked"
+	ActionUnblocked = "unblocked"
+	ActionDeleted   = "deleted"
+)
+
+// WithAudit sets the store the changes of users are recorded in. Defaults
+// to an in-memory store.
+func WithAudit(store audit.Store) Option {
+	return func(s *Service) {
+		s.audit = store
+	}
+}
+
+// History returns the recorded changes of the user with the given ID,
+// oldest first, each with the actor in its context (see audit.WithActor).
+// The history of deleted users is kept.
+// Returns ErrNotFound if the user has no history and does not exist.
+func (s *Service) History(ctx context.Context, id string) ([]audit.Entry, error) {
+	var entries []audit.Entry
+	if s.audit != nil {
+		var err error
+		if entries, err = s.audit.List(ctx, auditResource, id); err != nil {
+			return nil, err
+		}
+	}
+	if len(entries) == 0 {
+		if _, err := s.storage.Read(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// record appends to the history of the user the fields that differ from
+// before to after; nil stands for a user that does not exist. The change
+// is already stored, so failing to record it is only logged.
+func (s *Service) record(ctx context.Context, action string, before, after *User) {
+	if s.audit == nil {
+		return
+	}
+	id := ""
+	var b, a User
+	if before != nil {
+		b, id = *before, before.ID
+	}
+	if after != nil {
+		a, id = *after, after.ID
+	}
+
+	e := audit.Entry{
+		ID:         s.ids.NewID(),
+		Resource:   auditResource,
+		ResourceID: id,
+		Action:     action,
+		Actor:      audit.ActorFromContext(ctx),
+		At:         s.clock.Now(),
+		Changes:    diff(&b, &a),
+	}
+	if err := s.audit.Append(ctx, e); err != nil {
+		s.log(ctx).Error("failed to record user change", zap.String("user_id", id), zap.String("action", action), zap.Error(err))
+	}
+}
+
+// diff returns the audited fields that differ between before and after.
+func diff(before, after *User) []audit.Change {
+	fields := []audit.Change{
+		{Field: "name", Before: before.Name, After: after.Name},
+		{Field: "address.street", Before: before.Address.Street, After: after.Address.Street},
+		{Field: "address.city", Before: before.Address.City, After: after.Address.City},
+		{Field: "address.province", Before: before.Address.Province, After: after.Address.Province},
+		{Field: "address.postal_code", Before: before.Address.PostalCode, After: after.Address.PostalCode},
+		{Field: "address.country", Before: before.Address.Country, After: after.Address.Country},
+		{Field: "nickname", Before: before.NickName, After: after.NickName},
+		{Field: "email", Before: before.Email, After: after.Email},
+		{Field: "email_verified", Before: before.EmailVerified, After: after.EmailVerified},
+		{Field: "blocked", Before: before.Blocked, After: after.Blocked},
+		{Field: "block_reason", Before: before.BlockReason, After: after.BlockReason},
+	}
+
+	var changes []audit.Change
+	for _, c := range fields {
+		if c.Before != c.After {
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
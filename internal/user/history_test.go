@@ -0,0 +1,39 @@
+package user
+
+import (
+	"context"
+	"testing"
+
+	"Ejercicio_Final-Taller_Go/internal/audit"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestService_History(t *testing.T) {
+	ctx := audit.WithActor(context.Background(), "apikey:support")
+	s := NewService(NewLocalStorage(), zap.NewNop())
+
+	u := &User{Name: "Ayrton", Address: Address{Street: "Calle 1", City: "Tandil", Country: "AR"}}
+	require.NoError(t, s.Create(ctx, u))
+	city := "Azul"
+	_, err := s.Update(ctx, u.ID, &UpdateFields{Address: &Address{Street: "Calle 1", City: city, Country: "AR"}})
+	require.NoError(t, err)
+	require.NoError(t, s.Delete(ctx, u.ID))
+
+	history, err := s.History(ctx, u.ID)
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	require.Equal(t, ActionCreated, history[0].Action)
+	require.Contains(t, history[0].Changes, audit.Change{Field: "name", Before: "", After: "Ayrton"})
+
+	require.Equal(t, ActionUpdated, history[1].Action)
+	require.Equal(t, "apikey:support", history[1].Actor)
+	require.Equal(t, []audit.Change{{Field: "address.city", Before: "Tandil", After: "Azul"}}, history[1].Changes)
+
+	// la historia sobrevive al usuario
+	require.Equal(t, ActionDeleted, history[2].Action)
+
+	_, err = s.History(ctx, "missing")
+	require.ErrorIs(t, err, ErrNotFound)
+}
@@ -0,0 +1,101 @@
+package user
+
+import (
+	"context"
+	"net/mail"
+	"strings"
+
+	"Ejercicio_Final-Taller_Go/internal/apperrors"
+
+	"go.uber.org/zap"
+)
+
+// ErrNameRequired is returned for a user without a name.
+var ErrNameRequired = apperrors.New(apperrors.Validation, "name_required", "name is required")
+
+// ErrInvalidEmail is returned for a user whose email is not a plain
+// address such as "ana@example.com".
+var ErrInvalidEmail = apperrors.New(apperrors.Validation, "invalid_email", "invalid email address")
+
+// importBatchSize is how many users Import writes per transaction.
+const importBatchSize = 100
+
+// ImportResult is the outcome of one imported user. Row counts from 1 in
+// the order the users were given; Err is nil for created users.
+type ImportResult struct {
+	Row  int
+	User *User
+	Err  error
+}
+
+// Validate checks the fields a new user must have, created or imported: a
+// name, a valid address and, if any, a valid email. Returns ErrNameRequired,
+// ErrInvalidEmail or the error of Address.Validate otherwise.
+func Validate(u *User) error {
+	if strings.TrimSpace(u.Name) == "" {
+		return ErrNameRequired
+	}
+	if u.Email != "" {
+		addr, err := mail.ParseAddress(u.Email)
+		if err != nil || addr.Address != u.Email {
+			return ErrInvalidEmail
+		}
+	}
+	return u.Address.Validate()
+}
+
+// Import creates every valid user of users, stamping them as Create does,
+// and returns one result per user in the same order. Valid users are
+// written in transactions of importBatchSize; a batch that fails to be
+// written fails every user in it, and the batches after it are not tried
+// once ctx is done.
+func (s *Service) Import(ctx context.Context, users []*User) []ImportResult {
+	results := make([]ImportResult, len(users))
+	var valid []int
+	for i, u := range users {
+		results[i] = ImportResult{Row: i + 1, User: u}
+		u.Address = u.Address.normalized()
+		if err := Validate(u); err != nil {
+			results[i].Err = err
+			continue
+		}
+		valid = append(valid, i)
+	}
+
+	for start := 0; start < len(valid); start += importBatchSize {
+		batch := valid[start:min(start+importBatchSize, len(valid))]
+		if err := ctx.Err(); err != nil {
+			for _, i := range batch {
+				results[i].Err = err
+			}
+			continue
+		}
+
+		err := s.storage.WithTx(ctx, func(tx Storage) error {
+			now := s.clock.Now()
+			for _, i := range batch {
+				u := users[i]
+				u.ID = s.ids.NewID()
+				u.CreatedAt, u.UpdatedAt, u.Version = now, now, 1
+				if err := tx.Set(ctx, u); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			s.log(ctx).Error("failed to import users", zap.Int("batch_size", len(batch)), zap.Error(err))
+			for _, i := range batch {
+				results[i].Err = err
+			}
+			continue
+		}
+		for _, i := range batch {
+			s.record(ctx, ActionImported, nil, users[i])
+			s.issueVerification(ctx, users[i])
+		}
+	}
+
+	s.log(ctx).Info("users imported", zap.Int("total", len(users)), zap.Int("valid", len(valid)))
+	return results
+}
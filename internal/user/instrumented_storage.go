@@ -0,0 +1,64 @@
+package user
+
+import (
+	"context"
+
+	"Ejercicio_Final-Taller_Go/internal/metrics"
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+
+	"go.uber.org/zap"
+)
+
+// InstrumentedStorage wraps a Storage timing each of its operations on a
+// metrics.Operations, which logs the slow ones with their parameters.
+type InstrumentedStorage struct {
+	inner Storage
+	ops   *metrics.Operations
+}
+
+// NewInstrumentedStorage returns inner with its operations timed on ops.
+func NewInstrumentedStorage(inner Storage, ops *metrics.Operations) *InstrumentedStorage {
+	return &InstrumentedStorage{inner: inner, ops: ops}
+}
+
+func (s *InstrumentedStorage) Set(ctx context.Context, user *User) error {
+	defer s.ops.Start("set")(tenantField(ctx), zap.String("user_id", user.ID))
+	return s.inner.Set(ctx, user)
+}
+
+func (s *InstrumentedStorage) Read(ctx context.Context, id string) (*User, error) {
+	defer s.ops.Start("read")(tenantField(ctx), zap.String("user_id", id))
+	return s.inner.Read(ctx, id)
+}
+
+func (s *InstrumentedStorage) Delete(ctx context.Context, id string) error {
+	defer s.ops.Start("delete")(tenantField(ctx), zap.String("user_id", id))
+	return s.inner.Delete(ctx, id)
+}
+
+func (s *InstrumentedStorage) List(ctx context.Context) ([]*User, error) {
+	defer s.ops.Start("list")(tenantField(ctx))
+	return s.inner.List(ctx)
+}
+
+func (s *InstrumentedStorage) ReadByExternalID(ctx context.Context, externalID string) (*User, error) {
+	defer s.ops.Start("read_by_external_id")(tenantField(ctx), zap.String("external_id", externalID))
+	return s.inner.ReadByExternalID(ctx, externalID)
+}
+
+func (s *InstrumentedStorage) Ping(ctx context.Context) error {
+	defer s.ops.Start("ping")()
+	return s.inner.Ping(ctx)
+}
+
+// WithTx times the whole transaction, and each operation within it.
+func (s *InstrumentedStorage) WithTx(ctx context.Context, fn func(tx Storage) error) error {
+	defer s.ops.Start("with_tx")(tenantField(ctx))
+	return s.inner.WithTx(ctx, func(tx Storage) error {
+		return fn(&InstrumentedStorage{inner: tx, ops: s.ops})
+	})
+}
+
+func tenantField(ctx context.Context) zap.Field {
+	return zap.String("tenant", tenant.FromContext(ctx))
+}
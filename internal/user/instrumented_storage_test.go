@@ -0,0 +1,31 @@
+package user
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/metrics"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestInstrumentedStorage(t *testing.T) {
+	core, logs := observer.New(zap.WarnLevel)
+	ops := metrics.NewOperations("user_storage", zap.New(core), time.Hour)
+	storage := NewInstrumentedStorage(NewLocalStorage(), ops)
+	ctx := context.Background()
+
+	require.NoError(t, storage.Set(ctx, &User{ID: "1", Name: "Ayrton"}))
+	_, err := storage.Read(ctx, "1")
+	require.NoError(t, err)
+	_, err = storage.Read(ctx, "2")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	require.Equal(t, int64(1), ops.Histogram("set").Count())
+	require.Equal(t, int64(2), ops.Histogram("read").Count())
+	// ninguna superó el umbral
+	require.Zero(t, logs.Len())
+}
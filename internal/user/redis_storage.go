@@ -0,0 +1,271 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStorage keeps the users in Redis, so they outlive the process and
+// are shared by every instance. Each tenant has a hash of its users by ID,
+// one of their IDs by ExternalID, and one of the ExternalID each user is
+// indexed under. It is safe for concurrent use.
+type RedisStorage struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStorage returns a Storage on client, namespacing its keys with prefix.
+func NewRedisStorage(client *redis.Client, prefix string) *RedisStorage {
+	return &RedisStorage{client: client, prefix: prefix}
+}
+
+// redisWrite is a write of a user, or the deletion of the one with id.
+type redisWrite struct {
+	id   string
+	user *User // nil para borrarlo
+}
+
+// writeUsers applies writes in order, all or none: the deletions of users
+// that do not exist are checked before anything is written. It returns the
+// ID of the first such user, or nil. ARGV holds an ID, its JSON and its
+// ExternalID for each write; an empty JSON deletes the user.
+var writeUsers = redis.NewScript(`
+local exists = {}
+for i = 1, #ARGV, 3 do
+	local id = ARGV[i]
+	if ARGV[i + 1] == '' then
+		if exists[id] == nil then
+			exists[id] = redis.call('HEXISTS', KEYS[1], id) == 1
+		end
+		if not exists[id] then
+			return id
+		end
+	end
+	exists[id] = ARGV[i + 1] ~= ''
+end
+for i = 1, #ARGV, 3 do
+	local id, data, external = ARGV[i], ARGV[i + 1], ARGV[i + 2]
+	local previous = redis.call('HGET', KEYS[3], id)
+	if previous and redis.call('HGET', KEYS[2], previous) == id then
+		redis.call('HDEL', KEYS[2], previous)
+	end
+	redis.call('HDEL', KEYS[3], id)
+	if data == '' then
+		redis.call('HDEL', KEYS[1], id)
+	else
+		redis.call('HSET', KEYS[1], id, data)
+		if external ~= '' then
+			redis.call('HSET', KEYS[2], external, id)
+			redis.call('HSET', KEYS[3], id, external)
+		end
+	end
+end
+return false
+`)
+
+// keys returns the keys of the hashes of the tenant of ctx.
+func (r *RedisStorage) keys(ctx context.Context) (users, byExternalID, externalIDs string) {
+	base := r.prefix + tenant.FromContext(ctx) + ":"
+	return base + "users", base + "by_external_id", base + "external_ids"
+}
+
+// Set stores or replaces user. Returns ErrEmptyID if it has no ID.
+func (r *RedisStorage) Set(ctx context.Context, user *User) error {
+	if user.ID == "" {
+		return ErrEmptyID
+	}
+	return r.write(ctx, []redisWrite{{id: user.ID, user: user}})
+}
+
+// Delete removes the user with the given ID, or returns ErrNotFound.
+func (r *RedisStorage) Delete(ctx context.Context, id string) error {
+	return r.write(ctx, []redisWrite{{id: id}})
+}
+
+func (r *RedisStorage) write(ctx context.Context, writes []redisWrite) error {
+	args := make([]any, 0, 3*len(writes))
+	for _, w := range writes {
+		if w.user == nil {
+			args = append(args, w.id, "", "")
+			continue
+		}
+		// se guarda también la clave de datos, que el JSON del usuario deja afuera
+		data, err := json.Marshal(cachedUser{User: w.user, WrappedKey: w.user.wrappedKey})
+		if err != nil {
+			return fmt.Errorf("error encoding user %s: %w", w.id, err)
+		}
+		args = append(args, w.id, data, w.user.ExternalID)
+	}
+
+	users, byExternalID, externalIDs := r.keys(ctx)
+	err := writeUsers.Run(ctx, r.client, []string{users, byExternalID, externalIDs}, args...).Err()
+	switch {
+	case errors.Is(err, redis.Nil):
+		return nil
+	case err != nil:
+		return fmt.Errorf("error writing users: %w", err)
+	default:
+		// el script devuelve el ID de un usuario a borrar que no existe
+		return ErrNotFound
+	}
+}
+
+// Read returns the user with the given ID, or ErrNotFound.
+func (r *RedisStorage) Read(ctx context.Context, id string) (*User, error) {
+	users, _, _ := r.keys(ctx)
+	data, err := r.client.HGet(ctx, users, id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading user %s: %w", id, err)
+	}
+	return decodeUser(id, data)
+}
+
+// ReadByExternalID returns the user with the given ExternalID, or ErrNotFound.
+func (r *RedisStorage) ReadByExternalID(ctx context.Context, externalID string) (*User, error) {
+	_, byExternalID, _ := r.keys(ctx)
+	id, err := r.client.HGet(ctx, byExternalID, externalID).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading user by external ID: %w", err)
+	}
+	return r.Read(ctx, id)
+}
+
+// List returns every user of the tenant, in no particular order.
+func (r *RedisStorage) List(ctx context.Context) ([]*User, error) {
+	users, _, _ := r.keys(ctx)
+	all, err := r.client.HGetAll(ctx, users).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error listing users: %w", err)
+	}
+	list := make([]*User, 0, len(all))
+	for id, data := range all {
+		u, err := decodeUser(id, []byte(data))
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, u)
+	}
+	return list, nil
+}
+
+// Ping reports whether Redis answers.
+func (r *RedisStorage) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+// WithTx runs fn with a Storage that holds its writes back, reading them
+// back to fn, and applies them together once fn returns nil.
+func (r *RedisStorage) WithTx(ctx context.Context, fn func(tx Storage) error) error {
+	tx := &redisTx{storage: r, pending: map[string]*User{}}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if len(tx.writes) == 0 {
+		return nil
+	}
+	return r.write(ctx, tx.writes)
+}
+
+func decodeUser(id string, data []byte) (*User, error) {
+	var stored cachedUser
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("error decoding user %s: %w", id, err)
+	}
+	if stored.User == nil {
+		return nil, fmt.Errorf("error decoding user %s: no user stored", id)
+	}
+	stored.User.wrappedKey = stored.WrappedKey
+	return stored.User, nil
+}
+
+// redisTx is the Storage of a transaction of a RedisStorage.
+type redisTx struct {
+	storage *RedisStorage
+	writes  []redisWrite
+	pending map[string]*User // lo último escrito de cada usuario, nil si se borró
+}
+
+func (t *redisTx) Set(ctx context.Context, user *User) error {
+	if user.ID == "" {
+		return ErrEmptyID
+	}
+	t.writes = append(t.writes, redisWrite{id: user.ID, user: user})
+	t.pending[user.ID] = user
+	return nil
+}
+
+func (t *redisTx) Delete(ctx context.Context, id string) error {
+	if _, err := t.Read(ctx, id); err != nil {
+		return err
+	}
+	t.writes = append(t.writes, redisWrite{id: id})
+	t.pending[id] = nil
+	return nil
+}
+
+func (t *redisTx) Read(ctx context.Context, id string) (*User, error) {
+	if u, ok := t.pending[id]; ok {
+		if u == nil {
+			return nil, ErrNotFound
+		}
+		return u, nil
+	}
+	return t.storage.Read(ctx, id)
+}
+
+func (t *redisTx) ReadByExternalID(ctx context.Context, externalID string) (*User, error) {
+	for _, u := range t.pending {
+		if u != nil && u.ExternalID == externalID {
+			return u, nil
+		}
+	}
+	u, err := t.storage.ReadByExternalID(ctx, externalID)
+	if err != nil {
+		return nil, err
+	}
+	// el usuario guardado con ese ExternalID pudo cambiarlo o borrarse en la transacción
+	if _, ok := t.pending[u.ID]; ok {
+		return nil, ErrNotFound
+	}
+	return u, nil
+}
+
+func (t *redisTx) List(ctx context.Context) ([]*User, error) {
+	stored, err := t.storage.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*User, 0, len(stored)+len(t.pending))
+	for _, u := range stored {
+		if _, ok := t.pending[u.ID]; !ok {
+			list = append(list, u)
+		}
+	}
+	for _, u := range t.pending {
+		if u != nil {
+			list = append(list, u)
+		}
+	}
+	return list, nil
+}
+
+func (t *redisTx) Ping(ctx context.Context) error {
+	return t.storage.Ping(ctx)
+}
+
+// WithTx runs fn within the same transaction.
+func (t *redisTx) WithTx(ctx context.Context, fn func(tx Storage) error) error {
+	return fn(t)
+}
@@ -0,0 +1,119 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"Ejercicio_Final-Taller_Go/internal/envelope"
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+func newRedisStorage(t *testing.T) *RedisStorage {
+	mr := miniredis.RunT(t)
+	return NewRedisStorage(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "test:")
+}
+
+func TestRedisStorage(t *testing.T) {
+	ctx := context.Background()
+	storage := newRedisStorage(t)
+	require.NoError(t, storage.Ping(ctx))
+
+	require.ErrorIs(t, storage.Set(ctx, &User{Name: "Ayrton"}), ErrEmptyID)
+	require.NoError(t, storage.Set(ctx, &User{ID: "1", Name: "Ayrton", ExternalID: "crm-1", Version: 1}))
+	got, err := storage.Read(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, "Ayrton", got.Name)
+	got, err = storage.ReadByExternalID(ctx, "crm-1")
+	require.NoError(t, err)
+	require.Equal(t, "1", got.ID)
+
+	// el índice sigue al ExternalID
+	require.NoError(t, storage.Set(ctx, &User{ID: "1", Name: "Senna", ExternalID: "crm-2", Version: 2}))
+	_, err = storage.ReadByExternalID(ctx, "crm-1")
+	require.ErrorIs(t, err, ErrNotFound)
+	got, err = storage.ReadByExternalID(ctx, "crm-2")
+	require.NoError(t, err)
+	require.Equal(t, "Senna", got.Name)
+
+	// cada tenant tiene sus usuarios
+	_, err = storage.Read(tenant.WithID(ctx, "acme"), "1")
+	require.ErrorIs(t, err, ErrNotFound)
+	list, err := storage.List(tenant.WithID(ctx, "acme"))
+	require.NoError(t, err)
+	require.Empty(t, list)
+
+	require.NoError(t, storage.Set(ctx, &User{ID: "2", Name: "Prost"}))
+	list, err = storage.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+
+	require.NoError(t, storage.Delete(ctx, "1"))
+	require.ErrorIs(t, storage.Delete(ctx, "1"), ErrNotFound)
+	_, err = storage.Read(ctx, "1")
+	require.ErrorIs(t, err, ErrNotFound)
+	_, err = storage.ReadByExternalID(ctx, "crm-2")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestRedisStorage_WithTx(t *testing.T) {
+	ctx := context.Background()
+	storage := newRedisStorage(t)
+	require.NoError(t, storage.Set(ctx, &User{ID: "1", Name: "Ayrton", ExternalID: "crm-1"}))
+
+	// nada se escribe si la transacción falla
+	failure := errors.New("boom")
+	err := storage.WithTx(ctx, func(tx Storage) error {
+		require.NoError(t, tx.Set(ctx, &User{ID: "2", Name: "Prost"}))
+		require.NoError(t, tx.Delete(ctx, "1"))
+		// la transacción ve sus propias escrituras
+		_, err := tx.Read(ctx, "1")
+		require.ErrorIs(t, err, ErrNotFound)
+		_, err = tx.ReadByExternalID(ctx, "crm-1")
+		require.ErrorIs(t, err, ErrNotFound)
+		list, err := tx.List(ctx)
+		require.NoError(t, err)
+		require.Len(t, list, 1)
+		return failure
+	})
+	require.ErrorIs(t, err, failure)
+	_, err = storage.Read(ctx, "2")
+	require.ErrorIs(t, err, ErrNotFound)
+	_, err = storage.Read(ctx, "1")
+	require.NoError(t, err)
+
+	require.NoError(t, storage.WithTx(ctx, func(tx Storage) error {
+		if err := tx.Set(ctx, &User{ID: "2", Name: "Prost", ExternalID: "crm-2"}); err != nil {
+			return err
+		}
+		return tx.Delete(ctx, "1")
+	}))
+	got, err := storage.ReadByExternalID(ctx, "crm-2")
+	require.NoError(t, err)
+	require.Equal(t, "Prost", got.Name)
+	_, err = storage.Read(ctx, "1")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestRedisStorage_UnderEncryption(t *testing.T) {
+	ctx := context.Background()
+	kek, err := envelope.LocalKey(bytes.Repeat([]byte{7}, 32))
+	require.NoError(t, err)
+	inner := newRedisStorage(t)
+	storage := NewEncryptedStorage(inner, envelope.New(kek))
+
+	require.NoError(t, storage.Set(ctx, &User{ID: "1", Name: "Ayrton", Email: "ayrton@example.com"}))
+	// lo guardado está cifrado, y se descifra con la clave de datos guardada a su lado
+	stored, err := inner.Read(ctx, "1")
+	require.NoError(t, err)
+	require.NotEqual(t, "Ayrton", stored.Name)
+	got, err := storage.Read(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, "Ayrton", got.Name)
+	require.Equal(t, "ayrton@example.com", got.Email)
+}
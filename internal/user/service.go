@@ -1,9 +1,16 @@
 package user
 
 import (
-	"github.com/google/uuid"
+	"Ejercicio_Final-Taller_Go/internal/audit"
+	"Ejercicio_Final-Taller_Go/internal/clock"
+	"Ejercicio_Final-Taller_Go/internal/idgen"
+	"Ejercicio_Final-Taller_Go/internal/logging"
+	"context"
+	"errors"
+	"fmt"
 	"go.uber.org/zap"
-	"time"
+	"sort"
+	"sync"
 )
 
 // Service provides high-level user management operations on a LocalStorage backend.
@@ -13,78 +20,271 @@ type Service struct {
 
 	// logger is our observability component to log.
 	logger *zap.Logger
+
+	// ids generates the IDs of new users.
+	ids idgen.Generator
+
+	// clock provides the timestamps of created and updated users.
+	clock clock.Clock
+
+	// verifications holds the email verification tokens; nil disables them.
+	verifications *verifications
+
+	// audit records the history of every user (see History).
+	audit audit.Store
+
+	// updateMu serializes the version check and write of the changes to
+	// stored users (see readForUpdate), and createMu the lookup and write
+	// of CreateOrGet.
+	updateMu sync.Mutex
+	createMu sync.Mutex
+}
+
+// Option configures optional dependencies of a Service.
+type Option func(*Service)
+
+// WithClock sets the clock used for timestamps. Defaults to the system clock.
+func WithClock(c clock.Clock) Option {
+	return func(s *Service) {
+		s.clock = c
+	}
+}
+
+// WithIDGenerator sets the generator used for new user IDs. Defaults to UUIDs.
+func WithIDGenerator(ids idgen.Generator) Option {
+	return func(s *Service) {
+		s.ids = ids
+	}
 }
 
 // NewService creates a new Service.
-func NewService(storage Storage, logger *zap.Logger) *Service {
+func NewService(storage Storage, logger *zap.Logger, opts ...Option) *Service {
 	if logger == nil {
-		logger, _ = zap.NewProduction()
-		defer logger.Sync() // flushes buffer, if any
+		logger = zap.NewNop()
 	}
 	
-	return &Service{
+	s := &Service{
 		storage: storage,
 		logger:  logger,
+		ids:     idgen.UUID(),
+		clock:   clock.System(),
+		audit:   audit.NewLocalStore(),
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+
+	return s
+}
+
+// log returns the logger of the work ctx belongs to, such as a request,
+// with the fields describing it, or the service's logger.
+func (s *Service) log(ctx context.Context) *zap.Logger {
+	return logging.FromContext(ctx, s.logger)
 }
 
 // Create adds a brand-new user to the system.
-// It sets CreatedAt and UpdatedAt to the current time and initializes Version to 1.
-// Returns ErrEmptyID if user.ID is empty.
-func (s *Service) Create(user *User) error {
-	user.ID = uuid.NewString()
-	now := time.Now()
+// It sets CreatedAt and UpdatedAt to the current time, initializes Version to 1
+// and sends a token to verify the email, if any (see WithVerification).
+// Returns the error of Validate for an invalid user.
+func (s *Service) Create(ctx context.Context, user *User) error {
+	user.Address = user.Address.normalized()
+	if err := Validate(user); err != nil {
+		return err
+	}
+
+	user.ID = s.ids.NewID()
+	now := s.clock.Now()
 	user.CreatedAt = now
 	user.UpdatedAt = now
 	user.Version = 1
+	user.EmailVerified = false
 
-	if err := s.storage.Set(user); err != nil {
-		s.logger.Error("failed to set user", zap.Error(err), zap.Any("user", user))
+	if err := s.storage.Set(ctx, user); err != nil {
+		s.log(ctx).Error("failed to set user", zap.Error(err), zap.Any("user", user))
 		return err
 	}
 
+	s.record(ctx, ActionCreated, nil, user)
+	s.issueVerification(ctx, user)
 	return nil
 }
 
+// CreateOrGet creates user as Create does, unless a stored user already has
+// its ExternalID: that user is then returned as it is and created is false,
+// so that retrying a creation never makes a duplicate.
+func (s *Service) CreateOrGet(ctx context.Context, user *User) (stored *User, created bool, err error) {
+	if user.ExternalID != "" {
+		// la búsqueda y el alta van juntas para que dos reintentos no creen dos usuarios
+		s.createMu.Lock()
+		defer s.createMu.Unlock()
+
+		existing, err := s.storage.ReadByExternalID(ctx, user.ExternalID)
+		if err == nil {
+			return existing, false, nil
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return nil, false, err
+		}
+	}
+
+	if err := s.Create(ctx, user); err != nil {
+		return nil, false, err
+	}
+	return user, true, nil
+}
+
 // Get retrieves a user by its ID.
 // Returns ErrNotFound if no user exists with the given ID.
-func (s *Service) Get(id string) (*User, error) {
-	return s.storage.Read(id)
+func (s *Service) Get(ctx context.Context, id string) (*User, error) {
+	return s.storage.Read(ctx, id)
+}
+
+// List returns every user, oldest first.
+func (s *Service) List(ctx context.Context) ([]*User, error) {
+	users, err := s.storage.List(ctx)
+	if err != nil {
+		s.log(ctx).Error("failed to list users", zap.Error(err))
+		return nil, err
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		if !users[i].CreatedAt.Equal(users[j].CreatedAt) {
+			return users[i].CreatedAt.Before(users[j].CreatedAt)
+		}
+		return users[i].ID < users[j].ID
+	})
+	return users, nil
 }
 
 // Update modifies an existing user's data.
-// It updates Name, Address, NickName, sets UpdatedAt to now and increments Version.
-// Returns ErrNotFound if the user does not exist, or ErrEmptyID if user.ID is empty.
-func (s *Service) Update(id string, user *UpdateFields) (*User, error) {
-	existing, err := s.storage.Read(id)
+// It updates Name, Address, NickName, Email, sets UpdatedAt to now and increments Version.
+// A new email is unverified and gets a verification token, as in Create.
+// Returns ErrNotFound if the user does not exist, ErrEmptyID if user.ID is empty,
+// ErrVersionMismatch if user.Version is set and differs from the stored one,
+// or the error of Address.Validate.
+func (s *Service) Update(ctx context.Context, id string, user *UpdateFields) (*User, error) {
+	var address Address
+	if user.Address != nil {
+		address = user.Address.normalized()
+		if err := address.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	existing, err := s.readForUpdate(ctx, id, user.Version)
 	if err != nil {
 		return nil, err
 	}
+	before := *existing
 
 	if user.Name != nil {
 		existing.Name = *user.Name
 	}
 
 	if user.Address != nil {
-		existing.Address = *user.Address
+		existing.Address = address
 	}
 
 	if user.NickName != nil {
 		existing.NickName = *user.NickName
 	}
 
-	existing.UpdatedAt = time.Now()
+	emailChanged := user.Email != nil && *user.Email != existing.Email
+	if emailChanged {
+		existing.Email = *user.Email
+		existing.EmailVerified = false
+	}
+
+	existing.UpdatedAt = s.clock.Now()
+	existing.Version++
+
+	if err := s.storage.Set(ctx, existing); err != nil {
+		return nil, err
+	}
+
+	s.record(ctx, ActionUpdated, &before, existing)
+	if emailChanged {
+		s.issueVerification(ctx, existing)
+	}
+	return existing, nil
+}
+
+// Replace sets every mutable field of an existing user (Name, Address,
+// NickName and Email) to those of replacement, clearing the ones it leaves
+// empty, sets UpdatedAt to now and increments Version. A new email is
+// unverified and gets a verification token, as in Create.
+// Returns ErrNotFound if the user does not exist, ErrVersionMismatch if
+// version is set and differs from the stored one, or the error of
+// Address.Validate.
+func (s *Service) Replace(ctx context.Context, id string, version *int, replacement *User) (*User, error) {
+	address := replacement.Address.normalized()
+	if err := address.Validate(); err != nil {
+		return nil, err
+	}
+
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	existing, err := s.readForUpdate(ctx, id, version)
+	if err != nil {
+		return nil, err
+	}
+
+	before := *existing
+	emailChanged := replacement.Email != existing.Email
+	existing.Name = replacement.Name
+	existing.Address = address
+	existing.NickName = replacement.NickName
+	existing.Email = replacement.Email
+	if emailChanged {
+		existing.EmailVerified = false
+	}
+	existing.UpdatedAt = s.clock.Now()
 	existing.Version++
 
-	if err := s.storage.Set(existing); err != nil {
+	if err := s.storage.Set(ctx, existing); err != nil {
 		return nil, err
 	}
 
+	s.record(ctx, ActionReplaced, &before, existing)
+	if emailChanged {
+		s.issueVerification(ctx, existing)
+	}
 	return existing, nil
 }
 
+// readForUpdate returns a copy of the stored user id, for the caller to
+// change and Set: the stored one is shared with concurrent readers. A
+// non-nil version must match the stored one, or ErrVersionMismatch is
+// returned. Callers must hold s.updateMu.
+func (s *Service) readForUpdate(ctx context.Context, id string, version *int) (*User, error) {
+	existing, err := s.storage.Read(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if version != nil && *version != existing.Version {
+		return nil, fmt.Errorf("%w: expected version %d, found %d", ErrVersionMismatch, *version, existing.Version)
+	}
+	u := *existing
+	return &u, nil
+}
+
 // Delete removes a user from the system by its ID.
 // Returns ErrNotFound if the user does not exist.
-func (s *Service) Delete(id string) error {
-	return s.storage.Delete(id)
+func (s *Service) Delete(ctx context.Context, id string) error {
+	existing, err := s.storage.Read(ctx, id)
+	if err != nil {
+		return err
+	}
+	before := *existing
+	if err := s.storage.Delete(ctx, id); err != nil {
+		return err
+	}
+	s.forgetVerification(ctx, id)
+	s.record(ctx, ActionDeleted, &before, nil)
+	return nil
 }
@@ -1,8 +1,12 @@
 package user
 
 import (
+	"Ejercicio_Final-Taller_Go/internal/clock"
+	"Ejercicio_Final-Taller_Go/internal/idgen"
+	"context"
 	"errors"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
 	"testing"
 )
 
@@ -11,11 +15,11 @@ func TestService_Create_Simple(t *testing.T) {
 
 	input := &User{
 		Name:     "Ayrton",
-		Address:  "Pringles",
+		Address:  Address{Street: "Pringles"},
 		NickName: "Chiche",
 	}
 
-	err := s.Create(input)
+	err := s.Create(context.Background(), input)
 
 	require.Nil(t, err)
 	require.NotEmpty(t, input.ID)
@@ -29,7 +33,7 @@ func TestService_Create_Simple(t *testing.T) {
 		},
 	}, nil)
 
-	err = s.Create(input)
+	err = s.Create(context.Background(), input)
 	require.NotNil(t, err)
 	require.EqualError(t, err, "fake error trying to set user")
 }
@@ -60,7 +64,7 @@ func TestService_Create(t *testing.T) {
 				},
 			},
 			args: args{
-				user: &User{},
+				user: &User{Name: "Ayrton"},
 			},
 			wantErr: func(t *testing.T, err error) {
 				require.NotNil(t, err)
@@ -68,6 +72,21 @@ func TestService_Create(t *testing.T) {
 			},
 			wantUser: nil,
 		},
+		{
+			name: "invalid",
+			fields: fields{
+				storage: NewLocalStorage(),
+			},
+			args: args{
+				user: &User{Name: "Ayrton", Email: "Ayrton <ayrton@example.com>"},
+			},
+			wantErr: func(t *testing.T, err error) {
+				require.ErrorIs(t, err, ErrInvalidEmail)
+			},
+			wantUser: func(t *testing.T, input *User) {
+				require.Empty(t, input.ID)
+			},
+		},
 		{
 			name: "success",
 			fields: fields{
@@ -76,7 +95,7 @@ func TestService_Create(t *testing.T) {
 			args: args{
 				user: &User{
 					Name:     "Ayrton",
-					Address:  "Pringles",
+					Address:  Address{Street: "Pringles"},
 					NickName: "Chiche",
 				},
 			},
@@ -95,9 +114,12 @@ func TestService_Create(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			s := &Service{
 				storage: tt.fields.storage,
+				logger:  zap.NewNop(),
+				ids:     idgen.UUID(),
+				clock:   clock.System(),
 			}
 
-			err := s.Create(tt.args.user)
+			err := s.Create(context.Background(), tt.args.user)
 			if tt.wantErr != nil {
 				tt.wantErr(t, err)
 			}
@@ -115,14 +137,130 @@ type mockStorage struct {
 	mockDelete func(id string) error
 }
 
-func (m *mockStorage) Set(user *User) error {
+func (m *mockStorage) Set(_ context.Context, user *User) error {
 	return m.mockSet(user)
 }
 
-func (m *mockStorage) Read(id string) (*User, error) {
+func (m *mockStorage) Read(_ context.Context, id string) (*User, error) {
 	return m.mockRead(id)
 }
 
-func (m *mockStorage) Delete(id string) error {
+func (m *mockStorage) Delete(_ context.Context, id string) error {
 	return m.mockDelete(id)
 }
+
+func (m *mockStorage) ReadByExternalID(_ context.Context, _ string) (*User, error) {
+	return nil, ErrNotFound
+}
+
+func (m *mockStorage) List(_ context.Context) ([]*User, error) {
+	return nil, nil
+}
+
+func (m *mockStorage) Ping(_ context.Context) error {
+	return nil
+}
+
+func (m *mockStorage) WithTx(_ context.Context, fn func(tx Storage) error) error {
+	return fn(m)
+}
+
+func TestService_Import(t *testing.T) {
+	storage := NewLocalStorage()
+	s := NewService(storage, zap.NewNop())
+	ctx := context.Background()
+
+	users := []*User{
+		{Name: "Ayrton", Email: "ayrton@example.com"},
+		{Name: " "},
+		{Name: "Chiche", Email: "Chiche <chiche@example.com>"},
+		{Name: "Pringles"},
+	}
+	for i := 0; i < importBatchSize; i++ {
+		users = append(users, &User{Name: "bulk"})
+	}
+
+	results := s.Import(ctx, users)
+	require.Len(t, results, len(users))
+	require.NoError(t, results[0].Err)
+	require.NotEmpty(t, results[0].User.ID)
+	require.ErrorIs(t, results[1].Err, ErrNameRequired)
+	require.ErrorIs(t, results[2].Err, ErrInvalidEmail)
+	require.Equal(t, 3, results[2].Row)
+
+	stored, err := storage.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, stored, len(users)-2)
+}
+
+func TestService_Update_Version(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(NewLocalStorage(), zap.NewNop())
+	u := &User{Name: "Ayrton"}
+	require.NoError(t, s.Create(ctx, u))
+
+	name := "Senna"
+	stale := 1
+	updated, err := s.Update(ctx, u.ID, &UpdateFields{Name: &name, Version: &stale})
+	require.NoError(t, err)
+	require.Equal(t, 2, updated.Version)
+
+	// otra edición que leyó la versión 1 no pisa la anterior
+	other := "Prost"
+	_, err = s.Update(ctx, u.ID, &UpdateFields{Name: &other, Version: &stale})
+	require.ErrorIs(t, err, ErrVersionMismatch)
+	got, err := s.Get(ctx, u.ID)
+	require.NoError(t, err)
+	require.Equal(t, "Senna", got.Name)
+}
+
+func TestService_Replace_Version(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(NewLocalStorage(), zap.NewNop())
+	u := &User{Name: "Ayrton"}
+	require.NoError(t, s.Create(ctx, u))
+	read, err := s.Get(ctx, u.ID)
+	require.NoError(t, err)
+
+	stale := 1
+	replaced, err := s.Replace(ctx, u.ID, &stale, &User{Name: "Senna"})
+	require.NoError(t, err)
+	require.Equal(t, 2, replaced.Version)
+	// lo leído antes no cambia por debajo
+	require.Equal(t, "Ayrton", read.Name)
+	require.Equal(t, 1, read.Version)
+
+	_, err = s.Replace(ctx, u.ID, &stale, &User{Name: "Prost"})
+	require.ErrorIs(t, err, ErrVersionMismatch)
+	_, err = s.Block(ctx, u.ID, &stale, "fraud", "admin")
+	require.ErrorIs(t, err, ErrVersionMismatch)
+	got, err := s.Get(ctx, u.ID)
+	require.NoError(t, err)
+	require.Equal(t, "Senna", got.Name)
+	require.False(t, got.Blocked)
+}
+
+func TestService_CreateOrGet(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(NewLocalStorage(), zap.NewNop())
+
+	first, created, err := s.CreateOrGet(ctx, &User{Name: "Ayrton", ExternalID: "crm-1"})
+	require.NoError(t, err)
+	require.True(t, created)
+
+	// el reintento del job de sincronización devuelve el mismo usuario
+	again, created, err := s.CreateOrGet(ctx, &User{Name: "Senna", ExternalID: "crm-1"})
+	require.NoError(t, err)
+	require.False(t, created)
+	require.Equal(t, first.ID, again.ID)
+	require.Equal(t, "Ayrton", again.Name)
+
+	other, created, err := s.CreateOrGet(ctx, &User{Name: "Prost"})
+	require.NoError(t, err)
+	require.True(t, created)
+	require.NotEqual(t, first.ID, other.ID)
+
+	users, err := s.storage.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+}
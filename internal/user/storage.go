@@ -1,62 +1,65 @@
 package user
 
-import "errors"
+import (
+	"context"
+
+	"Ejercicio_Final-Taller_Go/internal/apperrors"
+	"Ejercicio_Final-Taller_Go/internal/repo"
+)
 
 // ErrNotFound is returned when a user with the given ID is not found.
-var ErrNotFound = errors.New("user not found")
+var ErrNotFound = apperrors.New(apperrors.NotFound, "user_not_found", "user not found")
+
+// ErrVersionMismatch is returned when updating a user that changed since
+// the caller read it, so that concurrent edits do not overwrite each other.
+var ErrVersionMismatch = apperrors.New(apperrors.Conflict, "user_version_mismatch", "the user was modified since it was read")
 
 // ErrEmptyID is returned when trying to store a user with an empty ID.
-var ErrEmptyID = errors.New("empty user ID")
+var ErrEmptyID = apperrors.New(apperrors.Internal, "empty_user_id", "empty user ID")
 
 // Storage is the main interface for our storage layer.
+// Every operation is scoped to the tenant carried by ctx (see package tenant).
 type Storage interface {
-	Set(user *User) error
-	Read(id string) (*User, error)
-	Delete(id string) error
+	Set(ctx context.Context, user *User) error
+	Read(ctx context.Context, id string) (*User, error)
+	Delete(ctx context.Context, id string) error
+	List(ctx context.Context) ([]*User, error)
+	// ReadByExternalID returns the user with the given ExternalID, or ErrNotFound.
+	ReadByExternalID(ctx context.Context, externalID string) (*User, error)
+	Ping(ctx context.Context) error
+	// WithTx runs fn with a Storage whose writes are committed together if
+	// fn returns nil and rolled back otherwise, returning fn's error.
+	// Storages without transactions run fn on themselves.
+	WithTx(ctx context.Context, fn func(tx Storage) error) error
 }
 
-// LocalStorage provides an in-memory implementation for storing users.
+// LocalStorage provides an in-memory implementation for storing users,
+// partitioned by tenant. It is safe for concurrent use.
 type LocalStorage struct {
-	m map[string]*User
+	*repo.Repository[*User]
 }
 
+// externalIDIndex finds users by their ExternalID.
+const externalIDIndex = "external_id"
+
 // NewLocalStorage instantiates a new LocalStorage with an empty map.
 func NewLocalStorage() *LocalStorage {
 	return &LocalStorage{
-		m: map[string]*User{},
+		Repository: repo.New(ErrNotFound, ErrEmptyID, repo.Index[*User]{
+			Name: externalIDIndex,
+			Key:  func(u *User) string { return u.ExternalID },
+		}),
 	}
 }
 
-// Set stores or updates a user in the local storage.
-// Returns ErrEmptyID if the user has an empty ID.
-func (l *LocalStorage) Set(user *User) error {
-	if user.ID == "" {
-		return ErrEmptyID
-	}
-
-	l.m[user.ID] = user
-	return nil
+// ReadByExternalID retrieves a user by the ID it has in an external system.
+// Returns ErrNotFound if no user has that external ID.
+func (l *LocalStorage) ReadByExternalID(ctx context.Context, externalID string) (*User, error) {
+	return l.ReadBy(ctx, externalIDIndex, externalID)
 }
 
-// Read retrieves a user from the local storage by ID.
-// Returns ErrNotFound if the user is not found.
-func (l *LocalStorage) Read(id string) (*User, error) {
-	u, ok := l.m[id]
-	if !ok {
-		return nil, ErrNotFound
-	}
-
-	return u, nil
-}
-
-// Delete removes a user from the local storage by ID.
-// Returns ErrNotFound if the user does not exist.
-func (l *LocalStorage) Delete(id string) error {
-	_, err := l.Read(id)
-	if err != nil {
-		return err
-	}
-
-	delete(l.m, id)
-	return nil
+// WithTx runs fn on l itself: the in-memory storage has no transactions,
+// and writes made before fn fails are kept.
+func (l *LocalStorage) WithTx(ctx context.Context, fn func(tx Storage) error) error {
+	return fn(l)
 }
@@ -0,0 +1,158 @@
+// Package usertest provides builders, pre-seeded storages and a mock user
+// API server for tests of code that works with users.
+package usertest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+	"Ejercicio_Final-Taller_Go/internal/user"
+)
+
+// Now is the creation time of built users.
+var Now = time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+
+// seq numbers the users built without an explicit ID.
+var seq atomic.Int64
+
+// UserBuilder builds a User field by field, starting from a valid user with
+// a unique ID. Each With method sets the field of the same name.
+type UserBuilder struct {
+	user user.User
+}
+
+// NewUserBuilder starts a user with the defaults.
+func NewUserBuilder() *UserBuilder {
+	n := seq.Add(1)
+	return &UserBuilder{user: user.User{
+		ID:        fmt.Sprintf("user-%d", n),
+		Name:      "Ayrton",
+		Address:   user.Address{Street: "Calle Falsa 123", City: "Springfield", Country: "AR"},
+		NickName:  "ayrton",
+		Email:     fmt.Sprintf("user%d@example.com", n),
+		CreatedAt: Now,
+		UpdatedAt: Now,
+		Version:   1,
+	}}
+}
+
+func (b *UserBuilder) WithID(id string) *UserBuilder {
+	b.user.ID = id
+	return b
+}
+
+func (b *UserBuilder) WithName(name string) *UserBuilder {
+	b.user.Name = name
+	return b
+}
+
+func (b *UserBuilder) WithAddress(address user.Address) *UserBuilder {
+	b.user.Address = address
+	return b
+}
+
+func (b *UserBuilder) WithNickName(nickname string) *UserBuilder {
+	b.user.NickName = nickname
+	return b
+}
+
+func (b *UserBuilder) WithEmail(email string) *UserBuilder {
+	b.user.Email = email
+	return b
+}
+
+// Build returns a new copy of the user, so a builder can be reused as a template.
+func (b *UserBuilder) Build() *user.User {
+	u := b.user
+	return &u
+}
+
+// NewStorage returns a LocalStorage holding the given users in the default
+// tenant, failing tb on error.
+func NewStorage(tb testing.TB, seed ...*user.User) *user.LocalStorage {
+	tb.Helper()
+	storage := user.NewLocalStorage()
+	for _, u := range seed {
+		if err := storage.Set(context.Background(), u); err != nil {
+			tb.Fatalf("seeding user %s: %v", u.ID, err)
+		}
+	}
+	return storage
+}
+
+// Server is a mock of the user API: it answers GET /users/:id with the
+// users it was given, per tenant, 404 for the rest, and GET /ping. It is
+// closed when the test ends.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	users    map[string]*user.User // tenant + ID -> user
+	status   int                   // si no es cero se responde siempre con este estado
+	requests atomic.Int64
+}
+
+// NewServer starts a Server that knows the given users in the default tenant.
+func NewServer(tb testing.TB, users ...*user.User) *Server {
+	s := &Server{users: map[string]*user.User{}}
+	for _, u := range users {
+		s.Add(tenant.Default, u)
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	tb.Cleanup(s.Close)
+	return s
+}
+
+// Add makes u known in the tenant named tenantID.
+func (s *Server) Add(tenantID string, u *user.User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[tenantID+"/"+u.ID] = u
+}
+
+// Fail makes every later request, /ping included, answer with status, to
+// simulate an outage; 0 restores normal answers.
+func (s *Server) Fail(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+// Requests returns how many requests the server received.
+func (s *Server) Requests() int {
+	return int(s.requests.Load())
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.requests.Add(1)
+
+	s.mu.Lock()
+	status := s.status
+	t := r.Header.Get(tenant.Header)
+	if t == "" {
+		t = tenant.Default
+	}
+	u, ok := s.users[t+"/"+strings.TrimPrefix(r.URL.Path, "/users/")]
+	s.mu.Unlock()
+
+	switch {
+	case status != 0:
+		w.WriteHeader(status)
+	case r.URL.Path == "/ping":
+		w.WriteHeader(http.StatusOK)
+	case !strings.HasPrefix(r.URL.Path, "/users/") || !ok:
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(u)
+	}
+}
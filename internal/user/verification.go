@@ -0,0 +1,129 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"sync"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/apperrors"
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+
+	"go.uber.org/zap"
+)
+
+// ErrInvalidVerification is returned by Verify for a token that was not
+// issued for the user's current email, has expired or was already used.
+var ErrInvalidVerification = apperrors.New(apperrors.Validation, "invalid_verification", "invalid or expired verification token")
+
+// VerificationSender delivers to u the token that verifies its email, e.g.
+// by email. It should not block on the delivery itself.
+type VerificationSender func(ctx context.Context, u *User, token string) error
+
+// WithVerification issues a verification token, valid for ttl, whenever a
+// user gets a new email, and delivers it through send. Without it emails
+// are never verified.
+func WithVerification(send VerificationSender, ttl time.Duration) Option {
+	return func(s *Service) {
+		s.verifications = &verifications{send: send, ttl: ttl, pending: map[string]pendingVerification{}}
+	}
+}
+
+// verifications are the tokens issued and not used yet. They are kept in
+// memory: a restart invalidates them and users must ask for a new email.
+type verifications struct {
+	send VerificationSender
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	pending map[string]pendingVerification // tenant + user ID -> token
+}
+
+// pendingVerification is an issued token, of which only the hash is kept.
+type pendingVerification struct {
+	digest  [sha256.Size]byte
+	email   string
+	expires time.Time
+}
+
+// issueVerification sends u a new token for its email, replacing any
+// earlier one. Failures are logged, not returned: the user is stored
+// already and stays unverified until a new token reaches them.
+func (s *Service) issueVerification(ctx context.Context, u *User) {
+	v := s.verifications
+	if v == nil || u.Email == "" {
+		return
+	}
+
+	token := rand.Text()
+	v.mu.Lock()
+	v.pending[verificationKey(ctx, u.ID)] = pendingVerification{
+		digest:  sha256.Sum256([]byte(token)),
+		email:   u.Email,
+		expires: s.clock.Now().Add(v.ttl),
+	}
+	v.mu.Unlock()
+
+	if err := v.send(ctx, u, token); err != nil {
+		s.log(ctx).Warn("failed to send verification token", zap.String("user_id", u.ID), zap.Error(err))
+	}
+}
+
+// Verify marks the email of the user with the given ID as verified if
+// token is the latest one issued for it, sets UpdatedAt to now and
+// increments Version. Each token can be used once.
+// Returns ErrNotFound if the user does not exist, ErrVersionMismatch if
+// version is set and differs from the stored one, or ErrInvalidVerification.
+func (s *Service) Verify(ctx context.Context, id string, version *int, token string) (*User, error) {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	existing, err := s.readForUpdate(ctx, id, version)
+	if err != nil {
+		return nil, err
+	}
+
+	v := s.verifications
+	if v == nil {
+		return nil, ErrInvalidVerification
+	}
+	key := verificationKey(ctx, id)
+	v.mu.Lock()
+	p, ok := v.pending[key]
+	digest := sha256.Sum256([]byte(token))
+	ok = ok && subtle.ConstantTimeCompare(p.digest[:], digest[:]) == 1
+	if ok {
+		delete(v.pending, key)
+	}
+	v.mu.Unlock()
+	// un token emitido para un email anterior no verifica el actual
+	if !ok || p.email != existing.Email || !s.clock.Now().Before(p.expires) {
+		return nil, ErrInvalidVerification
+	}
+
+	before := *existing
+	existing.EmailVerified = true
+	existing.UpdatedAt = s.clock.Now()
+	existing.Version++
+	if err := s.storage.Set(ctx, existing); err != nil {
+		return nil, err
+	}
+	s.record(ctx, ActionVerified, &before, existing)
+	return existing, nil
+}
+
+// forgetVerification drops the pending token of the user with the given ID.
+func (s *Service) forgetVerification(ctx context.Context, id string) {
+	if v := s.verifications; v != nil {
+		v.mu.Lock()
+		delete(v.pending, verificationKey(ctx, id))
+		v.mu.Unlock()
+	}
+}
+
+// verificationKey scopes a user ID to the tenant in ctx.
+func verificationKey(ctx context.Context, id string) string {
+	return tenant.FromContext(ctx) + "/" + id
+}
@@ -0,0 +1,57 @@
+package user
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/clock"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestService_Verify(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	clk := clock.NewManual(now)
+	sent := map[string]string{} // email -> último token
+	send := func(_ context.Context, u *User, token string) error {
+		sent[u.Email] = token
+		return nil
+	}
+	s := NewService(NewLocalStorage(), zap.NewNop(), WithClock(clk), WithVerification(send, time.Hour))
+
+	u := &User{Name: "Ayrton", Email: "ayrton@example.com"}
+	require.NoError(t, s.Create(ctx, u))
+	require.False(t, u.EmailVerified)
+	require.NotEmpty(t, sent["ayrton@example.com"])
+
+	_, err := s.Verify(ctx, u.ID, nil, "wrong")
+	require.ErrorIs(t, err, ErrInvalidVerification)
+
+	verified, err := s.Verify(ctx, u.ID, nil, sent["ayrton@example.com"])
+	require.NoError(t, err)
+	require.True(t, verified.EmailVerified)
+	require.Equal(t, 2, verified.Version)
+
+	// cada token sirve una sola vez
+	_, err = s.Verify(ctx, u.ID, nil, sent["ayrton@example.com"])
+	require.ErrorIs(t, err, ErrInvalidVerification)
+
+	// un email nuevo vuelve a estar sin verificar, y el token anterior no lo verifica
+	email := "senna@example.com"
+	updated, err := s.Update(ctx, u.ID, &UpdateFields{Email: &email})
+	require.NoError(t, err)
+	require.False(t, updated.EmailVerified)
+	_, err = s.Verify(ctx, u.ID, nil, sent["ayrton@example.com"])
+	require.ErrorIs(t, err, ErrInvalidVerification)
+
+	// los tokens vencen
+	clk.Advance(2 * time.Hour)
+	_, err = s.Verify(ctx, u.ID, nil, sent[email])
+	require.ErrorIs(t, err, ErrInvalidVerification)
+
+	_, err = s.Verify(ctx, "missing", nil, "token")
+	require.ErrorIs(t, err, ErrNotFound)
+}
@@ -0,0 +1,148 @@
+package userapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"Ejercicio_Final-Taller_Go/internal/apikey"
+	"Ejercicio_Final-Taller_Go/internal/apperrors"
+	"Ejercicio_Final-Taller_Go/internal/discovery"
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+)
+
+// ErrNotFound is returned when the user API does not know the requested user.
+var ErrNotFound = apperrors.New(apperrors.NotFound, "user_not_found", "user not found")
+
+// User is the subset of the user API representation the sales side needs.
+type User struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// Client reads users from the user API over HTTP.
+type Client struct {
+	endpoints discovery.Endpoints
+	http      *http.Client
+	apiKey    string
+}
+
+// Option configures optional settings of a Client.
+type Option func(*Client)
+
+// WithAPIKey authenticates the calls to the user API with the given key.
+func WithAPIKey(secret string) Option {
+	return func(c *Client) {
+		c.apiKey = secret
+	}
+}
+
+// NewClient creates a Client for the user API at baseURL.
+// A nil httpClient uses http.DefaultClient.
+func NewClient(baseURL string, httpClient *http.Client, opts ...Option) *Client {
+	return NewBalancedClient(discovery.Static(baseURL), httpClient, opts...)
+}
+
+// NewBalancedClient creates a Client that spreads calls across the user API
+// instances of endpoints. A nil httpClient uses http.DefaultClient.
+func NewBalancedClient(endpoints discovery.Endpoints, httpClient *http.Client, opts ...Option) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	c := &Client{
+		endpoints: endpoints,
+		http:      httpClient,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// do sends a GET for path to the next user API instance, marking the
+// instance as failed when it cannot be reached or answers a 5xx.
+func (c *Client) do(ctx context.Context, path string) (*http.Response, error) {
+	baseURL, err := c.endpoints.Pick()
+	if err != nil {
+		return nil, fmt.Errorf("error resolving user API: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error building request to user API: %w", err)
+	}
+	req.Header.Set(tenant.Header, tenant.FromContext(ctx))
+	if c.apiKey != "" {
+		req.Header.Set(apikey.Header, c.apiKey)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if ctx.Err() == nil {
+			c.endpoints.MarkFailed(baseURL)
+		}
+		return nil, fmt.Errorf("error making request to user API: %w", err)
+	}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		c.endpoints.MarkFailed(baseURL)
+	}
+	return resp, nil
+}
+
+// GetUser fetches a user in the tenant of ctx.
+// Returns ErrNotFound if the user API answers 404.
+func (c *Client) GetUser(ctx context.Context, id string) (*User, error) {
+	resp, err := c.do(ctx, "/users/"+url.PathEscape(id))
+	if err != nil {
+		return nil, err
+	}
+	defer drain(resp)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrNotFound
+	default:
+		return nil, fmt.Errorf("user API returned unexpected status: %d", resp.StatusCode)
+	}
+
+	var u User
+	if err := json.NewDecoder(resp.Body).Decode(&u); err != nil {
+		return nil, fmt.Errorf("error decoding user API response: %w", err)
+	}
+	return &u, nil
+}
+
+// Ping checks that the user API is up through its /ping endpoint.
+func (c *Client) Ping(ctx context.Context) error {
+	resp, err := c.do(ctx, "/ping")
+	if err != nil {
+		return err
+	}
+	defer drain(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("user API returned unexpected status: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Email returns the email address of a user, implementing notify.UserDirectory.
+func (c *Client) Email(ctx context.Context, userID string) (string, error) {
+	u, err := c.GetUser(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	return u.Email, nil
+}
+
+// drain discards what is left of the body and closes it so the connection
+// goes back to the pool.
+func drain(resp *http.Response) {
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+}
@@ -0,0 +1,106 @@
+package webhook
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/apperrors"
+	"Ejercicio_Final-Taller_Go/internal/sales"
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+)
+
+// ErrInvalidOutcome is returned when filtering deliveries by an unknown outcome.
+var ErrInvalidOutcome = apperrors.New(apperrors.Validation, "invalid_delivery_outcome", "invalid delivery outcome")
+
+// Outcome is how a delivery attempt ended.
+type Outcome string
+
+const (
+	// OutcomeSucceeded is an attempt answered with a 2xx status.
+	OutcomeSucceeded Outcome = "succeeded"
+	// OutcomeFailed is an attempt that could not be made, or was answered
+	// with any other status.
+	OutcomeFailed Outcome = "failed"
+)
+
+// maxExcerpt caps the bytes of a response body kept with its attempt.
+const maxExcerpt = 1024
+
+// maxLoggedAttempts is how many attempts are kept per subscription.
+const maxLoggedAttempts = 100
+
+// Attempt is one try at posting an event to a subscription.
+type Attempt struct {
+	ID        string          `json:"id"`
+	WebhookID string          `json:"webhook_id"`
+	EventID   string          `json:"event_id"`
+	EventType sales.EventType `json:"event_type"`
+	// Attempt counts the tries of the event, from 1.
+	Attempt   int       `json:"attempt"`
+	Outcome   Outcome   `json:"outcome"`
+	At        time.Time `json:"at"`
+	LatencyMS int64     `json:"latency_ms"`
+	// StatusCode and ResponseBody, cut to its first bytes, are those of the
+	// response, if there was one, and Error tells why the attempt failed.
+	StatusCode   int    `json:"status_code,omitempty"`
+	ResponseBody string `json:"response_body,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// DeliveryLog keeps the delivery attempts of every tenant, scoped by the
+// tenant in ctx.
+type DeliveryLog interface {
+	Record(ctx context.Context, a Attempt) error
+	// List returns the attempts of a subscription, newest first, only those
+	// with the given outcome unless it is empty.
+	List(ctx context.Context, webhookID string, outcome Outcome) ([]Attempt, error)
+	// Delete drops the attempts of a subscription.
+	Delete(ctx context.Context, webhookID string) error
+}
+
+// LocalDeliveryLog keeps the last attempts of each subscription in memory.
+// It is safe for concurrent use.
+type LocalDeliveryLog struct {
+	mu       sync.Mutex
+	attempts map[string][]Attempt // tenant + "/" + webhook -> attempts, oldest first
+}
+
+// NewLocalDeliveryLog creates an empty LocalDeliveryLog.
+func NewLocalDeliveryLog() *LocalDeliveryLog {
+	return &LocalDeliveryLog{attempts: map[string][]Attempt{}}
+}
+
+func (l *LocalDeliveryLog) Record(ctx context.Context, a Attempt) error {
+	key := tenant.FromContext(ctx) + "/" + a.WebhookID
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	attempts := append(l.attempts[key], a)
+	if len(attempts) > maxLoggedAttempts {
+		attempts = slices.Delete(attempts, 0, len(attempts)-maxLoggedAttempts)
+	}
+	l.attempts[key] = attempts
+	return nil
+}
+
+func (l *LocalDeliveryLog) List(ctx context.Context, webhookID string, outcome Outcome) ([]Attempt, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	attempts := l.attempts[tenant.FromContext(ctx)+"/"+webhookID]
+	out := make([]Attempt, 0, len(attempts))
+	for i := len(attempts) - 1; i >= 0; i-- {
+		if outcome == "" || attempts[i].Outcome == outcome {
+			out = append(out, attempts[i])
+		}
+	}
+	return out, nil
+}
+
+func (l *LocalDeliveryLog) Delete(ctx context.Context, webhookID string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.attempts, tenant.FromContext(ctx)+"/"+webhookID)
+	return nil
+}
@@ -0,0 +1,434 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/clock"
+	"Ejercicio_Final-Taller_Go/internal/idgen"
+	"Ejercicio_Final-Taller_Go/internal/sales"
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+
+	"go.uber.org/zap"
+)
+
+// ErrQueueFull is returned when an event cannot be queued for delivery.
+var ErrQueueFull = errors.New("webhook queue is full")
+
+// Dispatcher keeps the subscriptions of every tenant and posts sale events
+// to them in the background, retrying failed deliveries with exponential
+// backoff. Only public addresses are subscribed to and connected to,
+// unless WithPrivateTargets. It is safe for concurrent use.
+type Dispatcher struct {
+	store       Store
+	log         DeliveryLog
+	http        *http.Client
+	clock       clock.Clock
+	ids         idgen.Generator
+	logger      *zap.Logger
+	maxAttempts int
+	backoff     time.Duration
+	grace       time.Duration // vigencia del secreto anterior tras rotarlo
+	workers     int
+
+	resolver       *net.Resolver
+	privateTargets bool
+
+	jobs chan delivery
+	done chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
+}
+
+// delivery is a payload waiting to be posted to a subscription.
+type delivery struct {
+	sub         *Subscription
+	tenant      string
+	eventID     string
+	eventType   sales.EventType
+	body        []byte
+	contentType string
+	attempt     int
+}
+
+// Option configures optional dependencies of a Dispatcher.
+type Option func(*Dispatcher)
+
+// WithHTTPClient sets the client deliveries are posted with. Defaults to
+// a client with a 10 second timeout. Its transport is replaced by one that
+// only connects to public addresses, unless WithPrivateTargets.
+func WithHTTPClient(c *http.Client) Option {
+	return func(d *Dispatcher) {
+		d.http = c
+	}
+}
+
+// WithClock sets the clock that dates the subscriptions and events.
+// Defaults to the system clock.
+func WithClock(c clock.Clock) Option {
+	return func(d *Dispatcher) {
+		d.clock = c
+	}
+}
+
+// WithIDGenerator sets the generator of subscription and event IDs.
+// Defaults to UUIDs.
+func WithIDGenerator(ids idgen.Generator) Option {
+	return func(d *Dispatcher) {
+		d.ids = ids
+	}
+}
+
+// WithRetries sets how many times a delivery is tried, and the delay
+// before the first retry, doubled on every retry. Defaults to 5 attempts
+// from one second.
+func WithRetries(maxAttempts int, backoff time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.maxAttempts, d.backoff = maxAttempts, backoff
+	}
+}
+
+// WithDeliveryLog sets where delivery attempts are kept. Defaults to a
+// LocalDeliveryLog.
+func WithDeliveryLog(log DeliveryLog) Option {
+	return func(d *Dispatcher) {
+		d.log = log
+	}
+}
+
+// WithSecretGrace sets how long a rotated secret keeps signing deliveries
+// next to the new one, for consumers to switch. Defaults to 24 hours.
+func WithSecretGrace(grace time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.grace = grace
+	}
+}
+
+// WithWorkers sets how many deliveries are posted at once, so a slow
+// endpoint does not hold up the others. Defaults to 4.
+func WithWorkers(n int) Option {
+	return func(d *Dispatcher) {
+		d.workers = n
+	}
+}
+
+// WithPrivateTargets allows subscriptions and deliveries to loopback,
+// private and link-local addresses, and leaves the hosts of subscriptions
+// unresolved. Meant for development and tests, whose endpoints are local.
+func WithPrivateTargets() Option {
+	return func(d *Dispatcher) {
+		d.privateTargets = true
+	}
+}
+
+// New creates a Dispatcher of the subscriptions in store and starts its
+// delivery workers, buffering up to size deliveries.
+func New(store Store, size int, logger *zap.Logger, opts ...Option) *Dispatcher {
+	d := &Dispatcher{
+		store:       store,
+		log:         NewLocalDeliveryLog(),
+		http:        &http.Client{Timeout: 10 * time.Second},
+		clock:       clock.System(),
+		ids:         idgen.UUID(),
+		logger:      logger,
+		maxAttempts: 5,
+		backoff:     time.Second,
+		grace:       24 * time.Hour,
+		workers:     4,
+		resolver:    net.DefaultResolver,
+		jobs:        make(chan delivery, size),
+		done:        make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	if !d.privateTargets {
+		client := *d.http
+		client.Transport = publicTransport()
+		d.http = &client
+	}
+
+	for range max(d.workers, 1) {
+		d.wg.Add(1)
+		go d.work()
+	}
+	return d
+}
+
+// Validate checks sub as Subscribe would, without storing it: its fields,
+// and that its host only resolves to public addresses.
+// Returns ErrInvalidSubscription.
+func (d *Dispatcher) Validate(ctx context.Context, sub Subscription) error {
+	return d.validate(ctx, &sub)
+}
+
+// validate checks sub and fills in its defaults.
+func (d *Dispatcher) validate(ctx context.Context, sub *Subscription) error {
+	if err := sub.normalize(); err != nil {
+		return err
+	}
+	return d.checkTarget(ctx, sub.URL)
+}
+
+// Subscribe validates sub, fills in its defaults and stores it as a new
+// subscription of the tenant in ctx, with a new signing secret. The secret
+// is returned so it can be shown to the caller once.
+// Returns ErrInvalidSubscription.
+func (d *Dispatcher) Subscribe(ctx context.Context, sub Subscription) (*Subscription, string, error) {
+	if err := d.validate(ctx, &sub); err != nil {
+		return nil, "", err
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	sub.ID, sub.CreatedAt = d.ids.NewID(), d.clock.Now()
+	sub.Secret, sub.PreviousSecret, sub.PreviousSecretExpiresAt = secret, "", nil
+	if err := d.store.Save(ctx, &sub); err != nil {
+		return nil, "", err
+	}
+	d.logger.Info("webhook subscribed", zap.String("webhook_id", sub.ID), zap.String("format", string(sub.Format)))
+	return &sub, secret, nil
+}
+
+// Upsert stores sub in the tenant in ctx as Subscribe does, unless the
+// tenant already has a subscription to its URL: that one is then given the
+// events, format and template of sub, keeping its ID and secrets. The
+// secret is only returned for new subscriptions. Returns ErrInvalidSubscription.
+func (d *Dispatcher) Upsert(ctx context.Context, sub Subscription) (*Subscription, string, error) {
+	subs, err := d.store.List(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	var existing *Subscription
+	for _, s := range subs {
+		if s.URL == sub.URL {
+			existing = s
+			break
+		}
+	}
+	if existing == nil {
+		return d.Subscribe(ctx, sub)
+	}
+
+	if err := d.validate(ctx, &sub); err != nil {
+		return nil, "", err
+	}
+	existing.Events, existing.Format, existing.SchemaVersion = sub.Events, sub.Format, sub.SchemaVersion
+	existing.Template, existing.ContentType = sub.Template, sub.ContentType
+	if err := d.store.Save(ctx, existing); err != nil {
+		return nil, "", err
+	}
+	d.logger.Info("webhook updated", zap.String("webhook_id", existing.ID), zap.String("format", string(existing.Format)))
+	return existing, "", nil
+}
+
+// RotateSecret gives a subscription of the tenant in ctx a new signing
+// secret, which is returned. The replaced one keeps signing deliveries next
+// to it for the grace period (see WithSecretGrace). Returns ErrNotFound.
+func (d *Dispatcher) RotateSecret(ctx context.Context, id string) (*Subscription, string, error) {
+	sub, err := d.store.Get(ctx, id)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	expires := d.clock.Now().Add(d.grace)
+	sub.Secret, sub.PreviousSecret, sub.PreviousSecretExpiresAt = secret, sub.Secret, &expires
+	if err := d.store.Save(ctx, sub); err != nil {
+		return nil, "", err
+	}
+	d.logger.Info("webhook secret rotated", zap.String("webhook_id", sub.ID), zap.Time("previous_expires_at", expires))
+	return sub, secret, nil
+}
+
+// Get returns a subscription of the tenant in ctx. Returns ErrNotFound.
+func (d *Dispatcher) Get(ctx context.Context, id string) (*Subscription, error) {
+	return d.store.Get(ctx, id)
+}
+
+// List returns the subscriptions of the tenant in ctx, oldest first.
+func (d *Dispatcher) List(ctx context.Context) ([]*Subscription, error) {
+	return d.store.List(ctx)
+}
+
+// Unsubscribe deletes a subscription of the tenant in ctx, with its
+// delivery attempts. Deliveries already queued are still made.
+// Returns ErrNotFound.
+func (d *Dispatcher) Unsubscribe(ctx context.Context, id string) error {
+	if err := d.store.Delete(ctx, id); err != nil {
+		return err
+	}
+	if err := d.log.Delete(ctx, id); err != nil {
+		return err
+	}
+	d.logger.Info("webhook unsubscribed", zap.String("webhook_id", id))
+	return nil
+}
+
+// Deliveries returns the delivery attempts of a subscription of the tenant
+// in ctx, newest first, only those with the given outcome unless it is
+// empty. Returns ErrNotFound and ErrInvalidOutcome.
+func (d *Dispatcher) Deliveries(ctx context.Context, id string, outcome Outcome) ([]Attempt, error) {
+	if outcome != "" && outcome != OutcomeSucceeded && outcome != OutcomeFailed {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidOutcome, outcome)
+	}
+	if _, err := d.store.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	return d.log.List(ctx, id, outcome)
+}
+
+// Hook returns a sales hook queueing every event for the subscriptions of
+// its tenant that want it, each rendered in the subscription's format.
+func (d *Dispatcher) Hook() sales.Hook {
+	return func(ctx context.Context, e sales.Event) {
+		subs, err := d.store.List(ctx)
+		if err != nil {
+			d.logger.Error("failed to list webhooks", zap.String("sale_id", e.Sale.ID), zap.Error(err))
+			return
+		}
+
+		p := Payload{
+			ID:             d.ids.NewID(),
+			Type:           e.Type,
+			OccurredAt:     e.Sale.UpdatedAt,
+			Tenant:         tenant.FromContext(ctx),
+			Sale:           e.Sale,
+			PreviousStatus: e.PreviousStatus,
+		}
+		for _, sub := range subs {
+			if !sub.wants(e.Type) {
+				continue
+			}
+			p.SchemaVersion = sub.SchemaVersion
+			body, contentType, err := render(sub, p, e.Previous)
+			if err != nil {
+				d.logger.Warn("failed to render webhook payload", zap.String("webhook_id", sub.ID), zap.String("sale_id", e.Sale.ID), zap.Error(err))
+				continue
+			}
+			if err := d.enqueue(delivery{sub: sub, tenant: p.Tenant, eventID: p.ID, eventType: e.Type, body: body, contentType: contentType, attempt: 1}); err != nil {
+				d.logger.Warn("webhook delivery dropped", zap.String("webhook_id", sub.ID), zap.String("sale_id", e.Sale.ID), zap.Error(err))
+			}
+		}
+	}
+}
+
+// enqueue schedules j without blocking.
+func (d *Dispatcher) enqueue(j delivery) error {
+	select {
+	case d.jobs <- j:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Close stops the workers. Deliveries still buffered or waiting for a retry
+// are dropped.
+func (d *Dispatcher) Close() {
+	d.once.Do(func() { close(d.done) })
+	d.wg.Wait()
+}
+
+func (d *Dispatcher) work() {
+	defer d.wg.Done()
+
+	for {
+		select {
+		case <-d.done:
+			return
+		case j := <-d.jobs:
+			d.deliver(j)
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(j delivery) {
+	started := d.clock.Now()
+	status, excerpt, err := d.post(j)
+	d.record(j, started, status, excerpt, err)
+	if err == nil {
+		return
+	}
+
+	if j.attempt >= d.maxAttempts {
+		d.logger.Error("webhook delivery dropped after max attempts", zap.String("webhook_id", j.sub.ID),
+			zap.String("event_id", j.eventID), zap.Int("attempts", j.attempt), zap.Error(err))
+		return
+	}
+
+	delay := d.backoff << (j.attempt - 1)
+	d.logger.Warn("webhook delivery failed, retrying", zap.String("webhook_id", j.sub.ID), zap.Int("attempt", j.attempt),
+		zap.Duration("retry_in", delay), zap.Error(err))
+
+	j.attempt++
+	time.AfterFunc(delay, func() {
+		select {
+		case d.jobs <- j:
+		case <-d.done:
+		}
+	})
+}
+
+// record keeps the attempt at j started at started in the delivery log.
+func (d *Dispatcher) record(j delivery, started time.Time, status int, excerpt string, err error) {
+	a := Attempt{
+		ID:           d.ids.NewID(),
+		WebhookID:    j.sub.ID,
+		EventID:      j.eventID,
+		EventType:    j.eventType,
+		Attempt:      j.attempt,
+		Outcome:      OutcomeSucceeded,
+		At:           started,
+		LatencyMS:    d.clock.Now().Sub(started).Milliseconds(),
+		StatusCode:   status,
+		ResponseBody: excerpt,
+	}
+	if err != nil {
+		a.Outcome, a.Error = OutcomeFailed, err.Error()
+	}
+	if err := d.log.Record(tenant.WithID(context.Background(), j.tenant), a); err != nil {
+		d.logger.Warn("failed to record webhook delivery", zap.String("webhook_id", j.sub.ID), zap.Error(err))
+	}
+}
+
+// post makes one attempt at delivering j, and returns the status and the
+// start of the body of the response, if there was one.
+func (d *Dispatcher) post(j delivery) (int, string, error) {
+	req, err := http.NewRequest(http.MethodPost, j.sub.URL, bytes.NewReader(j.body))
+	if err != nil {
+		return 0, "", fmt.Errorf("error building webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", j.contentType)
+	req.Header.Set("User-Agent", "sales-api-webhooks")
+	req.Header.Set("X-Webhook-ID", j.sub.ID)
+	req.Header.Set("X-Event-ID", j.eventID)
+	req.Header.Set("X-Event-Type", string(j.eventType))
+	// se firma en cada intento, así el timestamp es el del envío
+	req.Header.Set(SignatureHeader, Sign(d.clock.Now(), j.body, j.sub.secrets(d.clock.Now())...))
+
+	resp, err := d.http.Do(req)
+	if err != nil {
+		return 0, "", fmt.Errorf("error posting webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxExcerpt))
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	excerpt := strings.ToValidUTF8(string(body), "")
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, excerpt, fmt.Errorf("webhook returned unexpected status: %d", resp.StatusCode)
+	}
+	return resp.StatusCode, excerpt, nil
+}
@@ -0,0 +1,134 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"text/template"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/cloudevents"
+	"Ejercicio_Final-Taller_Go/internal/sales"
+)
+
+// Payload is what FormatFull posts for an event, and what the templates of
+// FormatTemplate are executed on. ID identifies the event, the same for
+// every subscription and every retry, so consumers can drop duplicates.
+type Payload struct {
+	ID             string           `json:"id"`
+	Type           sales.EventType  `json:"type"`
+	OccurredAt     time.Time        `json:"occurred_at"`
+	Tenant         string           `json:"tenant"`
+	SchemaVersion  int              `json:"schema_version"`
+	Sale           sales.Sale       `json:"sale"`
+	PreviousStatus sales.SaleStatus `json:"previous_status,omitempty"`
+}
+
+// diffPayload is what FormatDiff posts: for each field of the sale that
+// changed, its value before and after. Every field of a new sale changes.
+type diffPayload struct {
+	ID            string                 `json:"id"`
+	Type          sales.EventType        `json:"type"`
+	OccurredAt    time.Time              `json:"occurred_at"`
+	Tenant        string                 `json:"tenant"`
+	SchemaVersion int                    `json:"schema_version"`
+	SaleID        string                 `json:"sale_id"`
+	Version       int                    `json:"version"`
+	Changes       map[string]fieldChange `json:"changes"`
+}
+
+type fieldChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// templateFuncs are the functions templates can call besides the builtins.
+var templateFuncs = template.FuncMap{
+	// json escapes a value for JSON, e.g. {"note": {{json .Sale.Notes}}}
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// render returns the body and content type posted to sub for p. previous
+// is the sale before the event, nil for a new one.
+func render(sub *Subscription, p Payload, previous *sales.Sale) ([]byte, string, error) {
+	switch sub.Format {
+	case FormatDiff:
+		changes, err := diff(previous, &p.Sale)
+		if err != nil {
+			return nil, "", err
+		}
+		body, err := json.Marshal(diffPayload{ID: p.ID, Type: p.Type, OccurredAt: p.OccurredAt, Tenant: p.Tenant,
+			SchemaVersion: p.SchemaVersion, SaleID: p.Sale.ID, Version: p.Sale.Version, Changes: changes})
+		return body, "application/json", err
+	case FormatCloudEvents:
+		event := cloudevents.FromSale(p.ID, p.Tenant, p.Type, p.Sale, p)
+		event.DataSchema = fmt.Sprintf("urn:sales-api:schema:sale-event:v%d", p.SchemaVersion)
+		body, err := json.Marshal(event)
+		return body, cloudevents.ContentType, err
+	case FormatTemplate:
+		tmpl, err := parseTemplate(sub.Template)
+		if err != nil {
+			return nil, "", err
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, p); err != nil {
+			return nil, "", fmt.Errorf("error rendering webhook template: %w", err)
+		}
+		return buf.Bytes(), sub.ContentType, nil
+	default:
+		body, err := json.Marshal(p)
+		return body, "application/json", err
+	}
+}
+
+// diff returns the JSON fields of after that differ from before, which is
+// nil for a new sale. The version and update time, which change every
+// time, are left out.
+func diff(before, after *sales.Sale) (map[string]fieldChange, error) {
+	b, err := jsonFields(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := jsonFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]fieldChange{}
+	for k := range mergeKeys(a, b) {
+		if k == "version" || k == "updated_at" || reflect.DeepEqual(b[k], a[k]) {
+			continue
+		}
+		changes[k] = fieldChange{Before: b[k], After: a[k]}
+	}
+	return changes, nil
+}
+
+// mergeKeys returns the keys of a and b.
+func mergeKeys(a, b map[string]any) map[string]bool {
+	keys := make(map[string]bool, len(a))
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+	return keys
+}
+
+// jsonFields returns the fields sale is encoded with in JSON.
+func jsonFields(sale *sales.Sale) (map[string]any, error) {
+	fields := map[string]any{}
+	if sale == nil {
+		return fields, nil
+	}
+	data, err := json.Marshal(sale)
+	if err != nil {
+		return nil, err
+	}
+	return fields, json.Unmarshal(data, &fields)
+}
@@ -0,0 +1,83 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureHeader is the header deliveries are signed in.
+const SignatureHeader = "X-Signature"
+
+// secretPrefix marks webhook secrets, so a leaked one is easy to recognize.
+const secretPrefix = "whsec_"
+
+// ErrInvalidSignature is returned by Verify for a payload not signed by
+// any of the secrets, or signed too long ago.
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// newSecret returns a random signing secret.
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating webhook secret: %w", err)
+	}
+	return secretPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// signature returns the hex HMAC-SHA256 of "<unix seconds>.<body>" with secret.
+func signature(secret string, ts int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", ts)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sign returns the SignatureHeader value of body sent at t, with one v1
+// signature per secret: "t=<unix seconds>,v1=<hex>[,v1=<hex>]".
+func Sign(t time.Time, body []byte, secrets ...string) string {
+	ts := t.Unix()
+	parts := []string{"t=" + strconv.FormatInt(ts, 10)}
+	for _, secret := range secrets {
+		parts = append(parts, "v1="+signature(secret, ts, body))
+	}
+	return strings.Join(parts, ",")
+}
+
+// Verify checks a SignatureHeader value the way consumers should: one of
+// its v1 signatures must be that of body with secret, and its timestamp
+// within tolerance of now, so a captured delivery cannot be replayed later.
+func Verify(header string, body []byte, secret string, now time.Time, tolerance time.Duration) error {
+	var ts int64
+	var sigs []string
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			var err error
+			if ts, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return ErrInvalidSignature
+			}
+		case "v1":
+			sigs = append(sigs, v)
+		}
+	}
+	if ts == 0 || now.Sub(time.Unix(ts, 0)).Abs() > tolerance {
+		return fmt.Errorf("%w: timestamp out of tolerance", ErrInvalidSignature)
+	}
+
+	expected := signature(secret, ts, body)
+	for _, sig := range sigs {
+		if hmac.Equal([]byte(sig), []byte(expected)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
@@ -0,0 +1,77 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// errPrivateAddress is returned when a delivery would connect to an
+// address that is not public.
+var errPrivateAddress = errors.New("webhook address is not public")
+
+// public reports whether addr can be reached from the internet: loopback,
+// private, link-local, multicast and unspecified addresses are refused, so
+// a subscription cannot make the dispatcher call the internal network or
+// the metadata endpoint of the cloud provider.
+func public(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !addr.IsLoopback() && !addr.IsLinkLocalUnicast()
+}
+
+// checkTarget returns ErrInvalidSubscription unless the host of rawURL, an
+// absolute http(s) URL, resolves and only to public addresses.
+func (d *Dispatcher) checkTarget(ctx context.Context, rawURL string) error {
+	if d.privateTargets {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%w: url must be an absolute http(s) URL", ErrInvalidSubscription)
+	}
+	addrs, err := d.resolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil {
+		return fmt.Errorf("%w: url host %s does not resolve", ErrInvalidSubscription, u.Hostname())
+	}
+	for _, addr := range addrs {
+		if !public(addr) {
+			return fmt.Errorf("%w: url must not point to a private address", ErrInvalidSubscription)
+		}
+	}
+	return nil
+}
+
+// publicTransport returns a transport that refuses to connect to addresses
+// that are not public. The check is made on the address dialed, so it also
+// holds when a host resolves differently than when it was subscribed.
+// Proxies are not used, since they would connect in its place.
+func publicTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+			if !public(addr) {
+				return fmt.Errorf("%w: %s", errPrivateAddress, addr)
+			}
+			return nil
+		},
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	t.DialContext = dialer.DialContext
+	return t
+}
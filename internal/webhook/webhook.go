@@ -0,0 +1,233 @@
+// Package webhook delivers sale events to the HTTP endpoints tenants
+// subscribe, each in the payload shape its consumer expects.
+//
+// Every delivery is signed with the secret of its subscription in the
+// X-Signature header, as "t=<unix seconds>,v1=<hex signature>", where the
+// signature is the HMAC-SHA256 of the timestamp, a dot and the raw body.
+// Consumers recompute it with their secret, compare it in constant time
+// with every v1 value, since a rotated secret keeps signing next to the
+// new one for a while, and reject timestamps more than a few minutes off,
+// so a captured delivery cannot be replayed. Verify does just that.
+//
+// A secret is only shown when the subscription is created and when it is
+// rotated (see RotateSecret). After a rotation the replaced secret keeps
+// signing for the grace period (see WithSecretGrace), so for a while each
+// delivery carries two v1 signatures and consumers can switch secrets
+// without rejecting any.
+//
+// Each delivery attempt is recorded in a DeliveryLog with its status code,
+// latency and the first maxExcerpt bytes of the response body. The log
+// keeps only the last maxLoggedAttempts attempts of each subscription, in
+// memory, so it is lost on restart and not shared between instances, and
+// it is deleted with its subscription.
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"sync"
+	"text/template"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/apperrors"
+	"Ejercicio_Final-Taller_Go/internal/sales"
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+)
+
+// ErrNotFound is returned for a subscription that does not exist.
+var ErrNotFound = apperrors.New(apperrors.NotFound, "webhook_not_found", "webhook not found")
+
+// ErrInvalidSubscription is returned for a subscription with a bad URL,
+// event, format, schema version or template.
+var ErrInvalidSubscription = apperrors.New(apperrors.Validation, "invalid_webhook", "invalid webhook subscription")
+
+// Format is the shape of the payloads posted to a subscription.
+type Format string
+
+const (
+	// FormatFull posts the event with the whole sale.
+	FormatFull Format = "full"
+	// FormatDiff posts the event with only the fields of the sale that changed.
+	FormatDiff Format = "diff"
+	// FormatCloudEvents posts the full payload in a CloudEvents 1.0
+	// envelope, in structured mode.
+	FormatCloudEvents Format = "cloudevents"
+	// FormatTemplate posts the output of the subscription's Template,
+	// executed on the full payload.
+	FormatTemplate Format = "template"
+)
+
+// LatestSchema is the newest version of the payload schemas. Subscriptions
+// keep the version they were created with, so a new one does not break
+// their consumers.
+const LatestSchema = 1
+
+// maxTemplateLength caps the size of a subscription template.
+const maxTemplateLength = 4096
+
+// Subscription asks for the sale events of a tenant to be posted to URL.
+type Subscription struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	// Events are the event types posted; empty for all of them.
+	Events []sales.EventType `json:"events,omitempty"`
+	Format Format            `json:"format"`
+	// SchemaVersion is the version of the payload schema posted.
+	SchemaVersion int `json:"schema_version"`
+	// Template is the text/template of FormatTemplate payloads, posted as
+	// ContentType, which defaults to application/json.
+	Template    string    `json:"template,omitempty"`
+	ContentType string    `json:"content_type,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	// Secret signs the deliveries. PreviousSecret, replaced by a rotation,
+	// signs them too until PreviousSecretExpiresAt. Secrets are never encoded.
+	Secret                  string     `json:"-"`
+	PreviousSecret          string     `json:"-"`
+	PreviousSecretExpiresAt *time.Time `json:"previous_secret_expires_at,omitempty"`
+}
+
+// secrets returns the secrets that sign the deliveries made at now.
+func (sub *Subscription) secrets(now time.Time) []string {
+	secrets := []string{sub.Secret}
+	if sub.PreviousSecret != "" && sub.PreviousSecretExpiresAt != nil && now.Before(*sub.PreviousSecretExpiresAt) {
+		secrets = append(secrets, sub.PreviousSecret)
+	}
+	return secrets
+}
+
+// clone returns a copy of sub that does not share its Events.
+func (sub *Subscription) clone() *Subscription {
+	c := *sub
+	c.Events = slices.Clone(sub.Events)
+	return &c
+}
+
+// wants reports whether events of type t are posted to sub.
+func (sub *Subscription) wants(t sales.EventType) bool {
+	return len(sub.Events) == 0 || slices.Contains(sub.Events, t)
+}
+
+// eventTypes are the sale events that can be subscribed to.
+var eventTypes = []sales.EventType{sales.EventCreated, sales.EventStatusChanged, sales.EventUpdated}
+
+// normalize checks sub and fills in its defaults.
+func (sub *Subscription) normalize() error {
+	u, err := url.Parse(sub.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: url must be an absolute http(s) URL", ErrInvalidSubscription)
+	}
+	for _, t := range sub.Events {
+		if !slices.Contains(eventTypes, t) {
+			return fmt.Errorf("%w: unknown event %q", ErrInvalidSubscription, t)
+		}
+	}
+
+	if sub.Format == "" {
+		sub.Format = FormatFull
+	}
+	switch sub.Format {
+	case FormatFull, FormatDiff, FormatCloudEvents:
+		if sub.Template != "" || sub.ContentType != "" {
+			return fmt.Errorf("%w: template and content_type are only for the template format", ErrInvalidSubscription)
+		}
+	case FormatTemplate:
+		if sub.Template == "" || len(sub.Template) > maxTemplateLength {
+			return fmt.Errorf("%w: template must have 1 to %d bytes", ErrInvalidSubscription, maxTemplateLength)
+		}
+		if _, err := parseTemplate(sub.Template); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidSubscription, err)
+		}
+		if sub.ContentType == "" {
+			sub.ContentType = "application/json"
+		}
+	default:
+		return fmt.Errorf("%w: unknown format %q", ErrInvalidSubscription, sub.Format)
+	}
+
+	if sub.SchemaVersion == 0 {
+		sub.SchemaVersion = LatestSchema
+	}
+	if sub.SchemaVersion < 1 || sub.SchemaVersion > LatestSchema {
+		return fmt.Errorf("%w: schema_version must be between 1 and %d", ErrInvalidSubscription, LatestSchema)
+	}
+	return nil
+}
+
+// parseTemplate parses the template of a FormatTemplate subscription.
+func parseTemplate(text string) (*template.Template, error) {
+	return template.New("payload").Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+}
+
+// Store keeps the subscriptions of every tenant, scoped by the tenant in ctx.
+type Store interface {
+	Save(ctx context.Context, sub *Subscription) error
+	// Get returns ErrNotFound if there is no subscription with the given ID.
+	Get(ctx context.Context, id string) (*Subscription, error)
+	// List returns the subscriptions of the tenant, oldest first.
+	List(ctx context.Context) ([]*Subscription, error)
+	// Delete returns ErrNotFound if there is no subscription with the given ID.
+	Delete(ctx context.Context, id string) error
+}
+
+// LocalStore keeps subscriptions in memory. It is safe for concurrent use.
+type LocalStore struct {
+	mu   sync.Mutex
+	subs map[string][]*Subscription // tenant -> subscriptions, oldest first
+}
+
+// NewLocalStore creates an empty LocalStore.
+func NewLocalStore() *LocalStore {
+	return &LocalStore{subs: map[string][]*Subscription{}}
+}
+
+// Save stores a copy of sub, replacing the one with its ID.
+func (s *LocalStore) Save(ctx context.Context, sub *Subscription) error {
+	c := sub.clone()
+	id := tenant.FromContext(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	subs := s.subs[id]
+	if i := slices.IndexFunc(subs, func(o *Subscription) bool { return o.ID == sub.ID }); i >= 0 {
+		subs[i] = c
+		return nil
+	}
+	s.subs[id] = append(subs, c)
+	return nil
+}
+
+func (s *LocalStore) Get(ctx context.Context, id string) (*Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sub := range s.subs[tenant.FromContext(ctx)] {
+		if sub.ID == id {
+			return sub.clone(), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *LocalStore) List(ctx context.Context) ([]*Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	subs := make([]*Subscription, 0, len(s.subs[tenant.FromContext(ctx)]))
+	for _, sub := range s.subs[tenant.FromContext(ctx)] {
+		subs = append(subs, sub.clone())
+	}
+	return subs, nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := tenant.FromContext(ctx)
+	i := slices.IndexFunc(s.subs[t], func(o *Subscription) bool { return o.ID == id })
+	if i < 0 {
+		return ErrNotFound
+	}
+	s.subs[t] = slices.Delete(s.subs[t], i, i+1)
+	return nil
+}
@@ -0,0 +1,311 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/internal/clock"
+	"Ejercicio_Final-Taller_Go/internal/sales"
+	"Ejercicio_Final-Taller_Go/internal/tenant"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// received is a request posted to a test endpoint.
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+// endpoint starts a server that answers status to the first fails
+// requests and 204 afterwards, sending every request to the channel.
+func endpoint(t *testing.T, fails int) (*httptest.Server, <-chan received) {
+	ch := make(chan received, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		ch <- received{header: r.Header, body: body}
+		if fails > 0 {
+			fails--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, ch
+}
+
+func next(t *testing.T, ch <-chan received) received {
+	select {
+	case r := <-ch:
+		return r
+	case <-time.After(2 * time.Second):
+		t.Fatal("no delivery")
+		return received{}
+	}
+}
+
+func TestDispatcher_Subscribe(t *testing.T) {
+	ctx := context.Background()
+	d := New(NewLocalStore(), 10, zap.NewNop(), WithPrivateTargets())
+	defer d.Close()
+
+	for _, sub := range []Subscription{
+		{URL: "ftp://example.com"},
+		{URL: "/relative"},
+		{URL: "https://example.com", Events: []sales.EventType{"sale.deleted"}},
+		{URL: "https://example.com", Format: "xml"},
+		{URL: "https://example.com", Format: FormatTemplate},
+		{URL: "https://example.com", Format: FormatTemplate, Template: "{{.Nope"},
+		{URL: "https://example.com", Template: "{{.ID}}"},
+		{URL: "https://example.com", SchemaVersion: LatestSchema + 1},
+	} {
+		_, _, err := d.Subscribe(ctx, sub)
+		require.ErrorIs(t, err, ErrInvalidSubscription, sub)
+	}
+
+	sub, secret, err := d.Subscribe(ctx, Subscription{URL: "https://example.com/hooks"})
+	require.NoError(t, err)
+	require.NotEmpty(t, sub.ID)
+	require.Equal(t, secret, sub.Secret)
+	require.Regexp(t, `^whsec_[A-Za-z0-9_-]{43}$`, secret)
+	require.Equal(t, FormatFull, sub.Format)
+	require.Equal(t, LatestSchema, sub.SchemaVersion)
+
+	// las suscripciones son de cada tenant
+	subs, err := d.List(tenant.WithID(ctx, "other"))
+	require.NoError(t, err)
+	require.Empty(t, subs)
+	subs, err = d.List(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []*Subscription{sub}, subs)
+
+	require.NoError(t, d.Unsubscribe(ctx, sub.ID))
+	_, err = d.Get(ctx, sub.ID)
+	require.ErrorIs(t, err, ErrNotFound)
+	require.ErrorIs(t, d.Unsubscribe(ctx, sub.ID), ErrNotFound)
+}
+
+func TestDispatcher_Formats(t *testing.T) {
+	ctx := tenant.WithID(context.Background(), "acme")
+	// con un solo worker las entregas llegan en el orden de las suscripciones
+	d := New(NewLocalStore(), 10, zap.NewNop(), WithPrivateTargets(), WithWorkers(1))
+	defer d.Close()
+
+	srv, ch := endpoint(t, 0)
+	subscribe := func(sub Subscription) {
+		sub.URL = srv.URL
+		_, _, err := d.Subscribe(ctx, sub)
+		require.NoError(t, err)
+	}
+	subscribe(Subscription{Format: FormatFull})
+	subscribe(Subscription{Format: FormatDiff})
+	subscribe(Subscription{Format: FormatCloudEvents})
+	subscribe(Subscription{Format: FormatTemplate, Template: `{"text": {{json (printf "Sale %s is %s" .Sale.Number .Sale.Status)}}}`})
+	subscribe(Subscription{Events: []sales.EventType{sales.EventCreated}})
+
+	at := time.Date(2024, 3, 10, 15, 0, 0, 0, time.UTC)
+	before := sales.Sale{ID: "1", Number: "2024-000001", UserID: "a", Amount: 1000, Status: sales.StatusPending, CreatedAt: at, UpdatedAt: at, Version: 1}
+	after := before
+	after.Status, after.UpdatedAt, after.Version = sales.StatusApproved, at.Add(time.Minute), 2
+	d.Hook()(ctx, sales.Event{Type: sales.EventStatusChanged, Sale: after, PreviousStatus: sales.StatusPending, Previous: &before})
+
+	full := next(t, ch)
+	require.Equal(t, "application/json", full.header.Get("Content-Type"))
+	require.Equal(t, "sale.status_changed", full.header.Get("X-Event-Type"))
+	var p Payload
+	require.NoError(t, json.Unmarshal(full.body, &p))
+	require.Equal(t, full.header.Get("X-Event-ID"), p.ID)
+	require.Equal(t, "acme", p.Tenant)
+	require.Equal(t, 1, p.SchemaVersion)
+	require.Equal(t, sales.StatusApproved, p.Sale.Status)
+	require.Equal(t, sales.StatusPending, p.PreviousStatus)
+
+	changes := next(t, ch)
+	require.JSONEq(t, `{"id":"`+p.ID+`","type":"sale.status_changed","occurred_at":"2024-03-10T15:01:00Z","tenant":"acme",
+		"schema_version":1,"sale_id":"1","version":2,"changes":{"status":{"before":"pending","after":"approved"}}}`, string(changes.body))
+
+	ce := next(t, ch)
+	require.Equal(t, "application/cloudevents+json", ce.header.Get("Content-Type"))
+	var event map[string]any
+	require.NoError(t, json.Unmarshal(ce.body, &event))
+	require.Equal(t, "1.0", event["specversion"])
+	require.Equal(t, p.ID, event["id"])
+	require.Equal(t, "/tenants/acme/sales", event["source"])
+	require.Equal(t, "sale.status_changed", event["type"])
+	require.Equal(t, "1", event["subject"])
+	require.Equal(t, "urn:sales-api:schema:sale-event:v1", event["dataschema"])
+
+	tmpl := next(t, ch)
+	require.JSONEq(t, `{"text":"Sale 2024-000001 is approved"}`, string(tmpl.body))
+
+	// la suscripción solo a ventas creadas no recibe el cambio de estado
+	select {
+	case r := <-ch:
+		t.Fatalf("unexpected delivery: %s", r.body)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestDispatcher_Retries(t *testing.T) {
+	ctx := context.Background()
+	d := New(NewLocalStore(), 10, zap.NewNop(), WithPrivateTargets(), WithRetries(3, time.Millisecond))
+	defer d.Close()
+
+	srv, ch := endpoint(t, 2)
+	_, _, err := d.Subscribe(ctx, Subscription{URL: srv.URL})
+	require.NoError(t, err)
+	d.Hook()(ctx, sales.Event{Type: sales.EventCreated, Sale: sales.Sale{ID: "1", Status: sales.StatusPending}})
+
+	first := next(t, ch)
+	next(t, ch)
+	third := next(t, ch)
+	require.Equal(t, first.body, third.body)
+	require.Equal(t, first.header.Get("X-Event-ID"), third.header.Get("X-Event-ID"))
+}
+
+func TestVerify(t *testing.T) {
+	at := time.Unix(1710082800, 0)
+	body := []byte(`{"id":"1"}`)
+	header := Sign(at, body, "whsec_new", "whsec_old")
+	require.Regexp(t, `^t=1710082800,v1=[0-9a-f]{64},v1=[0-9a-f]{64}$`, header)
+
+	require.NoError(t, Verify(header, body, "whsec_new", at.Add(time.Minute), 5*time.Minute))
+	require.NoError(t, Verify(header, body, "whsec_old", at, 5*time.Minute))
+	require.ErrorIs(t, Verify(header, body, "whsec_other", at, 5*time.Minute), ErrInvalidSignature)
+	require.ErrorIs(t, Verify(header, []byte(`{"id":"2"}`), "whsec_new", at, 5*time.Minute), ErrInvalidSignature)
+	require.ErrorIs(t, Verify(header, body, "whsec_new", at.Add(10*time.Minute), 5*time.Minute), ErrInvalidSignature)
+	require.ErrorIs(t, Verify("v1=abc", body, "whsec_new", at, 5*time.Minute), ErrInvalidSignature)
+}
+
+func TestDispatcher_RotateSecret(t *testing.T) {
+	ctx := context.Background()
+	now := clock.NewManual(time.Date(2024, 3, 10, 15, 0, 0, 0, time.UTC))
+	d := New(NewLocalStore(), 10, zap.NewNop(), WithPrivateTargets(), WithClock(now), WithSecretGrace(time.Hour))
+	defer d.Close()
+
+	srv, ch := endpoint(t, 0)
+	sub, old, err := d.Subscribe(ctx, Subscription{URL: srv.URL})
+	require.NoError(t, err)
+	event := sales.Event{Type: sales.EventCreated, Sale: sales.Sale{ID: "1", Status: sales.StatusPending}}
+
+	d.Hook()(ctx, event)
+	r := next(t, ch)
+	require.NoError(t, Verify(r.header.Get(SignatureHeader), r.body, old, now.Now(), 5*time.Minute))
+
+	_, _, err = d.RotateSecret(ctx, "nope")
+	require.ErrorIs(t, err, ErrNotFound)
+	rotated, secret, err := d.RotateSecret(ctx, sub.ID)
+	require.NoError(t, err)
+	require.NotEqual(t, old, secret)
+	require.Equal(t, now.Now().Add(time.Hour), *rotated.PreviousSecretExpiresAt)
+
+	// durante la gracia se firma con los dos secretos
+	d.Hook()(ctx, event)
+	r = next(t, ch)
+	require.NoError(t, Verify(r.header.Get(SignatureHeader), r.body, secret, now.Now(), 5*time.Minute))
+	require.NoError(t, Verify(r.header.Get(SignatureHeader), r.body, old, now.Now(), 5*time.Minute))
+
+	now.Advance(time.Hour)
+	d.Hook()(ctx, event)
+	r = next(t, ch)
+	require.NoError(t, Verify(r.header.Get(SignatureHeader), r.body, secret, now.Now(), 5*time.Minute))
+	require.ErrorIs(t, Verify(r.header.Get(SignatureHeader), r.body, old, now.Now(), 5*time.Minute), ErrInvalidSignature)
+}
+
+func TestDispatcher_Deliveries(t *testing.T) {
+	ctx := context.Background()
+	d := New(NewLocalStore(), 10, zap.NewNop(), WithPrivateTargets(), WithRetries(2, time.Millisecond))
+	defer d.Close()
+
+	srv, ch := endpoint(t, 1)
+	sub, _, err := d.Subscribe(ctx, Subscription{URL: srv.URL})
+	require.NoError(t, err)
+	d.Hook()(ctx, sales.Event{Type: sales.EventCreated, Sale: sales.Sale{ID: "1", Status: sales.StatusPending}})
+	next(t, ch)
+	r := next(t, ch)
+
+	// el intento se registra después de recibida la respuesta
+	var attempts []Attempt
+	require.Eventually(t, func() bool {
+		attempts, err = d.Deliveries(ctx, sub.ID, "")
+		return err == nil && len(attempts) == 2
+	}, 2*time.Second, 5*time.Millisecond)
+	require.Equal(t, OutcomeSucceeded, attempts[0].Outcome)
+	require.Equal(t, 2, attempts[0].Attempt)
+	require.Equal(t, http.StatusNoContent, attempts[0].StatusCode)
+	require.Equal(t, r.header.Get("X-Event-ID"), attempts[0].EventID)
+	require.Equal(t, OutcomeFailed, attempts[1].Outcome)
+	require.Equal(t, http.StatusServiceUnavailable, attempts[1].StatusCode)
+	require.Contains(t, attempts[1].Error, "503")
+
+	failed, err := d.Deliveries(ctx, sub.ID, OutcomeFailed)
+	require.NoError(t, err)
+	require.Equal(t, attempts[1:], failed)
+
+	_, err = d.Deliveries(ctx, sub.ID, "lost")
+	require.ErrorIs(t, err, ErrInvalidOutcome)
+	_, err = d.Deliveries(ctx, "nope", "")
+	require.ErrorIs(t, err, ErrNotFound)
+	attempts, err = d.Deliveries(tenant.WithID(ctx, "other"), sub.ID, "")
+	require.ErrorIs(t, err, ErrNotFound)
+	require.Empty(t, attempts)
+}
+
+func TestDispatcher_PrivateTargets(t *testing.T) {
+	ctx := context.Background()
+	d := New(NewLocalStore(), 10, zap.NewNop(), WithRetries(1, time.Millisecond))
+	defer d.Close()
+
+	for _, url := range []string{
+		"http://127.0.0.1:8080", "http://localhost/hooks", "http://10.1.2.3", "http://192.168.0.1",
+		"http://169.254.169.254/latest/meta-data", "http://[::1]", "http://[fd00::1]", "http://0.0.0.0",
+	} {
+		_, _, err := d.Subscribe(ctx, Subscription{URL: url})
+		require.ErrorIs(t, err, ErrInvalidSubscription, url)
+		require.ErrorIs(t, d.Validate(ctx, Subscription{URL: url}), ErrInvalidSubscription, url)
+	}
+
+	// un host que ahora resuelve a una dirección privada tampoco recibe entregas
+	srv, ch := endpoint(t, 0)
+	rebound := &Subscription{ID: "rebound", URL: srv.URL, Format: FormatFull, SchemaVersion: LatestSchema, Secret: "whsec_test"}
+	require.NoError(t, d.store.Save(ctx, rebound))
+	d.Hook()(ctx, sales.Event{Type: sales.EventCreated, Sale: sales.Sale{ID: "1", Status: sales.StatusPending}})
+
+	var attempts []Attempt
+	require.Eventually(t, func() bool {
+		var err error
+		attempts, err = d.Deliveries(ctx, rebound.ID, OutcomeFailed)
+		return err == nil && len(attempts) == 1
+	}, 2*time.Second, 5*time.Millisecond)
+	require.Contains(t, attempts[0].Error, "not public")
+	require.Empty(t, ch)
+}
+
+func TestDispatcher_Workers(t *testing.T) {
+	ctx := context.Background()
+	d := New(NewLocalStore(), 10, zap.NewNop(), WithPrivateTargets(), WithWorkers(2))
+	defer d.Close()
+
+	// una entrega lenta no demora las de los demás
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+	fast, ch := endpoint(t, 0)
+	for _, url := range []string{slow.URL, fast.URL} {
+		_, _, err := d.Subscribe(ctx, Subscription{URL: url})
+		require.NoError(t, err)
+	}
+
+	d.Hook()(ctx, sales.Event{Type: sales.EventCreated, Sale: sales.Sale{ID: "1", Status: sales.StatusPending}})
+	next(t, ch)
+}
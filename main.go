@@ -1,36 +1,88 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"log"
-	"os"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"Ejercicio_Final-Taller_Go/api"
+	"Ejercicio_Final-Taller_Go/internal/buildinfo"
+	"Ejercicio_Final-Taller_Go/internal/config"
+	"Ejercicio_Final-Taller_Go/internal/errreport"
+	"Ejercicio_Final-Taller_Go/internal/logging"
 
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 )
 
 func main() {
-	r := gin.Default()
+	// sin gin.Recovery: los pánicos los atiende el middleware de la API
+	r := gin.New()
+	r.Use(gin.Logger())
+	build := buildinfo.Get()
 
-	// Definir la URL base de la API de usuarios.
-	// Se asume que tu API de usuarios corre en http://localhost:8080
-	userAPIURL := os.Getenv("USER_API_URL")
-	if userAPIURL == "" {
-		userAPIURL = "http://localhost:8080" // URL por defecto para la API de usuarios
-		log.Printf("Warning: USER_API_URL not set, using default: %s", userAPIURL)
+	cfg, err := config.Load()
+	if err != nil {
+		panic(fmt.Errorf("error trying to load configuration: %v", err))
 	}
 
-	api.InitRoutes(r, userAPIURL) // Pasar la userAPIURL
+	// Un único logger para toda la API, que se vacía al terminar
+	logger, err := logging.New(cfg.Logging, cfg.LogLevel)
+	if err != nil {
+		panic(fmt.Errorf("error trying to build logger: %v", err))
+	}
+	defer logger.Sync()
+
+	// El reporte de errores a Sentry solo se activa si SENTRY_DSN está definido
+	reporter, err := errreport.New(cfg.SentryDSN, cfg.SentryEnvironment, build.Version)
+	if err != nil {
+		panic(err)
+	}
+	defer reporter.Flush(2 * time.Second)
+
+	stop, err := api.InitRoutes(r, cfg, reporter, logger)
+	if err != nil {
+		panic(fmt.Errorf("error trying to initialize routes: %v", err))
+	}
 
-	port := os.Getenv("SALES_API_PORT")
-	if port == "" {
-		port = "8080" // Puerto por defecto para la API de ventas
+	// Perfiles y métricas de runtime, solo en una dirección interna
+	if cfg.DebugAddr != "" {
+		go func() {
+			logger.Info("starting diagnostics server", zap.String("addr", cfg.DebugAddr))
+			if err := http.ListenAndServe(cfg.DebugAddr, api.DebugHandler()); err != nil {
+				logger.Error("diagnostics server stopped", zap.Error(err))
+			}
+		}()
 	}
-	addr := fmt.Sprintf(":%s", port)
 
-	log.Printf("Starting sales API server at %s", addr)
-	if err := r.Run(addr); err != nil {
+	addr := fmt.Sprintf(":%s", cfg.Port)
+	srv := &http.Server{Addr: addr, Handler: r}
+
+	logger.Info("starting sales API server", zap.String("version", build.Version), zap.String("commit", build.Commit),
+		zap.String("built", build.BuildTime), zap.String("addr", addr))
+	signals, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stopSignals()
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.ListenAndServe()
+	}()
+	select {
+	case err := <-served:
 		panic(fmt.Errorf("error trying to start sales API server: %v", err))
+	case <-signals.Done():
+	}
+
+	// Al apagarse deja de aceptar requests, termina los en curso y después las creaciones encoladas
+	logger.Info("shutting down sales API server", zap.Duration("timeout", cfg.ShutdownTimeout))
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.Error("error shutting down sales API server", zap.Error(err))
+	}
+	if err := stop(ctx); err != nil {
+		logger.Error("error waiting for background work", zap.Error(err))
 	}
 }
@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"Ejercicio_Final-Taller_Go/internal/config"
+	"Ejercicio_Final-Taller_Go/internal/user"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+// newFuzzApp starts an app whose user API is itself, with one user created,
+// and returns the app and that user's ID.
+func newFuzzApp(f *testing.F) (*gin.Engine, string) {
+	gin.SetMode(gin.TestMode)
+	app := gin.New()
+	srv := httptest.NewServer(app)
+	f.Cleanup(srv.Close)
+	initRoutes(f, app, config.Config{UserAPIURL: srv.URL, MaxBodyBytes: 64 << 10}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBufferString(`{"name":"Ayrton"}`))
+	res := fakeRequest(app, req)
+	require.Equal(f, http.StatusCreated, res.Code)
+	var u user.User
+	require.NoError(f, json.Unmarshal(res.Body.Bytes(), &u))
+	return app, u.ID
+}
+
+func FuzzCreateSaleBody(f *testing.F) {
+	app, userID := newFuzzApp(f)
+	for _, seed := range []string{
+		`{"user_id":"` + userID + `","amount":10}`,
+		`{"user_id":"` + userID + `","amount_cents":1000}`,
+		`{"user_id":"` + userID + `","amount":NaN}`,
+		`{"user_id":"` + userID + `","amount":1e999}`,
+		`{"user_id":"` + userID + `","amount_cents":9223372036854775807}`,
+		`{"amount":-0.01}`,
+		strings.Repeat("[", 10000),
+		`{"user_id":` + strings.Repeat(`{"a":`, 100) + `1` + strings.Repeat(`}`, 100) + `}`,
+		"",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, body string) {
+		req, _ := http.NewRequest(http.MethodPost, "/v1/sales", strings.NewReader(body))
+		res := fakeRequest(app, req)
+		// ningún cuerpo debe provocar un error interno
+		require.Less(t, res.Code, http.StatusInternalServerError, "body %q answered %s", body, res.Body.String())
+	})
+}
+
+func FuzzSearchSalesQuery(f *testing.F) {
+	app, userID := newFuzzApp(f)
+	for _, seed := range []string{
+		"user_id=" + userID,
+		"status=approved&limit=5&offset=10",
+		"limit=100&offset=9223372036854775807",
+		"limit=-1",
+		"count_only=maybe",
+		"filter=amount>NaN",
+		"filter=" + strings.Repeat("amount>1%20AND%20", 200),
+		"%zz",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, query string) {
+		req := httptest.NewRequest(http.MethodGet, "/v1/sales", nil)
+		req.URL.RawQuery = query
+		res := fakeRequest(app, req)
+		require.Less(t, res.Code, http.StatusInternalServerError, "query %q answered %s", query, res.Body.String())
+	})
+}
@@ -2,19 +2,41 @@ package tests
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"github.com/gin-gonic/gin"
-	"github.com/stretchr/testify/require"
+	"encoding/xml"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
-	"parte3/api"
-	"parte3/internal/user"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"Ejercicio_Final-Taller_Go/api"
+	"Ejercicio_Final-Taller_Go/internal/audit"
+	"Ejercicio_Final-Taller_Go/internal/config"
+	"Ejercicio_Final-Taller_Go/internal/errreport"
+	"Ejercicio_Final-Taller_Go/internal/faults"
+	"Ejercicio_Final-Taller_Go/internal/logging"
+	"Ejercicio_Final-Taller_Go/internal/sales"
+	"Ejercicio_Final-Taller_Go/internal/tracing"
+	"Ejercicio_Final-Taller_Go/internal/user"
+	"Ejercicio_Final-Taller_Go/internal/webhook"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 func TestIntegrationCreateAndGet(t *testing.T) {
 	app := gin.Default()
-	api.InitRoutes(app)
+	initRoutes(t, app, config.Config{UserAPIURL: "http://localhost:8080"}, nil, nil)
 
 	req, _ := http.NewRequest(http.MethodGet, "/ping", nil)
 	res := fakeRequest(app, req)
@@ -37,7 +59,7 @@ func TestIntegrationCreateAndGet(t *testing.T) {
 	var resUser *user.User
 	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &resUser))
 	require.Equal(t, "Ayrton", resUser.Name)
-	require.Equal(t, "Pringles", resUser.Address)
+	require.Equal(t, "Pringles", resUser.Address.Street)
 	require.Equal(t, "Chiche", resUser.NickName)
 	require.Equal(t, 1, resUser.Version)
 	require.NotEmpty(t, resUser.ID)
@@ -50,6 +72,15 @@ func TestIntegrationCreateAndGet(t *testing.T) {
 
 	require.NotNil(t, res)
 	require.Equal(t, http.StatusOK, res.Code)
+	require.Equal(t, "true", res.Header().Get("Deprecation"))
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/users/"+resUser.ID, nil)
+
+	res = fakeRequest(app, req)
+
+	require.NotNil(t, res)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Empty(t, res.Header().Get("Deprecation"))
 }
 
 func fakeRequest(e *gin.Engine, r *http.Request) *httptest.ResponseRecorder {
@@ -58,3 +89,2276 @@ func fakeRequest(e *gin.Engine, r *http.Request) *httptest.ResponseRecorder {
 
 	return w
 }
+
+// initRoutes registers the routes of cfg on e, and stops their background
+// work once the test ends.
+func initRoutes(tb testing.TB, e *gin.Engine, cfg config.Config, reporter errreport.Reporter, logger *logging.Logger) {
+	tb.Helper()
+	stop, err := api.InitRoutes(e, cfg, reporter, logger)
+	require.NoError(tb, err)
+	tb.Cleanup(func() {
+		require.NoError(tb, stop(context.Background()))
+	})
+}
+
+func TestIntegrationSaleConditionalGet(t *testing.T) {
+	app := gin.Default()
+
+	// the sales service validates users over HTTP against this same app
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	initRoutes(t, app, config.Config{UserAPIURL: srv.URL}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/users", bytes.NewBufferString(`{"name":"Ayrton"}`))
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+
+	var resUser *user.User
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &resUser))
+
+	req, _ = http.NewRequest(http.MethodPost, "/sales", bytes.NewBufferString(`{"user_id":"`+resUser.ID+`","amount":10.5}`))
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+
+	var resSale *sales.Sale
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &resSale))
+	require.EqualValues(t, 1050, resSale.Amount)
+
+	req, _ = http.NewRequest(http.MethodGet, "/sales/"+resSale.ID, nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	etag := res.Header().Get("ETag")
+	require.Equal(t, `"v1"`, etag)
+
+	req, _ = http.NewRequest(http.MethodGet, "/sales/"+resSale.ID, nil)
+	req.Header.Set("If-None-Match", etag)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusNotModified, res.Code)
+	require.Empty(t, res.Body.String())
+}
+
+func TestIntegrationCreateSaleTimeout(t *testing.T) {
+	// a user API slower than the write deadline
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	app := gin.Default()
+	initRoutes(t, app, config.Config{UserAPIURL: srv.URL, WriteTimeout: 50 * time.Millisecond}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/sales", bytes.NewBufferString(`{"user_id":"slow","amount":10}`))
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusGatewayTimeout, res.Code)
+	require.Contains(t, res.Body.String(), `"code":"request_timeout"`)
+}
+
+func TestIntegrationListUsersPagination(t *testing.T) {
+	app := gin.Default()
+	initRoutes(t, app, config.Config{UserAPIURL: "http://localhost:8080"}, nil, nil)
+
+	for _, name := range []string{"Ana", "Beto", "Carla"} {
+		req, _ := http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBufferString(`{"name":"`+name+`"}`))
+		require.Equal(t, http.StatusCreated, fakeRequest(app, req).Code)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "/v1/users?limit=2", nil)
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Equal(t, `</v1/users?limit=2&offset=2>; rel="next"`, res.Header().Get("Link"))
+
+	var page struct {
+		Data []*user.User `json:"data"`
+		Meta struct {
+			Total int `json:"total"`
+		} `json:"meta"`
+		Links struct {
+			Next string `json:"next"`
+			Prev string `json:"prev"`
+		} `json:"links"`
+	}
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &page))
+	require.Len(t, page.Data, 2)
+	require.Equal(t, 3, page.Meta.Total)
+	require.Empty(t, page.Links.Prev)
+
+	req, _ = http.NewRequest(http.MethodGet, page.Links.Next, nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Equal(t, `</v1/users?limit=2&offset=0>; rel="prev"`, res.Header().Get("Link"))
+}
+
+func TestIntegrationAPIKeyQuotas(t *testing.T) {
+	app := gin.Default()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	initRoutes(t, app, config.Config{
+		UserAPIURL: srv.URL,
+		UserAPIKey: "internal-secret",
+		APIKeys: []config.APIKey{
+			{ID: "shop", Secret: "shop-secret", SaleQuota: 1},
+			{ID: "internal", Secret: "internal-secret", Admin: true},
+		},
+	}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBufferString(`{"name":"Ayrton"}`))
+	require.Equal(t, http.StatusUnauthorized, fakeRequest(app, req).Code)
+
+	req, _ = http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBufferString(`{"name":"Ayrton"}`))
+	req.Header.Set("X-API-Key", "shop-secret")
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+
+	var resUser *user.User
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &resUser))
+
+	// una venta que no se crea no gasta la cuota
+	req, _ = http.NewRequest(http.MethodPost, "/v1/sales", bytes.NewBufferString(`{"user_id":"nobody","amount":10}`))
+	req.Header.Set("X-API-Key", "shop-secret")
+	require.Equal(t, http.StatusNotFound, fakeRequest(app, req).Code)
+
+	for _, want := range []int{http.StatusCreated, http.StatusTooManyRequests} {
+		req, _ = http.NewRequest(http.MethodPost, "/v1/sales", bytes.NewBufferString(`{"user_id":"`+resUser.ID+`","amount":10}`))
+		req.Header.Set("X-API-Key", "shop-secret")
+		res = fakeRequest(app, req)
+		require.Equal(t, want, res.Code)
+	}
+	require.NotEmpty(t, res.Header().Get("Retry-After"))
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/admin/keys/shop/usage", nil)
+	req.Header.Set("X-API-Key", "internal-secret")
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+
+	var usage struct {
+		Usage struct {
+			Requests     int `json:"requests"`
+			SalesCreated int `json:"sales_created"`
+		} `json:"usage"`
+	}
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &usage))
+	require.Equal(t, 4, usage.Usage.Requests)
+	require.Equal(t, 1, usage.Usage.SalesCreated)
+
+	// solo las claves de administrador llegan a /admin
+	for _, path := range []string{"/v1/admin/keys/shop/usage", "/v1/admin/apikeys", "/v1/admin/dashboard"} {
+		req, _ = http.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-API-Key", "shop-secret")
+		require.Equal(t, http.StatusForbidden, fakeRequest(app, req).Code, path)
+	}
+	req, _ = http.NewRequest(http.MethodPost, "/v1/admin/apikeys", bytes.NewBufferString(`{"name":"mine","sale_quota":1000}`))
+	req.Header.Set("X-API-Key", "shop-secret")
+	require.Equal(t, http.StatusForbidden, fakeRequest(app, req).Code)
+}
+
+func TestIntegrationQuotaWarnings(t *testing.T) {
+	app := gin.Default()
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+	initRoutes(t, app, config.Config{
+		UserAPIURL:        srv.URL,
+		UserAPIKey:        "internal-secret",
+		QuotaWarningRatio: 0.8,
+		APIKeys: []config.APIKey{
+			{ID: "shop", Secret: "shop-secret", SaleQuota: 5},
+			{ID: "reader", Secret: "reader-secret", RequestQuota: 5},
+			{ID: "internal", Secret: "internal-secret"},
+		},
+	}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBufferString(`{"name":"Ayrton"}`))
+	req.Header.Set("X-API-Key", "shop-secret")
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+	require.Empty(t, res.Header().Get("X-Quota-Remaining"))
+
+	var resUser *user.User
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &resUser))
+
+	// la advertencia aparece recién con la cuarta venta de cinco
+	var saleID string
+	for i, want := range []string{"", "", "", "1", "0"} {
+		if i == 3 {
+			// una venta que falla no advierte, ni cuenta para la advertencia
+			req, _ = http.NewRequest(http.MethodPost, "/v1/sales", bytes.NewBufferString(`{"user_id":"nobody","amount":10}`))
+			req.Header.Set("X-API-Key", "shop-secret")
+			res = fakeRequest(app, req)
+			require.Equal(t, http.StatusNotFound, res.Code)
+			require.Empty(t, res.Header().Get("X-Sale-Quota-Remaining"))
+		}
+		req, _ = http.NewRequest(http.MethodPost, "/v1/sales", bytes.NewBufferString(`{"user_id":"`+resUser.ID+`","amount":10}`))
+		req.Header.Set("X-API-Key", "shop-secret")
+		res = fakeRequest(app, req)
+		require.Equal(t, http.StatusCreated, res.Code)
+		require.Equal(t, want, res.Header().Get("X-Sale-Quota-Remaining"))
+
+		var sale map[string]any
+		require.NoError(t, json.Unmarshal(res.Body.Bytes(), &sale))
+		saleID = sale["id"].(string)
+	}
+	require.NotEmpty(t, res.Header().Get("X-Quota-Reset"))
+
+	for _, want := range []string{"", "", "", "1"} {
+		req, _ = http.NewRequest(http.MethodGet, "/v1/sales/"+saleID, nil)
+		req.Header.Set("X-API-Key", "reader-secret")
+		res = fakeRequest(app, req)
+		require.Equal(t, http.StatusOK, res.Code)
+		require.Equal(t, want, res.Header().Get("X-Quota-Remaining"))
+	}
+	// el request fallido cuenta para la cuota, pero no lleva la advertencia
+	req, _ = http.NewRequest(http.MethodGet, "/v1/sales/missing", nil)
+	req.Header.Set("X-API-Key", "reader-secret")
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusNotFound, res.Code)
+	require.Empty(t, res.Header().Get("X-Quota-Remaining"))
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/sales/"+saleID, nil)
+	req.Header.Set("X-API-Key", "reader-secret")
+	require.Equal(t, http.StatusTooManyRequests, fakeRequest(app, req).Code)
+}
+
+func TestIntegrationAPIKeyTenants(t *testing.T) {
+	app := gin.Default()
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+	initRoutes(t, app, config.Config{
+		UserAPIURL: srv.URL,
+		UserAPIKey: "internal-secret",
+		APIKeys: []config.APIKey{
+			{ID: "acme", Secret: "acme-secret", Tenant: "acme"},
+			{ID: "shop", Secret: "shop-secret"},
+			{ID: "internal", Secret: "internal-secret", Admin: true},
+		},
+	}, nil, nil)
+
+	do := func(method, path, secret, tenantID, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("X-API-Key", secret)
+		if tenantID != "" {
+			req.Header.Set("X-Tenant-ID", tenantID)
+		}
+		return fakeRequest(app, req)
+	}
+
+	// la key de acme opera en acme aunque no mande el header
+	res := do(http.MethodPost, "/v1/users", "acme-secret", "", `{"name":"Ayrton"}`)
+	require.Equal(t, http.StatusCreated, res.Code)
+	var resUser *user.User
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &resUser))
+	res = do(http.MethodPost, "/v1/sales", "acme-secret", "", `{"user_id":"`+resUser.ID+`","amount":10}`)
+	require.Equal(t, http.StatusCreated, res.Code)
+	var sale sales.Sale
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &sale))
+
+	require.Equal(t, http.StatusOK, do(http.MethodGet, "/v1/sales/"+sale.ID, "acme-secret", "acme", "").Code)
+	require.Equal(t, http.StatusOK, do(http.MethodGet, "/v1/sales/"+sale.ID, "internal-secret", "acme", "").Code)
+
+	// las demás keys no pueden elegir otro tenant con el header
+	res = do(http.MethodGet, "/v1/sales/"+sale.ID, "acme-secret", "other", "")
+	require.Equal(t, http.StatusForbidden, res.Code)
+	require.Contains(t, res.Body.String(), `"code":"tenant_not_allowed"`)
+	require.Equal(t, http.StatusForbidden, do(http.MethodGet, "/v1/sales/"+sale.ID, "shop-secret", "acme", "").Code)
+	require.Equal(t, http.StatusNotFound, do(http.MethodGet, "/v1/sales/"+sale.ID, "shop-secret", "", "").Code)
+}
+
+func TestIntegrationTenantBoundAdmin(t *testing.T) {
+	app := gin.Default()
+	initRoutes(t, app, config.Config{
+		UserAPIURL: "http://localhost:8080",
+		APIKeys: []config.APIKey{
+			{ID: "acme-admin", Secret: "acme-admin-secret", Tenant: "acme", Admin: true},
+			{ID: "globex", Secret: "globex-secret", Tenant: "globex"},
+			{ID: "internal", Secret: "internal-secret", Admin: true},
+		},
+	}, nil, nil)
+
+	do := func(method, path, secret, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("X-API-Key", secret)
+		return fakeRequest(app, req)
+	}
+
+	// un admin atado a acme no crea keys de otro tenant
+	res := do(http.MethodPost, "/v1/admin/apikeys", "acme-admin-secret", `{"name":"escalated","tenant":"globex"}`)
+	require.Equal(t, http.StatusForbidden, res.Code)
+	require.Contains(t, res.Body.String(), `"code":"tenant_not_allowed"`)
+	res = do(http.MethodPost, "/v1/admin/apikeys", "acme-admin-secret", `{"name":"mine","tenant":"acme"}`)
+	require.Equal(t, http.StatusCreated, res.Code)
+	var created struct {
+		ID     string `json:"id"`
+		Tenant string `json:"tenant"`
+	}
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &created))
+	require.Equal(t, "acme", created.Tenant)
+
+	// ni ve, mide o revoca las de los demás
+	res = do(http.MethodGet, "/v1/admin/apikeys", "acme-admin-secret", "")
+	require.Equal(t, http.StatusOK, res.Code)
+	var list struct {
+		Results []struct {
+			ID string `json:"id"`
+		} `json:"results"`
+	}
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &list))
+	var ids []string
+	for _, k := range list.Results {
+		ids = append(ids, k.ID)
+	}
+	require.ElementsMatch(t, []string{"acme-admin", created.ID}, ids)
+
+	require.Equal(t, http.StatusNotFound, do(http.MethodGet, "/v1/admin/keys/globex/usage", "acme-admin-secret", "").Code)
+	require.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/v1/admin/apikeys/globex", "acme-admin-secret", "").Code)
+	require.Equal(t, http.StatusOK, do(http.MethodGet, "/v1/sales?status=approved", "globex-secret", "").Code)
+	require.Equal(t, http.StatusOK, do(http.MethodGet, "/v1/admin/keys/"+created.ID+"/usage", "acme-admin-secret", "").Code)
+
+	// su bundle solo lleva las keys de acme, y no puede importar umbrales globales
+	res = do(http.MethodGet, "/v1/admin/config", "acme-admin-secret", "")
+	require.Equal(t, http.StatusOK, res.Code)
+	require.NotContains(t, res.Body.String(), `"globex"`)
+	require.NotContains(t, res.Body.String(), `"internal"`)
+	res = do(http.MethodPost, "/v1/admin/config/import", "acme-admin-secret", `{"version":1,"thresholds":{"channel_notify":0}}`)
+	require.Equal(t, http.StatusForbidden, res.Code)
+	require.Contains(t, res.Body.String(), `"code":"unbound_admin_required"`)
+
+	// el admin sin tenant sigue administrando todas
+	res = do(http.MethodGet, "/v1/admin/apikeys", "internal-secret", "")
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &list))
+	require.Len(t, list.Results, 4)
+	require.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/v1/admin/apikeys/globex", "internal-secret", "").Code)
+}
+
+func TestIntegrationAsyncCreateSale(t *testing.T) {
+	app := gin.Default()
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+	initRoutes(t, app, config.Config{UserAPIURL: srv.URL, AsyncWorkers: 1, AsyncQueueSize: 10}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBufferString(`{"name":"Ayrton"}`))
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+	var resUser *user.User
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &resUser))
+
+	poll := func(body string) map[string]any {
+		req, _ := http.NewRequest(http.MethodPost, "/v1/sales", bytes.NewBufferString(body))
+		req.Header.Set("Prefer", "respond-async")
+		res := fakeRequest(app, req)
+		require.Equal(t, http.StatusAccepted, res.Code)
+		location := res.Header().Get("Location")
+		require.Contains(t, location, "/v1/sales/jobs/")
+
+		var job map[string]any
+		require.Eventually(t, func() bool {
+			req, _ := http.NewRequest(http.MethodGet, location, nil)
+			res := fakeRequest(app, req)
+			require.Equal(t, http.StatusOK, res.Code)
+			job = map[string]any{}
+			require.NoError(t, json.Unmarshal(res.Body.Bytes(), &job))
+			return job["status"] == "succeeded" || job["status"] == "failed"
+		}, 2*time.Second, 10*time.Millisecond)
+		return job
+	}
+
+	job := poll(`{"user_id":"` + resUser.ID + `","amount":10}`)
+	require.Equal(t, "succeeded", job["status"])
+	require.Equal(t, resUser.ID, job["sale"].(map[string]any)["user_id"])
+
+	job = poll(`{"user_id":"missing","amount":10}`)
+	require.Equal(t, "failed", job["status"])
+	require.Equal(t, "user_not_found", job["error"].(map[string]any)["code"])
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/sales/jobs/unknown", nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusNotFound, res.Code)
+}
+
+func TestIntegrationDebugHandler(t *testing.T) {
+	debug := api.DebugHandler()
+
+	req, _ := http.NewRequest(http.MethodGet, "/debug/pprof/goroutine?debug=1", nil)
+	res := httptest.NewRecorder()
+	debug.ServeHTTP(res, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Contains(t, res.Body.String(), "goroutine profile")
+
+	req, _ = http.NewRequest(http.MethodGet, "/debug/vars", nil)
+	res = httptest.NewRecorder()
+	debug.ServeHTTP(res, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Contains(t, res.Body.String(), `"goroutines"`)
+}
+
+func TestIntegrationConfigReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sales-api.env")
+	writeConfig := func(content string) {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+	writeConfig("# quotas de prueba\nAPI_KEYS=shop:shop-secret:2\nCONFIG_RELOAD_INTERVAL=10ms\n")
+	t.Setenv("CONFIG_FILE", path)
+	t.Cleanup(func() {
+		os.Unsetenv("API_KEYS")
+		os.Unsetenv("CONFIG_RELOAD_INTERVAL")
+	})
+
+	cfg, err := config.Load()
+	require.NoError(t, err)
+	require.Len(t, cfg.APIKeys, 1)
+
+	app := gin.Default()
+	initRoutes(t, app, cfg, nil, nil)
+
+	listUsers := func() int {
+		req, _ := http.NewRequest(http.MethodGet, "/v1/users", nil)
+		req.Header.Set("X-API-Key", "shop-secret")
+		return fakeRequest(app, req).Code
+	}
+	for _, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		require.Equal(t, want, listUsers())
+	}
+
+	// la nueva cuota se aplica sin reiniciar ni perder los datos
+	writeConfig("API_KEYS=shop:shop-secret:100\nCONFIG_RELOAD_INTERVAL=10ms\n")
+	require.Eventually(t, func() bool {
+		return listUsers() == http.StatusOK
+	}, 2*time.Second, 20*time.Millisecond)
+
+	// quitar la key la revoca, y volver a listarla la habilita otra vez
+	writeConfig("API_KEYS=other:other-secret\nCONFIG_RELOAD_INTERVAL=10ms\n")
+	require.Eventually(t, func() bool {
+		return listUsers() == http.StatusUnauthorized
+	}, 2*time.Second, 20*time.Millisecond)
+	writeConfig("API_KEYS=shop:shop-secret:100,other:other-secret\nCONFIG_RELOAD_INTERVAL=10ms\n")
+	require.Eventually(t, func() bool {
+		return listUsers() == http.StatusOK
+	}, 2*time.Second, 20*time.Millisecond)
+}
+
+func TestIntegrationVersion(t *testing.T) {
+	app := gin.Default()
+	initRoutes(t, app, config.Config{UserAPIURL: "http://localhost:8080"}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodGet, "/version", nil)
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+
+	var version map[string]string
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &version))
+	require.Equal(t, "dev", version["version"])
+	require.NotEmpty(t, version["go_version"])
+}
+
+func TestIntegrationErrorCatalog(t *testing.T) {
+	app := gin.Default()
+	initRoutes(t, app, config.Config{UserAPIURL: "http://localhost:8080"}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodGet, "/errors", nil)
+	req.Header.Set("Accept-Language", "es")
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+
+	var catalog struct {
+		Results []struct {
+			Code        string `json:"code"`
+			Status      int    `json:"status"`
+			Description string `json:"description"`
+		} `json:"results"`
+	}
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &catalog))
+	byCode := map[string]int{}
+	for _, e := range catalog.Results {
+		byCode[e.Code] = e.Status
+		if e.Code == "sale_not_found" {
+			require.Equal(t, "venta no encontrada", e.Description)
+		}
+	}
+	require.Equal(t, http.StatusNotFound, byCode["sale_not_found"])
+	require.Equal(t, http.StatusServiceUnavailable, byCode["user_api_unavailable"])
+	require.Equal(t, http.StatusBadRequest, byCode["invalid_request_body"])
+	require.NotContains(t, byCode, "empty_sale_id")
+}
+
+func TestIntegrationXMLResponses(t *testing.T) {
+	app := gin.Default()
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+	initRoutes(t, app, config.Config{UserAPIURL: srv.URL}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBufferString(`{"name":"Ayrton"}`))
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+	var resUser *user.User
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &resUser))
+
+	req, _ = http.NewRequest(http.MethodPost, "/v1/sales", bytes.NewBufferString(`{"user_id":"`+resUser.ID+`","amount":10.5}`))
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+	var resSale *sales.Sale
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &resSale))
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/sales/"+resSale.ID, nil)
+	req.Header.Set("Accept", "application/xml")
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Contains(t, res.Header().Get("Content-Type"), "application/xml")
+
+	var xmlSale struct {
+		XMLName xml.Name `xml:"sale"`
+		ID      string   `xml:"id"`
+		UserID  string   `xml:"user_id"`
+		Amount  string   `xml:"amount"`
+	}
+	require.NoError(t, xml.Unmarshal(res.Body.Bytes(), &xmlSale))
+	require.Equal(t, resSale.ID, xmlSale.ID)
+	require.Equal(t, resUser.ID, xmlSale.UserID)
+	require.Equal(t, "10.50", xmlSale.Amount)
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/sales?user_id="+resUser.ID, nil)
+	req.Header.Set("Accept", "application/xml")
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	var xmlPage struct {
+		Sales []struct {
+			ID string `xml:"id"`
+		} `xml:"data>sale"`
+		Total  int    `xml:"meta>total"`
+		Amount string `xml:"meta>totals>total_amount"`
+	}
+	require.NoError(t, xml.Unmarshal(res.Body.Bytes(), &xmlPage))
+	require.Len(t, xmlPage.Sales, 1)
+	require.Equal(t, resSale.ID, xmlPage.Sales[0].ID)
+	require.Equal(t, 1, xmlPage.Total)
+	require.Equal(t, "10.50", xmlPage.Amount)
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/users", nil)
+	req.Header.Set("Accept", "application/xml")
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Contains(t, res.Body.String(), "<data><user><id>"+resUser.ID+"</id>")
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/sales/missing", nil)
+	req.Header.Set("Accept", "application/xml")
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusNotFound, res.Code)
+	require.Equal(t, "application/problem+xml", res.Header().Get("Content-Type"))
+	require.Contains(t, res.Body.String(), "<code>sale_not_found</code>")
+
+	// sin Accept se sigue respondiendo JSON
+	req, _ = http.NewRequest(http.MethodGet, "/v1/sales/"+resSale.ID, nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Contains(t, res.Header().Get("Content-Type"), "application/json")
+}
+
+func TestIntegrationMsgpackResponses(t *testing.T) {
+	app := gin.Default()
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+	initRoutes(t, app, config.Config{UserAPIURL: srv.URL}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBufferString(`{"name":"Ayrton"}`))
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+	var resUser *user.User
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &resUser))
+
+	for _, amount := range []string{"10.5", "20"} {
+		req, _ = http.NewRequest(http.MethodPost, "/v1/sales", bytes.NewBufferString(`{"user_id":"`+resUser.ID+`","amount":`+amount+`}`))
+		require.Equal(t, http.StatusCreated, fakeRequest(app, req).Code)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/sales?user_id="+resUser.ID, nil)
+	req.Header.Set("Accept", "application/msgpack")
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Equal(t, "application/msgpack", res.Header().Get("Content-Type"))
+
+	var page struct {
+		Data []struct {
+			UserID    string    `msgpack:"user_id"`
+			Amount    string    `msgpack:"amount"`
+			CreatedAt time.Time `msgpack:"created_at"`
+		} `msgpack:"data"`
+		Meta struct {
+			Total int `msgpack:"total"`
+		} `msgpack:"meta"`
+	}
+	require.NoError(t, msgpack.Unmarshal(res.Body.Bytes(), &page))
+	require.Equal(t, 2, page.Meta.Total)
+	require.Len(t, page.Data, 2)
+	require.Equal(t, resUser.ID, page.Data[0].UserID)
+	require.ElementsMatch(t, []string{"10.50", "20.00"}, []string{page.Data[0].Amount, page.Data[1].Amount})
+	require.False(t, page.Data[0].CreatedAt.IsZero())
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/sales/stream?user_id="+resUser.ID, nil)
+	req.Header.Set("Accept", "application/msgpack")
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Equal(t, "application/msgpack", res.Header().Get("Content-Type"))
+
+	dec := msgpack.NewDecoder(res.Body)
+	streamed := 0
+	for {
+		var sale map[string]any
+		if err := dec.Decode(&sale); err != nil {
+			break
+		}
+		require.Equal(t, resUser.ID, sale["user_id"])
+		streamed++
+	}
+	require.Equal(t, 2, streamed)
+}
+
+func TestIntegrationSaleLinks(t *testing.T) {
+	app := gin.Default()
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+	initRoutes(t, app, config.Config{UserAPIURL: srv.URL}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBufferString(`{"name":"Ayrton"}`))
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+	var resUser *user.User
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &resUser))
+
+	type links map[string]struct {
+		Href   string `json:"href"`
+		Method string `json:"method"`
+	}
+	var sale struct {
+		ID                  string    `json:"id"`
+		Status              string    `json:"status"`
+		StatusChangedAt     time.Time `json:"status_changed_at"`
+		AgeSeconds          *int64    `json:"age_seconds"`
+		TimeInCurrentStatus *int64    `json:"time_in_current_status"`
+		Links               links     `json:"_links"`
+	}
+
+	// se crean ventas hasta tener una pendiente, el estado inicial es aleatorio
+	require.Eventually(t, func() bool {
+		req, _ := http.NewRequest(http.MethodPost, "/v1/sales", bytes.NewBufferString(`{"user_id":"`+resUser.ID+`","amount":10}`))
+		res := fakeRequest(app, req)
+		require.Equal(t, http.StatusCreated, res.Code)
+		require.NoError(t, json.Unmarshal(res.Body.Bytes(), &sale))
+		return sale.Status == "pending"
+	}, 2*time.Second, time.Millisecond)
+
+	require.Equal(t, "/v1/sales/"+sale.ID, sale.Links["self"].Href)
+	require.Equal(t, "/v1/users/"+resUser.ID, sale.Links["user"].Href)
+	require.Equal(t, http.MethodPatch, sale.Links["approve"].Method)
+	require.Equal(t, http.MethodPatch, sale.Links["reject"].Method)
+	require.Equal(t, "/v1/sales/"+sale.ID+"/claim", sale.Links["claim"].Href)
+	require.NotNil(t, sale.AgeSeconds)
+	require.NotNil(t, sale.TimeInCurrentStatus)
+	created := sale.StatusChangedAt
+	require.False(t, created.IsZero())
+
+	req, _ = http.NewRequest(sale.Links["approve"].Method, sale.Links["approve"].Href, bytes.NewBufferString(`{"status":"approved"}`))
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	sale.Links = nil
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &sale))
+	require.Equal(t, "approved", sale.Status)
+	require.False(t, sale.StatusChangedAt.Before(created))
+	require.Contains(t, sale.Links, "self")
+	require.NotContains(t, sale.Links, "approve")
+	require.NotContains(t, sale.Links, "reject")
+	require.NotContains(t, sale.Links, "claim")
+}
+
+func TestIntegrationOnboarding(t *testing.T) {
+	app := gin.Default()
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+	initRoutes(t, app, config.Config{UserAPIURL: srv.URL}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/onboarding", bytes.NewBufferString(`{"name":"Ayrton","email":"ayrton@example.com","amount":25}`))
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+
+	var body struct {
+		User *user.User  `json:"user"`
+		Sale *sales.Sale `json:"sale"`
+	}
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &body))
+	require.Equal(t, "Ayrton", body.User.Name)
+	require.Equal(t, body.User.ID, body.Sale.UserID)
+	require.Equal(t, "25.00", body.Sale.Amount.String())
+
+	req, _ = http.NewRequest(http.MethodPost, "/v1/onboarding", bytes.NewBufferString(`{"name":"Ayrton","amount":0}`))
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusUnprocessableEntity, res.Code)
+}
+
+func TestIntegrationOnboardingCompensation(t *testing.T) {
+	// la API de usuarios no responde, así que la venta falla después de crear el usuario
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	app := gin.Default()
+	initRoutes(t, app, config.Config{UserAPIURL: down.URL}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/onboarding", bytes.NewBufferString(`{"name":"Ayrton","amount":25}`))
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusServiceUnavailable, res.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/users", nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	var page struct {
+		Meta struct {
+			Total int `json:"total"`
+		} `json:"meta"`
+	}
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &page))
+	require.Zero(t, page.Meta.Total)
+}
+
+func TestIntegrationCheckout(t *testing.T) {
+	app := gin.Default()
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+	initRoutes(t, app, config.Config{UserAPIURL: srv.URL, StatusSeed: 1}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBufferString(`{"name":"Ayrton"}`))
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+	var u user.User
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &u))
+
+	// el estado inicial es aleatorio: las ventas rechazadas al crearse no se cobran
+	var paid int
+	for range 10 {
+		req, _ = http.NewRequest(http.MethodPost, "/v1/checkout", bytes.NewBufferString(`{"user_id":"`+u.ID+`","amount":10}`))
+		res = fakeRequest(app, req)
+		if res.Code != http.StatusCreated {
+			require.Equal(t, http.StatusUnprocessableEntity, res.Code)
+			require.Contains(t, res.Body.String(), `"code":"sale_rejected"`)
+			continue
+		}
+		paid++
+
+		var body struct {
+			Saga struct {
+				ID     string `json:"id"`
+				Status string `json:"status"`
+			} `json:"saga"`
+			Sale *sales.Sale `json:"sale"`
+		}
+		require.NoError(t, json.Unmarshal(res.Body.Bytes(), &body))
+		require.Equal(t, "completed", body.Saga.Status)
+		require.Equal(t, sales.StatusApproved, body.Sale.Status)
+
+		req, _ = http.NewRequest(http.MethodGet, "/v1/admin/sagas/"+body.Saga.ID, nil)
+		res = fakeRequest(app, req)
+		require.Equal(t, http.StatusOK, res.Code)
+		require.Contains(t, res.Body.String(), `"status":"completed"`)
+	}
+	require.NotZero(t, paid)
+
+	req, _ = http.NewRequest(http.MethodPost, "/v1/checkout", bytes.NewBufferString(`{"user_id":"nobody","amount":10}`))
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusNotFound, res.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/admin/sagas/missing", nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusNotFound, res.Code)
+}
+
+func TestIntegrationSaleHistory(t *testing.T) {
+	app := gin.Default()
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+	initRoutes(t, app, config.Config{UserAPIURL: srv.URL, SalesStorage: "events", SalesSnapshotEvery: 10}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/onboarding", bytes.NewBufferString(`{"name":"Ayrton","amount":10}`))
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+	var body struct {
+		Sale *sales.Sale `json:"sale"`
+	}
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &body))
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/sales/"+body.Sale.ID+"/history", nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	var history struct {
+		Sale   *sales.Sale         `json:"sale"`
+		Events []sales.StreamEvent `json:"events"`
+	}
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &history))
+	require.Equal(t, body.Sale.ID, history.Sale.ID)
+	require.Len(t, history.Events, 1)
+	require.Equal(t, sales.StreamCreated, history.Events[0].Type)
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/sales/"+body.Sale.ID+"/history?at=yesterday", nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusBadRequest, res.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/sales/"+body.Sale.ID+"/history?at=2000-01-01T00:00:00Z", nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusNotFound, res.Code)
+}
+
+func TestIntegrationSalesStats(t *testing.T) {
+	app := gin.Default()
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+	initRoutes(t, app, config.Config{UserAPIURL: srv.URL}, nil, nil)
+
+	var userID string
+	for _, amount := range []string{"10", "15.50"} {
+		req, _ := http.NewRequest(http.MethodPost, "/v1/onboarding", bytes.NewBufferString(`{"name":"Ayrton","amount":`+amount+`}`))
+		res := fakeRequest(app, req)
+		require.Equal(t, http.StatusCreated, res.Code)
+		var body struct {
+			User *user.User `json:"user"`
+		}
+		require.NoError(t, json.Unmarshal(res.Body.Bytes(), &body))
+		userID = body.User.ID
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "/v1/sales/stats", nil)
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	var stats sales.SalesMetadata
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &stats))
+	require.Equal(t, 2, stats.Quantity)
+	require.Equal(t, "25.50", stats.TotalAmount.String())
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/sales/stats?user_id="+userID, nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &stats))
+	require.Equal(t, 1, stats.Quantity)
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/sales/stats?buckets=12,20", nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	var withDistribution struct {
+		Distribution sales.Distribution `json:"distribution"`
+	}
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &withDistribution))
+	d := withDistribution.Distribution
+	require.InEpsilon(t, 1000, float64(d.P50), 0.01)
+	require.InEpsilon(t, 1550, float64(d.P99), 0.01)
+	require.Len(t, d.Buckets, 3)
+	require.Equal(t, 1, d.Buckets[0].Count)
+	require.Equal(t, 1, d.Buckets[1].Count)
+	require.Zero(t, d.Buckets[2].Count)
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/sales/stats?buckets=20,12", nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusBadRequest, res.Code)
+	require.Contains(t, res.Body.String(), `"code":"invalid_buckets"`)
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/sales/stats?status=unknown", nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusBadRequest, res.Code)
+}
+
+func TestIntegrationAggregateSales(t *testing.T) {
+	app := gin.Default()
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+	initRoutes(t, app, config.Config{UserAPIURL: srv.URL}, nil, nil)
+
+	var userIDs []string
+	for _, amount := range []string{"10", "15.50"} {
+		req, _ := http.NewRequest(http.MethodPost, "/v1/onboarding", bytes.NewBufferString(`{"name":"Ayrton","amount":`+amount+`}`))
+		res := fakeRequest(app, req)
+		require.Equal(t, http.StatusCreated, res.Code)
+		var body struct {
+			User *user.User `json:"user"`
+		}
+		require.NoError(t, json.Unmarshal(res.Body.Bytes(), &body))
+		userIDs = append(userIDs, body.User.ID)
+	}
+
+	var body struct {
+		GroupBy string             `json:"group_by"`
+		Groups  []sales.SalesGroup `json:"groups"`
+	}
+	req, _ := http.NewRequest(http.MethodGet, "/v1/sales/aggregate?group_by=day", nil)
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &body))
+	require.Equal(t, "day", body.GroupBy)
+	quantity := 0
+	for _, group := range body.Groups {
+		_, err := time.Parse(time.DateOnly, group.Key)
+		require.NoError(t, err)
+		quantity += group.Quantity
+	}
+	require.Equal(t, 2, quantity)
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/sales/aggregate?group_by=user_id&user_id="+userIDs[1], nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &body))
+	require.Len(t, body.Groups, 1)
+	require.Equal(t, userIDs[1], body.Groups[0].Key)
+	require.Equal(t, "15.50", body.Groups[0].TotalAmount.String())
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/sales/aggregate?group_by=status", nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &body))
+	quantity = 0
+	for _, group := range body.Groups {
+		quantity += group.Quantity
+	}
+	require.Equal(t, 2, quantity)
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/sales/aggregate", nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusBadRequest, res.Code)
+	require.Contains(t, res.Body.String(), `"code":"invalid_group_by"`)
+}
+
+func TestIntegrationUserAPIFaults(t *testing.T) {
+	app := gin.Default()
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+	initRoutes(t, app, config.Config{UserAPIURL: srv.URL, UserAPIFaults: faults.Config{ErrorRate: 1}}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBufferString(`{"name":"Ayrton"}`))
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+	var u user.User
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &u))
+
+	// la API de usuarios funciona, pero la validación recibe fallas inyectadas
+	req, _ = http.NewRequest(http.MethodPost, "/v1/sales", bytes.NewBufferString(`{"user_id":"`+u.ID+`","amount":10}`))
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusServiceUnavailable, res.Code)
+	require.Contains(t, res.Body.String(), `"code":"user_api_unavailable"`)
+}
+
+func TestIntegrationRequestLimits(t *testing.T) {
+	app := gin.Default()
+	initRoutes(t, app, config.Config{UserAPIURL: "http://localhost:8080", MaxBodyBytes: 1024}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBufferString(`{"name":"`+strings.Repeat("a", 2048)+`"}`))
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusRequestEntityTooLarge, res.Code)
+	require.Contains(t, res.Body.String(), `"code":"body_too_large"`)
+
+	req, _ = http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBufferString(`{"name":`+strings.Repeat("[", 100)+`}`))
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusBadRequest, res.Code)
+	require.Contains(t, res.Body.String(), `"code":"body_too_deep"`)
+
+	req, _ = http.NewRequest(http.MethodPost, "/v1/sales", bytes.NewBufferString(`{"user_id":"u1","amount_cents":9223372036854775807}`))
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusUnprocessableEntity, res.Code)
+	require.Contains(t, res.Body.String(), `"code":"amount_too_large"`)
+}
+
+// panicReporter records the panics reported to it.
+type panicReporter struct {
+	panics []any
+	tags   []map[string]string
+}
+
+func (r *panicReporter) CaptureError(error, map[string]string) {}
+
+func (r *panicReporter) CapturePanic(value any, tags map[string]string) {
+	r.panics = append(r.panics, value)
+	r.tags = append(r.tags, tags)
+}
+
+func (r *panicReporter) Flush(time.Duration) bool { return true }
+
+func TestIntegrationPanicRecovery(t *testing.T) {
+	reporter := &panicReporter{}
+	app := gin.New()
+	initRoutes(t, app, config.Config{UserAPIURL: "http://localhost:8080"}, reporter, nil)
+	app.GET("/boom", func(*gin.Context) { panic("boom") })
+
+	req, _ := http.NewRequest(http.MethodGet, "/boom", nil)
+	req.Header.Set("X-Request-ID", "req-1")
+	res := fakeRequest(app, req)
+
+	require.Equal(t, http.StatusInternalServerError, res.Code)
+	require.Equal(t, "application/problem+json", res.Header().Get("Content-Type"))
+	require.Contains(t, res.Body.String(), `"code":"internal_error"`)
+	require.NotContains(t, res.Body.String(), "boom")
+	require.Equal(t, []any{"boom"}, reporter.panics)
+	require.Equal(t, "req-1", reporter.tags[0]["request_id"])
+}
+
+func TestIntegrationCreateSaleUserAPIBudget(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	app := gin.Default()
+	initRoutes(t, app, config.Config{UserAPIURL: srv.URL, WriteTimeout: 5 * time.Second, UserAPIBudget: 50 * time.Millisecond}, nil, nil)
+
+	start := time.Now()
+	req, _ := http.NewRequest(http.MethodPost, "/v1/sales", bytes.NewBufferString(`{"user_id":"slow","amount":10}`))
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusGatewayTimeout, res.Code)
+	require.Contains(t, res.Body.String(), `"code":"user_api_timeout"`)
+	require.Less(t, time.Since(start), time.Second)
+}
+
+func TestIntegrationApproveRejectSale(t *testing.T) {
+	app := gin.Default()
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+	initRoutes(t, app, config.Config{UserAPIURL: srv.URL}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBufferString(`{"name":"Ayrton"}`))
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+	var resUser *user.User
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &resUser))
+
+	// ventas pendientes, el estado inicial es aleatorio
+	pending := func() string {
+		var sale sales.Sale
+		require.Eventually(t, func() bool {
+			req, _ := http.NewRequest(http.MethodPost, "/v1/sales", bytes.NewBufferString(`{"user_id":"`+resUser.ID+`","amount":10}`))
+			res := fakeRequest(app, req)
+			require.Equal(t, http.StatusCreated, res.Code)
+			require.NoError(t, json.Unmarshal(res.Body.Bytes(), &sale))
+			return sale.Status == sales.StatusPending
+		}, 2*time.Second, time.Millisecond)
+		return sale.ID
+	}
+
+	id := pending()
+	req, _ = http.NewRequest(http.MethodPost, "/v1/sales/"+id+"/reject", bytes.NewBufferString(`{"reason":"duplicated"}`))
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	var got sales.Sale
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &got))
+	require.Equal(t, sales.StatusRejected, got.Status)
+	require.Equal(t, "duplicated", got.StatusReason)
+
+	// ya no está pendiente
+	req, _ = http.NewRequest(http.MethodPost, "/v1/sales/"+id+"/approve", nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusConflict, res.Code)
+
+	// sin cuerpo
+	id = pending()
+	req, _ = http.NewRequest(http.MethodPost, "/v1/sales/"+id+"/approve", nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	got = sales.Sale{}
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &got))
+	require.Equal(t, sales.StatusApproved, got.Status)
+	require.Empty(t, got.StatusReason)
+}
+
+func TestIntegrationRejectionReasons(t *testing.T) {
+	app := gin.Default()
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+	initRoutes(t, app, config.Config{UserAPIURL: srv.URL, RejectionReasons: []string{"fraud", "duplicated"}}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBufferString(`{"name":"Ayrton"}`))
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+	var resUser *user.User
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &resUser))
+
+	var sale sales.Sale
+	require.Eventually(t, func() bool {
+		req, _ := http.NewRequest(http.MethodPost, "/v1/sales", bytes.NewBufferString(`{"user_id":"`+resUser.ID+`","amount":10}`))
+		res := fakeRequest(app, req)
+		require.Equal(t, http.StatusCreated, res.Code)
+		require.NoError(t, json.Unmarshal(res.Body.Bytes(), &sale))
+		return sale.Status == sales.StatusPending
+	}, 2*time.Second, time.Millisecond)
+
+	req, _ = http.NewRequest(http.MethodPost, "/v1/sales/"+sale.ID+"/reject", nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusBadRequest, res.Code)
+	require.Contains(t, res.Body.String(), `"code":"invalid_rejection_reason"`)
+
+	req, _ = http.NewRequest(http.MethodPatch, "/v1/sales/"+sale.ID, bytes.NewBufferString(`{"status":"rejected","rejection_reason":"fraud"}`))
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Contains(t, res.Body.String(), `"rejection_reason":"fraud"`)
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/sales?rejection_reason=fraud", nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	var page struct {
+		Data []sales.Sale `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &page))
+	require.Len(t, page.Data, 1)
+	require.Equal(t, sale.ID, page.Data[0].ID)
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/sales?rejection_reason=duplicated", nil)
+	res = fakeRequest(app, req)
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &page))
+	require.Empty(t, page.Data)
+}
+
+func TestIntegrationPatchSaleFields(t *testing.T) {
+	app := gin.Default()
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+	initRoutes(t, app, config.Config{UserAPIURL: srv.URL}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBufferString(`{"name":"Ayrton"}`))
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+	var resUser *user.User
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &resUser))
+
+	req, _ = http.NewRequest(http.MethodPost, "/v1/sales", bytes.NewBufferString(`{"user_id":"`+resUser.ID+`","amount":10}`))
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+	var sale sales.Sale
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &sale))
+
+	req, _ = http.NewRequest(http.MethodPatch, "/v1/sales/"+sale.ID, bytes.NewBufferString(`{"tags":["vip"],"notes":"gift"}`))
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	var got sales.Sale
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &got))
+	require.Equal(t, []string{"vip"}, got.Tags)
+	require.Equal(t, "gift", got.Notes)
+	require.Equal(t, sale.Version+1, got.Version)
+
+	// con máscara, los campos nombrados y ausentes se borran
+	req, _ = http.NewRequest(http.MethodPatch, "/v1/sales/"+sale.ID, bytes.NewBufferString(`{"update_mask":["notes"]}`))
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	got = sales.Sale{}
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &got))
+	require.Empty(t, got.Notes)
+	require.Equal(t, []string{"vip"}, got.Tags)
+
+	req, _ = http.NewRequest(http.MethodPatch, "/v1/sales/"+sale.ID, bytes.NewBufferString(`{"update_mask":["amount"]}`))
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusBadRequest, res.Code)
+	require.Contains(t, res.Body.String(), `"code":"unknown_sale_field"`)
+
+	if sale.Status != sales.StatusPending {
+		req, _ = http.NewRequest(http.MethodPatch, "/v1/sales/"+sale.ID, bytes.NewBufferString(`{"metadata":{"channel":"web"}}`))
+		res = fakeRequest(app, req)
+		require.Equal(t, http.StatusConflict, res.Code)
+		require.Contains(t, res.Body.String(), `"code":"immutable_sale_field"`)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/sales/"+sale.ID, nil)
+	req.Header.Set("Accept", "application/xml")
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Contains(t, res.Body.String(), "<tag>vip</tag>")
+}
+
+func TestIntegrationReplaceUser(t *testing.T) {
+	app := gin.Default()
+	initRoutes(t, app, config.Config{UserAPIURL: "http://localhost:8080"}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBufferString(`{"name":"Ayrton","address":"Calle 1","nickname":"Senna","email":"a@example.com"}`))
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+	var created user.User
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &created))
+
+	req, _ = http.NewRequest(http.MethodPut, "/v1/users/"+created.ID, bytes.NewBufferString(`{"name":"Ayrton Senna","email":"senna@example.com"}`))
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	var replaced user.User
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &replaced))
+	require.Equal(t, "Ayrton Senna", replaced.Name)
+	require.Equal(t, "senna@example.com", replaced.Email)
+	require.Empty(t, replaced.Address)
+	require.Empty(t, replaced.NickName)
+	require.Equal(t, created.Version+1, replaced.Version)
+
+	req, _ = http.NewRequest(http.MethodPut, "/v1/users/"+created.ID, bytes.NewBufferString(`{"name":"Ayrton","nick_name":"Senna"}`))
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusBadRequest, res.Code)
+	require.Contains(t, res.Body.String(), `"code":"unknown_field"`)
+
+	req, _ = http.NewRequest(http.MethodPut, "/v1/users/missing", bytes.NewBufferString(`{"name":"Ayrton"}`))
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusNotFound, res.Code)
+}
+
+func TestIntegrationImportUsers(t *testing.T) {
+	app := gin.Default()
+	initRoutes(t, app, config.Config{UserAPIURL: "http://localhost:8080"}, nil, nil)
+
+	type result struct {
+		Row    int    `json:"row"`
+		Status string `json:"status"`
+		ID     string `json:"id"`
+		Code   string `json:"code"`
+	}
+	var resp struct {
+		Created int      `json:"created"`
+		Failed  int      `json:"failed"`
+		Results []result `json:"results"`
+	}
+
+	csvBody := "name,email\nAyrton,ayrton@example.com\n,nobody@example.com\nChiche,not-an-email\n"
+	req, _ := http.NewRequest(http.MethodPost, "/v1/users/import", bytes.NewBufferString(csvBody))
+	req.Header.Set("Content-Type", "text/csv")
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &resp))
+	require.Equal(t, 1, resp.Created)
+	require.Equal(t, 2, resp.Failed)
+	require.Equal(t, "created", resp.Results[0].Status)
+	require.Equal(t, "name_required", resp.Results[1].Code)
+	require.Equal(t, "invalid_email", resp.Results[2].Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/users/"+resp.Results[0].ID, nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+
+	req, _ = http.NewRequest(http.MethodPost, "/v1/users/import", bytes.NewBufferString(`[{"name":"Pringles","nickname":"P"}]`))
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &resp))
+	require.Equal(t, 1, resp.Created)
+
+	req, _ = http.NewRequest(http.MethodPost, "/v1/users/import", bytes.NewBufferString("name,phone\nAyrton,123\n"))
+	req.Header.Set("Content-Type", "text/csv")
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusBadRequest, res.Code)
+	require.Contains(t, res.Body.String(), `"code":"invalid_import"`)
+
+	// el alta de a uno valida lo mismo que la importación
+	for body, code := range map[string]string{`{"email":"nobody@example.com"}`: "name_required", `{"name":"Chiche","email":"not-an-email"}`: "invalid_email"} {
+		req, _ = http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBufferString(body))
+		res = fakeRequest(app, req)
+		require.Equal(t, http.StatusBadRequest, res.Code, body)
+		require.Contains(t, res.Body.String(), `"code":"`+code+`"`, body)
+	}
+}
+
+func TestIntegrationUserAddress(t *testing.T) {
+	app := gin.Default()
+	initRoutes(t, app, config.Config{UserAPIURL: "http://localhost:8080"}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBufferString(`{"name":"Ayrton","address":{"street":"Av. Corrientes 1234","city":"CABA","province":"Buenos Aires","postal_code":"c1043aaz","country":"ar"}}`))
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+	require.Contains(t, res.Body.String(), `"address":{"street":"Av. Corrientes 1234","city":"CABA","province":"Buenos Aires","postal_code":"C1043AAZ","country":"AR"}`)
+	var created user.User
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &created))
+
+	// una dirección de una sola línea se toma como la calle
+	req, _ = http.NewRequest(http.MethodPatch, "/v1/users/"+created.ID, bytes.NewBufferString(`{"address":"Calle Falsa 123"}`))
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Contains(t, res.Body.String(), `"address":{"street":"Calle Falsa 123"}`)
+
+	req, _ = http.NewRequest(http.MethodPut, "/v1/users/"+created.ID, bytes.NewBufferString(`{"name":"Ayrton","address":{"postal_code":"1900","country":"US"}}`))
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusBadRequest, res.Code)
+	require.Contains(t, res.Body.String(), `"code":"invalid_postal_code"`)
+
+	req, _ = http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBufferString(`{"name":"Ayrton","address":{"country":"ZZ"}}`))
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusBadRequest, res.Code)
+	require.Contains(t, res.Body.String(), `"code":"invalid_country"`)
+
+	req, _ = http.NewRequest(http.MethodPost, "/v1/users/import", bytes.NewBufferString("name,street,city,postal_code,country\nAna,Calle 1,Tandil,7000,AR\nBeto,Calle 2,Chicago,7000,US\n"))
+	req.Header.Set("Content-Type", "text/csv")
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Contains(t, res.Body.String(), `"created":1,"failed":1`)
+	require.Contains(t, res.Body.String(), `"code":"invalid_postal_code"`)
+}
+
+func TestIntegrationVerifyUser(t *testing.T) {
+	app := gin.Default()
+	initRoutes(t, app, config.Config{UserAPIURL: "http://localhost:8080"}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBufferString(`{"name":"Ayrton","email":"a@example.com"}`))
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+	require.Contains(t, res.Body.String(), `"email_verified":false`)
+	var created user.User
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &created))
+
+	req, _ = http.NewRequest(http.MethodPost, "/v1/users/"+created.ID+"/verify", bytes.NewBufferString(`{"token":"guess"}`))
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusBadRequest, res.Code)
+	require.Contains(t, res.Body.String(), `"code":"invalid_verification"`)
+
+	req, _ = http.NewRequest(http.MethodPost, "/v1/users/missing/verify", bytes.NewBufferString(`{"token":"guess"}`))
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusNotFound, res.Code)
+
+	// con REQUIRE_VERIFIED_USERS los usuarios sin verificar no pueden comprar
+	app = gin.Default()
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+	initRoutes(t, app, config.Config{UserAPIURL: srv.URL, RequireVerifiedUsers: true}, nil, nil)
+
+	req, _ = http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBufferString(`{"name":"Ayrton","email":"a@example.com"}`))
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &created))
+
+	req, _ = http.NewRequest(http.MethodPost, "/v1/sales", bytes.NewBufferString(`{"user_id":"`+created.ID+`","amount":10.5}`))
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusUnprocessableEntity, res.Code)
+	require.Contains(t, res.Body.String(), `"code":"user_not_verified"`)
+}
+
+func TestIntegrationBlockUser(t *testing.T) {
+	app := gin.Default()
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+	initRoutes(t, app, config.Config{
+		UserAPIURL: srv.URL,
+		UserAPIKey: "risk-secret",
+		APIKeys:    []config.APIKey{{ID: "risk-team", Secret: "risk-secret"}},
+	}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBufferString(`{"name":"Ayrton"}`))
+	req.Header.Set("X-API-Key", "risk-secret")
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+	var created user.User
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &created))
+
+	req, _ = http.NewRequest(http.MethodPost, "/v1/users/"+created.ID+"/block", bytes.NewBufferString(`{}`))
+	req.Header.Set("X-API-Key", "risk-secret")
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusBadRequest, res.Code)
+	require.Contains(t, res.Body.String(), `"code":"block_reason_required"`)
+
+	req, _ = http.NewRequest(http.MethodPost, "/v1/users/"+created.ID+"/block", bytes.NewBufferString(`{"reason":"chargeback","actor":"someone-else"}`))
+	req.Header.Set("X-API-Key", "risk-secret")
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	// el bloqueo queda a nombre de la clave, no de quien diga el cuerpo
+	require.Contains(t, res.Body.String(), `"blocked":true,"block_reason":"chargeback","blocked_by":"apikey:risk-team"`)
+
+	sale := `{"user_id":"` + created.ID + `","amount":10.5}`
+	req, _ = http.NewRequest(http.MethodPost, "/v1/sales", bytes.NewBufferString(sale))
+	req.Header.Set("X-API-Key", "risk-secret")
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusUnprocessableEntity, res.Code)
+	require.Contains(t, res.Body.String(), `"code":"user_blocked"`)
+
+	req, _ = http.NewRequest(http.MethodPost, "/v1/users/"+created.ID+"/unblock", bytes.NewBufferString(`{"reason":"dispute resolved"}`))
+	req.Header.Set("X-API-Key", "risk-secret")
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Contains(t, res.Body.String(), `"blocked":false`)
+
+	req, _ = http.NewRequest(http.MethodPost, "/v1/sales", bytes.NewBufferString(sale))
+	req.Header.Set("X-API-Key", "risk-secret")
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+}
+
+func TestIntegrationUpdateUserIfMatch(t *testing.T) {
+	app := gin.Default()
+	initRoutes(t, app, config.Config{UserAPIURL: "http://localhost:8080"}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBufferString(`{"name":"Ayrton"}`))
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+	var created user.User
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &created))
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/users/"+created.ID, nil)
+	res = fakeRequest(app, req)
+	etag := res.Header().Get("ETag")
+	require.Equal(t, `"v1"`, etag)
+
+	req, _ = http.NewRequest(http.MethodPatch, "/v1/users/"+created.ID, bytes.NewBufferString(`{"name":"Senna"}`))
+	req.Header.Set("If-Match", etag)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Equal(t, `"v2"`, res.Header().Get("ETag"))
+
+	// el segundo admin editó sobre la versión 1
+	req, _ = http.NewRequest(http.MethodPatch, "/v1/users/"+created.ID, bytes.NewBufferString(`{"name":"Prost"}`))
+	req.Header.Set("If-Match", etag)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusConflict, res.Code)
+	require.Contains(t, res.Body.String(), `"code":"user_version_mismatch"`)
+
+	req, _ = http.NewRequest(http.MethodPatch, "/v1/users/"+created.ID, bytes.NewBufferString(`{"name":"Prost","version":1}`))
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusConflict, res.Code)
+
+	req, _ = http.NewRequest(http.MethodPatch, "/v1/users/"+created.ID, bytes.NewBufferString(`{"name":"Prost"}`))
+	req.Header.Set("If-Match", "v2")
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusBadRequest, res.Code)
+	require.Contains(t, res.Body.String(), `"code":"invalid_if_match"`)
+
+	req, _ = http.NewRequest(http.MethodPatch, "/v1/users/"+created.ID, bytes.NewBufferString(`{"name":"Prost"}`))
+	req.Header.Set("If-Match", "*")
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+
+	// PUT y el bloqueo también respetan la versión leída
+	req, _ = http.NewRequest(http.MethodPut, "/v1/users/"+created.ID, bytes.NewBufferString(`{"name":"Lauda"}`))
+	req.Header.Set("If-Match", etag)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusConflict, res.Code)
+	req, _ = http.NewRequest(http.MethodPut, "/v1/users/"+created.ID, bytes.NewBufferString(`{"name":"Lauda","version":1}`))
+	require.Equal(t, http.StatusConflict, fakeRequest(app, req).Code)
+	req, _ = http.NewRequest(http.MethodPost, "/v1/users/"+created.ID+"/block", bytes.NewBufferString(`{"reason":"fraud"}`))
+	req.Header.Set("If-Match", etag)
+	require.Equal(t, http.StatusConflict, fakeRequest(app, req).Code)
+
+	req, _ = http.NewRequest(http.MethodPut, "/v1/users/"+created.ID, bytes.NewBufferString(`{"name":"Lauda"}`))
+	req.Header.Set("If-Match", `"v3"`)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Equal(t, `"v4"`, res.Header().Get("ETag"))
+}
+
+func TestIntegrationUserHistory(t *testing.T) {
+	app := gin.Default()
+	initRoutes(t, app, config.Config{UserAPIURL: "http://localhost:8080"}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBufferString(`{"name":"Ayrton","address":{"street":"Calle 1","city":"Tandil","country":"AR"}}`))
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+	var created user.User
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &created))
+
+	req, _ = http.NewRequest(http.MethodPatch, "/v1/users/"+created.ID, bytes.NewBufferString(`{"address":{"street":"Calle 1","city":"Azul","country":"AR"}}`))
+	require.Equal(t, http.StatusOK, fakeRequest(app, req).Code)
+	req, _ = http.NewRequest(http.MethodPost, "/v1/users/"+created.ID+"/block", bytes.NewBufferString(`{"reason":"chargeback"}`))
+	require.Equal(t, http.StatusOK, fakeRequest(app, req).Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/users/"+created.ID+"/history", nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	var body struct {
+		History []audit.Entry `json:"history"`
+	}
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &body))
+	require.Len(t, body.History, 3)
+	require.Equal(t, []string{"created", "updated", "blocked"}, []string{body.History[0].Action, body.History[1].Action, body.History[2].Action})
+	require.Equal(t, []audit.Change{{Field: "address.city", Before: "Tandil", After: "Azul"}}, body.History[1].Changes)
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/users/missing/history", nil)
+	require.Equal(t, http.StatusNotFound, fakeRequest(app, req).Code)
+}
+
+func TestIntegrationCreateUserExternalID(t *testing.T) {
+	app := gin.Default()
+	initRoutes(t, app, config.Config{UserAPIURL: "http://localhost:8080"}, nil, nil)
+
+	body := `{"name":"Ayrton","external_id":"crm-42"}`
+	req, _ := http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBufferString(body))
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+	var created user.User
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &created))
+	require.Equal(t, "crm-42", created.ExternalID)
+
+	req, _ = http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBufferString(body))
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	var retried user.User
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &retried))
+	require.Equal(t, created.ID, retried.ID)
+
+	req, _ = http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBufferString(`{"name":"Ayrton"}`))
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+}
+
+func TestIntegrationUserStorage(t *testing.T) {
+	initRoutes(t, gin.New(), config.Config{UserAPIURL: "http://localhost:8080", UserStorage: "memory"}, nil, nil)
+
+	for _, backend := range []string{"postgres", "cassandra"} {
+		_, err := api.InitRoutes(gin.New(), config.Config{UserAPIURL: "http://localhost:8080", UserStorage: backend}, nil, nil)
+		require.ErrorContains(t, err, "unknown USER_STORAGE", backend)
+	}
+
+	// en Redis los usuarios los ven todas las instancias, y sobreviven a un reinicio
+	mr := miniredis.RunT(t)
+	cfg := config.Config{UserAPIURL: "http://localhost:8080", UserStorage: "redis", RedisAddr: mr.Addr()}
+	first, second := gin.New(), gin.New()
+	initRoutes(t, first, cfg, nil, nil)
+	initRoutes(t, second, cfg, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBufferString(`{"name":"Ayrton","email":"ayrton@example.com"}`))
+	res := fakeRequest(first, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+	var created user.User
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &created))
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/users/"+created.ID, nil)
+	res = fakeRequest(second, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Contains(t, res.Body.String(), `"name":"Ayrton"`)
+}
+
+func TestIntegrationUserSales(t *testing.T) {
+	app := gin.Default()
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+	initRoutes(t, app, config.Config{UserAPIURL: srv.URL}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBufferString(`{"name":"Ayrton"}`))
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+	var resUser user.User
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &resUser))
+
+	var created []sales.Sale
+	for range 2 {
+		req, _ = http.NewRequest(http.MethodPost, "/v1/sales", bytes.NewBufferString(`{"user_id":"`+resUser.ID+`","amount":10}`))
+		res = fakeRequest(app, req)
+		require.Equal(t, http.StatusCreated, res.Code)
+		var sale sales.Sale
+		require.NoError(t, json.Unmarshal(res.Body.Bytes(), &sale))
+		created = append(created, sale)
+	}
+
+	var page struct {
+		Data []struct {
+			ID     string `json:"id"`
+			UserID string `json:"user_id"`
+			Status string `json:"status"`
+		} `json:"data"`
+		Meta struct {
+			Total int `json:"total"`
+		} `json:"meta"`
+	}
+	req, _ = http.NewRequest(http.MethodGet, "/v1/users/"+resUser.ID+"/sales?limit=1", nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &page))
+	require.Len(t, page.Data, 1)
+	require.Equal(t, created[0].ID, page.Data[0].ID)
+	require.Equal(t, 2, page.Meta.Total)
+
+	status := string(created[1].Status)
+	req, _ = http.NewRequest(http.MethodGet, "/v1/users/"+resUser.ID+"/sales?status="+status, nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &page))
+	for _, sale := range page.Data {
+		require.Equal(t, status, sale.Status)
+		require.Equal(t, resUser.ID, sale.UserID)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/users/"+resUser.ID+"/sales?status=lost", nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusBadRequest, res.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/users/missing/sales", nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusNotFound, res.Code)
+}
+
+func TestIntegrationSalesBySeller(t *testing.T) {
+	app := gin.Default()
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+	initRoutes(t, app, config.Config{
+		UserAPIURL: srv.URL,
+		UserAPIKey: "internal-secret",
+		APIKeys: []config.APIKey{
+			{ID: "shop", Secret: "shop-secret"},
+			{ID: "internal", Secret: "internal-secret"},
+		},
+	}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBufferString(`{"name":"Ayrton"}`))
+	req.Header.Set("X-API-Key", "shop-secret")
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+	var resUser user.User
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &resUser))
+
+	for _, secret := range []string{"shop-secret", "shop-secret", "internal-secret"} {
+		req, _ = http.NewRequest(http.MethodPost, "/v1/sales", bytes.NewBufferString(`{"user_id":"`+resUser.ID+`","amount":10}`))
+		req.Header.Set("X-API-Key", secret)
+		res = fakeRequest(app, req)
+		require.Equal(t, http.StatusCreated, res.Code)
+		require.Contains(t, res.Body.String(), `"created_by":"apikey:`)
+	}
+
+	today := time.Now().UTC().Format(time.DateOnly)
+	req, _ = http.NewRequest(http.MethodGet, "/v1/sales/reports/by-seller?from="+today+"&to="+today, nil)
+	req.Header.Set("X-API-Key", "internal-secret")
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	var report struct {
+		Sellers []struct {
+			Seller   string `json:"seller"`
+			Quantity int    `json:"quantity"`
+		} `json:"sellers"`
+	}
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &report))
+	quantities := map[string]int{}
+	for _, s := range report.Sellers {
+		quantities[s.Seller] = s.Quantity
+	}
+	require.Equal(t, map[string]int{"apikey:shop": 2, "apikey:internal": 1}, quantities)
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/sales/reports/by-seller?from=yesterday", nil)
+	req.Header.Set("X-API-Key", "internal-secret")
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusBadRequest, res.Code)
+	require.Contains(t, res.Body.String(), `"code":"invalid_date_range"`)
+}
+
+func TestIntegrationListAlerts(t *testing.T) {
+	app := gin.Default()
+	initRoutes(t, app, config.Config{UserAPIURL: "http://localhost:8080", AnomalyInterval: time.Minute}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodGet, "/v1/admin/alerts", nil)
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.JSONEq(t, `{"results":[]}`, res.Body.String())
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/admin/jobs", nil)
+	res = fakeRequest(app, req)
+	require.Contains(t, res.Body.String(), `"name":"anomalies"`)
+}
+
+func TestIntegrationRejectionBreaker(t *testing.T) {
+	app := gin.Default()
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+	initRoutes(t, app, config.Config{UserAPIURL: srv.URL, StatusSeed: 42,
+		BreakerRejectionRate: 0.01, BreakerWindow: time.Hour, BreakerMinSales: 1, BreakerCooldown: time.Hour}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBufferString(`{"name":"Ayrton"}`))
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+	var resUser *user.User
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &resUser))
+
+	createSale := func() sales.SaleStatus {
+		req, _ := http.NewRequest(http.MethodPost, "/v1/sales", bytes.NewBufferString(`{"user_id":"`+resUser.ID+`","amount":10.5}`))
+		res := fakeRequest(app, req)
+		require.Equal(t, http.StatusCreated, res.Code)
+		var resSale *sales.Sale
+		require.NoError(t, json.Unmarshal(res.Body.Bytes(), &resSale))
+		return resSale.Status
+	}
+	for i := 0; createSale() != sales.StatusRejected; i++ {
+		require.Less(t, i, 100)
+	}
+	require.Equal(t, sales.StatusPending, createSale())
+	require.Equal(t, sales.StatusPending, createSale())
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/admin/alerts", nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Contains(t, res.Body.String(), `"kind":"rejection_breaker"`)
+}
+
+func TestIntegrationSaleNotes(t *testing.T) {
+	app := gin.Default()
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+	// con cifrado, las notas se guardan cifradas y se leen en claro
+	initRoutes(t, app, config.Config{UserAPIURL: srv.URL, SalesStorage: "events",
+		EncryptionKey: "BwcHBwcHBwcHBwcHBwcHBwcHBwcHBwcHBwcHBwcHBwc="}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/onboarding", bytes.NewBufferString(`{"name":"Ayrton","amount":10}`))
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+	var body struct {
+		Sale *sales.Sale `json:"sale"`
+	}
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &body))
+
+	req, _ = http.NewRequest(http.MethodPost, "/v1/sales/"+body.Sale.ID+"/notes", bytes.NewBufferString(`{"text":"  "}`))
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusBadRequest, res.Code)
+
+	req, _ = http.NewRequest(http.MethodPost, "/v1/sales/"+body.Sale.ID+"/notes", bytes.NewBufferString(`{"text":"customer called about the invoice"}`))
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+	var note sales.Note
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &note))
+	require.NotEmpty(t, note.ID)
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/sales/"+body.Sale.ID+"/notes", nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	var notes struct {
+		Results []sales.Note `json:"results"`
+	}
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &notes))
+	require.Len(t, notes.Results, 1)
+	require.Equal(t, "customer called about the invoice", notes.Results[0].Text)
+
+	// la nota queda en la historia de la venta
+	req, _ = http.NewRequest(http.MethodGet, "/v1/sales/"+body.Sale.ID+"/history", nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	var history struct {
+		Sale   *sales.Sale         `json:"sale"`
+		Events []sales.StreamEvent `json:"events"`
+	}
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &history))
+	require.Len(t, history.Sale.OperatorNotes, 1)
+	last := history.Events[len(history.Events)-1]
+	require.Equal(t, sales.StreamNoted, last.Type)
+	require.Equal(t, "customer called about the invoice", last.Note.Text)
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/sales/missing/notes", nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusNotFound, res.Code)
+}
+
+func TestIntegrationSaleAttachments(t *testing.T) {
+	app := gin.Default()
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+	initRoutes(t, app, config.Config{UserAPIURL: srv.URL, AttachmentsDir: t.TempDir(),
+		AttachmentMaxBytes: 1024, AttachmentTypes: []string{"image/png", "application/pdf"}}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/onboarding", bytes.NewBufferString(`{"name":"Ayrton","amount":10}`))
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+	var body struct {
+		Sale *sales.Sale `json:"sale"`
+	}
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &body))
+
+	upload := func(name string, data []byte) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+		part, err := w.CreateFormFile("file", name)
+		require.NoError(t, err)
+		_, err = part.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		req, _ := http.NewRequest(http.MethodPost, "/v1/sales/"+body.Sale.ID+"/attachments", &buf)
+		req.Header.Set("Content-Type", w.FormDataContentType())
+		return fakeRequest(app, req)
+	}
+
+	res = upload("notes.txt", []byte("just some text"))
+	require.Equal(t, http.StatusBadRequest, res.Code)
+	require.Contains(t, res.Body.String(), "unsupported_attachment")
+
+	pdf := []byte("%PDF-1.4\n%signed contract\n")
+	res = upload("contract.pdf", pdf)
+	require.Equal(t, http.StatusCreated, res.Code)
+	var attachment sales.Attachment
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &attachment))
+	require.Equal(t, "contract.pdf", attachment.Name)
+	require.Equal(t, "application/pdf", attachment.ContentType)
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/sales/"+body.Sale.ID+"/attachments", nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	var list struct {
+		Results []sales.Attachment `json:"results"`
+	}
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &list))
+	require.Equal(t, []sales.Attachment{attachment}, list.Results)
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/sales/"+body.Sale.ID+"/attachments/"+attachment.ID, nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Equal(t, "application/pdf", res.Header().Get("Content-Type"))
+	require.Equal(t, `attachment; filename=contract.pdf`, res.Header().Get("Content-Disposition"))
+	require.Equal(t, pdf, res.Body.Bytes())
+
+	req, _ = http.NewRequest(http.MethodPost, "/v1/sales/"+body.Sale.ID+"/attachments", bytes.NewBufferString(`{}`))
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusBadRequest, res.Code)
+}
+
+func TestIntegrationSaleAttachmentsDisabled(t *testing.T) {
+	app := gin.Default()
+	initRoutes(t, app, config.Config{UserAPIURL: "http://localhost:8080"}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodGet, "/v1/sales/1/attachments", nil)
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusNotFound, res.Code)
+	require.Contains(t, res.Body.String(), "attachments_unavailable")
+}
+
+func TestIntegrationWebhooks(t *testing.T) {
+	received := make(chan []byte, 10)
+	consumer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- body
+	}))
+	defer consumer.Close()
+
+	app := gin.Default()
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+	initRoutes(t, app, config.Config{UserAPIURL: srv.URL, NotifyMaxAttempts: 1, WebhookPrivateTargets: true}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/webhooks", bytes.NewBufferString(`{"url":"ftp://example.com"}`))
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusBadRequest, res.Code)
+	require.Contains(t, res.Body.String(), "invalid_webhook")
+
+	req, _ = http.NewRequest(http.MethodPost, "/v1/webhooks", bytes.NewBufferString(`{"url":"`+consumer.URL+`","events":["sale.created"],"format":"diff"}`))
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+	var sub map[string]any
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &sub))
+	require.Equal(t, float64(1), sub["schema_version"])
+
+	req, _ = http.NewRequest(http.MethodPost, "/v1/onboarding", bytes.NewBufferString(`{"name":"Ayrton","amount":10}`))
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+
+	select {
+	case body := <-received:
+		var payload map[string]any
+		require.NoError(t, json.Unmarshal(body, &payload))
+		require.Equal(t, "sale.created", payload["type"])
+		require.Contains(t, payload["changes"], "amount")
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook not delivered")
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/webhooks", nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Contains(t, res.Body.String(), sub["id"].(string))
+
+	require.Eventually(t, func() bool {
+		req, _ := http.NewRequest(http.MethodGet, "/v1/webhooks/"+sub["id"].(string)+"/deliveries?outcome=succeeded", nil)
+		res := fakeRequest(app, req)
+		return res.Code == http.StatusOK && strings.Contains(res.Body.String(), `"status_code":200`)
+	}, 2*time.Second, 10*time.Millisecond)
+	req, _ = http.NewRequest(http.MethodGet, "/v1/webhooks/"+sub["id"].(string)+"/deliveries?outcome=failed", nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.JSONEq(t, `{"results":[]}`, res.Body.String())
+	req, _ = http.NewRequest(http.MethodGet, "/v1/webhooks/"+sub["id"].(string)+"/deliveries?outcome=lost", nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusBadRequest, res.Code)
+	require.Contains(t, res.Body.String(), "invalid_delivery_outcome")
+
+	req, _ = http.NewRequest(http.MethodDelete, "/v1/webhooks/"+sub["id"].(string), nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusNoContent, res.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/webhooks/"+sub["id"].(string), nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusNotFound, res.Code)
+}
+
+func TestIntegrationWebhookSignatures(t *testing.T) {
+	type delivery struct {
+		signature string
+		body      []byte
+	}
+	received := make(chan delivery, 10)
+	consumer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- delivery{signature: r.Header.Get(webhook.SignatureHeader), body: body}
+	}))
+	defer consumer.Close()
+
+	app := gin.Default()
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+	initRoutes(t, app, config.Config{UserAPIURL: srv.URL, NotifyMaxAttempts: 1, WebhookSecretGrace: time.Hour, WebhookPrivateTargets: true}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/webhooks", bytes.NewBufferString(`{"url":"`+consumer.URL+`"}`))
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+	var sub struct {
+		ID     string `json:"id"`
+		Secret string `json:"secret"`
+	}
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &sub))
+	require.NotEmpty(t, sub.Secret)
+	old := sub.Secret
+
+	// el secreto no se vuelve a mostrar
+	req, _ = http.NewRequest(http.MethodGet, "/v1/webhooks/"+sub.ID, nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.NotContains(t, res.Body.String(), old)
+
+	onboard := func() delivery {
+		req, _ := http.NewRequest(http.MethodPost, "/v1/onboarding", bytes.NewBufferString(`{"name":"Ayrton","amount":10}`))
+		res := fakeRequest(app, req)
+		require.Equal(t, http.StatusCreated, res.Code)
+		select {
+		case d := <-received:
+			return d
+		case <-time.After(2 * time.Second):
+			t.Fatal("webhook not delivered")
+			return delivery{}
+		}
+	}
+	d := onboard()
+	require.NoError(t, webhook.Verify(d.signature, d.body, old, time.Now(), 5*time.Minute))
+
+	req, _ = http.NewRequest(http.MethodPost, "/v1/webhooks/"+sub.ID+"/rotate-secret", nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &sub))
+	require.NotEqual(t, old, sub.Secret)
+	require.Contains(t, res.Body.String(), "previous_secret_expires_at")
+
+	d = onboard()
+	require.NoError(t, webhook.Verify(d.signature, d.body, sub.Secret, time.Now(), 5*time.Minute))
+	require.NoError(t, webhook.Verify(d.signature, d.body, old, time.Now(), 5*time.Minute))
+
+	req, _ = http.NewRequest(http.MethodPost, "/v1/webhooks/nope/rotate-secret", nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusNotFound, res.Code)
+}
+
+func TestIntegrationWebhookPrivateTargets(t *testing.T) {
+	app := gin.Default()
+	initRoutes(t, app, config.Config{UserAPIURL: "http://localhost:8080"}, nil, nil)
+
+	// los webhooks no sirven para llegar a la red interna ni a la metadata de la nube
+	for _, target := range []string{
+		"http://127.0.0.1:8080/admin", "http://localhost:8080", "http://10.0.0.5/hook",
+		"http://169.254.169.254/latest/meta-data", "http://[::1]/hook", "http://0.0.0.0:8080",
+	} {
+		req, _ := http.NewRequest(http.MethodPost, "/v1/webhooks", bytes.NewBufferString(`{"url":"`+target+`"}`))
+		res := fakeRequest(app, req)
+		require.Equal(t, http.StatusBadRequest, res.Code, target)
+		require.Contains(t, res.Body.String(), "invalid_webhook", target)
+	}
+}
+
+func TestIntegrationEventBusBackends(t *testing.T) {
+	// la conexión a RabbitMQ se abre con el primer evento, así que arranca sin broker
+	initRoutes(t, gin.New(), config.Config{UserAPIURL: "http://localhost:8080", EventBus: "amqp", AMQPURL: "amqp://localhost:1/"}, nil, nil)
+	_, err := api.InitRoutes(gin.New(), config.Config{UserAPIURL: "http://localhost:8080", EventBus: "kafka"}, nil, nil)
+	require.ErrorContains(t, err, `unknown EVENT_BUS "kafka"`)
+}
+
+func TestIntegrationTracePropagation(t *testing.T) {
+	app := gin.Default()
+	var traceparent, requestID string
+	userAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent, requestID = r.Header.Get(tracing.Header), r.Header.Get(tracing.RequestIDHeader)
+		app.ServeHTTP(w, r)
+	}))
+	defer userAPI.Close()
+	initRoutes(t, app, config.Config{UserAPIURL: userAPI.URL}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/onboarding", bytes.NewBufferString(`{"name":"Ayrton","amount":10}`))
+	req.Header.Set(tracing.Header, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set(tracing.RequestIDHeader, "req-1")
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+
+	require.Equal(t, "req-1", requestID)
+	sc, ok := tracing.Parse(traceparent)
+	require.True(t, ok)
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID)
+	require.NotEqual(t, "00f067aa0ba902b7", sc.SpanID)
+	require.True(t, sc.Sampled)
+}
+
+func TestIntegrationUserAPIMetrics(t *testing.T) {
+	app := gin.Default()
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+	initRoutes(t, app, config.Config{UserAPIURL: srv.URL, UserCache: "memory", UserCacheTTL: time.Minute}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBufferString(`{"name":"Ayrton"}`))
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+	var resUser *user.User
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &resUser))
+
+	for _, userID := range []string{resUser.ID, resUser.ID, "unknown"} {
+		req, _ = http.NewRequest(http.MethodPost, "/v1/sales", bytes.NewBufferString(`{"user_id":"`+userID+`","amount":10}`))
+		fakeRequest(app, req)
+	}
+
+	// las métricas solo se sirven en el puerto interno
+	req, _ = http.NewRequest(http.MethodGet, "/debug/vars", nil)
+	require.Equal(t, http.StatusNotFound, fakeRequest(app, req).Code)
+
+	res = httptest.NewRecorder()
+	api.DebugHandler().ServeHTTP(res, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	var vars struct {
+		Metrics struct {
+			UserAPI struct {
+				Calls map[string]int64 `json:"calls"`
+			} `json:"user_api"`
+			UserCache struct {
+				Hits   int64 `json:"hits"`
+				Misses int64 `json:"misses"`
+			} `json:"user_cache"`
+		} `json:"metrics"`
+	}
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &vars))
+	require.Equal(t, map[string]int64{"success": 2, "not_found": 1}, vars.Metrics.UserAPI.Calls)
+	require.Equal(t, int64(1), vars.Metrics.UserCache.Hits)
+	require.Equal(t, int64(2), vars.Metrics.UserCache.Misses)
+	require.Contains(t, res.Body.String(), `"sales_storage"`)
+	require.Contains(t, res.Body.String(), `"user_storage"`)
+}
+
+func TestIntegrationRequestLogger(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	app := gin.New()
+	initRoutes(t, app, config.Config{
+		UserAPIURL: "http://127.0.0.1:1",
+		APIKeys:    []config.APIKey{{ID: "shop", Secret: "shop-secret", Tenant: "acme"}},
+	}, nil, &logging.Logger{Logger: zap.New(core), Level: zap.NewAtomicLevel()})
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/sales", bytes.NewBufferString(`{"user_id":"1","amount":10}`))
+	req.Header.Set("X-API-Key", "shop-secret")
+	req.Header.Set("X-Request-ID", "req-1")
+	req.Header.Set("X-Tenant-ID", "acme")
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusServiceUnavailable, res.Code)
+
+	// lo registrado por el servicio y por el handler lleva los mismos campos
+	for _, msg := range []string{"error validating user", "request failed"} {
+		entries := logs.FilterMessage(msg).All()
+		require.Len(t, entries, 1, msg)
+		fields := entries[0].ContextMap()
+		require.Equal(t, "req-1", fields["request_id"], msg)
+		require.Equal(t, "acme", fields["tenant"], msg)
+		require.Equal(t, "apikey:shop", fields["actor"], msg)
+	}
+}
+
+func TestIntegrationForceSaleStatus(t *testing.T) {
+	app := gin.Default()
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+	initRoutes(t, app, config.Config{
+		UserAPIURL: srv.URL,
+		UserAPIKey: "ops-secret",
+		APIKeys: []config.APIKey{
+			{ID: "shop", Secret: "shop-secret"},
+			{ID: "ops", Secret: "ops-secret", Admin: true},
+		},
+	}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBufferString(`{"name":"Ayrton"}`))
+	req.Header.Set("X-API-Key", "shop-secret")
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+	var resUser *user.User
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &resUser))
+
+	req, _ = http.NewRequest(http.MethodPost, "/v1/sales", bytes.NewBufferString(`{"user_id":"`+resUser.ID+`","amount":10}`))
+	req.Header.Set("X-API-Key", "shop-secret")
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+	var sale sales.Sale
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &sale))
+
+	// el estado inicial es aleatorio
+	status := sales.StatusApproved
+	if sale.Status == sales.StatusApproved {
+		status = sales.StatusPending
+	}
+	body := `{"status":"` + string(status) + `","reason":"payment incident 42"}`
+
+	req, _ = http.NewRequest(http.MethodPost, "/v1/admin/sales/"+sale.ID+"/force-status", bytes.NewBufferString(body))
+	req.Header.Set("X-API-Key", "shop-secret")
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusForbidden, res.Code)
+	require.Contains(t, res.Body.String(), "admin_required")
+
+	req, _ = http.NewRequest(http.MethodPost, "/v1/admin/sales/"+sale.ID+"/force-status", bytes.NewBufferString(`{"status":"`+string(status)+`"}`))
+	req.Header.Set("X-API-Key", "ops-secret")
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusBadRequest, res.Code)
+	require.Contains(t, res.Body.String(), "force_reason_required")
+
+	req, _ = http.NewRequest(http.MethodPost, "/v1/admin/sales/"+sale.ID+"/force-status", bytes.NewBufferString(body))
+	req.Header.Set("X-API-Key", "ops-secret")
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	var got sales.Sale
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &got))
+	require.Equal(t, status, got.Status)
+	require.Equal(t, "apikey:ops", got.StatusChangedBy)
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/admin/sales/"+sale.ID+"/audit", nil)
+	req.Header.Set("X-API-Key", "ops-secret")
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	var log struct {
+		Audit []audit.Entry `json:"audit"`
+	}
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &log))
+	require.Len(t, log.Audit, 1)
+	require.Equal(t, sales.ActionStatusForced, log.Audit[0].Action)
+	require.Equal(t, "apikey:ops", log.Audit[0].Actor)
+	require.Equal(t, "payment incident 42", log.Audit[0].Reason)
+}
+
+func TestIntegrationReprocessSale(t *testing.T) {
+	app := gin.Default()
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+	initRoutes(t, app, config.Config{UserAPIURL: srv.URL}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBufferString(`{"name":"Ayrton"}`))
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+	var resUser *user.User
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &resUser))
+
+	// el estado inicial es aleatorio
+	createSale := func(want sales.SaleStatus) sales.Sale {
+		var sale sales.Sale
+		require.Eventually(t, func() bool {
+			req, _ := http.NewRequest(http.MethodPost, "/v1/sales", bytes.NewBufferString(`{"user_id":"`+resUser.ID+`","amount":10}`))
+			res := fakeRequest(app, req)
+			require.Equal(t, http.StatusCreated, res.Code)
+			require.NoError(t, json.Unmarshal(res.Body.Bytes(), &sale))
+			return sale.Status == want
+		}, 2*time.Second, time.Millisecond)
+		return sale
+	}
+
+	approved := createSale(sales.StatusApproved)
+	req, _ = http.NewRequest(http.MethodPost, "/v1/sales/"+approved.ID+"/reprocess", nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusConflict, res.Code)
+	require.Contains(t, res.Body.String(), "sale_not_reprocessable")
+
+	rejected := createSale(sales.StatusRejected)
+	req, _ = http.NewRequest(http.MethodPost, "/v1/sales/"+rejected.ID+"/reprocess", nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	var got sales.Sale
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &got))
+	require.Equal(t, rejected.Number, got.Number)
+	require.Equal(t, rejected.Version+1, got.Version)
+}
+
+func TestIntegrationExportJobs(t *testing.T) {
+	app := gin.Default()
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+	initRoutes(t, app, config.Config{
+		UserAPIURL:         srv.URL,
+		ExportJobsDir:      t.TempDir(),
+		ExportJobPartSize:  2,
+		ExportJobsInterval: 10 * time.Millisecond,
+	}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBufferString(`{"name":"Ayrton"}`))
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+	var resUser *user.User
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &resUser))
+	for i := 0; i < 3; i++ {
+		req, _ = http.NewRequest(http.MethodPost, "/v1/sales", bytes.NewBufferString(`{"user_id":"`+resUser.ID+`","amount":10}`))
+		require.Equal(t, http.StatusCreated, fakeRequest(app, req).Code)
+	}
+
+	req, _ = http.NewRequest(http.MethodPost, "/v1/sales/exports", bytes.NewBufferString(`{"format":"parquet"}`))
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusBadRequest, res.Code)
+	require.Contains(t, res.Body.String(), "invalid_job_format")
+
+	req, _ = http.NewRequest(http.MethodPost, "/v1/sales/exports", nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusAccepted, res.Code)
+	var job struct {
+		ID          string `json:"id"`
+		Status      string `json:"status"`
+		Sales       int    `json:"sales"`
+		DownloadURL string `json:"download_url"`
+	}
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &job))
+	require.Equal(t, "/v1/sales/exports/"+job.ID, res.Header().Get("Location"))
+
+	require.Eventually(t, func() bool {
+		req, _ := http.NewRequest(http.MethodGet, "/v1/sales/exports/"+job.ID, nil)
+		res := fakeRequest(app, req)
+		require.Equal(t, http.StatusOK, res.Code)
+		require.NoError(t, json.Unmarshal(res.Body.Bytes(), &job))
+		return job.Status == "succeeded"
+	}, 2*time.Second, 10*time.Millisecond)
+	require.Equal(t, 3, job.Sales)
+	require.Equal(t, "/v1/sales/exports/"+job.ID+"/download", job.DownloadURL)
+
+	req, _ = http.NewRequest(http.MethodGet, job.DownloadURL, nil)
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Equal(t, "application/x-ndjson", res.Header().Get("Content-Type"))
+	require.Len(t, strings.Split(strings.TrimSpace(res.Body.String()), "\n"), 3)
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/sales/exports/unknown", nil)
+	require.Equal(t, http.StatusNotFound, fakeRequest(app, req).Code)
+}
+
+func TestIntegrationConfigBundle(t *testing.T) {
+	app := gin.Default()
+	initRoutes(t, app, config.Config{
+		UserAPIURL: "http://127.0.0.1:1",
+		APIKeys: []config.APIKey{
+			{ID: "shop", Secret: "shop-secret"},
+			{ID: "ops", Secret: "ops-secret", Admin: true},
+		},
+		WebhookPrivateTargets: true,
+	}, nil, nil)
+
+	req, _ := http.NewRequest(http.MethodGet, "/v1/admin/config", nil)
+	req.Header.Set("X-API-Key", "shop-secret")
+	require.Equal(t, http.StatusForbidden, fakeRequest(app, req).Code)
+
+	body := `{"version":1,"webhooks":[{"url":"https://hooks.example.com/sales","format":"diff"}],
+		"api_keys":[{"id":"shop","name":"Shop","sale_quota":5}],"thresholds":{"channel_notify":250.00}}`
+	req, _ = http.NewRequest(http.MethodPost, "/v1/admin/config/import", bytes.NewBufferString(body))
+	req.Header.Set("X-API-Key", "ops-secret")
+	res := fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	var result struct {
+		Webhooks []struct {
+			Created bool   `json:"created"`
+			Secret  string `json:"secret"`
+		} `json:"webhooks"`
+		UpdatedKeys []string `json:"updated_keys"`
+	}
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &result))
+	require.Len(t, result.Webhooks, 1)
+	require.True(t, result.Webhooks[0].Created)
+	require.NotEmpty(t, result.Webhooks[0].Secret)
+	require.Equal(t, []string{"shop"}, result.UpdatedKeys)
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/admin/config", nil)
+	req.Header.Set("X-API-Key", "ops-secret")
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Contains(t, res.Body.String(), `"url":"https://hooks.example.com/sales"`)
+	require.Contains(t, res.Body.String(), `"channel_notify":250.00`)
+	require.Contains(t, res.Body.String(), `"sale_quota":5`)
+	require.NotContains(t, res.Body.String(), "secret")
+
+	req, _ = http.NewRequest(http.MethodPost, "/v1/admin/config/import", bytes.NewBufferString(`{"version":7}`))
+	req.Header.Set("X-API-Key", "ops-secret")
+	res = fakeRequest(app, req)
+	require.Equal(t, http.StatusBadRequest, res.Code)
+	require.Contains(t, res.Body.String(), "invalid_bundle")
+}